@@ -10,8 +10,10 @@ import (
 	"besedka/static"
 	"context"
 	oshttp "net/http"
+	"net/http/cookiejar"
 	"net/http/httptest"
 	"net/url"
+	"strconv"
 	"strings"
 	"testing"
 	"time"
@@ -48,18 +50,18 @@ func (m *mockStorage) ListAllCredentials() ([]auth.UserCredentials, error) {
 	}
 	return list, nil
 }
-func (m *mockStorage) UpsertToken(uid, hash string) error     { return nil }
-func (m *mockStorage) DeleteToken(hash string) error          { return nil }
-func (m *mockStorage) ListTokens() (map[string]string, error) { return nil, nil }
+func (m *mockStorage) UpsertSession(session auth.Session) error { return nil }
+func (m *mockStorage) DeleteToken(hash string) error             { return nil }
+func (m *mockStorage) ListSessions() ([]auth.Session, error)     { return nil, nil }
 func (m *mockStorage) UpsertRegistrationToken(uid, token string) error {
 	m.regTokens[token] = uid
 	return nil
 }
 func (m *mockStorage) DeleteRegistrationToken(uid string) error           { return nil }
 func (m *mockStorage) ListRegistrationTokens() (map[string]string, error) { return m.regTokens, nil }
-func (m *mockStorage) UpsertAPIKey(userID string, keyHash string) error   { return nil }
+func (m *mockStorage) UpsertAPIKey(key auth.APIKey) error                 { return nil }
 func (m *mockStorage) DeleteAPIKey(keyHash string) error                  { return nil }
-func (m *mockStorage) ListAPIKeys() (map[string]string, error)             { return nil, nil }
+func (m *mockStorage) ListAPIKeys() ([]auth.APIKey, error)                { return nil, nil }
 
 func (m *mockStorage) GetVAPIDKeys() (string, string, error)             { return "", "", models.ErrNotFound }
 func (m *mockStorage) SaveVAPIDKeys(priv, pub string) error             { return nil }
@@ -70,16 +72,34 @@ func (m *mockStorage) UpsertPasskey(pk auth.Passkey) error               { retur
 func (m *mockStorage) ListPasskeys(userID string) ([]auth.Passkey, error) { return nil, nil }
 func (m *mockStorage) DeletePasskey(userID string, credentialID []byte) error { return nil }
 func (m *mockStorage) DeleteAllPasskeys(userID string) error             { return nil }
+func (m *mockStorage) UpsertAdmin(admin auth.Admin) error               { return nil }
+func (m *mockStorage) DeleteAdmin(adminID string) error                  { return nil }
+func (m *mockStorage) ListAdmins() ([]auth.Admin, error)                 { return nil, nil }
+func (m *mockStorage) UpsertAdminToken(token auth.AdminToken) error      { return nil }
+func (m *mockStorage) DeleteAdminToken(tokenHash string) error           { return nil }
+func (m *mockStorage) ListAdminTokens() ([]auth.AdminToken, error)       { return nil, nil }
+func (m *mockStorage) AddAdminAuditEntry(e models.AdminAuditEntry) error { return nil }
+func (m *mockStorage) ListAdminAuditEntries(adminID string, limit int) ([]models.AdminAuditEntry, error) {
+	return nil, nil
+}
 
 // ws.storage implementation
 func (m *mockStorage) UpsertMessage(message models.Message) error { return nil }
 func (m *mockStorage) ListMessages(chatID string, from, to int64) ([]models.Message, error) {
 	return nil, nil
 }
+func (m *mockStorage) GetMessages(chatID string, seqs []int64) ([]models.Message, error) {
+	return nil, nil
+}
+func (m *mockStorage) ListReplies(chatID string, seq, after int64, limit int) ([]int64, error) {
+	return nil, nil
+}
 func (m *mockStorage) ListChats() ([]models.Chat, error) { return nil, nil }
 func (m *mockStorage) UpsertChat(chat models.Chat) error { return nil }
 func (m *mockStorage) SaveLastSeenBatch(batch []models.LastSeenEntry) error { return nil }
 func (m *mockStorage) ListLastSeen() ([]models.LastSeenEntry, error)       { return nil, nil }
+func (m *mockStorage) SetDisappearAfter(chatID string, seconds int64) error { return nil }
+func (m *mockStorage) FileUploader(id string) (string, error)              { return "", models.ErrNotFound }
 
 type mockPushService struct{}
 
@@ -89,10 +109,8 @@ func TestAdminUI(t *testing.T) {
 	t.Parallel()
 	// Setup dependencies
 	cfg := &config.Config{
-		AdminUser:     "admin",
-		AdminPassword: "password",
-		AdminAddr:     "localhost:0",
-		AuthSecret:    "c2VjcmV0", // base64 "secret"
+		AdminAddr:  "localhost:0",
+		AuthSecret: "c2VjcmV0", // base64 "secret"
 	}
 
 	store := &mockStorage{
@@ -125,6 +143,11 @@ func TestAdminUI(t *testing.T) {
 	defer ts.Close()
 
 	client := ts.Client()
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		t.Fatalf("Failed to create cookie jar: %v", err)
+	}
+	client.Jar = jar
 
 	// 1. Test Unauthorized Access
 	resp, err := client.Get(ts.URL)
@@ -135,23 +158,32 @@ func TestAdminUI(t *testing.T) {
 		t.Errorf("Expected 401, got %d", resp.StatusCode)
 	}
 
-	// 2. Test Authorized Access (List Users - Empty)
-	req, _ := oshttp.NewRequest("GET", ts.URL, nil)
-	req.SetBasicAuth("admin", "password")
-	resp, err = client.Do(req)
+	// 2. Sign in with the bootstrapped admin's password and TOTP
+	admin, _, _, err := authService.BootstrapAdmin(authService.BootstrapToken(), "admin", "correct-horse-battery", auth.ClientInfo{})
 	if err != nil {
-		t.Fatalf("Failed to get authorized: %v", err)
+		t.Fatalf("Failed to bootstrap admin: %v", err)
+	}
+	totp, err := auth.GenerateTOTP(admin.TOTPSecret, time.Now())
+	if err != nil {
+		t.Fatalf("Failed to generate TOTP: %v", err)
+	}
+	form := url.Values{}
+	form.Add("username", "admin")
+	form.Add("password", "correct-horse-battery")
+	form.Add("totp", strconv.Itoa(totp))
+	resp, err = client.PostForm(ts.URL+"/admin/login", form)
+	if err != nil {
+		t.Fatalf("Failed to log in: %v", err)
 	}
 	if resp.StatusCode != oshttp.StatusOK {
-		t.Errorf("Expected 200, got %d", resp.StatusCode)
+		t.Errorf("Expected 200 (after redirect), got %d", resp.StatusCode)
 	}
 
 	// 3. Test Add User
-	form := url.Values{}
+	form = url.Values{}
 	form.Add("username", "testuser")
-	req, _ = oshttp.NewRequest("POST", ts.URL+"/admin/users", strings.NewReader(form.Encode()))
+	req, _ := oshttp.NewRequest("POST", ts.URL+"/admin/users", strings.NewReader(form.Encode()))
 	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
-	req.SetBasicAuth("admin", "password")
 
 	resp, err = client.Do(req)
 	if err != nil {
@@ -172,7 +204,6 @@ func TestAdminUI(t *testing.T) {
 	form.Add("id", users[0].ID)
 	req, _ = oshttp.NewRequest("POST", ts.URL+"/admin/users/delete", strings.NewReader(form.Encode()))
 	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
-	req.SetBasicAuth("admin", "password")
 
 	// Go client follows redirects
 	resp, err = client.Do(req)
@@ -44,6 +44,7 @@ type TestServer struct {
 	BaseURL     string
 	DBPath      string
 	UploadsPath string
+	AdminToken  string
 	Cmd         *exec.Cmd
 	Logs        *safeBuffer
 }
@@ -101,6 +102,7 @@ func startServer(t *testing.T) *TestServer {
 	cmd := exec.Command(serverBinPath)
 	cmd.Env = append(os.Environ(),
 		"AUTH_SECRET=test-secret-key-must-be-long-enough-for-base64-if-needed",
+		"ADMIN_BOOTSTRAP_TOKEN="+e2eBootstrapToken,
 		fmt.Sprintf("API_ADDR=%s", apiAddr),
 		fmt.Sprintf("ADMIN_ADDR=%s", adminAddr),
 		fmt.Sprintf("BASE_URL=%s", baseURL),
@@ -130,10 +132,34 @@ func startServer(t *testing.T) *TestServer {
 	// CLI (CreateUser) talks to.
 	waitForListening(t, server, apiAddr, 15*time.Second, "API server failed to start")
 	waitForListening(t, server, adminAddr, 15*time.Second, "Admin server failed to start")
+	server.bootstrapAdmin(t)
 
 	return server
 }
 
+// e2eBootstrapToken is the bootstrap token test servers are started with.
+const e2eBootstrapToken = "e2e-bootstrap-token"
+
+// bootstrapAdmin creates the first admin account and keeps its token for the
+// admin API calls and CLI commands of the test.
+func (s *TestServer) bootstrapAdmin(t *testing.T) {
+	reqBody, _ := json.Marshal(map[string]string{
+		"username":       "admin",
+		"password":       "e2e-admin-password",
+		"bootstrapToken": e2eBootstrapToken,
+	})
+	resp, err := http.Post(fmt.Sprintf("http://%s/api/admins/bootstrap", s.AdminAddr), "application/json", bytes.NewReader(reqBody))
+	require.NoError(t, err)
+	defer func() { _ = resp.Body.Close() }()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var result struct {
+		Token string `json:"token"`
+	}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&result))
+	s.AdminToken = result.Token
+}
+
 func (s *TestServer) Kill() {
 	if s.Cmd != nil && s.Cmd.Process != nil {
 		_ = s.Cmd.Process.Kill()
@@ -196,6 +222,7 @@ func (s *TestServer) CreateUser(t *testing.T, username string) string {
 	cmd := exec.Command(serverBinPath, "-add-user", username)
 	cmd.Env = append(os.Environ(),
 		fmt.Sprintf("ADMIN_ADDR=%s", s.AdminAddr),
+		fmt.Sprintf("ADMIN_TOKEN=%s", s.AdminToken),
 		fmt.Sprintf("BASE_URL=%s", s.BaseURL),
 		"AUTH_SECRET=test-secret-key-must-be-long-enough-for-base64-if-needed",
 		fmt.Sprintf("BESEDKA_DB=%s", s.DBPath),
@@ -216,7 +243,7 @@ func (s *TestServer) CreateUserAPI(t *testing.T, username string) string {
 	reqBody, _ := json.Marshal(map[string]string{"username": username})
 	req, err := http.NewRequest("POST", fmt.Sprintf("http://%s/api/users", s.AdminAddr), bytes.NewReader(reqBody))
 	require.NoError(t, err)
-	req.SetBasicAuth("admin", "1337chat")
+	req.Header.Set("Authorization", "Bearer "+s.AdminToken)
 	req.Header.Set("Content-Type", "application/json")
 
 	resp, err := http.DefaultClient.Do(req)
@@ -253,7 +280,7 @@ func setupPlaywright(t *testing.T) (*playwright.Playwright, playwright.Browser)
 func (s *TestServer) DeleteUser(t *testing.T, userID string) {
 	req, err := http.NewRequest("DELETE", fmt.Sprintf("http://%s/api/users?id=%s", s.AdminAddr, userID), nil)
 	require.NoError(t, err)
-	req.SetBasicAuth("admin", "1337chat")
+	req.Header.Set("Authorization", "Bearer "+s.AdminToken)
 
 	resp, err := http.DefaultClient.Do(req)
 	require.NoError(t, err)
@@ -264,7 +291,7 @@ func (s *TestServer) DeleteUser(t *testing.T, userID string) {
 func (s *TestServer) GetUserID(t *testing.T, username string) string {
 	req, err := http.NewRequest("GET", fmt.Sprintf("http://%s/api/users", s.AdminAddr), nil)
 	require.NoError(t, err)
-	req.SetBasicAuth("admin", "1337chat")
+	req.Header.Set("Authorization", "Bearer "+s.AdminToken)
 
 	resp, err := http.DefaultClient.Do(req)
 	require.NoError(t, err)
@@ -24,11 +24,13 @@ func TestIntegrationUI(t *testing.T) {
 	_ = os.Setenv("ADMIN_ADDR", adminAddr)
 	_ = os.Setenv("API_ADDR", apiAddr)
 	_ = os.Setenv("AUTH_SECRET", "very-secure-test-secret")
+	_ = os.Setenv("ADMIN_BOOTSTRAP_TOKEN", testBootstrapToken)
 	defer func() {
 		_ = os.Unsetenv("BESEDKA_DB")
 		_ = os.Unsetenv("ADMIN_ADDR")
 		_ = os.Unsetenv("API_ADDR")
 		_ = os.Unsetenv("AUTH_SECRET")
+		_ = os.Unsetenv("ADMIN_BOOTSTRAP_TOKEN")
 	}()
 
 	// Start server in background
@@ -47,10 +49,11 @@ func TestIntegrationUI(t *testing.T) {
 	waitForServer(t, "http://127.0.0.1:8890/admin/users", 50)
 
 	baseURL := "http://" + adminAddr
+	adminToken := bootstrapTestAdmin(t, adminAddr)
 
 	// 1. Get Admin Page (List Users)
 	req, _ := http.NewRequest("GET", baseURL+"/", nil)
-	req.SetBasicAuth("admin", "1337chat")
+	req.Header.Set("Authorization", "Bearer "+adminToken)
 	client := &http.Client{}
 	resp, err := client.Do(req)
 	require.NoError(t, err)
@@ -62,7 +65,7 @@ func TestIntegrationUI(t *testing.T) {
 	form.Add("username", "ui_testuser")
 	req, _ = http.NewRequest("POST", baseURL+"/admin/users", strings.NewReader(form.Encode()))
 	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
-	req.SetBasicAuth("admin", "1337chat")
+	req.Header.Set("Authorization", "Bearer "+adminToken)
 
 	resp, err = client.Do(req)
 	require.NoError(t, err)
@@ -75,7 +78,7 @@ func TestIntegrationUI(t *testing.T) {
 	form.Add("id", "ui_testuser")
 	req, _ = http.NewRequest("POST", baseURL+"/admin/users/delete", strings.NewReader(form.Encode()))
 	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
-	req.SetBasicAuth("admin", "1337chat")
+	req.Header.Set("Authorization", "Bearer "+adminToken)
 
 	// Client follows redirects by default
 	resp, err = client.Do(req)
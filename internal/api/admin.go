@@ -10,6 +10,7 @@ import (
 	"log/slog"
 	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
 	"time"
 
@@ -30,15 +31,17 @@ type AdminHandler struct {
 	storage       *storage.BboltStorage
 	baseURL       string
 	maxAvatarSize int64
+	retention     models.RetentionPolicy
 }
 
-func NewAdminHandler(authService *auth.AuthService, hub *ws.Hub, store *storage.BboltStorage, baseURL string, maxAvatarSize int64) *AdminHandler {
+func NewAdminHandler(authService *auth.AuthService, hub *ws.Hub, store *storage.BboltStorage, baseURL string, maxAvatarSize int64, retention models.RetentionPolicy) *AdminHandler {
 	return &AdminHandler{
 		authService:   authService,
 		hub:           hub,
 		storage:       store,
 		baseURL:       baseURL,
 		maxAvatarSize: maxAvatarSize,
+		retention:     retention,
 	}
 }
 
@@ -47,8 +50,12 @@ type AddUserRequest struct {
 	DisplayName    string                `json:"displayName,omitempty"`
 	Type           string                `json:"type,omitempty"`
 	BotPermissions models.BotPermissions `json:"botPermissions,omitempty"`
-	Target         string                `json:"target,omitempty"`
-	TargetChat     string                `json:"targetChat,omitempty"`
+	// Scopes restricts a bot to the listed chats; BotPermissions is then
+	// ignored. An empty list leaves only DMs users opt into; null means
+	// unrestricted.
+	Scopes     []models.ChatScope `json:"scopes"`
+	Target     string             `json:"target,omitempty"`
+	TargetChat string             `json:"targetChat,omitempty"`
 }
 
 type AddUserResponse struct {
@@ -60,7 +67,22 @@ type AddUserResponse struct {
 }
 
 func (h *AdminHandler) addBotHandler(w http.ResponseWriter, req AddUserRequest, displayName string) {
+	if err := auth.ValidateScopes(req.Scopes); err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		_ = json.NewEncoder(w).Encode(AddUserResponse{
+			Success: false,
+			Message: fmt.Sprintf("Failed to create bot: %v", err),
+		})
+		return
+	}
 	user, apiKey, err := h.authService.AddBot(req.Username, displayName, req.BotPermissions)
+	if err == nil && req.Scopes != nil {
+		if err = h.authService.SetBotScopes(user.ID, req.Scopes); err != nil {
+			// Don't hand out a key with broader access than asked for.
+			_ = h.authService.DeleteUser(user.ID)
+		}
+	}
 	if err != nil {
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusBadRequest)
@@ -90,14 +112,23 @@ func (h *AdminHandler) addWebhookHandler(w http.ResponseWriter, req AddUserReque
 	if target == "" {
 		target = "townhall"
 	}
-	user, apiKey, err := h.authService.AddWebhook(req.Username, displayName, target)
-	if err != nil {
+	// A comma-separated target allows several chats; the first is the default.
+	targets := strings.Split(target, ",")
+	fail := func(err error) {
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusBadRequest)
 		_ = json.NewEncoder(w).Encode(AddUserResponse{
 			Success: false,
 			Message: fmt.Sprintf("Failed to create webhook: %v", err),
 		})
+	}
+	if err := h.checkGroupTargets(targets); err != nil {
+		fail(err)
+		return
+	}
+	user, apiKey, err := h.authService.AddWebhook(req.Username, displayName, targets)
+	if err != nil {
+		fail(err)
 		return
 	}
 	if allUsers, err := h.authService.GetUsers(); err == nil {
@@ -112,6 +143,17 @@ func (h *AdminHandler) addWebhookHandler(w http.ResponseWriter, req AddUserReque
 	})
 }
 
+// checkGroupTargets verifies that group chats named as webhook targets exist.
+func (h *AdminHandler) checkGroupTargets(targets []string) error {
+	for _, target := range targets {
+		target = strings.TrimSpace(target)
+		if strings.HasPrefix(target, "group_") && !h.hub.IsGroup(target) {
+			return fmt.Errorf("%w: group %q not found", auth.ErrInvalidWebhookTarget, target)
+		}
+	}
+	return nil
+}
+
 func (h *AdminHandler) AddUserHandler(w http.ResponseWriter, r *http.Request) {
 	var req AddUserRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -300,6 +342,230 @@ func (h *AdminHandler) ResetAPIKeyHandler(w http.ResponseWriter, r *http.Request
 	})
 }
 
+// APIKeyInfo describes an API key without the key itself.
+type APIKeyInfo struct {
+	ID         string `json:"id"`
+	Name       string `json:"name"`
+	CreatedAt  int64  `json:"createdAt,omitempty"`
+	ExpiresAt  int64  `json:"expiresAt,omitempty"`
+	LastUsedAt int64  `json:"lastUsedAt,omitempty"`
+	LastUsedIP string `json:"lastUsedIp,omitempty"`
+	Expired    bool   `json:"expired,omitempty"`
+}
+
+func newAPIKeyInfo(key auth.APIKey, now time.Time) APIKeyInfo {
+	return APIKeyInfo{
+		ID:         key.ID,
+		Name:       key.Name,
+		CreatedAt:  key.CreatedAt,
+		ExpiresAt:  key.ExpiresAt,
+		LastUsedAt: key.LastUsedAt,
+		LastUsedIP: key.LastUsedIP,
+		Expired:    key.Expired(now),
+	}
+}
+
+type APIKeysResponse struct {
+	models.APIResponse
+	Keys []APIKeyInfo `json:"keys"`
+}
+
+type CreateAPIKeyRequest struct {
+	Name      string `json:"name"`
+	ExpiresAt int64  `json:"expiresAt,omitempty"` // Unix timestamp (seconds), 0 for no expiry
+}
+
+type CreateAPIKeyResponse struct {
+	models.APIResponse
+	APIKey string     `json:"apiKey,omitempty"`
+	Key    APIKeyInfo `json:"key"`
+}
+
+// ListAPIKeysHandler lists the API keys of a bot or webhook.
+func (h *AdminHandler) ListAPIKeysHandler(w http.ResponseWriter, r *http.Request) {
+	userID := r.URL.Query().Get("id")
+	if userID == "" {
+		http.Error(w, "User ID is required", http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	keys, err := h.authService.ListAPIKeys(userID)
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		_ = json.NewEncoder(w).Encode(models.APIResponse{
+			Success: false,
+			Message: "User not found",
+		})
+		return
+	}
+
+	now := time.Now()
+	infos := make([]APIKeyInfo, 0, len(keys))
+	for _, key := range keys {
+		infos = append(infos, newAPIKeyInfo(key, now))
+	}
+	_ = json.NewEncoder(w).Encode(APIKeysResponse{
+		APIResponse: models.APIResponse{Success: true},
+		Keys:        infos,
+	})
+}
+
+// CreateAPIKeyHandler issues an additional API key for a bot or webhook.
+// Existing keys stay valid until they are revoked.
+func (h *AdminHandler) CreateAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	userID := r.URL.Query().Get("id")
+	if userID == "" {
+		http.Error(w, "User ID is required", http.StatusBadRequest)
+		return
+	}
+
+	var req CreateAPIKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	var expiresAt time.Time
+	if req.ExpiresAt != 0 {
+		expiresAt = time.Unix(req.ExpiresAt, 0)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	key, rawKey, err := h.authService.CreateAPIKey(userID, req.Name, expiresAt)
+	if err != nil {
+		status := http.StatusInternalServerError
+		switch {
+		case errors.Is(err, models.ErrNotFound):
+			status = http.StatusNotFound
+		case errors.Is(err, auth.ErrNoAPIKeys), errors.Is(err, auth.ErrInvalidAPIKey):
+			status = http.StatusBadRequest
+		}
+		w.WriteHeader(status)
+		_ = json.NewEncoder(w).Encode(models.APIResponse{
+			Success: false,
+			Message: fmt.Sprintf("Failed to create API key: %v", err),
+		})
+		return
+	}
+
+	_ = json.NewEncoder(w).Encode(CreateAPIKeyResponse{
+		APIResponse: models.APIResponse{
+			Success: true,
+			Message: fmt.Sprintf("API key %s created", key.Name),
+		},
+		APIKey: rawKey,
+		Key:    newAPIKeyInfo(key, time.Now()),
+	})
+}
+
+// RevokeAPIKeyHandler deletes one API key of a user. Open WebSocket
+// connections of the user are closed, so they have to reconnect with a key
+// that is still valid.
+func (h *AdminHandler) RevokeAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	userID := r.URL.Query().Get("id")
+	keyID := r.URL.Query().Get("key")
+	if userID == "" || keyID == "" {
+		http.Error(w, "User ID and key ID are required", http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := h.authService.RevokeAPIKey(userID, keyID); err != nil {
+		status := http.StatusInternalServerError
+		message := fmt.Sprintf("Failed to revoke API key: %v", err)
+		if errors.Is(err, models.ErrNotFound) {
+			status = http.StatusNotFound
+			message = "API key not found"
+		}
+		w.WriteHeader(status)
+		_ = json.NewEncoder(w).Encode(models.APIResponse{
+			Success: false,
+			Message: message,
+		})
+		return
+	}
+
+	h.hub.DisconnectUser(userID)
+
+	_ = json.NewEncoder(w).Encode(models.APIResponse{
+		Success: true,
+		Message: fmt.Sprintf("API key %s revoked", keyID),
+	})
+}
+
+type SessionsResponse struct {
+	models.APIResponse
+	Sessions []models.SessionInfo `json:"sessions"`
+}
+
+// UserSessionsHandler lists the login sessions of a user.
+func (h *AdminHandler) UserSessionsHandler(w http.ResponseWriter, r *http.Request) {
+	userID := r.URL.Query().Get("id")
+	if userID == "" {
+		http.Error(w, "User ID is required", http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if _, err := h.authService.GetUser(userID); err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		_ = json.NewEncoder(w).Encode(models.APIResponse{
+			Success: false,
+			Message: "User not found",
+		})
+		return
+	}
+
+	_ = json.NewEncoder(w).Encode(SessionsResponse{
+		APIResponse: models.APIResponse{Success: true},
+		Sessions:    h.authService.ListSessions(userID, ""),
+	})
+}
+
+// RevokeUserSessionsHandler force-logs a user out. Without a session ID all
+// of the user's sessions are revoked. Affected WebSocket connections are
+// closed.
+func (h *AdminHandler) RevokeUserSessionsHandler(w http.ResponseWriter, r *http.Request) {
+	userID := r.URL.Query().Get("id")
+	sessionID := r.URL.Query().Get("session")
+	if userID == "" {
+		http.Error(w, "User ID is required", http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if sessionID == "" {
+		n := h.authService.RevokeSessions(userID)
+		h.hub.DisconnectUser(userID)
+		_ = json.NewEncoder(w).Encode(models.APIResponse{
+			Success: true,
+			Message: fmt.Sprintf("%d session(s) revoked", n),
+		})
+		return
+	}
+
+	if err := h.authService.RevokeSession(userID, sessionID); err != nil {
+		status := http.StatusInternalServerError
+		message := fmt.Sprintf("Failed to revoke session: %v", err)
+		if errors.Is(err, models.ErrNotFound) {
+			status = http.StatusNotFound
+			message = "Session not found"
+		}
+		w.WriteHeader(status)
+		_ = json.NewEncoder(w).Encode(models.APIResponse{
+			Success: false,
+			Message: message,
+		})
+		return
+	}
+	h.hub.DisconnectSession(userID, sessionID)
+
+	_ = json.NewEncoder(w).Encode(models.APIResponse{
+		Success: true,
+		Message: fmt.Sprintf("Session %s revoked", sessionID),
+	})
+}
+
 func (h *AdminHandler) SetUserAvatarHandler(w http.ResponseWriter, r *http.Request) {
 	userID := r.URL.Query().Get("id")
 	if userID == "" {
@@ -455,3 +721,407 @@ func (h *AdminHandler) SetUserAvatarHandler(w http.ResponseWriter, r *http.Reque
 	})
 }
 
+func (h *AdminHandler) DeleteMessageHandler(w http.ResponseWriter, r *http.Request) {
+	chatID := r.URL.Query().Get("chatId")
+	seq, err := strconv.ParseInt(r.URL.Query().Get("seq"), 10, 64)
+	if chatID == "" || err != nil {
+		http.Error(w, "chatId and seq are required", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.hub.AdminDeleteMessage(chatID, seq); err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		if errors.Is(err, models.ErrNotFound) {
+			w.WriteHeader(http.StatusNotFound)
+			_ = json.NewEncoder(w).Encode(models.APIResponse{
+				Success: false,
+				Message: "Message not found",
+			})
+			return
+		}
+
+		w.WriteHeader(http.StatusInternalServerError)
+		_ = json.NewEncoder(w).Encode(models.APIResponse{
+			Success: false,
+			Message: fmt.Sprintf("Failed to delete message: %v", err),
+		})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(models.APIResponse{
+		Success: true,
+		Message: fmt.Sprintf("Message %d in chat %s deleted", seq, chatID),
+	})
+}
+
+// RemoveGroupMemberHandler removes a user from a group chat, whoever created it.
+func (h *AdminHandler) RemoveGroupMemberHandler(w http.ResponseWriter, r *http.Request) {
+	chatID := r.URL.Query().Get("chatId")
+	userID := r.URL.Query().Get("userId")
+	if chatID == "" || userID == "" {
+		http.Error(w, "chatId and userId are required", http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if _, err := h.hub.AdminRemoveGroupMember(chatID, userID); err != nil {
+		status := http.StatusInternalServerError
+		switch {
+		case errors.Is(err, models.ErrNotFound):
+			status = http.StatusNotFound
+		case errors.Is(err, ws.ErrNotGroup), errors.Is(err, ws.ErrInvalidMember):
+			status = http.StatusBadRequest
+		}
+		w.WriteHeader(status)
+		_ = json.NewEncoder(w).Encode(models.APIResponse{
+			Success: false,
+			Message: fmt.Sprintf("Failed to remove group member: %v", err),
+		})
+		return
+	}
+
+	_ = json.NewEncoder(w).Encode(models.APIResponse{
+		Success: true,
+		Message: fmt.Sprintf("User %s removed from chat %s", userID, chatID),
+	})
+}
+
+// ExportChatHandler streams a chat export on behalf of a user, with the same
+// membership and visibility rules as GET /api/chats/{id}/export.
+func (h *AdminHandler) ExportChatHandler(w http.ResponseWriter, r *http.Request) {
+	chatID := r.URL.Query().Get("chatId")
+	userID := r.URL.Query().Get("userId")
+	if chatID == "" || userID == "" {
+		http.Error(w, "chatId and userId are required", http.StatusBadRequest)
+		return
+	}
+
+	user, err := h.authService.GetUser(userID)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		_ = json.NewEncoder(w).Encode(models.APIResponse{
+			Success: false,
+			Message: "User not found",
+		})
+		return
+	}
+
+	writeExport(w, r, h.authService, h.hub, h.storage, user, chatID)
+}
+
+type SetCallbackURLRequest struct {
+	URL string `json:"url"`
+}
+
+// SetBotCallbackURLHandler sets the URL new messages are POSTed to for a bot.
+// An empty URL turns outgoing webhooks off and drops queued deliveries.
+func (h *AdminHandler) SetBotCallbackURLHandler(w http.ResponseWriter, r *http.Request) {
+	userID := r.URL.Query().Get("id")
+	if userID == "" {
+		http.Error(w, "User ID is required", http.StatusBadRequest)
+		return
+	}
+
+	var req SetCallbackURLRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := h.authService.SetBotCallbackURL(userID, req.URL); err != nil {
+		status := http.StatusInternalServerError
+		switch {
+		case errors.Is(err, models.ErrNotFound):
+			status = http.StatusNotFound
+		case errors.Is(err, auth.ErrNotBot), errors.Is(err, auth.ErrNoSigningKey), errors.Is(err, auth.ErrInvalidCallbackURL):
+			status = http.StatusBadRequest
+		}
+		w.WriteHeader(status)
+		_ = json.NewEncoder(w).Encode(models.APIResponse{
+			Success: false,
+			Message: fmt.Sprintf("Failed to set callback URL: %v", err),
+		})
+		return
+	}
+
+	message := "Callback URL set"
+	if req.URL == "" {
+		message = "Callback URL removed"
+		if err := h.storage.ClearDeliveries(userID); err != nil {
+			slog.Error("failed to clear bot webhook deliveries", "userID", userID, "error", err)
+		}
+	}
+	_ = json.NewEncoder(w).Encode(models.APIResponse{
+		Success: true,
+		Message: message,
+	})
+}
+
+// BotDeliveryStatus reports outgoing webhook delivery for one bot.
+type BotDeliveryStatus struct {
+	BotID          string `json:"botId"`
+	UserName       string `json:"userName"`
+	CallbackURL    string `json:"callbackUrl,omitempty"`
+	Pending        int    `json:"pending"`
+	Delivered      int64  `json:"delivered"`
+	Dropped        int64  `json:"dropped"`
+	LastAttempt    int64  `json:"lastAttempt,omitempty"`
+	LastSuccess    int64  `json:"lastSuccess,omitempty"`
+	LastError      string `json:"lastError,omitempty"`
+	LastStatusCode int    `json:"lastStatusCode,omitempty"`
+}
+
+// BotDeliveriesHandler lists the webhook delivery status of every bot that
+// has a callback URL or has had deliveries.
+func (h *AdminHandler) BotDeliveriesHandler(w http.ResponseWriter, r *http.Request) {
+	users, err := h.authService.GetUsers()
+	if err != nil {
+		http.Error(w, "Failed to list users", http.StatusInternalServerError)
+		return
+	}
+	pending, err := h.storage.CountDeliveries()
+	if err != nil {
+		http.Error(w, "Failed to count deliveries", http.StatusInternalServerError)
+		return
+	}
+	statuses, err := h.storage.ListDeliveryStatuses()
+	if err != nil {
+		http.Error(w, "Failed to list delivery statuses", http.StatusInternalServerError)
+		return
+	}
+	byBot := make(map[string]storage.DeliveryStatus, len(statuses))
+	for _, st := range statuses {
+		byBot[st.BotID] = st
+	}
+
+	result := []BotDeliveryStatus{}
+	for _, u := range users {
+		if u.Type != models.UserTypeBot {
+			continue
+		}
+		callbackURL, _, _ := h.authService.GetBotWebhook(u.ID)
+		st, hasStatus := byBot[u.ID]
+		if callbackURL == "" && !hasStatus && pending[u.ID] == 0 {
+			continue
+		}
+		result = append(result, BotDeliveryStatus{
+			BotID:          u.ID,
+			UserName:       u.UserName,
+			CallbackURL:    callbackURL,
+			Pending:        pending[u.ID],
+			Delivered:      st.Delivered,
+			Dropped:        st.Dropped,
+			LastAttempt:    st.LastAttempt,
+			LastSuccess:    st.LastSuccess,
+			LastError:      st.LastError,
+			LastStatusCode: st.LastStatusCode,
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(result)
+}
+
+// ListCommandsHandler lists the registered slash commands.
+func (h *AdminHandler) ListCommandsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(h.hub.ListCommands())
+}
+
+type RegisterCommandRequest struct {
+	Name        string `json:"name"`
+	BotID       string `json:"botId"`
+	Description string `json:"description"`
+}
+
+// RegisterCommandHandler routes a slash command to a bot, replacing any
+// existing command with the same name.
+func (h *AdminHandler) RegisterCommandHandler(w http.ResponseWriter, r *http.Request) {
+	var req RegisterCommandRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err := h.hub.RegisterCommand(models.SlashCommand{
+		Name:        req.Name,
+		BotID:       req.BotID,
+		Description: req.Description,
+	})
+	if err != nil {
+		status := http.StatusInternalServerError
+		switch {
+		case errors.Is(err, ws.ErrInvalidCommand):
+			status = http.StatusBadRequest
+		case errors.Is(err, models.ErrNotFound):
+			status = http.StatusNotFound
+			err = errors.New("bot not found")
+		}
+		w.WriteHeader(status)
+		_ = json.NewEncoder(w).Encode(models.APIResponse{
+			Success: false,
+			Message: fmt.Sprintf("Failed to register command: %v", err),
+		})
+		return
+	}
+
+	_ = json.NewEncoder(w).Encode(models.APIResponse{
+		Success: true,
+		Message: "Command registered",
+	})
+}
+
+// UnregisterCommandHandler removes the slash command given by the name query
+// parameter.
+func (h *AdminHandler) UnregisterCommandHandler(w http.ResponseWriter, r *http.Request) {
+	name := r.URL.Query().Get("name")
+	if name == "" {
+		http.Error(w, "Command name is required", http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := h.hub.UnregisterCommand(name); err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, models.ErrNotFound) {
+			status = http.StatusNotFound
+		}
+		w.WriteHeader(status)
+		_ = json.NewEncoder(w).Encode(models.APIResponse{
+			Success: false,
+			Message: fmt.Sprintf("Failed to unregister command: %v", err),
+		})
+		return
+	}
+
+	_ = json.NewEncoder(w).Encode(models.APIResponse{
+		Success: true,
+		Message: "Command unregistered",
+	})
+}
+
+type SetScopesRequest struct {
+	Scopes []models.ChatScope `json:"scopes"`
+}
+
+// SetBotScopesHandler restricts a bot to the given chats. Direct messages
+// users opted the bot into are kept.
+func (h *AdminHandler) SetBotScopesHandler(w http.ResponseWriter, r *http.Request) {
+	userID := r.URL.Query().Get("id")
+	if userID == "" {
+		http.Error(w, "User ID is required", http.StatusBadRequest)
+		return
+	}
+
+	var req SetScopesRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := h.authService.SetBotScopes(userID, req.Scopes); err != nil {
+		status := http.StatusInternalServerError
+		switch {
+		case errors.Is(err, models.ErrNotFound):
+			status = http.StatusNotFound
+		case errors.Is(err, auth.ErrNotBot), errors.Is(err, auth.ErrInvalidScope), errors.Is(err, auth.ErrDMScopeDenied):
+			status = http.StatusBadRequest
+		}
+		w.WriteHeader(status)
+		_ = json.NewEncoder(w).Encode(models.APIResponse{
+			Success: false,
+			Message: fmt.Sprintf("Failed to set scopes: %v", err),
+		})
+		return
+	}
+
+	_ = json.NewEncoder(w).Encode(models.APIResponse{
+		Success: true,
+		Message: "Scopes updated",
+	})
+}
+
+type WebhookChatsRequest struct {
+	Targets []string `json:"targets"`
+}
+
+type WebhookChatsResponse struct {
+	models.APIResponse
+	Chats []string `json:"chats,omitempty"` // Allowed chat IDs, the default first
+}
+
+// WebhookChatsHandler lists the chats a webhook may post to.
+func (h *AdminHandler) WebhookChatsHandler(w http.ResponseWriter, r *http.Request) {
+	userID := r.URL.Query().Get("id")
+	if userID == "" {
+		http.Error(w, "User ID is required", http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	user, err := h.authService.GetUser(userID)
+	if err != nil || user.Type != models.UserTypeWebhook {
+		w.WriteHeader(http.StatusNotFound)
+		_ = json.NewEncoder(w).Encode(models.APIResponse{
+			Success: false,
+			Message: "Webhook not found",
+		})
+		return
+	}
+
+	_ = json.NewEncoder(w).Encode(WebhookChatsResponse{
+		APIResponse: models.APIResponse{Success: true},
+		Chats:       user.WebhookChats,
+	})
+}
+
+// SetWebhookChatsHandler replaces the chats a webhook may post to. The first
+// target becomes the chat messages go to when a request names none.
+func (h *AdminHandler) SetWebhookChatsHandler(w http.ResponseWriter, r *http.Request) {
+	userID := r.URL.Query().Get("id")
+	if userID == "" {
+		http.Error(w, "User ID is required", http.StatusBadRequest)
+		return
+	}
+
+	var req WebhookChatsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err := h.checkGroupTargets(req.Targets)
+	var chats []string
+	if err == nil {
+		chats, err = h.authService.SetWebhookChats(userID, req.Targets)
+	}
+	if err != nil {
+		status := http.StatusInternalServerError
+		switch {
+		case errors.Is(err, models.ErrNotFound):
+			status = http.StatusNotFound
+		case errors.Is(err, auth.ErrNotWebhook), errors.Is(err, auth.ErrInvalidWebhookTarget):
+			status = http.StatusBadRequest
+		}
+		w.WriteHeader(status)
+		_ = json.NewEncoder(w).Encode(models.APIResponse{
+			Success: false,
+			Message: fmt.Sprintf("Failed to set webhook chats: %v", err),
+		})
+		return
+	}
+
+	_ = json.NewEncoder(w).Encode(WebhookChatsResponse{
+		APIResponse: models.APIResponse{
+			Success: true,
+			Message: "Webhook chats updated",
+		},
+		Chats: chats,
+	})
+}
@@ -0,0 +1,509 @@
+package api
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"besedka/internal/auth"
+	"besedka/internal/models"
+)
+
+const (
+	adminKey = contextKey("admin")
+
+	// AdminTokenCookie holds the admin login token in the admin UI.
+	AdminTokenCookie = "admin_token"
+
+	defaultAuditLimit = 100
+)
+
+// WithAdmin returns a copy of ctx carrying the authenticated admin.
+func WithAdmin(ctx context.Context, admin auth.Admin) context.Context {
+	return context.WithValue(ctx, adminKey, admin)
+}
+
+// AdminFromContext returns the authenticated admin from context.
+func AdminFromContext(ctx context.Context) (auth.Admin, bool) {
+	admin, ok := ctx.Value(adminKey).(auth.Admin)
+	return admin, ok
+}
+
+// adminToken returns the admin login token of a request, sent as a bearer
+// token by the CLI or as a cookie by the admin UI.
+func adminToken(r *http.Request) string {
+	if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		return strings.TrimSpace(token)
+	}
+	if c, err := r.Cookie(AdminTokenCookie); err == nil {
+		return c.Value
+	}
+	return ""
+}
+
+// AuthenticateAdmin returns the admin a request is signed in as.
+func (h *AdminHandler) AuthenticateAdmin(r *http.Request) (auth.Admin, bool) {
+	token := adminToken(r)
+	if token == "" {
+		return auth.Admin{}, false
+	}
+	admin, err := h.authService.GetAdminByToken(token)
+	return admin, err == nil
+}
+
+// SetAdminTokenCookie signs the admin UI in with a login token.
+func (h *AdminHandler) SetAdminTokenCookie(w http.ResponseWriter, token auth.AdminToken, rawToken string) {
+	// nosemgrep: go.lang.security.audit.net.cookie-missing-secure.cookie-missing-secure
+	http.SetCookie(w, &http.Cookie{
+		Name:     AdminTokenCookie,
+		Value:    rawToken,
+		Path:     "/",
+		Expires:  time.Unix(token.ExpiresAt, 0),
+		HttpOnly: true,
+		Secure:   strings.HasPrefix(h.authService.AdminOrigin, "https://"),
+		SameSite: http.SameSiteStrictMode,
+	})
+}
+
+// ClearAdminTokenCookie signs the admin UI out.
+func (h *AdminHandler) ClearAdminTokenCookie(w http.ResponseWriter) {
+	// nosemgrep: go.lang.security.audit.net.cookie-missing-secure.cookie-missing-secure
+	http.SetCookie(w, &http.Cookie{
+		Name:     AdminTokenCookie,
+		Value:    "",
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   strings.HasPrefix(h.authService.AdminOrigin, "https://"),
+		SameSite: http.SameSiteStrictMode,
+	})
+}
+
+// RecordLogin adds an admin login attempt to the audit log.
+func (h *AdminHandler) RecordLogin(r *http.Request, admin auth.Admin, username string, status int) {
+	action := "login"
+	if status != http.StatusOK {
+		action = "login failed"
+	}
+	if admin.UserName != "" {
+		username = admin.UserName
+	}
+	h.authService.RecordAdminAction(models.AdminAuditEntry{
+		AdminID:   admin.ID,
+		AdminName: username,
+		Action:    action,
+		Status:    status,
+		IP:        auth.ClientInfoFromRequest(r).IP,
+	})
+}
+
+// AdminInfo describes an admin account without its secrets.
+type AdminInfo struct {
+	ID        string `json:"id"`
+	Username  string `json:"username"`
+	CreatedAt int64  `json:"createdAt"`
+	CreatedBy string `json:"createdBy,omitempty"` // ID of the admin who added this one
+}
+
+func newAdminInfo(admin auth.Admin) AdminInfo {
+	return AdminInfo{
+		ID:        admin.ID,
+		Username:  admin.UserName,
+		CreatedAt: admin.CreatedAt,
+		CreatedBy: admin.CreatedBy,
+	}
+}
+
+type AdminCredentialsRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// BootstrapAdminRequest creates the first admin. BootstrapToken is the
+// one-time token the server prints to its log while there are no admins.
+type BootstrapAdminRequest struct {
+	AdminCredentialsRequest
+	BootstrapToken string `json:"bootstrapToken"`
+}
+
+type AddAdminResponse struct {
+	models.APIResponse
+	Admin      AdminInfo `json:"admin"`
+	TOTPSecret string    `json:"totpSecret,omitempty"`
+}
+
+type AdminLoginResponse struct {
+	models.APIResponse
+	Token       string `json:"token,omitempty"`
+	TokenExpiry int64  `json:"tokenExpiry,omitempty"` // Unix timestamp (seconds)
+}
+
+type BootstrapAdminResponse struct {
+	AddAdminResponse
+	Token       string `json:"token,omitempty"`
+	TokenExpiry int64  `json:"tokenExpiry,omitempty"` // Unix timestamp (seconds)
+}
+
+type AdminsResponse struct {
+	models.APIResponse
+	Admins []AdminInfo `json:"admins"`
+}
+
+type AdminAuditResponse struct {
+	models.APIResponse
+	Entries []models.AdminAuditEntry `json:"entries"`
+}
+
+// adminStatus maps admin account errors to HTTP statuses.
+func adminStatus(err error) int {
+	switch {
+	case errors.Is(err, models.ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, auth.ErrInvalidAdmin):
+		return http.StatusBadRequest
+	case errors.Is(err, auth.ErrAdminsExist), errors.Is(err, auth.ErrAdminExists), errors.Is(err, auth.ErrLastAdmin):
+		return http.StatusConflict
+	case errors.Is(err, auth.ErrTooManyAttempts):
+		return http.StatusTooManyRequests
+	case errors.Is(err, auth.ErrAdminLoginFailed):
+		return http.StatusUnauthorized
+	case errors.Is(err, auth.ErrBootstrapToken):
+		return http.StatusForbidden
+	}
+	return http.StatusInternalServerError
+}
+
+func writeAdminError(w http.ResponseWriter, message string, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(adminStatus(err))
+	_ = json.NewEncoder(w).Encode(models.APIResponse{
+		Success: false,
+		Message: fmt.Sprintf("%s: %v", message, err),
+	})
+}
+
+// BootstrapAdminHandler creates the first admin account and logs it in. It
+// needs no admin login, only the one-time bootstrap token from the server log,
+// and only works until an admin exists.
+func (h *AdminHandler) BootstrapAdminHandler(w http.ResponseWriter, r *http.Request) {
+	var req BootstrapAdminRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	admin, rawToken, token, err := h.authService.BootstrapAdmin(req.BootstrapToken, req.Username, req.Password, auth.ClientInfoFromRequest(r))
+	if err != nil {
+		writeAdminError(w, "Failed to bootstrap admin", err)
+		return
+	}
+	h.authService.RecordAdminAction(models.AdminAuditEntry{
+		AdminID:   admin.ID,
+		AdminName: admin.UserName,
+		Action:    "bootstrap",
+		Status:    http.StatusOK,
+		IP:        auth.ClientInfoFromRequest(r).IP,
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(BootstrapAdminResponse{
+		AddAdminResponse: AddAdminResponse{
+			APIResponse: models.APIResponse{
+				Success: true,
+				Message: fmt.Sprintf("Admin %s created", admin.UserName),
+			},
+			Admin:      newAdminInfo(admin),
+			TOTPSecret: admin.TOTPSecret,
+		},
+		Token:       rawToken,
+		TokenExpiry: token.ExpiresAt,
+	})
+}
+
+// AdminLoginHandler exchanges an admin's password and TOTP for a login token.
+func (h *AdminHandler) AdminLoginHandler(w http.ResponseWriter, r *http.Request) {
+	var req auth.AdminLoginRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	req.Client = auth.ClientInfoFromRequest(r)
+
+	rawToken, token, err := h.authService.AdminLogin(req)
+	if err != nil {
+		h.RecordLogin(r, auth.Admin{}, req.Username, adminStatus(err))
+		writeAdminError(w, "Login failed", err)
+		return
+	}
+	admin, _ := h.authService.GetAdmin(token.AdminID)
+	h.RecordLogin(r, admin, req.Username, http.StatusOK)
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(AdminLoginResponse{
+		APIResponse: models.APIResponse{Success: true},
+		Token:       rawToken,
+		TokenExpiry: token.ExpiresAt,
+	})
+}
+
+// AdminLogoutHandler invalidates the login token of the request.
+func (h *AdminHandler) AdminLogoutHandler(w http.ResponseWriter, r *http.Request) {
+	h.authService.AdminLogout(adminToken(r))
+	h.ClearAdminTokenCookie(w)
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(models.APIResponse{Success: true, Message: "Logged out"})
+}
+
+// ListAdminsHandler lists the admin accounts.
+func (h *AdminHandler) ListAdminsHandler(w http.ResponseWriter, r *http.Request) {
+	admins := h.authService.ListAdmins()
+	infos := make([]AdminInfo, 0, len(admins))
+	for _, admin := range admins {
+		infos = append(infos, newAdminInfo(admin))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(AdminsResponse{
+		APIResponse: models.APIResponse{Success: true},
+		Admins:      infos,
+	})
+}
+
+// AddAdminHandler creates another admin account with an initial password.
+// The response carries the TOTP secret of the new admin.
+func (h *AdminHandler) AddAdminHandler(w http.ResponseWriter, r *http.Request) {
+	current, _ := AdminFromContext(r.Context())
+
+	var req AdminCredentialsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	admin, err := h.authService.AddAdmin(req.Username, req.Password, current.ID)
+	if err != nil {
+		writeAdminError(w, "Failed to add admin", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(AddAdminResponse{
+		APIResponse: models.APIResponse{
+			Success: true,
+			Message: fmt.Sprintf("Admin %s created", admin.UserName),
+		},
+		Admin:      newAdminInfo(admin),
+		TOTPSecret: admin.TOTPSecret,
+	})
+}
+
+// DeleteAdminHandler removes an admin account by ID, logging it out.
+func (h *AdminHandler) DeleteAdminHandler(w http.ResponseWriter, r *http.Request) {
+	adminID := r.URL.Query().Get("id")
+	if adminID == "" {
+		http.Error(w, "Admin ID is required", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.authService.DeleteAdmin(adminID); err != nil {
+		writeAdminError(w, "Failed to delete admin", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(models.APIResponse{
+		Success: true,
+		Message: fmt.Sprintf("Admin %s deleted", adminID),
+	})
+}
+
+// AdminAuditHandler returns the newest audit log entries, optionally only
+// those of one admin (?admin=<id>). ?limit= defaults to 100; 0 returns all.
+func (h *AdminHandler) AdminAuditHandler(w http.ResponseWriter, r *http.Request) {
+	limit := defaultAuditLimit
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+
+	entries, err := h.authService.AdminAudit(r.URL.Query().Get("admin"), limit)
+	if err != nil {
+		slog.Error("failed to list admin audit log", "error", err)
+		writeAdminError(w, "Failed to list audit log", err)
+		return
+	}
+	if entries == nil {
+		entries = []models.AdminAuditEntry{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(AdminAuditResponse{
+		APIResponse: models.APIResponse{Success: true},
+		Entries:     entries,
+	})
+}
+
+// setAdminWebAuthnSession remembers a passkey ceremony in a cookie scoped to
+// the admin passkey endpoints.
+func (h *AdminHandler) setAdminWebAuthnSession(w http.ResponseWriter, sessionID string) {
+	// nosemgrep: go.lang.security.audit.net.cookie-missing-secure.cookie-missing-secure
+	http.SetCookie(w, &http.Cookie{
+		Name:     "webauthn_session",
+		Value:    sessionID,
+		Path:     "/api/admins/webauthn/",
+		HttpOnly: true,
+		Secure:   strings.HasPrefix(h.authService.AdminOrigin, "https://"),
+		SameSite: http.SameSiteStrictMode,
+		Expires:  time.Now().Add(5 * time.Minute),
+	})
+}
+
+// AdminPasskeyRegisterBeginHandler starts adding a passkey to the signed-in
+// admin.
+func (h *AdminHandler) AdminPasskeyRegisterBeginHandler(w http.ResponseWriter, r *http.Request) {
+	admin, _ := AdminFromContext(r.Context())
+
+	options, sessionData, err := h.authService.BeginAdminPasskeyRegistration(admin.ID)
+	if err != nil {
+		slog.Error("Failed to begin admin passkey registration", "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	sessionID := generateSessionID()
+	h.authService.SaveWebAuthnSession(sessionID, sessionData)
+	h.setAdminWebAuthnSession(w, sessionID)
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(options)
+}
+
+// AdminPasskeyRegisterFinishHandler stores the new passkey (?name=).
+func (h *AdminHandler) AdminPasskeyRegisterFinishHandler(w http.ResponseWriter, r *http.Request) {
+	admin, _ := AdminFromContext(r.Context())
+
+	cookie, err := r.Cookie("webauthn_session")
+	if err != nil {
+		http.Error(w, "Session cookie missing", http.StatusBadRequest)
+		return
+	}
+	sessionData, ok := h.authService.GetWebAuthnSession(cookie.Value)
+	if !ok {
+		http.Error(w, "Session expired or not found", http.StatusBadRequest)
+		return
+	}
+	defer h.authService.DeleteWebAuthnSession(cookie.Value)
+
+	if err := h.authService.FinishAdminPasskeyRegistration(admin.ID, r.URL.Query().Get("name"), sessionData, r); err != nil {
+		slog.Error("Failed to finish admin passkey registration", "error", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(models.APIResponse{Success: true, Message: "Passkey added"})
+}
+
+// AdminPasskeyLoginBeginHandler starts signing an admin in with a passkey.
+func (h *AdminHandler) AdminPasskeyLoginBeginHandler(w http.ResponseWriter, r *http.Request) {
+	options, sessionData, err := h.authService.BeginPasskeyLogin()
+	if err != nil {
+		slog.Error("Failed to begin admin passkey login", "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	sessionID := generateSessionID()
+	h.authService.SaveWebAuthnSession(sessionID, sessionData)
+	h.setAdminWebAuthnSession(w, sessionID)
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(options)
+}
+
+// AdminPasskeyLoginFinishHandler signs an admin in with a passkey. The token
+// is returned and set as the admin UI cookie.
+func (h *AdminHandler) AdminPasskeyLoginFinishHandler(w http.ResponseWriter, r *http.Request) {
+	cookie, err := r.Cookie("webauthn_session")
+	if err != nil {
+		http.Error(w, "Session cookie missing", http.StatusBadRequest)
+		return
+	}
+	sessionData, ok := h.authService.GetWebAuthnSession(cookie.Value)
+	if !ok {
+		http.Error(w, "Session expired or not found", http.StatusBadRequest)
+		return
+	}
+	defer h.authService.DeleteWebAuthnSession(cookie.Value)
+
+	rawToken, token, err := h.authService.FinishAdminPasskeyLogin(sessionData, r)
+	if err != nil {
+		slog.Error("Failed to finish admin passkey login", "error", err)
+		h.RecordLogin(r, auth.Admin{}, "", http.StatusUnauthorized)
+		writeAdminError(w, "Login failed", auth.ErrAdminLoginFailed)
+		return
+	}
+	admin, _ := h.authService.GetAdmin(token.AdminID)
+	h.RecordLogin(r, admin, "", http.StatusOK)
+	h.SetAdminTokenCookie(w, token, rawToken)
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(AdminLoginResponse{
+		APIResponse: models.APIResponse{Success: true},
+		Token:       rawToken,
+		TokenExpiry: token.ExpiresAt,
+	})
+}
+
+// ListAdminPasskeysHandler lists the passkeys of the signed-in admin.
+func (h *AdminHandler) ListAdminPasskeysHandler(w http.ResponseWriter, r *http.Request) {
+	admin, _ := AdminFromContext(r.Context())
+
+	passkeys, err := h.authService.ListPasskeys(admin.ID)
+	if err != nil {
+		http.Error(w, "Failed to list passkeys", http.StatusInternalServerError)
+		return
+	}
+	result := make([]passkeyJSON, len(passkeys))
+	for i, pk := range passkeys {
+		result[i] = passkeyJSON{
+			ID:        base64.RawURLEncoding.EncodeToString(pk.ID),
+			Name:      pk.Name,
+			CreatedAt: pk.CreatedAt,
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(result)
+}
+
+// DeleteAdminPasskeyHandler removes a passkey of the signed-in admin (?id=,
+// the base64url credential ID).
+func (h *AdminHandler) DeleteAdminPasskeyHandler(w http.ResponseWriter, r *http.Request) {
+	admin, _ := AdminFromContext(r.Context())
+
+	credID, err := base64.RawURLEncoding.DecodeString(r.URL.Query().Get("id"))
+	if err != nil || len(credID) == 0 {
+		http.Error(w, "Invalid passkey id", http.StatusBadRequest)
+		return
+	}
+	if err := h.authService.DeletePasskey(admin.ID, credID); err != nil {
+		http.Error(w, "Failed to delete passkey", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(models.APIResponse{Success: true, Message: "Passkey deleted"})
+}
@@ -67,7 +67,7 @@ func TestWebhookHandler(t *testing.T) {
 	apiInst, as, st, _ := setupAPIKeyTest(t)
 	defer func() { _ = st.Close() }()
 
-	_, webhookKey, err := as.AddWebhook("wh_test", "Webhook Test", "townhall")
+	_, webhookKey, err := as.AddWebhook("wh_test", "Webhook Test", []string{"townhall"})
 	if err != nil {
 		t.Fatalf("AddWebhook failed: %v", err)
 	}
@@ -133,3 +133,67 @@ func TestBotPermissionsInTownhall(t *testing.T) {
 		t.Errorf("expected status 403 Forbidden for bot posting without write permission, got %d", wSend.Code)
 	}
 }
+
+func TestAPIKeyAdminHandlers(t *testing.T) {
+	apiInst, as, st, hub := setupAPIKeyTest(t)
+	defer func() { _ = st.Close() }()
+
+	bot, _, err := as.AddBot("rotbot", "Rotating Bot", models.BotPermissions{Write: true})
+	if err != nil {
+		t.Fatalf("AddBot failed: %v", err)
+	}
+	admin := NewAdminHandler(as, hub, st, "", 0, models.RetentionPolicy{})
+
+	body, _ := json.Marshal(CreateAPIKeyRequest{Name: "ci"})
+	w := httptest.NewRecorder()
+	admin.CreateAPIKeyHandler(w, httptest.NewRequest(http.MethodPost, "/api/users/api-keys?id="+bot.ID, bytes.NewReader(body)))
+	var created CreateAPIKeyResponse
+	if err := json.NewDecoder(w.Body).Decode(&created); err != nil || w.Code != http.StatusOK || created.APIKey == "" {
+		t.Fatalf("expected a new key, got %d %+v (%v)", w.Code, created, err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/chats", nil)
+	req.Header.Set("Authorization", "Bearer "+created.APIKey)
+	req.RemoteAddr = "198.51.100.4:5000"
+	apiInst.RequireAuth(func(w http.ResponseWriter, r *http.Request) {})(httptest.NewRecorder(), req)
+
+	list := func() APIKeysResponse {
+		t.Helper()
+		w := httptest.NewRecorder()
+		admin.ListAPIKeysHandler(w, httptest.NewRequest(http.MethodGet, "/api/users/api-keys?id="+bot.ID, nil))
+		var resp APIKeysResponse
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil || w.Code != http.StatusOK {
+			t.Fatalf("listing keys: %d (%v)", w.Code, err)
+		}
+		return resp
+	}
+	keys := list().Keys
+	if len(keys) != 2 || keys[1].ID != created.Key.ID || keys[1].LastUsedIP != "198.51.100.4" || keys[0].LastUsedAt != 0 {
+		t.Fatalf("unexpected keys %+v", keys)
+	}
+
+	w = httptest.NewRecorder()
+	admin.RevokeAPIKeyHandler(w, httptest.NewRequest(http.MethodDelete, "/api/users/api-keys?id="+bot.ID+"&key="+keys[0].ID, nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200 revoking, got %d", w.Code)
+	}
+	if keys := list().Keys; len(keys) != 1 || keys[0].ID != created.Key.ID {
+		t.Errorf("expected only the new key to be left, got %+v", keys)
+	}
+
+	w = httptest.NewRecorder()
+	admin.RevokeAPIKeyHandler(w, httptest.NewRequest(http.MethodDelete, "/api/users/api-keys?id="+bot.ID+"&key="+keys[0].ID, nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expected 404 revoking twice, got %d", w.Code)
+	}
+
+	// The key metadata survives a restart.
+	reloaded, err := auth.NewAuthService(context.Background(), as.Config, st)
+	if err != nil {
+		t.Fatalf("NewAuthService failed: %v", err)
+	}
+	stored, err := reloaded.ListAPIKeys(bot.ID)
+	if err != nil || len(stored) != 1 || stored[0].Name != "ci" || stored[0].LastUsedIP != "198.51.100.4" {
+		t.Errorf("unexpected stored keys %+v (%v)", stored, err)
+	}
+}
@@ -0,0 +1,51 @@
+package api
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"besedka/internal/auth"
+	"besedka/internal/models"
+)
+
+// GrantDMAccessHandler opts the current user's direct messages with a scoped
+// bot into the bot's scopes, so it can read and reply there.
+func (a *API) GrantDMAccessHandler(w http.ResponseWriter, r *http.Request) {
+	a.setDMAccess(w, r, true)
+}
+
+// RevokeDMAccessHandler removes a scoped bot's access to the current user's
+// direct messages with it.
+func (a *API) RevokeDMAccessHandler(w http.ResponseWriter, r *http.Request) {
+	a.setDMAccess(w, r, false)
+}
+
+func (a *API) setDMAccess(w http.ResponseWriter, r *http.Request, allow bool) {
+	botID := r.PathValue("id")
+	if botID == "" {
+		http.Error(w, "Missing bot ID", http.StatusBadRequest)
+		return
+	}
+
+	user, ok := UserFromContext(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	if err := a.auth.SetDMBotAccess(user.ID, botID, allow); err != nil {
+		switch {
+		case errors.Is(err, models.ErrNotFound):
+			http.Error(w, "Bot not found", http.StatusNotFound)
+		case errors.Is(err, auth.ErrBotNotScoped):
+			http.Error(w, "Bot already has access to its direct messages", http.StatusConflict)
+		default:
+			slog.Error("failed to update bot DM access", "error", err)
+			http.Error(w, "Server error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,93 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"besedka/internal/models"
+)
+
+func TestScopedBotDMAccess(t *testing.T) {
+	apiInst, as, st, hub := setupAPIKeyTest(t)
+	defer func() { _ = st.Close() }()
+
+	bot, botKey, err := as.AddBot("scopedbot", "Scoped Bot", models.BotPermissions{ReadAll: true, Write: true})
+	if err != nil {
+		t.Fatalf("AddBot failed: %v", err)
+	}
+	if err := as.SetBotScopes(bot.ID, []models.ChatScope{}); err != nil {
+		t.Fatalf("SetBotScopes failed: %v", err)
+	}
+	legacy, _, err := as.AddBot("legacybot", "Legacy Bot", models.BotPermissions{})
+	if err != nil {
+		t.Fatalf("AddBot failed: %v", err)
+	}
+	if _, err := as.AddUser("alice", "Alice"); err != nil {
+		t.Fatalf("AddUser failed: %v", err)
+	}
+	alice, _ := as.GetUserByUsername("alice")
+	if err := as.ActivateUser(alice.ID); err != nil {
+		t.Fatalf("ActivateUser failed: %v", err)
+	}
+	aliceKey, err := as.ResetAPIKey(alice.ID)
+	if err != nil {
+		t.Fatalf("ResetAPIKey failed: %v", err)
+	}
+	users, _ := as.GetUsers()
+	hub.EnsureDMsFor(alice, users)
+	dmID := models.GetDMID(alice.ID, bot.ID)
+
+	readHandler := apiInst.RequireAuth(RequireUserTypes(apiInst.ChatMessagesHandler, models.UserTypeHuman, models.UserTypeBot))
+	sendHandler := apiInst.RequireAuth(RequireSameOrigin(RequireUserTypes(apiInst.SendMessageHandler, models.UserTypeHuman, models.UserTypeBot)))
+	do := func(handler http.HandlerFunc, method, key, chatID string) int {
+		body, _ := json.Marshal(map[string]string{"content": "hello"})
+		req := httptest.NewRequest(method, "/api/chats/"+chatID+"/messages?toSeq=10", bytes.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+key)
+		req.SetPathValue("id", chatID)
+		w := httptest.NewRecorder()
+		handler(w, req)
+		return w.Code
+	}
+
+	// Scoped bots ignore their Town Hall permissions and see no DMs by default.
+	for _, chatID := range []string{"townhall", dmID} {
+		if code := do(readHandler, http.MethodGet, botKey, chatID); code != http.StatusForbidden {
+			t.Errorf("expected 403 reading %s, got %d", chatID, code)
+		}
+		if code := do(sendHandler, http.MethodPost, botKey, chatID); code != http.StatusForbidden {
+			t.Errorf("expected 403 posting to %s, got %d", chatID, code)
+		}
+	}
+
+	accessHandler := apiInst.RequireAuth(RequireSameOrigin(RequireUserTypes(apiInst.GrantDMAccessHandler, models.UserTypeHuman)))
+	grant := func(botID string) int {
+		req := httptest.NewRequest(http.MethodPut, "/api/bots/"+botID+"/dm-access", nil)
+		req.Header.Set("Authorization", "Bearer "+aliceKey)
+		req.SetPathValue("id", botID)
+		w := httptest.NewRecorder()
+		accessHandler(w, req)
+		return w.Code
+	}
+	if code := grant(legacy.ID); code != http.StatusConflict {
+		t.Errorf("expected 409 for an unscoped bot, got %d", code)
+	}
+	if code := grant("missing"); code != http.StatusNotFound {
+		t.Errorf("expected 404 for an unknown bot, got %d", code)
+	}
+	if code := grant(bot.ID); code != http.StatusOK {
+		t.Fatalf("expected 200 granting DM access, got %d", code)
+	}
+
+	if code := do(sendHandler, http.MethodPost, botKey, dmID); code != http.StatusOK {
+		t.Errorf("expected 200 posting to the opted-in DM, got %d", code)
+	}
+	if code := do(readHandler, http.MethodGet, botKey, dmID); code != http.StatusOK {
+		t.Errorf("expected 200 reading the opted-in DM, got %d", code)
+	}
+	if code := do(readHandler, http.MethodGet, botKey, "townhall"); code != http.StatusForbidden {
+		t.Errorf("expected Town Hall to stay out of scope, got %d", code)
+	}
+}
@@ -0,0 +1,65 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"besedka/internal/models"
+	"besedka/internal/ws"
+)
+
+// CommandsHandler lists the registered slash commands.
+func (a *API) CommandsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(a.hub.ListCommands()); err != nil {
+		slog.Error("failed to encode commands response", "error", err)
+	}
+}
+
+type CommandReplyRequest struct {
+	Content   string `json:"content"`
+	Ephemeral bool   `json:"ephemeral"`
+}
+
+// CommandReplyHandler lets a bot answer a slash command invocation, either
+// only to the user who ran it or publicly in the chat.
+func (a *API) CommandReplyHandler(w http.ResponseWriter, r *http.Request) {
+	invocationID := r.PathValue("id")
+	if invocationID == "" {
+		http.Error(w, "Missing invocation ID", http.StatusBadRequest)
+		return
+	}
+
+	user, ok := UserFromContext(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req CommandReplyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.Content == "" {
+		http.Error(w, "Reply content cannot be empty", http.StatusBadRequest)
+		return
+	}
+
+	if err := a.hub.ReplyToCommand(user.ID, invocationID, req.Content, req.Ephemeral); err != nil {
+		switch {
+		case errors.Is(err, models.ErrNotFound):
+			http.Error(w, "Invocation not found or expired", http.StatusNotFound)
+		case errors.Is(err, ws.ErrCannotPostReply):
+			http.Error(w, err.Error(), http.StatusForbidden)
+		default:
+			slog.Error("failed to reply to command", "error", err)
+			http.Error(w, "Server error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,103 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"besedka/internal/models"
+)
+
+func TestCommandHandlers(t *testing.T) {
+	apiInst, as, st, hub := setupAPIKeyTest(t)
+	defer func() { _ = st.Close() }()
+
+	if err := hub.SetCommandStore(st); err != nil {
+		t.Fatalf("SetCommandStore failed: %v", err)
+	}
+	bot, botKey, err := as.AddBot("weatherbot", "Weather Bot", models.BotPermissions{Write: true})
+	if err != nil {
+		t.Fatalf("AddBot failed: %v", err)
+	}
+	_, otherKey, err := as.AddBot("otherbot", "Other Bot", models.BotPermissions{Write: true})
+	if err != nil {
+		t.Fatalf("AddBot failed: %v", err)
+	}
+	if _, err := as.AddUser("alice", "Alice"); err != nil {
+		t.Fatalf("AddUser failed: %v", err)
+	}
+	alice, err := as.GetUserByUsername("alice")
+	if err != nil {
+		t.Fatalf("GetUserByUsername failed: %v", err)
+	}
+	if err := hub.RegisterCommand(models.SlashCommand{Name: "weather", BotID: bot.ID, Description: "Forecast"}); err != nil {
+		t.Fatalf("RegisterCommand failed: %v", err)
+	}
+
+	listHandler := apiInst.RequireAuth(RequireUserTypes(apiInst.CommandsHandler, models.UserTypeHuman, models.UserTypeBot))
+	req := httptest.NewRequest(http.MethodGet, "/api/commands", nil)
+	req.Header.Set("Authorization", "Bearer "+otherKey)
+	w := httptest.NewRecorder()
+	listHandler(w, req)
+	var commands []models.SlashCommand
+	if err := json.Unmarshal(w.Body.Bytes(), &commands); err != nil || len(commands) != 1 || commands[0].Description != "Forecast" {
+		t.Fatalf("unexpected commands %s (%v)", w.Body.String(), err)
+	}
+
+	aliceCh := hub.Join(alice.ID)
+	botCh := hub.Join(bot.ID)
+	hub.Dispatch(alice.ID, models.ClientMessage{Type: models.ClientMessageTypeSend, ChatID: "townhall", Content: "/weather Oslo"}, aliceCh)
+	inv := waitFor(t, botCh, models.ServerMessageTypeCommand).Command
+	if inv == nil || inv.Args != "Oslo" {
+		t.Fatalf("expected invocation for the bot, got %+v", inv)
+	}
+
+	replyHandler := apiInst.RequireAuth(RequireSameOrigin(RequireUserTypes(apiInst.CommandReplyHandler, models.UserTypeBot)))
+	reply := func(key, id string, body CommandReplyRequest) int {
+		data, _ := json.Marshal(body)
+		req := httptest.NewRequest(http.MethodPost, "/api/commands/"+id+"/reply", bytes.NewReader(data))
+		req.Header.Set("Authorization", "Bearer "+key)
+		req.SetPathValue("id", id)
+		w := httptest.NewRecorder()
+		replyHandler(w, req)
+		return w.Code
+	}
+
+	if code := reply(botKey, inv.ID, CommandReplyRequest{}); code != http.StatusBadRequest {
+		t.Errorf("expected 400 for empty reply, got %d", code)
+	}
+	if code := reply(otherKey, inv.ID, CommandReplyRequest{Content: "hi"}); code != http.StatusNotFound {
+		t.Errorf("expected 404 for another bot's invocation, got %d", code)
+	}
+	if code := reply(botKey, inv.ID, CommandReplyRequest{Content: "Rain", Ephemeral: true}); code != http.StatusOK {
+		t.Fatalf("expected 200 for ephemeral reply, got %d", code)
+	}
+	if msg := waitFor(t, aliceCh, models.ServerMessageTypeEphemeral); len(msg.Messages) != 1 || msg.Messages[0].UserID != bot.ID {
+		t.Errorf("unexpected ephemeral reply %+v", msg)
+	}
+	if code := reply(botKey, inv.ID, CommandReplyRequest{Content: "Rain in Oslo"}); code != http.StatusOK {
+		t.Fatalf("expected 200 for public reply, got %d", code)
+	}
+	messages, err := st.ListMessages("townhall", 0, 10)
+	if err != nil || len(messages) != 1 || messages[0].UserID != bot.ID {
+		t.Errorf("expected only the public reply to be stored, got %+v (%v)", messages, err)
+	}
+}
+
+func waitFor(t *testing.T, ch <-chan models.ServerMessage, typ models.ServerMessageType) models.ServerMessage {
+	t.Helper()
+	timeout := time.After(time.Second)
+	for {
+		select {
+		case msg := <-ch:
+			if msg.Type == typ {
+				return msg
+			}
+		case <-timeout:
+			t.Fatalf("timeout waiting for %s", typ)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package api
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"besedka/internal/auth"
+	"besedka/internal/export"
+	"besedka/internal/models"
+	"besedka/internal/storage"
+	"besedka/internal/ws"
+)
+
+// ExportHandler streams the full history of a chat the user belongs to as
+// JSON Lines (format=jsonl, the default) or as a zip with an HTML page and
+// the referenced attachments (format=html).
+func (a *API) ExportHandler(w http.ResponseWriter, r *http.Request) {
+	chatID := r.PathValue("id")
+	if chatID == "" {
+		http.Error(w, "Missing chat ID", http.StatusBadRequest)
+		return
+	}
+
+	user, ok := UserFromContext(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	writeExport(w, r, a.auth, a.hub, a.storage, user, chatID)
+}
+
+// writeExport is shared by the user-facing and admin export endpoints.
+func writeExport(w http.ResponseWriter, r *http.Request, authService *auth.AuthService, hub *ws.Hub, store *storage.BboltStorage, user models.User, chatID string) {
+	format, err := export.ParseFormat(r.URL.Query().Get("format"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	chat, err := hub.GetChat(user.ID, chatID)
+	if err != nil {
+		if errors.Is(err, models.ErrNotFound) {
+			http.Error(w, "Chat not found", http.StatusNotFound)
+		} else {
+			slog.Error("failed to get chat for export", "error", err)
+			http.Error(w, "Server error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	names := make(map[string]string)
+	if users, err := authService.GetUsers(); err == nil {
+		for _, u := range users {
+			names[u.ID] = u.DisplayName
+		}
+	}
+
+	w.Header().Set("Content-Type", format.ContentType())
+	w.Header().Set("Content-Disposition", `attachment; filename="`+format.Filename(chatID)+`"`)
+	w.Header().Set("Cache-Control", "no-store")
+
+	// The status is already sent once streaming starts, so failures can only
+	// be logged; the client sees a truncated body.
+	err = export.Write(w, format, store, export.Options{
+		Chat: chat,
+		Filter: func(msgs []models.Message) []models.Message {
+			return filterVisibleMessages(chatID, msgs, user)
+		},
+		UserNames: names,
+	})
+	if err != nil {
+		slog.Error("chat export failed", "chatID", chatID, "userID", user.ID, "error", err)
+	}
+}
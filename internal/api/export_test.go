@@ -0,0 +1,91 @@
+package api
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"besedka/internal/models"
+)
+
+func TestExportHandler(t *testing.T) {
+	apiInst, as, st, _ := setupAPIKeyTest(t)
+	defer func() { _ = st.Close() }()
+
+	_, writerKey, err := as.AddBot("writerbot", "Writer Bot", models.BotPermissions{ReadAll: true, Write: true})
+	if err != nil {
+		t.Fatalf("AddBot failed: %v", err)
+	}
+	_, readerKey, err := as.AddBot("mentionbot", "Mention Bot", models.BotPermissions{ReadMentions: true})
+	if err != nil {
+		t.Fatalf("AddBot failed: %v", err)
+	}
+
+	sendHandler := apiInst.RequireAuth(RequireSameOrigin(RequireUserTypes(apiInst.SendMessageHandler, models.UserTypeHuman, models.UserTypeBot)))
+	for _, text := range []string{"first", "@mentionbot second", "third"} {
+		body, _ := json.Marshal(map[string]string{"content": text})
+		req := httptest.NewRequest(http.MethodPost, "/api/chats/townhall/messages", bytes.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+writerKey)
+		req.SetPathValue("id", "townhall")
+		w := httptest.NewRecorder()
+		sendHandler(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status 200 OK sending message, got %d: %s", w.Code, w.Body.String())
+		}
+	}
+
+	exportHandler := apiInst.RequireAuth(RequireUserTypes(apiInst.ExportHandler, models.UserTypeHuman, models.UserTypeBot))
+	export := func(key, chatID, format string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/api/chats/"+chatID+"/export?format="+format, nil)
+		req.Header.Set("Authorization", "Bearer "+key)
+		req.SetPathValue("id", chatID)
+		w := httptest.NewRecorder()
+		exportHandler(w, req)
+		return w
+	}
+	contents := func(w *httptest.ResponseRecorder) []string {
+		var out []string
+		sc := bufio.NewScanner(w.Body)
+		for sc.Scan() {
+			var m models.Message
+			if err := json.Unmarshal(sc.Bytes(), &m); err != nil {
+				t.Fatalf("invalid line %q: %v", sc.Text(), err)
+			}
+			out = append(out, m.Content)
+		}
+		return out
+	}
+
+	w := export(writerKey, "townhall", "jsonl")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200 OK, got %d: %s", w.Code, w.Body.String())
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "application/x-ndjson" {
+		t.Errorf("unexpected content type %q", ct)
+	}
+	if cd := w.Header().Get("Content-Disposition"); !strings.Contains(cd, "besedka-townhall.jsonl") {
+		t.Errorf("unexpected content disposition %q", cd)
+	}
+	if got := contents(w); len(got) != 3 || got[0] != "first" {
+		t.Errorf("expected all 3 messages, got %q", got)
+	}
+
+	// Visibility rules apply to exports too.
+	if got := contents(export(readerKey, "townhall", "")); len(got) != 1 || got[0] != "@mentionbot second" {
+		t.Errorf("expected only the mentioning message, got %q", got)
+	}
+
+	if w := export(writerKey, "townhall", "html"); w.Code != http.StatusOK || w.Header().Get("Content-Type") != "application/zip" {
+		t.Errorf("expected zip archive, got %d %q", w.Code, w.Header().Get("Content-Type"))
+	}
+	if w := export(writerKey, "townhall", "pdf"); w.Code != http.StatusBadRequest {
+		t.Errorf("expected status 400 for unknown format, got %d", w.Code)
+	}
+	if w := export(writerKey, "dm_someone_else", "jsonl"); w.Code != http.StatusNotFound {
+		t.Errorf("expected status 404 for inaccessible chat, got %d", w.Code)
+	}
+}
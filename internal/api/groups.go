@@ -0,0 +1,104 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"besedka/internal/content"
+	"besedka/internal/models"
+	"besedka/internal/ws"
+)
+
+func (a *API) CreateGroupHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := UserFromContext(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req struct {
+		Name      string   `json:"name"`
+		MemberIDs []string `json:"memberIds"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	c, err := a.hub.CreateGroup(user.ID, req.Name, req.MemberIDs)
+	writeGroupResponse(w, c, err)
+}
+
+func (a *API) RenameGroupHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := UserFromContext(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req struct {
+		Name string `json:"name"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	c, err := a.hub.RenameGroup(user.ID, r.PathValue("id"), req.Name)
+	writeGroupResponse(w, c, err)
+}
+
+func (a *API) AddGroupMemberHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := UserFromContext(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req struct {
+		UserID string `json:"userId"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	c, err := a.hub.AddGroupMember(user.ID, r.PathValue("id"), req.UserID)
+	writeGroupResponse(w, c, err)
+}
+
+func (a *API) RemoveGroupMemberHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := UserFromContext(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	c, err := a.hub.RemoveGroupMember(user.ID, r.PathValue("id"), r.PathValue("userId"))
+	writeGroupResponse(w, c, err)
+}
+
+func writeGroupResponse(w http.ResponseWriter, c models.Chat, err error) {
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrNotFound):
+			http.Error(w, "Chat not found", http.StatusNotFound)
+		case errors.Is(err, ws.ErrInvalidGroupName), errors.Is(err, ws.ErrInvalidMember), errors.Is(err, ws.ErrNotGroup):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		case errors.Is(err, ws.ErrNotGroupCreator), errors.Is(err, ws.ErrCannotPost):
+			http.Error(w, err.Error(), http.StatusForbidden)
+		default:
+			slog.Error("failed to update group chat", "error", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	c.Name = content.Escape(c.Name)
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(c); err != nil {
+		slog.Error("failed to encode group chat response", "error", err)
+	}
+}
@@ -19,13 +19,16 @@ import (
 
 	"besedka/internal/audio"
 	"besedka/internal/auth"
+	"besedka/internal/chat"
 	"besedka/internal/config"
 	"besedka/internal/content"
 	"besedka/internal/images"
 	"besedka/internal/models"
 	"besedka/internal/storage"
+	"besedka/internal/unfurl"
 	"besedka/internal/ws"
 
+	"github.com/c-pro/geche"
 	"github.com/google/uuid"
 	"github.com/h2non/filetype"
 )
@@ -41,23 +44,30 @@ type API struct {
 	storage *storage.BboltStorage
 	cfg     *config.Config
 	push    PushService
+
+	// fetchClient downloads webhook attachments and avatars by URL.
+	fetchClient *http.Client
+	avatars     *geche.RingBuffer[string, string]
 }
 
 func New(auth *auth.AuthService, hub *ws.Hub, storage *storage.BboltStorage, cfg *config.Config, push PushService) *API {
 	return &API{
-		auth:    auth,
-		hub:     hub,
-		storage: storage,
-		cfg:     cfg,
-		push:    push,
+		auth:        auth,
+		hub:         hub,
+		storage:     storage,
+		cfg:         cfg,
+		push:        push,
+		fetchClient: unfurl.NewClient(webhookFetchTimeout, false),
+		avatars:     geche.NewRingBuffer[string, string](avatarCacheSize),
 	}
 }
 
 func (a *API) LoginHandler(w http.ResponseWriter, r *http.Request) {
 	var req struct {
-		Username string `json:"username"`
-		Password string `json:"password"`
-		TOTP     int    `json:"totp"`
+		Username     string `json:"username"`
+		Password     string `json:"password"`
+		TOTP         int    `json:"totp"`
+		RecoveryCode string `json:"recoveryCode"`
 	}
 
 	// Support both JSON and Form (since frontend uses x-www-form-urlencoded)
@@ -76,6 +86,7 @@ func (a *API) LoginHandler(w http.ResponseWriter, r *http.Request) {
 		if t := r.FormValue("totp"); t != "" {
 			_, _ = fmt.Sscanf(t, "%d", &req.TOTP)
 		}
+		req.RecoveryCode = r.FormValue("recoveryCode")
 	}
 
 	if err := content.ValidateUsername(req.Username); err != nil {
@@ -84,9 +95,11 @@ func (a *API) LoginHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	loginResp, _ := a.auth.Login(auth.LoginRequest{
-		Username: req.Username,
-		Password: req.Password,
-		TOTP:     req.TOTP,
+		Username:     req.Username,
+		Password:     req.Password,
+		TOTP:         req.TOTP,
+		RecoveryCode: req.RecoveryCode,
+		Client:       auth.ClientInfoFromRequest(r),
 	})
 
 	if !loginResp.Success {
@@ -161,7 +174,7 @@ func (a *API) RequireAuth(next http.HandlerFunc) http.HandlerFunc {
 		if strings.HasPrefix(authHeader, "Bearer ") {
 			apiKey := strings.TrimSpace(strings.TrimPrefix(authHeader, "Bearer "))
 			if apiKey != "" {
-				user, err := a.auth.GetUserByAPIKey(apiKey)
+				user, err := a.auth.GetUserByAPIKey(apiKey, r.RemoteAddr)
 				if err == nil {
 					if user.Type == "" {
 						user.Type = models.UserTypeHuman
@@ -238,8 +251,15 @@ func (a *API) RegisterHandler(w http.ResponseWriter, r *http.Request) {
 
 	// Sanitize inputs
 	req.DisplayName = content.Sanitize(req.DisplayName)
+	req.Client = auth.ClientInfoFromRequest(r)
 
 	resp, _ := a.auth.CompleteRegistration(req)
+	a.writeRegistration(w, resp)
+}
+
+// writeRegistration announces a newly registered user, logs them in and
+// writes the registration response.
+func (a *API) writeRegistration(w http.ResponseWriter, resp auth.RegistrationResponse) {
 	if !resp.Success {
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusBadRequest)
@@ -387,7 +407,7 @@ func (a *API) ChatMessagesHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Access denied", http.StatusForbidden)
 		return
 	case models.UserTypeBot:
-		if chatID == "townhall" && !user.BotPermissions.ReadAll && !user.BotPermissions.ReadMentions {
+		if perms := user.ChatPermissions(chatID); !perms.ReadAll && !perms.ReadMentions {
 			http.Error(w, "Access denied", http.StatusForbidden)
 			return
 		}
@@ -404,21 +424,85 @@ func (a *API) ChatMessagesHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	filtered := make([]models.Message, 0, len(messages))
-	for _, m := range messages {
-		mentions := content.ExtractMentions(m.Content)
-		if models.IsMessageVisible(chatID, mentions, user) {
-			filtered = append(filtered, m)
+	messages = filterVisibleMessages(chatID, messages, user)
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(messages); err != nil {
+		slog.Error("failed to encode messages response", "error", err)
+	}
+}
+
+// RepliesHandler returns a page of messages replying to the message with the
+// given seq. ?after= is the last reply seq of the previous page and ?limit=
+// the page size, at most ws.MaxRepliesPage.
+func (a *API) RepliesHandler(w http.ResponseWriter, r *http.Request) {
+	chatID := r.PathValue("id")
+	seq, err := strconv.ParseInt(r.PathValue("seq"), 10, 64)
+	if chatID == "" || err != nil {
+		http.Error(w, "Invalid message reference", http.StatusBadRequest)
+		return
+	}
+
+	var after int64
+	if v := r.URL.Query().Get("after"); v != "" {
+		if after, err = strconv.ParseInt(v, 10, 64); err != nil || after < 0 {
+			http.Error(w, "Invalid after", http.StatusBadRequest)
+			return
+		}
+	}
+	limit := ws.MaxRepliesPage
+	if v := r.URL.Query().Get("limit"); v != "" {
+		if limit, err = strconv.Atoi(v); err != nil || limit < 1 {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+	}
+
+	user, ok := UserFromContext(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	messages, err := a.hub.GetReplies(user.ID, chatID, seq, after, limit)
+	if err != nil {
+		if errors.Is(err, models.ErrNotFound) {
+			http.Error(w, "Message not found", http.StatusNotFound)
+		} else {
+			slog.Error("failed to get replies", "error", err)
+			http.Error(w, "Server error", http.StatusInternalServerError)
 		}
+		return
 	}
-	messages = filtered
+
+	messages = filterVisibleMessages(chatID, messages, user)
 
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(messages); err != nil {
-		slog.Error("failed to encode messages response", "error", err)
+		slog.Error("failed to encode replies response", "error", err)
 	}
 }
 
+// filterVisibleMessages drops messages user may not see and hides reply
+// previews from users who may not see quoted messages.
+func filterVisibleMessages(chatID string, messages []models.Message, user models.User) []models.Message {
+	showPreviews := models.IsReplyPreviewVisible(chatID, user)
+	filtered := make([]models.Message, 0, len(messages))
+	for _, m := range messages {
+		mentions := content.ExtractMentions(m.Content)
+		if !models.IsMessageVisible(chatID, mentions, user) {
+			continue
+		}
+		if !showPreviews && m.ReplyTo != nil {
+			ref := *m.ReplyTo
+			ref.Preview = ""
+			m.ReplyTo = &ref
+		}
+		filtered = append(filtered, m)
+	}
+	return filtered
+}
+
 func (a *API) SendMessageHandler(w http.ResponseWriter, r *http.Request) {
 	chatID := r.PathValue("id")
 	if chatID == "" {
@@ -436,15 +520,14 @@ func (a *API) SendMessageHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Webhooks must post via /api/webhook", http.StatusForbidden)
 		return
 	}
-	if user.Type == models.UserTypeBot && chatID == "townhall" {
-		if !user.BotPermissions.Write {
-			http.Error(w, "Bot has no write permission in Townhall", http.StatusForbidden)
-			return
-		}
+	if !models.CanPost(chatID, user) {
+		http.Error(w, "Bot has no write permission in this chat", http.StatusForbidden)
+		return
 	}
 
 	var req struct {
-		Content string `json:"content"`
+		Content string           `json:"content"`
+		ReplyTo *models.ReplyRef `json:"replyTo,omitempty"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -461,11 +544,91 @@ func (a *API) SendMessageHandler(w http.ResponseWriter, r *http.Request) {
 		Type:    models.ClientMessageTypeSend,
 		ChatID:  chatID,
 		Content: req.Content,
+		ReplyTo: req.ReplyTo,
 	}, nil)
 
 	w.WriteHeader(http.StatusOK)
 }
 
+func (a *API) EditMessageHandler(w http.ResponseWriter, r *http.Request) {
+	chatID := r.PathValue("id")
+	seq, err := strconv.ParseInt(r.PathValue("seq"), 10, 64)
+	if chatID == "" || err != nil {
+		http.Error(w, "Invalid message reference", http.StatusBadRequest)
+		return
+	}
+
+	user, ok := UserFromContext(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	if !models.CanPost(chatID, user) {
+		http.Error(w, "Bot has no write permission in this chat", http.StatusForbidden)
+		return
+	}
+
+	var req struct {
+		Content string `json:"content"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	msg, err := a.hub.EditMessage(user.ID, chatID, seq, req.Content)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrNotFound):
+			http.Error(w, "Message not found", http.StatusNotFound)
+		case errors.Is(err, chat.ErrNotAuthor), errors.Is(err, ws.ErrCannotPost):
+			http.Error(w, err.Error(), http.StatusForbidden)
+		case errors.Is(err, ws.ErrEmptyMessage):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		default:
+			slog.Error("failed to edit message", "error", err)
+			http.Error(w, "Server error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(msg); err != nil {
+		slog.Error("failed to encode edited message response", "error", err)
+	}
+}
+
+func (a *API) DeleteMessageHandler(w http.ResponseWriter, r *http.Request) {
+	chatID := r.PathValue("id")
+	seq, err := strconv.ParseInt(r.PathValue("seq"), 10, 64)
+	if chatID == "" || err != nil {
+		http.Error(w, "Invalid message reference", http.StatusBadRequest)
+		return
+	}
+
+	user, ok := UserFromContext(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	if err := a.hub.DeleteMessage(user.ID, chatID, seq); err != nil {
+		switch {
+		case errors.Is(err, models.ErrNotFound):
+			http.Error(w, "Message not found", http.StatusNotFound)
+		case errors.Is(err, chat.ErrNotAuthor), errors.Is(err, ws.ErrCannotPost):
+			http.Error(w, err.Error(), http.StatusForbidden)
+		default:
+			slog.Error("failed to delete message", "error", err)
+			http.Error(w, "Server error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
 func (a *API) MeHandler(w http.ResponseWriter, r *http.Request) {
 	currentUser, ok := UserFromContext(r.Context())
 	if !ok {
@@ -486,15 +649,19 @@ func (a *API) MeHandler(w http.ResponseWriter, r *http.Request) {
 	// The frontend expects { id: ... } at minimum based on existing logic,
 	// but having name is good too.
 	resp := struct {
-		ID           string `json:"id"`
-		Name         string `json:"name"`
-		TokenExpiry  int64  `json:"tokenExpiry,omitempty"`
-		SessionLimit int64  `json:"sessionLimit,omitempty"`
+		ID                string `json:"id"`
+		Name              string `json:"name"`
+		TokenExpiry       int64  `json:"tokenExpiry,omitempty"`
+		SessionLimit      int64  `json:"sessionLimit,omitempty"`
+		RecoveryCodesLeft int    `json:"recoveryCodesLeft"`
+		PasskeyOnly       bool   `json:"passkeyOnly,omitempty"`
 	}{
-		ID:           currentUser.ID,
-		Name:         content.Escape(currentUser.DisplayName),
-		TokenExpiry:  tokenExpiry,
-		SessionLimit: int64(a.auth.TokenExpiry.Seconds()),
+		ID:                currentUser.ID,
+		Name:              content.Escape(currentUser.DisplayName),
+		TokenExpiry:       tokenExpiry,
+		SessionLimit:      int64(a.auth.TokenExpiry.Seconds()),
+		RecoveryCodesLeft: a.auth.RecoveryCodesLeft(currentUser.ID),
+		PasskeyOnly:       a.auth.IsPasskeyOnly(currentUser.ID),
 	}
 
 	if err := json.NewEncoder(w).Encode(resp); err != nil {
@@ -682,6 +849,19 @@ func (a *API) processUpload(w http.ResponseWriter, r *http.Request, maxBytes int
 		}
 	}
 
+	meta, err := a.saveUpload(uploaderID, data)
+	if err != nil {
+		slog.Error("failed to save upload", "error", err)
+		http.Error(w, "Internal Storage Error", http.StatusInternalServerError)
+		return "", err
+	}
+
+	return meta.ID, nil
+}
+
+// saveUpload stores data as a new file owned by uploaderID, detecting its type
+// and generating a thumbnail for images.
+func (a *API) saveUpload(uploaderID string, data []byte) (storage.FileMetadata, error) {
 	mimeType := "application/octet-stream"
 	if detected := audio.DetectAudioMimeType(data); detected != "" {
 		mimeType = detected
@@ -696,9 +876,7 @@ func (a *API) processUpload(w http.ResponseWriter, r *http.Request, maxBytes int
 	hash := hex.EncodeToString(hasher.Sum(nil))
 
 	if err := a.storage.SaveFileBlob(bytes.NewReader(data), hash); err != nil {
-		slog.Error("failed to save file blob", "error", err)
-		http.Error(w, "Internal Storage Error", http.StatusInternalServerError)
-		return "", err
+		return storage.FileMetadata{}, fmt.Errorf("failed to save file blob: %w", err)
 	}
 
 	fileID := uuid.NewString()
@@ -720,12 +898,10 @@ func (a *API) processUpload(w http.ResponseWriter, r *http.Request, maxBytes int
 	}
 
 	if err := a.storage.UpsertFileMetadata(meta); err != nil {
-		slog.Error("failed to save file metadata", "error", err)
-		http.Error(w, "Internal Database Error", http.StatusInternalServerError)
-		return "", err
+		return storage.FileMetadata{}, fmt.Errorf("failed to save file metadata: %w", err)
 	}
 
-	return fileID, nil
+	return meta, nil
 }
 
 func (a *API) UploadImageHandler(w http.ResponseWriter, r *http.Request) {
@@ -1231,45 +1407,6 @@ func getExtensionForMime(mimeType string) string {
 	}
 }
 
-func (a *API) WebhookHandler(w http.ResponseWriter, r *http.Request) {
-	user, ok := UserFromContext(r.Context())
-	if !ok {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
-		return
-	}
-
-	if user.TargetChatID == "" {
-		http.Error(w, "Webhook has no target chat configured", http.StatusBadRequest)
-		return
-	}
-
-	var req struct {
-		Content string `json:"content"`
-	}
-
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
-		return
-	}
-
-	req.Content = content.Sanitize(req.Content)
-	if req.Content == "" {
-		http.Error(w, "Message content cannot be empty", http.StatusBadRequest)
-		return
-	}
-
-	a.hub.Dispatch(user.ID, models.ClientMessage{
-		Type:    models.ClientMessageTypeSend,
-		ChatID:  user.TargetChatID,
-		Content: req.Content,
-	}, nil)
-
-	w.Header().Set("Content-Type", "application/json")
-	_ = json.NewEncoder(w).Encode(models.APIResponse{
-		Success: true,
-	})
-}
-
 func (a *API) PushVAPIDPublicKeyHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/octet-stream")
 	_, _ = w.Write([]byte(a.push.PublicKey())) // nosemgrep: go.lang.security.audit.xss.no-direct-write-to-responsewriter.no-direct-write-to-responsewriter
@@ -1315,3 +1452,57 @@ func (a *API) PushSubscribeHandler(w http.ResponseWriter, r *http.Request) {
 
 	w.WriteHeader(http.StatusOK)
 }
+
+// RecoveryCodesHandler replaces the current user's recovery codes with a new
+// set and returns it. The request must carry the user's password and a TOTP
+// code or a current recovery code.
+func (a *API) RecoveryCodesHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := UserFromContext(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req auth.RecoveryCodesRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	codes, err := a.auth.RegenerateRecoveryCodes(user.ID, req)
+	fail := func(status int, message string) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		_ = json.NewEncoder(w).Encode(models.APIResponse{
+			Success: false,
+			Message: message,
+		})
+	}
+	switch {
+	case errors.Is(err, auth.ErrPasskeyOnly):
+		fail(http.StatusBadRequest, "Passkey-only accounts have no recovery codes")
+		return
+	case errors.Is(err, auth.ErrInvalidCredentials):
+		fail(http.StatusForbidden, "Invalid password or code")
+		return
+	case errors.Is(err, auth.ErrTooManyAttempts):
+		fail(http.StatusTooManyRequests, "Too many failed attempts. Try again later")
+		return
+	}
+	if err != nil {
+		slog.Error("failed to regenerate recovery codes", "userID", user.ID, "error", err)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		_ = json.NewEncoder(w).Encode(models.APIResponse{
+			Success: false,
+			Message: "Failed to generate recovery codes",
+		})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(models.RecoveryCodesResponse{
+		APIResponse:   models.APIResponse{Success: true},
+		RecoveryCodes: codes,
+	})
+}
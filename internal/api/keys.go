@@ -0,0 +1,21 @@
+package api
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+)
+
+// KeyStatusHandler reports how many records and files are still encrypted
+// with previous keys during a key rollover.
+func (h *AdminHandler) KeyStatusHandler(w http.ResponseWriter, r *http.Request) {
+	status, err := h.storage.KeyStatus()
+	if err != nil {
+		slog.Error("failed to get key status", "error", err)
+		http.Error(w, "Failed to get key status", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(status)
+}
@@ -0,0 +1,85 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"besedka/internal/models"
+	"besedka/internal/ws"
+)
+
+// PinsHandler returns the pinned messages of a chat, most recently pinned first.
+func (a *API) PinsHandler(w http.ResponseWriter, r *http.Request) {
+	chatID := r.PathValue("id")
+	if chatID == "" {
+		http.Error(w, "Missing chat ID", http.StatusBadRequest)
+		return
+	}
+
+	user, ok := UserFromContext(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	messages, err := a.hub.GetPins(user.ID, chatID)
+	if err != nil {
+		if errors.Is(err, models.ErrNotFound) {
+			http.Error(w, "Chat not found", http.StatusNotFound)
+		} else {
+			slog.Error("failed to get pins", "error", err)
+			http.Error(w, "Server error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	messages = filterVisibleMessages(chatID, messages, user)
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(messages); err != nil {
+		slog.Error("failed to encode pins response", "error", err)
+	}
+}
+
+func (a *API) PinMessageHandler(w http.ResponseWriter, r *http.Request) {
+	a.updatePin(w, r, true)
+}
+
+func (a *API) UnpinMessageHandler(w http.ResponseWriter, r *http.Request) {
+	a.updatePin(w, r, false)
+}
+
+func (a *API) updatePin(w http.ResponseWriter, r *http.Request, pin bool) {
+	chatID := r.PathValue("id")
+	seq, err := strconv.ParseInt(r.PathValue("seq"), 10, 64)
+	if chatID == "" || err != nil {
+		http.Error(w, "Invalid message reference", http.StatusBadRequest)
+		return
+	}
+
+	user, ok := UserFromContext(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	if err := a.hub.PinMessage(user.ID, chatID, seq, pin); err != nil {
+		switch {
+		case errors.Is(err, models.ErrNotFound):
+			http.Error(w, "Message not found", http.StatusNotFound)
+		case errors.Is(err, ws.ErrTooManyPins):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		case errors.Is(err, ws.ErrCannotPost):
+			http.Error(w, err.Error(), http.StatusForbidden)
+		default:
+			slog.Error("failed to update pins", "error", err)
+			http.Error(w, "Server error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,110 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"besedka/internal/models"
+)
+
+// ChatRetention is the retention state of a chat. A nil Retention means the
+// chat follows the global policy.
+type ChatRetention struct {
+	ID        string                  `json:"id"`
+	Name      string                  `json:"name,omitempty"`
+	FirstSeq  int                     `json:"firstSeq,omitempty"`
+	LastSeq   int                     `json:"lastSeq"`
+	Retention *models.RetentionPolicy `json:"retention"`
+}
+
+type RetentionResponse struct {
+	models.APIResponse
+	Global models.RetentionPolicy `json:"global"`
+	Chats  []ChatRetention        `json:"chats"`
+}
+
+// ListRetentionHandler lists the global retention policy and the policy of
+// every chat.
+func (h *AdminHandler) ListRetentionHandler(w http.ResponseWriter, r *http.Request) {
+	chats, err := h.storage.ListChats()
+	if err != nil {
+		slog.Error("failed to list chats", "error", err)
+		http.Error(w, "Failed to list chats", http.StatusInternalServerError)
+		return
+	}
+
+	resp := RetentionResponse{
+		APIResponse: models.APIResponse{Success: true},
+		Global:      h.retention,
+		Chats:       make([]ChatRetention, 0, len(chats)),
+	}
+	for _, c := range chats {
+		resp.Chats = append(resp.Chats, ChatRetention{
+			ID:        c.ID,
+			Name:      c.Name,
+			FirstSeq:  c.FirstSeq,
+			LastSeq:   c.LastSeq,
+			Retention: c.Retention,
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// SetRetentionHandler overrides the global retention policy for a chat. An
+// empty policy keeps the chat's messages forever.
+func (h *AdminHandler) SetRetentionHandler(w http.ResponseWriter, r *http.Request) {
+	chatID := r.URL.Query().Get("id")
+	if chatID == "" {
+		http.Error(w, "Chat ID is required", http.StatusBadRequest)
+		return
+	}
+
+	var policy models.RetentionPolicy
+	if err := json.NewDecoder(r.Body).Decode(&policy); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if policy.MaxAge < 0 || policy.MaxMessages < 0 {
+		http.Error(w, "maxAge and maxMessages must not be negative", http.StatusBadRequest)
+		return
+	}
+
+	h.setRetention(w, chatID, &policy, "Retention policy updated")
+}
+
+// ResetRetentionHandler makes a chat follow the global retention policy again.
+func (h *AdminHandler) ResetRetentionHandler(w http.ResponseWriter, r *http.Request) {
+	chatID := r.URL.Query().Get("id")
+	if chatID == "" {
+		http.Error(w, "Chat ID is required", http.StatusBadRequest)
+		return
+	}
+
+	h.setRetention(w, chatID, nil, "Retention policy reset to global")
+}
+
+func (h *AdminHandler) setRetention(w http.ResponseWriter, chatID string, policy *models.RetentionPolicy, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := h.storage.SetChatRetention(chatID, policy); err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, models.ErrNotFound) {
+			status = http.StatusNotFound
+		}
+		w.WriteHeader(status)
+		_ = json.NewEncoder(w).Encode(models.APIResponse{
+			Success: false,
+			Message: fmt.Sprintf("Failed to set retention policy: %v", err),
+		})
+		return
+	}
+
+	_ = json.NewEncoder(w).Encode(models.APIResponse{
+		Success: true,
+		Message: message,
+	})
+}
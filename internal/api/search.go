@@ -0,0 +1,108 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"html"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"besedka/internal/content"
+	"besedka/internal/models"
+)
+
+const (
+	maxSearchQueryLength = 256
+	maxSearchResults     = 50
+	searchSnippetRadius  = 60
+)
+
+// SearchHit is a single message matching a search query.
+type SearchHit struct {
+	ChatID    string `json:"chatId"`
+	Seq       int64  `json:"seq"`
+	UserID    string `json:"userId"`
+	Timestamp int64  `json:"timestamp"`
+	// Snippet is an HTML-escaped excerpt with matching words wrapped in <mark>.
+	Snippet string `json:"snippet"`
+}
+
+// SearchHandler returns the most recent messages containing every word of
+// the q query parameter, limited to chats the user can read.
+func (a *API) SearchHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := UserFromContext(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	query := strings.TrimSpace(r.URL.Query().Get("q"))
+	if query == "" || len(query) > maxSearchQueryLength {
+		http.Error(w, "Invalid search query", http.StatusBadRequest)
+		return
+	}
+
+	tokens := content.Tokenize(query)
+	refs, err := a.storage.SearchMessages(tokens, a.hub.ChatIDs(user.ID))
+	if err != nil {
+		slog.Error("failed to search messages", "error", err)
+		http.Error(w, "Server error", http.StatusInternalServerError)
+		return
+	}
+
+	// Refs come newest first. Load them a page at a time, one batch per chat,
+	// until enough of them turn out to be visible to the user.
+	type hitKey struct {
+		chatID string
+		seq    int64
+	}
+	hits := make([]SearchHit, 0)
+	denied := make(map[string]bool)
+	for len(refs) > 0 && len(hits) < maxSearchResults {
+		page := refs[:min(len(refs), maxSearchResults-len(hits))]
+		refs = refs[len(page):]
+
+		byChat := make(map[string][]int64)
+		for _, ref := range page {
+			if !denied[ref.ChatID] {
+				byChat[ref.ChatID] = append(byChat[ref.ChatID], ref.Seq)
+			}
+		}
+		found := make(map[hitKey]models.Message)
+		for chatID, seqs := range byChat {
+			messages, err := a.hub.GetChatRecordsAt(user.ID, chatID, seqs)
+			if err != nil {
+				if !errors.Is(err, models.ErrNotFound) {
+					slog.Error("failed to load search hits", "chatID", chatID, "error", err)
+				}
+				denied[chatID] = true
+				continue
+			}
+			for _, m := range filterVisibleMessages(chatID, messages, user) {
+				if !m.Deleted {
+					found[hitKey{chatID, m.Seq}] = m
+				}
+			}
+		}
+
+		for _, ref := range page {
+			m, ok := found[hitKey{ref.ChatID, ref.Seq}]
+			if !ok {
+				continue
+			}
+			hits = append(hits, SearchHit{
+				ChatID:    ref.ChatID,
+				Seq:       m.Seq,
+				UserID:    m.UserID,
+				Timestamp: m.Timestamp,
+				Snippet:   content.Highlight(html.UnescapeString(m.RawContent), tokens, searchSnippetRadius),
+			})
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(hits); err != nil {
+		slog.Error("failed to encode search response", "error", err)
+	}
+}
@@ -0,0 +1,77 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"besedka/internal/models"
+)
+
+func TestSearchHandler(t *testing.T) {
+	apiInst, as, st, _ := setupAPIKeyTest(t)
+	defer func() { _ = st.Close() }()
+
+	_, writerKey, err := as.AddBot("writerbot", "Writer Bot", models.BotPermissions{ReadAll: true, Write: true})
+	if err != nil {
+		t.Fatalf("AddBot failed: %v", err)
+	}
+	_, readerKey, err := as.AddBot("mentionbot", "Mention Bot", models.BotPermissions{ReadMentions: true})
+	if err != nil {
+		t.Fatalf("AddBot failed: %v", err)
+	}
+
+	sendHandler := apiInst.RequireAuth(RequireSameOrigin(RequireUserTypes(apiInst.SendMessageHandler, models.UserTypeHuman, models.UserTypeBot)))
+	for _, text := range []string{"Deploy finished", "@mentionbot deploy started", "unrelated"} {
+		body, _ := json.Marshal(map[string]string{"content": text})
+		req := httptest.NewRequest(http.MethodPost, "/api/chats/townhall/messages", bytes.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+writerKey)
+		req.SetPathValue("id", "townhall")
+		w := httptest.NewRecorder()
+		sendHandler(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected status 200 OK sending message, got %d: %s", w.Code, w.Body.String())
+		}
+	}
+
+	searchHandler := apiInst.RequireAuth(RequireUserTypes(apiInst.SearchHandler, models.UserTypeHuman, models.UserTypeBot))
+	search := func(key, query string) (int, []SearchHit) {
+		req := httptest.NewRequest(http.MethodGet, "/api/search?q="+query, nil)
+		req.Header.Set("Authorization", "Bearer "+key)
+		w := httptest.NewRecorder()
+		searchHandler(w, req)
+		var hits []SearchHit
+		if w.Code == http.StatusOK {
+			if err := json.NewDecoder(w.Body).Decode(&hits); err != nil {
+				t.Fatalf("failed to decode search response: %v", err)
+			}
+		}
+		return w.Code, hits
+	}
+
+	code, hits := search(writerKey, "deploy")
+	if code != http.StatusOK || len(hits) != 2 {
+		t.Fatalf("expected 2 hits, got %d %+v", code, hits)
+	}
+	if hits[0].Seq != 2 || hits[1].Seq != 1 {
+		t.Errorf("expected newest hits first, got %+v", hits)
+	}
+	for _, hit := range hits {
+		if hit.ChatID != "townhall" || !strings.Contains(strings.ToLower(hit.Snippet), "<mark>deploy</mark>") {
+			t.Errorf("unexpected hit: %+v", hit)
+		}
+	}
+
+	// Bots that only read mentions only find messages mentioning them.
+	code, hits = search(readerKey, "deploy")
+	if code != http.StatusOK || len(hits) != 1 || hits[0].Seq != 2 {
+		t.Errorf("expected only the mentioning message, got %d %+v", code, hits)
+	}
+
+	if code, _ := search(writerKey, ""); code != http.StatusBadRequest {
+		t.Errorf("expected status 400 for empty query, got %d", code)
+	}
+}
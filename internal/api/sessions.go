@@ -0,0 +1,65 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"besedka/internal/models"
+)
+
+// SessionsHandler lists the current user's login sessions.
+func (a *API) SessionsHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := UserFromContext(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(a.auth.ListSessions(user.ID, a.getToken(r))); err != nil {
+		slog.Error("failed to encode sessions", "error", err)
+	}
+}
+
+// RevokeSessionHandler logs the current user out of one of their sessions
+// and closes its WebSocket connections.
+func (a *API) RevokeSessionHandler(w http.ResponseWriter, r *http.Request) {
+	sessionID := r.PathValue("id")
+	if sessionID == "" {
+		http.Error(w, "Missing session ID", http.StatusBadRequest)
+		return
+	}
+
+	user, ok := UserFromContext(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	currentID, _ := a.auth.SessionID(a.getToken(r))
+	if err := a.auth.RevokeSession(user.ID, sessionID); err != nil {
+		if errors.Is(err, models.ErrNotFound) {
+			http.Error(w, "Session not found", http.StatusNotFound)
+			return
+		}
+		slog.Error("failed to revoke session", "error", err)
+		http.Error(w, "Server error", http.StatusInternalServerError)
+		return
+	}
+	a.hub.DisconnectSession(user.ID, sessionID)
+
+	if sessionID == currentID {
+		http.SetCookie(w, &http.Cookie{
+			Name:     "token",
+			Value:    "",
+			HttpOnly: true,
+			Secure:   true,
+			Path:     "/",
+			MaxAge:   -1,
+		})
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,46 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"besedka/internal/models"
+	"besedka/internal/ws"
+)
+
+// SetTimerHandler sets the disappearing messages timer of a DM. The body is
+// {"disappearAfter": seconds}, with 0 turning the timer off.
+func (a *API) SetTimerHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := UserFromContext(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req struct {
+		DisappearAfter int64 `json:"disappearAfter"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if err := a.hub.SetDisappearingTimer(user.ID, r.PathValue("id"), req.DisappearAfter); err != nil {
+		switch {
+		case errors.Is(err, models.ErrNotFound):
+			http.Error(w, "Chat not found", http.StatusNotFound)
+		case errors.Is(err, ws.ErrNotDM), errors.Is(err, ws.ErrInvalidTimer):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		case errors.Is(err, ws.ErrCannotPost):
+			http.Error(w, err.Error(), http.StatusForbidden)
+		default:
+			slog.Error("failed to set disappearing messages timer", "error", err)
+			http.Error(w, "Server error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
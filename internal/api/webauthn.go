@@ -3,11 +3,14 @@ package api
 import (
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"log/slog"
 	"net/http"
 	"strings"
 	"time"
 
+	"besedka/internal/auth"
+
 	"github.com/google/uuid"
 )
 
@@ -81,6 +84,59 @@ func (a *API) WebAuthnRegisterFinishHandler(w http.ResponseWriter, r *http.Reque
 	_ = json.NewEncoder(w).Encode(map[string]bool{"success": true})
 }
 
+// WebAuthnSetupBeginHandler starts registering a passkey from a setup link,
+// for users who register without a password.
+func (a *API) WebAuthnSetupBeginHandler(w http.ResponseWriter, r *http.Request) {
+	options, sessionData, err := a.auth.BeginPasskeySetup(r.URL.Query().Get("token"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	sessionID := generateSessionID()
+	a.auth.SaveWebAuthnSession(sessionID, sessionData)
+
+	// nosemgrep: go.lang.security.audit.net.cookie-missing-secure.cookie-missing-secure
+	http.SetCookie(w, &http.Cookie{
+		Name:     "webauthn_session",
+		Value:    sessionID,
+		Path:     "/api/webauthn/",
+		HttpOnly: true,
+		Secure:   strings.HasPrefix(a.auth.RPOrigin, "https://"),
+		SameSite: http.SameSiteLaxMode,
+		Expires:  time.Now().Add(5 * time.Minute),
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(options)
+}
+
+// WebAuthnSetupFinishHandler completes registration with the passkey, making
+// the account passkey-only, and logs the user in.
+func (a *API) WebAuthnSetupFinishHandler(w http.ResponseWriter, r *http.Request) {
+	cookie, err := r.Cookie("webauthn_session")
+	if err != nil {
+		http.Error(w, "Session cookie missing", http.StatusBadRequest)
+		return
+	}
+
+	sessionData, ok := a.auth.GetWebAuthnSession(cookie.Value)
+	if !ok {
+		http.Error(w, "Session expired or not found", http.StatusBadRequest)
+		return
+	}
+	defer a.auth.DeleteWebAuthnSession(cookie.Value)
+
+	query := r.URL.Query()
+	resp, _ := a.auth.CompletePasskeyRegistration(auth.PasskeyRegistrationRequest{
+		Token:       query.Get("token"),
+		DisplayName: query.Get("displayName"),
+		Name:        query.Get("name"),
+		Client:      auth.ClientInfoFromRequest(r),
+	}, sessionData, r)
+	a.writeRegistration(w, resp)
+}
+
 func (a *API) WebAuthnLoginBeginHandler(w http.ResponseWriter, r *http.Request) {
 	options, sessionData, err := a.auth.BeginPasskeyLogin()
 	if err != nil {
@@ -197,6 +253,10 @@ func (a *API) DeletePasskeyHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	
 	err = a.auth.DeletePasskey(user.ID, credID)
+	if errors.Is(err, auth.ErrLastPasskey) {
+		http.Error(w, "Can't remove the only passkey of a passkey-only account", http.StatusBadRequest)
+		return
+	}
 	if err != nil {
 		http.Error(w, "Failed to delete passkey", http.StatusInternalServerError)
 		return
@@ -0,0 +1,608 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"besedka/internal/auth"
+	"besedka/internal/models"
+	"besedka/internal/unfurl"
+	"besedka/internal/ws"
+
+	"github.com/h2non/filetype"
+)
+
+const (
+	maxWebhookAttachments = 10
+	maxSenderNameRunes    = 80
+	maxWebhookJSONSize    = 1 << 20
+	webhookFetchTimeout   = 15 * time.Second
+	avatarCacheSize       = 256
+)
+
+var errInvalidPayload = errors.New("invalid payload")
+
+// WebhookAttachment is a file referenced by URL. It is downloaded and stored
+// like an upload when the message is posted.
+type WebhookAttachment struct {
+	URL  string `json:"url"`
+	Name string `json:"name,omitempty"`
+}
+
+// WebhookRequest is the native incoming webhook payload. Content is markdown.
+// Target picks one of the webhook's allowed chats instead of its default.
+// Username and AvatarURL override how this message's sender is shown.
+type WebhookRequest struct {
+	Content     string              `json:"content"`
+	Target      string              `json:"target,omitempty"`
+	Username    string              `json:"username,omitempty"`
+	AvatarURL   string              `json:"avatarUrl,omitempty"`
+	Attachments []WebhookAttachment `json:"attachments,omitempty"`
+
+	// channel is the Slack channel the payload names. It is only used if it
+	// is one of the webhook's chats.
+	channel string
+}
+
+// webhookFile is a file uploaded with a multipart webhook request.
+type webhookFile struct {
+	name string
+	data []byte
+}
+
+// webhookDecoder turns a JSON payload in one of the supported formats into
+// a native request.
+type webhookDecoder func(data []byte) (WebhookRequest, error)
+
+// WebhookHandler posts a message from a webhook user to its target chat.
+func (a *API) WebhookHandler(w http.ResponseWriter, r *http.Request) {
+	a.handleWebhook(w, r, decodeWebhook)
+}
+
+// SlackWebhookHandler accepts Slack-style incoming webhook payloads.
+func (a *API) SlackWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	a.handleWebhook(w, r, decodeSlackWebhook)
+}
+
+// DiscordWebhookHandler accepts Discord-style incoming webhook payloads.
+func (a *API) DiscordWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	a.handleWebhook(w, r, decodeDiscordWebhook)
+}
+
+// APIKeyFromPath lets integrations that can only be configured with a URL,
+// like Slack and Discord webhook clients, pass the API key as the {key} path
+// segment. It must wrap RequireAuth.
+func APIKeyFromPath(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if key := r.PathValue("key"); key != "" {
+			r.Header.Set("Authorization", "Bearer "+key)
+		}
+		next(w, r)
+	}
+}
+
+func (a *API) handleWebhook(w http.ResponseWriter, r *http.Request, decode webhookDecoder) {
+	user, ok := UserFromContext(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	req, files, err := a.readWebhookRequest(w, r, decode)
+	if err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	target := req.Target
+	if target == "" {
+		target = r.URL.Query().Get("target")
+	}
+	// Slack tools send the channel they were set up for, which is usually
+	// not a Besedka chat.
+	if target == "" && req.channel != "" {
+		if _, err := a.auth.ResolveWebhookTarget(user.ID, req.channel); err == nil {
+			target = req.channel
+		}
+	}
+	chatID, err := a.auth.ResolveWebhookTarget(user.ID, target)
+	if err != nil {
+		switch {
+		case errors.Is(err, auth.ErrInvalidWebhookTarget):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		case errors.Is(err, auth.ErrWebhookChatDenied):
+			http.Error(w, "Webhook is not allowed to post to this chat", http.StatusForbidden)
+		default:
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		}
+		return
+	}
+	if chatID == "" {
+		http.Error(w, "Webhook has no target chat configured", http.StatusBadRequest)
+		return
+	}
+
+	req.Content = strings.TrimSpace(req.Content)
+	if req.Content == "" && len(req.Attachments) == 0 && len(files) == 0 {
+		http.Error(w, "Message content cannot be empty", http.StatusBadRequest)
+		return
+	}
+	if len(req.Attachments)+len(files) > maxWebhookAttachments {
+		http.Error(w, fmt.Sprintf("At most %d attachments are allowed", maxWebhookAttachments), http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), webhookFetchTimeout)
+	defer cancel()
+
+	for _, att := range req.Attachments {
+		data, err := unfurl.Download(ctx, a.fetchClient, att.URL, a.cfg.MaxFileSize)
+		if err != nil {
+			slog.Debug("webhook attachment download failed", "url", att.URL, "error", err)
+			http.Error(w, "Failed to download attachment", http.StatusBadRequest)
+			return
+		}
+		name := att.Name
+		if name == "" {
+			if u, err := url.Parse(att.URL); err == nil {
+				name = path.Base(u.Path)
+			}
+		}
+		files = append(files, webhookFile{name: name, data: data})
+	}
+
+	// saved lists the files stored for this message, to be released if it
+	// is not posted.
+	var saved []string
+	var attachments []models.Attachment
+	for _, f := range files {
+		meta, err := a.saveUpload(user.ID, f.data)
+		if err != nil {
+			slog.Error("failed to save webhook attachment", "error", err)
+			a.releaseUploads(saved)
+			http.Error(w, "Internal Storage Error", http.StatusInternalServerError)
+			return
+		}
+		saved = append(saved, meta.ID)
+		// SVG is posted as a file: it can carry scripts.
+		attType := models.AttachmentTypeFile
+		if filetype.IsImage(f.data) {
+			attType = models.AttachmentTypeImage
+		}
+		name := f.name
+		if name == "" || name == "." || name == "/" {
+			name = "attachment"
+		}
+		attachments = append(attachments, models.Attachment{
+			Type:     attType,
+			Name:     name,
+			MimeType: meta.MimeType,
+			FileID:   meta.ID,
+		})
+	}
+
+	sender, newAvatarID, release := a.webhookSender(ctx, user.ID, req)
+	defer release()
+	if newAvatarID != "" {
+		saved = append(saved, newAvatarID)
+	}
+	err = a.hub.SendMessage(user.ID, models.ClientMessage{
+		Type:        models.ClientMessageTypeSend,
+		ChatID:      chatID,
+		Content:     req.Content,
+		Attachments: attachments,
+		Sender:      sender,
+	}, nil)
+	if err != nil {
+		a.releaseUploads(saved)
+		switch {
+		case errors.Is(err, models.ErrNotFound):
+			http.Error(w, "Chat not found", http.StatusNotFound)
+		case errors.Is(err, ws.ErrCannotPost):
+			http.Error(w, "Webhook is not allowed to post to this chat", http.StatusForbidden)
+		default:
+			slog.Error("failed to post webhook message", "chatID", chatID, "error", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		}
+		return
+	}
+	// Avatars are reused only once a message refers to them.
+	if newAvatarID != "" {
+		a.avatars.Set(avatarCacheKey(user.ID, req.AvatarURL), newAvatarID)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(models.APIResponse{
+		Success: true,
+	})
+}
+
+// readWebhookRequest reads a JSON body, a form with the JSON in a "payload"
+// or "payload_json" field, or a multipart form with plain fields and files.
+func (a *API) readWebhookRequest(w http.ResponseWriter, r *http.Request, decode webhookDecoder) (WebhookRequest, []webhookFile, error) {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch mediaType {
+	case "multipart/form-data":
+		r.Body = http.MaxBytesReader(w, r.Body, a.cfg.MaxFileSize*maxWebhookAttachments+maxWebhookJSONSize)
+		if err := r.ParseMultipartForm(32 << 20); err != nil {
+			return WebhookRequest{}, nil, err
+		}
+	case "application/x-www-form-urlencoded":
+		r.Body = http.MaxBytesReader(w, r.Body, maxWebhookJSONSize)
+		if err := r.ParseForm(); err != nil {
+			return WebhookRequest{}, nil, err
+		}
+	default:
+		data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxWebhookJSONSize))
+		if err != nil {
+			return WebhookRequest{}, nil, err
+		}
+		req, err := decode(data)
+		return req, nil, err
+	}
+
+	var req WebhookRequest
+	var err error
+	if payload := firstNonEmpty(r.PostFormValue("payload_json"), r.PostFormValue("payload")); payload != "" {
+		if req, err = decode([]byte(payload)); err != nil {
+			return WebhookRequest{}, nil, err
+		}
+	} else {
+		req = WebhookRequest{
+			Content:   r.PostFormValue("content"),
+			Target:    r.PostFormValue("target"),
+			Username:  r.PostFormValue("username"),
+			AvatarURL: firstNonEmpty(r.PostFormValue("avatarUrl"), r.PostFormValue("avatar_url")),
+		}
+	}
+
+	if r.MultipartForm == nil {
+		return req, nil, nil
+	}
+	var files []webhookFile
+	fields := make([]string, 0, len(r.MultipartForm.File))
+	for field := range r.MultipartForm.File {
+		fields = append(fields, field)
+	}
+	slices.Sort(fields)
+	for _, field := range fields {
+		for _, fh := range r.MultipartForm.File[field] {
+			if fh.Size > a.cfg.MaxFileSize {
+				return WebhookRequest{}, nil, errInvalidPayload
+			}
+			f, err := fh.Open()
+			if err != nil {
+				return WebhookRequest{}, nil, err
+			}
+			data, err := io.ReadAll(f)
+			_ = f.Close()
+			if err != nil {
+				return WebhookRequest{}, nil, err
+			}
+			files = append(files, webhookFile{name: path.Base(fh.Filename), data: data})
+		}
+	}
+	return req, files, nil
+}
+
+// webhookSender builds the sender override for a message. A missing or
+// unusable avatar is skipped rather than failing the message. If the avatar
+// was downloaded for this message, its file ID is returned as well. Call
+// release once the message is stored or rejected.
+func (a *API) webhookSender(ctx context.Context, userID string, req WebhookRequest) (sender *models.SenderOverride, newAvatarID string, release func()) {
+	name := cleanSenderName(req.Username)
+	avatarID := ""
+	release = func() {}
+	if req.AvatarURL != "" {
+		id, downloaded, held, err := a.webhookAvatar(ctx, userID, req.AvatarURL)
+		if err != nil {
+			slog.Debug("webhook avatar skipped", "url", req.AvatarURL, "error", err)
+		}
+		avatarID = id
+		if downloaded {
+			newAvatarID = id
+		}
+		if held != nil {
+			release = held
+		}
+	}
+	if name == "" && avatarID == "" {
+		return nil, "", release
+	}
+	return &models.SenderOverride{Name: name, AvatarID: avatarID}, newAvatarID, release
+}
+
+// avatarCacheKey identifies a webhook's avatar in the avatar cache.
+func avatarCacheKey(userID, avatarURL string) string {
+	return userID + " " + avatarURL
+}
+
+// webhookAvatar returns the file ID of an avatar image, and whether it was
+// downloaded and stored now. Webhooks usually send the same avatar with every
+// message, so recent downloads are reused. A reused avatar is held, so
+// retention doesn't delete it before the message refers to it, until the
+// returned func is called; it is nil otherwise.
+func (a *API) webhookAvatar(ctx context.Context, userID, avatarURL string) (string, bool, func(), error) {
+	key := avatarCacheKey(userID, avatarURL)
+	if id, err := a.avatars.Get(key); err == nil {
+		if release, ok := a.storage.HoldFile(id); ok {
+			return id, false, release, nil
+		}
+		// Deleted along with the last message that referred to it.
+		_ = a.avatars.Del(key)
+	}
+
+	data, err := unfurl.Download(ctx, a.fetchClient, avatarURL, a.cfg.MaxAvatarSize)
+	if err != nil {
+		return "", false, nil, err
+	}
+	// SVG is not detected by filetype and is rejected on purpose: it can carry scripts.
+	if !filetype.IsImage(data) {
+		return "", false, nil, errors.New("not an image")
+	}
+	meta, err := a.saveUpload(userID, data)
+	if err != nil {
+		return "", false, nil, err
+	}
+	return meta.ID, true, nil, nil
+}
+
+// releaseUploads deletes files stored for a webhook message that was not
+// posted.
+func (a *API) releaseUploads(fileIDs []string) {
+	if _, err := a.storage.ReleaseFiles(fileIDs); err != nil {
+		slog.Error("failed to release webhook files", "error", err)
+	}
+}
+
+// cleanSenderName strips control characters and limits the length of a
+// sender name. The name is plain text and is escaped by clients.
+func cleanSenderName(name string) string {
+	name = strings.Join(strings.FieldsFunc(name, unicode.IsControl), " ")
+	name = strings.TrimSpace(name)
+	if utf8.RuneCountInString(name) > maxSenderNameRunes {
+		name = string([]rune(name)[:maxSenderNameRunes])
+	}
+	return name
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+func decodeWebhook(data []byte) (WebhookRequest, error) {
+	var req WebhookRequest
+	if err := json.Unmarshal(data, &req); err != nil {
+		return WebhookRequest{}, err
+	}
+	return req, nil
+}
+
+type slackText struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+type slackBlock struct {
+	Type     string      `json:"type"`
+	Text     *slackText  `json:"text"`
+	Fields   []slackText `json:"fields"`
+	Elements []slackText `json:"elements"`
+	ImageURL string      `json:"image_url"`
+	AltText  string      `json:"alt_text"`
+}
+
+type slackField struct {
+	Title string `json:"title"`
+	Value string `json:"value"`
+}
+
+type slackAttachment struct {
+	Fallback  string       `json:"fallback"`
+	Pretext   string       `json:"pretext"`
+	Title     string       `json:"title"`
+	TitleLink string       `json:"title_link"`
+	Text      string       `json:"text"`
+	Fields    []slackField `json:"fields"`
+	ImageURL  string       `json:"image_url"`
+	Footer    string       `json:"footer"`
+}
+
+type slackWebhook struct {
+	Text        string            `json:"text"`
+	Channel     string            `json:"channel"`
+	Username    string            `json:"username"`
+	IconURL     string            `json:"icon_url"`
+	Blocks      []slackBlock      `json:"blocks"`
+	Attachments []slackAttachment `json:"attachments"`
+}
+
+var (
+	slackLinkRegex = regexp.MustCompile(`<([^<>|]+)(?:\|([^<>]*))?>`)
+	slackBoldRegex = regexp.MustCompile(`(?m)(^|[\s(_~])\*([^*\n]+)\*`)
+)
+
+// slackMarkdown converts Slack mrkdwn to markdown: links and mentions in
+// angle brackets, single-asterisk bold and Slack's HTML entities.
+func slackMarkdown(s string) string {
+	s = slackLinkRegex.ReplaceAllStringFunc(s, func(m string) string {
+		parts := slackLinkRegex.FindStringSubmatch(m)
+		target, label := parts[1], parts[2]
+		switch target[0] {
+		case '!':
+			name, _, _ := strings.Cut(target[1:], "^")
+			return "@" + name
+		case '@', '#':
+			if label != "" {
+				return string(target[0]) + label
+			}
+			return target
+		}
+		if label == "" {
+			return target
+		}
+		return "[" + label + "](" + target + ")"
+	})
+	s = slackBoldRegex.ReplaceAllString(s, "$1**$2**")
+	return strings.NewReplacer("&lt;", "<", "&gt;", ">", "&amp;", "&").Replace(s)
+}
+
+// decodeSlackWebhook renders text, section blocks and legacy attachments as
+// markdown paragraphs. Images become attachments.
+func decodeSlackWebhook(data []byte) (WebhookRequest, error) {
+	var p slackWebhook
+	if err := json.Unmarshal(data, &p); err != nil {
+		return WebhookRequest{}, err
+	}
+
+	// "#townhall" and "@username" name Besedka chats the same way.
+	req := WebhookRequest{channel: strings.TrimLeft(p.Channel, "#@"), Username: p.Username, AvatarURL: p.IconURL}
+	var parts []string
+	add := func(s string) {
+		if s = strings.TrimSpace(slackMarkdown(s)); s != "" {
+			parts = append(parts, s)
+		}
+	}
+
+	// Slack shows blocks instead of text when both are set.
+	if len(p.Blocks) == 0 {
+		add(p.Text)
+	}
+	for _, b := range p.Blocks {
+		switch b.Type {
+		case "header":
+			if b.Text != nil {
+				add("**" + b.Text.Text + "**")
+			}
+		case "section", "context":
+			var lines []string
+			if b.Text != nil {
+				lines = append(lines, b.Text.Text)
+			}
+			for _, f := range slices.Concat(b.Fields, b.Elements) {
+				if f.Text != "" {
+					lines = append(lines, f.Text)
+				}
+			}
+			add(strings.Join(lines, "\n"))
+		case "image":
+			if b.ImageURL != "" {
+				req.Attachments = append(req.Attachments, WebhookAttachment{URL: b.ImageURL, Name: b.AltText})
+			}
+		}
+	}
+	for _, att := range p.Attachments {
+		var lines []string
+		if att.Pretext != "" {
+			lines = append(lines, att.Pretext)
+		}
+		switch {
+		case att.Title != "" && att.TitleLink != "":
+			lines = append(lines, "*<"+att.TitleLink+"|"+att.Title+">*")
+		case att.Title != "":
+			lines = append(lines, "*"+att.Title+"*")
+		}
+		if att.Text != "" {
+			lines = append(lines, att.Text)
+		}
+		for _, f := range att.Fields {
+			lines = append(lines, "*"+f.Title+"*: "+f.Value)
+		}
+		if att.Footer != "" {
+			lines = append(lines, "_"+att.Footer+"_")
+		}
+		if len(lines) == 0 {
+			lines = append(lines, att.Fallback)
+		}
+		add(strings.Join(lines, "\n"))
+		if att.ImageURL != "" {
+			req.Attachments = append(req.Attachments, WebhookAttachment{URL: att.ImageURL})
+		}
+	}
+	req.Content = strings.Join(parts, "\n\n")
+	return req, nil
+}
+
+type discordEmbed struct {
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	URL         string `json:"url"`
+	Author      *struct {
+		Name string `json:"name"`
+	} `json:"author"`
+	Fields []struct {
+		Name  string `json:"name"`
+		Value string `json:"value"`
+	} `json:"fields"`
+	Image *struct {
+		URL string `json:"url"`
+	} `json:"image"`
+	Footer *struct {
+		Text string `json:"text"`
+	} `json:"footer"`
+}
+
+type discordWebhook struct {
+	Content   string         `json:"content"`
+	Username  string         `json:"username"`
+	AvatarURL string         `json:"avatar_url"`
+	Embeds    []discordEmbed `json:"embeds"`
+}
+
+// decodeDiscordWebhook appends embeds to the content as markdown paragraphs.
+// Embed images become attachments.
+func decodeDiscordWebhook(data []byte) (WebhookRequest, error) {
+	var p discordWebhook
+	if err := json.Unmarshal(data, &p); err != nil {
+		return WebhookRequest{}, err
+	}
+
+	req := WebhookRequest{Username: p.Username, AvatarURL: p.AvatarURL}
+	parts := []string{p.Content}
+	for _, e := range p.Embeds {
+		var lines []string
+		if e.Author != nil && e.Author.Name != "" {
+			lines = append(lines, e.Author.Name)
+		}
+		switch {
+		case e.Title != "" && e.URL != "":
+			lines = append(lines, "**["+e.Title+"]("+e.URL+")**")
+		case e.Title != "":
+			lines = append(lines, "**"+e.Title+"**")
+		}
+		if e.Description != "" {
+			lines = append(lines, e.Description)
+		}
+		for _, f := range e.Fields {
+			lines = append(lines, "**"+f.Name+"**: "+f.Value)
+		}
+		if e.Footer != nil && e.Footer.Text != "" {
+			lines = append(lines, "_"+e.Footer.Text+"_")
+		}
+		parts = append(parts, strings.Join(lines, "\n"))
+		if e.Image != nil && e.Image.URL != "" {
+			req.Attachments = append(req.Attachments, WebhookAttachment{URL: e.Image.URL})
+		}
+	}
+	req.Content = strings.TrimSpace(strings.Join(slices.DeleteFunc(parts, func(s string) bool { return s == "" }), "\n\n"))
+	return req, nil
+}
@@ -0,0 +1,276 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"image"
+	"image/png"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"besedka/internal/models"
+	"besedka/internal/unfurl"
+)
+
+func TestSlackMarkdown(t *testing.T) {
+	for in, want := range map[string]string{
+		"*Build* passed":                    "**Build** passed",
+		"see <https://ci.example/42|#42>":   "see [#42](https://ci.example/42)",
+		"<https://ci.example/42>":           "https://ci.example/42",
+		"<!here> deploy &lt;prod&gt; &amp;": "@here deploy <prod> &",
+		"a*b*c stays":                       "a*b*c stays",
+	} {
+		if got := slackMarkdown(in); got != want {
+			t.Errorf("slackMarkdown(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestWebhookRichPayloads(t *testing.T) {
+	apiInst, as, st, _ := setupAPIKeyTest(t)
+	defer func() { _ = st.Close() }()
+	apiInst.cfg.MaxAvatarSize = 1 << 20
+	apiInst.fetchClient = unfurl.NewClient(time.Second, true)
+
+	var pngData bytes.Buffer
+	if err := png.Encode(&pngData, image.NewRGBA(image.Rect(0, 0, 4, 4))); err != nil {
+		t.Fatalf("failed to encode png: %v", err)
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/logo.png":
+			w.Header().Set("Content-Type", "image/png")
+			_, _ = w.Write(pngData.Bytes())
+		case "/report.txt":
+			w.Header().Set("Content-Type", "text/plain")
+			_, _ = w.Write([]byte("all green"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	_, webhookKey, err := as.AddWebhook("ci", "CI", []string{"townhall"})
+	if err != nil {
+		t.Fatalf("AddWebhook failed: %v", err)
+	}
+
+	post := func(handler http.HandlerFunc, target, contentType string, body []byte) int {
+		req := httptest.NewRequest(http.MethodPost, target, bytes.NewReader(body))
+		req.Header.Set("Content-Type", contentType)
+		if !strings.Contains(target, webhookKey) {
+			req.Header.Set("Authorization", "Bearer "+webhookKey)
+		}
+		w := httptest.NewRecorder()
+		mux := http.NewServeMux()
+		mux.HandleFunc("POST /api/webhook", handler)
+		mux.HandleFunc("POST /api/webhook/{format}/{key}", handler)
+		mux.ServeHTTP(w, req)
+		return w.Code
+	}
+	lastMessage := func() models.Message {
+		t.Helper()
+		messages, err := st.ListMessages("townhall", 0, 100)
+		if err != nil || len(messages) == 0 {
+			t.Fatalf("expected a stored message, got %v", err)
+		}
+		return messages[len(messages)-1]
+	}
+	wrap := func(h http.HandlerFunc) http.HandlerFunc {
+		return APIKeyFromPath(apiInst.RequireAuth(RequireSameOrigin(RequireUserTypes(h, models.UserTypeWebhook))))
+	}
+
+	// Native payload with markdown, attachments by URL and a sender override.
+	body, _ := json.Marshal(WebhookRequest{
+		Content:   "**Deploy** finished",
+		Username:  "Release\nBot",
+		AvatarURL: srv.URL + "/logo.png",
+		Attachments: []WebhookAttachment{
+			{URL: srv.URL + "/logo.png"},
+			{URL: srv.URL + "/report.txt", Name: "report.txt"},
+		},
+	})
+	if code := post(wrap(apiInst.WebhookHandler), "/api/webhook", "application/json", body); code != http.StatusOK {
+		t.Fatalf("expected 200 for native payload, got %d", code)
+	}
+	msg := lastMessage()
+	if msg.Content != "**Deploy** finished" {
+		t.Errorf("expected markdown to be kept, got %q", msg.Content)
+	}
+	if msg.Sender == nil || msg.Sender.Name != "Release Bot" || msg.Sender.AvatarID == "" {
+		t.Errorf("unexpected sender override %+v", msg.Sender)
+	}
+	if len(msg.Attachments) != 2 || msg.Attachments[0].Type != models.AttachmentTypeImage ||
+		msg.Attachments[0].Name != "logo.png" || msg.Attachments[1].Type != models.AttachmentTypeFile {
+		t.Errorf("unexpected attachments %+v", msg.Attachments)
+	}
+
+	body, _ = json.Marshal(WebhookRequest{Content: "broken", Attachments: []WebhookAttachment{{URL: srv.URL + "/missing"}}})
+	if code := post(wrap(apiInst.WebhookHandler), "/api/webhook", "application/json", body); code != http.StatusBadRequest {
+		t.Errorf("expected 400 for an attachment that can't be downloaded, got %d", code)
+	}
+
+	// Slack-style payload with the key in the URL.
+	slack := `{"text":"fallback","username":"Jenkins","blocks":[{"type":"section","text":{"type":"mrkdwn","text":"*Build* <https://ci.example/42|#42> passed"}}]}`
+	if code := post(wrap(apiInst.SlackWebhookHandler), "/api/webhook/slack/"+webhookKey, "application/json", []byte(slack)); code != http.StatusOK {
+		t.Fatalf("expected 200 for Slack payload, got %d", code)
+	}
+	if msg := lastMessage(); msg.Content != "**Build** [#42](https://ci.example/42) passed" || msg.Sender == nil || msg.Sender.Name != "Jenkins" {
+		t.Errorf("unexpected Slack message %q from %+v", msg.Content, msg.Sender)
+	}
+
+	// Discord-style multipart payload with an embed and a file.
+	var form bytes.Buffer
+	mw := multipart.NewWriter(&form)
+	_ = mw.WriteField("payload_json", `{"content":"Alert","embeds":[{"title":"CPU","url":"https://mon.example","fields":[{"name":"host","value":"db1"}]}]}`)
+	fw, _ := mw.CreateFormFile("files[0]", "graph.png")
+	_, _ = fw.Write(pngData.Bytes())
+	_ = mw.Close()
+	if code := post(wrap(apiInst.DiscordWebhookHandler), "/api/webhook/discord/"+webhookKey, mw.FormDataContentType(), form.Bytes()); code != http.StatusOK {
+		t.Fatalf("expected 200 for Discord payload, got %d", code)
+	}
+	msg = lastMessage()
+	if msg.Content != "Alert\n\n**[CPU](https://mon.example)**\n**host**: db1" || msg.Sender != nil {
+		t.Errorf("unexpected Discord message %q from %+v", msg.Content, msg.Sender)
+	}
+	if len(msg.Attachments) != 1 || msg.Attachments[0].Name != "graph.png" || msg.Attachments[0].Type != models.AttachmentTypeImage {
+		t.Errorf("unexpected Discord attachments %+v", msg.Attachments)
+	}
+
+	if code := post(wrap(apiInst.SlackWebhookHandler), "/api/webhook/slack/not-a-key", "application/json", []byte(slack)); code != http.StatusUnauthorized {
+		t.Errorf("expected 401 for an invalid key in the URL, got %d", code)
+	}
+}
+
+func TestWebhookTargets(t *testing.T) {
+	apiInst, as, st, hub := setupAPIKeyTest(t)
+	defer func() { _ = st.Close() }()
+
+	if _, err := as.AddUser("alice", "Alice"); err != nil {
+		t.Fatalf("AddUser failed: %v", err)
+	}
+	alice, err := as.GetUserByUsername("alice")
+	if err != nil {
+		t.Fatalf("GetUserByUsername failed: %v", err)
+	}
+	if err := as.ActivateUser(alice.ID); err != nil {
+		t.Fatalf("ActivateUser failed: %v", err)
+	}
+	hook, webhookKey, err := as.AddWebhook("alerts", "Alerts", []string{"townhall"})
+	if err != nil {
+		t.Fatalf("AddWebhook failed: %v", err)
+	}
+	if allUsers, err := as.GetUsers(); err == nil {
+		hub.EnsureDMsFor(hook, allUsers)
+	}
+	group, err := hub.CreateGroup(alice.ID, "Ops", nil)
+	if err != nil {
+		t.Fatalf("CreateGroup failed: %v", err)
+	}
+
+	admin := NewAdminHandler(as, hub, st, "", 0, models.RetentionPolicy{})
+	setChats := func(targets ...string) int {
+		body, _ := json.Marshal(WebhookChatsRequest{Targets: targets})
+		req := httptest.NewRequest(http.MethodPost, "/api/users/webhook-chats?id="+hook.ID, bytes.NewReader(body))
+		w := httptest.NewRecorder()
+		admin.SetWebhookChatsHandler(w, req)
+		return w.Code
+	}
+	if code := setChats("townhall", "group_missing"); code != http.StatusBadRequest {
+		t.Errorf("expected 400 for an unknown group, got %d", code)
+	}
+	if code := setChats("townhall", "alice", group.ID); code != http.StatusOK {
+		t.Fatalf("expected 200 setting webhook chats, got %d", code)
+	}
+
+	handler := apiInst.RequireAuth(RequireSameOrigin(RequireUserTypes(apiInst.WebhookHandler, models.UserTypeWebhook)))
+	post := func(target, query string) int {
+		body, _ := json.Marshal(WebhookRequest{Content: "ping", Target: target})
+		req := httptest.NewRequest(http.MethodPost, "/api/webhook"+query, bytes.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+webhookKey)
+		w := httptest.NewRecorder()
+		handler(w, req)
+		return w.Code
+	}
+
+	for _, tc := range []struct {
+		target, query, chatID string
+	}{
+		{"", "", "townhall"},
+		{"alice", "", models.GetDMID(hook.ID, alice.ID)},
+		{"", "?target=" + group.ID, group.ID},
+	} {
+		if code := post(tc.target, tc.query); code != http.StatusOK {
+			t.Fatalf("posting to %q%s: expected 200, got %d", tc.target, tc.query, code)
+		}
+		messages, err := st.ListMessages(tc.chatID, 0, 10)
+		if err != nil || len(messages) != 1 || messages[0].UserID != hook.ID {
+			t.Errorf("expected the message in %s, got %+v (%v)", tc.chatID, messages, err)
+		}
+	}
+
+	if code := post("group_other", ""); code != http.StatusForbidden {
+		t.Errorf("expected 403 for a chat outside the allow-list, got %d", code)
+	}
+	if code := post("nobody", ""); code != http.StatusBadRequest {
+		t.Errorf("expected 400 for an unknown target, got %d", code)
+	}
+
+	// A Slack channel picks the chat only if it is one of the webhook's chats.
+	slackHandler := apiInst.RequireAuth(RequireSameOrigin(RequireUserTypes(apiInst.SlackWebhookHandler, models.UserTypeWebhook)))
+	postSlack := func(channel string) int {
+		body, _ := json.Marshal(map[string]string{"text": "from slack", "channel": channel})
+		req := httptest.NewRequest(http.MethodPost, "/api/webhook/slack", bytes.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+webhookKey)
+		w := httptest.NewRecorder()
+		slackHandler(w, req)
+		return w.Code
+	}
+	for channel, chatID := range map[string]string{
+		"#alerts-prod": "townhall",
+		"@alice":       models.GetDMID(hook.ID, alice.ID),
+	} {
+		if code := postSlack(channel); code != http.StatusOK {
+			t.Fatalf("posting to Slack channel %q: expected 200, got %d", channel, code)
+		}
+		messages, err := st.ListMessages(chatID, 0, 10)
+		if err != nil || len(messages) != 2 || messages[1].Content != "from slack" {
+			t.Errorf("expected the Slack message in %s, got %+v (%v)", chatID, messages, err)
+		}
+	}
+
+	// Files uploaded with a message the hub rejects are deleted. The DM with
+	// bob is allowed but was never opened.
+	if _, err := as.AddUser("bob", "Bob"); err != nil {
+		t.Fatalf("AddUser failed: %v", err)
+	}
+	bob, _ := as.GetUserByUsername("bob")
+	if err := as.ActivateUser(bob.ID); err != nil {
+		t.Fatalf("ActivateUser failed: %v", err)
+	}
+	if code := setChats("townhall", "alice", "bob", group.ID); code != http.StatusOK {
+		t.Fatalf("expected 200 setting webhook chats, got %d", code)
+	}
+	var form bytes.Buffer
+	mw := multipart.NewWriter(&form)
+	_ = mw.WriteField("content", "report")
+	_ = mw.WriteField("target", "bob")
+	fw, _ := mw.CreateFormFile("file", "report.txt")
+	_, _ = fw.Write([]byte("all green"))
+	_ = mw.Close()
+	req := httptest.NewRequest(http.MethodPost, "/api/webhook", &form)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	req.Header.Set("Authorization", "Bearer "+webhookKey)
+	w := httptest.NewRecorder()
+	handler(w, req)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for a chat the hub doesn't have, got %d", w.Code)
+	}
+	if files, err := st.ListFileMetadata(); err != nil || len(files) != 0 {
+		t.Errorf("expected the uploaded file to be deleted, got %+v (%v)", files, err)
+	}
+}
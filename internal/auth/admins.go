@@ -0,0 +1,437 @@
+package auth
+
+import (
+	"cmp"
+	"crypto/hmac"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"besedka/internal/content"
+	"besedka/internal/models"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/google/uuid"
+)
+
+const (
+	DefaultAdminTokenExpiry = 12 * time.Hour
+	// adminIDPrefix keeps admin IDs apart from user IDs, so an admin passkey
+	// can't be used to sign in to the chat and the other way round.
+	adminIDPrefix          = "admin_"
+	minAdminPasswordLength = 12
+)
+
+var (
+	ErrAdminsExist      = errors.New("admin accounts already exist")
+	ErrAdminExists      = errors.New("admin already exists")
+	ErrLastAdmin        = errors.New("the last admin account can't be deleted")
+	ErrInvalidAdmin     = errors.New("invalid admin account")
+	ErrAdminLoginFailed = errors.New("login failed")
+	ErrTooManyAttempts  = errors.New("too many failed login attempts")
+	ErrBootstrapToken   = errors.New("invalid bootstrap token")
+)
+
+// Admin is an account of the admin server. Admins are not chat users: they
+// sign in with a password and TOTP, or a passkey, to manage the chat.
+type Admin struct {
+	ID           string
+	UserName     string
+	PasswordHash string
+	TOTPSecret   string
+	// Remember last TOTP to prevent replay attacks
+	LastTOTP  int
+	CreatedAt int64  // Unix timestamp (seconds)
+	CreatedBy string // ID of the admin who added this one, empty for the first
+	// Counter for consecutive failed login attempts to throttle brute force attacks.
+	FailedLoginAttempts int64
+	LastAttemptTime     int64
+}
+
+// AdminToken is a login token of an admin. Only its hash is kept.
+type AdminToken struct {
+	TokenHash string
+	AdminID   string
+	CreatedAt int64 // Unix timestamp (seconds)
+	ExpiresAt int64 // Unix timestamp (seconds)
+	IP        string
+}
+
+type AdminLoginRequest struct {
+	Username string     `json:"username"`
+	Password string     `json:"password"`
+	TOTP     int        `json:"totp"`
+	Client   ClientInfo `json:"-"`
+}
+
+// loadAdmins reads admin accounts and their unexpired tokens from storage.
+func (as *AuthService) loadAdmins() error {
+	admins, err := as.storage.ListAdmins()
+	if err != nil {
+		return fmt.Errorf("failed to list admins: %w", err)
+	}
+	tx := as.admins.Lock()
+	defer tx.Unlock()
+	for _, admin := range admins {
+		tx.Set(admin.ID, &admin)
+	}
+	if tx.Len() == 0 {
+		as.bootstrapToken = as.AdminBootstrapToken
+		if as.bootstrapToken == "" {
+			as.bootstrapToken = rand.Text()
+		}
+	}
+
+	tokens, err := as.storage.ListAdminTokens()
+	if err != nil {
+		return fmt.Errorf("failed to list admin tokens: %w", err)
+	}
+	now := as.now().Unix()
+	for _, token := range tokens {
+		if token.ExpiresAt <= now {
+			if err := as.storage.DeleteAdminToken(token.TokenHash); err != nil {
+				slog.Error("failed to delete expired admin token", "admin_id", token.AdminID, "error", err)
+			}
+			continue
+		}
+		as.adminTokens.Set(token.TokenHash, token)
+	}
+	return nil
+}
+
+// HasAdmins reports whether any admin account exists.
+func (as *AuthService) HasAdmins() bool {
+	tx := as.admins.RLock()
+	defer tx.Unlock()
+	return tx.Len() > 0
+}
+
+// BootstrapToken returns the one-time token BootstrapAdmin needs, or "" once
+// an admin exists. The server prints it to its log, so only someone with
+// access to the server console can create the first admin.
+func (as *AuthService) BootstrapToken() string {
+	tx := as.admins.RLock()
+	defer tx.Unlock()
+	return as.bootstrapToken
+}
+
+// BootstrapAdmin creates the first admin account and logs it in, given the
+// token from BootstrapToken. It fails with ErrBootstrapToken if the token
+// doesn't match and with ErrAdminsExist once there is an admin; further
+// admins are added by existing ones with AddAdmin. The returned admin carries
+// the TOTP secret to enroll in an authenticator app.
+func (as *AuthService) BootstrapAdmin(bootstrapToken, username, password string, client ClientInfo) (Admin, string, AdminToken, error) {
+	tx := as.admins.Lock()
+	defer tx.Unlock()
+
+	if tx.Len() > 0 {
+		return Admin{}, "", AdminToken{}, ErrAdminsExist
+	}
+	if as.bootstrapToken == "" || !hmac.Equal([]byte(bootstrapToken), []byte(as.bootstrapToken)) {
+		return Admin{}, "", AdminToken{}, ErrBootstrapToken
+	}
+	admin, err := as.newAdmin(tx.Snapshot(), username, password, "")
+	if err != nil {
+		return Admin{}, "", AdminToken{}, err
+	}
+	if err := as.storage.UpsertAdmin(*admin); err != nil {
+		return Admin{}, "", AdminToken{}, fmt.Errorf("failed to persist admin: %w", err)
+	}
+	tx.Set(admin.ID, admin)
+	as.bootstrapToken = ""
+
+	rawToken, token, err := as.startAdminSession(admin.ID, client)
+	if err != nil {
+		return Admin{}, "", AdminToken{}, err
+	}
+	return *admin, rawToken, token, nil
+}
+
+// AddAdmin creates another admin account with an initial password. The
+// returned admin carries the TOTP secret to hand over with the password.
+func (as *AuthService) AddAdmin(username, password, createdBy string) (Admin, error) {
+	tx := as.admins.Lock()
+	defer tx.Unlock()
+
+	admin, err := as.newAdmin(tx.Snapshot(), username, password, createdBy)
+	if err != nil {
+		return Admin{}, err
+	}
+	if err := as.storage.UpsertAdmin(*admin); err != nil {
+		return Admin{}, fmt.Errorf("failed to persist admin: %w", err)
+	}
+	tx.Set(admin.ID, admin)
+	return *admin, nil
+}
+
+// newAdmin validates and describes a new admin account. existing holds the
+// current admins by ID.
+func (as *AuthService) newAdmin(existing map[string]*Admin, username, password, createdBy string) (*Admin, error) {
+	if err := content.ValidateUsername(username); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidAdmin, err)
+	}
+	if len(password) < minAdminPasswordLength {
+		return nil, fmt.Errorf("%w: password must be at least %d characters", ErrInvalidAdmin, minAdminPasswordLength)
+	}
+	for _, admin := range existing {
+		if admin.UserName == username {
+			return nil, ErrAdminExists
+		}
+	}
+
+	totpSecret, err := as.generateTOTPSecret()
+	if err != nil {
+		return nil, err
+	}
+	return &Admin{
+		ID:           adminIDPrefix + uuid.NewString(),
+		UserName:     username,
+		PasswordHash: as.hashPassword(username, password),
+		TOTPSecret:   totpSecret,
+		CreatedAt:    as.now().Unix(),
+		CreatedBy:    createdBy,
+	}, nil
+}
+
+// ListAdmins returns all admin accounts, oldest first.
+func (as *AuthService) ListAdmins() []Admin {
+	tx := as.admins.RLock()
+	defer tx.Unlock()
+
+	admins := make([]Admin, 0, tx.Len())
+	for _, admin := range tx.Snapshot() {
+		admins = append(admins, *admin)
+	}
+	slices.SortFunc(admins, func(a, b Admin) int {
+		return cmp.Or(cmp.Compare(a.CreatedAt, b.CreatedAt), cmp.Compare(a.UserName, b.UserName))
+	})
+	return admins
+}
+
+// GetAdmin returns an admin account by ID.
+func (as *AuthService) GetAdmin(adminID string) (Admin, error) {
+	tx := as.admins.RLock()
+	defer tx.Unlock()
+	admin, err := tx.Get(adminID)
+	if err != nil {
+		return Admin{}, models.ErrNotFound
+	}
+	return *admin, nil
+}
+
+// DeleteAdmin removes an admin account with its tokens and passkeys. The
+// last admin can't be deleted, as nobody could sign in to add another.
+func (as *AuthService) DeleteAdmin(adminID string) error {
+	tx := as.admins.Lock()
+	defer tx.Unlock()
+
+	if _, err := tx.Get(adminID); err != nil {
+		return models.ErrNotFound
+	}
+	if tx.Len() == 1 {
+		return ErrLastAdmin
+	}
+	if err := as.storage.DeleteAdmin(adminID); err != nil {
+		return fmt.Errorf("failed to delete admin: %w", err)
+	}
+	_ = tx.Del(adminID)
+
+	for tokenHash, token := range as.adminTokens.Snapshot() {
+		if token.AdminID == adminID {
+			as.deleteAdminToken(tokenHash)
+		}
+	}
+	if err := as.storage.DeleteAllPasskeys(adminID); err != nil {
+		slog.Error("failed to delete admin passkeys", "admin_id", adminID, "error", err)
+	}
+	return nil
+}
+
+// AdminLogin checks the password and TOTP of an admin and returns a new
+// login token. Failed attempts are throttled like user logins.
+func (as *AuthService) AdminLogin(req AdminLoginRequest) (string, AdminToken, error) {
+	now := as.now()
+	tx := as.admins.Lock()
+	defer tx.Unlock()
+
+	var admin *Admin
+	for _, a := range tx.Snapshot() {
+		if a.UserName == req.Username {
+			admin = a
+			break
+		}
+	}
+	if admin == nil {
+		return "", AdminToken{}, ErrAdminLoginFailed
+	}
+
+	if admin.FailedLoginAttempts > 3 {
+		failedAttempts := admin.FailedLoginAttempts
+		nextAttempt := admin.LastAttemptTime + 30*(failedAttempts*failedAttempts)
+		if now.Unix() < nextAttempt {
+			return "", AdminToken{}, fmt.Errorf("%w: next attempt in %d seconds", ErrTooManyAttempts, nextAttempt-now.Unix())
+		}
+	}
+
+	if !as.checkPassword(&admin.PasswordHash, admin.UserName, req.Password) ||
+		!as.checkTOTP(admin.TOTPSecret, req.TOTP, admin.LastTOTP) {
+		admin.FailedLoginAttempts++
+		admin.LastAttemptTime = now.Unix()
+		if err := as.storage.UpsertAdmin(*admin); err != nil {
+			slog.Error("failed to persist admin after failed login", "admin_id", admin.ID, "error", err)
+		}
+		return "", AdminToken{}, ErrAdminLoginFailed
+	}
+
+	admin.LastTOTP = req.TOTP
+	admin.FailedLoginAttempts = 0
+	admin.LastAttemptTime = now.Unix()
+	if err := as.storage.UpsertAdmin(*admin); err != nil {
+		slog.Error("failed to persist admin after login", "admin_id", admin.ID, "error", err)
+	}
+	return as.startAdminSession(admin.ID, req.Client)
+}
+
+// startAdminSession issues a login token for an admin. The caller holds the
+// admins lock.
+func (as *AuthService) startAdminSession(adminID string, client ClientInfo) (string, AdminToken, error) {
+	rawToken, err := as.generateToken()
+	if err != nil {
+		return "", AdminToken{}, err
+	}
+	now := as.now()
+	token := AdminToken{
+		TokenHash: as.hashToken(rawToken),
+		AdminID:   adminID,
+		CreatedAt: now.Unix(),
+		ExpiresAt: now.Add(as.AdminTokenExpiry).Unix(),
+		IP:        client.IP,
+	}
+	if err := as.storage.UpsertAdminToken(token); err != nil {
+		return "", AdminToken{}, fmt.Errorf("failed to persist admin token: %w", err)
+	}
+	as.adminTokens.Set(token.TokenHash, token)
+	return rawToken, token, nil
+}
+
+// GetAdminByToken returns the admin a login token belongs to. Expired tokens
+// are deleted.
+func (as *AuthService) GetAdminByToken(rawToken string) (Admin, error) {
+	tokenHash := as.hashToken(rawToken)
+	token, err := as.adminTokens.Get(tokenHash)
+	if err != nil {
+		return Admin{}, models.ErrNotFound
+	}
+	if token.ExpiresAt <= as.now().Unix() {
+		tx := as.admins.Lock()
+		as.deleteAdminToken(tokenHash)
+		tx.Unlock()
+		return Admin{}, models.ErrNotFound
+	}
+	return as.GetAdmin(token.AdminID)
+}
+
+// AdminLogout invalidates an admin login token.
+func (as *AuthService) AdminLogout(rawToken string) {
+	tx := as.admins.Lock()
+	defer tx.Unlock()
+	as.deleteAdminToken(as.hashToken(rawToken))
+}
+
+// deleteAdminToken forgets a token. The caller holds the admins lock.
+func (as *AuthService) deleteAdminToken(tokenHash string) {
+	_ = as.adminTokens.Del(tokenHash)
+	if err := as.storage.DeleteAdminToken(tokenHash); err != nil {
+		slog.Error("failed to delete admin token from storage", "error", err)
+	}
+}
+
+// RecordAdminAction appends an entry to the admin audit log.
+func (as *AuthService) RecordAdminAction(entry models.AdminAuditEntry) {
+	if entry.Time == 0 {
+		entry.Time = as.now().Unix()
+	}
+	if err := as.storage.AddAdminAuditEntry(entry); err != nil {
+		slog.Error("failed to record admin action", "admin_id", entry.AdminID, "action", entry.Action, "error", err)
+	}
+}
+
+// AdminAudit returns up to limit audit log entries, newest first, optionally
+// only those of one admin.
+func (as *AuthService) AdminAudit(adminID string, limit int) ([]models.AdminAuditEntry, error) {
+	return as.storage.ListAdminAuditEntries(adminID, limit)
+}
+
+type adminWebAuthnUser struct {
+	authService *AuthService
+	admin       *Admin
+}
+
+func (w *adminWebAuthnUser) WebAuthnID() []byte          { return []byte(w.admin.ID) }
+func (w *adminWebAuthnUser) WebAuthnName() string        { return w.admin.UserName }
+func (w *adminWebAuthnUser) WebAuthnDisplayName() string { return w.admin.UserName }
+func (w *adminWebAuthnUser) WebAuthnCredentials() []webauthn.Credential {
+	return w.authService.webAuthnCredentials(w.admin.ID)
+}
+
+func (as *AuthService) getAdminWebAuthnUser(adminID string) (*adminWebAuthnUser, error) {
+	admin, err := as.GetAdmin(adminID)
+	if err != nil {
+		return nil, err
+	}
+	return &adminWebAuthnUser{authService: as, admin: &admin}, nil
+}
+
+// BeginAdminPasskeyRegistration starts adding a passkey to an admin account.
+func (as *AuthService) BeginAdminPasskeyRegistration(adminID string) (*protocol.CredentialCreation, *webauthn.SessionData, error) {
+	u, err := as.getAdminWebAuthnUser(adminID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return as.webAuthn.BeginRegistration(u, webauthn.WithResidentKeyRequirement(protocol.ResidentKeyRequirementRequired))
+}
+
+// FinishAdminPasskeyRegistration stores the passkey of an admin.
+func (as *AuthService) FinishAdminPasskeyRegistration(adminID, name string, sessionData *webauthn.SessionData, r *http.Request) error {
+	u, err := as.getAdminWebAuthnUser(adminID)
+	if err != nil {
+		return err
+	}
+	cred, err := as.webAuthn.FinishRegistration(u, *sessionData, r)
+	if err != nil {
+		return err
+	}
+	return as.storage.UpsertPasskey(newPasskey(adminID, name, cred))
+}
+
+// FinishAdminPasskeyLogin signs an admin in with a passkey, started with
+// BeginPasskeyLogin. Passkeys of chat users are rejected.
+func (as *AuthService) FinishAdminPasskeyLogin(sessionData *webauthn.SessionData, r *http.Request) (string, AdminToken, error) {
+	var adminID string
+	handler := func(rawID, userHandle []byte) (webauthn.User, error) {
+		adminID = string(userHandle)
+		if !strings.HasPrefix(adminID, adminIDPrefix) {
+			return nil, ErrAdminLoginFailed
+		}
+		return as.getAdminWebAuthnUser(adminID)
+	}
+
+	cred, err := as.webAuthn.FinishDiscoverableLogin(handler, *sessionData, r)
+	if err != nil {
+		return "", AdminToken{}, fmt.Errorf("%w: %v", ErrAdminLoginFailed, err)
+	}
+	as.updatePasskeyAfterLogin(adminID, cred)
+
+	tx := as.admins.Lock()
+	defer tx.Unlock()
+	if _, err := tx.Get(adminID); err != nil {
+		return "", AdminToken{}, ErrAdminLoginFailed // deleted meanwhile
+	}
+	return as.startAdminSession(adminID, ClientInfoFromRequest(r))
+}
@@ -0,0 +1,125 @@
+package auth
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"besedka/internal/models"
+)
+
+func TestAdminAccounts(t *testing.T) {
+	as := newTestAuthService(t)
+	now := time.Unix(1_700_000_000, 0)
+	as.now = func() time.Time { return now }
+	st := as.storage.(*MockStorage)
+
+	if as.HasAdmins() {
+		t.Fatal("expected no admins in a new service")
+	}
+	bootstrapToken := as.BootstrapToken()
+	if bootstrapToken == "" {
+		t.Fatal("expected a bootstrap token while there are no admins")
+	}
+	for _, token := range []string{"", "wrong"} {
+		if _, _, _, err := as.BootstrapAdmin(token, "root", "correct-horse-battery", ClientInfo{}); !errors.Is(err, ErrBootstrapToken) {
+			t.Errorf("expected ErrBootstrapToken for token %q, got %v", token, err)
+		}
+	}
+	if _, _, _, err := as.BootstrapAdmin(bootstrapToken, "root", "short", ClientInfo{}); !errors.Is(err, ErrInvalidAdmin) {
+		t.Errorf("expected ErrInvalidAdmin for a short password, got %v", err)
+	}
+	root, rawToken, _, err := as.BootstrapAdmin(bootstrapToken, "root", "correct-horse-battery", ClientInfo{IP: "127.0.0.1"})
+	if err != nil {
+		t.Fatalf("BootstrapAdmin failed: %v", err)
+	}
+	if as.BootstrapToken() != "" {
+		t.Error("expected the bootstrap token to be used up")
+	}
+	if _, _, _, err := as.BootstrapAdmin(bootstrapToken, "other", "correct-horse-battery", ClientInfo{}); !errors.Is(err, ErrAdminsExist) {
+		t.Errorf("expected ErrAdminsExist on a second bootstrap, got %v", err)
+	}
+	if stored := st.admins[root.ID]; stored.PasswordHash == "" || stored.PasswordHash == "correct-horse-battery" {
+		t.Errorf("expected a hashed password to be persisted, got %q", stored.PasswordHash)
+	}
+	if admin, err := as.GetAdminByToken(rawToken); err != nil || admin.ID != root.ID {
+		t.Fatalf("expected the bootstrap token to authenticate root, got %+v %v", admin, err)
+	}
+
+	second, err := as.AddAdmin("second", "another-long-password", root.ID)
+	if err != nil {
+		t.Fatalf("AddAdmin failed: %v", err)
+	}
+	if _, err := as.AddAdmin("second", "another-long-password", root.ID); !errors.Is(err, ErrAdminExists) {
+		t.Errorf("expected ErrAdminExists for a taken username, got %v", err)
+	}
+	if admins := as.ListAdmins(); len(admins) != 2 || admins[0].ID != root.ID {
+		t.Errorf("expected root and second, oldest first, got %+v", admins)
+	}
+
+	login := func(password string, totpAt time.Time) (string, error) {
+		code, err := GenerateTOTP(second.TOTPSecret, totpAt)
+		if err != nil {
+			t.Fatalf("GenerateTOTP failed: %v", err)
+		}
+		token, _, err := as.AdminLogin(AdminLoginRequest{Username: "second", Password: password, TOTP: code})
+		return token, err
+	}
+	secondToken, err := login("another-long-password", now)
+	if err != nil {
+		t.Fatalf("AdminLogin failed: %v", err)
+	}
+	if _, err := login("another-long-password", now); !errors.Is(err, ErrAdminLoginFailed) {
+		t.Errorf("expected a replayed TOTP code to be rejected, got %v", err)
+	}
+	for range 4 {
+		_, _ = login("wrong-password-123", now.Add(time.Minute))
+	}
+	if _, err := login("another-long-password", now.Add(time.Minute)); !errors.Is(err, ErrTooManyAttempts) {
+		t.Errorf("expected logins to be throttled after failed attempts, got %v", err)
+	}
+
+	as.AdminLogout(rawToken)
+	if _, err := as.GetAdminByToken(rawToken); !errors.Is(err, models.ErrNotFound) {
+		t.Errorf("expected a logged out token to be rejected, got %v", err)
+	}
+	now = now.Add(as.AdminTokenExpiry + time.Second)
+	if _, err := as.GetAdminByToken(secondToken); !errors.Is(err, models.ErrNotFound) {
+		t.Errorf("expected an expired token to be rejected, got %v", err)
+	}
+	if len(st.adminTkns) != 0 {
+		t.Errorf("expected expired and logged out tokens to be deleted, got %d", len(st.adminTkns))
+	}
+
+	if err := as.DeleteAdmin(second.ID); err != nil {
+		t.Fatalf("DeleteAdmin failed: %v", err)
+	}
+	if err := as.DeleteAdmin(root.ID); !errors.Is(err, ErrLastAdmin) {
+		t.Errorf("expected ErrLastAdmin when deleting the last admin, got %v", err)
+	}
+	if err := as.DeleteAdmin(second.ID); !errors.Is(err, models.ErrNotFound) {
+		t.Errorf("expected ErrNotFound for a deleted admin, got %v", err)
+	}
+}
+
+func TestAdminAudit(t *testing.T) {
+	as := newTestAuthService(t)
+	now := time.Unix(1_700_000_000, 0)
+	as.now = func() time.Time { return now }
+
+	as.RecordAdminAction(models.AdminAuditEntry{AdminID: "admin_a", Action: "POST /api/users", Status: 200})
+	as.RecordAdminAction(models.AdminAuditEntry{AdminID: "admin_b", Action: "DELETE /api/users?id=u1", Status: 200})
+	as.RecordAdminAction(models.AdminAuditEntry{AdminID: "admin_a", Action: "GET /api/export?chat=townhall", Status: 200})
+
+	entries, err := as.AdminAudit("", 2)
+	if err != nil || len(entries) != 2 || entries[0].Action != "GET /api/export?chat=townhall" {
+		t.Fatalf("expected the 2 newest entries, got %+v %v", entries, err)
+	}
+	if entries[0].Time != now.Unix() {
+		t.Errorf("expected the entry time to be set, got %d", entries[0].Time)
+	}
+	entries, _ = as.AdminAudit("admin_a", 0)
+	if len(entries) != 2 || entries[1].Action != "POST /api/users" {
+		t.Errorf("expected the entries of admin_a, got %+v", entries)
+	}
+}
@@ -0,0 +1,210 @@
+package auth
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"besedka/internal/content"
+	"besedka/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// defaultAPIKeyName names the key a bot or webhook is created with.
+const defaultAPIKeyName = "default"
+
+// maxAPIKeyNameLength limits API key names, in runes.
+const maxAPIKeyNameLength = 64
+
+var (
+	ErrNoAPIKeys     = errors.New("only bots and webhooks have API keys")
+	ErrInvalidAPIKey = errors.New("invalid api key")
+)
+
+// apiKeyPrefix returns the prefix of raw API keys for a user type.
+func apiKeyPrefix(userType models.UserType) string {
+	if userType == models.UserTypeWebhook {
+		return "bsk_wh_"
+	}
+	return "bsk_bot_"
+}
+
+// CreateAPIKey issues another API key for a bot or webhook, keeping its
+// existing keys valid so clients can be moved to the new one before the old
+// one is revoked. A zero expiresAt means the key never expires. The outgoing
+// webhook signing key of a bot is not changed; ResetAPIKey does that.
+func (as *AuthService) CreateAPIKey(userID, name string, expiresAt time.Time) (APIKey, string, error) {
+	name = strings.TrimSpace(content.Sanitize(name))
+	if name == "" || utf8.RuneCountInString(name) > maxAPIKeyNameLength {
+		return APIKey{}, "", fmt.Errorf("%w: name must be 1 to %d characters", ErrInvalidAPIKey, maxAPIKeyNameLength)
+	}
+	var expires int64
+	if !expiresAt.IsZero() {
+		if !expiresAt.After(as.now()) {
+			return APIKey{}, "", fmt.Errorf("%w: expiry is in the past", ErrInvalidAPIKey)
+		}
+		expires = expiresAt.Unix()
+	}
+
+	tx := as.users.Lock()
+	defer tx.Unlock()
+
+	user, err := tx.Get(userID)
+	if err != nil || user.Status == models.UserStatusDeleted {
+		return APIKey{}, "", models.ErrNotFound
+	}
+	if user.Type != models.UserTypeBot && user.Type != models.UserTypeWebhook {
+		return APIKey{}, "", ErrNoAPIKeys
+	}
+
+	rawKey, keyHash, err := as.generateAPIKey(apiKeyPrefix(user.Type))
+	if err != nil {
+		return APIKey{}, "", err
+	}
+	key := as.newAPIKey(user, keyHash, name, expires)
+	if err := as.storeAPIKey(key); err != nil {
+		return APIKey{}, "", err
+	}
+	return key, rawKey, nil
+}
+
+// ListAPIKeys returns the API keys of a user, oldest first. Expired keys are
+// included until they are revoked.
+func (as *AuthService) ListAPIKeys(userID string) ([]APIKey, error) {
+	tx := as.users.RLock()
+	user, err := tx.Get(userID)
+	tx.Unlock()
+	if err != nil || user.Status == models.UserStatusDeleted {
+		return nil, models.ErrNotFound
+	}
+
+	userAPIKeysTx := as.userAPIKeys.RLock()
+	defer userAPIKeysTx.Unlock()
+	keyHashes, _ := userAPIKeysTx.Get(userID)
+
+	keys := make([]APIKey, 0, len(keyHashes))
+	for _, keyHash := range keyHashes {
+		if key, err := as.liveAPIKeys.Get(keyHash); err == nil {
+			keys = append(keys, key)
+		}
+	}
+	slices.SortStableFunc(keys, func(a, b APIKey) int {
+		return cmp.Compare(a.CreatedAt, b.CreatedAt)
+	})
+	return keys, nil
+}
+
+// RevokeAPIKey deletes one API key of a user by its ID.
+func (as *AuthService) RevokeAPIKey(userID, keyID string) error {
+	userAPIKeysTx := as.userAPIKeys.Lock()
+	defer userAPIKeysTx.Unlock()
+
+	keyHashes, _ := userAPIKeysTx.Get(userID)
+	for i, keyHash := range keyHashes {
+		key, err := as.liveAPIKeys.Get(keyHash)
+		if err != nil || key.ID != keyID {
+			continue
+		}
+		if err := as.storage.DeleteAPIKey(keyHash); err != nil {
+			return fmt.Errorf("failed to delete api key: %w", err)
+		}
+		_ = as.liveAPIKeys.Del(keyHash)
+		userAPIKeysTx.Set(userID, slices.Delete(slices.Clone(keyHashes), i, i+1))
+		return nil
+	}
+	return models.ErrNotFound
+}
+
+// newAPIKey describes a new key of user.
+func (as *AuthService) newAPIKey(user *UserCredentials, keyHash, name string, expiresAt int64) APIKey {
+	return APIKey{
+		ID:        uuid.NewString(),
+		UserID:    user.ID,
+		KeyHash:   keyHash,
+		Name:      name,
+		CreatedAt: as.now().Unix(),
+		ExpiresAt: expiresAt,
+	}
+}
+
+// storeAPIKey persists a new key and makes it usable.
+func (as *AuthService) storeAPIKey(key APIKey) error {
+	if err := as.storage.UpsertAPIKey(key); err != nil {
+		return fmt.Errorf("failed to persist api key: %w", err)
+	}
+
+	userAPIKeysTx := as.userAPIKeys.Lock()
+	defer userAPIKeysTx.Unlock()
+	as.liveAPIKeys.Set(key.KeyHash, key)
+	userKeys, _ := userAPIKeysTx.Get(key.UserID)
+	userAPIKeysTx.Set(key.UserID, append(slices.Clone(userKeys), key.KeyHash))
+	return nil
+}
+
+// recordAPIKeyUse remembers when and where from a key was last used. It is
+// written to storage at most once a minute per key unless the address changes.
+func (as *AuthService) recordAPIKeyUse(keyHash string, now time.Time, remoteAddr string) {
+	ip := remoteAddr
+	if host, _, err := net.SplitHostPort(remoteAddr); err == nil {
+		ip = host
+	}
+
+	userAPIKeysTx := as.userAPIKeys.Lock()
+	defer userAPIKeysTx.Unlock()
+
+	key, err := as.liveAPIKeys.Get(keyHash)
+	if err != nil {
+		return // revoked meanwhile
+	}
+	persist := key.LastUsedIP != ip || key.LastUsedAt/60 != now.Unix()/60
+	key.LastUsedAt = now.Unix()
+	key.LastUsedIP = ip
+	if persist {
+		if err := as.storage.UpsertAPIKey(key); err != nil {
+			slog.Error("failed to persist api key usage", "user_id", key.UserID, "key_id", key.ID, "error", err)
+		}
+	}
+	as.liveAPIKeys.Set(keyHash, key)
+}
+
+// rehashAPIKey looks up an API key hashed with the previous secret and moves
+// it to its hash under the current secret. It reports false if apiKey is not
+// such a key.
+func (as *AuthService) rehashAPIKey(apiKey string) (APIKey, bool) {
+	prevHash := as.previousHash(apiKey)
+	if prevHash == "" {
+		return APIKey{}, false
+	}
+
+	userAPIKeysTx := as.userAPIKeys.Lock()
+	defer userAPIKeysTx.Unlock()
+
+	key, err := as.liveAPIKeys.Get(prevHash)
+	if err != nil {
+		return APIKey{}, false
+	}
+	key.KeyHash = as.hashToken(apiKey)
+	if err := as.storage.UpsertAPIKey(key); err != nil {
+		slog.Error("failed to persist rehashed api key", "user_id", key.UserID, "key_id", key.ID, "error", err)
+		return APIKey{}, false
+	}
+	if err := as.storage.DeleteAPIKey(prevHash); err != nil {
+		slog.Error("failed to delete api key stored under the previous secret", "user_id", key.UserID, "key_id", key.ID, "error", err)
+	}
+	_ = as.liveAPIKeys.Del(prevHash)
+	as.liveAPIKeys.Set(key.KeyHash, key)
+	userKeys, _ := userAPIKeysTx.Get(key.UserID)
+	userKeys = slices.Clone(userKeys)
+	if i := slices.Index(userKeys, prevHash); i >= 0 {
+		userKeys[i] = key.KeyHash
+	}
+	userAPIKeysTx.Set(key.UserID, userKeys)
+	return key, true
+}
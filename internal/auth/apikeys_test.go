@@ -0,0 +1,118 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"besedka/internal/models"
+)
+
+func TestAPIKeyRotation(t *testing.T) {
+	as := newTestAuthService(t)
+	now := time.Unix(1_700_000_000, 0)
+	as.now = func() time.Time { return now }
+	st := as.storage.(*MockStorage)
+
+	bot, oldKey, err := as.AddBot("deploybot", "Deploy Bot", models.BotPermissions{Write: true})
+	if err != nil {
+		t.Fatalf("AddBot failed: %v", err)
+	}
+
+	key, newKey, err := as.CreateAPIKey(bot.ID, " ci ", now.Add(time.Hour))
+	if err != nil {
+		t.Fatalf("CreateAPIKey failed: %v", err)
+	}
+	if key.Name != "ci" || key.ExpiresAt != now.Add(time.Hour).Unix() || key.ID == "" {
+		t.Errorf("unexpected key %+v", key)
+	}
+	for _, raw := range []string{oldKey, newKey} {
+		if u, err := as.GetUserByAPIKey(raw, "192.0.2.7:4242"); err != nil || u.ID != bot.ID {
+			t.Errorf("expected both keys to work, got %v %v", u, err)
+		}
+	}
+
+	keys, err := as.ListAPIKeys(bot.ID)
+	if err != nil || len(keys) != 2 || keys[0].Name != defaultAPIKeyName || keys[1].ID != key.ID {
+		t.Fatalf("unexpected keys %+v (%v)", keys, err)
+	}
+	if keys[1].LastUsedAt != now.Unix() || keys[1].LastUsedIP != "192.0.2.7" {
+		t.Errorf("expected the last use to be recorded, got %+v", keys[1])
+	}
+	if stored := st.apiKeys[keys[1].KeyHash]; stored.LastUsedIP != "192.0.2.7" {
+		t.Errorf("expected the last use to be persisted, got %+v", stored)
+	}
+
+	// Uses within the same minute from the same address are not written.
+	now = now.Add(10 * time.Second)
+	if _, err := as.GetUserByAPIKey(newKey, "192.0.2.7:4243"); err != nil {
+		t.Fatalf("GetUserByAPIKey failed: %v", err)
+	}
+	if stored := st.apiKeys[keys[1].KeyHash]; stored.LastUsedAt != keys[1].LastUsedAt {
+		t.Errorf("expected the usage write to be throttled, got %+v", stored)
+	}
+
+	now = now.Add(time.Hour)
+	if _, err := as.GetUserByAPIKey(newKey, ""); !errors.Is(err, models.ErrNotFound) {
+		t.Errorf("expected the expired key to fail, got %v", err)
+	}
+	if keys, _ := as.ListAPIKeys(bot.ID); len(keys) != 2 || !keys[1].Expired(now) {
+		t.Errorf("expected the expired key to be listed, got %+v", keys)
+	}
+
+	if err := as.RevokeAPIKey(bot.ID, keys[0].ID); err != nil {
+		t.Fatalf("RevokeAPIKey failed: %v", err)
+	}
+	if _, err := as.GetUserByAPIKey(oldKey, ""); err == nil {
+		t.Error("expected the revoked key to fail")
+	}
+	if _, ok := st.apiKeys[keys[0].KeyHash]; ok {
+		t.Error("expected the revoked key to be deleted from storage")
+	}
+	if err := as.RevokeAPIKey(bot.ID, keys[0].ID); !errors.Is(err, models.ErrNotFound) {
+		t.Errorf("expected ErrNotFound revoking twice, got %v", err)
+	}
+
+	if _, _, err := as.CreateAPIKey(bot.ID, "", time.Time{}); !errors.Is(err, ErrInvalidAPIKey) {
+		t.Errorf("expected ErrInvalidAPIKey for an empty name, got %v", err)
+	}
+	if _, _, err := as.CreateAPIKey(bot.ID, "late", now.Add(-time.Second)); !errors.Is(err, ErrInvalidAPIKey) {
+		t.Errorf("expected ErrInvalidAPIKey for a past expiry, got %v", err)
+	}
+	if _, err := as.AddUser("alice", "Alice"); err != nil {
+		t.Fatalf("AddUser failed: %v", err)
+	}
+	alice, _ := as.GetUserByUsername("alice")
+	if _, _, err := as.CreateAPIKey(alice.ID, "mine", time.Time{}); !errors.Is(err, ErrNoAPIKeys) {
+		t.Errorf("expected ErrNoAPIKeys for a human, got %v", err)
+	}
+}
+
+func TestLegacyAPIKeyMigration(t *testing.T) {
+	as := newTestAuthService(t)
+	bot, rawKey, err := as.AddBot("oldbot", "Old Bot", models.BotPermissions{Write: true})
+	if err != nil {
+		t.Fatalf("AddBot failed: %v", err)
+	}
+
+	st := as.storage.(*MockStorage)
+	for hash, key := range st.apiKeys {
+		st.apiKeys[hash] = APIKey{UserID: key.UserID, KeyHash: key.KeyHash}
+	}
+	reloaded, err := NewAuthService(context.Background(), as.Config, st)
+	if err != nil {
+		t.Fatalf("NewAuthService failed: %v", err)
+	}
+
+	keys, err := reloaded.ListAPIKeys(bot.ID)
+	if err != nil || len(keys) != 1 || keys[0].ID == "" || keys[0].Name != defaultAPIKeyName {
+		t.Fatalf("expected the legacy key to get an ID, got %+v (%v)", keys, err)
+	}
+	if st.apiKeys[keys[0].KeyHash].ID != keys[0].ID {
+		t.Error("expected the key ID to be persisted")
+	}
+	if _, err := reloaded.GetUserByAPIKey(rawKey, ""); err != nil {
+		t.Errorf("expected the legacy key to keep working, got %v", err)
+	}
+}
@@ -41,19 +41,19 @@ type storage interface {
 	UpsertCredentials(credentials UserCredentials) error
 	ListCredentials() ([]UserCredentials, error)
 	ListAllCredentials() ([]UserCredentials, error)
-	// UpsertToken saves a token for a user. The token should be hashed.
-	UpsertToken(userID string, tokenHash string) error
+	// UpsertSession saves a login session. Its token is stored hashed.
+	UpsertSession(session Session) error
 	// DeleteToken deletes a specific token (by hash).
 	DeleteToken(tokenHash string) error
-	// ListTokens returns all tokens (hashed) and their associated user IDs.
-	ListTokens() (map[string]string, error)
+	// ListSessions returns all login sessions.
+	ListSessions() ([]Session, error)
 	UpsertRegistrationToken(userID string, token string) error
 	DeleteRegistrationToken(userID string) error
 	ListRegistrationTokens() (map[string]string, error)
 
-	UpsertAPIKey(userID string, keyHash string) error
+	UpsertAPIKey(key APIKey) error
 	DeleteAPIKey(keyHash string) error
-	ListAPIKeys() (map[string]string, error)
+	ListAPIKeys() ([]APIKey, error)
 
 	UpsertPasskey(cred Passkey) error
 	ListPasskeys(userID string) ([]Passkey, error)
@@ -62,6 +62,15 @@ type storage interface {
 
 	UpsertUserSettings(userID string, settings models.UserSettings) error
 	GetUserSettings(userID string) (models.UserSettings, bool, error)
+
+	UpsertAdmin(admin Admin) error
+	DeleteAdmin(adminID string) error
+	ListAdmins() ([]Admin, error)
+	UpsertAdminToken(token AdminToken) error
+	DeleteAdminToken(tokenHash string) error
+	ListAdminTokens() ([]AdminToken, error)
+	AddAdminAuditEntry(entry models.AdminAuditEntry) error
+	ListAdminAuditEntries(adminID string, limit int) ([]models.AdminAuditEntry, error)
 }
 
 type Passkey struct {
@@ -78,25 +87,46 @@ type Passkey struct {
 	BackupState     bool
 }
 
+// APIKey is a stored API key. Keys of a scoped bot share its chat scopes.
+type APIKey struct {
+	ID         string
+	UserID     string
+	KeyHash    string
+	Name       string
+	CreatedAt  int64 // Unix timestamp (seconds)
+	ExpiresAt  int64 // Unix timestamp (seconds), 0 if the key never expires
+	LastUsedAt int64 // Unix timestamp (seconds)
+	LastUsedIP string
+}
+
+// Expired reports whether the key can no longer be used at now.
+func (k APIKey) Expired(now time.Time) bool {
+	return k.ExpiresAt != 0 && now.Unix() >= k.ExpiresAt
+}
+
 type LoginRequest struct {
-	Username string `json:"username"`
-	Password string `json:"password"`
-	TOTP     int    `json:"totp"`
+	Username     string     `json:"username"`
+	Password     string     `json:"password"`
+	TOTP         int        `json:"totp"`
+	RecoveryCode string     `json:"recoveryCode,omitempty"` // Checked instead of TOTP if set
+	Client       ClientInfo `json:"-"`
 }
 
 type RegistrationRequest struct {
-	Token       string `json:"token"`
-	DisplayName string `json:"displayName"`
-	Password    string `json:"password"`
-	TOTP        int    `json:"totp"`
+	Token       string     `json:"token"`
+	DisplayName string     `json:"displayName"`
+	Password    string     `json:"password"`
+	TOTP        int        `json:"totp"`
+	Client      ClientInfo `json:"-"`
 }
 
 type RegistrationResponse struct {
-	Success    bool   `json:"success"`
-	Token      string `json:"token,omitempty"`
-	Message    string `json:"message,omitempty"`
-	UserID     string `json:"userId,omitempty"`
-	TOTPSecret string `json:"totpSecret,omitempty"`
+	Success       bool     `json:"success"`
+	Token         string   `json:"token,omitempty"`
+	Message       string   `json:"message,omitempty"`
+	UserID        string   `json:"userId,omitempty"`
+	TOTPSecret    string   `json:"totpSecret,omitempty"`
+	RecoveryCodes []string `json:"recoveryCodes,omitempty"` // Shown once, right after registration
 }
 
 type RegistrationInfoResponse struct {
@@ -121,9 +151,17 @@ type UserCredentials struct {
 	TOTPSecret   string `json:"totpSecret"`
 	// Remember last TOTP to prevent replay attacks
 	LastTOTP int `json:"lastTOTP"`
+	// Hashes of unused one-time recovery codes, accepted instead of a TOTP.
+	RecoveryCodes []string `json:"-"`
+	// PasskeyOnly accounts registered with a passkey and have no password.
+	PasskeyOnly bool `json:"passkeyOnly"`
 	// Counter for consecutive failed login attempts to throttle brute force attacks.
 	FailedLoginAttempts int64 `json:"failedLoginAttempts"`
 	LastAttemptTime     int64 `json:"lastAttemptTime"`
+	// Outgoing webhook settings for bots. WebhookSecret is derived from the
+	// bot's API key when the key is issued; see WebhookSigningKey.
+	CallbackURL   string `json:"callbackUrl,omitempty"`
+	WebhookSecret []byte `json:"-"`
 }
 
 func (uc *UserCredentials) ResetFailedLoginAttempts(now time.Time) {
@@ -136,6 +174,16 @@ func (uc *UserCredentials) IncrementFailedLoginAttempts(now time.Time) {
 	uc.LastAttemptTime = now.Unix()
 }
 
+// RetryAfter returns how many seconds the user must wait before the password
+// can be tried again after repeated failures, or 0.
+func (uc *UserCredentials) RetryAfter(now time.Time) int64 {
+	if uc.FailedLoginAttempts <= 3 {
+		return 0
+	}
+	next := uc.LastAttemptTime + 30*(uc.FailedLoginAttempts*uc.FailedLoginAttempts)
+	return max(next-now.Unix(), 0)
+}
+
 type Config struct {
 	Secret                  string        `json:"secret"`
 	secretBytes             []byte        `json:"-"`
@@ -144,10 +192,22 @@ type Config struct {
 	RPDisplayName           string        `json:"rpDisplayName"`
 	RPID                    string        `json:"rpID"`
 	RPOrigin                string        `json:"rpOrigin"`
+	// AdminOrigin is the origin of the admin UI, accepted for admin passkeys.
+	AdminOrigin      string        `json:"adminOrigin"`
+	AdminTokenExpiry time.Duration `json:"adminTokenExpiry"`
+	// AdminBootstrapToken is the one-time token needed to create the first
+	// admin. A random one is made if it is empty.
+	AdminBootstrapToken string `json:"adminBootstrapToken"`
+
+	// PreviousSecret is the secret in use before the database was re-keyed.
+	// Password, recovery code and API key hashes made with it keep working
+	// and are re-hashed with Secret when used.
+	PreviousSecret      string `json:"previousSecret"`
+	previousSecretBytes []byte `json:"-"`
 }
 
 type tokenSession struct {
-	UserID    string
+	Session
 	UpdatedAt time.Time
 }
 
@@ -164,10 +224,17 @@ type AuthService struct {
 	userTokens *geche.Locker[string, []string]
 	// Map of registration token to user ID
 	registrationTokens *geche.MapTTLCache[string, string]
-	// Map of keyHash to user ID
-	liveAPIKeys geche.Geche[string, string]
-	// Index of all API keys per user
+	// Map of keyHash to API key. Writes are done holding the userAPIKeys lock.
+	liveAPIKeys geche.Geche[string, APIKey]
+	// Index of all API key hashes per user
 	userAPIKeys *geche.Locker[string, []string]
+	// Map of admin ID to admin account
+	admins *geche.Locker[string, *Admin]
+	// Map of token hash to admin token. Writes are done holding the admins lock.
+	adminTokens geche.Geche[string, AdminToken]
+	// One-time token for BootstrapAdmin, empty once an admin exists. Guarded
+	// by the admins lock.
+	bootstrapToken string
 	now         func() time.Time
 
 	webAuthn           *webauthn.WebAuthn
@@ -184,6 +251,12 @@ func (c *Config) Validate() error {
 	if err != nil {
 		return fmt.Errorf("auth secret is not a valid base64: %w", err)
 	}
+	if c.PreviousSecret != "" {
+		c.previousSecretBytes, err = base64.StdEncoding.DecodeString(c.PreviousSecret)
+		if err != nil {
+			return fmt.Errorf("previous auth secret is not a valid base64: %w", err)
+		}
+	}
 
 	if c.TokenExpiry == 0 {
 		c.TokenExpiry = DefaultTokenExpiry
@@ -191,6 +264,9 @@ func (c *Config) Validate() error {
 	if c.RegistrationTokenExpiry == 0 {
 		c.RegistrationTokenExpiry = DefaultRegistrationTokenExpiry
 	}
+	if c.AdminTokenExpiry == 0 {
+		c.AdminTokenExpiry = DefaultAdminTokenExpiry
+	}
 
 	return nil
 }
@@ -200,10 +276,14 @@ func NewAuthService(ctx context.Context, config Config, storage storage) (*AuthS
 		return nil, err
 	}
 
+	origins := []string{config.RPOrigin}
+	if config.AdminOrigin != "" && config.AdminOrigin != config.RPOrigin {
+		origins = append(origins, config.AdminOrigin)
+	}
 	wAuthn, err := webauthn.New(&webauthn.Config{
 		RPDisplayName: config.RPDisplayName,
 		RPID:          config.RPID,
-		RPOrigins:     []string{config.RPOrigin},
+		RPOrigins:     origins,
 	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to initialize webauthn: %w", err)
@@ -217,8 +297,10 @@ func NewAuthService(ctx context.Context, config Config, storage storage) (*AuthS
 		liveTokens:         geche.NewMapTTLCache[string, tokenSession](ctx, config.TokenExpiry, time.Minute),
 		userTokens:         geche.NewLocker(geche.NewMapCache[string, []string]()),
 		registrationTokens: geche.NewMapTTLCache[string, string](ctx, config.RegistrationTokenExpiry, time.Minute),
-		liveAPIKeys:        geche.NewMapCache[string, string](),
+		liveAPIKeys:        geche.NewMapCache[string, APIKey](),
 		userAPIKeys:        geche.NewLocker(geche.NewMapCache[string, []string]()),
+		admins:             geche.NewLocker(geche.NewMapCache[string, *Admin]()),
+		adminTokens:        geche.NewMapCache[string, AdminToken](),
 		now:                time.Now,
 		webAuthn:           wAuthn,
 		webAuthnSessions:   geche.NewMapTTLCache[string, *webauthn.SessionData](ctx, 5*time.Minute, time.Minute),
@@ -236,22 +318,33 @@ func NewAuthService(ctx context.Context, config Config, storage storage) (*AuthS
 	for _, c := range creds {
 		// Reset online status on storage load
 		c.Presence.Online = false
+		// Webhooks created before allow-lists may only post to their target.
+		if c.Type == models.UserTypeWebhook && len(c.WebhookChats) == 0 && c.TargetChatID != "" {
+			c.WebhookChats = []string{c.TargetChatID}
+		}
 		tx.Set(c.ID, &c)
 		as.usernames.Set(c.UserName, c.ID)
 	}
 
 	// Load tokens from storage
-	tokens, err := storage.ListTokens()
+	sessions, err := storage.ListSessions()
 	if err != nil {
 		return nil, fmt.Errorf("failed to list tokens: %w", err)
 	}
 	userTokensTx := as.userTokens.Lock()
 	defer userTokensTx.Unlock()
 
-	for tokenHash, userID := range tokens {
-		as.liveTokens.Set(tokenHash, tokenSession{UserID: userID, UpdatedAt: as.now()})
-		userTokens, _ := userTokensTx.Get(userID)
-		userTokensTx.Set(userID, append(userTokens, tokenHash))
+	for _, session := range sessions {
+		// Sessions started before they could be listed get an ID to revoke them by.
+		if session.ID == "" {
+			session.ID = uuid.NewString()
+			if err := storage.UpsertSession(session); err != nil {
+				return nil, fmt.Errorf("failed to migrate session: %w", err)
+			}
+		}
+		as.liveTokens.Set(session.TokenHash, tokenSession{Session: session, UpdatedAt: as.now()})
+		userTokens, _ := userTokensTx.Get(session.UserID)
+		userTokensTx.Set(session.UserID, append(userTokens, session.TokenHash))
 	}
 
 	as.liveTokens.OnEvict(func(tokenHash string, session tokenSession) {
@@ -289,28 +382,67 @@ func NewAuthService(ctx context.Context, config Config, storage storage) (*AuthS
 		return nil, fmt.Errorf("failed to list api keys: %w", err)
 	}
 	userAPIKeysTx := as.userAPIKeys.Lock()
-	for keyHash, userID := range apiKeys {
-		as.liveAPIKeys.Set(keyHash, userID)
-		userKeys, _ := userAPIKeysTx.Get(userID)
-		userAPIKeysTx.Set(userID, append(userKeys, keyHash))
+	for _, key := range apiKeys {
+		// Keys created before they could be listed get an ID to revoke them by.
+		if key.ID == "" {
+			key.ID = uuid.NewString()
+			key.Name = defaultAPIKeyName
+			if err := storage.UpsertAPIKey(key); err != nil {
+				userAPIKeysTx.Unlock()
+				return nil, fmt.Errorf("failed to migrate api key: %w", err)
+			}
+		}
+		as.liveAPIKeys.Set(key.KeyHash, key)
+		userKeys, _ := userAPIKeysTx.Get(key.UserID)
+		userAPIKeysTx.Set(key.UserID, append(userKeys, key.KeyHash))
 	}
 	userAPIKeysTx.Unlock()
 
+	if err := as.loadAdmins(); err != nil {
+		return nil, err
+	}
+
 	return as, nil
 }
 
 func (as *AuthService) hashPassword(username, password string) string {
-	h := hmac.New(sha512.New, as.secretBytes)
-	h.Write([]byte(username + password))
-	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+	return hmacHash(as.secretBytes, username+password)
 }
 
 func (as *AuthService) hashToken(token string) string {
-	h := hmac.New(sha512.New, as.secretBytes)
-	h.Write([]byte(token))
+	return hmacHash(as.secretBytes, token)
+}
+
+// previousHash hashes data the way hashPassword and hashToken did before the
+// secret was rotated. It returns "" if no previous secret is configured.
+func (as *AuthService) previousHash(data string) string {
+	if len(as.previousSecretBytes) == 0 {
+		return ""
+	}
+	return hmacHash(as.previousSecretBytes, data)
+}
+
+func hmacHash(secret []byte, data string) string {
+	h := hmac.New(sha512.New, secret)
+	h.Write([]byte(data))
 	return base64.StdEncoding.EncodeToString(h.Sum(nil))
 }
 
+// checkPassword reports whether password matches *hash. A hash made with the
+// previous secret is replaced with one made with the current secret; the
+// caller persists it along with the rest of the record.
+func (as *AuthService) checkPassword(hash *string, username, password string) bool {
+	currentHash := as.hashPassword(username, password)
+	if hmac.Equal([]byte(*hash), []byte(currentHash)) {
+		return true
+	}
+	if prev := as.previousHash(username + password); prev != "" && hmac.Equal([]byte(*hash), []byte(prev)) {
+		*hash = currentHash
+		return true
+	}
+	return false
+}
+
 func (as *AuthService) UpdateAvatarURL(userID string, avatarURL string) error {
 	tx := as.users.Lock()
 	defer tx.Unlock()
@@ -549,6 +681,8 @@ func (as *AuthService) ResetPassword(userID string, clearPasskeys bool) (string,
 	user.FailedLoginAttempts = 0
 	user.LastAttemptTime = 0
 	user.PasswordHash = ""
+	user.RecoveryCodes = nil
+	user.PasskeyOnly = false
 	user.Status = models.UserStatusCreated
 
 	// Set presence to offline
@@ -697,7 +831,8 @@ func (as *AuthService) GetAllUsers() ([]models.User, error) {
 
 func (as *AuthService) Login(req LoginRequest) (LoginResponse, string) {
 	now := as.now()
-	tx := as.users.RLock()
+	// Write lock, as a recovery code must only be accepted once.
+	tx := as.users.Lock()
 	defer tx.Unlock()
 
 	id, err := as.usernames.Get(req.Username)
@@ -724,37 +859,23 @@ func (as *AuthService) Login(req LoginRequest) (LoginResponse, string) {
 	}
 
 	// Check failed login attempts
-	if user.FailedLoginAttempts > 3 {
-		lastAttempt := user.LastAttemptTime
-		failedAttempts := user.FailedLoginAttempts
-		nextAttempt := lastAttempt + 30*(failedAttempts*failedAttempts)
-		if now.Unix() < nextAttempt {
-			return LoginResponse{
-				Success: false,
-				Message: fmt.Sprintf("Too many failed login attempts. Next attempt in %d seconds", nextAttempt-now.Unix()),
-			}, ""
-		}
-	}
-
-	// Use constant-time comparison for password hashes
-	currentHash := as.hashPassword(req.Username, req.Password)
-	if !hmac.Equal([]byte(user.PasswordHash), []byte(currentHash)) {
-		user.IncrementFailedLoginAttempts(now)
+	if wait := user.RetryAfter(now); wait > 0 {
 		return LoginResponse{
 			Success: false,
-			Message: loginFailedMessage,
+			Message: fmt.Sprintf("Too many failed login attempts. Next attempt in %d seconds", wait),
 		}, ""
 	}
 
-	if user.LastTOTP == -1 {
+	// Passkey-only accounts have no password to check.
+	if user.PasskeyOnly {
 		return LoginResponse{
 			Success: false,
-			Message: "User setup not completed",
+			Message: loginFailedMessage,
 		}, ""
 	}
 
-	// Do not allow to reuse TOTP (possible replay attack).
-	if user.LastTOTP == req.TOTP {
+	// Use constant-time comparison for password hashes
+	if !as.checkPassword(&user.PasswordHash, req.Username, req.Password) {
 		user.IncrementFailedLoginAttempts(now)
 		return LoginResponse{
 			Success: false,
@@ -762,15 +883,43 @@ func (as *AuthService) Login(req LoginRequest) (LoginResponse, string) {
 		}, ""
 	}
 
-	if !as.checkTOTP(user.TOTPSecret, req.TOTP, user.LastTOTP) {
-		user.IncrementFailedLoginAttempts(now)
+	if user.LastTOTP == -1 {
 		return LoginResponse{
 			Success: false,
-			Message: loginFailedMessage,
+			Message: "User setup not completed",
 		}, ""
 	}
 
-	token, err := as.generateToken()
+	if req.RecoveryCode != "" {
+		if !as.useRecoveryCode(user, req.RecoveryCode) {
+			user.IncrementFailedLoginAttempts(now)
+			return LoginResponse{
+				Success: false,
+				Message: loginFailedMessage,
+			}, ""
+		}
+	} else {
+		// Do not allow to reuse TOTP (possible replay attack).
+		if user.LastTOTP == req.TOTP {
+			user.IncrementFailedLoginAttempts(now)
+			return LoginResponse{
+				Success: false,
+				Message: loginFailedMessage,
+			}, ""
+		}
+
+		if !as.checkTOTP(user.TOTPSecret, req.TOTP, user.LastTOTP) {
+			user.IncrementFailedLoginAttempts(now)
+			return LoginResponse{
+				Success: false,
+				Message: loginFailedMessage,
+			}, ""
+		}
+		// Update LastTOTP to prevent replay attacks
+		user.LastTOTP = req.TOTP
+	}
+
+	token, err := as.startSession(user.ID, req.Client, now)
 	if err != nil {
 		slog.Error("login failed", "user_id", user.ID, "error", err)
 		return LoginResponse{
@@ -779,28 +928,12 @@ func (as *AuthService) Login(req LoginRequest) (LoginResponse, string) {
 		}, ""
 	}
 
-	tokenHash := as.hashToken(token)
-	as.liveTokens.Set(tokenHash, tokenSession{UserID: user.ID, UpdatedAt: now})
-
-	// Add to userTokens
-	userTokensTx := as.userTokens.Lock()
-	userTokens, _ := userTokensTx.Get(user.ID)
-	// Append new token hash
-	userTokensTx.Set(user.ID, append(userTokens, tokenHash))
-	userTokensTx.Unlock()
-
 	user.ResetFailedLoginAttempts(now)
-	// Update LastTOTP to prevent replay attacks
-	user.LastTOTP = req.TOTP
 
 	if err := as.storage.UpsertCredentials(*user); err != nil {
 		slog.Error("failed to persist user after login", "error", err)
 	}
 
-	if err := as.storage.UpsertToken(user.ID, tokenHash); err != nil {
-		slog.Error("failed to persist token after login", "error", err)
-	}
-
 	return LoginResponse{
 		Success:      true,
 		Token:        token,
@@ -951,10 +1084,20 @@ func (as *AuthService) CompleteRegistration(req RegistrationRequest) (Registrati
 		req.DisplayName = content.Sanitize(req.DisplayName)
 	}
 
+	recoveryCodes, recoveryHashes, err := as.generateRecoveryCodes(user.ID)
+	if err != nil {
+		slog.Error("failed to generate recovery codes", "error", err)
+		return RegistrationResponse{
+			Success: false,
+			Message: "Internal error",
+		}, ""
+	}
+
 	user.PasswordHash = as.hashPassword(user.UserName, req.Password)
 	if req.DisplayName != "" {
 		user.DisplayName = req.DisplayName
 	}
+	user.RecoveryCodes = recoveryHashes
 	user.LastTOTP = 0 // Activate user
 	user.Status = models.UserStatusActive
 
@@ -973,7 +1116,7 @@ func (as *AuthService) CompleteRegistration(req RegistrationRequest) (Registrati
 	_ = as.registrationTokens.Del(req.Token)
 
 	// Create session token
-	token, err := as.generateToken()
+	token, err := as.startSession(user.ID, req.Client, as.now())
 	if err != nil {
 		slog.Error("login failed", "user_id", user.ID, "error", err)
 		return RegistrationResponse{
@@ -982,24 +1125,12 @@ func (as *AuthService) CompleteRegistration(req RegistrationRequest) (Registrati
 		}, ""
 	}
 
-	tokenHash := as.hashToken(token)
-	as.liveTokens.Set(tokenHash, tokenSession{UserID: user.ID, UpdatedAt: as.now()})
-
-	// Add to userTokens
-	userTokensTx := as.userTokens.Lock()
-	userTokens, _ := userTokensTx.Get(user.ID)
-	userTokensTx.Set(user.ID, append(userTokens, tokenHash))
-	userTokensTx.Unlock()
-
-	if err := as.storage.UpsertToken(user.ID, tokenHash); err != nil {
-		slog.Error("failed to persist token after registration", "error", err)
-	}
-
 	return RegistrationResponse{
-		Success:    true,
-		Token:      token,
-		UserID:     user.ID,
-		TOTPSecret: user.TOTPSecret,
+		Success:       true,
+		Token:         token,
+		UserID:        user.ID,
+		TOTPSecret:    user.TOTPSecret,
+		RecoveryCodes: recoveryCodes,
 	}, token
 }
 
@@ -1071,7 +1202,8 @@ func (as *AuthService) GetUserID(token string) (string, time.Time, error) {
 	// token will be extended indefinitely without requiring user to relogin.
 	// To implement "half TTL is good", we refresh only if more than half of TTL has passed.
 	if now.Sub(session.UpdatedAt) > as.TokenExpiry/2 {
-		as.liveTokens.Set(tokenHash, tokenSession{UserID: session.UserID, UpdatedAt: now})
+		session.UpdatedAt = now
+		as.liveTokens.Set(tokenHash, session)
 		expiry = now.Add(as.TokenExpiry)
 	}
 
@@ -1094,7 +1226,8 @@ func (as *AuthService) RefreshToken(token string) (time.Time, error) {
 		return time.Time{}, err
 	}
 	now := as.now()
-	as.liveTokens.Set(tokenHash, tokenSession{UserID: session.UserID, UpdatedAt: now})
+	session.UpdatedAt = now
+	as.liveTokens.Set(tokenHash, session)
 	return now.Add(as.TokenExpiry), nil
 }
 
@@ -1108,22 +1241,31 @@ func (as *AuthService) generateAPIKey(prefix string) (string, string, error) {
 	return rawKey, keyHash, nil
 }
 
-func (as *AuthService) GetUserByAPIKey(apiKey string) (models.User, error) {
+// GetUserByAPIKey returns the user an unexpired API key belongs to and
+// records the use of the key from remoteAddr.
+func (as *AuthService) GetUserByAPIKey(apiKey, remoteAddr string) (models.User, error) {
 	keyHash := as.hashToken(apiKey)
-	userID, err := as.liveAPIKeys.Get(keyHash)
+	key, err := as.liveAPIKeys.Get(keyHash)
 	if err != nil {
-		return models.User{}, models.ErrNotFound
+		if rehashed, ok := as.rehashAPIKey(apiKey); ok {
+			keyHash, key, err = rehashed.KeyHash, rehashed, nil
+		}
 	}
-	tx := as.users.RLock()
-	defer tx.Unlock()
-	userCreds, err := tx.Get(userID)
-	if err != nil {
+	now := as.now()
+	if err != nil || key.Expired(now) {
 		return models.User{}, models.ErrNotFound
 	}
-	if userCreds.Status != models.UserStatusActive {
+	tx := as.users.RLock()
+	userCreds, err := tx.Get(key.UserID)
+	if err != nil || userCreds.Status != models.UserStatusActive {
+		tx.Unlock()
 		return models.User{}, models.ErrNotFound
 	}
-	return userCreds.User, nil
+	user := userCreds.User
+	tx.Unlock()
+
+	as.recordAPIKeyUse(keyHash, now, remoteAddr)
+	return user, nil
 }
 
 func (as *AuthService) AddBot(username, displayName string, perms models.BotPermissions) (models.User, string, error) {
@@ -1155,31 +1297,28 @@ func (as *AuthService) AddBot(username, displayName string, perms models.BotPerm
 		},
 	}
 
-	rawKey, keyHash, err := as.generateAPIKey("bsk_bot_")
+	rawKey, keyHash, err := as.generateAPIKey(apiKeyPrefix(models.UserTypeBot))
 	if err != nil {
 		return models.User{}, "", err
 	}
+	user.WebhookSecret = WebhookSigningKey(rawKey)
 
 	if err := as.storage.UpsertCredentials(*user); err != nil {
 		return models.User{}, "", fmt.Errorf("failed to persist bot user: %w", err)
 	}
-	if err := as.storage.UpsertAPIKey(userID, keyHash); err != nil {
-		return models.User{}, "", fmt.Errorf("failed to persist api key: %w", err)
+	if err := as.storeAPIKey(as.newAPIKey(user, keyHash, defaultAPIKeyName, 0)); err != nil {
+		return models.User{}, "", err
 	}
 
 	tx.Set(userID, user)
 	as.usernames.Set(username, userID)
-	as.liveAPIKeys.Set(keyHash, userID)
-
-	userAPIKeysTx := as.userAPIKeys.Lock()
-	userKeys, _ := userAPIKeysTx.Get(userID)
-	userAPIKeysTx.Set(userID, append(userKeys, keyHash))
-	userAPIKeysTx.Unlock()
 
 	return user.User, rawKey, nil
 }
 
-func (as *AuthService) AddWebhook(username, displayName, target string) (models.User, string, error) {
+// AddWebhook creates a webhook user that may post to the chats targets
+// resolve to, as by ResolveWebhookTarget; the first one is its default.
+func (as *AuthService) AddWebhook(username, displayName string, targets []string) (models.User, string, error) {
 	tx := as.users.Lock()
 	defer tx.Unlock()
 
@@ -1198,20 +1337,9 @@ func (as *AuthService) AddWebhook(username, displayName, target string) (models.
 
 	userID := uuid.NewString()
 
-	var targetChatID string
-	targetSpec := strings.TrimSpace(target)
-	if targetSpec == "" || targetSpec == "townhall" {
-		targetChatID = "townhall"
-	} else {
-		targetID, err := as.usernames.Get(targetSpec)
-		if err != nil {
-			return models.User{}, "", fmt.Errorf("target user %q not found", targetSpec)
-		}
-		targetUser, err := tx.Get(targetID)
-		if err != nil || targetUser.Status == models.UserStatusDeleted {
-			return models.User{}, "", fmt.Errorf("target user %q not found", targetSpec)
-		}
-		targetChatID = models.GetDMID(userID, targetUser.ID)
+	chats, err := as.resolveWebhookChats(tx, userID, targets)
+	if err != nil {
+		return models.User{}, "", err
 	}
 
 	user := &UserCredentials{
@@ -1221,11 +1349,12 @@ func (as *AuthService) AddWebhook(username, displayName, target string) (models.
 			DisplayName:  displayName,
 			Status:       models.UserStatusActive,
 			Type:         models.UserTypeWebhook,
-			TargetChatID: targetChatID,
+			TargetChatID: chats[0],
+			WebhookChats: chats,
 		},
 	}
 
-	rawKey, keyHash, err := as.generateAPIKey("bsk_wh_")
+	rawKey, keyHash, err := as.generateAPIKey(apiKeyPrefix(models.UserTypeWebhook))
 	if err != nil {
 		return models.User{}, "", err
 	}
@@ -1233,22 +1362,18 @@ func (as *AuthService) AddWebhook(username, displayName, target string) (models.
 	if err := as.storage.UpsertCredentials(*user); err != nil {
 		return models.User{}, "", fmt.Errorf("failed to persist webhook user: %w", err)
 	}
-	if err := as.storage.UpsertAPIKey(userID, keyHash); err != nil {
-		return models.User{}, "", fmt.Errorf("failed to persist api key: %w", err)
+	if err := as.storeAPIKey(as.newAPIKey(user, keyHash, defaultAPIKeyName, 0)); err != nil {
+		return models.User{}, "", err
 	}
 
 	tx.Set(userID, user)
 	as.usernames.Set(username, userID)
-	as.liveAPIKeys.Set(keyHash, userID)
-
-	userAPIKeysTx := as.userAPIKeys.Lock()
-	userKeys, _ := userAPIKeysTx.Get(userID)
-	userAPIKeysTx.Set(userID, append(userKeys, keyHash))
-	userAPIKeysTx.Unlock()
 
 	return user.User, rawKey, nil
 }
 
+// ResetAPIKey revokes all API keys of a bot or webhook and issues a new one.
+// For bots the outgoing webhook signing key is derived from the new key.
 func (as *AuthService) ResetAPIKey(userID string) (string, error) {
 	tx := as.users.Lock()
 	defer tx.Unlock()
@@ -1259,7 +1384,6 @@ func (as *AuthService) ResetAPIKey(userID string) (string, error) {
 	}
 
 	userAPIKeysTx := as.userAPIKeys.Lock()
-	defer userAPIKeysTx.Unlock()
 	userKeys, _ := userAPIKeysTx.Get(userID)
 	for _, keyHash := range userKeys {
 		_ = as.liveAPIKeys.Del(keyHash)
@@ -1268,23 +1392,23 @@ func (as *AuthService) ResetAPIKey(userID string) (string, error) {
 		}
 	}
 	userAPIKeysTx.Set(userID, nil)
+	userAPIKeysTx.Unlock()
 
-	prefix := "bsk_bot_"
-	if user.Type == models.UserTypeWebhook {
-		prefix = "bsk_wh_"
-	}
-
-	rawKey, keyHash, err := as.generateAPIKey(prefix)
+	rawKey, keyHash, err := as.generateAPIKey(apiKeyPrefix(user.Type))
 	if err != nil {
 		return "", err
 	}
 
-	if err := as.storage.UpsertAPIKey(userID, keyHash); err != nil {
-		return "", fmt.Errorf("failed to persist new api key: %w", err)
+	if user.Type == models.UserTypeBot {
+		user.WebhookSecret = WebhookSigningKey(rawKey)
+		if err := as.storage.UpsertCredentials(*user); err != nil {
+			return "", fmt.Errorf("failed to persist webhook signing key: %w", err)
+		}
 	}
 
-	as.liveAPIKeys.Set(keyHash, userID)
-	userAPIKeysTx.Set(userID, []string{keyHash})
+	if err := as.storeAPIKey(as.newAPIKey(user, keyHash, defaultAPIKeyName, 0)); err != nil {
+		return "", err
+	}
 
 	return rawKey, nil
 }
@@ -14,7 +14,7 @@ func newTestAuthService(t *testing.T) *AuthService {
 		creds:     make(map[string]UserCredentials),
 		tokens:    make(map[string]string),
 		regTokens: make(map[string]string),
-		apiKeys:   make(map[string]string),
+		apiKeys:   make(map[string]APIKey),
 	}
 
 	cfg := Config{
@@ -60,7 +60,7 @@ func TestAddBotAndAPIKeyAuth(t *testing.T) {
 	}
 
 	// Verify authentication using API key
-	foundUser, err := as.GetUserByAPIKey(apiKey)
+	foundUser, err := as.GetUserByAPIKey(apiKey, "")
 	if err != nil {
 		t.Fatalf("GetUserByAPIKey failed: %v", err)
 	}
@@ -78,12 +78,12 @@ func TestAddBotAndAPIKeyAuth(t *testing.T) {
 	}
 
 	// Old key should fail
-	if _, err := as.GetUserByAPIKey(apiKey); err == nil {
+	if _, err := as.GetUserByAPIKey(apiKey, ""); err == nil {
 		t.Errorf("expected old API key to fail authentication")
 	}
 
 	// New key should succeed
-	if foundUser, err = as.GetUserByAPIKey(newKey); err != nil || foundUser.ID != botUser.ID {
+	if foundUser, err = as.GetUserByAPIKey(newKey, ""); err != nil || foundUser.ID != botUser.ID {
 		t.Errorf("expected new API key authentication to succeed, got user %v, err %v", foundUser, err)
 	}
 }
@@ -92,7 +92,7 @@ func TestAddWebhook(t *testing.T) {
 	as := newTestAuthService(t)
 
 	// 1. Townhall target
-	webhookUser, apiKey, err := as.AddWebhook("mywebhook", "My Webhook", "townhall")
+	webhookUser, apiKey, err := as.AddWebhook("mywebhook", "My Webhook", []string{"townhall"})
 	if err != nil {
 		t.Fatalf("AddWebhook failed: %v", err)
 	}
@@ -104,7 +104,7 @@ func TestAddWebhook(t *testing.T) {
 		t.Errorf("expected target chat townhall, got %s", webhookUser.TargetChatID)
 	}
 
-	foundUser, err := as.GetUserByAPIKey(apiKey)
+	foundUser, err := as.GetUserByAPIKey(apiKey, "")
 	if err != nil {
 		t.Fatalf("GetUserByAPIKey failed: %v", err)
 	}
@@ -113,7 +113,7 @@ func TestAddWebhook(t *testing.T) {
 	}
 
 	// 2. Target nonexistent user should fail validation
-	if _, _, err := as.AddWebhook("invalidwh", "Invalid Webhook", "unknown_user"); err == nil {
+	if _, _, err := as.AddWebhook("invalidwh", "Invalid Webhook", []string{"unknown_user"}); err == nil {
 		t.Errorf("expected error for nonexistent target user")
 	}
 
@@ -127,7 +127,7 @@ func TestAddWebhook(t *testing.T) {
 	}
 	aliceID := aliceUser.ID
 
-	dmWebhook, _, err := as.AddWebhook("alicewebhook", "Alice Webhook", "alice")
+	dmWebhook, _, err := as.AddWebhook("alicewebhook", "Alice Webhook", []string{"alice"})
 	if err != nil {
 		t.Fatalf("AddWebhook for alice target failed: %v", err)
 	}
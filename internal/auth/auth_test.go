@@ -14,10 +14,14 @@ type MockStorage struct {
 	creds map[string]UserCredentials
 	// tokens maps TokenHash -> UserID
 	tokens    map[string]string
+	sessions  map[string]Session
 	regTokens map[string]string
-	apiKeys   map[string]string
+	apiKeys   map[string]APIKey
 	passkeys  []Passkey
 	settings  map[string]models.UserSettings
+	admins    map[string]Admin
+	adminTkns map[string]AdminToken
+	audit     []models.AdminAuditEntry
 }
 
 func (m *MockStorage) UpsertCredentials(c UserCredentials) error {
@@ -59,13 +63,18 @@ func (m *MockStorage) ListAllCredentials() ([]UserCredentials, error) {
 	return list, nil
 }
 
-func (m *MockStorage) UpsertToken(userID string, tokenHash string) error {
-	m.tokens[tokenHash] = userID
+func (m *MockStorage) UpsertSession(session Session) error {
+	m.tokens[session.TokenHash] = session.UserID
+	if m.sessions == nil {
+		m.sessions = make(map[string]Session)
+	}
+	m.sessions[session.TokenHash] = session
 	return nil
 }
 
 func (m *MockStorage) DeleteToken(tokenHash string) error {
 	delete(m.tokens, tokenHash)
+	delete(m.sessions, tokenHash)
 	return nil
 }
 
@@ -82,15 +91,23 @@ func (m *MockStorage) MigrateTokens(hasher func(string) string) error {
 	return nil
 }
 
-func (m *MockStorage) ListTokens() (map[string]string, error) {
-	return m.tokens, nil
+func (m *MockStorage) ListSessions() ([]Session, error) {
+	var sessions []Session
+	for tokenHash, userID := range m.tokens {
+		session, ok := m.sessions[tokenHash]
+		if !ok {
+			session = Session{UserID: userID, TokenHash: tokenHash}
+		}
+		sessions = append(sessions, session)
+	}
+	return sessions, nil
 }
 
-func (m *MockStorage) UpsertAPIKey(userID string, keyHash string) error {
+func (m *MockStorage) UpsertAPIKey(key APIKey) error {
 	if m.apiKeys == nil {
-		m.apiKeys = make(map[string]string)
+		m.apiKeys = make(map[string]APIKey)
 	}
-	m.apiKeys[keyHash] = userID
+	m.apiKeys[key.KeyHash] = key
 	return nil
 }
 
@@ -101,11 +118,12 @@ func (m *MockStorage) DeleteAPIKey(keyHash string) error {
 	return nil
 }
 
-func (m *MockStorage) ListAPIKeys() (map[string]string, error) {
-	if m.apiKeys == nil {
-		m.apiKeys = make(map[string]string)
+func (m *MockStorage) ListAPIKeys() ([]APIKey, error) {
+	var keys []APIKey
+	for _, key := range m.apiKeys {
+		keys = append(keys, key)
 	}
-	return m.apiKeys, nil
+	return keys, nil
 }
 
 func (m *MockStorage) UpsertRegistrationToken(userID string, token string) error {
@@ -171,6 +189,63 @@ func (m *MockStorage) DeleteAllPasskeys(userID string) error {
 	return nil
 }
 
+func (m *MockStorage) UpsertAdmin(admin Admin) error {
+	if m.admins == nil {
+		m.admins = make(map[string]Admin)
+	}
+	m.admins[admin.ID] = admin
+	return nil
+}
+
+func (m *MockStorage) DeleteAdmin(adminID string) error {
+	delete(m.admins, adminID)
+	return nil
+}
+
+func (m *MockStorage) ListAdmins() ([]Admin, error) {
+	var admins []Admin
+	for _, admin := range m.admins {
+		admins = append(admins, admin)
+	}
+	return admins, nil
+}
+
+func (m *MockStorage) UpsertAdminToken(token AdminToken) error {
+	if m.adminTkns == nil {
+		m.adminTkns = make(map[string]AdminToken)
+	}
+	m.adminTkns[token.TokenHash] = token
+	return nil
+}
+
+func (m *MockStorage) DeleteAdminToken(tokenHash string) error {
+	delete(m.adminTkns, tokenHash)
+	return nil
+}
+
+func (m *MockStorage) ListAdminTokens() ([]AdminToken, error) {
+	var tokens []AdminToken
+	for _, token := range m.adminTkns {
+		tokens = append(tokens, token)
+	}
+	return tokens, nil
+}
+
+func (m *MockStorage) AddAdminAuditEntry(entry models.AdminAuditEntry) error {
+	m.audit = append(m.audit, entry)
+	return nil
+}
+
+func (m *MockStorage) ListAdminAuditEntries(adminID string, limit int) ([]models.AdminAuditEntry, error) {
+	var entries []models.AdminAuditEntry
+	for i := len(m.audit) - 1; i >= 0 && (limit == 0 || len(entries) < limit); i-- {
+		if adminID == "" || m.audit[i].AdminID == adminID {
+			entries = append(entries, m.audit[i])
+		}
+	}
+	return entries, nil
+}
+
 func TestAuthService(t *testing.T) {
 	// Test Vectors generated using github.com/pquerna/otp
 	// RawSecret: 12345678901234567890
@@ -626,7 +701,7 @@ func TestAuthService(t *testing.T) {
 		tx.Unlock()
 
 		initial := *now
-		svc.liveTokens.Set(tokenHash, tokenSession{UserID: userID, UpdatedAt: initial})
+		svc.liveTokens.Set(tokenHash, tokenSession{Session: Session{UserID: userID}, UpdatedAt: initial})
 
 		*now = initial.Add(svc.TokenExpiry / 2)
 		gotUserID, expiry, err := svc.GetUserID(token)
@@ -692,7 +767,7 @@ func TestAuthService(t *testing.T) {
 		tx.Unlock()
 
 		initial := *now
-		svc.liveTokens.Set(tokenHash, tokenSession{UserID: userID, UpdatedAt: initial})
+		svc.liveTokens.Set(tokenHash, tokenSession{Session: Session{UserID: userID}, UpdatedAt: initial})
 
 		// Test GetTokenExpiry
 		expiryTime, err := svc.GetTokenExpiry(token)
@@ -999,14 +1074,14 @@ func TestAuthService(t *testing.T) {
 		token, _ := svc.generateToken()
 		tokenHash := svc.hashToken(token)
 		// We should Set the hash in liveTokens, because that's what Login does
-		svc.liveTokens.Set(tokenHash, tokenSession{UserID: userID, UpdatedAt: svc.now()})
+		svc.liveTokens.Set(tokenHash, tokenSession{Session: Session{UserID: userID}, UpdatedAt: svc.now()})
 
 		// Also populate userTokens so DeleteUser knows what to delete
 		userTokensTx := svc.userTokens.Lock()
 		userTokensTx.Set(userID, []string{tokenHash})
 		userTokensTx.Unlock()
 
-		if err := store.UpsertToken(userID, tokenHash); err != nil {
+		if err := store.UpsertSession(Session{UserID: userID, TokenHash: tokenHash}); err != nil {
 			t.Fatalf("Failed to upsert token: %v", err)
 		}
 
@@ -1105,13 +1180,13 @@ func TestAuthService(t *testing.T) {
 		// 2. Assign some tokens to the user
 		token1, _ := svc.generateToken()
 		tokenHash1 := svc.hashToken(token1)
-		svc.liveTokens.Set(tokenHash1, tokenSession{UserID: userID, UpdatedAt: svc.now()})
+		svc.liveTokens.Set(tokenHash1, tokenSession{Session: Session{UserID: userID}, UpdatedAt: svc.now()})
 
 		userTokensTx := svc.userTokens.Lock()
 		userTokensTx.Set(userID, []string{tokenHash1})
 		userTokensTx.Unlock()
 
-		if err := store.UpsertToken(userID, tokenHash1); err != nil {
+		if err := store.UpsertSession(Session{UserID: userID, TokenHash: tokenHash1}); err != nil {
 			t.Fatalf("Failed to upsert token: %v", err)
 		}
 
@@ -0,0 +1,71 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"net/url"
+
+	"besedka/internal/models"
+)
+
+var (
+	ErrNotBot             = errors.New("user is not a bot")
+	ErrNoSigningKey       = errors.New("bot has no webhook signing key; reset its API key first")
+	ErrInvalidCallbackURL = errors.New("callback URL must be an absolute http(s) URL")
+)
+
+// WebhookSigningKey derives the key used to sign outgoing webhook requests
+// from a bot's raw API key. Only the derived key is stored, so a bot can
+// compute it from its own key while the server never keeps the raw key.
+func WebhookSigningKey(rawKey string) []byte {
+	mac := hmac.New(sha256.New, []byte(rawKey))
+	mac.Write([]byte("besedka webhook signing"))
+	return mac.Sum(nil)
+}
+
+// SetBotCallbackURL sets the URL new messages are POSTed to for a bot.
+// An empty URL turns outgoing webhooks off.
+func (as *AuthService) SetBotCallbackURL(userID, callbackURL string) error {
+	if callbackURL != "" {
+		u, err := url.Parse(callbackURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return ErrInvalidCallbackURL
+		}
+	}
+
+	tx := as.users.Lock()
+	defer tx.Unlock()
+
+	user, err := tx.Get(userID)
+	if err != nil || user.Status == models.UserStatusDeleted {
+		return models.ErrNotFound
+	}
+	if user.Type != models.UserTypeBot {
+		return ErrNotBot
+	}
+	if callbackURL != "" && len(user.WebhookSecret) == 0 {
+		return ErrNoSigningKey
+	}
+
+	user.CallbackURL = callbackURL
+	if err := as.storage.UpsertCredentials(*user); err != nil {
+		return fmt.Errorf("failed to persist callback URL: %w", err)
+	}
+	tx.Set(user.ID, user)
+	return nil
+}
+
+// GetBotWebhook returns the callback URL and signing key of an active bot.
+// It returns models.ErrNotFound when the user is not a bot with a callback URL.
+func (as *AuthService) GetBotWebhook(userID string) (string, []byte, error) {
+	tx := as.users.RLock()
+	defer tx.Unlock()
+
+	user, err := tx.Get(userID)
+	if err != nil || user.Type != models.UserTypeBot || user.Status != models.UserStatusActive || user.CallbackURL == "" {
+		return "", nil, models.ErrNotFound
+	}
+	return user.CallbackURL, user.WebhookSecret, nil
+}
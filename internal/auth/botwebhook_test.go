@@ -0,0 +1,63 @@
+package auth
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"besedka/internal/models"
+)
+
+func TestBotCallbackURL(t *testing.T) {
+	as := newTestAuthService(t)
+
+	bot, apiKey, err := as.AddBot("hookbot", "Hook Bot", models.BotPermissions{ReadAll: true})
+	if err != nil {
+		t.Fatalf("AddBot failed: %v", err)
+	}
+
+	if _, _, err := as.GetBotWebhook(bot.ID); !errors.Is(err, models.ErrNotFound) {
+		t.Errorf("expected ErrNotFound without a callback URL, got %v", err)
+	}
+
+	for _, bad := range []string{"ftp://example.com/hook", "/relative", "http://"} {
+		if err := as.SetBotCallbackURL(bot.ID, bad); !errors.Is(err, ErrInvalidCallbackURL) {
+			t.Errorf("SetBotCallbackURL(%q): expected ErrInvalidCallbackURL, got %v", bad, err)
+		}
+	}
+
+	if err := as.SetBotCallbackURL(bot.ID, "https://bot.example.com/hook"); err != nil {
+		t.Fatalf("SetBotCallbackURL failed: %v", err)
+	}
+	callbackURL, key, err := as.GetBotWebhook(bot.ID)
+	if err != nil || callbackURL != "https://bot.example.com/hook" {
+		t.Fatalf("got %q %v, want the callback URL", callbackURL, err)
+	}
+	if !bytes.Equal(key, WebhookSigningKey(apiKey)) {
+		t.Error("signing key is not derived from the bot's API key")
+	}
+
+	// Resetting the API key rotates the signing key.
+	newKey, err := as.ResetAPIKey(bot.ID)
+	if err != nil {
+		t.Fatalf("ResetAPIKey failed: %v", err)
+	}
+	if _, key, _ = as.GetBotWebhook(bot.ID); !bytes.Equal(key, WebhookSigningKey(newKey)) {
+		t.Error("signing key was not rotated with the API key")
+	}
+
+	if err := as.SetBotCallbackURL(bot.ID, ""); err != nil {
+		t.Fatalf("clearing callback URL failed: %v", err)
+	}
+	if _, _, err := as.GetBotWebhook(bot.ID); !errors.Is(err, models.ErrNotFound) {
+		t.Errorf("expected ErrNotFound after clearing, got %v", err)
+	}
+
+	hook, _, err := as.AddWebhook("inhook", "Incoming", []string{"townhall"})
+	if err != nil {
+		t.Fatalf("AddWebhook failed: %v", err)
+	}
+	if err := as.SetBotCallbackURL(hook.ID, "https://example.com"); !errors.Is(err, ErrNotBot) {
+		t.Errorf("expected ErrNotBot for a webhook user, got %v", err)
+	}
+}
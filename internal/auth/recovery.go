@@ -0,0 +1,143 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"besedka/internal/models"
+)
+
+// recoveryCodeCount is how many recovery codes a user is given at a time.
+const recoveryCodeCount = 10
+
+var (
+	ErrNotHuman           = errors.New("user is not a human")
+	ErrPasskeyOnly        = errors.New("passkey-only accounts have no recovery codes")
+	ErrInvalidCredentials = errors.New("invalid password or code")
+)
+
+// RecoveryCodesRequest confirms who is asking for new recovery codes: the
+// current password and either a TOTP code or one of the current recovery
+// codes, as on login.
+type RecoveryCodesRequest struct {
+	Password     string `json:"password"`
+	TOTP         int    `json:"totp"`
+	RecoveryCode string `json:"recoveryCode"`
+}
+
+// recoveryCodeEncoding spells recovery codes in lowercase base32.
+var recoveryCodeEncoding = base32.NewEncoding("abcdefghijklmnopqrstuvwxyz234567").WithPadding(base32.NoPadding)
+
+// generateRecoveryCodes returns a new set of one-time recovery codes for a
+// user, formatted for display, together with the hashes to store.
+func (as *AuthService) generateRecoveryCodes(userID string) ([]string, []string, error) {
+	codes := make([]string, 0, recoveryCodeCount)
+	hashes := make([]string, 0, recoveryCodeCount)
+	for range recoveryCodeCount {
+		b := make([]byte, 5)
+		if _, err := rand.Read(b); err != nil {
+			return nil, nil, fmt.Errorf("failed to generate recovery code: %w", err)
+		}
+		code := recoveryCodeEncoding.EncodeToString(b)
+		codes = append(codes, code[:4]+"-"+code[4:])
+		hashes = append(hashes, as.hashRecoveryCode(userID, code))
+	}
+	return codes, hashes, nil
+}
+
+// hashRecoveryCode hashes a recovery code as typed by a user, ignoring case,
+// dashes and spaces.
+func (as *AuthService) hashRecoveryCode(userID, code string) string {
+	return as.hashToken(userID + ":" + normalizeRecoveryCode(code))
+}
+
+func normalizeRecoveryCode(code string) string {
+	return strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+}
+
+// useRecoveryCode removes code from the user's recovery codes and reports
+// whether it was one of them. The caller must hold the users lock.
+func (as *AuthService) useRecoveryCode(user *UserCredentials, code string) bool {
+	hash := as.hashRecoveryCode(user.ID, code)
+	// Codes generated before the secret was rotated are hashed with the
+	// previous secret.
+	prevHash := as.previousHash(user.ID + ":" + normalizeRecoveryCode(code))
+	i := slices.IndexFunc(user.RecoveryCodes, func(h string) bool {
+		return hmac.Equal([]byte(h), []byte(hash)) || (prevHash != "" && hmac.Equal([]byte(h), []byte(prevHash)))
+	})
+	if i < 0 {
+		return false
+	}
+	user.RecoveryCodes = slices.Delete(slices.Clone(user.RecoveryCodes), i, i+1)
+	return true
+}
+
+// RegenerateRecoveryCodes replaces a user's recovery codes with a new set
+// and returns it. Previous codes stop working. A session alone is not enough:
+// req must prove the user knows the password and has a second factor.
+// Failures count towards the login throttling.
+func (as *AuthService) RegenerateRecoveryCodes(userID string, req RecoveryCodesRequest) ([]string, error) {
+	now := as.now()
+	tx := as.users.Lock()
+	defer tx.Unlock()
+
+	user, err := tx.Get(userID)
+	if err != nil || user.Status != models.UserStatusActive {
+		return nil, models.ErrNotFound
+	}
+	if user.Type == models.UserTypeBot || user.Type == models.UserTypeWebhook {
+		return nil, ErrNotHuman
+	}
+	if user.PasskeyOnly {
+		return nil, ErrPasskeyOnly
+	}
+	if wait := user.RetryAfter(now); wait > 0 {
+		return nil, fmt.Errorf("%w: next attempt in %d seconds", ErrTooManyAttempts, wait)
+	}
+	if !as.checkPassword(&user.PasswordHash, user.UserName, req.Password) {
+		user.IncrementFailedLoginAttempts(now)
+		return nil, ErrInvalidCredentials
+	}
+	if req.RecoveryCode != "" {
+		if !as.useRecoveryCode(user, req.RecoveryCode) {
+			user.IncrementFailedLoginAttempts(now)
+			return nil, ErrInvalidCredentials
+		}
+	} else {
+		if !as.checkTOTP(user.TOTPSecret, req.TOTP, user.LastTOTP) {
+			user.IncrementFailedLoginAttempts(now)
+			return nil, ErrInvalidCredentials
+		}
+		user.LastTOTP = req.TOTP
+	}
+	user.ResetFailedLoginAttempts(now)
+
+	codes, hashes, err := as.generateRecoveryCodes(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	updated := *user
+	updated.RecoveryCodes = hashes
+	if err := as.storage.UpsertCredentials(updated); err != nil {
+		return nil, fmt.Errorf("failed to persist recovery codes: %w", err)
+	}
+	tx.Set(user.ID, &updated)
+	return codes, nil
+}
+
+// RecoveryCodesLeft returns how many unused recovery codes a user has.
+func (as *AuthService) RecoveryCodesLeft(userID string) int {
+	tx := as.users.RLock()
+	defer tx.Unlock()
+
+	user, err := tx.Get(userID)
+	if err != nil {
+		return 0
+	}
+	return len(user.RecoveryCodes)
+}
@@ -0,0 +1,114 @@
+package auth
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"besedka/internal/models"
+)
+
+func TestRecoveryCodes(t *testing.T) {
+	as := newTestAuthService(t)
+	now := time.Unix(1_700_000_000, 0)
+	as.now = func() time.Time { return now }
+	st := as.storage.(*MockStorage)
+
+	regToken, err := as.AddUser("alice", "Alice")
+	if err != nil {
+		t.Fatalf("AddUser failed: %v", err)
+	}
+	info, err := as.GetRegistrationInfo(regToken)
+	if err != nil {
+		t.Fatalf("GetRegistrationInfo failed: %v", err)
+	}
+	code, err := GenerateTOTP(info.TOTPSecret, now)
+	if err != nil {
+		t.Fatalf("GenerateTOTP failed: %v", err)
+	}
+	reg, _ := as.CompleteRegistration(RegistrationRequest{Token: regToken, Password: "secret", TOTP: code})
+	if !reg.Success || len(reg.RecoveryCodes) != recoveryCodeCount {
+		t.Fatalf("expected %d recovery codes, got %+v", recoveryCodeCount, reg)
+	}
+	if stored := st.creds[reg.UserID].RecoveryCodes; len(stored) != recoveryCodeCount || stored[0] == reg.RecoveryCodes[0] {
+		t.Errorf("expected hashed recovery codes to be persisted, got %v", stored)
+	}
+
+	login := func(recoveryCode string) bool {
+		resp, _ := as.Login(LoginRequest{Username: "alice", Password: "secret", RecoveryCode: recoveryCode})
+		return resp.Success
+	}
+	// Codes are accepted regardless of case, dashes and spaces.
+	typed := strings.ToUpper(strings.ReplaceAll(reg.RecoveryCodes[0], "-", " "))
+	if !login(typed) {
+		t.Fatal("expected login with a recovery code to succeed")
+	}
+	if login(reg.RecoveryCodes[0]) {
+		t.Error("expected a used recovery code to be rejected")
+	}
+	if left := as.RecoveryCodesLeft(reg.UserID); left != recoveryCodeCount-1 {
+		t.Errorf("expected %d codes left, got %d", recoveryCodeCount-1, left)
+	}
+	if len(st.creds[reg.UserID].RecoveryCodes) != recoveryCodeCount-1 {
+		t.Error("expected the used code to be removed from storage")
+	}
+
+	// Regenerating needs the password and a second factor.
+	for _, req := range []RecoveryCodesRequest{
+		{Password: "secret"},
+		{Password: "wrong", RecoveryCode: reg.RecoveryCodes[1]},
+	} {
+		if _, err := as.RegenerateRecoveryCodes(reg.UserID, req); !errors.Is(err, ErrInvalidCredentials) {
+			t.Errorf("RegenerateRecoveryCodes(%+v): expected ErrInvalidCredentials, got %v", req, err)
+		}
+	}
+	codes, err := as.RegenerateRecoveryCodes(reg.UserID, RecoveryCodesRequest{Password: "secret", RecoveryCode: reg.RecoveryCodes[1]})
+	if err != nil || len(codes) != recoveryCodeCount {
+		t.Fatalf("RegenerateRecoveryCodes failed: %v %v", codes, err)
+	}
+	if login(reg.RecoveryCodes[2]) {
+		t.Error("expected old recovery codes to stop working")
+	}
+	if !login(codes[0]) {
+		t.Error("expected a new recovery code to work")
+	}
+
+	now = now.Add(30 * time.Second)
+	code, err = GenerateTOTP(info.TOTPSecret, now)
+	if err != nil {
+		t.Fatalf("GenerateTOTP failed: %v", err)
+	}
+	if _, err := as.RegenerateRecoveryCodes(reg.UserID, RecoveryCodesRequest{Password: "secret", TOTP: code}); err != nil {
+		t.Fatalf("RegenerateRecoveryCodes with TOTP failed: %v", err)
+	}
+	if _, err := as.RegenerateRecoveryCodes(reg.UserID, RecoveryCodesRequest{Password: "secret", TOTP: code}); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("expected a reused TOTP code to be rejected, got %v", err)
+	}
+
+	// Failures are throttled like logins.
+	for range 4 {
+		_, _ = as.RegenerateRecoveryCodes(reg.UserID, RecoveryCodesRequest{Password: "wrong"})
+	}
+	if _, err := as.RegenerateRecoveryCodes(reg.UserID, RecoveryCodesRequest{Password: "secret", TOTP: code}); !errors.Is(err, ErrTooManyAttempts) {
+		t.Errorf("expected ErrTooManyAttempts, got %v", err)
+	}
+
+	if _, err := as.ResetPassword(reg.UserID, false); err != nil {
+		t.Fatalf("ResetPassword failed: %v", err)
+	}
+	if as.RecoveryCodesLeft(reg.UserID) != 0 {
+		t.Error("expected a password reset to drop recovery codes")
+	}
+	if _, err := as.RegenerateRecoveryCodes(reg.UserID, RecoveryCodesRequest{}); !errors.Is(err, models.ErrNotFound) {
+		t.Errorf("expected ErrNotFound before registration is completed, got %v", err)
+	}
+
+	bot, _, err := as.AddBot("helper", "Helper", models.BotPermissions{Write: true})
+	if err != nil {
+		t.Fatalf("AddBot failed: %v", err)
+	}
+	if _, err := as.RegenerateRecoveryCodes(bot.ID, RecoveryCodesRequest{}); !errors.Is(err, ErrNotHuman) {
+		t.Errorf("expected ErrNotHuman for a bot, got %v", err)
+	}
+}
@@ -0,0 +1,101 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"besedka/internal/models"
+
+	"github.com/c-pro/geche"
+)
+
+var (
+	ErrInvalidScope  = errors.New("invalid chat scope")
+	ErrBotNotScoped  = errors.New("bot is not restricted to scoped chats")
+	ErrDMScopeDenied = errors.New("direct messages can only be opted into by their members")
+)
+
+// ValidateScopes checks scopes an admin grants to a bot: each chat must be
+// listed once, and direct messages are left to their members.
+func ValidateScopes(scopes []models.ChatScope) error {
+	seen := make(map[string]bool, len(scopes))
+	for _, s := range scopes {
+		if s.ChatID == "" || seen[s.ChatID] {
+			return ErrInvalidScope
+		}
+		if strings.HasPrefix(s.ChatID, "dm_") {
+			return ErrDMScopeDenied
+		}
+		seen[s.ChatID] = true
+	}
+	return nil
+}
+
+// SetBotScopes restricts a bot to the given chats. Direct messages can't be
+// granted this way; scopes users opted into with SetDMBotAccess are kept.
+func (as *AuthService) SetBotScopes(userID string, scopes []models.ChatScope) error {
+	if err := ValidateScopes(scopes); err != nil {
+		return err
+	}
+
+	tx := as.users.Lock()
+	defer tx.Unlock()
+
+	user, err := tx.Get(userID)
+	if err != nil || user.Status == models.UserStatusDeleted {
+		return models.ErrNotFound
+	}
+	if user.Type != models.UserTypeBot {
+		return ErrNotBot
+	}
+
+	newScopes := slices.Clone(scopes)
+	for _, s := range user.Scopes {
+		if strings.HasPrefix(s.ChatID, "dm_") {
+			newScopes = append(newScopes, s)
+		}
+	}
+	return as.updateBotScopes(tx, user, newScopes)
+}
+
+// SetDMBotAccess lets a user grant or revoke a scoped bot's access to their
+// direct message chat with it.
+func (as *AuthService) SetDMBotAccess(userID, botID string, allow bool) error {
+	tx := as.users.Lock()
+	defer tx.Unlock()
+
+	bot, err := tx.Get(botID)
+	if err != nil || bot.Status != models.UserStatusActive || bot.Type != models.UserTypeBot {
+		return models.ErrNotFound
+	}
+	if !bot.Scoped {
+		return ErrBotNotScoped
+	}
+
+	chatID := models.GetDMID(userID, botID)
+	scopes := slices.DeleteFunc(slices.Clone(bot.Scopes), func(s models.ChatScope) bool {
+		return s.ChatID == chatID
+	})
+	if allow {
+		scopes = append(scopes, models.ChatScope{
+			ChatID:         chatID,
+			BotPermissions: models.BotPermissions{ReadAll: true, Write: true},
+		})
+	}
+	return as.updateBotScopes(tx, bot, scopes)
+}
+
+// updateBotScopes stores scopes on the bot user, so they apply to all of its
+// API keys. The caller must hold the users lock.
+func (as *AuthService) updateBotScopes(tx *geche.Tx[string, *UserCredentials], bot *UserCredentials, scopes []models.ChatScope) error {
+	updated := *bot
+	updated.Scoped = true
+	updated.Scopes = scopes
+	if err := as.storage.UpsertCredentials(updated); err != nil {
+		return fmt.Errorf("failed to persist bot scopes: %w", err)
+	}
+	tx.Set(bot.ID, &updated)
+	return nil
+}
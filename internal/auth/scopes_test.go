@@ -0,0 +1,87 @@
+package auth
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"besedka/internal/models"
+)
+
+func TestBotScopes(t *testing.T) {
+	as := newTestAuthService(t)
+	st := as.storage.(*MockStorage)
+
+	legacy, _, err := as.AddBot("legacybot", "Legacy Bot", models.BotPermissions{ReadAll: true})
+	if err != nil {
+		t.Fatalf("AddBot failed: %v", err)
+	}
+	bot, apiKey, err := as.AddBot("scopedbot", "Scoped Bot", models.BotPermissions{})
+	if err != nil {
+		t.Fatalf("AddBot failed: %v", err)
+	}
+
+	if err := as.SetDMBotAccess("alice", legacy.ID, true); !errors.Is(err, ErrBotNotScoped) {
+		t.Errorf("expected ErrBotNotScoped for an unscoped bot, got %v", err)
+	}
+	if err := as.SetBotScopes(bot.ID, []models.ChatScope{{ChatID: models.GetDMID("alice", bot.ID)}}); !errors.Is(err, ErrDMScopeDenied) {
+		t.Errorf("expected ErrDMScopeDenied, got %v", err)
+	}
+	if err := as.SetBotScopes(bot.ID, []models.ChatScope{{ChatID: "g1"}, {ChatID: "g1"}}); !errors.Is(err, ErrInvalidScope) {
+		t.Errorf("expected ErrInvalidScope for duplicate chats, got %v", err)
+	}
+
+	group := models.ChatScope{ChatID: "g1", BotPermissions: models.BotPermissions{ReadMentions: true}}
+	if err := as.SetBotScopes(bot.ID, []models.ChatScope{group}); err != nil {
+		t.Fatalf("SetBotScopes failed: %v", err)
+	}
+	if err := as.SetDMBotAccess("alice", bot.ID, true); err != nil {
+		t.Fatalf("SetDMBotAccess failed: %v", err)
+	}
+
+	dmID := models.GetDMID("alice", bot.ID)
+	u, err := as.GetUserByAPIKey(apiKey, "")
+	if err != nil {
+		t.Fatalf("GetUserByAPIKey failed: %v", err)
+	}
+	if !u.Scoped || !models.IsMessageVisible(dmID, nil, u) || models.IsMessageVisible("townhall", []string{"scopedbot"}, u) {
+		t.Errorf("unexpected scopes %+v", u.Scopes)
+	}
+
+	// Replacing the admin scopes keeps the DM the user opted into. Scopes
+	// belong to the bot, so they survive revoking its only API key and apply
+	// to keys created later.
+	if err := as.SetBotScopes(bot.ID, nil); err != nil {
+		t.Fatalf("SetBotScopes failed: %v", err)
+	}
+	keys, err := as.ListAPIKeys(bot.ID)
+	if err != nil || len(keys) != 1 {
+		t.Fatalf("ListAPIKeys = %+v, %v", keys, err)
+	}
+	if err := as.RevokeAPIKey(bot.ID, keys[0].ID); err != nil {
+		t.Fatalf("RevokeAPIKey failed: %v", err)
+	}
+	stored := st.creds[bot.ID]
+	if !stored.Scoped || len(stored.Scopes) != 1 || stored.Scopes[0].ChatID != dmID {
+		t.Fatalf("expected only the DM scope to be stored with the bot, got %+v", stored.Scopes)
+	}
+	_, apiKey, err = as.CreateAPIKey(bot.ID, "second", time.Time{})
+	if err != nil {
+		t.Fatalf("CreateAPIKey failed: %v", err)
+	}
+	u, err = as.GetUserByAPIKey(apiKey, "")
+	if err != nil {
+		t.Fatalf("GetUserByAPIKey failed: %v", err)
+	}
+	if !u.Scoped || !models.IsMessageVisible(dmID, nil, u) {
+		t.Errorf("expected the new key to inherit the bot scopes, got %+v", u.Scopes)
+	}
+
+	if err := as.SetDMBotAccess("alice", bot.ID, false); err != nil {
+		t.Fatalf("SetDMBotAccess failed: %v", err)
+	}
+	u, _ = as.GetUser(bot.ID)
+	if !u.Scoped || len(u.Scopes) != 0 || models.IsMessageVisible(dmID, nil, u) {
+		t.Errorf("expected revoked DM access, got %+v", u.Scopes)
+	}
+}
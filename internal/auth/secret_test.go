@@ -0,0 +1,75 @@
+package auth
+
+import (
+	"context"
+	"encoding/base64"
+	"testing"
+	"time"
+
+	"besedka/internal/models"
+)
+
+func TestPreviousSecret(t *testing.T) {
+	as := newTestAuthService(t)
+	now := time.Unix(1_700_000_000, 0)
+	as.now = func() time.Time { return now }
+	st := as.storage.(*MockStorage)
+
+	bot, apiKey, err := as.AddBot("rotbot", "Rotation Bot", models.BotPermissions{Write: true})
+	if err != nil {
+		t.Fatalf("AddBot failed: %v", err)
+	}
+	admin, _, _, err := as.BootstrapAdmin(as.BootstrapToken(), "root", "correct-horse-battery", ClientInfo{})
+	if err != nil {
+		t.Fatalf("BootstrapAdmin failed: %v", err)
+	}
+	codes, hashes, err := as.generateRecoveryCodes("user_1")
+	if err != nil {
+		t.Fatalf("generateRecoveryCodes failed: %v", err)
+	}
+	oldPasswordHash := st.admins[admin.ID].PasswordHash
+
+	// Restart with a rotated secret, keeping the old one as the previous secret.
+	cfg := as.Config
+	cfg.PreviousSecret = cfg.Secret
+	cfg.Secret = base64.StdEncoding.EncodeToString([]byte("a-brand-new-secret-after-rekey"))
+	rotated, err := NewAuthService(context.Background(), cfg, st)
+	if err != nil {
+		t.Fatalf("failed to create auth service: %v", err)
+	}
+	rotated.now = as.now
+
+	user, err := rotated.GetUserByAPIKey(apiKey, "")
+	if err != nil || user.ID != bot.ID {
+		t.Fatalf("expected the old API key to keep working, got %+v %v", user, err)
+	}
+	if _, ok := st.apiKeys[rotated.hashToken(apiKey)]; !ok || len(st.apiKeys) != 1 {
+		t.Errorf("expected the API key to be stored under its new hash only, got %d keys", len(st.apiKeys))
+	}
+
+	code, err := GenerateTOTP(admin.TOTPSecret, now)
+	if err != nil {
+		t.Fatalf("GenerateTOTP failed: %v", err)
+	}
+	if _, _, err := rotated.AdminLogin(AdminLoginRequest{Username: "root", Password: "correct-horse-battery", TOTP: code}); err != nil {
+		t.Fatalf("expected the old password to keep working, got %v", err)
+	}
+	if hash := st.admins[admin.ID].PasswordHash; hash == oldPasswordHash || hash != rotated.hashPassword("root", "correct-horse-battery") {
+		t.Errorf("expected the password to be re-hashed with the new secret")
+	}
+
+	user1 := &UserCredentials{User: models.User{ID: "user_1"}, RecoveryCodes: hashes}
+	if !rotated.useRecoveryCode(user1, codes[0]) || len(user1.RecoveryCodes) != len(codes)-1 {
+		t.Errorf("expected a recovery code made with the previous secret to be accepted")
+	}
+
+	// Without the previous secret, old hashes no longer match.
+	cfg.PreviousSecret = ""
+	fresh, err := NewAuthService(context.Background(), cfg, &MockStorage{creds: map[string]UserCredentials{}})
+	if err != nil {
+		t.Fatalf("failed to create auth service: %v", err)
+	}
+	if fresh.useRecoveryCode(&UserCredentials{User: models.User{ID: "user_1"}, RecoveryCodes: hashes}, codes[1]) {
+		t.Errorf("expected an old recovery code to be rejected without the previous secret")
+	}
+}
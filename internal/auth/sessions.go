@@ -0,0 +1,157 @@
+package auth
+
+import (
+	"cmp"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"slices"
+	"time"
+
+	"besedka/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// maxUserAgentLength limits the user agent kept with a session.
+const maxUserAgentLength = 256
+
+// Session is a login session of a user on one device. Only the hash of its
+// token is kept.
+type Session struct {
+	ID        string
+	UserID    string
+	TokenHash string
+	CreatedAt int64 // Unix timestamp (seconds)
+	UserAgent string
+	IP        string
+}
+
+// ClientInfo describes the client a session is started from.
+type ClientInfo struct {
+	UserAgent string
+	IP        string
+}
+
+// ClientInfoFromRequest returns the user agent and remote IP of a request.
+func ClientInfoFromRequest(r *http.Request) ClientInfo {
+	ip := r.RemoteAddr
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		ip = host
+	}
+	ua := r.UserAgent()
+	if len(ua) > maxUserAgentLength {
+		ua = ua[:maxUserAgentLength]
+	}
+	return ClientInfo{UserAgent: ua, IP: ip}
+}
+
+// startSession creates a session token for a user, stores its hash and
+// returns the token.
+func (as *AuthService) startSession(userID string, client ClientInfo, now time.Time) (string, error) {
+	token, err := as.generateToken()
+	if err != nil {
+		return "", err
+	}
+
+	session := Session{
+		ID:        uuid.NewString(),
+		UserID:    userID,
+		TokenHash: as.hashToken(token),
+		CreatedAt: now.Unix(),
+		UserAgent: client.UserAgent,
+		IP:        client.IP,
+	}
+	as.liveTokens.Set(session.TokenHash, tokenSession{Session: session, UpdatedAt: now})
+
+	userTokensTx := as.userTokens.Lock()
+	userTokens, _ := userTokensTx.Get(userID)
+	userTokensTx.Set(userID, append(userTokens, session.TokenHash))
+	userTokensTx.Unlock()
+
+	if err := as.storage.UpsertSession(session); err != nil {
+		slog.Error("failed to persist session", "user_id", userID, "error", err)
+	}
+	return token, nil
+}
+
+// SessionID returns the ID of the session a token belongs to.
+func (as *AuthService) SessionID(token string) (string, error) {
+	session, err := as.liveTokens.Get(as.hashToken(token))
+	if err != nil {
+		return "", models.ErrNotFound
+	}
+	return session.ID, nil
+}
+
+// ListSessions returns the live sessions of a user, most recently active
+// first. currentToken, if set, marks the session it belongs to.
+func (as *AuthService) ListSessions(userID, currentToken string) []models.SessionInfo {
+	currentHash := ""
+	if currentToken != "" {
+		currentHash = as.hashToken(currentToken)
+	}
+
+	userTokensTx := as.userTokens.RLock()
+	defer userTokensTx.Unlock()
+	tokenHashes, _ := userTokensTx.Get(userID)
+
+	sessions := make([]models.SessionInfo, 0, len(tokenHashes))
+	for _, tokenHash := range tokenHashes {
+		session, err := as.liveTokens.Get(tokenHash)
+		if err != nil {
+			continue
+		}
+		sessions = append(sessions, models.SessionInfo{
+			ID:           session.ID,
+			CreatedAt:    session.CreatedAt,
+			LastActiveAt: session.UpdatedAt.Unix(),
+			UserAgent:    session.UserAgent,
+			IP:           session.IP,
+			Current:      tokenHash == currentHash,
+		})
+	}
+	slices.SortFunc(sessions, func(a, b models.SessionInfo) int {
+		return cmp.Compare(b.LastActiveAt, a.LastActiveAt)
+	})
+	return sessions
+}
+
+// RevokeSession logs a user out of one session by its ID.
+func (as *AuthService) RevokeSession(userID, sessionID string) error {
+	userTokensTx := as.userTokens.Lock()
+	defer userTokensTx.Unlock()
+
+	tokenHashes, _ := userTokensTx.Get(userID)
+	for i, tokenHash := range tokenHashes {
+		session, err := as.liveTokens.Get(tokenHash)
+		if err != nil || session.ID != sessionID {
+			continue
+		}
+		if err := as.storage.DeleteToken(tokenHash); err != nil {
+			return fmt.Errorf("failed to delete session: %w", err)
+		}
+		_ = as.liveTokens.Del(tokenHash)
+		userTokensTx.Set(userID, slices.Delete(slices.Clone(tokenHashes), i, i+1))
+		return nil
+	}
+	return models.ErrNotFound
+}
+
+// RevokeSessions logs a user out of all their sessions and returns how many
+// there were.
+func (as *AuthService) RevokeSessions(userID string) int {
+	userTokensTx := as.userTokens.Lock()
+	defer userTokensTx.Unlock()
+
+	tokenHashes, _ := userTokensTx.Get(userID)
+	for _, tokenHash := range tokenHashes {
+		_ = as.liveTokens.Del(tokenHash)
+		if err := as.storage.DeleteToken(tokenHash); err != nil {
+			slog.Error("failed to delete token from storage", "user_id", userID, "error", err)
+		}
+	}
+	_ = userTokensTx.Del(userID)
+	return len(tokenHashes)
+}
@@ -0,0 +1,115 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"besedka/internal/models"
+)
+
+func TestSessions(t *testing.T) {
+	as := newTestAuthService(t)
+	now := time.Unix(1_700_000_000, 0)
+	as.now = func() time.Time { return now }
+	st := as.storage.(*MockStorage)
+
+	if _, err := as.AddUser("alice", "Alice"); err != nil {
+		t.Fatalf("AddUser failed: %v", err)
+	}
+	alice, err := as.GetUserByUsername("alice")
+	if err != nil {
+		t.Fatalf("GetUserByUsername failed: %v", err)
+	}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "192.0.2.7:4242"
+	req.Header.Set("User-Agent", "Firefox")
+	client := ClientInfoFromRequest(req)
+	if client.IP != "192.0.2.7" || client.UserAgent != "Firefox" {
+		t.Errorf("unexpected client info %+v", client)
+	}
+
+	laptop, err := as.startSession(alice.ID, client, now)
+	if err != nil {
+		t.Fatalf("startSession failed: %v", err)
+	}
+	phone, err := as.startSession(alice.ID, ClientInfo{UserAgent: "Safari", IP: "198.51.100.1"}, now.Add(time.Minute))
+	if err != nil {
+		t.Fatalf("startSession failed: %v", err)
+	}
+	if stored := st.sessions[as.hashToken(laptop)]; stored.ID == "" || stored.UserAgent != "Firefox" || stored.CreatedAt != now.Unix() {
+		t.Errorf("expected the session to be persisted, got %+v", stored)
+	}
+
+	sessions := as.ListSessions(alice.ID, laptop)
+	if len(sessions) != 2 || sessions[0].UserAgent != "Safari" || sessions[1].IP != "192.0.2.7" {
+		t.Fatalf("unexpected sessions %+v", sessions)
+	}
+	if sessions[0].Current || !sessions[1].Current {
+		t.Errorf("expected the laptop session to be current, got %+v", sessions)
+	}
+
+	// Activity moves a session to the top of the list. It is recorded when
+	// the token is refreshed, after half of its lifetime.
+	now = now.Add(as.TokenExpiry/2 + time.Minute)
+	if _, _, err := as.GetUserID(laptop); err != nil {
+		t.Fatalf("GetUserID failed: %v", err)
+	}
+	sessions = as.ListSessions(alice.ID, "")
+	if sessions[0].IP != "192.0.2.7" || sessions[0].LastActiveAt != now.Unix() {
+		t.Errorf("expected the laptop session to be most recent, got %+v", sessions)
+	}
+
+	phoneID, err := as.SessionID(phone)
+	if err != nil {
+		t.Fatalf("SessionID failed: %v", err)
+	}
+	if err := as.RevokeSession("bob-id", phoneID); !errors.Is(err, models.ErrNotFound) {
+		t.Errorf("expected ErrNotFound revoking another user's session, got %v", err)
+	}
+	if err := as.RevokeSession(alice.ID, phoneID); err != nil {
+		t.Fatalf("RevokeSession failed: %v", err)
+	}
+	if _, _, err := as.GetUserID(phone); err == nil {
+		t.Error("expected the revoked token to fail")
+	}
+	if _, ok := st.sessions[as.hashToken(phone)]; ok {
+		t.Error("expected the revoked session to be deleted from storage")
+	}
+	if _, _, err := as.GetUserID(laptop); err != nil {
+		t.Errorf("expected the other session to keep working, got %v", err)
+	}
+
+	if n := as.RevokeSessions(alice.ID); n != 1 {
+		t.Errorf("expected 1 session revoked, got %d", n)
+	}
+	if _, _, err := as.GetUserID(laptop); err == nil {
+		t.Error("expected all sessions to be revoked")
+	}
+	if len(as.ListSessions(alice.ID, "")) != 0 {
+		t.Error("expected no sessions left")
+	}
+}
+
+func TestLegacySessionMigration(t *testing.T) {
+	as := newTestAuthService(t)
+	st := as.storage.(*MockStorage)
+
+	// Tokens stored before sessions had metadata only map to a user.
+	st.tokens["legacy-hash"] = "alice-id"
+	reloaded, err := NewAuthService(context.Background(), as.Config, st)
+	if err != nil {
+		t.Fatalf("NewAuthService failed: %v", err)
+	}
+
+	sessions := reloaded.ListSessions("alice-id", "")
+	if len(sessions) != 1 || sessions[0].ID == "" {
+		t.Fatalf("expected the legacy token to get a session ID, got %+v", sessions)
+	}
+	if st.sessions["legacy-hash"].ID != sessions[0].ID {
+		t.Error("expected the session ID to be persisted")
+	}
+}
@@ -7,12 +7,28 @@ import (
 	"net/http"
 	"time"
 
+	"besedka/internal/content"
 	"besedka/internal/models"
 
 	"github.com/go-webauthn/webauthn/protocol"
 	"github.com/go-webauthn/webauthn/webauthn"
 )
 
+var (
+	ErrInvalidRegistrationToken = errors.New("invalid or expired registration token")
+	ErrAlreadyRegistered        = errors.New("user already registered")
+	ErrLastPasskey              = errors.New("the only passkey of a passkey-only account can't be removed")
+)
+
+// PasskeyRegistrationRequest completes registration with a passkey from a
+// setup link.
+type PasskeyRegistrationRequest struct {
+	Token       string
+	DisplayName string
+	Name        string // Passkey name
+	Client      ClientInfo
+}
+
 type webAuthnUser struct {
 	authService *AuthService
 	user        *UserCredentials
@@ -22,9 +38,14 @@ func (w *webAuthnUser) WebAuthnID() []byte { return []byte(w.user.ID) }
 func (w *webAuthnUser) WebAuthnName() string { return w.user.UserName }
 func (w *webAuthnUser) WebAuthnDisplayName() string { return w.user.DisplayName }
 func (w *webAuthnUser) WebAuthnCredentials() []webauthn.Credential {
-	passkeys, err := w.authService.storage.ListPasskeys(w.user.ID)
+	return w.authService.webAuthnCredentials(w.user.ID)
+}
+
+// webAuthnCredentials returns the passkeys of a user or admin.
+func (a *AuthService) webAuthnCredentials(id string) []webauthn.Credential {
+	passkeys, err := a.storage.ListPasskeys(id)
 	if err != nil {
-		slog.Error("failed to list passkeys in WebAuthnCredentials", "error", err, "userID", w.user.ID)
+		slog.Error("failed to list passkeys in WebAuthnCredentials", "error", err, "userID", id)
 	}
 	var creds []webauthn.Credential
 	for _, p := range passkeys {
@@ -78,6 +99,11 @@ func (a *AuthService) FinishPasskeyRegistration(userID string, name string, sess
 	if err != nil {
 		return err
 	}
+	return a.storage.UpsertPasskey(newPasskey(userID, name, cred))
+}
+
+// newPasskey describes a newly registered credential of a user.
+func newPasskey(userID, name string, cred *webauthn.Credential) Passkey {
 	if name == "" {
 		name = "Passkey"
 	}
@@ -85,7 +111,7 @@ func (a *AuthService) FinishPasskeyRegistration(userID string, name string, sess
 	for _, t := range cred.Transport {
 		transports = append(transports, string(t))
 	}
-	pk := Passkey{
+	return Passkey{
 		ID:              cred.ID,
 		UserID:          userID,
 		PublicKey:       cred.PublicKey,
@@ -98,7 +124,96 @@ func (a *AuthService) FinishPasskeyRegistration(userID string, name string, sess
 		BackupEligible:  cred.Flags.BackupEligible,
 		BackupState:     cred.Flags.BackupState,
 	}
-	return a.storage.UpsertPasskey(pk)
+}
+
+// getSetupUser returns the user a registration token was issued for, if they
+// have not completed registration yet.
+func (a *AuthService) getSetupUser(token string) (*webAuthnUser, error) {
+	userID, err := a.registrationTokens.Get(token)
+	if err != nil {
+		return nil, ErrInvalidRegistrationToken
+	}
+	u, err := a.getWebAuthnUser(userID)
+	if err != nil {
+		return nil, ErrInvalidRegistrationToken
+	}
+	if u.user.LastTOTP != -1 {
+		return nil, ErrAlreadyRegistered
+	}
+	return u, nil
+}
+
+// BeginPasskeySetup starts enrolling the first passkey of a user from their
+// setup link, for registration without a password.
+func (a *AuthService) BeginPasskeySetup(token string) (*protocol.CredentialCreation, *webauthn.SessionData, error) {
+	u, err := a.getSetupUser(token)
+	if err != nil {
+		return nil, nil, err
+	}
+	return a.webAuthn.BeginRegistration(u, webauthn.WithResidentKeyRequirement(protocol.ResidentKeyRequirementRequired))
+}
+
+// CompletePasskeyRegistration finishes registration with a passkey instead of
+// a password and TOTP. The account becomes passkey-only: Login rejects
+// password attempts for it.
+func (a *AuthService) CompletePasskeyRegistration(req PasskeyRegistrationRequest, sessionData *webauthn.SessionData, r *http.Request) (RegistrationResponse, string) {
+	u, err := a.getSetupUser(req.Token)
+	if err != nil {
+		return RegistrationResponse{Success: false, Message: err.Error()}, ""
+	}
+	cred, err := a.webAuthn.FinishRegistration(u, *sessionData, r)
+	if err != nil {
+		slog.Error("failed to finish passkey registration", "error", err, "userID", u.user.ID)
+		return RegistrationResponse{Success: false, Message: "Passkey registration failed"}, ""
+	}
+
+	tx := a.users.Lock()
+	defer tx.Unlock()
+
+	user, err := tx.Get(u.user.ID)
+	if err != nil {
+		return RegistrationResponse{Success: false, Message: "User not found"}, ""
+	}
+	if user.LastTOTP != -1 {
+		return RegistrationResponse{Success: false, Message: ErrAlreadyRegistered.Error()}, ""
+	}
+
+	if err := a.storage.UpsertPasskey(newPasskey(user.ID, req.Name, cred)); err != nil {
+		slog.Error("failed to persist passkey", "error", err, "userID", user.ID)
+		return RegistrationResponse{Success: false, Message: "Internal error"}, ""
+	}
+
+	if displayName := content.Sanitize(req.DisplayName); displayName != "" {
+		user.DisplayName = displayName
+	}
+	user.PasskeyOnly = true
+	user.PasswordHash = ""
+	user.TOTPSecret = ""
+	user.RecoveryCodes = nil
+	user.LastTOTP = 0 // Activate user
+	user.Status = models.UserStatusActive
+
+	if err := a.storage.UpsertCredentials(*user); err != nil {
+		slog.Error("failed to persist user after registration", "error", err)
+		return RegistrationResponse{Success: false, Message: "Internal error"}, ""
+	}
+
+	if err := a.storage.DeleteRegistrationToken(user.ID); err != nil {
+		slog.Error("failed to delete registration token", "error", err)
+	}
+	_ = a.registrationTokens.Del(req.Token)
+
+	token, err := a.startSession(user.ID, req.Client, a.now())
+	if err != nil {
+		slog.Error("login failed", "user_id", user.ID, "error", err)
+		return RegistrationResponse{Success: false, Message: "Internal error"}, ""
+	}
+
+	return RegistrationResponse{
+		Success: true,
+		Token:   token,
+		UserID:  user.ID,
+	}, token
 }
 
 func (a *AuthService) BeginPasskeyLogin() (*protocol.CredentialAssertion, *webauthn.SessionData, error) {
@@ -124,46 +239,19 @@ func (a *AuthService) FinishPasskeyLogin(sessionData *webauthn.SessionData, r *h
 		return LoginResponse{Success: false, Message: "WebAuthn login failed"}, nil, err
 	}
 
-	// Update sign count
-	passkeys, err := a.storage.ListPasskeys(userID)
-	if err != nil {
-		slog.Error("failed to list passkeys for sign count update", "error", err, "userID", userID)
-	} else {
-		for _, pk := range passkeys {
-			if bytes.Equal(pk.ID, cred.ID) {
-				pk.SignCount = cred.Authenticator.SignCount
-				pk.BackupState = cred.Flags.BackupState
-				if err := a.storage.UpsertPasskey(pk); err != nil {
-					slog.Error("failed to update passkey after login", "error", err, "userID", userID)
-				}
-				break
-			}
-		}
-	}
+	a.updatePasskeyAfterLogin(userID, cred)
 
-	token, err := a.generateToken()
+	now := a.now()
+	token, err := a.startSession(userID, ClientInfoFromRequest(r), now)
 	if err != nil {
 		return LoginResponse{Success: false, Message: "Failed to generate token"}, nil, err
 	}
-	tokenHash := a.hashToken(token)
-
-	now := a.now()
-	a.liveTokens.Set(tokenHash, tokenSession{UserID: userID, UpdatedAt: now})
-
-	userTokensTx := a.userTokens.Lock()
-	userTokens, _ := userTokensTx.Get(userID)
-	userTokensTx.Set(userID, append(userTokens, tokenHash))
-	userTokensTx.Unlock()
 
 	u.user.ResetFailedLoginAttempts(now)
 	if err := a.storage.UpsertCredentials(*u.user); err != nil {
 		return LoginResponse{Success: false, Message: "Database error"}, nil, err
 	}
 
-	if err := a.storage.UpsertToken(userID, tokenHash); err != nil {
-		slog.Error("failed to persist token after passkey login", "error", err)
-	}
-
 	return LoginResponse{
 		Success:      true,
 		Token:        token,
@@ -173,6 +261,26 @@ func (a *AuthService) FinishPasskeyLogin(sessionData *webauthn.SessionData, r *h
 	}, &u.user.User, nil
 }
 
+// updatePasskeyAfterLogin stores the sign count and backup state reported by
+// the authenticator of a passkey that was just used.
+func (a *AuthService) updatePasskeyAfterLogin(userID string, cred *webauthn.Credential) {
+	passkeys, err := a.storage.ListPasskeys(userID)
+	if err != nil {
+		slog.Error("failed to list passkeys for sign count update", "error", err, "userID", userID)
+		return
+	}
+	for _, pk := range passkeys {
+		if bytes.Equal(pk.ID, cred.ID) {
+			pk.SignCount = cred.Authenticator.SignCount
+			pk.BackupState = cred.Flags.BackupState
+			if err := a.storage.UpsertPasskey(pk); err != nil {
+				slog.Error("failed to update passkey after login", "error", err, "userID", userID)
+			}
+			return
+		}
+	}
+}
+
 func (a *AuthService) SaveWebAuthnSession(sessionID string, sessionData *webauthn.SessionData) {
 	a.webAuthnSessions.Set(sessionID, sessionData)
 }
@@ -189,10 +297,40 @@ func (a *AuthService) DeleteWebAuthnSession(sessionID string) {
 	_ = a.webAuthnSessions.Del(sessionID)
 }
 
+// IsPasskeyOnly reports whether a user signs in with passkeys only.
+func (a *AuthService) IsPasskeyOnly(userID string) bool {
+	tx := a.users.RLock()
+	defer tx.Unlock()
+	user, err := tx.Get(userID)
+	return err == nil && user.PasskeyOnly
+}
+
 func (a *AuthService) ListPasskeys(userID string) ([]Passkey, error) {
 	return a.storage.ListPasskeys(userID)
 }
 
+// DeletePasskey removes a passkey of a user. The last passkey of a
+// passkey-only account can't be removed, as the user would be locked out.
 func (a *AuthService) DeletePasskey(userID string, credentialID []byte) error {
+	tx := a.users.RLock()
+	user, err := tx.Get(userID)
+	passkeyOnly := err == nil && user.PasskeyOnly
+	tx.Unlock()
+
+	if passkeyOnly {
+		passkeys, err := a.storage.ListPasskeys(userID)
+		if err != nil {
+			return err
+		}
+		remaining := 0
+		for _, pk := range passkeys {
+			if !bytes.Equal(pk.ID, credentialID) {
+				remaining++
+			}
+		}
+		if remaining == 0 {
+			return ErrLastPasskey
+		}
+	}
 	return a.storage.DeletePasskey(userID, credentialID)
 }
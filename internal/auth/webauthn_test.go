@@ -2,11 +2,22 @@ package auth
 
 import (
 	"besedka/internal/models"
+	"bytes"
 	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
 	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 	"time"
 
+	"github.com/go-webauthn/webauthn/protocol/webauthncbor"
+	"github.com/go-webauthn/webauthn/protocol/webauthncose"
 	"github.com/go-webauthn/webauthn/webauthn"
 )
 
@@ -166,3 +177,119 @@ func TestBeginPasskeyRegistration(t *testing.T) {
 		t.Errorf("expected session userID to be user123, got %s", string(session.UserID))
 	}
 }
+
+// noneAttestation builds a browser's response to a passkey registration
+// ceremony, as an authenticator without attestation would produce it.
+func noneAttestation(t *testing.T, cfg Config, session *webauthn.SessionData) *http.Request {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	coseKey, err := webauthncbor.Marshal(webauthncose.EC2PublicKeyData{
+		PublicKeyData: webauthncose.PublicKeyData{KeyType: int64(webauthncose.EllipticKey), Algorithm: int64(webauthncose.AlgES256)},
+		Curve:         1, // P-256
+		XCoord:        key.X.FillBytes(make([]byte, 32)),
+		YCoord:        key.Y.FillBytes(make([]byte, 32)),
+	})
+	if err != nil {
+		t.Fatalf("failed to encode key: %v", err)
+	}
+
+	credID := []byte("credential-" + session.Challenge[:8])
+	rpIDHash := sha256.Sum256([]byte(cfg.RPID))
+	authData := append(rpIDHash[:], 0x45, 0, 0, 0, 0) // UP, UV and AT flags, zero sign count
+	authData = append(authData, make([]byte, 16)...)  // AAGUID
+	authData = append(authData, byte(len(credID)>>8), byte(len(credID)))
+	authData = append(authData, credID...)
+	authData = append(authData, coseKey...)
+
+	attestation, err := webauthncbor.Marshal(map[string]any{
+		"fmt":      "none",
+		"attStmt":  map[string]any{},
+		"authData": authData,
+	})
+	if err != nil {
+		t.Fatalf("failed to encode attestation: %v", err)
+	}
+	clientData, _ := json.Marshal(map[string]string{
+		"type":      "webauthn.create",
+		"challenge": session.Challenge,
+		"origin":    cfg.RPOrigin,
+	})
+
+	enc := base64.RawURLEncoding
+	body, _ := json.Marshal(map[string]any{
+		"id":    enc.EncodeToString(credID),
+		"rawId": enc.EncodeToString(credID),
+		"type":  "public-key",
+		"response": map[string]string{
+			"attestationObject": enc.EncodeToString(attestation),
+			"clientDataJSON":    enc.EncodeToString(clientData),
+		},
+	})
+	return httptest.NewRequest(http.MethodPost, "/api/webauthn/setup/finish", bytes.NewReader(body))
+}
+
+func TestPasskeyOnlyRegistration(t *testing.T) {
+	as := newTestAuthService(t)
+	st := as.storage.(*MockStorage)
+
+	regToken, err := as.AddUser("alice", "Alice")
+	if err != nil {
+		t.Fatalf("AddUser failed: %v", err)
+	}
+	if _, _, err := as.BeginPasskeySetup("bogus"); !errors.Is(err, ErrInvalidRegistrationToken) {
+		t.Errorf("expected ErrInvalidRegistrationToken, got %v", err)
+	}
+	_, session, err := as.BeginPasskeySetup(regToken)
+	if err != nil {
+		t.Fatalf("BeginPasskeySetup failed: %v", err)
+	}
+
+	resp, token := as.CompletePasskeyRegistration(PasskeyRegistrationRequest{
+		Token:       regToken,
+		DisplayName: "Alice A.",
+		Name:        "Laptop",
+	}, session, noneAttestation(t, as.Config, session))
+	if !resp.Success || token == "" {
+		t.Fatalf("CompletePasskeyRegistration failed: %+v", resp)
+	}
+	if userID, _, err := as.GetUserID(token); err != nil || userID != resp.UserID {
+		t.Errorf("expected to be logged in, got %q %v", userID, err)
+	}
+
+	stored := st.creds[resp.UserID]
+	if !stored.PasskeyOnly || stored.PasswordHash != "" || stored.TOTPSecret != "" ||
+		stored.Status != models.UserStatusActive || stored.DisplayName != "Alice A." {
+		t.Errorf("unexpected stored user %+v", stored)
+	}
+	passkeys, _ := as.ListPasskeys(resp.UserID)
+	if len(passkeys) != 1 || passkeys[0].Name != "Laptop" {
+		t.Fatalf("expected the passkey to be stored, got %+v", passkeys)
+	}
+
+	if _, _, err := as.BeginPasskeySetup(regToken); err == nil {
+		t.Error("expected the setup link to be used up")
+	}
+	for _, password := range []string{"", "anything"} {
+		if resp, _ := as.Login(LoginRequest{Username: "alice", Password: password}); resp.Success {
+			t.Errorf("expected password login with %q to be rejected", password)
+		}
+	}
+	if _, err := as.RegenerateRecoveryCodes(resp.UserID, RecoveryCodesRequest{}); !errors.Is(err, ErrPasskeyOnly) {
+		t.Errorf("expected ErrPasskeyOnly, got %v", err)
+	}
+	if err := as.DeletePasskey(resp.UserID, passkeys[0].ID); !errors.Is(err, ErrLastPasskey) {
+		t.Errorf("expected ErrLastPasskey, got %v", err)
+	}
+
+	// A password reset lets the user register again either way.
+	if _, err := as.ResetPassword(resp.UserID, true); err != nil {
+		t.Fatalf("ResetPassword failed: %v", err)
+	}
+	if as.IsPasskeyOnly(resp.UserID) {
+		t.Error("expected a password reset to clear the passkey-only flag")
+	}
+}
@@ -0,0 +1,129 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"besedka/internal/models"
+
+	"github.com/c-pro/geche"
+)
+
+var (
+	ErrNotWebhook           = errors.New("user is not a webhook")
+	ErrInvalidWebhookTarget = errors.New("invalid webhook target")
+	ErrWebhookChatDenied    = errors.New("webhook is not allowed to post to this chat")
+)
+
+// SetWebhookChats replaces the chats a webhook may post to. Targets are
+// resolved as by ResolveWebhookTarget; the first one becomes the default.
+// Group chat IDs are not checked against existing groups, the caller must
+// do that.
+func (as *AuthService) SetWebhookChats(userID string, targets []string) ([]string, error) {
+	tx := as.users.Lock()
+	defer tx.Unlock()
+
+	user, err := tx.Get(userID)
+	if err != nil || user.Status == models.UserStatusDeleted {
+		return nil, models.ErrNotFound
+	}
+	if user.Type != models.UserTypeWebhook {
+		return nil, ErrNotWebhook
+	}
+
+	chats, err := as.resolveWebhookChats(tx, userID, targets)
+	if err != nil {
+		return nil, err
+	}
+
+	updated := *user
+	updated.TargetChatID = chats[0]
+	updated.WebhookChats = chats
+	if err := as.storage.UpsertCredentials(updated); err != nil {
+		return nil, fmt.Errorf("failed to persist webhook chats: %w", err)
+	}
+	tx.Set(userID, &updated)
+	return chats, nil
+}
+
+// ResolveWebhookTarget returns the chat a webhook posts to for target, which
+// is "townhall", a username for the webhook's direct messages with that user,
+// the ID of such a chat, or a group chat ID. An empty target is the webhook's
+// default chat. It returns ErrWebhookChatDenied if the chat isn't allowed.
+func (as *AuthService) ResolveWebhookTarget(userID, target string) (string, error) {
+	tx := as.users.RLock()
+	defer tx.Unlock()
+
+	user, err := tx.Get(userID)
+	if err != nil || user.Type != models.UserTypeWebhook {
+		return "", models.ErrNotFound
+	}
+	if strings.TrimSpace(target) == "" {
+		return user.TargetChatID, nil
+	}
+	chatID, err := as.resolveWebhookTarget(tx, userID, target)
+	if err != nil {
+		return "", err
+	}
+	if !slices.Contains(user.WebhookChats, chatID) {
+		return "", ErrWebhookChatDenied
+	}
+	return chatID, nil
+}
+
+// resolveWebhookChats resolves targets to distinct chat IDs, keeping their
+// order. The caller must hold the users lock.
+func (as *AuthService) resolveWebhookChats(tx *geche.Tx[string, *UserCredentials], webhookID string, targets []string) ([]string, error) {
+	if len(targets) == 0 {
+		return nil, fmt.Errorf("%w: at least one chat is required", ErrInvalidWebhookTarget)
+	}
+	chats := make([]string, 0, len(targets))
+	for _, target := range targets {
+		chatID, err := as.resolveWebhookTarget(tx, webhookID, target)
+		if err != nil {
+			return nil, err
+		}
+		if !slices.Contains(chats, chatID) {
+			chats = append(chats, chatID)
+		}
+	}
+	return chats, nil
+}
+
+// resolveWebhookTarget maps a target to a chat ID without checking the
+// webhook's allow-list. The caller must hold the users lock.
+func (as *AuthService) resolveWebhookTarget(tx *geche.Tx[string, *UserCredentials], webhookID, target string) (string, error) {
+	target = strings.TrimSpace(target)
+	switch {
+	case target == "" || target == "townhall":
+		return "townhall", nil
+	case strings.HasPrefix(target, "group_"):
+		return target, nil
+	case strings.HasPrefix(target, "dm_"):
+		parts := strings.Split(strings.TrimPrefix(target, "dm_"), "_")
+		if len(parts) != 2 || !slices.Contains(parts, webhookID) {
+			return "", fmt.Errorf("%w: %q is not a direct message chat of this webhook", ErrInvalidWebhookTarget, target)
+		}
+		otherID := parts[0]
+		if otherID == webhookID {
+			otherID = parts[1]
+		}
+		other, err := tx.Get(otherID)
+		if err != nil || other.Status == models.UserStatusDeleted {
+			return "", fmt.Errorf("%w: %q is not a direct message chat of this webhook", ErrInvalidWebhookTarget, target)
+		}
+		return models.GetDMID(webhookID, otherID), nil
+	}
+
+	targetID, err := as.usernames.Get(target)
+	if err != nil {
+		return "", fmt.Errorf("%w: target user %q not found", ErrInvalidWebhookTarget, target)
+	}
+	targetUser, err := tx.Get(targetID)
+	if err != nil || targetUser.Status == models.UserStatusDeleted || targetID == webhookID {
+		return "", fmt.Errorf("%w: target user %q not found", ErrInvalidWebhookTarget, target)
+	}
+	return models.GetDMID(webhookID, targetUser.ID), nil
+}
@@ -0,0 +1,95 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	"besedka/internal/models"
+)
+
+func TestWebhookChats(t *testing.T) {
+	as := newTestAuthService(t)
+
+	if _, err := as.AddUser("alice", "Alice"); err != nil {
+		t.Fatalf("AddUser failed: %v", err)
+	}
+	alice, err := as.GetUserByUsername("alice")
+	if err != nil {
+		t.Fatalf("GetUserByUsername failed: %v", err)
+	}
+	hook, _, err := as.AddWebhook("alerts", "Alerts", []string{"townhall"})
+	if err != nil {
+		t.Fatalf("AddWebhook failed: %v", err)
+	}
+	aliceDM := models.GetDMID(hook.ID, alice.ID)
+
+	if chatID, err := as.ResolveWebhookTarget(hook.ID, ""); err != nil || chatID != "townhall" {
+		t.Errorf("expected the default chat, got %q %v", chatID, err)
+	}
+	if _, err := as.ResolveWebhookTarget(hook.ID, "alice"); !errors.Is(err, ErrWebhookChatDenied) {
+		t.Errorf("expected ErrWebhookChatDenied before the DM is allowed, got %v", err)
+	}
+
+	chats, err := as.SetWebhookChats(hook.ID, []string{"alice", "townhall", "group_ops", aliceDM})
+	if err != nil {
+		t.Fatalf("SetWebhookChats failed: %v", err)
+	}
+	if !slices.Equal(chats, []string{aliceDM, "townhall", "group_ops"}) {
+		t.Errorf("unexpected chats %v", chats)
+	}
+	for target, want := range map[string]string{"": aliceDM, "alice": aliceDM, "townhall": "townhall", "group_ops": "group_ops"} {
+		if chatID, err := as.ResolveWebhookTarget(hook.ID, target); err != nil || chatID != want {
+			t.Errorf("ResolveWebhookTarget(%q) = %q, %v; want %q", target, chatID, err, want)
+		}
+	}
+	if _, err := as.ResolveWebhookTarget(hook.ID, "group_other"); !errors.Is(err, ErrWebhookChatDenied) {
+		t.Errorf("expected ErrWebhookChatDenied for another group, got %v", err)
+	}
+	for _, bad := range []string{"nobody", "alerts", models.GetDMID(alice.ID, "someone")} {
+		if _, err := as.SetWebhookChats(hook.ID, []string{bad}); !errors.Is(err, ErrInvalidWebhookTarget) {
+			t.Errorf("SetWebhookChats(%q): expected ErrInvalidWebhookTarget, got %v", bad, err)
+		}
+	}
+	if _, err := as.SetWebhookChats(hook.ID, nil); !errors.Is(err, ErrInvalidWebhookTarget) {
+		t.Errorf("expected ErrInvalidWebhookTarget for an empty list, got %v", err)
+	}
+	if _, err := as.SetWebhookChats(alice.ID, []string{"townhall"}); !errors.Is(err, ErrNotWebhook) {
+		t.Errorf("expected ErrNotWebhook, got %v", err)
+	}
+
+	// A webhook is only created once all its chats resolve, so a failed
+	// attempt doesn't take the username.
+	if _, _, err := as.AddWebhook("deploys", "Deploys", []string{"townhall", "nobody"}); !errors.Is(err, ErrInvalidWebhookTarget) {
+		t.Errorf("expected ErrInvalidWebhookTarget, got %v", err)
+	}
+	deploys, _, err := as.AddWebhook("deploys", "Deploys", []string{"townhall", "alice"})
+	if err != nil {
+		t.Fatalf("AddWebhook failed: %v", err)
+	}
+	if want := []string{"townhall", models.GetDMID(deploys.ID, alice.ID)}; deploys.TargetChatID != "townhall" || !slices.Equal(deploys.WebhookChats, want) {
+		t.Errorf("unexpected webhook chats %q, %v", deploys.TargetChatID, deploys.WebhookChats)
+	}
+
+	user, _ := as.GetUser(hook.ID)
+	if user.TargetChatID != aliceDM || !models.CanPost("group_ops", user) || models.CanPost("group_other", user) {
+		t.Errorf("unexpected webhook user %+v", user)
+	}
+
+	// Webhooks stored before allow-lists keep posting to their target.
+	st := as.storage.(*MockStorage)
+	legacy := st.creds[hook.ID]
+	legacy.WebhookChats = nil
+	st.creds[hook.ID] = legacy
+	reloaded, err := NewAuthService(context.Background(), as.Config, st)
+	if err != nil {
+		t.Fatalf("NewAuthService failed: %v", err)
+	}
+	if chatID, err := reloaded.ResolveWebhookTarget(hook.ID, "alice"); err != nil || chatID != aliceDM {
+		t.Errorf("expected the legacy target to be allowed, got %q %v", chatID, err)
+	}
+	if _, err := reloaded.ResolveWebhookTarget(hook.ID, "townhall"); !errors.Is(err, ErrWebhookChatDenied) {
+		t.Errorf("expected only the legacy target to be allowed, got %v", err)
+	}
+}
@@ -15,6 +15,7 @@ import (
 	"testing"
 	"time"
 
+	"besedka/internal/auth"
 	"besedka/internal/filestore"
 	"besedka/internal/models"
 	"besedka/internal/objectstore"
@@ -317,7 +318,7 @@ func TestIncrementalBackupAndRecover(t *testing.T) {
 	if err := st.SetConfig("greeting", "v1"); err != nil {
 		t.Fatal(err)
 	}
-	if err := st.UpsertToken("u1", "tok-a"); err != nil {
+	if err := st.UpsertSession(auth.Session{UserID: "u1", TokenHash: "tok-a"}); err != nil {
 		t.Fatal(err)
 	}
 
@@ -335,7 +336,7 @@ func TestIncrementalBackupAndRecover(t *testing.T) {
 	if err := st.DeleteToken("tok-a"); err != nil {
 		t.Fatal(err)
 	}
-	if err := st.UpsertToken("u1", "tok-b"); err != nil {
+	if err := st.UpsertSession(auth.Session{UserID: "u1", TokenHash: "tok-b"}); err != nil {
 		t.Fatal(err)
 	}
 	if err := st.SetConfig("greeting", "v2"); err != nil {
@@ -386,10 +387,14 @@ func TestIncrementalBackupAndRecover(t *testing.T) {
 		t.Errorf("recovered messages = %v, want [hello world again]", contents)
 	}
 
-	tokens, err := st2.ListTokens()
+	sessions, err := st2.ListSessions()
 	if err != nil {
 		t.Fatal(err)
 	}
+	tokens := make(map[string]string)
+	for _, s := range sessions {
+		tokens[s.TokenHash] = s.UserID
+	}
 	if _, ok := tokens["tok-a"]; ok {
 		t.Error("deleted token tok-a should not survive recovery")
 	}
@@ -0,0 +1,446 @@
+// Package botwebhook delivers new messages to bots over HTTP, as an
+// alternative to holding a WebSocket open.
+//
+// Each message a bot can see is queued in the database and POSTed to the
+// bot's callback URL as JSON. Requests are signed with a key derived from the
+// bot's API key (see auth.WebhookSigningKey). Failed requests are retried with
+// exponential backoff; deliveries for a bot are sent in order, and a bot's
+// queue is bounded so an unreachable bot can't grow the database forever.
+// Bots are served concurrently by a bounded pool of workers, so a slow bot
+// doesn't hold up the others.
+package botwebhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"besedka/internal/models"
+	"besedka/internal/storage"
+)
+
+const (
+	SignatureHeader = "X-Besedka-Signature"
+	TimestampHeader = "X-Besedka-Timestamp"
+	DeliveryHeader  = "X-Besedka-Delivery"
+
+	EventTypeMessage = "message"
+	EventTypeCommand = "command"
+
+	userAgent       = "Besedka-Webhook/1.0"
+	maxErrorLen     = 200
+	maxResponseRead = 64 << 10
+
+	// MaxTimestampSkew is how far the signed timestamp of a request may be
+	// from the receiver's clock for Verify to accept it.
+	MaxTimestampSkew = 5 * time.Minute
+)
+
+// Store persists the delivery queue and per-bot delivery status.
+type Store interface {
+	EnqueueDelivery(d storage.Delivery, limit int) (uint64, int, error)
+	CountDeliveries() (map[string]int, error)
+	NextDelivery(botID string) (*storage.Delivery, error)
+	UpdateDelivery(d storage.Delivery) error
+	DeleteDelivery(botID string, id uint64) error
+	UpdateDeliveryStatus(botID string, update func(st *storage.DeliveryStatus)) error
+}
+
+// Bots looks up a bot's callback URL and signing key. It returns an error
+// when the bot has no callback URL.
+type Bots interface {
+	GetBotWebhook(userID string) (string, []byte, error)
+}
+
+type Config struct {
+	Timeout      time.Duration // Per request
+	MaxAttempts  int           // Deliveries are dropped after this many failed attempts
+	MaxQueue     int           // Per bot; the oldest deliveries are dropped when full
+	RetryBackoff time.Duration // Delay before the first retry, doubled on every failure
+	MaxBackoff   time.Duration
+	PollInterval time.Duration // How often due retries are checked
+	Workers      int           // Bots served at once
+}
+
+func (c Config) withDefaults() Config {
+	if c.Timeout <= 0 {
+		c.Timeout = 10 * time.Second
+	}
+	if c.MaxAttempts <= 0 {
+		c.MaxAttempts = 8
+	}
+	if c.MaxQueue <= 0 {
+		c.MaxQueue = 1000
+	}
+	if c.RetryBackoff <= 0 {
+		c.RetryBackoff = 5 * time.Second
+	}
+	if c.MaxBackoff <= 0 {
+		c.MaxBackoff = 30 * time.Minute
+	}
+	if c.PollInterval <= 0 {
+		c.PollInterval = 5 * time.Second
+	}
+	if c.Workers <= 0 {
+		c.Workers = 4
+	}
+	return c
+}
+
+// Event is the JSON body POSTed to a bot's callback URL. Message is set for
+// message events and Command for slash command invocations.
+type Event struct {
+	Type    string                    `json:"type"`
+	BotID   string                    `json:"botId"`
+	Message *models.Message           `json:"message,omitempty"`
+	Command *models.CommandInvocation `json:"command,omitempty"`
+}
+
+type Dispatcher struct {
+	store  Store
+	bots   Bots
+	cfg    Config
+	client *http.Client
+	wake   chan struct{}
+	now    func() time.Time
+
+	workers chan struct{} // Semaphore bounding the bots served at once
+	wg      sync.WaitGroup
+
+	mu sync.Mutex
+	// busy holds the bots a worker is serving, and retryAt when the
+	// first delivery of a bot waiting for a retry is due, so its queue is
+	// not read until then.
+	busy    map[string]bool
+	retryAt map[string]int64
+}
+
+func New(store Store, bots Bots, cfg Config) *Dispatcher {
+	cfg = cfg.withDefaults()
+	return &Dispatcher{
+		store: store,
+		bots:  bots,
+		cfg:   cfg,
+		client: &http.Client{
+			Timeout: cfg.Timeout,
+			// Redirects would be followed without the signature being
+			// re-checked by anyone, so a redirect counts as a failure.
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		wake:    make(chan struct{}, 1),
+		now:     time.Now,
+		workers: make(chan struct{}, cfg.Workers),
+		busy:    make(map[string]bool),
+		retryAt: make(map[string]int64),
+	}
+}
+
+// NotifyBot queues msg for delivery if the bot has a callback URL.
+func (d *Dispatcher) NotifyBot(botID string, msg models.Message) {
+	d.enqueue(Event{Type: EventTypeMessage, BotID: botID, Message: &msg})
+}
+
+// NotifyCommand queues a slash command invocation for delivery. It reports
+// false if the bot has no callback URL.
+func (d *Dispatcher) NotifyCommand(botID string, inv models.CommandInvocation) bool {
+	return d.enqueue(Event{Type: EventTypeCommand, BotID: botID, Command: &inv})
+}
+
+func (d *Dispatcher) enqueue(ev Event) bool {
+	botID := ev.BotID
+	if _, _, err := d.bots.GetBotWebhook(botID); err != nil {
+		return false
+	}
+
+	payload, err := json.Marshal(ev)
+	if err != nil {
+		slog.Error("failed to encode bot webhook event", "botID", botID, "error", err)
+		return false
+	}
+
+	now := d.now()
+	_, dropped, err := d.store.EnqueueDelivery(storage.Delivery{
+		ID:          uint64(now.UnixNano()),
+		BotID:       botID,
+		Payload:     payload,
+		NextAttempt: now.Unix(),
+		CreatedAt:   now.Unix(),
+	}, d.cfg.MaxQueue)
+	if err != nil {
+		slog.Error("failed to queue bot webhook delivery", "botID", botID, "error", err)
+		return false
+	}
+	if dropped > 0 {
+		slog.Warn("bot webhook queue full, dropped oldest deliveries", "botID", botID, "dropped", dropped)
+	}
+
+	d.signal()
+	return true
+}
+
+// signal wakes Run up without blocking.
+func (d *Dispatcher) signal() {
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Run delivers queued messages until ctx is done.
+func (d *Dispatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(d.cfg.PollInterval)
+	defer ticker.Stop()
+	for {
+		d.deliverDue(ctx)
+		select {
+		case <-ctx.Done():
+			d.wg.Wait()
+			return
+		case <-ticker.C:
+		case <-d.wake:
+		}
+	}
+}
+
+// deliverDue starts a worker for every bot with queued deliveries that may be
+// due, unless one is already serving it. Only the queue keys are read here;
+// workers decrypt the deliveries they send.
+func (d *Dispatcher) deliverDue(ctx context.Context) {
+	counts, err := d.store.CountDeliveries()
+	if err != nil {
+		slog.Error("failed to list bot webhook deliveries", "error", err)
+		return
+	}
+
+	now := d.now().Unix()
+	for botID, n := range counts {
+		if n == 0 {
+			continue
+		}
+		d.mu.Lock()
+		skip := d.busy[botID] || d.retryAt[botID] > now
+		if !skip {
+			d.busy[botID] = true
+		}
+		d.mu.Unlock()
+		if skip {
+			continue
+		}
+
+		select {
+		case d.workers <- struct{}{}:
+		case <-ctx.Done():
+			d.release(botID)
+			return
+		}
+		d.wg.Add(1)
+		go func() {
+			defer d.wg.Done()
+			defer func() { <-d.workers }()
+			d.deliverBot(ctx, botID)
+			d.release(botID)
+			// Deliveries queued while the worker was finishing are picked
+			// up by the next round.
+			d.signal()
+		}()
+	}
+}
+
+// deliverBot sends a bot's deliveries in order until its queue is empty or
+// the oldest delivery is waiting for a retry.
+func (d *Dispatcher) deliverBot(ctx context.Context, botID string) {
+	for ctx.Err() == nil {
+		del, err := d.store.NextDelivery(botID)
+		if err != nil {
+			slog.Error("failed to read bot webhook delivery", "botID", botID, "error", err)
+			return
+		}
+		if del == nil {
+			return
+		}
+		if del.NextAttempt > d.now().Unix() {
+			d.setRetryAt(botID, del.NextAttempt)
+			return
+		}
+		if !d.attempt(ctx, *del) {
+			return
+		}
+	}
+}
+
+func (d *Dispatcher) release(botID string) {
+	d.mu.Lock()
+	delete(d.busy, botID)
+	d.mu.Unlock()
+}
+
+func (d *Dispatcher) setRetryAt(botID string, at int64) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if at > 0 {
+		d.retryAt[botID] = at
+	} else {
+		delete(d.retryAt, botID)
+	}
+}
+
+// attempt sends one delivery and records the outcome. It reports whether the
+// delivery is finished, either sent or given up on.
+func (d *Dispatcher) attempt(ctx context.Context, del storage.Delivery) bool {
+	callbackURL, key, err := d.bots.GetBotWebhook(del.BotID)
+	if err != nil {
+		// The callback was removed or the bot deleted since it was queued.
+		d.remove(del)
+		return true
+	}
+
+	code, err := d.post(ctx, callbackURL, key, del)
+	if ctx.Err() != nil {
+		return false // Shutting down; retry on next start
+	}
+
+	now := d.now().Unix()
+	if err == nil {
+		d.setRetryAt(del.BotID, 0)
+		d.remove(del)
+		d.updateStatus(del.BotID, func(st *storage.DeliveryStatus) {
+			st.Delivered++
+			st.LastAttempt = now
+			st.LastSuccess = now
+			st.LastStatusCode = code
+			st.LastError = ""
+		})
+		return true
+	}
+
+	del.Attempts++
+	giveUp := del.Attempts >= d.cfg.MaxAttempts
+	d.updateStatus(del.BotID, func(st *storage.DeliveryStatus) {
+		st.LastAttempt = now
+		st.LastStatusCode = code
+		st.LastError = truncate(err.Error(), maxErrorLen)
+		if giveUp {
+			st.Dropped++
+		}
+	})
+
+	if giveUp {
+		slog.Warn("giving up on bot webhook delivery", "botID", del.BotID, "attempts", del.Attempts, "error", err)
+		d.setRetryAt(del.BotID, 0)
+		d.remove(del)
+		return true
+	}
+
+	del.NextAttempt = now + int64(d.backoff(del.Attempts)/time.Second)
+	d.setRetryAt(del.BotID, del.NextAttempt)
+	if err := d.store.UpdateDelivery(del); err != nil {
+		slog.Error("failed to reschedule bot webhook delivery", "botID", del.BotID, "error", err)
+	}
+	return false
+}
+
+func (d *Dispatcher) post(ctx context.Context, callbackURL string, key []byte, del storage.Delivery) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, callbackURL, bytes.NewReader(del.Payload))
+	if err != nil {
+		return 0, err
+	}
+	ts := strconv.FormatInt(d.now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", userAgent)
+	req.Header.Set(TimestampHeader, ts)
+	req.Header.Set(DeliveryHeader, strconv.FormatUint(del.ID, 10))
+	req.Header.Set(SignatureHeader, "sha256="+Sign(key, ts, del.Payload))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, maxResponseRead))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("callback returned status %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+func (d *Dispatcher) backoff(attempts int) time.Duration {
+	delay := d.cfg.RetryBackoff
+	for i := 1; i < attempts && delay < d.cfg.MaxBackoff; i++ {
+		delay *= 2
+	}
+	return min(delay, d.cfg.MaxBackoff)
+}
+
+func (d *Dispatcher) remove(del storage.Delivery) {
+	if err := d.store.DeleteDelivery(del.BotID, del.ID); err != nil {
+		slog.Error("failed to remove bot webhook delivery", "botID", del.BotID, "error", err)
+	}
+}
+
+func (d *Dispatcher) updateStatus(botID string, update func(st *storage.DeliveryStatus)) {
+	if err := d.store.UpdateDeliveryStatus(botID, update); err != nil {
+		slog.Error("failed to update bot webhook status", "botID", botID, "error", err)
+	}
+}
+
+// Sign returns the hex-encoded HMAC-SHA256 of timestamp, a dot and body.
+func Sign(key []byte, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+var (
+	// ErrBadSignature is returned by Verify for requests not signed with the key.
+	ErrBadSignature = errors.New("invalid webhook signature")
+	// ErrStaleTimestamp is returned by Verify for requests signed more than
+	// MaxTimestampSkew away from now, such as replayed ones.
+	ErrStaleTimestamp = errors.New("webhook timestamp outside the allowed window")
+)
+
+// Verify checks the signature headers of a webhook request and that it was
+// signed within MaxTimestampSkew of now. Bots written in Go can use it with
+// auth.WebhookSigningKey(apiKey).
+func Verify(key []byte, header http.Header, body []byte) error {
+	return verifyAt(key, header, body, time.Now())
+}
+
+func verifyAt(key []byte, header http.Header, body []byte, now time.Time) error {
+	ts := header.Get(TimestampHeader)
+	sig := header.Get(SignatureHeader)
+	want := "sha256=" + Sign(key, ts, body)
+	if !hmac.Equal([]byte(sig), []byte(want)) {
+		return ErrBadSignature
+	}
+	unix, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return ErrBadSignature
+	}
+	if skew := now.Sub(time.Unix(unix, 0)); skew > MaxTimestampSkew || skew < -MaxTimestampSkew {
+		return ErrStaleTimestamp
+	}
+	return nil
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n]
+}
@@ -0,0 +1,221 @@
+package botwebhook
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"besedka/internal/filestore"
+	"besedka/internal/models"
+	"besedka/internal/storage"
+)
+
+type fakeBots struct {
+	urls map[string]string
+	key  []byte
+}
+
+func (f *fakeBots) GetBotWebhook(userID string) (string, []byte, error) {
+	u, ok := f.urls[userID]
+	if !ok {
+		return "", nil, models.ErrNotFound
+	}
+	return u, f.key, nil
+}
+
+func newTestStore(t *testing.T) *storage.BboltStorage {
+	t.Helper()
+	dir := t.TempDir()
+	fs, err := filestore.NewLocalFileStore(filepath.Join(dir, "uploads"))
+	if err != nil {
+		t.Fatalf("failed to create filestore: %v", err)
+	}
+	st, err := storage.NewBboltStorage(filepath.Join(dir, "test.db"), []byte("test-secret-key-32-bytes-length!"), fs)
+	if err != nil {
+		t.Fatalf("failed to create storage: %v", err)
+	}
+	t.Cleanup(func() { _ = st.Close() })
+	return st
+}
+
+// recorder is a callback endpoint that fails the first failures requests.
+type recorder struct {
+	mu       sync.Mutex
+	failures int
+	events   []Event
+	headers  []http.Header
+	bodies   [][]byte
+}
+
+func (rec *recorder) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	if rec.failures > 0 {
+		rec.failures--
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	var ev Event
+	_ = json.Unmarshal(body, &ev)
+	rec.events = append(rec.events, ev)
+	rec.headers = append(rec.headers, r.Header.Clone())
+	rec.bodies = append(rec.bodies, body)
+}
+
+// deliverAll runs one delivery round and waits for its workers.
+func deliverAll(d *Dispatcher) {
+	d.deliverDue(context.Background())
+	d.wg.Wait()
+}
+
+func TestDispatcherDelivers(t *testing.T) {
+	st := newTestStore(t)
+	rec := &recorder{}
+	srv := httptest.NewServer(rec)
+	defer srv.Close()
+
+	bots := &fakeBots{urls: map[string]string{"bot1": srv.URL}, key: []byte("signing-key")}
+	d := New(st, bots, Config{})
+
+	d.NotifyBot("bot1", models.Message{Seq: 1, ChatID: "townhall", Content: "hello"})
+	d.NotifyBot("bot1", models.Message{Seq: 2, ChatID: "townhall", Content: "world"})
+	d.NotifyBot("nobody", models.Message{Seq: 3, ChatID: "townhall"}) // no callback URL, not queued
+	deliverAll(d)
+
+	if len(rec.events) != 2 || rec.events[0].Message.Seq != 1 || rec.events[1].Message.Seq != 2 {
+		t.Fatalf("expected both messages in order, got %+v", rec.events)
+	}
+	if rec.events[0].Type != EventTypeMessage || rec.events[0].BotID != "bot1" {
+		t.Errorf("unexpected event %+v", rec.events[0])
+	}
+	if err := Verify(bots.key, rec.headers[0], rec.bodies[0]); err != nil {
+		t.Errorf("signature did not verify: %v", err)
+	}
+	if err := Verify([]byte("other-key"), rec.headers[0], rec.bodies[0]); err != ErrBadSignature {
+		t.Errorf("expected ErrBadSignature for the wrong key, got %v", err)
+	}
+	// Captured requests can't be replayed later.
+	if err := verifyAt(bots.key, rec.headers[0], rec.bodies[0], time.Now().Add(MaxTimestampSkew+time.Minute)); err != ErrStaleTimestamp {
+		t.Errorf("expected ErrStaleTimestamp for an old request, got %v", err)
+	}
+
+	statuses, _ := st.ListDeliveryStatuses()
+	if len(statuses) != 1 || statuses[0].Delivered != 2 || statuses[0].LastStatusCode != http.StatusOK {
+		t.Errorf("unexpected status %+v", statuses)
+	}
+	if counts, _ := st.CountDeliveries(); counts["bot1"] != 0 {
+		t.Errorf("expected empty queue, got %v", counts)
+	}
+}
+
+func TestDispatcherRetries(t *testing.T) {
+	st := newTestStore(t)
+	rec := &recorder{failures: 1}
+	srv := httptest.NewServer(rec)
+	defer srv.Close()
+
+	now := time.Unix(1_700_000_000, 0)
+	d := New(st, &fakeBots{urls: map[string]string{"bot1": srv.URL}}, Config{RetryBackoff: 10 * time.Second, MaxAttempts: 2})
+	d.now = func() time.Time { return now }
+
+	d.NotifyBot("bot1", models.Message{Seq: 1})
+	d.NotifyBot("bot1", models.Message{Seq: 2})
+	deliverAll(d)
+
+	// The first delivery failed; the second waits behind it to keep order.
+	if len(rec.events) != 0 {
+		t.Fatalf("expected no deliveries yet, got %+v", rec.events)
+	}
+	statuses, _ := st.ListDeliveryStatuses()
+	if len(statuses) != 1 || statuses[0].LastStatusCode != http.StatusServiceUnavailable || statuses[0].LastError == "" {
+		t.Errorf("expected failure to be recorded, got %+v", statuses)
+	}
+
+	// Not due yet.
+	deliverAll(d)
+	if len(rec.events) != 0 {
+		t.Fatalf("expected retry to wait for backoff, got %+v", rec.events)
+	}
+
+	now = now.Add(10 * time.Second)
+	deliverAll(d)
+	if len(rec.events) != 2 || rec.events[0].Message.Seq != 1 {
+		t.Fatalf("expected both messages after retry, got %+v", rec.events)
+	}
+
+	// Deliveries are dropped after MaxAttempts failures.
+	rec.failures = 2
+	d.NotifyBot("bot1", models.Message{Seq: 3})
+	deliverAll(d)
+	now = now.Add(time.Minute)
+	deliverAll(d)
+	if counts, _ := st.CountDeliveries(); counts["bot1"] != 0 {
+		t.Errorf("expected delivery to be dropped, got %v", counts)
+	}
+	statuses, _ = st.ListDeliveryStatuses()
+	if statuses[0].Dropped != 1 || statuses[0].Delivered != 2 {
+		t.Errorf("unexpected status %+v", statuses[0])
+	}
+}
+
+func TestDispatcherServesBotsConcurrently(t *testing.T) {
+	st := newTestStore(t)
+	release := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer slow.Close()
+	unblock := sync.OnceFunc(func() { close(release) })
+	defer unblock()
+	fast := &recorder{}
+	fastSrv := httptest.NewServer(fast)
+	defer fastSrv.Close()
+
+	d := New(st, &fakeBots{urls: map[string]string{"slowbot": slow.URL, "fastbot": fastSrv.URL}}, Config{})
+	d.NotifyBot("slowbot", models.Message{Seq: 1})
+	d.NotifyBot("fastbot", models.Message{Seq: 1})
+	d.deliverDue(context.Background())
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		fast.mu.Lock()
+		n := len(fast.events)
+		fast.mu.Unlock()
+		if n == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("fast bot was held up by the slow one")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// A bot already being served is not picked up twice.
+	d.NotifyBot("slowbot", models.Message{Seq: 2})
+	d.deliverDue(context.Background())
+	d.mu.Lock()
+	busy := d.busy["slowbot"]
+	d.mu.Unlock()
+	if !busy {
+		t.Error("expected the slow bot to still be served")
+	}
+
+	unblock()
+	d.wg.Wait()
+}
+
+func TestBackoff(t *testing.T) {
+	d := New(nil, nil, Config{RetryBackoff: time.Second, MaxBackoff: 5 * time.Second})
+	for attempts, want := range map[int]time.Duration{1: time.Second, 2: 2 * time.Second, 3: 4 * time.Second, 4: 5 * time.Second, 10: 5 * time.Second} {
+		if got := d.backoff(attempts); got != want {
+			t.Errorf("backoff(%d) = %v, want %v", attempts, got, want)
+		}
+	}
+}
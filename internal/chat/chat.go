@@ -2,16 +2,23 @@ package chat
 
 import (
 	"besedka/internal/models"
+	"errors"
 	"fmt"
 	"log/slog"
+	"slices"
+	"sort"
 	"sync"
+	"time"
 )
 
 type storage interface {
 	UpsertMessage(message models.Message) error
 	ListMessages(chatID string, from, to int64) ([]models.Message, error)
+	GetMessages(chatID string, seqs []int64) ([]models.Message, error)
 }
 
+var ErrNotAuthor = errors.New("only the author can change this message")
+
 type Seq int64
 
 type ChatRecord struct {
@@ -21,17 +28,82 @@ type ChatRecord struct {
 	Content          string
 	FormattedContent string
 	Attachments      []models.Attachment
+	EditedAt         int64
+	Revisions        []models.MessageRevision
+	Deleted          bool
+	Reactions        []models.Reaction
+	ReplyTo          *models.ReplyRef
+	Previews         []models.LinkPreview
+	Sender           *models.SenderOverride
+	// ExpiresAt is when a disappearing message expires, 0 if it does not.
+	ExpiresAt int64
+	// DisappearAfter is set on the announcement of a timer change.
+	DisappearAfter *int64
+}
+
+// expired reports whether the record is a disappearing message past its
+// expiry at now.
+func (r ChatRecord) expired(now int64) bool {
+	return r.ExpiresAt > 0 && r.ExpiresAt <= now
+}
+
+func (r ChatRecord) toMessage(chatID string) models.Message {
+	return models.Message{
+		Seq:            int64(r.Seq),
+		Timestamp:      r.Timestamp,
+		ChatID:         chatID,
+		UserID:         r.UserID,
+		Content:        r.Content,
+		Attachments:    r.Attachments,
+		EditedAt:       r.EditedAt,
+		Revisions:      r.Revisions,
+		Deleted:        r.Deleted,
+		Reactions:      r.Reactions,
+		ReplyTo:        r.ReplyTo,
+		Previews:       r.Previews,
+		Sender:         r.Sender,
+		ExpiresAt:      r.ExpiresAt,
+		DisappearAfter: r.DisappearAfter,
+	}
+}
+
+// RecordFromMessage converts a stored message into a chat record.
+// FormattedContent is left empty for the caller to fill in.
+func RecordFromMessage(m models.Message) ChatRecord {
+	return ChatRecord{
+		Seq:            Seq(m.Seq),
+		Timestamp:      m.Timestamp,
+		UserID:         m.UserID,
+		Content:        m.Content,
+		Attachments:    m.Attachments,
+		EditedAt:       m.EditedAt,
+		Revisions:      m.Revisions,
+		Deleted:        m.Deleted,
+		Reactions:      m.Reactions,
+		ReplyTo:        m.ReplyTo,
+		Previews:       m.Previews,
+		Sender:         m.Sender,
+		ExpiresAt:      m.ExpiresAt,
+		DisappearAfter: m.DisappearAfter,
+	}
 }
 
 type Chat struct {
 	ID         string
 	Name       string
+	IsGroup    bool
+	CreatedBy  string // Creator of a group chat
 	Records    []ChatRecord
 	Members    map[string]bool
 	FirstSeq   Seq
 	LastSeq    Seq
 	LastIndex  int
 	MaxRecords int
+	// MinSeq is the oldest seq retention kept, or 0 if nothing was trimmed.
+	MinSeq Seq
+	pins   []int64
+	// disappearAfter is the disappearing messages timer in seconds.
+	disappearAfter int64
 
 	RecordCallback func(receiverID string, chatID string, record ChatRecord)
 
@@ -41,6 +113,11 @@ type Chat struct {
 
 type Config struct {
 	ID             string
+	Name           string
+	IsGroup        bool
+	CreatedBy      string
+	Pins           []int64
+	DisappearAfter int64
 	MaxRecords     int
 	RecordCallback func(receiverID string, chatID string, record ChatRecord)
 	Storage        storage
@@ -49,7 +126,12 @@ type Config struct {
 func New(config Config) *Chat {
 	return &Chat{
 		ID:             config.ID,
+		Name:           config.Name,
+		IsGroup:        config.IsGroup,
+		CreatedBy:      config.CreatedBy,
 		MaxRecords:     config.MaxRecords,
+		pins:           config.Pins,
+		disappearAfter: config.DisappearAfter,
 		LastIndex:      -1,
 		FirstSeq:       0,
 		LastSeq:        0,
@@ -64,26 +146,24 @@ func New(config Config) *Chat {
 // - Updating FirstSeq and LastSeq
 // - Persisting into storage
 // - Sending updates to all connected clients
-func (c *Chat) AddRecord(record ChatRecord) error {
+// Records added while disappearing messages are on get an expiry time.
+// It returns the seq assigned to the record.
+func (c *Chat) AddRecord(record ChatRecord) (Seq, error) {
 	c.mux.Lock()
 
 	c.LastSeq++
 	record.Seq = c.LastSeq
+	if c.disappearAfter > 0 && record.ExpiresAt == 0 {
+		record.ExpiresAt = record.Timestamp + c.disappearAfter
+	}
 
 	// Persist
 	if c.storage != nil {
-		err := c.storage.UpsertMessage(models.Message{
-			Seq:         int64(record.Seq),
-			Timestamp:   record.Timestamp,
-			ChatID:      c.ID,
-			UserID:      record.UserID,
-			Content:     record.Content,
-			Attachments: record.Attachments,
-		})
+		err := c.storage.UpsertMessage(record.toMessage(c.ID))
 		if err != nil {
 			c.mux.Unlock()
 			slog.Error("failed to persist message", "chatID", c.ID, "error", err)
-			return fmt.Errorf("failed to persist message: %w", err)
+			return 0, fmt.Errorf("failed to persist message: %w", err)
 		}
 	}
 
@@ -115,7 +195,7 @@ func (c *Chat) AddRecord(record ChatRecord) error {
 			c.RecordCallback(receiverID, c.ID, record)
 		}
 	}
-	return nil
+	return record.Seq, nil
 }
 
 func (c *Chat) GetLastSeq() int64 {
@@ -124,6 +204,13 @@ func (c *Chat) GetLastSeq() int64 {
 	return int64(c.LastSeq)
 }
 
+// GetMinSeq returns the oldest seq retention kept, or 0 if nothing was trimmed.
+func (c *Chat) GetMinSeq() Seq {
+	c.mux.RLock()
+	defer c.mux.RUnlock()
+	return c.MinSeq
+}
+
 func (c *Chat) GetRecords(from, to Seq) ([]ChatRecord, error) {
 	c.mux.RLock()
 	defer c.mux.RUnlock()
@@ -139,6 +226,11 @@ func (c *Chat) GetRecords(from, to Seq) ([]ChatRecord, error) {
 		memFrom = c.LastSeq + 1 // Effectively empty
 	}
 
+	// Messages before MinSeq were deleted by retention
+	if from < c.MinSeq {
+		from = c.MinSeq
+	}
+
 	var result []ChatRecord
 
 	// 2. Fetch from storage if 'from' is before what we have in memory
@@ -154,13 +246,7 @@ func (c *Chat) GetRecords(from, to Seq) ([]ChatRecord, error) {
 		}
 
 		for _, m := range msgs {
-			result = append(result, ChatRecord{
-				Seq:         Seq(m.Seq),
-				Timestamp:   m.Timestamp,
-				UserID:      m.UserID,
-				Content:     m.Content,
-				Attachments: m.Attachments,
-			})
+			result = append(result, RecordFromMessage(m))
 		}
 	}
 
@@ -173,7 +259,7 @@ func (c *Chat) GetRecords(from, to Seq) ([]ChatRecord, error) {
 			mFrom = memFrom
 		}
 
-		if mFrom <= to && mFrom >= c.FirstSeq {
+		if mFrom <= to && mFrom >= c.FirstSeq && mFrom <= c.LastSeq {
 			// Memory fetch logic...
 			count := int(to - mFrom + 1)
 			
@@ -200,14 +286,14 @@ func (c *Chat) GetRecords(from, to Seq) ([]ChatRecord, error) {
 		}
 	}
 
-	return result, nil
+	return dropExpired(result), nil
 }
 
 func (c *Chat) GetLastRecords(count int) ([]ChatRecord, error) {
 	c.mux.RLock()
 	defer c.mux.RUnlock()
 
-	if c.LastSeq == 0 {
+	if c.LastSeq == 0 || len(c.Records) == 0 {
 		return []ChatRecord{}, nil
 	}
 
@@ -237,7 +323,173 @@ func (c *Chat) GetLastRecords(count int) ([]ChatRecord, error) {
 		copy(result[n1:], c.Records[:count-n1])
 	}
 
-	return result, nil
+	return dropExpired(result), nil
+}
+
+// GetRecordsAt returns the records with the given seqs in ascending seq order,
+// serving what it can from memory and loading the rest from storage at once.
+// Seqs that do not exist, were trimmed or expired are skipped.
+func (c *Chat) GetRecordsAt(seqs []Seq) ([]ChatRecord, error) {
+	c.mux.RLock()
+	defer c.mux.RUnlock()
+
+	var result []ChatRecord
+	var missing []int64
+	for _, seq := range seqs {
+		if seq < 1 || seq < c.MinSeq || seq > c.LastSeq {
+			continue
+		}
+		if idx := c.indexOf(seq); idx >= 0 {
+			result = append(result, c.Records[idx])
+		} else {
+			missing = append(missing, int64(seq))
+		}
+	}
+
+	if len(missing) > 0 && c.storage != nil {
+		msgs, err := c.storage.GetMessages(c.ID, missing)
+		if err != nil {
+			return nil, fmt.Errorf("storage error: %w", err)
+		}
+		for _, m := range msgs {
+			result = append(result, RecordFromMessage(m))
+		}
+	}
+
+	slices.SortFunc(result, func(a, b ChatRecord) int { return int(a.Seq - b.Seq) })
+	result = slices.CompactFunc(result, func(a, b ChatRecord) bool { return a.Seq == b.Seq })
+	return dropExpired(result), nil
+}
+
+// dropExpired removes the disappearing messages that expired from records,
+// which must not share its backing array with the ring buffer.
+func dropExpired(records []ChatRecord) []ChatRecord {
+	now := time.Now().Unix()
+	return slices.DeleteFunc(records, func(r ChatRecord) bool {
+		return r.expired(now)
+	})
+}
+
+// UpdateRecord applies update to the record with the given seq, persists it and
+// refreshes the ring buffer copy if the record is still in memory.
+// Records that were evicted from memory are loaded from storage.
+func (c *Chat) UpdateRecord(seq Seq, update func(r *ChatRecord) error) (ChatRecord, error) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	if seq < 1 || seq < c.MinSeq || seq > c.LastSeq {
+		return ChatRecord{}, models.ErrNotFound
+	}
+
+	idx := c.indexOf(seq)
+	var record ChatRecord
+	if idx >= 0 {
+		record = c.Records[idx]
+	} else {
+		if c.storage == nil {
+			return ChatRecord{}, models.ErrNotFound
+		}
+		msgs, err := c.storage.ListMessages(c.ID, int64(seq), int64(seq))
+		if err != nil {
+			return ChatRecord{}, fmt.Errorf("storage error: %w", err)
+		}
+		if len(msgs) == 0 {
+			return ChatRecord{}, models.ErrNotFound
+		}
+		record = RecordFromMessage(msgs[0])
+	}
+	if record.expired(time.Now().Unix()) {
+		return ChatRecord{}, models.ErrNotFound
+	}
+
+	if err := update(&record); err != nil {
+		return ChatRecord{}, err
+	}
+
+	if c.storage != nil {
+		if err := c.storage.UpsertMessage(record.toMessage(c.ID)); err != nil {
+			return ChatRecord{}, fmt.Errorf("failed to persist message: %w", err)
+		}
+	}
+
+	if idx >= 0 {
+		c.Records[idx] = record
+	}
+	return record, nil
+}
+
+// Trim drops the records before seq from memory and makes them unavailable
+// from storage too, so a record being deleted by retention can no longer be
+// read or updated. The ring buffer is rebuilt in order.
+func (c *Chat) Trim(before Seq) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	if before <= c.MinSeq {
+		return
+	}
+	c.MinSeq = before
+
+	head := 0
+	if len(c.Records) == c.MaxRecords {
+		head = (c.LastIndex + 1) % c.MaxRecords
+	}
+	kept := make([]ChatRecord, 0, len(c.Records))
+	for i := range c.Records {
+		r := c.Records[(head+i)%len(c.Records)]
+		if r.Seq >= before {
+			kept = append(kept, r)
+		}
+	}
+	c.Records = kept
+	c.LastIndex = len(kept) - 1
+	c.FirstSeq = 0
+	if len(kept) > 0 {
+		c.FirstSeq = kept[0].Seq
+	}
+}
+
+// Expire drops the content of the given disappearing messages from memory.
+// Their seqs stay in the ring buffer as empty records, which reads skip.
+func (c *Chat) Expire(seqs []Seq) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	for _, seq := range seqs {
+		if idx := c.indexOf(seq); idx >= 0 {
+			r := c.Records[idx]
+			c.Records[idx] = ChatRecord{Seq: r.Seq, Timestamp: r.Timestamp, ExpiresAt: r.ExpiresAt}
+		}
+	}
+}
+
+// GetDisappearAfter returns the disappearing messages timer in seconds, 0
+// when it is off.
+func (c *Chat) GetDisappearAfter() int64 {
+	c.mux.RLock()
+	defer c.mux.RUnlock()
+	return c.disappearAfter
+}
+
+// SetDisappearAfter sets the disappearing messages timer for records added
+// from now on.
+func (c *Chat) SetDisappearAfter(seconds int64) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	c.disappearAfter = seconds
+}
+
+// indexOf returns the ring buffer index of seq, or -1 if it is not in memory.
+// c.mux must be held.
+func (c *Chat) indexOf(seq Seq) int {
+	if len(c.Records) == 0 || seq < c.FirstSeq || seq > c.LastSeq {
+		return -1
+	}
+	head := 0
+	if len(c.Records) == c.MaxRecords {
+		head = (c.LastIndex + 1) % c.MaxRecords
+	}
+	return (head + int(seq-c.FirstSeq)) % len(c.Records)
 }
 
 func (c *Chat) addMember(userID string, online bool) {
@@ -258,3 +510,55 @@ func (c *Chat) Join(userID string) {
 func (c *Chat) Leave(userID string) {
 	c.addMember(userID, false)
 }
+
+// HasMember reports whether userID is in the chat's member list.
+func (c *Chat) HasMember(userID string) bool {
+	c.mux.RLock()
+	defer c.mux.RUnlock()
+	_, ok := c.Members[userID]
+	return ok
+}
+
+// RemoveMember drops userID from the member list so it no longer receives records.
+func (c *Chat) RemoveMember(userID string) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	delete(c.Members, userID)
+}
+
+// MemberIDs returns the sorted IDs of all chat members.
+func (c *Chat) MemberIDs() []string {
+	c.mux.RLock()
+	defer c.mux.RUnlock()
+	ids := make([]string, 0, len(c.Members))
+	for id := range c.Members {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func (c *Chat) GetName() string {
+	c.mux.RLock()
+	defer c.mux.RUnlock()
+	return c.Name
+}
+
+func (c *Chat) SetName(name string) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	c.Name = name
+}
+
+// GetPins returns the seqs of pinned messages, most recently pinned first.
+func (c *Chat) GetPins() []int64 {
+	c.mux.RLock()
+	defer c.mux.RUnlock()
+	return slices.Clone(c.pins)
+}
+
+func (c *Chat) SetPins(pins []int64) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	c.pins = slices.Clone(pins)
+}
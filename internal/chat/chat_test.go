@@ -3,7 +3,9 @@ package chat
 import (
 	"besedka/internal/models"
 	"fmt"
+	"slices"
 	"testing"
+	"time"
 )
 
 func TestNew(t *testing.T) {
@@ -26,7 +28,7 @@ func TestChat_AddRecord_NoWrap(t *testing.T) {
 	c.RecordCallback = func(id string, chatID string, r ChatRecord) {}
 
 	for i := 0; i < 5; i++ {
-		if err := c.AddRecord(ChatRecord{UserID: "user", Content: fmt.Sprintf("msg %d", i)}); err != nil {
+		if _, err := c.AddRecord(ChatRecord{UserID: "user", Content: fmt.Sprintf("msg %d", i)}); err != nil {
 			t.Errorf("AddRecord failed: %v", err)
 		}
 	}
@@ -46,6 +48,15 @@ func TestChat_AddRecord_NoWrap(t *testing.T) {
 	if recs[1].Content != "msg 4" {
 		t.Errorf("expected last msg 'msg 4', got '%s'", recs[1].Content)
 	}
+
+	// Ranges past the last record are empty rather than out of bounds.
+	recs, err = c.GetRecords(7, 7)
+	if err != nil {
+		t.Fatalf("GetRecords failed: %v", err)
+	}
+	if len(recs) != 0 {
+		t.Errorf("expected no records past LastSeq, got %d", len(recs))
+	}
 }
 
 func TestChat_AddRecord_Wrap(t *testing.T) {
@@ -57,13 +68,13 @@ func TestChat_AddRecord_Wrap(t *testing.T) {
 
 	// Add 3 records (full)
 	for i := 0; i < 3; i++ {
-		if err := c.AddRecord(ChatRecord{UserID: "user", Content: fmt.Sprintf("msg %d", i)}); err != nil {
+		if _, err := c.AddRecord(ChatRecord{UserID: "user", Content: fmt.Sprintf("msg %d", i)}); err != nil {
 			t.Errorf("AddRecord failed: %v", err)
 		}
 	}
 
 	// Add 1 more (wrap)
-	if err := c.AddRecord(ChatRecord{UserID: "user", Content: "msg 3"}); err != nil {
+	if _, err := c.AddRecord(ChatRecord{UserID: "user", Content: "msg 3"}); err != nil {
 		t.Errorf("AddRecord failed: %v", err)
 	}
 
@@ -113,7 +124,7 @@ func TestChat_Callback(t *testing.T) {
 	}
 
 	msg := ChatRecord{UserID: "sender", Content: "hello"}
-	if err := c.AddRecord(msg); err != nil {
+	if _, err := c.AddRecord(msg); err != nil {
 		t.Errorf("AddRecord failed: %v", err)
 	}
 
@@ -144,12 +155,14 @@ func NewMockStorage() *MockStorage {
 }
 
 func (m *MockStorage) UpsertMessage(msg models.Message) error {
-	m.messages[msg.ChatID] = append(m.messages[msg.ChatID], ChatRecord{
-		Seq:       Seq(msg.Seq),
-		Timestamp: msg.Timestamp,
-		UserID:    msg.UserID,
-		Content:   msg.Content,
-	})
+	rec := RecordFromMessage(msg)
+	for i, r := range m.messages[msg.ChatID] {
+		if r.Seq == rec.Seq {
+			m.messages[msg.ChatID][i] = rec
+			return nil
+		}
+	}
+	m.messages[msg.ChatID] = append(m.messages[msg.ChatID], rec)
 	return nil
 }
 
@@ -158,19 +171,23 @@ func (m *MockStorage) ListMessages(chatID string, from, to int64) ([]models.Mess
 	if msgs, ok := m.messages[chatID]; ok {
 		for _, r := range msgs {
 			if int64(r.Seq) >= from && int64(r.Seq) <= to {
-				results = append(results, models.Message{
-					Seq:       int64(r.Seq),
-					Timestamp: r.Timestamp,
-					ChatID:    chatID,
-					UserID:    r.UserID,
-					Content:   r.Content,
-				})
+				results = append(results, r.toMessage(chatID))
 			}
 		}
 	}
 	return results, nil
 }
 
+func (m *MockStorage) GetMessages(chatID string, seqs []int64) ([]models.Message, error) {
+	var results []models.Message
+	for _, r := range m.messages[chatID] {
+		if slices.Contains(seqs, int64(r.Seq)) {
+			results = append(results, r.toMessage(chatID))
+		}
+	}
+	return results, nil
+}
+
 func TestChat_Persistence(t *testing.T) {
 	store := NewMockStorage()
 	c := New(Config{
@@ -182,7 +199,7 @@ func TestChat_Persistence(t *testing.T) {
 	// Add 10 records. MaxRecords is 5.
 	// So 5 should be in memory, all 10 in storage.
 	for i := 1; i <= 10; i++ {
-		if err := c.AddRecord(ChatRecord{
+		if _, err := c.AddRecord(ChatRecord{
 			UserID:  "user",
 			Content: fmt.Sprintf("msg %d", i),
 		}); err != nil {
@@ -241,3 +258,170 @@ func TestChat_Persistence(t *testing.T) {
 	}
 
 }
+
+func TestChat_UpdateRecord(t *testing.T) {
+	store := NewMockStorage()
+	c := New(Config{ID: "chat_update", MaxRecords: 2, Storage: store})
+
+	for i := 1; i <= 3; i++ {
+		if _, err := c.AddRecord(ChatRecord{UserID: "user", Content: fmt.Sprintf("msg %d", i)}); err != nil {
+			t.Fatalf("AddRecord failed: %v", err)
+		}
+	}
+
+	setContent := func(content string) func(r *ChatRecord) error {
+		return func(r *ChatRecord) error {
+			r.Content = content
+			return nil
+		}
+	}
+
+	// Seq 3 is in memory.
+	if _, err := c.UpdateRecord(3, setContent("edited 3")); err != nil {
+		t.Fatalf("UpdateRecord in memory failed: %v", err)
+	}
+	// Seq 1 was evicted and must be loaded from storage.
+	if _, err := c.UpdateRecord(1, setContent("edited 1")); err != nil {
+		t.Fatalf("UpdateRecord from storage failed: %v", err)
+	}
+	if _, err := c.UpdateRecord(4, setContent("nope")); err != models.ErrNotFound {
+		t.Errorf("expected ErrNotFound for unknown seq, got %v", err)
+	}
+	if _, err := c.UpdateRecord(2, func(r *ChatRecord) error { return ErrNotAuthor }); err != ErrNotAuthor {
+		t.Errorf("expected update error to be returned, got %v", err)
+	}
+
+	recs, err := c.GetRecords(1, 3)
+	if err != nil {
+		t.Fatalf("GetRecords failed: %v", err)
+	}
+	expected := []string{"edited 1", "msg 2", "edited 3"}
+	for i, exp := range expected {
+		if recs[i].Content != exp {
+			t.Errorf("index %d: expected %q, got %q", i, exp, recs[i].Content)
+		}
+	}
+	if got := store.messages["chat_update"][2].Content; got != "edited 3" {
+		t.Errorf("expected edit to be persisted, got %q", got)
+	}
+}
+
+func TestChat_GetRecordsAt(t *testing.T) {
+	store := NewMockStorage()
+	c := New(Config{ID: "chat_at", MaxRecords: 3, Storage: store})
+
+	// Seqs 4..6 are in memory, 1..3 only in storage.
+	for i := 1; i <= 6; i++ {
+		if _, err := c.AddRecord(ChatRecord{UserID: "user", Content: fmt.Sprintf("msg %d", i)}); err != nil {
+			t.Fatalf("AddRecord failed: %v", err)
+		}
+	}
+
+	recs, err := c.GetRecordsAt([]Seq{5, 2, 9, 1, 5, 6})
+	if err != nil {
+		t.Fatalf("GetRecordsAt failed: %v", err)
+	}
+	expected := []string{"msg 1", "msg 2", "msg 5", "msg 6"}
+	if len(recs) != len(expected) {
+		t.Fatalf("expected %d records, got %+v", len(expected), recs)
+	}
+	for i, exp := range expected {
+		if recs[i].Content != exp {
+			t.Errorf("index %d: expected %q, got %q", i, exp, recs[i].Content)
+		}
+	}
+
+	c.Trim(2)
+	if recs, _ := c.GetRecordsAt([]Seq{1, 2}); len(recs) != 1 || recs[0].Seq != 2 {
+		t.Errorf("expected only seq 2 after trim, got %+v", recs)
+	}
+}
+
+func TestChat_Trim(t *testing.T) {
+	store := NewMockStorage()
+	c := New(Config{ID: "chat_trim", MaxRecords: 3, Storage: store})
+
+	// Seqs 3..5 are in memory, wrapped around the ring buffer.
+	for i := 1; i <= 5; i++ {
+		if _, err := c.AddRecord(ChatRecord{UserID: "user", Content: fmt.Sprintf("msg %d", i)}); err != nil {
+			t.Fatalf("AddRecord failed: %v", err)
+		}
+	}
+
+	c.Trim(4)
+	recs, err := c.GetRecords(1, 5)
+	if err != nil {
+		t.Fatalf("GetRecords failed: %v", err)
+	}
+	if len(recs) != 2 || recs[0].Seq != 4 || recs[1].Seq != 5 {
+		t.Errorf("expected seqs 4 and 5, got %+v", recs)
+	}
+	if _, err := c.UpdateRecord(2, func(r *ChatRecord) error { return nil }); err != models.ErrNotFound {
+		t.Errorf("expected ErrNotFound for a trimmed seq, got %v", err)
+	}
+
+	// New records keep filling the ring buffer after a trim.
+	for i := 6; i <= 7; i++ {
+		if _, err := c.AddRecord(ChatRecord{UserID: "user", Content: fmt.Sprintf("msg %d", i)}); err != nil {
+			t.Fatalf("AddRecord failed: %v", err)
+		}
+	}
+	recs, err = c.GetLastRecords(3)
+	if err != nil {
+		t.Fatalf("GetLastRecords failed: %v", err)
+	}
+	expected := []string{"msg 5", "msg 6", "msg 7"}
+	for i, exp := range expected {
+		if recs[i].Content != exp {
+			t.Errorf("index %d: expected %q, got %q", i, exp, recs[i].Content)
+		}
+	}
+
+	// Trimming everything leaves an empty chat that still counts seqs.
+	c.Trim(8)
+	if recs, _ := c.GetLastRecords(3); len(recs) != 0 {
+		t.Errorf("expected no records, got %+v", recs)
+	}
+	if seq, err := c.AddRecord(ChatRecord{UserID: "user", Content: "msg 8"}); err != nil || seq != 8 {
+		t.Errorf("expected seq 8, got %d %v", seq, err)
+	}
+}
+
+func TestChat_Disappearing(t *testing.T) {
+	store := NewMockStorage()
+	c := New(Config{ID: "dm_a_b", MaxRecords: 10, DisappearAfter: 3600, Storage: store})
+
+	now := time.Now().Unix()
+	// The first record was sent two hours ago, so it has expired.
+	for _, ts := range []int64{now - 7200, now, now} {
+		if _, err := c.AddRecord(ChatRecord{UserID: "a", Content: "hi", Timestamp: ts}); err != nil {
+			t.Fatalf("AddRecord failed: %v", err)
+		}
+	}
+	c.SetDisappearAfter(0)
+	if _, err := c.AddRecord(ChatRecord{UserID: "a", Content: "kept", Timestamp: now}); err != nil {
+		t.Fatalf("AddRecord failed: %v", err)
+	}
+
+	recs, err := c.GetRecords(1, 4)
+	if err != nil {
+		t.Fatalf("GetRecords failed: %v", err)
+	}
+	if len(recs) != 3 || recs[0].Seq != 2 || recs[0].ExpiresAt != now+3600 || recs[2].ExpiresAt != 0 {
+		t.Errorf("expected seqs 2 to 4 with seq 4 not expiring, got %+v", recs)
+	}
+	if recs, _ := c.GetLastRecords(10); len(recs) != 3 {
+		t.Errorf("expected the expired record to be skipped, got %+v", recs)
+	}
+	if _, err := c.UpdateRecord(1, func(r *ChatRecord) error { return nil }); err != models.ErrNotFound {
+		t.Errorf("expected ErrNotFound for an expired record, got %v", err)
+	}
+	if store.messages["dm_a_b"][1].ExpiresAt != now+3600 {
+		t.Errorf("expected the expiry to be persisted, got %+v", store.messages["dm_a_b"][1])
+	}
+
+	c.Expire([]Seq{1, 2})
+	if c.Records[1].Content != "" || c.Records[1].Seq != 2 {
+		t.Errorf("expected the content of seq 2 to be dropped, got %+v", c.Records[1])
+	}
+}
@@ -0,0 +1,48 @@
+package commands
+
+import (
+	"besedka/internal/api"
+	"besedka/internal/config"
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+)
+
+// AddAdmin creates another admin account, prompting for its initial
+// password, and prints its TOTP secret to hand over.
+func AddAdmin(username string, cfg *config.Config) error {
+	if username == "" {
+		return errors.New("admin username is required")
+	}
+	password, err := readNewPassword(bufio.NewReader(stdin), os.Stdout)
+	if err != nil {
+		return err
+	}
+
+	resp, err := adminRequest(cfg, http.MethodPost, "/api/admins", api.AdminCredentialsRequest{
+		Username: username,
+		Password: password,
+	})
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	if resp.StatusCode != http.StatusOK {
+		return httpError("add admin", resp)
+	}
+
+	var result api.AddAdminResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	fmt.Printf("\nAdmin %s created.\n", result.Admin.Username)
+	printTOTPSecret(os.Stdout, cfg, result.Admin.Username, result.TOTPSecret)
+	return nil
+}
@@ -10,29 +10,25 @@ import (
 	"strings"
 )
 
-func AddUser(username, displayName, userType, botPermissionsStr, target string, cfg *config.Config) error {
-	perms := models.BotPermissions{}
-	if botPermissionsStr != "" {
-		for _, p := range strings.Split(botPermissionsStr, ",") {
-			p = strings.TrimSpace(p)
-			switch p {
-			case "read_mentions":
-				perms.ReadMentions = true
-			case "read_all":
-				perms.ReadAll = true
-			case "write":
-				perms.Write = true
-			}
-		}
-	}
-
+func AddUser(username, displayName, userType, botPermissionsStr, scopesStr, target string, cfg *config.Config) error {
 	req := api.AddUserRequest{
 		Username:       username,
 		DisplayName:    displayName,
 		Type:           userType,
-		BotPermissions: perms,
+		BotPermissions: parseBotPermissions(botPermissionsStr),
 		Target:         target,
 	}
+	if scopesStr != "" {
+		if userType != string(models.UserTypeBot) {
+			return fmt.Errorf("--scopes only applies to bots")
+		}
+		scopes, err := parseScopes(scopesStr)
+		if err != nil {
+			return err
+		}
+		req.Scopes = scopes
+		req.BotPermissions = models.BotPermissions{}
+	}
 
 	resp, err := adminRequest(cfg, http.MethodPost, "/admin/users", req)
 	if err != nil {
@@ -62,3 +58,41 @@ func AddUser(username, displayName, userType, botPermissionsStr, target string,
 	}
 	return nil
 }
+
+func parseBotPermissions(s string) models.BotPermissions {
+	perms := models.BotPermissions{}
+	if s != "" {
+		for _, p := range strings.Split(s, ",") {
+			p = strings.TrimSpace(p)
+			switch p {
+			case "read_mentions":
+				perms.ReadMentions = true
+			case "read_all":
+				perms.ReadAll = true
+			case "write":
+				perms.Write = true
+			}
+		}
+	}
+	return perms
+}
+
+// parseScopes parses "chat:perm,perm;chat2:perm", e.g.
+// "townhall:read_mentions;<group id>:read_all,write". "none" grants no chats.
+func parseScopes(s string) ([]models.ChatScope, error) {
+	scopes := []models.ChatScope{}
+	if s == "none" {
+		return scopes, nil
+	}
+	for _, spec := range strings.Split(s, ";") {
+		chatID, perms, ok := strings.Cut(strings.TrimSpace(spec), ":")
+		if !ok || chatID == "" {
+			return nil, fmt.Errorf("invalid scope %q, expected <chat id>:<permissions>", spec)
+		}
+		scopes = append(scopes, models.ChatScope{
+			ChatID:         chatID,
+			BotPermissions: parseBotPermissions(perms),
+		})
+	}
+	return scopes, nil
+}
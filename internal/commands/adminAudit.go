@@ -0,0 +1,67 @@
+package commands
+
+import (
+	"besedka/internal/api"
+	"besedka/internal/config"
+	"besedka/internal/models"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"text/tabwriter"
+)
+
+// AdminAudit prints the newest entries of the admin audit log, only those of
+// one admin when adminName is set.
+func AdminAudit(adminName string, cfg *config.Config) error {
+	query := url.Values{}
+	if adminName != "" {
+		adminID, err := resolveAdminID(cfg, adminName)
+		if err != nil {
+			return err
+		}
+		query.Set("admin", adminID)
+	}
+
+	resp, err := adminRequest(cfg, http.MethodGet, "/api/admins/audit?"+query.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	if resp.StatusCode != http.StatusOK {
+		return httpError("list audit log", resp)
+	}
+
+	var result api.AdminAuditResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	printAudit(os.Stdout, result.Entries)
+	return nil
+}
+
+// printAudit renders audit log entries as an aligned table.
+func printAudit(w io.Writer, entries []models.AdminAuditEntry) {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	_, _ = fmt.Fprintln(tw, "TIME\tADMIN\tIP\tSTATUS\tACTION")
+	for _, e := range entries {
+		name, ip := e.AdminName, e.IP
+		if name == "" {
+			name = "-"
+		}
+		if ip == "" {
+			ip = "-"
+		}
+		_, _ = fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t%s\n", formatUnix(e.Time, "-"), name, ip, e.Status, e.Action)
+	}
+	_ = tw.Flush()
+	if len(entries) == 0 {
+		_, _ = fmt.Fprintln(w, "(no entries)")
+	}
+}
@@ -0,0 +1,64 @@
+package commands
+
+import (
+	"besedka/internal/api"
+	"besedka/internal/auth"
+	"besedka/internal/config"
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// AdminLogin logs the CLI in as an admin, prompting for the password and
+// TOTP code, and saves the token for later commands.
+func AdminLogin(username string, cfg *config.Config) error {
+	if username == "" {
+		return errors.New("admin username is required")
+	}
+	in := bufio.NewReader(stdin)
+	password, err := prompt(in, os.Stdout, "Password: ")
+	if err != nil {
+		return err
+	}
+	code, err := prompt(in, os.Stdout, "TOTP code: ")
+	if err != nil {
+		return err
+	}
+	totp, err := strconv.Atoi(strings.TrimSpace(code))
+	if err != nil {
+		return errors.New("TOTP code must be a number")
+	}
+
+	resp, err := adminRequest(cfg, http.MethodPost, "/api/admins/login", auth.AdminLoginRequest{
+		Username: username,
+		Password: password,
+		TOTP:     totp,
+	})
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	if resp.StatusCode != http.StatusOK {
+		return httpError("log in", resp)
+	}
+
+	var result api.AdminLoginResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	if err := saveAdminToken(cfg, result.Token); err != nil {
+		return err
+	}
+
+	fmt.Printf("Logged in as %s until %s.\n", username, time.Unix(result.TokenExpiry, 0).UTC().Format(time.RFC3339))
+	return nil
+}
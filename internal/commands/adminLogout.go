@@ -0,0 +1,34 @@
+package commands
+
+import (
+	"besedka/internal/config"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+)
+
+// AdminLogout invalidates the saved admin token and removes it.
+func AdminLogout(cfg *config.Config) error {
+	resp, err := adminRequest(cfg, http.MethodPost, "/api/admins/logout", nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	// An expired token can't be invalidated, but is removed all the same.
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusUnauthorized {
+		return httpError("log out", resp)
+	}
+	if cfg.AdminTokenFile != "" {
+		if err := os.Remove(cfg.AdminTokenFile); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("failed to remove admin token: %w", err)
+		}
+	}
+
+	fmt.Println("Logged out.")
+	return nil
+}
@@ -0,0 +1,65 @@
+package commands
+
+import (
+	"besedka/internal/api"
+	"besedka/internal/config"
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// BootstrapAdmin creates the first admin account, prompting for its password.
+// It needs the one-time bootstrap token the server prints to its log, taken
+// from ADMIN_BOOTSTRAP_TOKEN or prompted for, and only works while there are
+// no admins. The new admin is logged in right away.
+func BootstrapAdmin(username string, cfg *config.Config) error {
+	if username == "" {
+		return errors.New("admin username is required")
+	}
+	r := bufio.NewReader(stdin)
+	bootstrapToken := cfg.AdminBootstrapToken
+	if bootstrapToken == "" {
+		var err error
+		if bootstrapToken, err = prompt(r, os.Stdout, "Bootstrap token (from the server log): "); err != nil {
+			return err
+		}
+	}
+	password, err := readNewPassword(r, os.Stdout)
+	if err != nil {
+		return err
+	}
+
+	resp, err := adminRequest(cfg, http.MethodPost, "/api/admins/bootstrap", api.BootstrapAdminRequest{
+		AdminCredentialsRequest: api.AdminCredentialsRequest{
+			Username: username,
+			Password: password,
+		},
+		BootstrapToken: strings.TrimSpace(bootstrapToken),
+	})
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	if resp.StatusCode != http.StatusOK {
+		return httpError("bootstrap admin", resp)
+	}
+
+	var result api.BootstrapAdminResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	if err := saveAdminToken(cfg, result.Token); err != nil {
+		return err
+	}
+
+	fmt.Printf("\nAdmin %s created and logged in.\n", result.Admin.Username)
+	printTOTPSecret(os.Stdout, cfg, result.Admin.Username, result.TOTPSecret)
+	return nil
+}
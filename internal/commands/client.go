@@ -1,7 +1,10 @@
 // Package commands implements the CLI subcommands that drive the running
-// server's Basic-Auth-protected admin API (add/list/delete/reset users, trigger
-// an out-of-schedule backup, and graceful shutdown). Every command talks to the
-// server over HTTP at cfg.AdminAddr, so the server must be running.
+// server's admin API (add/list/delete/reset users, manage admin accounts,
+// trigger an out-of-schedule backup, and graceful shutdown). Every command
+// talks to the server over HTTP at cfg.AdminAddr, so the server must be
+// running. Requests are authenticated with an admin token from --admin-login
+// or --bootstrap-admin, or from ADMIN_TOKEN. The exceptions are Rekey and DB,
+// which work on the database file offline while the server is stopped.
 package commands
 
 import (
@@ -10,12 +13,19 @@ import (
 	"bufio"
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"net/http"
+	"net/url"
+	"os"
 	"strings"
 )
 
+// stdin is where prompts read answers and passwords from.
+var stdin io.Reader = os.Stdin
+
 // httpClient is used for all admin API calls. It has no timeout on purpose:
 // backup and shutdown can block while a snapshot is uploaded to object storage.
 var httpClient = &http.Client{}
@@ -41,7 +51,9 @@ func adminRequest(cfg *config.Config, method, path string, body any) (*http.Resp
 	if body != nil {
 		req.Header.Set("Content-Type", "application/json")
 	}
-	req.SetBasicAuth(cfg.AdminUser, cfg.AdminPassword)
+	if err := setAdminToken(cfg, req); err != nil {
+		return nil, err
+	}
 
 	resp, err := httpClient.Do(req)
 	if err != nil {
@@ -50,6 +62,49 @@ func adminRequest(cfg *config.Config, method, path string, body any) (*http.Resp
 	return resp, nil
 }
 
+// adminToken returns the admin token to authenticate with: ADMIN_TOKEN if
+// set, else the one saved by --admin-login. An empty token means none.
+func adminToken(cfg *config.Config) (string, error) {
+	if cfg.AdminToken != "" {
+		return cfg.AdminToken, nil
+	}
+	if cfg.AdminTokenFile == "" {
+		return "", nil
+	}
+	data, err := os.ReadFile(cfg.AdminTokenFile)
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to read admin token: %w", err)
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// setAdminToken authenticates a request to the admin API.
+func setAdminToken(cfg *config.Config, req *http.Request) error {
+	token, err := adminToken(cfg)
+	if err != nil {
+		return err
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	return nil
+}
+
+// saveAdminToken stores a token for later commands, readable by the current
+// OS user only.
+func saveAdminToken(cfg *config.Config, token string) error {
+	if cfg.AdminTokenFile == "" {
+		return nil
+	}
+	if err := os.WriteFile(cfg.AdminTokenFile, []byte(token+"\n"), 0600); err != nil {
+		return fmt.Errorf("failed to save admin token: %w", err)
+	}
+	return nil
+}
+
 // httpError reads the response body and returns a formatted error for a
 // non-success status code. When the body is a JSON APIResponse its Message is
 // surfaced; otherwise the raw body is used.
@@ -60,6 +115,9 @@ func httpError(action string, resp *http.Response) error {
 	if json.Unmarshal(body, &apiResp) == nil && apiResp.Message != "" {
 		msg = apiResp.Message
 	}
+	if resp.StatusCode == http.StatusUnauthorized {
+		msg += ". Log in with --admin-login"
+	}
 	return fmt.Errorf("failed to %s (status %d): %s", action, resp.StatusCode, msg)
 }
 
@@ -99,6 +157,58 @@ func resolveUserID(cfg *config.Config, username string) (string, error) {
 	}
 }
 
+// prompt prints label to w and reads one line from r, without the line break.
+// Input is echoed, so pipe secrets in when the terminal is shared.
+func prompt(r *bufio.Reader, w io.Writer, label string) (string, error) {
+	_, _ = fmt.Fprint(w, label)
+	line, err := r.ReadString('\n')
+	if err != nil && (err != io.EOF || line == "") {
+		return "", fmt.Errorf("failed to read %s: %w", strings.TrimRight(strings.ToLower(label), ": "), err)
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// readNewPassword asks for a password twice and returns it if both match.
+func readNewPassword(r *bufio.Reader, w io.Writer) (string, error) {
+	password, err := prompt(r, w, "Password: ")
+	if err != nil {
+		return "", err
+	}
+	repeated, err := prompt(r, w, "Repeat password: ")
+	if err != nil {
+		return "", err
+	}
+	if password != repeated {
+		return "", errors.New("passwords do not match")
+	}
+	return password, nil
+}
+
+// printTOTPSecret shows the TOTP secret of an admin with the otpauth URI
+// authenticator apps accept.
+func printTOTPSecret(w io.Writer, cfg *config.Config, username, secret string) {
+	issuer := cfg.ChatName + " Admin"
+	uri := fmt.Sprintf("otpauth://totp/%s?secret=%s&issuer=%s",
+		url.PathEscape(issuer+":"+username), secret, url.QueryEscape(issuer))
+	_, _ = fmt.Fprintf(w, "TOTP secret: %s\n%s\n", secret, uri)
+	_, _ = fmt.Fprintln(w, "Add it to an authenticator app now: it is needed to log in and is not shown again.")
+}
+
+// resolveAdminID looks up the ID of an admin account by username via
+// GET /api/admins.
+func resolveAdminID(cfg *config.Config, username string) (string, error) {
+	admins, err := listAdmins(cfg)
+	if err != nil {
+		return "", err
+	}
+	for _, a := range admins {
+		if a.Username == username {
+			return a.ID, nil
+		}
+	}
+	return "", fmt.Errorf("no admin found with username %q", username)
+}
+
 // confirm prints prompt to w and reads a yes/no answer from r. Only "y" or
 // "yes" (case-insensitive) count as confirmation; anything else, including an
 // empty line, is treated as no.
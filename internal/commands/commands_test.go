@@ -1,35 +1,39 @@
 package commands
 
 import (
+	"besedka/internal/api"
 	"besedka/internal/config"
+	"besedka/internal/filestore"
 	"besedka/internal/models"
+	"besedka/internal/storage"
+	"context"
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 )
 
 // testServer spins up an httptest server with the given handler and returns a
-// config pointing the CLI commands at it with fixed admin credentials.
+// config pointing the CLI commands at it with a fixed admin token.
 func testServer(t *testing.T, handler http.HandlerFunc) (*config.Config, *httptest.Server) {
 	t.Helper()
 	ts := httptest.NewServer(handler)
 	t.Cleanup(ts.Close)
 	cfg := &config.Config{
-		AdminAddr:     strings.TrimPrefix(ts.URL, "http://"),
-		AdminUser:     "admin",
-		AdminPassword: "secret",
+		AdminAddr:  strings.TrimPrefix(ts.URL, "http://"),
+		AdminToken: "secret",
 	}
 	return cfg, ts
 }
 
-// requireAuth fails the request unless it carries the expected basic auth.
+// requireAuth fails the request unless it carries the expected admin token.
 func requireAuth(t *testing.T, w http.ResponseWriter, r *http.Request) bool {
 	t.Helper()
-	user, pass, ok := r.BasicAuth()
-	if !ok || user != "admin" || pass != "secret" {
+	if r.Header.Get("Authorization") != "Bearer secret" {
 		w.WriteHeader(http.StatusUnauthorized)
 		return false
 	}
@@ -337,3 +341,576 @@ func TestSetAvatar(t *testing.T) {
 	})
 }
 
+
+func TestExport(t *testing.T) {
+	users := []models.User{
+		{ID: "u1", UserName: "alice", Status: models.UserStatusActive},
+	}
+	cfg, _ := testServer(t, func(w http.ResponseWriter, r *http.Request) {
+		if !requireAuth(t, w, r) {
+			return
+		}
+		if r.Method == http.MethodGet && r.URL.Path == "/api/users" {
+			writeUsers(w, users)
+			return
+		}
+		if r.Method == http.MethodGet && r.URL.Path == "/api/export" {
+			q := r.URL.Query()
+			if q.Get("chatId") != "townhall" || q.Get("userId") != "u1" || q.Get("format") != "html" {
+				t.Errorf("unexpected query %q", r.URL.RawQuery)
+			}
+			_, _ = w.Write([]byte("zip-bytes"))
+			return
+		}
+		t.Fatalf("unexpected request: %s %s", r.Method, r.URL.Path)
+	})
+
+	if err := Export("townhall", "", "html", "", cfg); err == nil {
+		t.Error("expected error without --user")
+	}
+	if err := Export("townhall", "alice", "pdf", "", cfg); err == nil {
+		t.Error("expected error for unknown format")
+	}
+
+	out := t.TempDir() + "/export.zip"
+	if err := Export("townhall", "alice", "html", out, cfg); err != nil {
+		t.Fatalf("Export failed: %v", err)
+	}
+	data, err := os.ReadFile(out)
+	if err != nil || string(data) != "zip-bytes" {
+		t.Errorf("got %q err=%v, want exported body", data, err)
+	}
+}
+
+func TestSetCallbackURL(t *testing.T) {
+	users := []models.User{
+		{ID: "b1", UserName: "hookbot", Status: models.UserStatusActive, Type: models.UserTypeBot},
+	}
+	var gotURL *string
+	cfg, _ := testServer(t, func(w http.ResponseWriter, r *http.Request) {
+		if !requireAuth(t, w, r) {
+			return
+		}
+		if r.Method == http.MethodGet && r.URL.Path == "/api/users" {
+			writeUsers(w, users)
+			return
+		}
+		if r.Method == http.MethodPost && r.URL.Path == "/api/users/callback-url" {
+			if r.URL.Query().Get("id") != "b1" {
+				t.Errorf("got id=%q, want b1", r.URL.Query().Get("id"))
+			}
+			var req struct {
+				URL string `json:"url"`
+			}
+			_ = json.NewDecoder(r.Body).Decode(&req)
+			gotURL = &req.URL
+			w.Header().Set("Content-Type", "application/json")
+			_ = json.NewEncoder(w).Encode(models.APIResponse{Success: true, Message: "Callback URL set"})
+			return
+		}
+		t.Fatalf("unexpected request: %s %s", r.Method, r.URL.Path)
+	})
+
+	if err := SetCallbackURL("https://bot.example.com/hook", "", cfg); err == nil {
+		t.Error("expected error without --user")
+	}
+
+	if err := SetCallbackURL("https://bot.example.com/hook", "hookbot", cfg); err != nil {
+		t.Fatalf("SetCallbackURL failed: %v", err)
+	}
+	if gotURL == nil || *gotURL != "https://bot.example.com/hook" {
+		t.Errorf("unexpected URL sent: %v", gotURL)
+	}
+
+	// "none" clears the callback URL.
+	if err := SetCallbackURL("none", "hookbot", cfg); err != nil {
+		t.Fatalf("SetCallbackURL failed: %v", err)
+	}
+	if gotURL == nil || *gotURL != "" {
+		t.Errorf("expected empty URL to be sent, got %v", gotURL)
+	}
+}
+
+func TestAddUserScopes(t *testing.T) {
+	var got api.AddUserRequest
+	cfg, _ := testServer(t, func(w http.ResponseWriter, r *http.Request) {
+		if !requireAuth(t, w, r) {
+			return
+		}
+		if r.Method != http.MethodPost || r.URL.Path != "/admin/users" {
+			t.Fatalf("unexpected request: %s %s", r.Method, r.URL.Path)
+		}
+		got = api.AddUserRequest{}
+		_ = json.NewDecoder(r.Body).Decode(&got)
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(api.AddUserResponse{Success: true, Username: got.Username, APIKey: "bsk_bot_x"})
+	})
+
+	if err := AddUser("scopedbot", "", "bot", "read_all,write", "townhall:read_mentions; g1:read_all,write", "", cfg); err != nil {
+		t.Fatalf("AddUser failed: %v", err)
+	}
+	want := []models.ChatScope{
+		{ChatID: "townhall", BotPermissions: models.BotPermissions{ReadMentions: true}},
+		{ChatID: "g1", BotPermissions: models.BotPermissions{ReadAll: true, Write: true}},
+	}
+	if len(got.Scopes) != 2 || got.Scopes[0] != want[0] || got.Scopes[1] != want[1] {
+		t.Errorf("unexpected scopes %+v", got.Scopes)
+	}
+	if got.BotPermissions != (models.BotPermissions{}) {
+		t.Errorf("expected --bot-permissions to be dropped for scoped bots, got %+v", got.BotPermissions)
+	}
+
+	// "none" creates a bot limited to DMs users opt into.
+	if err := AddUser("dmbot", "", "bot", "", "none", "", cfg); err != nil {
+		t.Fatalf("AddUser failed: %v", err)
+	}
+	if got.Scopes == nil || len(got.Scopes) != 0 {
+		t.Errorf("expected an empty scope list, got %+v", got.Scopes)
+	}
+
+	if err := AddUser("badbot", "", "bot", "", "townhall", "", cfg); err == nil {
+		t.Error("expected an error for a scope without permissions")
+	}
+	if err := AddUser("alice", "", "user", "", "g1:read_all", "", cfg); err == nil {
+		t.Error("expected an error for scopes on a human user")
+	}
+}
+
+func TestSetWebhookChats(t *testing.T) {
+	users := []models.User{
+		{ID: "w1", UserName: "alerts", Status: models.UserStatusActive, Type: models.UserTypeWebhook},
+	}
+	var got api.WebhookChatsRequest
+	cfg, _ := testServer(t, func(w http.ResponseWriter, r *http.Request) {
+		if !requireAuth(t, w, r) {
+			return
+		}
+		if r.Method == http.MethodGet && r.URL.Path == "/api/users" {
+			writeUsers(w, users)
+			return
+		}
+		if r.Method == http.MethodPost && r.URL.Path == "/api/users/webhook-chats" && r.URL.Query().Get("id") == "w1" {
+			_ = json.NewDecoder(r.Body).Decode(&got)
+			w.Header().Set("Content-Type", "application/json")
+			_ = json.NewEncoder(w).Encode(api.WebhookChatsResponse{
+				APIResponse: models.APIResponse{Success: true, Message: "Webhook chats updated"},
+				Chats:       []string{"townhall", "dm_w1_u1"},
+			})
+			return
+		}
+		t.Fatalf("unexpected request: %s %s", r.Method, r.URL.String())
+	})
+
+	if err := SetWebhookChats("townhall", "", cfg); err == nil {
+		t.Error("expected error without --user")
+	}
+	if err := SetWebhookChats(" , ", "alerts", cfg); err == nil {
+		t.Error("expected error without targets")
+	}
+	if err := SetWebhookChats("townhall, alice", "alerts", cfg); err != nil {
+		t.Fatalf("SetWebhookChats failed: %v", err)
+	}
+	if len(got.Targets) != 2 || got.Targets[0] != "townhall" || got.Targets[1] != "alice" {
+		t.Errorf("unexpected targets sent: %v", got.Targets)
+	}
+}
+
+func TestAPIKeyCommands(t *testing.T) {
+	users := []models.User{
+		{ID: "b1", UserName: "deploybot", Status: models.UserStatusActive, Type: models.UserTypeBot},
+	}
+	var created api.CreateAPIKeyRequest
+	var revoked string
+	cfg, _ := testServer(t, func(w http.ResponseWriter, r *http.Request) {
+		if !requireAuth(t, w, r) {
+			return
+		}
+		if r.Method == http.MethodGet && r.URL.Path == "/api/users" {
+			writeUsers(w, users)
+			return
+		}
+		if r.URL.Path != "/api/users/api-keys" || r.URL.Query().Get("id") != "b1" {
+			t.Fatalf("unexpected request: %s %s", r.Method, r.URL.String())
+		}
+		w.Header().Set("Content-Type", "application/json")
+		switch r.Method {
+		case http.MethodPost:
+			_ = json.NewDecoder(r.Body).Decode(&created)
+			_ = json.NewEncoder(w).Encode(api.CreateAPIKeyResponse{
+				APIResponse: models.APIResponse{Success: true},
+				APIKey:      "bsk_bot_new",
+				Key:         api.APIKeyInfo{ID: "k2", Name: created.Name, ExpiresAt: created.ExpiresAt},
+			})
+		case http.MethodGet:
+			_ = json.NewEncoder(w).Encode(api.APIKeysResponse{
+				APIResponse: models.APIResponse{Success: true},
+				Keys:        []api.APIKeyInfo{{ID: "k1", Name: "default"}},
+			})
+		case http.MethodDelete:
+			revoked = r.URL.Query().Get("key")
+			_ = json.NewEncoder(w).Encode(models.APIResponse{Success: true})
+		}
+	})
+
+	if err := CreateAPIKey("ci", "", "", cfg); err == nil {
+		t.Error("expected error without --user")
+	}
+	if err := CreateAPIKey("ci", "deploybot", "soon", cfg); err == nil {
+		t.Error("expected error for an invalid expiry")
+	}
+	before := time.Now()
+	if err := CreateAPIKey("ci", "deploybot", "720h", cfg); err != nil {
+		t.Fatalf("CreateAPIKey failed: %v", err)
+	}
+	if created.Name != "ci" || created.ExpiresAt < before.Add(720*time.Hour).Unix() {
+		t.Errorf("unexpected create request %+v", created)
+	}
+	if err := ListAPIKeys("deploybot", cfg); err != nil {
+		t.Fatalf("ListAPIKeys failed: %v", err)
+	}
+	if err := RevokeAPIKey("k1", "deploybot", cfg); err != nil || revoked != "k1" {
+		t.Fatalf("RevokeAPIKey failed: %v (revoked %q)", err, revoked)
+	}
+}
+
+func TestParseExpiry(t *testing.T) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	if got, err := parseExpiry("48h", now); err != nil || !got.Equal(now.Add(48*time.Hour)) {
+		t.Errorf("duration: got %v %v", got, err)
+	}
+	if got, err := parseExpiry("2026-12-31", now); err != nil || got.Year() != 2026 || got.YearDay() != 365 {
+		t.Errorf("date: got %v %v", got, err)
+	}
+	if got, err := parseExpiry("2026-06-01T00:00:00Z", now); err != nil || got.Month() != time.June {
+		t.Errorf("RFC 3339: got %v %v", got, err)
+	}
+	for _, bad := range []string{"-1h", "tomorrow"} {
+		if _, err := parseExpiry(bad, now); err == nil {
+			t.Errorf("expected an error for %q", bad)
+		}
+	}
+}
+
+func TestPrintAPIKeys(t *testing.T) {
+	var buf strings.Builder
+	printAPIKeys(&buf, []api.APIKeyInfo{
+		{ID: "k1", Name: "default", CreatedAt: 1, LastUsedAt: 2, LastUsedIP: "192.0.2.7"},
+		{ID: "k2", Name: "ci", ExpiresAt: 3, Expired: true},
+	})
+	out := buf.String()
+	for _, want := range []string{"LAST IP", "192.0.2.7", "never", "(expired)"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestSessionCommands(t *testing.T) {
+	users := []models.User{
+		{ID: "u1", UserName: "alice", Status: models.UserStatusActive},
+	}
+	var revoked []string
+	cfg, _ := testServer(t, func(w http.ResponseWriter, r *http.Request) {
+		if !requireAuth(t, w, r) {
+			return
+		}
+		if r.Method == http.MethodGet && r.URL.Path == "/api/users" {
+			writeUsers(w, users)
+			return
+		}
+		if r.URL.Path != "/api/users/sessions" || r.URL.Query().Get("id") != "u1" {
+			t.Fatalf("unexpected request: %s %s", r.Method, r.URL.String())
+		}
+		w.Header().Set("Content-Type", "application/json")
+		switch r.Method {
+		case http.MethodGet:
+			_ = json.NewEncoder(w).Encode(api.SessionsResponse{
+				APIResponse: models.APIResponse{Success: true},
+				Sessions:    []models.SessionInfo{{ID: "s1", IP: "192.0.2.7"}},
+			})
+		case http.MethodDelete:
+			revoked = append(revoked, r.URL.Query().Get("session"))
+			_ = json.NewEncoder(w).Encode(models.APIResponse{Success: true, Message: "1 session(s) revoked"})
+		}
+	})
+
+	if err := ListSessions("", cfg); err == nil {
+		t.Error("expected error without --user")
+	}
+	if err := ListSessions("alice", cfg); err != nil {
+		t.Fatalf("ListSessions failed: %v", err)
+	}
+	if err := RevokeSession("s1", "alice", cfg); err != nil {
+		t.Fatalf("RevokeSession failed: %v", err)
+	}
+	if err := LogoutUser("alice", cfg); err != nil {
+		t.Fatalf("LogoutUser failed: %v", err)
+	}
+	if len(revoked) != 2 || revoked[0] != "s1" || revoked[1] != "" {
+		t.Errorf("unexpected revocations %q", revoked)
+	}
+
+	var buf strings.Builder
+	printSessions(&buf, []models.SessionInfo{{ID: "s1", CreatedAt: 1, LastActiveAt: 2, UserAgent: "Firefox"}})
+	for _, want := range []string{"LAST ACTIVE", "s1", "Firefox"} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("output missing %q:\n%s", want, buf.String())
+		}
+	}
+}
+
+func TestAdminCommands(t *testing.T) {
+	admins := []api.AdminInfo{
+		{ID: "admin_1", Username: "root", CreatedAt: 1},
+		{ID: "admin_2", Username: "ops", CreatedAt: 2, CreatedBy: "admin_1"},
+	}
+	var deleted, auditFilter string
+	cfg, _ := testServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path == "/api/admins/login" {
+			var req struct {
+				Username string `json:"username"`
+				Password string `json:"password"`
+				TOTP     int    `json:"totp"`
+			}
+			_ = json.NewDecoder(r.Body).Decode(&req)
+			if req.Username != "root" || req.Password != "hunter2hunter2" || req.TOTP != 123456 {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			_ = json.NewEncoder(w).Encode(api.AdminLoginResponse{
+				APIResponse: models.APIResponse{Success: true},
+				Token:       "fresh",
+			})
+			return
+		}
+		if !requireAuth(t, w, r) {
+			return
+		}
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/api/admins":
+			_ = json.NewEncoder(w).Encode(api.AdminsResponse{APIResponse: models.APIResponse{Success: true}, Admins: admins})
+		case r.Method == http.MethodPost && r.URL.Path == "/api/admins":
+			var req api.AdminCredentialsRequest
+			_ = json.NewDecoder(r.Body).Decode(&req)
+			if req.Password != "new-admin-password" {
+				t.Errorf("unexpected password %q", req.Password)
+			}
+			_ = json.NewEncoder(w).Encode(api.AddAdminResponse{
+				APIResponse: models.APIResponse{Success: true},
+				Admin:       api.AdminInfo{ID: "admin_3", Username: req.Username},
+				TOTPSecret:  "SECRET",
+			})
+		case r.Method == http.MethodDelete && r.URL.Path == "/api/admins":
+			deleted = r.URL.Query().Get("id")
+			_ = json.NewEncoder(w).Encode(models.APIResponse{Success: true})
+		case r.URL.Path == "/api/admins/audit":
+			auditFilter = r.URL.Query().Get("admin")
+			_ = json.NewEncoder(w).Encode(api.AdminAuditResponse{APIResponse: models.APIResponse{Success: true}})
+		default:
+			t.Fatalf("unexpected request: %s %s", r.Method, r.URL.String())
+		}
+	})
+	cfg.AdminTokenFile = filepath.Join(t.TempDir(), "token")
+	t.Cleanup(func() { stdin = os.Stdin })
+
+	stdin = strings.NewReader("hunter2hunter2\n123456\n")
+	if err := AdminLogin("root", cfg); err != nil {
+		t.Fatalf("AdminLogin failed: %v", err)
+	}
+	if data, _ := os.ReadFile(cfg.AdminTokenFile); strings.TrimSpace(string(data)) != "fresh" {
+		t.Errorf("expected the token to be saved, got %q", data)
+	}
+
+	stdin = strings.NewReader("new-admin-password\nsomething-else\n")
+	if err := AddAdmin("helper", cfg); err == nil {
+		t.Error("expected mismatched passwords to fail")
+	}
+	stdin = strings.NewReader("new-admin-password\nnew-admin-password\n")
+	if err := AddAdmin("helper", cfg); err != nil {
+		t.Fatalf("AddAdmin failed: %v", err)
+	}
+
+	if err := DeleteAdmin("nobody", true, cfg); err == nil {
+		t.Error("expected an unknown admin to fail")
+	}
+	if err := DeleteAdmin("ops", true, cfg); err != nil || deleted != "admin_2" {
+		t.Fatalf("DeleteAdmin failed: %v (deleted %q)", err, deleted)
+	}
+	if err := AdminAudit("ops", cfg); err != nil || auditFilter != "admin_2" {
+		t.Fatalf("AdminAudit failed: %v (filter %q)", err, auditFilter)
+	}
+
+	var buf strings.Builder
+	printAdmins(&buf, admins)
+	for _, want := range []string{"CREATED BY", "ops", "root"} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("output missing %q:\n%s", want, buf.String())
+		}
+	}
+	buf.Reset()
+	printAudit(&buf, []models.AdminAuditEntry{{Time: 1, AdminName: "root", Action: "POST /api/users", Status: 200}})
+	for _, want := range []string{"ACTION", "root", "POST /api/users"} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("output missing %q:\n%s", want, buf.String())
+		}
+	}
+}
+
+func TestRekey(t *testing.T) {
+	tmpDir := t.TempDir()
+	cfg := &config.Config{
+		DBFile:      filepath.Join(tmpDir, "besedka.db"),
+		UploadsPath: filepath.Join(tmpDir, "uploads"),
+		AuthSecret:  "old-secret",
+	}
+	local, err := filestore.NewLocalFileStore(cfg.UploadsPath)
+	if err != nil {
+		t.Fatalf("NewLocalFileStore failed: %v", err)
+	}
+	store, err := storage.NewBboltStorage(cfg.DBFile, []byte(cfg.AuthSecret), local)
+	if err != nil {
+		t.Fatalf("NewBboltStorage failed: %v", err)
+	}
+	if err := store.UpsertSlashCommand(models.SlashCommand{Name: "deploy", BotID: "b1"}); err != nil {
+		t.Fatalf("UpsertSlashCommand failed: %v", err)
+	}
+	_ = store.Close()
+
+	if err := Rekey(context.Background(), cfg); err == nil || !strings.Contains(err.Error(), "NEW_AUTH_SECRET") {
+		t.Errorf("expected NEW_AUTH_SECRET to be required, got %v", err)
+	}
+	cfg.NewAuthSecret = "new-secret"
+	if err := Rekey(context.Background(), cfg); err != nil {
+		t.Fatalf("Rekey failed: %v", err)
+	}
+
+	store, err = storage.NewBboltStorage(cfg.DBFile, []byte(cfg.NewAuthSecret), local)
+	if err != nil {
+		t.Fatalf("NewBboltStorage failed: %v", err)
+	}
+	defer func() { _ = store.Close() }()
+	if cmds, err := store.ListSlashCommands(); err != nil || len(cmds) != 1 || cmds[0].Name != "deploy" {
+		t.Errorf("expected the command to decrypt with the new secret, got %+v %v", cmds, err)
+	}
+}
+
+func TestDB(t *testing.T) {
+	tmpDir := t.TempDir()
+	cfg := &config.Config{
+		DBFile:      filepath.Join(tmpDir, "besedka.db"),
+		UploadsPath: filepath.Join(tmpDir, "uploads"),
+		AuthSecret:  "secret",
+	}
+	local, err := filestore.NewLocalFileStore(cfg.UploadsPath)
+	if err != nil {
+		t.Fatalf("NewLocalFileStore failed: %v", err)
+	}
+	store, err := storage.NewBboltStorage(cfg.DBFile, []byte(cfg.AuthSecret), local)
+	if err != nil {
+		t.Fatalf("NewBboltStorage failed: %v", err)
+	}
+	if err := store.UpsertChat(models.Chat{ID: "townhall"}); err != nil {
+		t.Fatalf("UpsertChat failed: %v", err)
+	}
+	for seq := int64(1); seq <= 2; seq++ {
+		if err := store.UpsertMessage(models.Message{ChatID: "townhall", Seq: seq, UserID: "u1", Content: "hello"}); err != nil {
+			t.Fatalf("UpsertMessage failed: %v", err)
+		}
+	}
+	_ = store.Close()
+
+	var out strings.Builder
+	if err := runDB(&out, []string{"dump", "--chat", "townhall", "--from", "2"}, cfg); err != nil {
+		t.Fatalf("dump failed: %v", err)
+	}
+	var msg models.Message
+	if err := json.Unmarshal([]byte(out.String()), &msg); err != nil || msg.Seq != 2 || msg.Content != "hello" {
+		t.Errorf("expected message 2 as JSON, got %q %v", out.String(), err)
+	}
+
+	out.Reset()
+	if err := runDB(&out, []string{"chats"}, cfg); err != nil {
+		t.Fatalf("chats failed: %v", err)
+	}
+	if !strings.Contains(out.String(), "townhall") || strings.Contains(out.String(), "drifted") {
+		t.Errorf("expected townhall without drift, got %q", out.String())
+	}
+
+	out.Reset()
+	if err := runDB(&out, []string{"verify"}, cfg); err != nil || !strings.Contains(out.String(), "0 failed") {
+		t.Errorf("expected verify to pass, got %q %v", out.String(), err)
+	}
+
+	cfg.AuthSecret = "wrong"
+	out.Reset()
+	if err := runDB(&out, []string{"verify"}, cfg); err == nil {
+		t.Errorf("expected verify with the wrong secret to fail, got %q", out.String())
+	}
+
+	if err := runDB(&out, []string{"frobnicate"}, cfg); err == nil || !strings.Contains(err.Error(), "unknown db command") {
+		t.Errorf("expected an unknown command error, got %v", err)
+	}
+	if err := runDB(&out, []string{"dump"}, cfg); err == nil || !strings.Contains(err.Error(), "--chat") {
+		t.Errorf("expected --chat to be required, got %v", err)
+	}
+}
+
+func TestRetention(t *testing.T) {
+	var set models.RetentionPolicy
+	var reset string
+	cfg, _ := testServer(t, func(w http.ResponseWriter, r *http.Request) {
+		if !requireAuth(t, w, r) {
+			return
+		}
+		if r.URL.Path != "/api/chats/retention" {
+			t.Fatalf("unexpected request: %s %s", r.Method, r.URL.String())
+		}
+		w.Header().Set("Content-Type", "application/json")
+		switch r.Method {
+		case http.MethodGet:
+			_ = json.NewEncoder(w).Encode(api.RetentionResponse{
+				APIResponse: models.APIResponse{Success: true},
+				Global:      models.RetentionPolicy{MaxAge: 3600},
+				Chats:       []api.ChatRetention{{ID: "townhall", LastSeq: 3}},
+			})
+		case http.MethodPost:
+			_ = json.NewDecoder(r.Body).Decode(&set)
+			_ = json.NewEncoder(w).Encode(models.APIResponse{Success: true})
+		case http.MethodDelete:
+			reset = r.URL.Query().Get("id")
+			_ = json.NewEncoder(w).Encode(models.APIResponse{Success: true})
+		}
+	})
+
+	if err := SetRetention("townhall", "soon", 0, cfg); err == nil {
+		t.Error("expected error for an invalid max age")
+	}
+	if err := SetRetention("townhall", "720h", 100, cfg); err != nil {
+		t.Fatalf("SetRetention failed: %v", err)
+	}
+	if set.MaxAge != 720*3600 || set.MaxMessages != 100 {
+		t.Errorf("unexpected policy %+v", set)
+	}
+	if err := ResetRetention("townhall", cfg); err != nil || reset != "townhall" {
+		t.Fatalf("ResetRetention failed: %v (reset %q)", err, reset)
+	}
+	if err := ListRetention(cfg); err != nil {
+		t.Fatalf("ListRetention failed: %v", err)
+	}
+
+	var buf strings.Builder
+	printRetention(&buf, api.RetentionResponse{
+		Global: models.RetentionPolicy{MaxAge: 3600},
+		Chats: []api.ChatRetention{
+			{ID: "townhall", LastSeq: 3},
+			{ID: "g1", Name: "Ops", FirstSeq: 5, LastSeq: 9, Retention: &models.RetentionPolicy{MaxMessages: 5}},
+		},
+	})
+	out := buf.String()
+	for _, want := range []string{"Global: max age 1h0m0s", "townhall", "global", "max 5 messages"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected %q in output:\n%s", want, out)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package commands
+
+import (
+	"besedka/internal/api"
+	"besedka/internal/config"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// CreateAPIKey issues an additional API key for a bot or webhook, so it can
+// be rolled out before the old key is revoked. expires is either a duration
+// from now (e.g. "720h") or a date (YYYY-MM-DD); empty means no expiry.
+func CreateAPIKey(name, username, expires string, cfg *config.Config) error {
+	if username == "" {
+		return errors.New("--user is required when using --create-api-key")
+	}
+
+	var expiresAt int64
+	if expires != "" {
+		t, err := parseExpiry(expires, time.Now())
+		if err != nil {
+			return err
+		}
+		expiresAt = t.Unix()
+	}
+
+	userID, err := resolveUserID(cfg, username)
+	if err != nil {
+		return err
+	}
+
+	resp, err := adminRequest(cfg, http.MethodPost, "/api/users/api-keys?id="+url.QueryEscape(userID), api.CreateAPIKeyRequest{
+		Name:      name,
+		ExpiresAt: expiresAt,
+	})
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	if resp.StatusCode != http.StatusOK {
+		return httpError("create API key", resp)
+	}
+
+	var result api.CreateAPIKeyResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	fmt.Printf("API key %q (ID %s) created for %s.\n", result.Key.Name, result.Key.ID, username)
+	if result.Key.ExpiresAt != 0 {
+		fmt.Printf("Expires: %s\n", time.Unix(result.Key.ExpiresAt, 0).Format(time.RFC3339))
+	}
+	fmt.Printf("API Key: %s\n", result.APIKey)
+	return nil
+}
+
+// parseExpiry reads a key expiry given as a duration from now or a date.
+func parseExpiry(s string, now time.Time) (time.Time, error) {
+	if d, err := time.ParseDuration(s); err == nil {
+		if d <= 0 {
+			return time.Time{}, fmt.Errorf("expiry %q must be in the future", s)
+		}
+		return now.Add(d), nil
+	}
+	if t, err := time.ParseInLocation(time.DateOnly, s, time.Local); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("invalid expiry %q: use a duration like 720h or a date like 2026-12-31", s)
+}
@@ -0,0 +1,176 @@
+package commands
+
+import (
+	"besedka/internal/config"
+	"besedka/internal/storage"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strings"
+	"text/tabwriter"
+)
+
+const dbUsage = `usage: besedka db <command> [flags]
+
+Commands:
+  stats                                 record counts and sizes per bucket
+  chats                                 chats with their stored LastSeq and last message seq
+  dump --chat <id> [--from N] [--to N]  decrypted messages as JSON lines
+  verify                                check that every record decrypts and unmarshals
+  fix-seq                               move LastSeq up to the last message where it drifted behind
+  purge-dirty                           delete backup journal markers no backup needs`
+
+// DB runs the besedka db subcommands, which inspect and repair the database
+// file directly with AUTH_SECRET (and AUTH_SECRET_PREVIOUS) instead of going
+// through the admin API, so the server must be stopped. Only fix-seq and
+// purge-dirty write to the file.
+func DB(args []string, cfg *config.Config) error {
+	return runDB(os.Stdout, args, cfg)
+}
+
+func runDB(w io.Writer, args []string, cfg *config.Config) error {
+	if len(args) == 0 {
+		return errors.New(dbUsage)
+	}
+	cmd, args := args[0], args[1:]
+	fset := flag.NewFlagSet("besedka db "+cmd, flag.ContinueOnError)
+	chatID := fset.String("chat", "", "Chat ID for dump")
+	from := fset.Int64("from", 1, "First message seq for dump")
+	to := fset.Int64("to", math.MaxInt64, "Last message seq for dump (defaults to the last message)")
+	if err := fset.Parse(args); err != nil {
+		return err
+	}
+
+	readOnly := true
+	switch cmd {
+	case "stats", "chats", "verify":
+	case "dump":
+		if *chatID == "" {
+			return errors.New("--chat is required for dump")
+		}
+	case "fix-seq", "purge-dirty":
+		readOnly = false
+	default:
+		return fmt.Errorf("unknown db command %q\n\n%s", cmd, dbUsage)
+	}
+
+	var previousKeys [][]byte
+	if cfg.PreviousAuthSecret != "" {
+		previousKeys = append(previousKeys, []byte(cfg.PreviousAuthSecret))
+	}
+	store, err := storage.OpenOffline(cfg.DBFile, readOnly, []byte(cfg.AuthSecret), previousKeys...)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = store.Close() }()
+
+	switch cmd {
+	case "stats":
+		stats, err := store.BucketStats()
+		if err != nil {
+			return err
+		}
+		printBucketStats(w, stats)
+	case "chats":
+		seqs, err := store.ChatSeqs()
+		if err != nil {
+			return err
+		}
+		printChatSeqs(w, seqs)
+	case "dump":
+		msgs, err := store.ListMessages(*chatID, *from, *to)
+		if err != nil {
+			return err
+		}
+		enc := json.NewEncoder(w)
+		for _, msg := range msgs {
+			if err := enc.Encode(msg); err != nil {
+				return err
+			}
+		}
+	case "verify":
+		report, err := store.VerifyRecords()
+		if err != nil {
+			return err
+		}
+		return printVerifyReport(w, report)
+	case "fix-seq":
+		fixed, err := store.FixLastSeq()
+		if err != nil {
+			return err
+		}
+		for _, seq := range fixed {
+			_, _ = fmt.Fprintf(w, "Chat %s: LastSeq %d -> %d\n", seq.ID, seq.LastSeq, seq.MaxSeq)
+		}
+		_, _ = fmt.Fprintf(w, "Fixed %d chats.\n", len(fixed))
+	case "purge-dirty":
+		n, err := store.PurgeDirtyMarkers()
+		if err != nil {
+			return err
+		}
+		_, _ = fmt.Fprintf(w, "Purged %d backup journal markers.\n", n)
+	}
+	return nil
+}
+
+// printBucketStats renders bucket stats as an aligned table.
+func printBucketStats(w io.Writer, stats []storage.BucketStats) {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	_, _ = fmt.Fprintln(tw, "BUCKET\tRECORDS\tBUCKETS\tBYTES")
+	for _, st := range stats {
+		_, _ = fmt.Fprintf(tw, "%s\t%d\t%d\t%d\n", st.Name, st.Records, st.Buckets, st.Bytes)
+	}
+	_ = tw.Flush()
+}
+
+// printChatSeqs renders chats with their sequence numbers, flagging those
+// whose LastSeq drifted behind their messages.
+func printChatSeqs(w io.Writer, seqs []storage.ChatSeq) {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	_, _ = fmt.Fprintln(tw, "ID\tNAME\tLAST SEQ\tMAX SEQ\tMESSAGES\tSTATUS")
+	drifted := 0
+	for _, seq := range seqs {
+		status := "ok"
+		switch {
+		case seq.NoChat:
+			status = "no chat record"
+		case seq.Drifted():
+			status = "drifted"
+			drifted++
+		}
+		_, _ = fmt.Fprintf(tw, "%s\t%s\t%d\t%d\t%d\t%s\n", seq.ID, seq.Name, seq.LastSeq, seq.MaxSeq, seq.Messages, status)
+	}
+	_ = tw.Flush()
+	if len(seqs) == 0 {
+		_, _ = fmt.Fprintln(w, "(no chats)")
+	}
+	if drifted > 0 {
+		_, _ = fmt.Fprintf(w, "\n%d chats have LastSeq behind their messages; run besedka db fix-seq.\n", drifted)
+	}
+}
+
+// printVerifyReport lists the records that failed verification and returns
+// an error when there are any, so the command exits non-zero.
+func printVerifyReport(w io.Writer, report storage.VerifyReport) error {
+	if len(report.Errors) > 0 {
+		tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		_, _ = fmt.Fprintln(tw, "BUCKET\tKEY\tERROR")
+		for _, e := range report.Errors {
+			_, _ = fmt.Fprintf(tw, "%s\t%s\t%s\n", e.Path, e.Key, e.Err)
+		}
+		_ = tw.Flush()
+		_, _ = fmt.Fprintln(w)
+	}
+	_, _ = fmt.Fprintf(w, "Checked %d records, %d failed.\n", report.Records, len(report.Errors))
+	if len(report.Unknown) > 0 {
+		_, _ = fmt.Fprintf(w, "Buckets of unknown format, not checked: %s\n", strings.Join(report.Unknown, ", "))
+	}
+	if len(report.Errors) > 0 {
+		return fmt.Errorf("%d records failed verification", len(report.Errors))
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+package commands
+
+import (
+	"besedka/internal/config"
+	"besedka/internal/models"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+)
+
+// DeleteAdmin removes an admin account by username. The last admin can't be
+// deleted.
+func DeleteAdmin(username string, assumeYes bool, cfg *config.Config) error {
+	adminID, err := resolveAdminID(cfg, username)
+	if err != nil {
+		return err
+	}
+
+	if !assumeYes {
+		ok, err := confirm(stdin, os.Stdout, fmt.Sprintf("Delete admin %s? [y/N]: ", username))
+		if err != nil {
+			return err
+		}
+		if !ok {
+			fmt.Println("Aborted.")
+			return nil
+		}
+	}
+
+	resp, err := adminRequest(cfg, http.MethodDelete, "/api/admins?id="+url.QueryEscape(adminID), nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	if resp.StatusCode != http.StatusOK {
+		return httpError("delete admin", resp)
+	}
+
+	var result models.APIResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	fmt.Printf("Admin %s deleted.\n", username)
+	return nil
+}
@@ -0,0 +1,60 @@
+package commands
+
+import (
+	"besedka/internal/config"
+	"besedka/internal/export"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+)
+
+// Export downloads the history of chatID as seen by username and writes it to
+// outPath (a default name in the current directory when empty). format is
+// "jsonl" or "html"; the latter produces a zip with the attachments.
+func Export(chatID, username, format, outPath string, cfg *config.Config) error {
+	if username == "" {
+		return errors.New("--user is required when using --export")
+	}
+	f, err := export.ParseFormat(format)
+	if err != nil {
+		return err
+	}
+	if outPath == "" {
+		outPath = f.Filename(chatID)
+	}
+
+	userID, err := resolveUserID(cfg, username)
+	if err != nil {
+		return err
+	}
+
+	q := url.Values{"chatId": {chatID}, "userId": {userID}, "format": {string(f)}}
+	resp, err := adminRequest(cfg, http.MethodGet, "/api/export?"+q.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK {
+		return httpError("export chat", resp)
+	}
+
+	out, err := os.Create(outPath)
+	if err != nil {
+		return fmt.Errorf("failed to create %q: %w", outPath, err)
+	}
+	n, err := io.Copy(out, resp.Body)
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		_ = os.Remove(outPath)
+		return fmt.Errorf("failed to write export: %w", err)
+	}
+
+	fmt.Printf("Exported chat %s to %s (%d bytes).\n", chatID, outPath, n)
+	return nil
+}
@@ -0,0 +1,77 @@
+package commands
+
+import (
+	"besedka/internal/api"
+	"besedka/internal/config"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"text/tabwriter"
+	"time"
+)
+
+// ListAPIKeys prints the API keys of a bot or webhook with their expiry and
+// last use.
+func ListAPIKeys(username string, cfg *config.Config) error {
+	if username == "" {
+		return errors.New("--user is required when using --list-api-keys")
+	}
+
+	userID, err := resolveUserID(cfg, username)
+	if err != nil {
+		return err
+	}
+
+	resp, err := adminRequest(cfg, http.MethodGet, "/api/users/api-keys?id="+url.QueryEscape(userID), nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	if resp.StatusCode != http.StatusOK {
+		return httpError("list API keys", resp)
+	}
+
+	var result api.APIKeysResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	printAPIKeys(os.Stdout, result.Keys)
+	return nil
+}
+
+// printAPIKeys renders keys as an aligned table.
+func printAPIKeys(w io.Writer, keys []api.APIKeyInfo) {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	_, _ = fmt.Fprintln(tw, "ID\tNAME\tCREATED\tEXPIRES\tLAST USED\tLAST IP")
+	for _, k := range keys {
+		expires := formatUnix(k.ExpiresAt, "never")
+		if k.Expired {
+			expires += " (expired)"
+		}
+		lastIP := k.LastUsedIP
+		if lastIP == "" {
+			lastIP = "-"
+		}
+		_, _ = fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", k.ID, k.Name, formatUnix(k.CreatedAt, "-"), expires, formatUnix(k.LastUsedAt, "never"), lastIP)
+	}
+	_ = tw.Flush()
+	if len(keys) == 0 {
+		_, _ = fmt.Fprintln(w, "(no API keys)")
+	}
+}
+
+// formatUnix formats a Unix timestamp, or returns zero for 0.
+func formatUnix(ts int64, zero string) string {
+	if ts == 0 {
+		return zero
+	}
+	return time.Unix(ts, 0).UTC().Format(time.RFC3339)
+}
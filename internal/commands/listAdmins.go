@@ -0,0 +1,64 @@
+package commands
+
+import (
+	"besedka/internal/api"
+	"besedka/internal/config"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"text/tabwriter"
+)
+
+// ListAdmins prints the admin accounts.
+func ListAdmins(cfg *config.Config) error {
+	admins, err := listAdmins(cfg)
+	if err != nil {
+		return err
+	}
+	printAdmins(os.Stdout, admins)
+	return nil
+}
+
+func listAdmins(cfg *config.Config) ([]api.AdminInfo, error) {
+	resp, err := adminRequest(cfg, http.MethodGet, "/api/admins", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, httpError("list admins", resp)
+	}
+
+	var result api.AdminsResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+	return result.Admins, nil
+}
+
+// printAdmins renders admins as an aligned table.
+func printAdmins(w io.Writer, admins []api.AdminInfo) {
+	names := make(map[string]string, len(admins))
+	for _, a := range admins {
+		names[a.ID] = a.Username
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	_, _ = fmt.Fprintln(tw, "USERNAME\tCREATED\tCREATED BY")
+	for _, a := range admins {
+		createdBy := "-"
+		if a.CreatedBy != "" {
+			createdBy = names[a.CreatedBy]
+			if createdBy == "" {
+				createdBy = "(deleted)"
+			}
+		}
+		_, _ = fmt.Fprintf(tw, "%s\t%s\t%s\n", a.Username, formatUnix(a.CreatedAt, "-"), createdBy)
+	}
+	_ = tw.Flush()
+}
@@ -0,0 +1,67 @@
+package commands
+
+import (
+	"besedka/internal/api"
+	"besedka/internal/config"
+	"besedka/internal/models"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"text/tabwriter"
+)
+
+// ListSessions prints the login sessions of a user.
+func ListSessions(username string, cfg *config.Config) error {
+	if username == "" {
+		return errors.New("--user is required when using --list-sessions")
+	}
+
+	userID, err := resolveUserID(cfg, username)
+	if err != nil {
+		return err
+	}
+
+	resp, err := adminRequest(cfg, http.MethodGet, "/api/users/sessions?id="+url.QueryEscape(userID), nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	if resp.StatusCode != http.StatusOK {
+		return httpError("list sessions", resp)
+	}
+
+	var result api.SessionsResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	printSessions(os.Stdout, result.Sessions)
+	return nil
+}
+
+// printSessions renders sessions as an aligned table.
+func printSessions(w io.Writer, sessions []models.SessionInfo) {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	_, _ = fmt.Fprintln(tw, "ID\tCREATED\tLAST ACTIVE\tIP\tUSER AGENT")
+	for _, s := range sessions {
+		ip, userAgent := s.IP, s.UserAgent
+		if ip == "" {
+			ip = "-"
+		}
+		if userAgent == "" {
+			userAgent = "-"
+		}
+		_, _ = fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", s.ID, formatUnix(s.CreatedAt, "-"), formatUnix(s.LastActiveAt, "-"), ip, userAgent)
+	}
+	_ = tw.Flush()
+	if len(sessions) == 0 {
+		_, _ = fmt.Fprintln(w, "(no sessions)")
+	}
+}
@@ -0,0 +1,39 @@
+package commands
+
+import (
+	"besedka/internal/config"
+	"besedka/internal/models"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// LogoutUser revokes all login sessions of a user and closes their
+// connections.
+func LogoutUser(username string, cfg *config.Config) error {
+	userID, err := resolveUserID(cfg, username)
+	if err != nil {
+		return err
+	}
+
+	resp, err := adminRequest(cfg, http.MethodDelete, "/api/users/sessions?id="+url.QueryEscape(userID), nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	if resp.StatusCode != http.StatusOK {
+		return httpError("log out user", resp)
+	}
+
+	var result models.APIResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	fmt.Printf("User %s logged out: %s.\n", username, result.Message)
+	return nil
+}
@@ -0,0 +1,93 @@
+package commands
+
+import (
+	"besedka/internal/backup"
+	"besedka/internal/config"
+	"besedka/internal/filestore"
+	"besedka/internal/objectstore"
+	"besedka/internal/storage"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Rekey re-encrypts the database and uploaded files from AUTH_SECRET to
+// NEW_AUTH_SECRET. Unlike the other commands it works on the files directly,
+// so the server must be stopped. When S3 is enabled, re-encrypted files are
+// uploaded again and a full backup is taken under the new secret.
+func Rekey(ctx context.Context, cfg *config.Config) error {
+	if cfg.NewAuthSecret == "" {
+		return errors.New("NEW_AUTH_SECRET is required")
+	}
+
+	objClient, err := objectstore.New(objectstore.Config{
+		Endpoint:  cfg.S3Endpoint,
+		Region:    cfg.S3Region,
+		Bucket:    cfg.S3Bucket,
+		AccessKey: cfg.S3AccessKey,
+		SecretKey: cfg.S3SecretKey,
+		PathStyle: cfg.S3PathStyle,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to initialize object storage: %w", err)
+	}
+	local, err := filestore.NewLocalFileStore(cfg.UploadsPath)
+	if err != nil {
+		return fmt.Errorf("failed to initialize filestore: %w", err)
+	}
+	var fs filestore.FileStore = local
+	var uploadBlob func(hash string) error
+	var mirror *filestore.MirrorFileStore
+	if objClient != nil {
+		mirror = filestore.NewMirrorFileStore(local, objClient, "files/")
+		fs = rekeyFileStore{MirrorFileStore: mirror, local: local}
+		uploadBlob = func(hash string) error { return mirror.Upload(ctx, hash) }
+	}
+
+	oldSecrets := [][]byte{[]byte(cfg.AuthSecret)}
+	if cfg.PreviousAuthSecret != "" {
+		oldSecrets = append(oldSecrets, []byte(cfg.PreviousAuthSecret))
+	}
+	stats, err := storage.Rekey(cfg.DBFile, oldSecrets, []byte(cfg.NewAuthSecret), fs, uploadBlob)
+	if err != nil {
+		return fmt.Errorf("re-key failed (run --rekey again to resume): %w", err)
+	}
+	fmt.Printf("Re-encrypted %d records and %d files.\n", stats.Records, stats.Blobs)
+	if stats.MissingBlobs > 0 {
+		fmt.Printf("%d files referenced by the database were not found and were skipped.\n", stats.MissingBlobs)
+	}
+	if stats.Sessions > 0 {
+		fmt.Printf("Dropped %d login sessions; users and admins need to sign in again.\n", stats.Sessions)
+	}
+
+	if objClient != nil {
+		store, err := storage.NewBboltStorage(cfg.DBFile, []byte(cfg.NewAuthSecret), mirror)
+		if err != nil {
+			return fmt.Errorf("failed to open re-keyed database: %w", err)
+		}
+		defer func() { _ = store.Close() }()
+		scheduler := backup.NewScheduler(store, objClient, "backups/", cfg.S3BackupInterval, cfg.S3BackupIncrInterval, int(cfg.S3BackupKeep), mirror.Flush)
+		if err := scheduler.DoBackup(ctx); err != nil {
+			return fmt.Errorf("full backup after re-key failed (the server takes one on its next scheduled backup): %w", err)
+		}
+		fmt.Println("Full backup taken. Older backups can only be restored with the old secret.")
+	}
+
+	fmt.Println()
+	fmt.Println("Now set AUTH_SECRET to the new secret and AUTH_SECRET_PREVIOUS to the old one,")
+	fmt.Println("remove NEW_AUTH_SECRET and start the server.")
+	return nil
+}
+
+// rekeyFileStore reads blobs through the mirror, so files left only in object
+// storage are re-encrypted too, but writes them to local disk only: Rekey
+// uploads each rewritten blob itself instead of queueing it.
+type rekeyFileStore struct {
+	*filestore.MirrorFileStore
+	local filestore.FileStore
+}
+
+func (s rekeyFileStore) Replace(r io.Reader, hash string) error {
+	return s.local.Replace(r, hash)
+}
@@ -0,0 +1,128 @@
+package commands
+
+import (
+	"besedka/internal/api"
+	"besedka/internal/config"
+	"besedka/internal/models"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+)
+
+// ListRetention prints the global message retention policy and the policy
+// of every chat.
+func ListRetention(cfg *config.Config) error {
+	resp, err := adminRequest(cfg, http.MethodGet, "/api/chats/retention", nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	if resp.StatusCode != http.StatusOK {
+		return httpError("list retention policies", resp)
+	}
+
+	var result api.RetentionResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	printRetention(os.Stdout, result)
+	return nil
+}
+
+// SetRetention overrides the global retention policy for a chat. maxAge is a
+// duration (e.g. "720h"); leaving both limits empty keeps the chat's messages
+// forever.
+func SetRetention(chatID, maxAge string, maxMessages int, cfg *config.Config) error {
+	var policy models.RetentionPolicy
+	if maxAge != "" {
+		d, err := time.ParseDuration(maxAge)
+		if err != nil || d < 0 {
+			return fmt.Errorf("invalid --max-age %q: use a duration like 720h", maxAge)
+		}
+		policy.MaxAge = int64(d / time.Second)
+	}
+	if maxMessages < 0 {
+		return errors.New("--max-messages must not be negative")
+	}
+	policy.MaxMessages = maxMessages
+
+	resp, err := adminRequest(cfg, http.MethodPost, "/api/chats/retention?id="+url.QueryEscape(chatID), policy)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	if resp.StatusCode != http.StatusOK {
+		return httpError("set retention policy", resp)
+	}
+
+	fmt.Printf("Retention policy of %s set to %s.\n", chatID, formatPolicy(policy))
+	return nil
+}
+
+// ResetRetention makes a chat follow the global retention policy again.
+func ResetRetention(chatID string, cfg *config.Config) error {
+	resp, err := adminRequest(cfg, http.MethodDelete, "/api/chats/retention?id="+url.QueryEscape(chatID), nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	if resp.StatusCode != http.StatusOK {
+		return httpError("reset retention policy", resp)
+	}
+
+	fmt.Printf("Chat %s now follows the global retention policy.\n", chatID)
+	return nil
+}
+
+// printRetention renders the retention policies as an aligned table.
+func printRetention(w io.Writer, r api.RetentionResponse) {
+	_, _ = fmt.Fprintf(w, "Global: %s\n\n", formatPolicy(r.Global))
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	_, _ = fmt.Fprintln(tw, "ID\tNAME\tPOLICY\tFIRST SEQ\tLAST SEQ")
+	for _, c := range r.Chats {
+		policy := "global"
+		if c.Retention != nil {
+			policy = formatPolicy(*c.Retention)
+		}
+		firstSeq := "-"
+		if c.FirstSeq > 0 {
+			firstSeq = strconv.Itoa(c.FirstSeq)
+		}
+		_, _ = fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%d\n", c.ID, c.Name, policy, firstSeq, c.LastSeq)
+	}
+	_ = tw.Flush()
+	if len(r.Chats) == 0 {
+		_, _ = fmt.Fprintln(w, "(no chats)")
+	}
+}
+
+// formatPolicy describes a retention policy in words.
+func formatPolicy(p models.RetentionPolicy) string {
+	switch {
+	case p.IsZero():
+		return "keep forever"
+	case p.MaxMessages <= 0:
+		return fmt.Sprintf("max age %s", time.Duration(p.MaxAge)*time.Second)
+	case p.MaxAge <= 0:
+		return fmt.Sprintf("max %d messages", p.MaxMessages)
+	default:
+		return fmt.Sprintf("max age %s, max %d messages", time.Duration(p.MaxAge)*time.Second, p.MaxMessages)
+	}
+}
@@ -0,0 +1,38 @@
+package commands
+
+import (
+	"besedka/internal/config"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// RevokeAPIKey deletes one API key of a bot or webhook by its ID, as shown by
+// --list-api-keys.
+func RevokeAPIKey(keyID, username string, cfg *config.Config) error {
+	if username == "" {
+		return errors.New("--user is required when using --revoke-api-key")
+	}
+
+	userID, err := resolveUserID(cfg, username)
+	if err != nil {
+		return err
+	}
+
+	path := fmt.Sprintf("/api/users/api-keys?id=%s&key=%s", url.QueryEscape(userID), url.QueryEscape(keyID))
+	resp, err := adminRequest(cfg, http.MethodDelete, path, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	if resp.StatusCode != http.StatusOK {
+		return httpError("revoke API key", resp)
+	}
+
+	fmt.Printf("API key %s of %s revoked.\n", keyID, username)
+	return nil
+}
@@ -0,0 +1,38 @@
+package commands
+
+import (
+	"besedka/internal/config"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// RevokeSession logs a user out of one session by its ID, as shown by
+// --list-sessions.
+func RevokeSession(sessionID, username string, cfg *config.Config) error {
+	if username == "" {
+		return errors.New("--user is required when using --revoke-session")
+	}
+
+	userID, err := resolveUserID(cfg, username)
+	if err != nil {
+		return err
+	}
+
+	path := fmt.Sprintf("/api/users/sessions?id=%s&session=%s", url.QueryEscape(userID), url.QueryEscape(sessionID))
+	resp, err := adminRequest(cfg, http.MethodDelete, path, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	if resp.StatusCode != http.StatusOK {
+		return httpError("revoke session", resp)
+	}
+
+	fmt.Printf("Session %s of %s revoked.\n", sessionID, username)
+	return nil
+}
@@ -35,7 +35,9 @@ func SetAvatar(filePath, username string, cfg *config.Config) error {
 		return fmt.Errorf("failed to create request: %w", err)
 	}
 	req.Header.Set("Content-Type", "application/octet-stream")
-	req.SetBasicAuth(cfg.AdminUser, cfg.AdminPassword)
+	if err := setAdminToken(cfg, req); err != nil {
+		return err
+	}
 
 	resp, err := httpClient.Do(req)
 	if err != nil {
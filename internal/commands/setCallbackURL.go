@@ -0,0 +1,47 @@
+package commands
+
+import (
+	"besedka/internal/api"
+	"besedka/internal/config"
+	"besedka/internal/models"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// SetCallbackURL sets the outgoing webhook URL of a bot. The special value
+// "none" removes it, so the bot only receives messages over WebSocket again.
+func SetCallbackURL(callbackURL, username string, cfg *config.Config) error {
+	if username == "" {
+		return errors.New("--user is required when using --set-callback-url")
+	}
+	if callbackURL == "none" {
+		callbackURL = ""
+	}
+
+	userID, err := resolveUserID(cfg, username)
+	if err != nil {
+		return err
+	}
+
+	resp, err := adminRequest(cfg, http.MethodPost, "/api/users/callback-url?id="+userID, api.SetCallbackURLRequest{URL: callbackURL})
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	if resp.StatusCode != http.StatusOK {
+		return httpError("set callback URL", resp)
+	}
+
+	var result models.APIResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	fmt.Printf("%s for bot %s.\n", result.Message, username)
+	return nil
+}
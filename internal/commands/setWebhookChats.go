@@ -0,0 +1,58 @@
+package commands
+
+import (
+	"besedka/internal/api"
+	"besedka/internal/config"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// SetWebhookChats replaces the chats a webhook may post to. Targets are
+// comma-separated: "townhall", usernames for the webhook's DMs with them, or
+// group chat IDs. The first one is where messages go by default.
+func SetWebhookChats(targets, username string, cfg *config.Config) error {
+	if username == "" {
+		return errors.New("--user is required when using --set-webhook-chats")
+	}
+
+	var list []string
+	for _, t := range strings.Split(targets, ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			list = append(list, t)
+		}
+	}
+	if len(list) == 0 {
+		return errors.New("at least one target is required")
+	}
+
+	userID, err := resolveUserID(cfg, username)
+	if err != nil {
+		return err
+	}
+
+	resp, err := adminRequest(cfg, http.MethodPost, "/api/users/webhook-chats?id="+userID, api.WebhookChatsRequest{Targets: list})
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	if resp.StatusCode != http.StatusOK {
+		return httpError("set webhook chats", resp)
+	}
+
+	var result api.WebhookChatsResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	if len(result.Chats) == 0 {
+		return errors.New("server returned no chats")
+	}
+	fmt.Printf("%s for webhook %s: %s (default %s).\n", result.Message, username, strings.Join(result.Chats, ", "), result.Chats[0])
+	return nil
+}
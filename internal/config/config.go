@@ -2,10 +2,14 @@ package config
 
 import (
 	"fmt"
+	"net"
 	"net/url"
 	"os"
+	"path/filepath"
 	"regexp"
 	"time"
+
+	"besedka/internal/models"
 )
 
 var chatNameRegex = regexp.MustCompile(`^[a-zA-Z0-9-]{3,32}$`)
@@ -16,8 +20,6 @@ type Config struct {
 	APIAddr             string
 	BaseURL             string
 	UploadsPath         string
-	AdminUser           string
-	AdminPassword       string
 	AuthSecret          string
 	TokenExpiry         time.Duration
 	MaxImageSize        int64
@@ -29,6 +31,31 @@ type Config struct {
 	EnableHTTPChallenge bool
 	HTTPChallengePort   string
 	ChatName            string
+	LinkPreviews        bool
+
+	// Message retention. Messages older than RetentionMaxAge, or beyond the
+	// newest RetentionMaxMessages of a chat, are deleted every
+	// RetentionInterval. 0 means no limit; chats can override both.
+	RetentionMaxAge      time.Duration
+	RetentionMaxMessages int64
+	RetentionInterval    time.Duration
+
+	// Secret rotation. NewAuthSecret is the secret --rekey re-encrypts the
+	// database with. PreviousAuthSecret is the secret in use before the last
+	// re-key, so password and API key hashes made with it keep working.
+	NewAuthSecret      string
+	PreviousAuthSecret string
+
+	// Admin accounts. AdminOrigin is the origin the admin UI is opened at,
+	// for admin passkeys. AdminToken authenticates CLI commands; when empty,
+	// the token saved in AdminTokenFile by --admin-login is used.
+	// AdminBootstrapToken is the one-time token for --bootstrap-admin; when
+	// empty, the server makes a random one and prints it to its log.
+	AdminOrigin         string
+	AdminTokenExpiry    time.Duration
+	AdminToken          string
+	AdminTokenFile      string
+	AdminBootstrapToken string
 
 	// S3-compatible object storage (optional). Empty bucket or endpoint
 	// disables the feature entirely.
@@ -54,6 +81,11 @@ func Load() (*Config, error) {
 		return nil, err
 	}
 
+	adminTokenExpiry, err := time.ParseDuration(getEnv("ADMIN_TOKEN_EXPIRY", "12h"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid ADMIN_TOKEN_EXPIRY: %w", err)
+	}
+
 	backupInterval, err := time.ParseDuration(getEnv("S3_BACKUP_INTERVAL", "24h"))
 	if err != nil {
 		return nil, fmt.Errorf("invalid S3_BACKUP_INTERVAL: %w", err)
@@ -67,6 +99,22 @@ func Load() (*Config, error) {
 		return nil, fmt.Errorf("invalid S3_BACKUP_INCREMENTAL_INTERVAL: %w", err)
 	}
 
+	retentionMaxAge, err := time.ParseDuration(getEnv("RETENTION_MAX_AGE", "0"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid RETENTION_MAX_AGE: %w", err)
+	}
+
+	retentionInterval, err := time.ParseDuration(getEnv("RETENTION_INTERVAL", "1h"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid RETENTION_INTERVAL: %w", err)
+	}
+
+	adminAddr := getEnv("ADMIN_ADDR", "localhost:8081")
+	adminOrigin := os.Getenv("ADMIN_ORIGIN")
+	if adminOrigin == "" {
+		adminOrigin = defaultAdminOrigin(adminAddr)
+	}
+
 	apiAddr := os.Getenv("API_ADDR")
 	tlsAutoCertPath := os.Getenv("TLS_AUTO_CERT_PATH")
 	tlsCert := os.Getenv("TLS_CERT")
@@ -82,13 +130,18 @@ func Load() (*Config, error) {
 
 	cfg := &Config{
 		DBFile:              getEnv("BESEDKA_DB", "besedka.db"),
-		AdminAddr:           getEnv("ADMIN_ADDR", "localhost:8081"),
+		AdminAddr:           adminAddr,
 		APIAddr:             apiAddr,
 		BaseURL:             getEnv("BASE_URL", "http://localhost:8080"),
 		UploadsPath:         getEnv("UPLOADS_PATH", "uploads"),
-		AdminUser:           getEnv("ADMIN_USER", "admin"),
-		AdminPassword:       getEnv("ADMIN_PASSWORD", "1337chat"),
+		AdminOrigin:         adminOrigin,
+		AdminTokenExpiry:    adminTokenExpiry,
+		AdminToken:          os.Getenv("ADMIN_TOKEN"),
+		AdminTokenFile:      getEnv("ADMIN_TOKEN_FILE", defaultAdminTokenFile()),
+		AdminBootstrapToken: os.Getenv("ADMIN_BOOTSTRAP_TOKEN"),
 		AuthSecret:          os.Getenv("AUTH_SECRET"),
+		NewAuthSecret:       os.Getenv("NEW_AUTH_SECRET"),
+		PreviousAuthSecret:  os.Getenv("AUTH_SECRET_PREVIOUS"),
 		TokenExpiry:         tokenExpiry,
 		MaxImageSize:        getEnvInt64("MAX_IMAGE_SIZE", 10<<20),
 		MaxAvatarSize:       getEnvInt64("MAX_AVATAR_SIZE", 5<<20),
@@ -99,6 +152,11 @@ func Load() (*Config, error) {
 		EnableHTTPChallenge: getEnv("ENABLE_HTTP_CHALLENGE", "false") == "true" || getEnv("ENABLE_HTTP_CHALLENGE", "false") == "1",
 		HTTPChallengePort:   getEnv("HTTP_CHALLENGE_PORT", "80"),
 		ChatName:            getEnv("CHAT_NAME", "Besedka"),
+		LinkPreviews:        getEnv("LINK_PREVIEWS", "false") == "true" || getEnv("LINK_PREVIEWS", "false") == "1",
+
+		RetentionMaxAge:      retentionMaxAge,
+		RetentionMaxMessages: getEnvInt64("RETENTION_MAX_MESSAGES", 0),
+		RetentionInterval:    retentionInterval,
 
 		S3Endpoint:       os.Getenv("S3_ENDPOINT"),
 		S3Region:         getEnv("S3_REGION", "us-east-1"),
@@ -129,6 +187,18 @@ func (c *Config) Validate() error {
 		return fmt.Errorf("TOKEN_EXPIRY must be greater than 0")
 	}
 
+	if c.AdminTokenExpiry <= 0 {
+		return fmt.Errorf("ADMIN_TOKEN_EXPIRY must be greater than 0")
+	}
+
+	if c.RetentionMaxAge < 0 {
+		return fmt.Errorf("RETENTION_MAX_AGE must be 0 (keep forever) or greater")
+	}
+
+	if c.RetentionInterval <= 0 {
+		return fmt.Errorf("RETENTION_INTERVAL must be greater than 0")
+	}
+
 	if (c.TLSCert != "" && c.TLSKey == "") || (c.TLSCert == "" && c.TLSKey != "") {
 		return fmt.Errorf("TLS_CERT and TLS_KEY must be provided together")
 	}
@@ -169,6 +239,35 @@ func (c *Config) Validate() error {
 	return nil
 }
 
+// RetentionPolicy returns the global message retention policy.
+func (c *Config) RetentionPolicy() models.RetentionPolicy {
+	return models.RetentionPolicy{
+		MaxAge:      int64(c.RetentionMaxAge / time.Second),
+		MaxMessages: int(c.RetentionMaxMessages),
+	}
+}
+
+// defaultAdminOrigin returns the origin of the admin UI served at addr.
+func defaultAdminOrigin(addr string) string {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return "http://" + addr
+	}
+	if host == "" || host == "0.0.0.0" || host == "::" {
+		host = "localhost"
+	}
+	return "http://" + net.JoinHostPort(host, port)
+}
+
+// defaultAdminTokenFile returns where --admin-login saves the admin token.
+func defaultAdminTokenFile() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ".besedka_admin_token"
+	}
+	return filepath.Join(home, ".besedka_admin_token")
+}
+
 func getEnv(key, fallback string) string {
 	if value, ok := os.LookupEnv(key); ok {
 		return value
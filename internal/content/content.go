@@ -5,6 +5,8 @@ import (
 	"errors"
 	"html/template"
 	"regexp"
+	"slices"
+	"strings"
 
 	"github.com/microcosm-cc/bluemonday"
 	"github.com/yuin/goldmark"
@@ -91,3 +93,23 @@ func ExtractMentions(message string) []string {
 	}
 	return mentions
 }
+
+var urlRegex = regexp.MustCompile(`https?://[^\s<>"'` + "`" + `]+`)
+
+// ExtractURLs returns the distinct http(s) URLs in a message in order of appearance.
+// Trailing punctuation and unbalanced closing brackets are not part of the URL.
+func ExtractURLs(message string) []string {
+	var urls []string
+	for _, u := range urlRegex.FindAllString(message, -1) {
+		u = strings.TrimRight(u, ".,:;!?*_~")
+		for _, pair := range [][2]string{{"(", ")"}, {"[", "]"}} {
+			for strings.HasSuffix(u, pair[1]) && strings.Count(u, pair[0]) < strings.Count(u, pair[1]) {
+				u = strings.TrimSuffix(u, pair[1])
+			}
+		}
+		if !slices.Contains(urls, u) {
+			urls = append(urls, u)
+		}
+	}
+	return urls
+}
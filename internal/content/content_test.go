@@ -125,3 +125,68 @@ func TestExtractMentions(t *testing.T) {
 		})
 	}
 }
+
+func TestExtractURLs(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected []string
+	}{
+		{"No URLs", "Hello world!", nil},
+		{"Trailing punctuation", "See https://example.com/a?b=1.", []string{"https://example.com/a?b=1"}},
+		{"Markdown link", "[docs](https://example.com/docs) and http://x.org", []string{"https://example.com/docs", "http://x.org"}},
+		{"Balanced parens", "https://en.wikipedia.org/wiki/Go_(language)", []string{"https://en.wikipedia.org/wiki/Go_(language)"}},
+		{"Duplicates", "https://a.com https://a.com", []string{"https://a.com"}},
+		{"Other schemes", "ftp://a.com javascript:alert(1)", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ExtractURLs(tt.input)
+			if len(got) != len(tt.expected) {
+				t.Fatalf("ExtractURLs() = %v, want %v", got, tt.expected)
+			}
+			for i := range got {
+				if got[i] != tt.expected[i] {
+					t.Errorf("ExtractURLs()[%d] = %v, want %v", i, got[i], tt.expected[i])
+				}
+			}
+		})
+	}
+}
+
+func TestTokenize(t *testing.T) {
+	got := Tokenize("Wi-Fi password: Hunter2, hunter2! a Привет")
+	expected := []string{"wi", "fi", "password", "hunter2", "привет"}
+	if len(got) != len(expected) {
+		t.Fatalf("Tokenize() = %v, want %v", got, expected)
+	}
+	for i := range expected {
+		if got[i] != expected[i] {
+			t.Errorf("Tokenize()[%d] = %q, want %q", i, got[i], expected[i])
+		}
+	}
+}
+
+func TestHighlight(t *testing.T) {
+	tests := []struct {
+		name     string
+		text     string
+		terms    []string
+		radius   int
+		expected string
+	}{
+		{"Match", "the wifi password is <secret>", []string{"password"}, 100, "the wifi <mark>password</mark> is &lt;secret&gt;"},
+		{"Case insensitive", "Password and PASSWORD", []string{"password"}, 100, "<mark>Password</mark> and <mark>PASSWORD</mark>"},
+		{"Context window", "aaaa bbbb cccc dddd", []string{"cccc"}, 3, "…bb <mark>cccc</mark> dd…"},
+		{"No match", "hello world", []string{"nope"}, 2, "hell…"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Highlight(tt.text, tt.terms, tt.radius); got != tt.expected {
+				t.Errorf("Highlight() = %q, want %q", got, tt.expected)
+			}
+		})
+	}
+}
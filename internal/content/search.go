@@ -0,0 +1,106 @@
+package content
+
+import (
+	"strings"
+	"unicode"
+)
+
+const (
+	minTokenRunes = 2
+	maxTokenRunes = 64
+)
+
+type wordSpan struct {
+	start, end int // rune offsets, end exclusive
+}
+
+func wordSpans(text []rune) []wordSpan {
+	var spans []wordSpan
+	start := -1
+	for i, r := range text {
+		isWord := unicode.IsLetter(r) || unicode.IsDigit(r)
+		switch {
+		case isWord && start < 0:
+			start = i
+		case !isWord && start >= 0:
+			spans = append(spans, wordSpan{start, i})
+			start = -1
+		}
+	}
+	if start >= 0 {
+		spans = append(spans, wordSpan{start, len(text)})
+	}
+	return spans
+}
+
+func normalizeToken(word []rune) string {
+	if len(word) > maxTokenRunes {
+		word = word[:maxTokenRunes]
+	}
+	return strings.ToLower(string(word))
+}
+
+// Tokenize splits text into unique lowercase search tokens: runs of letters and
+// digits at least two characters long, truncated to 64 characters.
+func Tokenize(text string) []string {
+	runes := []rune(text)
+	seen := make(map[string]struct{})
+	var tokens []string
+	for _, s := range wordSpans(runes) {
+		if s.end-s.start < minTokenRunes {
+			continue
+		}
+		token := normalizeToken(runes[s.start:s.end])
+		if _, ok := seen[token]; ok {
+			continue
+		}
+		seen[token] = struct{}{}
+		tokens = append(tokens, token)
+	}
+	return tokens
+}
+
+// Highlight returns an HTML-escaped excerpt of plain text around the first
+// occurrence of any of terms, with up to radius characters of context on each
+// side. Words matching terms are wrapped in <mark>.
+func Highlight(text string, terms []string, radius int) string {
+	runes := []rune(text)
+	want := make(map[string]struct{}, len(terms))
+	for _, t := range terms {
+		want[t] = struct{}{}
+	}
+
+	var matches []wordSpan
+	for _, s := range wordSpans(runes) {
+		if _, ok := want[normalizeToken(runes[s.start:s.end])]; ok {
+			matches = append(matches, s)
+		}
+	}
+
+	from, to := 0, min(len(runes), 2*radius)
+	if len(matches) > 0 {
+		from = max(0, matches[0].start-radius)
+		to = min(len(runes), matches[0].end+radius)
+	}
+
+	var b strings.Builder
+	if from > 0 {
+		b.WriteString("…")
+	}
+	pos := from
+	for _, m := range matches {
+		if m.start < from || m.end > to {
+			continue
+		}
+		b.WriteString(Escape(string(runes[pos:m.start])))
+		b.WriteString("<mark>")
+		b.WriteString(Escape(string(runes[m.start:m.end])))
+		b.WriteString("</mark>")
+		pos = m.end
+	}
+	b.WriteString(Escape(string(runes[pos:to])))
+	if to < len(runes) {
+		b.WriteString("…")
+	}
+	return b.String()
+}
@@ -0,0 +1,293 @@
+// Package export writes the history of a chat to portable formats: JSON Lines
+// for machine consumption, or a zip archive with a self-contained HTML page and
+// the attachments it references.
+package export
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"log/slog"
+	"strings"
+	"time"
+
+	"besedka/internal/content"
+	"besedka/internal/models"
+	"besedka/internal/storage"
+)
+
+type Format string
+
+const (
+	FormatJSONL Format = "jsonl"
+	FormatHTML  Format = "html"
+)
+
+// batchSize is the number of messages read from storage at a time, so large
+// chats are streamed instead of loaded into memory at once.
+const batchSize = 500
+
+var ErrUnknownFormat = errors.New("unknown export format")
+
+// ParseFormat validates an export format name. An empty name means JSON Lines.
+func ParseFormat(name string) (Format, error) {
+	switch Format(name) {
+	case "", FormatJSONL:
+		return FormatJSONL, nil
+	case FormatHTML:
+		return FormatHTML, nil
+	}
+	return "", fmt.Errorf("%w: %q", ErrUnknownFormat, name)
+}
+
+// ContentType returns the MIME type of the export output.
+func (f Format) ContentType() string {
+	if f == FormatHTML {
+		return "application/zip"
+	}
+	return "application/x-ndjson"
+}
+
+// Filename returns the suggested file name for an export of chatID.
+func (f Format) Filename(chatID string) string {
+	if f == FormatHTML {
+		return "besedka-" + safeName(chatID) + ".zip"
+	}
+	return "besedka-" + safeName(chatID) + ".jsonl"
+}
+
+// Source is the subset of storage needed to export a chat.
+type Source interface {
+	ListMessages(chatID string, from, to int64) ([]models.Message, error)
+	GetFileMetadata(id string) (storage.FileMetadata, error)
+	GetFileBlob(hash string) (io.ReadCloser, error)
+}
+
+type Options struct {
+	// Chat is the exported chat. Its LastSeq bounds the export.
+	Chat models.Chat
+	// Filter drops messages the exporting user is not allowed to see.
+	// When nil all messages are exported.
+	Filter func([]models.Message) []models.Message
+	// UserNames maps user IDs to display names for the HTML archive.
+	UserNames map[string]string
+}
+
+// Write exports the chat to w in the given format.
+func Write(w io.Writer, format Format, src Source, opts Options) error {
+	if format == FormatHTML {
+		return HTMLArchive(w, src, opts)
+	}
+	return JSONLines(w, src, opts)
+}
+
+// JSONLines writes every message of the chat to w as one JSON object per line.
+func JSONLines(w io.Writer, src Source, opts Options) error {
+	enc := json.NewEncoder(w)
+	return eachMessage(src, opts, func(m models.Message) error {
+		return enc.Encode(m)
+	})
+}
+
+// HTMLArchive writes a zip archive to w with an index.html rendering the chat
+// and an attachments directory holding every file the messages reference.
+// Attachments whose blobs are gone are skipped rather than failing the export.
+func HTMLArchive(w io.Writer, src Source, opts Options) error {
+	zw := zip.NewWriter(w)
+
+	page, err := zw.Create("index.html")
+	if err != nil {
+		return fmt.Errorf("failed to create index.html: %w", err)
+	}
+
+	title := opts.Chat.Name
+	if title == "" {
+		title = opts.Chat.ID
+	}
+	if err := pageTemplate.ExecuteTemplate(page, "header", title); err != nil {
+		return fmt.Errorf("failed to render archive header: %w", err)
+	}
+
+	// Attachments are written after the page because a zip entry must be
+	// complete before the next one is started.
+	var fileIDs []string
+	paths := make(map[string]string)
+
+	err = eachMessage(src, opts, func(m models.Message) error {
+		view := messageView{
+			Author:  opts.UserNames[m.UserID],
+			Time:    time.Unix(m.Timestamp, 0).UTC().Format("2006-01-02 15:04"),
+			Edited:  m.EditedAt != 0,
+			Deleted: m.Deleted,
+			Content: template.HTML(content.FormatMessage(m.Content)),
+		}
+		if m.Sender != nil && m.Sender.Name != "" {
+			view.Author = m.Sender.Name
+		}
+		if view.Author == "" {
+			view.Author = m.UserID
+		}
+		for _, a := range m.Attachments {
+			p, ok := paths[a.FileID]
+			if !ok {
+				p = "attachments/" + safeName(a.FileID) + "-" + safeName(a.Name)
+				paths[a.FileID] = p
+				fileIDs = append(fileIDs, a.FileID)
+			}
+			view.Attachments = append(view.Attachments, attachmentView{
+				Name:  a.Name,
+				Path:  p,
+				Image: a.Type == models.AttachmentTypeImage,
+			})
+		}
+		return pageTemplate.ExecuteTemplate(page, "message", view)
+	})
+	if err != nil {
+		return err
+	}
+	if err := pageTemplate.ExecuteTemplate(page, "footer", nil); err != nil {
+		return fmt.Errorf("failed to render archive footer: %w", err)
+	}
+
+	for _, id := range fileIDs {
+		if err := addAttachment(zw, src, id, paths[id]); err != nil {
+			return err
+		}
+	}
+
+	return zw.Close()
+}
+
+func addAttachment(zw *zip.Writer, src Source, fileID, path string) error {
+	meta, err := src.GetFileMetadata(fileID)
+	if err != nil {
+		slog.Warn("export: skipping attachment without metadata", "fileID", fileID, "error", err)
+		return nil
+	}
+	blob, err := src.GetFileBlob(meta.Hash)
+	if err != nil {
+		slog.Warn("export: skipping attachment without blob", "fileID", fileID, "error", err)
+		return nil
+	}
+	defer func() { _ = blob.Close() }()
+
+	f, err := zw.CreateHeader(&zip.FileHeader{
+		Name:     path,
+		Method:   zip.Store, // attachments are mostly compressed media already
+		Modified: time.Unix(meta.CreatedAt, 0),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", path, err)
+	}
+	if _, err := io.Copy(f, blob); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return nil
+}
+
+// eachMessage calls fn for every visible message of the chat in seq order.
+// Disappearing messages that expired but are not deleted yet are skipped.
+func eachMessage(src Source, opts Options, fn func(models.Message) error) error {
+	now := time.Now().Unix()
+	last := int64(opts.Chat.LastSeq)
+	for from := int64(1); from <= last; from += batchSize {
+		to := min(from+batchSize-1, last)
+		msgs, err := src.ListMessages(opts.Chat.ID, from, to)
+		if err != nil {
+			return fmt.Errorf("failed to list messages: %w", err)
+		}
+		if opts.Filter != nil {
+			msgs = opts.Filter(msgs)
+		}
+		for _, m := range msgs {
+			if m.ExpiresAt > 0 && m.ExpiresAt <= now {
+				continue
+			}
+			if err := fn(m); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// safeName reduces name to characters that are safe in a zip entry or a
+// Content-Disposition header, so user-supplied names can't escape the archive.
+func safeName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_', r == '.':
+			return r
+		}
+		return '_'
+	}, name)
+	name = strings.TrimLeft(name, ".")
+	if name == "" {
+		return "file"
+	}
+	return name
+}
+
+type messageView struct {
+	Author      string
+	Time        string
+	Edited      bool
+	Deleted     bool
+	Content     template.HTML
+	Attachments []attachmentView
+}
+
+type attachmentView struct {
+	Name  string
+	Path  string
+	Image bool
+}
+
+var pageTemplate = template.Must(template.New("export").Parse(`
+{{- define "header" -}}
+<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.}}</title>
+<style>
+body { font-family: system-ui, sans-serif; max-width: 48rem; margin: 2rem auto; padding: 0 1rem; color: #222; }
+.msg { border-bottom: 1px solid #eee; padding: 0.5rem 0; }
+.meta { color: #777; font-size: 0.85rem; }
+.author { font-weight: bold; color: #222; }
+.deleted { color: #999; font-style: italic; }
+.msg img { max-width: 100%; max-height: 24rem; display: block; margin-top: 0.25rem; }
+pre { background: #f5f5f5; padding: 0.5rem; overflow-x: auto; }
+</style>
+</head>
+<body>
+<h1>{{.}}</h1>
+{{end -}}
+
+{{- define "message" -}}
+<div class="msg">
+<div class="meta"><span class="author">{{.Author}}</span> {{.Time}}{{if .Edited}} (edited){{end}}</div>
+{{- if .Deleted}}
+<div class="deleted">Message deleted</div>
+{{- else}}
+<div class="content">{{.Content}}</div>
+{{- range .Attachments}}
+{{- if .Image}}
+<a href="{{.Path}}"><img src="{{.Path}}" alt="{{.Name}}"></a>
+{{- else}}
+<div><a href="{{.Path}}">{{.Name}}</a></div>
+{{- end}}
+{{- end}}
+{{- end}}
+</div>
+{{end -}}
+
+{{- define "footer" -}}
+</body>
+</html>
+{{end -}}
+`))
@@ -0,0 +1,168 @@
+package export
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"besedka/internal/models"
+	"besedka/internal/storage"
+)
+
+type fakeSource struct {
+	messages []models.Message
+	files    map[string]storage.FileMetadata
+	blobs    map[string]string
+}
+
+func (f *fakeSource) ListMessages(chatID string, from, to int64) ([]models.Message, error) {
+	var out []models.Message
+	for _, m := range f.messages {
+		if m.ChatID == chatID && m.Seq >= from && m.Seq <= to {
+			out = append(out, m)
+		}
+	}
+	return out, nil
+}
+
+func (f *fakeSource) GetFileMetadata(id string) (storage.FileMetadata, error) {
+	meta, ok := f.files[id]
+	if !ok {
+		return storage.FileMetadata{}, models.ErrNotFound
+	}
+	return meta, nil
+}
+
+func (f *fakeSource) GetFileBlob(hash string) (io.ReadCloser, error) {
+	blob, ok := f.blobs[hash]
+	if !ok {
+		return nil, errors.New("blob not found")
+	}
+	return io.NopCloser(strings.NewReader(blob)), nil
+}
+
+func TestJSONLinesStreamsInBatches(t *testing.T) {
+	src := &fakeSource{}
+	total := batchSize + 3
+	for i := 1; i <= total; i++ {
+		src.messages = append(src.messages, models.Message{Seq: int64(i), ChatID: "c1", UserID: "u1", Content: "hi"})
+	}
+
+	var buf bytes.Buffer
+	err := JSONLines(&buf, src, Options{
+		Chat: models.Chat{ID: "c1", LastSeq: total},
+		Filter: func(msgs []models.Message) []models.Message {
+			// Drop every even message to check the filter is applied.
+			var out []models.Message
+			for _, m := range msgs {
+				if m.Seq%2 == 1 {
+					out = append(out, m)
+				}
+			}
+			return out
+		},
+	})
+	if err != nil {
+		t.Fatalf("JSONLines failed: %v", err)
+	}
+
+	var seqs []int64
+	sc := bufio.NewScanner(&buf)
+	for sc.Scan() {
+		var m models.Message
+		if err := json.Unmarshal(sc.Bytes(), &m); err != nil {
+			t.Fatalf("invalid line %q: %v", sc.Text(), err)
+		}
+		seqs = append(seqs, m.Seq)
+	}
+	if len(seqs) != (total+1)/2 || seqs[0] != 1 || seqs[len(seqs)-1] != int64(total) {
+		t.Errorf("unexpected seqs: %d lines, first %v", len(seqs), seqs[:3])
+	}
+}
+
+func TestHTMLArchive(t *testing.T) {
+	src := &fakeSource{
+		messages: []models.Message{
+			{Seq: 1, ChatID: "c1", UserID: "u1", Content: "**bold** <script>alert(1)</script>"},
+			{Seq: 2, ChatID: "c1", UserID: "u2", Attachments: []models.Attachment{
+				{Type: models.AttachmentTypeImage, Name: "cat.png", FileID: "f1"},
+				{Type: models.AttachmentTypeFile, Name: "../../etc/passwd", FileID: "f2"},
+				{Type: models.AttachmentTypeFile, Name: "gone.txt", FileID: "missing"},
+			}},
+			{Seq: 3, ChatID: "c1", UserID: "u1", Deleted: true},
+		},
+		files: map[string]storage.FileMetadata{
+			"f1": {ID: "f1", Hash: "h1"},
+			"f2": {ID: "f2", Hash: "h2"},
+		},
+		blobs: map[string]string{"h1": "PNGDATA", "h2": "secret"},
+	}
+
+	var buf bytes.Buffer
+	err := HTMLArchive(&buf, src, Options{
+		Chat:      models.Chat{ID: "c1", Name: "Family <3", LastSeq: 3},
+		UserNames: map[string]string{"u1": "Alice"},
+	})
+	if err != nil {
+		t.Fatalf("HTMLArchive failed: %v", err)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("invalid zip: %v", err)
+	}
+	entries := make(map[string]string)
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatalf("failed to open %s: %v", f.Name, err)
+		}
+		data, _ := io.ReadAll(rc)
+		_ = rc.Close()
+		entries[f.Name] = string(data)
+	}
+
+	page := entries["index.html"]
+	for _, want := range []string{
+		"<title>Family &lt;3</title>",
+		"<strong>bold</strong>",
+		"Alice",
+		"u2", // falls back to the ID for unknown users
+		`<img src="attachments/f1-cat.png"`,
+		"Message deleted",
+	} {
+		if !strings.Contains(page, want) {
+			t.Errorf("index.html missing %q", want)
+		}
+	}
+	if strings.Contains(page, "<script>") {
+		t.Error("index.html contains unescaped script")
+	}
+
+	if entries["attachments/f1-cat.png"] != "PNGDATA" {
+		t.Errorf("image attachment not bundled: %v", entries)
+	}
+	if entries["attachments/f2-_.._etc_passwd"] != "secret" {
+		t.Errorf("file attachment not bundled under a safe name: %v", entries)
+	}
+	if len(entries) != 3 {
+		t.Errorf("expected index and two attachments, got %d entries", len(entries))
+	}
+}
+
+func TestParseFormat(t *testing.T) {
+	if f, err := ParseFormat(""); err != nil || f != FormatJSONL {
+		t.Errorf("empty format: got %q %v", f, err)
+	}
+	if f, err := ParseFormat("html"); err != nil || f != FormatHTML {
+		t.Errorf("html format: got %q %v", f, err)
+	}
+	if _, err := ParseFormat("pdf"); !errors.Is(err, ErrUnknownFormat) {
+		t.Errorf("expected ErrUnknownFormat, got %v", err)
+	}
+}
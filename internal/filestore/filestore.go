@@ -15,4 +15,7 @@ type FileStore interface {
 
 	// Replace forcefully saves the file content with the given hash, ignoring idempotency checks.
 	Replace(r io.Reader, hash string) error
+
+	// Delete removes the file content for the given hash. A missing file is not an error.
+	Delete(hash string) error
 }
@@ -109,6 +109,13 @@ func (s *LocalFileStore) Get(hash string) (io.ReadCloser, error) {
 	return f, nil
 }
 
+func (s *LocalFileStore) Delete(hash string) error {
+	if err := os.Remove(s.getPath(hash)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to delete file %s: %w", hash, err)
+	}
+	return nil
+}
+
 // Walk calls fn with the hash (filename) of every stored blob. It walks the
 // two-level prefix layout (root/<hash[:2]>/<hash>), skipping in-progress temp
 // files. Iteration stops if fn returns an error.
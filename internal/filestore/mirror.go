@@ -110,6 +110,20 @@ func (m *MirrorFileStore) Get(hash string) (io.ReadCloser, error) {
 	return m.local.Get(hash)
 }
 
+// Delete removes the blob from local disk and then from object storage, so
+// it is not recovered from there on the next local miss.
+func (m *MirrorFileStore) Delete(hash string) error {
+	if err := m.local.Delete(hash); err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), mirrorGetTimeout)
+	defer cancel()
+	if err := m.obj.Delete(ctx, m.prefix+hash); err != nil {
+		return fmt.Errorf("mirror: failed to delete blob %s from object storage: %w", hash, err)
+	}
+	return nil
+}
+
 // Start launches the upload worker pool and the periodic backfill of local
 // files missing from object storage, then blocks until ctx is cancelled and
 // the workers exit. It is intended to run inside the application's errgroup.
@@ -178,6 +192,13 @@ func (m *MirrorFileStore) upload(ctx context.Context, hash string) {
 	}
 }
 
+// Upload synchronously uploads a local blob to object storage, replacing the
+// copy stored there. It is for offline tools that rewrite blobs in place and
+// do not run the upload workers.
+func (m *MirrorFileStore) Upload(ctx context.Context, hash string) error {
+	return m.uploadHash(ctx, hash)
+}
+
 // uploadHash reads a local blob and uploads it to object storage.
 func (m *MirrorFileStore) uploadHash(ctx context.Context, hash string) error {
 	rc, err := m.local.Get(hash)
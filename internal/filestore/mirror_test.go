@@ -182,6 +182,29 @@ func TestMirrorGetMissingEverywhere(t *testing.T) {
 	}
 }
 
+func TestMirrorDelete(t *testing.T) {
+	fake := newFakeS3("testbucket")
+	m, local := newMirrorForTest(t, fake)
+
+	if err := local.Save(bytes.NewReader([]byte("doomed")), "dead"); err != nil {
+		t.Fatal(err)
+	}
+	fake.put("files/dead", []byte("doomed"))
+
+	if err := m.Delete("dead"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, ok := fake.get("files/dead"); ok {
+		t.Error("expected the object storage copy to be deleted")
+	}
+	if _, err := m.Get("dead"); err == nil {
+		t.Error("expected the blob to be gone everywhere")
+	}
+	if err := m.Delete("dead"); err != nil {
+		t.Errorf("expected deleting a missing blob to succeed, got %v", err)
+	}
+}
+
 func TestMirrorBackfill(t *testing.T) {
 	fake := newFakeS3("testbucket")
 	m, local := newMirrorForTest(t, fake)
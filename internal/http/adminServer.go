@@ -3,6 +3,7 @@ package http
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"html/template"
 	"io/fs"
@@ -10,8 +11,10 @@ import (
 	"net/http"
 	"net/url"
 	"os"
+	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	"besedka/internal/api"
 	"besedka/internal/auth"
@@ -57,28 +60,19 @@ func (s *AdminServer) SetOps(
 
 func NewAdminServer(cfg *config.Config, authService *auth.AuthService, hub *ws.Hub, store *storage.BboltStorage, assets fs.FS) *AdminServer {
 	// Parse admin template
-	tmpl, err := template.ParseFS(assets, "admin.html")
+	tmpl, err := template.New("admin.html").Funcs(template.FuncMap{
+		"unixTime": func(ts int64) string {
+			return time.Unix(ts, 0).UTC().Format("2006-01-02 15:04:05")
+		},
+	}).ParseFS(assets, "admin.html")
 	if err != nil {
 		slog.Error("failed to parse admin template", "error", err)
 		os.Exit(1)
 	}
 
-	adminHandler := api.NewAdminHandler(authService, hub, store, cfg.BaseURL, cfg.MaxAvatarSize)
+	adminHandler := api.NewAdminHandler(authService, hub, store, cfg.BaseURL, cfg.MaxAvatarSize, cfg.RetentionPolicy())
 	mux := http.NewServeMux()
 
-	// Basic Auth Middleware
-	withBasicAuth := func(next http.HandlerFunc) http.HandlerFunc {
-		return func(w http.ResponseWriter, r *http.Request) {
-			user, pass, ok := r.BasicAuth()
-			if !ok || user != cfg.AdminUser || pass != cfg.AdminPassword {
-				w.Header().Set("WWW-Authenticate", `Basic realm="Restricted"`)
-				http.Error(w, "Unauthorized", http.StatusUnauthorized)
-				return
-			}
-			next(w, r)
-		}
-	}
-
 	// UI Handlers
 
 	// Wait, to call s.handleListUsers, s must exist.
@@ -92,23 +86,94 @@ func NewAdminServer(cfg *config.Config, authService *auth.AuthService, hub *ws.H
 		chatName:     cfg.ChatName,
 	}
 
+	// Admin auth middleware. Requests without a valid admin token get the
+	// login page, or a 401 for the JSON API. Changes made by an admin, and
+	// exports, are recorded in the audit log.
+	withAdminAuth := func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			admin, ok := adminHandler.AuthenticateAdmin(r)
+			if !ok {
+				if strings.HasPrefix(r.URL.Path, "/api/") {
+					writeJSONResp(w, http.StatusUnauthorized, models.APIResponse{
+						Success: false,
+						Message: "Unauthorized",
+					})
+					return
+				}
+				s.renderLogin(w, http.StatusUnauthorized, "")
+				return
+			}
+
+			rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+			next(rec, r.WithContext(api.WithAdmin(r.Context(), admin)))
+
+			if r.Method != http.MethodGet || r.URL.Path == "/api/export" {
+				authService.RecordAdminAction(models.AdminAuditEntry{
+					AdminID:   admin.ID,
+					AdminName: admin.UserName,
+					Action:    r.Method + " " + r.URL.RequestURI(),
+					Status:    rec.status,
+					IP:        auth.ClientInfoFromRequest(r).IP,
+				})
+			}
+		}
+	}
+
 	// UI Handlers
-	mux.HandleFunc("GET /", withBasicAuth(s.handleListUsers))
-	mux.HandleFunc("POST /admin/users", withBasicAuth(s.handleAddUser))
-	mux.HandleFunc("POST /admin/users/delete", withBasicAuth(s.handleDeleteUser))
-	mux.HandleFunc("POST /admin/users/reset", withBasicAuth(s.handleResetUser))
+	mux.HandleFunc("GET /", withAdminAuth(s.handleListUsers))
+	mux.HandleFunc("POST /admin/login", s.handleLogin)
+	mux.HandleFunc("POST /admin/logout", withAdminAuth(s.handleLogout))
+	mux.HandleFunc("POST /admin/users", withAdminAuth(s.handleAddUser))
+	mux.HandleFunc("POST /admin/users/delete", withAdminAuth(s.handleDeleteUser))
+	mux.HandleFunc("POST /admin/users/reset", withAdminAuth(s.handleResetUser))
+	mux.HandleFunc("POST /admin/users/logout", withAdminAuth(s.handleLogoutUser))
+
+	// Admin account handlers
+	mux.HandleFunc("POST /api/admins/bootstrap", adminHandler.BootstrapAdminHandler)
+	mux.HandleFunc("POST /api/admins/login", adminHandler.AdminLoginHandler)
+	mux.HandleFunc("POST /api/admins/logout", withAdminAuth(adminHandler.AdminLogoutHandler))
+	mux.HandleFunc("GET /api/admins", withAdminAuth(adminHandler.ListAdminsHandler))
+	mux.HandleFunc("POST /api/admins", withAdminAuth(adminHandler.AddAdminHandler))
+	mux.HandleFunc("DELETE /api/admins", withAdminAuth(adminHandler.DeleteAdminHandler))
+	mux.HandleFunc("GET /api/admins/audit", withAdminAuth(adminHandler.AdminAuditHandler))
+	mux.HandleFunc("GET /api/admins/passkeys", withAdminAuth(adminHandler.ListAdminPasskeysHandler))
+	mux.HandleFunc("DELETE /api/admins/passkeys", withAdminAuth(adminHandler.DeleteAdminPasskeyHandler))
+	mux.HandleFunc("POST /api/admins/webauthn/register/begin", withAdminAuth(adminHandler.AdminPasskeyRegisterBeginHandler))
+	mux.HandleFunc("POST /api/admins/webauthn/register/finish", withAdminAuth(adminHandler.AdminPasskeyRegisterFinishHandler))
+	mux.HandleFunc("POST /api/admins/webauthn/login/begin", adminHandler.AdminPasskeyLoginBeginHandler)
+	mux.HandleFunc("POST /api/admins/webauthn/login/finish", adminHandler.AdminPasskeyLoginFinishHandler)
 
 	// API Handlers
-	mux.HandleFunc("GET /api/users", withBasicAuth(s.handleListUsersJSON))
-	mux.HandleFunc("POST /api/users", withBasicAuth(adminHandler.AddUserHandler))
-	mux.HandleFunc("DELETE /api/users", withBasicAuth(adminHandler.DeleteUserHandler))
-	mux.HandleFunc("POST /api/users/reset-password", withBasicAuth(adminHandler.ResetUserPasswordHandler))
-	mux.HandleFunc("POST /api/users/reset-key", withBasicAuth(adminHandler.ResetAPIKeyHandler))
-	mux.HandleFunc("POST /api/users/set-avatar", withBasicAuth(adminHandler.SetUserAvatarHandler))
+	mux.HandleFunc("GET /api/users", withAdminAuth(s.handleListUsersJSON))
+	mux.HandleFunc("POST /api/users", withAdminAuth(adminHandler.AddUserHandler))
+	mux.HandleFunc("DELETE /api/users", withAdminAuth(adminHandler.DeleteUserHandler))
+	mux.HandleFunc("POST /api/users/reset-password", withAdminAuth(adminHandler.ResetUserPasswordHandler))
+	mux.HandleFunc("POST /api/users/reset-key", withAdminAuth(adminHandler.ResetAPIKeyHandler))
+	mux.HandleFunc("GET /api/users/api-keys", withAdminAuth(adminHandler.ListAPIKeysHandler))
+	mux.HandleFunc("POST /api/users/api-keys", withAdminAuth(adminHandler.CreateAPIKeyHandler))
+	mux.HandleFunc("DELETE /api/users/api-keys", withAdminAuth(adminHandler.RevokeAPIKeyHandler))
+	mux.HandleFunc("GET /api/users/sessions", withAdminAuth(adminHandler.UserSessionsHandler))
+	mux.HandleFunc("DELETE /api/users/sessions", withAdminAuth(adminHandler.RevokeUserSessionsHandler))
+	mux.HandleFunc("POST /api/users/set-avatar", withAdminAuth(adminHandler.SetUserAvatarHandler))
+	mux.HandleFunc("POST /api/users/callback-url", withAdminAuth(adminHandler.SetBotCallbackURLHandler))
+	mux.HandleFunc("POST /api/users/scopes", withAdminAuth(adminHandler.SetBotScopesHandler))
+	mux.HandleFunc("GET /api/users/webhook-chats", withAdminAuth(adminHandler.WebhookChatsHandler))
+	mux.HandleFunc("POST /api/users/webhook-chats", withAdminAuth(adminHandler.SetWebhookChatsHandler))
+	mux.HandleFunc("GET /api/bots/deliveries", withAdminAuth(adminHandler.BotDeliveriesHandler))
+	mux.HandleFunc("GET /api/commands", withAdminAuth(adminHandler.ListCommandsHandler))
+	mux.HandleFunc("POST /api/commands", withAdminAuth(adminHandler.RegisterCommandHandler))
+	mux.HandleFunc("DELETE /api/commands", withAdminAuth(adminHandler.UnregisterCommandHandler))
+	mux.HandleFunc("DELETE /api/messages", withAdminAuth(adminHandler.DeleteMessageHandler))
+	mux.HandleFunc("DELETE /api/chats/members", withAdminAuth(adminHandler.RemoveGroupMemberHandler))
+	mux.HandleFunc("GET /api/export", withAdminAuth(adminHandler.ExportChatHandler))
+	mux.HandleFunc("GET /api/keys/status", withAdminAuth(adminHandler.KeyStatusHandler))
+	mux.HandleFunc("GET /api/chats/retention", withAdminAuth(adminHandler.ListRetentionHandler))
+	mux.HandleFunc("POST /api/chats/retention", withAdminAuth(adminHandler.SetRetentionHandler))
+	mux.HandleFunc("DELETE /api/chats/retention", withAdminAuth(adminHandler.ResetRetentionHandler))
 
 	// Server-control handlers
-	mux.HandleFunc("POST /api/backup", withBasicAuth(s.handleBackup))
-	mux.HandleFunc("POST /api/shutdown", withBasicAuth(s.handleShutdown))
+	mux.HandleFunc("POST /api/backup", withAdminAuth(s.handleBackup))
+	mux.HandleFunc("POST /api/shutdown", withAdminAuth(s.handleShutdown))
 
 	addr := cfg.AdminAddr
 	if addr == "" {
@@ -123,21 +188,98 @@ func NewAdminServer(cfg *config.Config, authService *auth.AuthService, hub *ws.H
 	return s
 }
 
-func (s *AdminServer) handleListUsers(w http.ResponseWriter, r *http.Request) {
+// statusRecorder remembers the status code of a response for the audit log.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Flush() {
+	flush(r.ResponseWriter)
+}
+
+// auditPageSize is how many audit log entries the admin page shows.
+const auditPageSize = 20
+
+// renderLogin shows the admin login form. Until the first admin is created
+// it explains how to bootstrap one instead.
+func (s *AdminServer) renderLogin(w http.ResponseWriter, status int, loginError string) {
+	data := map[string]any{
+		"ChatName": s.chatName,
+		"Login":    true,
+		"NoAdmins": !s.authService.HasAdmins(),
+		"Error":    loginError,
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	if err := s.tmpl.Execute(w, data); err != nil {
+		slog.Error("failed to execute template", "error", err)
+	}
+}
+
+// renderPage shows the admin page with the users, the signed-in admin and
+// the latest audit log entries, on top of the given data.
+func (s *AdminServer) renderPage(w http.ResponseWriter, r *http.Request, data map[string]any) {
+	data["ChatName"] = s.chatName
 	users, err := s.authService.GetAllUsers()
 	if err != nil {
-		http.Error(w, "Failed to get users", http.StatusInternalServerError)
-		return
+		data["Error"] = "Failed to get users"
 	}
-	data := map[string]any{
-		"ChatName": s.chatName,
-		"Users":    users,
+	data["Users"] = users
+	if admin, ok := api.AdminFromContext(r.Context()); ok {
+		data["Admin"] = admin.UserName
+	}
+	if entries, err := s.authService.AdminAudit("", auditPageSize); err == nil {
+		data["Audit"] = entries
 	}
 	if err := s.tmpl.Execute(w, data); err != nil {
 		slog.Error("failed to execute template", "error", err)
 	}
 }
 
+// handleLogin signs the admin UI in with a password and TOTP.
+func (s *AdminServer) handleLogin(w http.ResponseWriter, r *http.Request) {
+	username := r.FormValue("username")
+	totp, _ := strconv.Atoi(strings.TrimSpace(r.FormValue("totp")))
+	rawToken, token, err := s.authService.AdminLogin(auth.AdminLoginRequest{
+		Username: username,
+		Password: r.FormValue("password"),
+		TOTP:     totp,
+		Client:   auth.ClientInfoFromRequest(r),
+	})
+	if err != nil {
+		s.adminHandler.RecordLogin(r, auth.Admin{}, username, http.StatusUnauthorized)
+		message := "Login failed"
+		if errors.Is(err, auth.ErrTooManyAttempts) {
+			message = err.Error()
+		}
+		s.renderLogin(w, http.StatusUnauthorized, message)
+		return
+	}
+	admin, _ := s.authService.GetAdmin(token.AdminID)
+	s.adminHandler.RecordLogin(r, admin, username, http.StatusOK)
+	s.adminHandler.SetAdminTokenCookie(w, token, rawToken)
+	http.Redirect(w, r, "/", http.StatusFound)
+}
+
+// handleLogout signs the admin UI out.
+func (s *AdminServer) handleLogout(w http.ResponseWriter, r *http.Request) {
+	if c, err := r.Cookie(api.AdminTokenCookie); err == nil {
+		s.authService.AdminLogout(c.Value)
+	}
+	s.adminHandler.ClearAdminTokenCookie(w)
+	http.Redirect(w, r, "/", http.StatusFound)
+}
+
+func (s *AdminServer) handleListUsers(w http.ResponseWriter, r *http.Request) {
+	s.renderPage(w, r, map[string]any{})
+}
+
 func (s *AdminServer) handleListUsersJSON(w http.ResponseWriter, r *http.Request) {
 	users, err := s.authService.GetAllUsers()
 	if err != nil {
@@ -236,21 +378,14 @@ func (s *AdminServer) handleAddUser(w http.ResponseWriter, r *http.Request) {
 
 	token, err := s.authService.AddUser(username, username)
 
-	data := map[string]any{"ChatName": s.chatName}
+	data := map[string]any{}
 	if err != nil {
 		data["Error"] = err.Error()
 	} else {
 		base := strings.TrimRight(s.baseURL, "/")
 		data["NewLink"] = fmt.Sprintf("%s/register.html?token=%s", base, url.QueryEscape(token))
 	}
-
-	// Refresh user list
-	users, _ := s.authService.GetAllUsers()
-	data["Users"] = users
-
-	if err := s.tmpl.Execute(w, data); err != nil {
-		slog.Error("failed to execute template", "error", err)
-	}
+	s.renderPage(w, r, data)
 }
 
 func (s *AdminServer) handleDeleteUser(w http.ResponseWriter, r *http.Request) {
@@ -263,9 +398,18 @@ func (s *AdminServer) handleDeleteUser(w http.ResponseWriter, r *http.Request) {
 	http.Redirect(w, r, "/", http.StatusFound)
 }
 
+func (s *AdminServer) handleLogoutUser(w http.ResponseWriter, r *http.Request) {
+	userID := r.FormValue("id")
+	if userID != "" {
+		s.authService.RevokeSessions(userID)
+		s.hub.DisconnectUser(userID)
+	}
+	http.Redirect(w, r, "/", http.StatusFound)
+}
+
 func (s *AdminServer) handleResetUser(w http.ResponseWriter, r *http.Request) {
 	userID := r.FormValue("id")
-	data := map[string]any{"ChatName": s.chatName}
+	data := map[string]any{}
 	if userID == "" {
 		data["Error"] = "User ID is required"
 	} else {
@@ -278,14 +422,7 @@ func (s *AdminServer) handleResetUser(w http.ResponseWriter, r *http.Request) {
 			data["NewLink"] = fmt.Sprintf("%s/register.html?token=%s", base, url.QueryEscape(token))
 		}
 	}
-
-	// Refresh user list
-	users, _ := s.authService.GetAllUsers()
-	data["Users"] = users
-
-	if err := s.tmpl.Execute(w, data); err != nil {
-		slog.Error("failed to execute template", "error", err)
-	}
+	s.renderPage(w, r, data)
 }
 
 func (s *AdminServer) Server() *http.Server {
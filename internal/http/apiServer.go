@@ -47,10 +47,28 @@ func NewAPIServer(cfg *config.Config, authService *auth.AuthService, hub *ws.Hub
 	mux.HandleFunc("POST /api/register", api.RequireSameOrigin(apiHandlers.RegisterHandler))
 	mux.HandleFunc("GET /api/register-info", apiHandlers.RegisterInfoHandler)
 	mux.HandleFunc("POST /api/reset-password", apiHandlers.RequireAuth(api.RequireSameOrigin(apiHandlers.ResetPasswordHandler)))
+	mux.HandleFunc("POST /api/recovery-codes", apiHandlers.RequireAuth(api.RequireSameOrigin(api.RequireUserTypes(apiHandlers.RecoveryCodesHandler, models.UserTypeHuman))))
 	mux.HandleFunc("GET /api/users", apiHandlers.RequireAuth(apiHandlers.UsersHandler))
 	mux.HandleFunc("GET /api/chats", apiHandlers.RequireAuth(apiHandlers.ChatsHandler))
 	mux.HandleFunc("GET /api/chats/{id}/messages", apiHandlers.RequireAuth(api.RequireUserTypes(apiHandlers.ChatMessagesHandler, models.UserTypeHuman, models.UserTypeBot)))
 	mux.HandleFunc("POST /api/chats/{id}/messages", apiHandlers.RequireAuth(api.RequireSameOrigin(api.RequireUserTypes(apiHandlers.SendMessageHandler, models.UserTypeHuman, models.UserTypeBot))))
+	mux.HandleFunc("GET /api/chats/{id}/messages/{seq}/replies", apiHandlers.RequireAuth(api.RequireUserTypes(apiHandlers.RepliesHandler, models.UserTypeHuman, models.UserTypeBot)))
+	mux.HandleFunc("PUT /api/chats/{id}/messages/{seq}", apiHandlers.RequireAuth(api.RequireSameOrigin(api.RequireUserTypes(apiHandlers.EditMessageHandler, models.UserTypeHuman, models.UserTypeBot))))
+	mux.HandleFunc("DELETE /api/chats/{id}/messages/{seq}", apiHandlers.RequireAuth(api.RequireSameOrigin(api.RequireUserTypes(apiHandlers.DeleteMessageHandler, models.UserTypeHuman, models.UserTypeBot))))
+	mux.HandleFunc("GET /api/search", apiHandlers.RequireAuth(api.RequireUserTypes(apiHandlers.SearchHandler, models.UserTypeHuman, models.UserTypeBot)))
+	mux.HandleFunc("GET /api/chats/{id}/pins", apiHandlers.RequireAuth(api.RequireUserTypes(apiHandlers.PinsHandler, models.UserTypeHuman, models.UserTypeBot)))
+	mux.HandleFunc("GET /api/chats/{id}/export", apiHandlers.RequireAuth(api.RequireUserTypes(apiHandlers.ExportHandler, models.UserTypeHuman, models.UserTypeBot)))
+	mux.HandleFunc("PUT /api/chats/{id}/pins/{seq}", apiHandlers.RequireAuth(api.RequireSameOrigin(api.RequireUserTypes(apiHandlers.PinMessageHandler, models.UserTypeHuman))))
+	mux.HandleFunc("DELETE /api/chats/{id}/pins/{seq}", apiHandlers.RequireAuth(api.RequireSameOrigin(api.RequireUserTypes(apiHandlers.UnpinMessageHandler, models.UserTypeHuman))))
+	mux.HandleFunc("PUT /api/bots/{id}/dm-access", apiHandlers.RequireAuth(api.RequireSameOrigin(api.RequireUserTypes(apiHandlers.GrantDMAccessHandler, models.UserTypeHuman))))
+	mux.HandleFunc("DELETE /api/bots/{id}/dm-access", apiHandlers.RequireAuth(api.RequireSameOrigin(api.RequireUserTypes(apiHandlers.RevokeDMAccessHandler, models.UserTypeHuman))))
+	mux.HandleFunc("GET /api/commands", apiHandlers.RequireAuth(api.RequireUserTypes(apiHandlers.CommandsHandler, models.UserTypeHuman, models.UserTypeBot)))
+	mux.HandleFunc("POST /api/commands/{id}/reply", apiHandlers.RequireAuth(api.RequireSameOrigin(api.RequireUserTypes(apiHandlers.CommandReplyHandler, models.UserTypeBot))))
+	mux.HandleFunc("POST /api/chats", apiHandlers.RequireAuth(api.RequireSameOrigin(api.RequireUserTypes(apiHandlers.CreateGroupHandler, models.UserTypeHuman))))
+	mux.HandleFunc("POST /api/chats/{id}/name", apiHandlers.RequireAuth(api.RequireSameOrigin(api.RequireUserTypes(apiHandlers.RenameGroupHandler, models.UserTypeHuman))))
+	mux.HandleFunc("POST /api/chats/{id}/members", apiHandlers.RequireAuth(api.RequireSameOrigin(api.RequireUserTypes(apiHandlers.AddGroupMemberHandler, models.UserTypeHuman))))
+	mux.HandleFunc("DELETE /api/chats/{id}/members/{userId}", apiHandlers.RequireAuth(api.RequireSameOrigin(api.RequireUserTypes(apiHandlers.RemoveGroupMemberHandler, models.UserTypeHuman))))
+	mux.HandleFunc("POST /api/chats/{id}/timer", apiHandlers.RequireAuth(api.RequireSameOrigin(api.RequireUserTypes(apiHandlers.SetTimerHandler, models.UserTypeHuman))))
 	mux.HandleFunc("GET /api/me", apiHandlers.RequireAuth(apiHandlers.MeHandler))
 	mux.HandleFunc("POST /api/users/me/avatar", apiHandlers.RequireAuth(api.RequireSameOrigin(apiHandlers.UploadAvatarHandler)))
 	mux.HandleFunc("POST /api/users/me/display-name", apiHandlers.RequireAuth(api.RequireSameOrigin(apiHandlers.UpdateDisplayNameHandler)))
@@ -64,6 +82,8 @@ func NewAPIServer(cfg *config.Config, authService *auth.AuthService, hub *ws.Hub
 	mux.HandleFunc("GET /api/images/{id}", apiHandlers.RequireAuth(apiHandlers.GetImageHandler))
 	mux.HandleFunc("GET /api/files/{id}", apiHandlers.RequireAuth(apiHandlers.GetFileHandler))
 	mux.HandleFunc("POST /api/webhook", apiHandlers.RequireAuth(api.RequireSameOrigin(api.RequireUserTypes(apiHandlers.WebhookHandler, models.UserTypeWebhook))))
+	mux.HandleFunc("POST /api/webhook/slack/{key}", api.APIKeyFromPath(apiHandlers.RequireAuth(api.RequireSameOrigin(api.RequireUserTypes(apiHandlers.SlackWebhookHandler, models.UserTypeWebhook)))))
+	mux.HandleFunc("POST /api/webhook/discord/{key}", api.APIKeyFromPath(apiHandlers.RequireAuth(api.RequireSameOrigin(api.RequireUserTypes(apiHandlers.DiscordWebhookHandler, models.UserTypeWebhook)))))
 
 	// Push notification endpoints
 	mux.HandleFunc("GET /api/push/vapidPublicKey", apiHandlers.RequireAuth(apiHandlers.PushVAPIDPublicKeyHandler))
@@ -71,10 +91,14 @@ func NewAPIServer(cfg *config.Config, authService *auth.AuthService, hub *ws.Hub
 	// WebAuthn endpoints
 	mux.HandleFunc("POST /api/webauthn/register/begin", api.RequireSameOrigin(apiHandlers.RequireAuth(apiHandlers.WebAuthnRegisterBeginHandler)))
 	mux.HandleFunc("POST /api/webauthn/register/finish", api.RequireSameOrigin(apiHandlers.RequireAuth(apiHandlers.WebAuthnRegisterFinishHandler)))
+	mux.HandleFunc("POST /api/webauthn/setup/begin", api.RequireSameOrigin(apiHandlers.WebAuthnSetupBeginHandler))
+	mux.HandleFunc("POST /api/webauthn/setup/finish", api.RequireSameOrigin(apiHandlers.WebAuthnSetupFinishHandler))
 	mux.HandleFunc("POST /api/webauthn/login/begin", api.RequireSameOrigin(apiHandlers.WebAuthnLoginBeginHandler))
 	mux.HandleFunc("POST /api/webauthn/login/finish", api.RequireSameOrigin(apiHandlers.WebAuthnLoginFinishHandler))
 	mux.HandleFunc("GET /api/webauthn/passkeys", apiHandlers.RequireAuth(apiHandlers.ListPasskeysHandler))
 	mux.HandleFunc("DELETE /api/webauthn/passkeys/{id}", api.RequireSameOrigin(apiHandlers.RequireAuth(apiHandlers.DeletePasskeyHandler)))
+	mux.HandleFunc("GET /api/sessions", apiHandlers.RequireAuth(apiHandlers.SessionsHandler))
+	mux.HandleFunc("DELETE /api/sessions/{id}", api.RequireSameOrigin(apiHandlers.RequireAuth(apiHandlers.RevokeSessionHandler)))
 	mux.HandleFunc("POST /api/push/subscribe", apiHandlers.RequireAuth(apiHandlers.PushSubscribeHandler))
 
 	// WebSocket endpoint
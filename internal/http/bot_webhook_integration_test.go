@@ -105,12 +105,15 @@ func TestBotAndWebhookHappyPathIntegration(t *testing.T) {
 	hub := ws.NewHub(context.Background(), as, st, pushSvc)
 
 	cfg := &config.Config{
-		AuthSecret:    "test-secret-key-32-bytes-length!",
-		AdminUser:     "admin",
-		AdminPassword: "adminpassword",
-		MaxImageSize:  10 * 1024 * 1024,
-		MaxFileSize:   25 * 1024 * 1024,
-		ChatName:      "Besedka Test",
+		AuthSecret:   "test-secret-key-32-bytes-length!",
+		MaxImageSize: 10 * 1024 * 1024,
+		MaxFileSize:  25 * 1024 * 1024,
+		ChatName:     "Besedka Test",
+	}
+
+	_, adminToken, _, err := as.BootstrapAdmin(as.BootstrapToken(), "admin", "adminpassword", auth.ClientInfo{})
+	if err != nil {
+		t.Fatalf("failed to bootstrap admin: %v", err)
 	}
 
 	mockAssets := fstest.MapFS{
@@ -139,7 +142,7 @@ func TestBotAndWebhookHappyPathIntegration(t *testing.T) {
 		},
 	})
 	reqAddBot, _ := http.NewRequest(http.MethodPost, adminServer.URL+"/admin/users", bytes.NewReader(botReqBody))
-	reqAddBot.SetBasicAuth("admin", "adminpassword")
+	reqAddBot.Header.Set("Authorization", "Bearer "+adminToken)
 	reqAddBot.Header.Set("Content-Type", "application/json")
 
 	respAddBot, err := client.Do(reqAddBot)
@@ -161,7 +164,7 @@ func TestBotAndWebhookHappyPathIntegration(t *testing.T) {
 		DisplayName: "Integration Human",
 	})
 	reqAddHuman, _ := http.NewRequest(http.MethodPost, adminServer.URL+"/admin/users", bytes.NewReader(humanReqBody))
-	reqAddHuman.SetBasicAuth("admin", "adminpassword")
+	reqAddHuman.Header.Set("Authorization", "Bearer "+adminToken)
 	reqAddHuman.Header.Set("Content-Type", "application/json")
 
 	respAddHuman, err := client.Do(reqAddHuman)
@@ -273,7 +276,7 @@ func TestBotAndWebhookHappyPathIntegration(t *testing.T) {
 		Target:      "townhall",
 	})
 	reqAddWh, _ := http.NewRequest(http.MethodPost, adminServer.URL+"/admin/users", bytes.NewReader(whReqBody))
-	reqAddWh.SetBasicAuth("admin", "adminpassword")
+	reqAddWh.Header.Set("Authorization", "Bearer "+adminToken)
 	reqAddWh.Header.Set("Content-Type", "application/json")
 
 	respAddWh, err := client.Do(reqAddWh)
@@ -53,8 +53,8 @@ func (m *mockStorage) ListAllCredentials() ([]auth.UserCredentials, error) {
 	return list, nil
 }
 
-func (m *mockStorage) UpsertToken(userID string, tokenHash string) error {
-	m.tokens[tokenHash] = userID
+func (m *mockStorage) UpsertSession(session auth.Session) error {
+	m.tokens[session.TokenHash] = session.UserID
 	return nil
 }
 
@@ -63,8 +63,12 @@ func (m *mockStorage) DeleteToken(tokenHash string) error {
 	return nil
 }
 
-func (m *mockStorage) ListTokens() (map[string]string, error) {
-	return m.tokens, nil
+func (m *mockStorage) ListSessions() ([]auth.Session, error) {
+	var sessions []auth.Session
+	for tokenHash, userID := range m.tokens {
+		sessions = append(sessions, auth.Session{UserID: userID, TokenHash: tokenHash})
+	}
+	return sessions, nil
 }
 
 func (m *mockStorage) UpsertRegistrationToken(userID string, token string) error {
@@ -81,7 +85,7 @@ func (m *mockStorage) ListRegistrationTokens() (map[string]string, error) {
 	return m.regTokens, nil
 }
 
-func (m *mockStorage) UpsertAPIKey(userID string, keyHash string) error {
+func (m *mockStorage) UpsertAPIKey(key auth.APIKey) error {
 	return nil
 }
 
@@ -89,8 +93,8 @@ func (m *mockStorage) DeleteAPIKey(keyHash string) error {
 	return nil
 }
 
-func (m *mockStorage) ListAPIKeys() (map[string]string, error) {
-	return make(map[string]string), nil
+func (m *mockStorage) ListAPIKeys() ([]auth.APIKey, error) {
+	return nil, nil
 }
 
 func (m *mockStorage) UpsertPasskey(cred auth.Passkey) error {
@@ -109,6 +113,38 @@ func (m *mockStorage) DeleteAllPasskeys(userID string) error {
 	return nil
 }
 
+func (m *mockStorage) UpsertAdmin(admin auth.Admin) error {
+	return nil
+}
+
+func (m *mockStorage) DeleteAdmin(adminID string) error {
+	return nil
+}
+
+func (m *mockStorage) ListAdmins() ([]auth.Admin, error) {
+	return nil, nil
+}
+
+func (m *mockStorage) UpsertAdminToken(token auth.AdminToken) error {
+	return nil
+}
+
+func (m *mockStorage) DeleteAdminToken(tokenHash string) error {
+	return nil
+}
+
+func (m *mockStorage) ListAdminTokens() ([]auth.AdminToken, error) {
+	return nil, nil
+}
+
+func (m *mockStorage) AddAdminAuditEntry(entry models.AdminAuditEntry) error {
+	return nil
+}
+
+func (m *mockStorage) ListAdminAuditEntries(adminID string, limit int) ([]models.AdminAuditEntry, error) {
+	return nil, nil
+}
+
 func hashToken(token string) string {
 	h := hmac.New(sha512.New, []byte("server-secret"))
 	h.Write([]byte(token))
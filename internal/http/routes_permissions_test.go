@@ -79,7 +79,7 @@ func TestWebhookPermissionsOnActualRoutes(t *testing.T) {
 	tsURL, as, _, _, cleanup := setupTestAPIServer(t)
 	defer cleanup()
 
-	_, webhookKey, err := as.AddWebhook("wh_route_test", "Webhook Route Test", "townhall")
+	_, webhookKey, err := as.AddWebhook("wh_route_test", "Webhook Route Test", []string{"townhall"})
 	if err != nil {
 		t.Fatalf("AddWebhook failed: %v", err)
 	}
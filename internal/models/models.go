@@ -23,6 +23,32 @@ type ResetPasswordResponse struct {
 	SetupLink string `json:"setupLink"`
 }
 
+// RecoveryCodesResponse carries a new set of recovery codes, shown once.
+type RecoveryCodesResponse struct {
+	APIResponse
+	RecoveryCodes []string `json:"recoveryCodes"`
+}
+
+// SessionInfo describes a login session of a user.
+type SessionInfo struct {
+	ID           string `json:"id"`
+	CreatedAt    int64  `json:"createdAt,omitempty"` // Unix timestamp (seconds), missing for sessions started before it was recorded
+	LastActiveAt int64  `json:"lastActiveAt"`        // Unix timestamp (seconds)
+	UserAgent    string `json:"userAgent,omitempty"`
+	IP           string `json:"ip,omitempty"`
+	Current      bool   `json:"current,omitempty"` // The session of the request
+}
+
+// AdminAuditEntry records an action taken by an admin on the admin server.
+type AdminAuditEntry struct {
+	Time      int64  `json:"time"`    // Unix timestamp (seconds)
+	AdminID   string `json:"adminId"` // Empty for failed logins of unknown admins
+	AdminName string `json:"adminName"`
+	Action    string `json:"action"` // E.g. "login" or "DELETE /api/users?id=..."
+	Status    int    `json:"status"` // HTTP status of the response
+	IP        string `json:"ip,omitempty"`
+}
+
 // UploadImageResponse represents a response for an image upload operation.
 type UploadImageResponse struct {
 	ID string `json:"id"`
@@ -55,6 +81,12 @@ type BotPermissions struct {
 	Write        bool `json:"write"`
 }
 
+// ChatScope grants a bot permissions in a single chat.
+type ChatScope struct {
+	ChatID string `json:"chatId"`
+	BotPermissions
+}
+
 // User represents a user in the system.
 type User struct {
 	ID             string         `json:"id"`
@@ -65,11 +97,19 @@ type User struct {
 	Status         UserStatus     `json:"status"`
 	Type           UserType       `json:"type,omitempty"`
 	BotPermissions BotPermissions `json:"botPermissions,omitempty"`
-	TargetChatID   string         `json:"targetChatId,omitempty"`
-	SongURL        string         `json:"songUrl,omitempty"`
-	SongTitle      string         `json:"songTitle,omitempty"`
-	SongArtist     string         `json:"songArtist,omitempty"`
-	Bio            string         `json:"bio,omitempty"`
+	// Scoped bots can only use the chats listed in Scopes, whichever of
+	// their API keys they use. Other bots use BotPermissions in Town Hall and
+	// have full access to the other chats they are a member of.
+	Scoped       bool        `json:"-"`
+	Scopes       []ChatScope `json:"-"`
+	TargetChatID string      `json:"targetChatId,omitempty"`
+	// WebhookChats lists the chats a webhook may post to. TargetChatID,
+	// its default, is always one of them.
+	WebhookChats []string `json:"-"`
+	SongURL      string   `json:"songUrl,omitempty"`
+	SongTitle    string   `json:"songTitle,omitempty"`
+	SongArtist   string   `json:"songArtist,omitempty"`
+	Bio          string   `json:"bio,omitempty"`
 }
 
 // Presence represents the online status of a user.
@@ -109,13 +149,36 @@ func DefaultUserSettings() UserSettings {
 
 // Chat represents a chat conversation.
 type Chat struct {
-	ID          string `json:"id"`
-	Name        string `json:"name"`
-	AvatarURL   string `json:"avatarUrl,omitempty"`
-	LastSeq     int    `json:"lastSeq"` // Last message sequence number (used to backfill messages and show unread count)
-	IsDM        bool   `json:"isDm"`
-	Online      bool   `json:"online,omitempty"` // Optional, for DMs
-	LastSeenSeq int64  `json:"lastSeenSeq"`      // Persistent last seen sequence number
+	ID          string   `json:"id"`
+	Name        string   `json:"name"`
+	AvatarURL   string   `json:"avatarUrl,omitempty"`
+	LastSeq     int      `json:"lastSeq"` // Last message sequence number (used to backfill messages and show unread count)
+	IsDM        bool     `json:"isDm"`
+	IsGroup     bool     `json:"isGroup,omitempty"`
+	Members     []string `json:"members,omitempty"`   // Member user IDs, for group chats
+	CreatedBy   string   `json:"createdBy,omitempty"` // Creator of a group chat, who may remove other members
+	Pins        []int64  `json:"-"`                   // Pinned message seqs, most recently pinned first
+	PinCount    int      `json:"pinCount"`            // Number of pinned messages, see GET /api/chats/{id}/pins
+	Online      bool     `json:"online,omitempty"`    // Optional, for DMs
+	LastSeenSeq int64    `json:"lastSeenSeq"`         // Persistent last seen sequence number
+	FirstSeq    int      `json:"firstSeq,omitempty"`  // Oldest message kept; earlier ones were deleted by retention
+	// Retention overrides the global retention policy for this chat.
+	Retention *RetentionPolicy `json:"-"`
+	// DisappearAfter is the disappearing messages timer of a DM, in seconds.
+	// Zero means messages are kept.
+	DisappearAfter int64 `json:"disappearAfter,omitempty"`
+}
+
+// RetentionPolicy limits how long messages are kept. Zero fields mean no
+// limit.
+type RetentionPolicy struct {
+	MaxAge      int64 `json:"maxAge,omitempty"`      // Seconds since the message was sent
+	MaxMessages int   `json:"maxMessages,omitempty"` // Newest messages kept
+}
+
+// IsZero reports whether the policy keeps messages forever.
+func (p RetentionPolicy) IsZero() bool {
+	return p.MaxAge <= 0 && p.MaxMessages <= 0
 }
 
 // GetDMID returns a deterministic DM chat ID for two user IDs.
@@ -125,16 +188,33 @@ func GetDMID(u1, u2 string) string {
 	return fmt.Sprintf("dm_%s_%s", ids[0], ids[1])
 }
 
+// ChatPermissions returns a bot's permissions in chatID.
+func (u User) ChatPermissions(chatID string) BotPermissions {
+	if !u.Scoped {
+		if chatID == "townhall" {
+			return u.BotPermissions
+		}
+		return BotPermissions{ReadAll: true, Write: true}
+	}
+	for _, s := range u.Scopes {
+		if s.ChatID == chatID {
+			return s.BotPermissions
+		}
+	}
+	return BotPermissions{}
+}
+
 // IsMessageVisible checks if a message with the given mentions in chatID is visible to user.
 func IsMessageVisible(chatID string, mentions []string, user User) bool {
 	if user.Type == UserTypeWebhook {
 		return false
 	}
-	if user.Type == UserTypeBot && chatID == "townhall" {
-		if user.BotPermissions.ReadAll {
+	if user.Type == UserTypeBot {
+		perms := user.ChatPermissions(chatID)
+		if perms.ReadAll {
 			return true
 		}
-		if user.BotPermissions.ReadMentions {
+		if perms.ReadMentions {
 			return slices.Contains(mentions, user.UserName)
 		}
 		return false
@@ -142,6 +222,26 @@ func IsMessageVisible(chatID string, mentions []string, user User) bool {
 	return true
 }
 
+// IsReplyPreviewVisible reports whether user may see quoted previews of replied-to
+// messages in chatID. Bots that only read mentions would otherwise see quotes of
+// messages hidden from them.
+func IsReplyPreviewVisible(chatID string, user User) bool {
+	return user.Type != UserTypeBot || user.ChatPermissions(chatID).ReadAll
+}
+
+// CanPost reports whether user may post or edit messages in chatID. Chat
+// membership is checked separately, except for webhooks, which are never
+// chat members and may post to their allowed chats only.
+func CanPost(chatID string, user User) bool {
+	switch user.Type {
+	case UserTypeBot:
+		return user.ChatPermissions(chatID).Write
+	case UserTypeWebhook:
+		return slices.Contains(user.WebhookChats, chatID)
+	}
+	return true
+}
+
 // LastSeenEntry represents a persisted last seen sequence number.
 type LastSeenEntry struct {
 	UserID string `json:"userId"`
@@ -151,13 +251,64 @@ type LastSeenEntry struct {
 
 // Message represents a chat message.
 type Message struct {
-	Seq         int64        `json:"seq"`
-	Timestamp   int64        `json:"timestamp"` // Unix timestamp (seconds)
-	ChatID      string       `json:"chatId"`
-	UserID      string       `json:"userId"`
-	Content     string       `json:"content"`
-	RawContent  string       `json:"rawContent,omitempty"`
-	Attachments []Attachment `json:"attachments,omitempty"`
+	Seq         int64             `json:"seq"`
+	Timestamp   int64             `json:"timestamp"` // Unix timestamp (seconds)
+	ChatID      string            `json:"chatId"`
+	UserID      string            `json:"userId"`
+	Content     string            `json:"content"`
+	RawContent  string            `json:"rawContent,omitempty"`
+	Attachments []Attachment      `json:"attachments,omitempty"`
+	EditedAt    int64             `json:"editedAt,omitempty"`  // Unix timestamp (seconds) of the last edit
+	Revisions   []MessageRevision `json:"revisions,omitempty"` // Prior versions, oldest first
+	Deleted     bool              `json:"deleted,omitempty"`   // Tombstone: content and attachments were removed
+	Reactions   []Reaction        `json:"reactions,omitempty"` // In order of first use
+	ReplyTo     *ReplyRef         `json:"replyTo,omitempty"`
+	Previews    []LinkPreview     `json:"previews,omitempty"`  // Unfurled links, filled in after the message is sent
+	Sender      *SenderOverride   `json:"sender,omitempty"`    // Per-message sender shown instead of the webhook user
+	ExpiresAt   int64             `json:"expiresAt,omitempty"` // Unix timestamp (seconds) when a disappearing message is deleted
+	// DisappearAfter is set on the message announcing a change of the
+	// disappearing messages timer to the new timer, 0 when it was turned off.
+	DisappearAfter *int64 `json:"disappearAfter,omitempty"`
+}
+
+// SenderOverride replaces the display name and avatar a webhook message is shown
+// with. Name is plain text and must be escaped on output.
+type SenderOverride struct {
+	Name     string `json:"name,omitempty"`
+	AvatarID string `json:"avatarId,omitempty"` // Served from /api/images/{avatarId}
+}
+
+// LinkPreview holds OpenGraph/Twitter card metadata for a link in a message.
+// Text fields are plain text as published by the site and must be escaped on output.
+type LinkPreview struct {
+	URL         string `json:"url"`
+	Title       string `json:"title,omitempty"`
+	Description string `json:"description,omitempty"`
+	SiteName    string `json:"siteName,omitempty"`
+	ImageID     string `json:"imageId,omitempty"` // Preview image, served from /api/images/{imageId}
+}
+
+// ReplyRef points to the message a reply quotes. UserID, Preview and Deleted
+// describe the quoted message and are only filled in on output.
+type ReplyRef struct {
+	ChatID  string `json:"chatId"`
+	Seq     int64  `json:"seq"`
+	UserID  string `json:"userId,omitempty"`
+	Preview string `json:"preview,omitempty"`
+	Deleted bool   `json:"deleted,omitempty"`
+}
+
+// Reaction aggregates all users who reacted to a message with the same emoji.
+type Reaction struct {
+	Emoji   string   `json:"emoji"`
+	Count   int      `json:"count"`
+	UserIDs []string `json:"userIds"`
+}
+
+// MessageRevision is a prior version of an edited message.
+type MessageRevision struct {
+	Content   string `json:"content"`
+	Timestamp int64  `json:"timestamp"` // Unix timestamp (seconds) when this version was written
 }
 
 // Location represents geographic coordinates.
@@ -181,20 +332,53 @@ type ClientMessage struct {
 	FromSeq     int64             `json:"fromSeq,omitempty"`
 	ToSeq       int64             `json:"toSeq,omitempty"`
 	Location    *Location         `json:"location,omitempty"`
-	Seq         int64             `json:"seq,omitempty"` // Sequence number for read receipts
+	Seq         int64             `json:"seq,omitempty"`     // Sequence number for read receipts
+	Name        string            `json:"name,omitempty"`    // Group chat name
+	UserID      string            `json:"userId,omitempty"`  // Group member to add or remove
+	UserIDs     []string          `json:"userIds,omitempty"` // Initial group members
+	Emoji       string            `json:"emoji,omitempty"`   // Reaction emoji
+	ReplyTo     *ReplyRef         `json:"replyTo,omitempty"` // Message being replied to
+	Sender      *SenderOverride   `json:"-"`                 // Set by the webhook API only
+	// DisappearAfter is the new disappearing messages timer in seconds, 0 to
+	// turn it off.
+	DisappearAfter int64 `json:"disappearAfter,omitempty"`
 }
 
 // ServerMessage represents a message to the client.
 type ServerMessage struct {
-	Type          ServerMessageType `json:"type"`
-	UserID        string            `json:"userId,omitempty"`
-	Online        bool              `json:"online,omitempty"`
-	ChatID        string            `json:"chatId,omitempty"`
-	Messages      []Message         `json:"messages,omitempty"`
-	User          *User             `json:"user,omitempty"`
-	Chat          *Chat             `json:"chat,omitempty"`
-	UserLocations []UserLocation    `json:"userLocations,omitempty"`
-	Seq           int64             `json:"seq,omitempty"`
+	Type          ServerMessageType  `json:"type"`
+	UserID        string             `json:"userId,omitempty"`
+	Online        bool               `json:"online,omitempty"`
+	ChatID        string             `json:"chatId,omitempty"`
+	Messages      []Message          `json:"messages,omitempty"`
+	User          *User              `json:"user,omitempty"`
+	Chat          *Chat              `json:"chat,omitempty"`
+	UserLocations []UserLocation     `json:"userLocations,omitempty"`
+	Seq           int64              `json:"seq,omitempty"`
+	Emoji         string             `json:"emoji,omitempty"`
+	Command       *CommandInvocation `json:"command,omitempty"`
+	Seqs          []int64            `json:"seqs,omitempty"`
+}
+
+// SlashCommand routes messages starting with /Name to the bot BotID instead of
+// posting them to the chat.
+type SlashCommand struct {
+	Name        string `json:"name"`
+	BotID       string `json:"botId"`
+	Description string `json:"description,omitempty"`
+}
+
+// CommandInvocation is sent to a bot when a user runs one of its slash commands.
+// The bot replies by ID while the invocation is still pending.
+type CommandInvocation struct {
+	ID        string `json:"id"`
+	Command   string `json:"command"`
+	Args      string `json:"args"`
+	ChatID    string `json:"chatId"`
+	UserID    string `json:"userId"`
+	Timestamp int64  `json:"timestamp"` // Unix timestamp (seconds)
+	// Attachments sent along with the command message.
+	Attachments []Attachment `json:"attachments,omitempty"`
 }
 
 type AttachmentType string
@@ -221,6 +405,24 @@ const (
 	ClientMessageTypePong     ClientMessageType = "pong"
 	ClientMessageTypeLocation ClientMessageType = "location"
 	ClientMessageTypeRead     ClientMessageType = "read"
+	ClientMessageTypeEdit     ClientMessageType = "edit"
+	ClientMessageTypeDelete   ClientMessageType = "delete"
+	ClientMessageTypeReact    ClientMessageType = "react"
+	ClientMessageTypeUnreact  ClientMessageType = "unreact"
+	// Sent repeatedly while the user types; expires on the server if not refreshed
+	ClientMessageTypeTyping     ClientMessageType = "typing"
+	ClientMessageTypeStopTyping ClientMessageType = "stopTyping"
+
+	ClientMessageTypePin   ClientMessageType = "pin"
+	ClientMessageTypeUnpin ClientMessageType = "unpin"
+
+	ClientMessageTypeCreateGroup  ClientMessageType = "createGroup"
+	ClientMessageTypeRenameGroup  ClientMessageType = "renameGroup"
+	ClientMessageTypeAddMember    ClientMessageType = "addMember"
+	ClientMessageTypeRemoveMember ClientMessageType = "removeMember"
+
+	// Sets the disappearing messages timer of a DM
+	ClientMessageTypeSetTimer ClientMessageType = "setTimer"
 )
 
 type ServerMessageType string
@@ -236,4 +438,29 @@ const (
 	ServerMessageTypePing     ServerMessageType = "ping"
 	ServerMessageTypeLocation ServerMessageType = "location"
 	ServerMessageTypeRead     ServerMessageType = "read"
+	// Sent to group members when a group chat is created, renamed or its members change
+	ServerMessageTypeChat ServerMessageType = "chat"
+	// Sent to a user removed from a group chat
+	ServerMessageTypeChatRemoved ServerMessageType = "chatRemoved"
+	// Sent to chat members when a message is edited
+	ServerMessageTypeEdited ServerMessageType = "edited"
+	// Sent to chat members when a message is replaced by a tombstone
+	ServerMessageTypeMessageDeleted ServerMessageType = "messageDeleted"
+	// Sent to chat members when a user adds or removes a reaction
+	ServerMessageTypeReacted   ServerMessageType = "reacted"
+	ServerMessageTypeUnreacted ServerMessageType = "unreacted"
+	// Sent to other chat members when a user starts or stops typing
+	ServerMessageTypeTyping        ServerMessageType = "typing"
+	ServerMessageTypeStoppedTyping ServerMessageType = "stoppedTyping"
+	// Sent to chat members when a message is pinned or unpinned
+	ServerMessageTypePinned   ServerMessageType = "pinned"
+	ServerMessageTypeUnpinned ServerMessageType = "unpinned"
+	// Sent to chat members when link previews are attached to a message
+	ServerMessageTypePreviews ServerMessageType = "previews"
+	// Sent to a bot when a user runs one of its slash commands
+	ServerMessageTypeCommand ServerMessageType = "command"
+	// Sent to a single user: a message that is not stored in the chat history
+	ServerMessageTypeEphemeral ServerMessageType = "ephemeral"
+	// Sent to chat members when disappearing messages expire
+	ServerMessageTypeExpired ServerMessageType = "expired"
 )
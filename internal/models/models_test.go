@@ -47,6 +47,40 @@ func TestIsMessageVisible(t *testing.T) {
 	}
 }
 
+func TestScopedBotPermissions(t *testing.T) {
+	bot := User{
+		ID:             "b1",
+		UserName:       "scopedbot",
+		Type:           UserTypeBot,
+		BotPermissions: BotPermissions{ReadAll: true, Write: true}, // Ignored once scoped
+		Scoped:         true,
+		Scopes: []ChatScope{
+			{ChatID: "group1", BotPermissions: BotPermissions{ReadMentions: true}},
+			{ChatID: "dm_b1_h1", BotPermissions: BotPermissions{ReadAll: true, Write: true}},
+		},
+	}
+
+	if IsMessageVisible("townhall", []string{"scopedbot"}, bot) || CanPost("townhall", bot) {
+		t.Errorf("expected townhall to be out of scope")
+	}
+	if IsMessageVisible("group1", nil, bot) || !IsMessageVisible("group1", []string{"scopedbot"}, bot) {
+		t.Errorf("expected only mentions to be visible in group1")
+	}
+	if CanPost("group1", bot) || IsReplyPreviewVisible("group1", bot) {
+		t.Errorf("expected read-mentions scope to deny posting and reply previews")
+	}
+	if !IsMessageVisible("dm_b1_h1", nil, bot) || !CanPost("dm_b1_h1", bot) {
+		t.Errorf("expected full access to the opted-in DM")
+	}
+	if IsMessageVisible("dm_b1_h2", nil, bot) {
+		t.Errorf("expected other DMs to be out of scope")
+	}
+
+	if !CanPost("anything", User{Type: UserTypeHuman}) {
+		t.Errorf("expected humans to be able to post")
+	}
+}
+
 func TestServerMessageJSONOmitempty(t *testing.T) {
 	locMsg := ServerMessage{
 		Type: ServerMessageTypeLocation,
@@ -0,0 +1,164 @@
+// Package retention deletes messages that fall outside the retention policy
+// of their chat, and disappearing messages once they expire.
+package retention
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"besedka/internal/models"
+)
+
+// Store is the subset of storage.BboltStorage the janitor needs.
+type Store interface {
+	ListChats() ([]models.Chat, error)
+	// RetentionCutoff returns the seq of the oldest message policy keeps, or
+	// 0 when it keeps them all.
+	RetentionCutoff(chatID string, policy models.RetentionPolicy, now time.Time) (int64, error)
+	// DeleteMessagesBefore deletes the messages before seq and returns the
+	// files they referred to.
+	DeleteMessagesBefore(chatID string, before int64) ([]string, int, error)
+	// ReleaseFiles deletes the files nothing refers to any more.
+	ReleaseFiles(fileIDs []string) (int, error)
+	// DeleteExpiredMessages deletes the disappearing messages expired by now
+	// and returns their seqs by chat ID and the files they referred to.
+	DeleteExpiredMessages(now time.Time) (map[string][]int64, []string, error)
+}
+
+// Chats is the subset of ws.Hub the janitor needs to drop deleted messages
+// from memory.
+type Chats interface {
+	TrimChat(chatID string, firstSeq int64)
+	ExpireMessages(chatID string, seqs []int64)
+}
+
+// expiryInterval is how often disappearing messages are deleted. Clients stop
+// seeing them as soon as they expire; this bounds how long they stay stored.
+const expiryInterval = time.Minute
+
+// Janitor periodically deletes messages past their chat's retention policy,
+// and disappearing messages past their expiry.
+type Janitor struct {
+	store          Store
+	chats          Chats
+	global         models.RetentionPolicy
+	interval       time.Duration
+	expiryInterval time.Duration
+	now            func() time.Time
+}
+
+// NewJanitor builds a Janitor enforcing global in every chat without a policy
+// of its own, every interval.
+func NewJanitor(store Store, chats Chats, global models.RetentionPolicy, interval time.Duration) *Janitor {
+	return &Janitor{
+		store:          store,
+		chats:          chats,
+		global:         global,
+		interval:       interval,
+		expiryInterval: expiryInterval,
+		now:            time.Now,
+	}
+}
+
+// Run sweeps once at startup and then every interval, and deletes expired
+// disappearing messages every minute, until ctx is cancelled.
+func (j *Janitor) Run(ctx context.Context) {
+	ticker := time.NewTicker(j.interval)
+	defer ticker.Stop()
+	expiryTicker := time.NewTicker(j.expiryInterval)
+	defer expiryTicker.Stop()
+
+	j.sweep()
+	j.sweepExpired()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			j.sweep()
+		case <-expiryTicker.C:
+			j.sweepExpired()
+		}
+	}
+}
+
+func (j *Janitor) sweep() {
+	if err := j.Sweep(); err != nil {
+		slog.Error("retention sweep failed", "error", err)
+	}
+}
+
+func (j *Janitor) sweepExpired() {
+	if err := j.SweepExpired(); err != nil {
+		slog.Error("disappearing messages sweep failed", "error", err)
+	}
+}
+
+// Sweep deletes the expired messages of every chat. Each chat is trimmed in
+// memory first, so clients stop seeing the messages before they are deleted
+// from storage, and the files only they referred to are released last.
+func (j *Janitor) Sweep() error {
+	chats, err := j.store.ListChats()
+	if err != nil {
+		return err
+	}
+	now := j.now()
+	for _, c := range chats {
+		policy := j.global
+		if c.Retention != nil {
+			policy = *c.Retention
+		}
+		if policy.IsZero() {
+			continue
+		}
+
+		cutoff, err := j.store.RetentionCutoff(c.ID, policy, now)
+		if err != nil {
+			slog.Error("retention: failed to find expired messages", "chatID", c.ID, "error", err)
+			continue
+		}
+		if cutoff == 0 {
+			continue
+		}
+
+		j.chats.TrimChat(c.ID, cutoff)
+		fileIDs, deleted, err := j.store.DeleteMessagesBefore(c.ID, cutoff)
+		if err != nil {
+			slog.Error("retention: failed to delete expired messages", "chatID", c.ID, "error", err)
+			continue
+		}
+		released, err := j.store.ReleaseFiles(fileIDs)
+		if err != nil {
+			slog.Error("retention: failed to release files", "chatID", c.ID, "error", err)
+		}
+		slog.Info("retention: deleted expired messages", "chatID", c.ID, "messages", deleted, "files", released)
+	}
+	return nil
+}
+
+// SweepExpired deletes the disappearing messages that expired, drops them
+// from memory and releases the files only they referred to.
+func (j *Janitor) SweepExpired() error {
+	expired, fileIDs, err := j.store.DeleteExpiredMessages(j.now())
+	for chatID, seqs := range expired {
+		j.chats.ExpireMessages(chatID, seqs)
+	}
+	if err != nil {
+		return err
+	}
+	if len(expired) == 0 {
+		return nil
+	}
+
+	released, err := j.store.ReleaseFiles(fileIDs)
+	if err != nil {
+		return err
+	}
+	deleted := 0
+	for _, seqs := range expired {
+		deleted += len(seqs)
+	}
+	slog.Info("retention: deleted disappearing messages", "chats", len(expired), "messages", deleted, "files", released)
+	return nil
+}
@@ -0,0 +1,115 @@
+package retention
+
+import (
+	"testing"
+	"time"
+
+	"besedka/internal/models"
+)
+
+type fakeStore struct {
+	chats    []models.Chat
+	cutoffs  map[string]int64
+	policies map[string]models.RetentionPolicy
+	deleted  map[string]int64
+	released []string
+	expired  map[string][]int64
+}
+
+func (f *fakeStore) ListChats() ([]models.Chat, error) {
+	return f.chats, nil
+}
+
+func (f *fakeStore) RetentionCutoff(chatID string, policy models.RetentionPolicy, now time.Time) (int64, error) {
+	f.policies[chatID] = policy
+	return f.cutoffs[chatID], nil
+}
+
+func (f *fakeStore) DeleteMessagesBefore(chatID string, before int64) ([]string, int, error) {
+	f.deleted[chatID] = before
+	return []string{"file-" + chatID}, 1, nil
+}
+
+func (f *fakeStore) ReleaseFiles(fileIDs []string) (int, error) {
+	f.released = append(f.released, fileIDs...)
+	return len(fileIDs), nil
+}
+
+func (f *fakeStore) DeleteExpiredMessages(now time.Time) (map[string][]int64, []string, error) {
+	expired := f.expired
+	f.expired = nil
+	var fileIDs []string
+	for chatID := range expired {
+		fileIDs = append(fileIDs, "file-"+chatID)
+	}
+	return expired, fileIDs, nil
+}
+
+type fakeChats map[string]int64
+
+func (f fakeChats) TrimChat(chatID string, firstSeq int64) {
+	f[chatID] = firstSeq
+}
+
+func (f fakeChats) ExpireMessages(chatID string, seqs []int64) {
+	f[chatID] = int64(len(seqs))
+}
+
+func TestJanitorSweep(t *testing.T) {
+	store := &fakeStore{
+		chats: []models.Chat{
+			{ID: "townhall"},
+			{ID: "group", Retention: &models.RetentionPolicy{MaxMessages: 10}},
+			{ID: "archive", Retention: &models.RetentionPolicy{}},
+			{ID: "quiet"},
+		},
+		cutoffs:  map[string]int64{"townhall": 5, "group": 7, "archive": 9},
+		policies: make(map[string]models.RetentionPolicy),
+		deleted:  make(map[string]int64),
+	}
+	chats := make(fakeChats)
+	j := NewJanitor(store, chats, models.RetentionPolicy{MaxAge: 3600}, time.Hour)
+
+	if err := j.Sweep(); err != nil {
+		t.Fatalf("Sweep failed: %v", err)
+	}
+
+	if store.policies["townhall"].MaxAge != 3600 || store.policies["group"].MaxMessages != 10 {
+		t.Errorf("expected the global policy unless overridden, got %+v", store.policies)
+	}
+	if _, ok := store.policies["archive"]; ok {
+		t.Error("expected a chat with an empty policy to keep its messages")
+	}
+	if chats["townhall"] != 5 || chats["group"] != 7 || len(chats) != 2 {
+		t.Errorf("expected townhall and group to be trimmed, got %+v", chats)
+	}
+	if store.deleted["townhall"] != 5 || store.deleted["group"] != 7 || len(store.deleted) != 2 {
+		t.Errorf("expected townhall and group messages to be deleted, got %+v", store.deleted)
+	}
+	if len(store.released) != 2 {
+		t.Errorf("expected the files of deleted messages to be released, got %+v", store.released)
+	}
+}
+
+func TestJanitorSweepExpired(t *testing.T) {
+	store := &fakeStore{expired: map[string][]int64{"dm_a_b": {3, 4}}}
+	chats := make(fakeChats)
+	j := NewJanitor(store, chats, models.RetentionPolicy{}, time.Hour)
+
+	if err := j.SweepExpired(); err != nil {
+		t.Fatalf("SweepExpired failed: %v", err)
+	}
+	if chats["dm_a_b"] != 2 || len(chats) != 1 {
+		t.Errorf("expected both expired messages to be dropped from memory, got %+v", chats)
+	}
+	if len(store.released) != 1 || store.released[0] != "file-dm_a_b" {
+		t.Errorf("expected the files of expired messages to be released, got %+v", store.released)
+	}
+
+	if err := j.SweepExpired(); err != nil {
+		t.Fatalf("SweepExpired failed: %v", err)
+	}
+	if len(store.released) != 1 {
+		t.Errorf("expected nothing to be released without expired messages, got %+v", store.released)
+	}
+}
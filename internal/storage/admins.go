@@ -0,0 +1,200 @@
+package storage
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"besedka/internal/auth"
+	"besedka/internal/models"
+
+	"go.etcd.io/bbolt"
+)
+
+// UpsertAdmin saves an admin account.
+func (s *BboltStorage) UpsertAdmin(admin auth.Admin) error {
+	dbAdmin := &DBAdmin{
+		ID:                  admin.ID,
+		UserName:            admin.UserName,
+		PasswordHash:        admin.PasswordHash,
+		TOTPSecret:          admin.TOTPSecret,
+		LastTOTP:            admin.LastTOTP,
+		CreatedAt:           admin.CreatedAt,
+		CreatedBy:           admin.CreatedBy,
+		FailedLoginAttempts: admin.FailedLoginAttempts,
+		LastAttemptTime:     admin.LastAttemptTime,
+	}
+	data, err := dbAdmin.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	data, err = s.crypter.Encrypt(data)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt admin record: %w", err)
+	}
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		b := tx.Bucket(bucketAdmins)
+		return dirtyPut(tx, b, [][]byte{bucketAdmins}, dbAdmin.Key(), data)
+	})
+}
+
+// DeleteAdmin removes an admin account.
+func (s *BboltStorage) DeleteAdmin(adminID string) error {
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		b := tx.Bucket(bucketAdmins)
+		return dirtyDelete(tx, b, [][]byte{bucketAdmins}, []byte(adminID))
+	})
+}
+
+// ListAdmins returns all admin accounts.
+func (s *BboltStorage) ListAdmins() ([]auth.Admin, error) {
+	var admins []auth.Admin
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		return tx.Bucket(bucketAdmins).ForEach(func(k, v []byte) error {
+			v, err := s.crypter.Decrypt(v)
+			if err != nil {
+				return fmt.Errorf("failed to decrypt admin record: %w", err)
+			}
+			var a DBAdmin
+			if err := a.UnmarshalBinary(v); err != nil {
+				return err
+			}
+			admins = append(admins, auth.Admin{
+				ID:                  a.ID,
+				UserName:            a.UserName,
+				PasswordHash:        a.PasswordHash,
+				TOTPSecret:          a.TOTPSecret,
+				LastTOTP:            a.LastTOTP,
+				CreatedAt:           a.CreatedAt,
+				CreatedBy:           a.CreatedBy,
+				FailedLoginAttempts: a.FailedLoginAttempts,
+				LastAttemptTime:     a.LastAttemptTime,
+			})
+			return nil
+		})
+	})
+	return admins, err
+}
+
+// UpsertAdminToken saves an admin login token, keyed by its hash.
+func (s *BboltStorage) UpsertAdminToken(token auth.AdminToken) error {
+	dbToken := &DBAdminToken{
+		TokenHash: token.TokenHash,
+		AdminID:   token.AdminID,
+		CreatedAt: token.CreatedAt,
+		ExpiresAt: token.ExpiresAt,
+		IP:        token.IP,
+	}
+	data, err := dbToken.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	data, err = s.crypter.Encrypt(data)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt admin token record: %w", err)
+	}
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		b := tx.Bucket(bucketAdminTokens)
+		return dirtyPut(tx, b, [][]byte{bucketAdminTokens}, dbToken.Key(), data)
+	})
+}
+
+// DeleteAdminToken removes an admin login token by its hash.
+func (s *BboltStorage) DeleteAdminToken(tokenHash string) error {
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		b := tx.Bucket(bucketAdminTokens)
+		return dirtyDelete(tx, b, [][]byte{bucketAdminTokens}, []byte(tokenHash))
+	})
+}
+
+// ListAdminTokens returns all admin login tokens, including expired ones.
+func (s *BboltStorage) ListAdminTokens() ([]auth.AdminToken, error) {
+	var tokens []auth.AdminToken
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		return tx.Bucket(bucketAdminTokens).ForEach(func(k, v []byte) error {
+			v, err := s.crypter.Decrypt(v)
+			if err != nil {
+				return fmt.Errorf("failed to decrypt admin token record: %w", err)
+			}
+			var t DBAdminToken
+			if err := t.UnmarshalBinary(v); err != nil {
+				return err
+			}
+			tokens = append(tokens, auth.AdminToken{
+				TokenHash: t.TokenHash,
+				AdminID:   t.AdminID,
+				CreatedAt: t.CreatedAt,
+				ExpiresAt: t.ExpiresAt,
+				IP:        t.IP,
+			})
+			return nil
+		})
+	})
+	return tokens, err
+}
+
+// AddAdminAuditEntry appends an entry to the admin audit log. Entries are
+// keyed by a sequence number, so they are kept in the order they were added.
+func (s *BboltStorage) AddAdminAuditEntry(entry models.AdminAuditEntry) error {
+	dbEntry := &DBAdminAuditEntry{
+		Time:      entry.Time,
+		AdminID:   entry.AdminID,
+		AdminName: entry.AdminName,
+		Action:    entry.Action,
+		Status:    entry.Status,
+		IP:        entry.IP,
+	}
+	data, err := dbEntry.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	data, err = s.crypter.Encrypt(data)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt admin audit entry: %w", err)
+	}
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		b := tx.Bucket(bucketAdminAudit)
+		seq, err := b.NextSequence()
+		if err != nil {
+			return err
+		}
+		key := make([]byte, 8)
+		binary.BigEndian.PutUint64(key, seq)
+		return dirtyPut(tx, b, [][]byte{bucketAdminAudit}, key, data)
+	})
+}
+
+// ListAdminAuditEntries returns up to limit audit entries, newest first. A
+// non-empty adminID only returns the entries of that admin; a limit of 0
+// returns all of them.
+func (s *BboltStorage) ListAdminAuditEntries(adminID string, limit int) ([]models.AdminAuditEntry, error) {
+	var entries []models.AdminAuditEntry
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		c := tx.Bucket(bucketAdminAudit).Cursor()
+		for k, v := c.Last(); k != nil; k, v = c.Prev() {
+			if limit > 0 && len(entries) >= limit {
+				break
+			}
+			v, err := s.crypter.Decrypt(v)
+			if err != nil {
+				return fmt.Errorf("failed to decrypt admin audit entry: %w", err)
+			}
+			var e DBAdminAuditEntry
+			if err := e.UnmarshalBinary(v); err != nil {
+				return err
+			}
+			if adminID != "" && e.AdminID != adminID {
+				continue
+			}
+			entries = append(entries, models.AdminAuditEntry{
+				Time:      e.Time,
+				AdminID:   e.AdminID,
+				AdminName: e.AdminName,
+				Action:    e.Action,
+				Status:    e.Status,
+				IP:        e.IP,
+			})
+		}
+		return nil
+	})
+	return entries, err
+}
@@ -0,0 +1,76 @@
+package storage
+
+import (
+	"path/filepath"
+	"testing"
+
+	"besedka/internal/auth"
+	"besedka/internal/filestore"
+	"besedka/internal/models"
+)
+
+func TestAdmins(t *testing.T) {
+	tmpDir := t.TempDir()
+	fs, _ := filestore.NewLocalFileStore(filepath.Join(tmpDir, "fs"))
+	dbPath := filepath.Join(tmpDir, "test.db")
+	store, err := NewBboltStorage(dbPath, testSecret, fs)
+	if err != nil {
+		t.Fatalf("failed to create storage: %v", err)
+	}
+
+	admin := auth.Admin{ID: "admin_1", UserName: "root", PasswordHash: "hash", TOTPSecret: "SECRET", CreatedAt: 100}
+	if err := store.UpsertAdmin(admin); err != nil {
+		t.Fatalf("UpsertAdmin failed: %v", err)
+	}
+	if err := store.UpsertAdmin(auth.Admin{ID: "admin_2", UserName: "gone"}); err != nil {
+		t.Fatalf("UpsertAdmin failed: %v", err)
+	}
+	if err := store.DeleteAdmin("admin_2"); err != nil {
+		t.Fatalf("DeleteAdmin failed: %v", err)
+	}
+	token := auth.AdminToken{TokenHash: "th", AdminID: "admin_1", CreatedAt: 100, ExpiresAt: 200, IP: "127.0.0.1"}
+	if err := store.UpsertAdminToken(token); err != nil {
+		t.Fatalf("UpsertAdminToken failed: %v", err)
+	}
+	for i, action := range []string{"POST /api/users", "DELETE /api/users?id=u1", "GET /api/export?chat=townhall"} {
+		adminID := "admin_1"
+		if i == 1 {
+			adminID = "admin_2"
+		}
+		if err := store.AddAdminAuditEntry(models.AdminAuditEntry{Time: int64(i), AdminID: adminID, Action: action, Status: 200}); err != nil {
+			t.Fatalf("AddAdminAuditEntry failed: %v", err)
+		}
+	}
+
+	// Everything survives a reopen.
+	_ = store.Close()
+	store, err = NewBboltStorage(dbPath, testSecret, fs)
+	if err != nil {
+		t.Fatalf("failed to reopen storage: %v", err)
+	}
+	defer func() { _ = store.Close() }()
+
+	admins, err := store.ListAdmins()
+	if err != nil || len(admins) != 1 || admins[0] != admin {
+		t.Errorf("expected only root, got %+v %v", admins, err)
+	}
+	tokens, err := store.ListAdminTokens()
+	if err != nil || len(tokens) != 1 || tokens[0] != token {
+		t.Errorf("expected the token, got %+v %v", tokens, err)
+	}
+	if err := store.DeleteAdminToken("th"); err != nil {
+		t.Fatalf("DeleteAdminToken failed: %v", err)
+	}
+	if tokens, _ := store.ListAdminTokens(); len(tokens) != 0 {
+		t.Errorf("expected no tokens, got %+v", tokens)
+	}
+
+	entries, err := store.ListAdminAuditEntries("", 2)
+	if err != nil || len(entries) != 2 || entries[0].Action != "GET /api/export?chat=townhall" {
+		t.Errorf("expected the 2 newest entries, got %+v %v", entries, err)
+	}
+	entries, _ = store.ListAdminAuditEntries("admin_1", 0)
+	if len(entries) != 2 || entries[1].Action != "POST /api/users" {
+		t.Errorf("expected the entries of admin_1, got %+v", entries)
+	}
+}
@@ -8,9 +8,13 @@ import (
 	"fmt"
 	"io"
 	"log/slog"
+	"slices"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"besedka/internal/auth"
+	"besedka/internal/content"
 	"besedka/internal/filestore"
 	"besedka/internal/models"
 
@@ -31,23 +35,62 @@ var (
 	bucketPasskeyCredentials = []byte("passkey_credentials")
 	bucketUserSettings       = []byte("user_settings")
 	bucketAPIKeys            = []byte("api_keys")
+	bucketLinkPreviews       = []byte("link_previews")
+	// bucketBotDeliveries queues outgoing bot webhook requests and
+	// bucketBotDeliveryStatus tracks their outcome per bot. See deliveries.go.
+	bucketBotDeliveries     = []byte("bot_deliveries")
+	bucketBotDeliveryStatus = []byte("bot_delivery_status")
+	bucketSlashCommands     = []byte("slash_commands")
+	// Admin accounts, their login tokens and the audit log. See admins.go.
+	bucketAdmins      = []byte("admins")
+	bucketAdminTokens = []byte("admin_tokens")
+	bucketAdminAudit  = []byte("admin_audit")
+	// bucketSearchIndex maps blinded search tokens to encrypted postings, one
+	// record per token and message. See search.go. bucketSearchIndexV1 held
+	// one posting list per token and is dropped on startup.
+	bucketSearchIndex   = []byte("search_index_v2")
+	bucketSearchIndexV1 = []byte("search_index")
 	// bucketBackupDirty journals which keys changed since the last backup so
 	// incremental backups can ship only the delta. See dirty.go.
 	bucketBackupDirty = []byte("backup_dirty")
+	// bucketMessageExpiry indexes disappearing messages by expiry time. See
+	// expiry.go.
+	bucketMessageExpiry = []byte("message_expiry")
+	// bucketMessageReplies indexes replies by the message they reply to, with
+	// one bucket per chat. See replies.go.
+	bucketMessageReplies = []byte("message_replies")
+	// bucketMessageFiles indexes the files stored messages refer to, by
+	// file ID. See filerefs.go.
+	bucketMessageFiles = []byte("message_files")
 )
 
 type BboltStorage struct {
 	db      *bbolt.DB
-	crypter *Crypter
+	crypter *Keyring
 	fs      filestore.FileStore
+
+	migrating atomic.Bool
+
+	// blobsMu orders ReleaseFiles with uploads. pendingBlobs counts the blobs
+	// saved by SaveFileBlob whose metadata is not stored yet, and heldFiles
+	// the files held by HoldFile; ReleaseFiles deletes neither.
+	blobsMu      sync.Mutex
+	pendingBlobs map[string]int
+	heldFiles    map[string]int
 }
 
-func NewBboltStorage(path string, key []byte, fs filestore.FileStore) (*BboltStorage, error) {
+// NewBboltStorage opens the database at path, encrypting with key. Records
+// written with any of previousKeys can still be read; MigrateKeys rewrites
+// them with key.
+func NewBboltStorage(path string, key []byte, fs filestore.FileStore, previousKeys ...[]byte) (*BboltStorage, error) {
 	db, err := bbolt.Open(path, 0600, &bbolt.Options{Timeout: 1 * time.Second})
 	if err != nil {
 		return nil, fmt.Errorf("failed to open bbolt db: %w", err)
 	}
 
+	rebuildIndex := false
+	rebuildReplies := false
+	rebuildFiles := false
 	err = db.Update(func(tx *bbolt.Tx) error {
 		if _, err := tx.CreateBucketIfNotExists(bucketUsers); err != nil {
 			return err
@@ -88,9 +131,59 @@ func NewBboltStorage(path string, key []byte, fs filestore.FileStore) (*BboltSto
 		if _, err := tx.CreateBucketIfNotExists(bucketAPIKeys); err != nil {
 			return err
 		}
+		if _, err := tx.CreateBucketIfNotExists(bucketLinkPreviews); err != nil {
+			return err
+		}
+		if _, err := tx.CreateBucketIfNotExists(bucketBotDeliveries); err != nil {
+			return err
+		}
+		if _, err := tx.CreateBucketIfNotExists(bucketBotDeliveryStatus); err != nil {
+			return err
+		}
+		if _, err := tx.CreateBucketIfNotExists(bucketSlashCommands); err != nil {
+			return err
+		}
+		if _, err := tx.CreateBucketIfNotExists(bucketAdmins); err != nil {
+			return err
+		}
+		if _, err := tx.CreateBucketIfNotExists(bucketAdminTokens); err != nil {
+			return err
+		}
+		if _, err := tx.CreateBucketIfNotExists(bucketAdminAudit); err != nil {
+			return err
+		}
 		if _, err := tx.CreateBucketIfNotExists(bucketBackupDirty); err != nil {
 			return err
 		}
+		if _, err := tx.CreateBucketIfNotExists(bucketMessageExpiry); err != nil {
+			return err
+		}
+		if tx.Bucket(bucketMessageReplies) == nil {
+			rebuildReplies = true
+			if _, err := tx.CreateBucket(bucketMessageReplies); err != nil {
+				return err
+			}
+		}
+		if tx.Bucket(bucketMessageFiles) == nil {
+			rebuildFiles = true
+			if _, err := tx.CreateBucket(bucketMessageFiles); err != nil {
+				return err
+			}
+		}
+		if tx.Bucket(bucketSearchIndexV1) != nil {
+			if err := tx.DeleteBucket(bucketSearchIndexV1); err != nil {
+				return err
+			}
+			if err := markDirty(tx, markerKindBucket, [][]byte{bucketSearchIndexV1}); err != nil {
+				return err
+			}
+		}
+		if tx.Bucket(bucketSearchIndex) == nil {
+			rebuildIndex = true
+			if _, err := tx.CreateBucket(bucketSearchIndex); err != nil {
+				return err
+			}
+		}
 		return nil
 	})
 	if err != nil {
@@ -105,6 +198,14 @@ func NewBboltStorage(path string, key []byte, fs filestore.FileStore) (*BboltSto
 
 	bs := &BboltStorage{db: db, fs: fs}
 
+	if rekeySalt, err := bs.GetConfig(configKeyRekeySalt); err != nil || rekeySalt != "" {
+		_ = db.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get re-key state: %w", err)
+		}
+		return nil, ErrRekeyInProgress
+	}
+
 	b64salt, err := bs.GetConfig("salt")
 	if err != nil {
 		_ = db.Close()
@@ -131,16 +232,72 @@ func NewBboltStorage(path string, key []byte, fs filestore.FileStore) (*BboltSto
 		}
 	}
 
-	crypter, err := NewCrypter(key, salt)
+	if bs.crypter, err = newKeyring(key, salt, previousKeys); err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	keyChanged, err := bs.switchKey()
 	if err != nil {
 		_ = db.Close()
-		return nil, fmt.Errorf("failed to create crypter: %w", err)
+		return nil, err
+	}
+	// Plain chat records are encrypted only once the key is checked, so a
+	// wrong key can't lock them away.
+	if err := bs.encryptChats(); err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("failed to encrypt chat records: %w", err)
+	}
+	if keyChanged {
+		// Blind indexes are keyed hashes under the current key.
+		rebuildIndex = true
+		if err := bs.rekeyLinkPreviews(); err != nil {
+			_ = db.Close()
+			return nil, fmt.Errorf("failed to re-key link previews: %w", err)
+		}
+	}
+
+	if rebuildIndex {
+		if err := bs.RebuildSearchIndex(); err != nil {
+			_ = db.Close()
+			return nil, fmt.Errorf("failed to build search index: %w", err)
+		}
+	}
+	if rebuildReplies {
+		if err := bs.rebuildReplyIndex(); err != nil {
+			_ = db.Close()
+			return nil, fmt.Errorf("failed to build reply index: %w", err)
+		}
+	}
+	if rebuildFiles {
+		if err := bs.rebuildFileIndex(); err != nil {
+			_ = db.Close()
+			return nil, fmt.Errorf("failed to build file reference index: %w", err)
+		}
 	}
-	bs.crypter = crypter
 
 	return bs, nil
 }
 
+// newKeyring derives the crypters for key and previousKeys under salt.
+func newKeyring(key, salt []byte, previousKeys [][]byte) (*Keyring, error) {
+	crypter, err := NewCrypter(key, salt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create crypter: %w", err)
+	}
+	var oldCrypters []*Crypter
+	for _, prev := range previousKeys {
+		if len(prev) == 0 || bytes.Equal(prev, key) {
+			continue
+		}
+		c, err := NewCrypter(prev, salt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create crypter: %w", err)
+		}
+		oldCrypters = append(oldCrypters, c)
+	}
+	return NewKeyring(crypter, oldCrypters...), nil
+}
+
 func (s *BboltStorage) Close() error {
 	return s.db.Close()
 }
@@ -217,11 +374,28 @@ func (s *BboltStorage) UpsertCredentials(credentials auth.UserCredentials) error
 				ReadAll:      credentials.BotPermissions.ReadAll,
 				Write:        credentials.BotPermissions.Write,
 			},
+			Scoped:       credentials.Scoped,
 			TargetChatID: credentials.TargetChatID,
+			WebhookChats: credentials.WebhookChats,
 			SongURL:      credentials.SongURL,
 			SongTitle:    credentials.SongTitle,
 			SongArtist:   credentials.SongArtist,
 			Bio:          credentials.Bio,
+
+			CallbackURL:   credentials.CallbackURL,
+			WebhookSecret: credentials.WebhookSecret,
+			RecoveryCodes: credentials.RecoveryCodes,
+			PasskeyOnly:   credentials.PasskeyOnly,
+		}
+		for _, scope := range credentials.Scopes {
+			dbUser.Scopes = append(dbUser.Scopes, DBChatScope{
+				ChatID: scope.ChatID,
+				Permissions: DBBotPermissions{
+					ReadMentions: scope.ReadMentions,
+					ReadAll:      scope.ReadAll,
+					Write:        scope.Write,
+				},
+			})
 		}
 
 		data, err := dbUser.MarshalBinary()
@@ -323,6 +497,17 @@ func (s *BboltStorage) ListAllCredentials() ([]auth.UserCredentials, error) {
 			if userType == "" {
 				userType = models.UserTypeHuman
 			}
+			var scopes []models.ChatScope
+			for _, scope := range dbUser.Scopes {
+				scopes = append(scopes, models.ChatScope{
+					ChatID: scope.ChatID,
+					BotPermissions: models.BotPermissions{
+						ReadMentions: scope.Permissions.ReadMentions,
+						ReadAll:      scope.Permissions.ReadAll,
+						Write:        scope.Permissions.Write,
+					},
+				})
+			}
 			credentials = append(credentials, auth.UserCredentials{
 				User: models.User{
 					ID:          dbUser.ID,
@@ -339,15 +524,22 @@ func (s *BboltStorage) ListAllCredentials() ([]auth.UserCredentials, error) {
 						ReadAll:      dbUser.BotPermissions.ReadAll,
 						Write:        dbUser.BotPermissions.Write,
 					},
+					Scoped:       dbUser.Scoped,
+					Scopes:       scopes,
 					TargetChatID: dbUser.TargetChatID,
+					WebhookChats: dbUser.WebhookChats,
 					SongURL:      dbUser.SongURL,
 					SongTitle:    dbUser.SongTitle,
 					SongArtist:   dbUser.SongArtist,
 					Bio:          dbUser.Bio,
 				},
-				PasswordHash: dbUser.PasswordHash,
-				TOTPSecret:   dbUser.TOTPSecret,
-				LastTOTP:     dbUser.LastTOTP,
+				PasswordHash:  dbUser.PasswordHash,
+				TOTPSecret:    dbUser.TOTPSecret,
+				LastTOTP:      dbUser.LastTOTP,
+				CallbackURL:   dbUser.CallbackURL,
+				WebhookSecret: dbUser.WebhookSecret,
+				RecoveryCodes: dbUser.RecoveryCodes,
+				PasskeyOnly:   dbUser.PasskeyOnly,
 			})
 			return nil
 		})
@@ -370,39 +562,109 @@ func (s *BboltStorage) ListCredentials() ([]auth.UserCredentials, error) {
 	return active, nil
 }
 
+// getChat reads the chat record of chatID, or returns nil if there is none.
+func (s *BboltStorage) getChat(tx *bbolt.Tx, chatID string) (*DBChat, error) {
+	data := tx.Bucket(bucketChats).Get([]byte(chatID))
+	if data == nil {
+		return nil, nil
+	}
+	return s.decodeChat(data)
+}
+
+func (s *BboltStorage) decodeChat(data []byte) (*DBChat, error) {
+	data, err := s.crypter.Decrypt(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt chat record: %w", err)
+	}
+	var dbChat DBChat
+	if err := dbChat.UnmarshalBinary(data); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal chat: %w", err)
+	}
+	return &dbChat, nil
+}
+
+// putChat encrypts and stores a chat record. Chat records hold group names,
+// member lists and pins, so they are encrypted like messages.
+func (s *BboltStorage) putChat(tx *bbolt.Tx, dbChat *DBChat) error {
+	data, err := dbChat.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	data, err = s.crypter.Encrypt(data)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt chat record: %w", err)
+	}
+	return dirtyPut(tx, tx.Bucket(bucketChats), [][]byte{bucketChats}, dbChat.Key(), data)
+}
+
+// encryptChats encrypts the chat records stored in plain text by versions
+// that didn't encrypt them. Records that don't decrypt and aren't plain chat
+// records are left alone.
+func (s *BboltStorage) encryptChats() error {
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		var plain []*DBChat
+		err := tx.Bucket(bucketChats).ForEach(func(k, v []byte) error {
+			if _, err := s.crypter.Decrypt(v); err == nil {
+				return nil
+			}
+			var dbChat DBChat
+			if err := dbChat.UnmarshalBinary(v); err == nil && dbChat.ID == string(k) {
+				plain = append(plain, &dbChat)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, dbChat := range plain {
+			if err := s.putChat(tx, dbChat); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
 // UpsertChat saves chat struct to the database.
 func (s *BboltStorage) UpsertChat(chat models.Chat) error {
 	return s.db.Update(func(tx *bbolt.Tx) error {
-		b := tx.Bucket(bucketChats)
-		chatKey := []byte(chat.ID)
 		lastSeq := chat.LastSeq
-
-		if existingData := b.Get(chatKey); existingData != nil {
-			var existingDBChat DBChat
-			if err := existingDBChat.UnmarshalBinary(existingData); err == nil {
-				if existingDBChat.LastSeq > lastSeq {
-					lastSeq = existingDBChat.LastSeq
-				}
+		firstSeq := chat.FirstSeq
+		var retention *DBRetention
+		var disappearAfter int64
+		createdBy := chat.CreatedBy
+
+		if existingDBChat, err := s.getChat(tx, chat.ID); err == nil && existingDBChat != nil {
+			if existingDBChat.LastSeq > lastSeq {
+				lastSeq = existingDBChat.LastSeq
+			}
+			// FirstSeq only moves forward, and the retention policy and
+			// disappearing messages timer are only changed by
+			// SetChatRetention and SetDisappearAfter.
+			firstSeq = max(firstSeq, existingDBChat.FirstSeq)
+			retention = existingDBChat.Retention
+			disappearAfter = existingDBChat.DisappearAfter
+			// The creator of a group never changes.
+			if existingDBChat.CreatedBy != "" {
+				createdBy = existingDBChat.CreatedBy
 			}
 		}
 
 		dbChat := DBChat{
-			ID:        chat.ID,
-			Name:      chat.Name,
-			AvatarURL: chat.AvatarURL,
-			LastSeq:   lastSeq,
-			IsDM:      chat.IsDM,
-		}
-		data, err := dbChat.MarshalBinary()
-		if err != nil {
-			return err
-		}
-
-		// We do not encrypt chat metadata. It only contains IDs and last sequence number,
-		// and sequence number can be inferred by number of messages anyway.
-		// Encrypting chat metadata would require decrypting/encrypting it for every message upsert,
-		// which is too much fuss.
-		return dirtyPut(tx, b, [][]byte{bucketChats}, dbChat.Key(), data)
+			ID:             chat.ID,
+			Name:           chat.Name,
+			AvatarURL:      chat.AvatarURL,
+			LastSeq:        lastSeq,
+			IsDM:           chat.IsDM,
+			IsGroup:        chat.IsGroup,
+			Members:        chat.Members,
+			Pins:           chat.Pins,
+			FirstSeq:       firstSeq,
+			Retention:      retention,
+			DisappearAfter: disappearAfter,
+			CreatedBy:      createdBy,
+		}
+		return s.putChat(tx, &dbChat)
 	})
 }
 
@@ -413,8 +675,8 @@ func (s *BboltStorage) ListChats() ([]models.Chat, error) {
 		b := tx.Bucket(bucketChats)
 		msgBucket := tx.Bucket(bucketMessages)
 		return b.ForEach(func(k, v []byte) error {
-			var dbChat DBChat
-			if err := dbChat.UnmarshalBinary(v); err != nil {
+			dbChat, err := s.decodeChat(v)
+			if err != nil {
 				return err
 			}
 			lastSeq := dbChat.LastSeq
@@ -427,11 +689,18 @@ func (s *BboltStorage) ListChats() ([]models.Chat, error) {
 				}
 			}
 			chats = append(chats, models.Chat{
-				ID:        dbChat.ID,
-				Name:      dbChat.Name,
-				AvatarURL: dbChat.AvatarURL,
-				LastSeq:   lastSeq,
-				IsDM:      dbChat.IsDM,
+				ID:             dbChat.ID,
+				Name:           dbChat.Name,
+				AvatarURL:      dbChat.AvatarURL,
+				LastSeq:        lastSeq,
+				IsDM:           dbChat.IsDM,
+				IsGroup:        dbChat.IsGroup,
+				Members:        dbChat.Members,
+				Pins:           dbChat.Pins,
+				FirstSeq:       dbChat.FirstSeq,
+				Retention:      dbChat.Retention.toModel(),
+				DisappearAfter: dbChat.DisappearAfter,
+				CreatedBy:      dbChat.CreatedBy,
 			})
 			return nil
 		})
@@ -440,8 +709,10 @@ func (s *BboltStorage) ListChats() ([]models.Chat, error) {
 }
 
 // UpsertMessage saves chat message to the database and updates chat object last message sequence number and timestamp.
+// Storing a tombstone releases the files the message referred to.
 func (s *BboltStorage) UpsertMessage(message models.Message) error {
-	return s.db.Update(func(tx *bbolt.Tx) error {
+	var dropped []string
+	err := s.db.Update(func(tx *bbolt.Tx) error {
 		if message.ChatID == "" {
 			return errors.New("message missing chatID")
 		}
@@ -453,12 +724,26 @@ func (s *BboltStorage) UpsertMessage(message models.Message) error {
 			return fmt.Errorf("failed to create chat bucket: %w", err)
 		}
 
+		var oldTokens, oldFileIDs []string
+		if old, err := s.getMessage(chatBucket, message.Seq); err != nil {
+			return err
+		} else if old != nil {
+			oldFileIDs = messageFileIDs(old)
+			if !old.Deleted {
+				oldTokens = content.Tokenize(old.Content)
+			}
+		}
+
 		dbMessage := DBMessage{
-			Seq:       message.Seq,
-			Timestamp: message.Timestamp,
-			ChatID:    message.ChatID,
-			UserID:    message.UserID,
-			Content:   message.Content,
+			Seq:            message.Seq,
+			Timestamp:      message.Timestamp,
+			ChatID:         message.ChatID,
+			UserID:         message.UserID,
+			Content:        message.Content,
+			EditedAt:       message.EditedAt,
+			Deleted:        message.Deleted,
+			ExpiresAt:      message.ExpiresAt,
+			DisappearAfter: message.DisappearAfter,
 		}
 
 		if len(message.Attachments) > 0 {
@@ -473,6 +758,44 @@ func (s *BboltStorage) UpsertMessage(message models.Message) error {
 			}
 		}
 
+		for _, r := range message.Revisions {
+			dbMessage.Revisions = append(dbMessage.Revisions, DBRevision{
+				Content:   r.Content,
+				Timestamp: r.Timestamp,
+			})
+		}
+
+		for _, r := range message.Reactions {
+			dbMessage.Reactions = append(dbMessage.Reactions, DBReaction{
+				Emoji:   r.Emoji,
+				UserIDs: r.UserIDs,
+			})
+		}
+
+		if message.ReplyTo != nil {
+			dbMessage.ReplyTo = &DBReplyRef{
+				ChatID: message.ReplyTo.ChatID,
+				Seq:    message.ReplyTo.Seq,
+			}
+		}
+
+		for _, p := range message.Previews {
+			dbMessage.Previews = append(dbMessage.Previews, DBLinkPreview{
+				URL:         p.URL,
+				Title:       p.Title,
+				Description: p.Description,
+				SiteName:    p.SiteName,
+				ImageID:     p.ImageID,
+			})
+		}
+
+		if message.Sender != nil {
+			dbMessage.Sender = &DBSender{
+				Name:     message.Sender.Name,
+				AvatarID: message.Sender.AvatarID,
+			}
+		}
+
 		data, err := dbMessage.MarshalBinary()
 		if err != nil {
 			return fmt.Errorf("failed to marshal message: %w", err)
@@ -487,34 +810,61 @@ func (s *BboltStorage) UpsertMessage(message models.Message) error {
 			return fmt.Errorf("failed to put message: %w", err)
 		}
 
-		// 2. Update chat LastSeq
-		chatBucketStats := tx.Bucket(bucketChats)
-		chatKey := []byte(message.ChatID)
-		chatData := chatBucketStats.Get(chatKey)
-		if chatData == nil {
-			return fmt.Errorf("chat %s not found for message upsert", message.ChatID)
+		var newTokens []string
+		if !message.Deleted {
+			newTokens = content.Tokenize(message.Content)
+		}
+		if err := s.updateSearchIndex(tx, message.ChatID, message.Seq, message.Timestamp, oldTokens, newTokens); err != nil {
+			return fmt.Errorf("failed to update search index: %w", err)
+		}
+		if message.ExpiresAt > 0 {
+			if err := indexExpiry(tx, &dbMessage); err != nil {
+				return fmt.Errorf("failed to index message expiry: %w", err)
+			}
+		}
+		if dbMessage.ReplyTo != nil {
+			if err := indexReply(tx, &dbMessage); err != nil {
+				return fmt.Errorf("failed to index reply: %w", err)
+			}
+		}
+		newFileIDs := messageFileIDs(&dbMessage)
+		if err := indexFiles(tx, message.ChatID, message.Seq, oldFileIDs, newFileIDs); err != nil {
+			return fmt.Errorf("failed to index message files: %w", err)
+		}
+		if message.Deleted {
+			for _, id := range oldFileIDs {
+				if !slices.Contains(newFileIDs, id) {
+					dropped = append(dropped, id)
+				}
+			}
 		}
 
-		var dbChat DBChat
-		if err := dbChat.UnmarshalBinary(chatData); err != nil {
-			return fmt.Errorf("failed to unmarshal chat: %w", err)
+		// 2. Update chat LastSeq
+		dbChat, err := s.getChat(tx, message.ChatID)
+		if err != nil {
+			return err
+		}
+		if dbChat == nil {
+			return fmt.Errorf("chat %s not found for message upsert", message.ChatID)
 		}
 
 		// Update LastSeq
 		if int(message.Seq) > dbChat.LastSeq {
 			dbChat.LastSeq = int(message.Seq)
-
-			newData, err := dbChat.MarshalBinary()
-			if err != nil {
-				return err
-			}
-			if err := dirtyPut(tx, chatBucketStats, [][]byte{bucketChats}, chatKey, newData); err != nil {
+			if err := s.putChat(tx, dbChat); err != nil {
 				return err
 			}
 		}
 
 		return nil
 	})
+	if err != nil {
+		return err
+	}
+	if _, err := s.ReleaseFiles(dropped); err != nil {
+		return fmt.Errorf("failed to release files of deleted message: %w", err)
+	}
+	return nil
 }
 
 // ListMessages returns chat messages stored in the database.
@@ -545,37 +895,106 @@ func (s *BboltStorage) ListMessages(chatID string, from, to int64) ([]models.Mes
 			if err := dbMsg.UnmarshalBinary(v); err != nil {
 				return err
 			}
-			msg := models.Message{
-				Seq:       dbMsg.Seq,
-				Timestamp: dbMsg.Timestamp,
-				ChatID:    dbMsg.ChatID,
-				UserID:    dbMsg.UserID,
-				Content:   dbMsg.Content,
-			}
-			if len(dbMsg.Attachments) > 0 {
-				msg.Attachments = make([]models.Attachment, len(dbMsg.Attachments))
-				for i, a := range dbMsg.Attachments {
-					msg.Attachments[i] = models.Attachment{
-						Type:     models.AttachmentType(a.Type),
-						Name:     a.Name,
-						MimeType: a.MimeType,
-						FileID:   a.FileID,
-					}
-				}
+			messages = append(messages, dbMsg.toModel())
+		}
+		return nil
+	})
+	return messages, err
+}
+
+// GetMessages returns the stored messages of chatID with the given seqs, in
+// ascending seq order. Seqs with no stored message are skipped.
+func (s *BboltStorage) GetMessages(chatID string, seqs []int64) ([]models.Message, error) {
+	seqs = slices.Clone(seqs)
+	slices.Sort(seqs)
+	seqs = slices.Compact(seqs)
+
+	var messages []models.Message
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		chatBucket := tx.Bucket(bucketMessages).Bucket([]byte(chatID))
+		if chatBucket == nil {
+			return nil
+		}
+		for _, seq := range seqs {
+			dbMsg, err := s.getMessage(chatBucket, seq)
+			if err != nil {
+				return err
+			}
+			if dbMsg != nil {
+				messages = append(messages, dbMsg.toModel())
 			}
-			messages = append(messages, msg)
 		}
 		return nil
 	})
 	return messages, err
 }
 
-func (s *BboltStorage) UpsertToken(userID string, tokenHash string) error {
+// toModel converts a decrypted message record to a message.
+func (m *DBMessage) toModel() models.Message {
+	msg := models.Message{
+		Seq:            m.Seq,
+		Timestamp:      m.Timestamp,
+		ChatID:         m.ChatID,
+		UserID:         m.UserID,
+		Content:        m.Content,
+		EditedAt:       m.EditedAt,
+		Deleted:        m.Deleted,
+		ExpiresAt:      m.ExpiresAt,
+		DisappearAfter: m.DisappearAfter,
+	}
+	if len(m.Attachments) > 0 {
+		msg.Attachments = make([]models.Attachment, len(m.Attachments))
+		for i, a := range m.Attachments {
+			msg.Attachments[i] = models.Attachment{
+				Type:     models.AttachmentType(a.Type),
+				Name:     a.Name,
+				MimeType: a.MimeType,
+				FileID:   a.FileID,
+			}
+		}
+	}
+	for _, r := range m.Revisions {
+		msg.Revisions = append(msg.Revisions, models.MessageRevision{
+			Content:   r.Content,
+			Timestamp: r.Timestamp,
+		})
+	}
+	for _, r := range m.Reactions {
+		msg.Reactions = append(msg.Reactions, models.Reaction{
+			Emoji:   r.Emoji,
+			Count:   len(r.UserIDs),
+			UserIDs: r.UserIDs,
+		})
+	}
+	if m.ReplyTo != nil {
+		msg.ReplyTo = &models.ReplyRef{
+			ChatID: m.ReplyTo.ChatID,
+			Seq:    m.ReplyTo.Seq,
+		}
+	}
+	for _, p := range m.Previews {
+		msg.Previews = append(msg.Previews, p.toModel())
+	}
+	if m.Sender != nil {
+		msg.Sender = &models.SenderOverride{
+			Name:     m.Sender.Name,
+			AvatarID: m.Sender.AvatarID,
+		}
+	}
+	return msg
+}
+
+// UpsertSession saves a login session, keyed by its token hash.
+func (s *BboltStorage) UpsertSession(session auth.Session) error {
 	return s.db.Update(func(tx *bbolt.Tx) error {
 		b := tx.Bucket(bucketTokensV2)
 		dbToken := &DBToken{
-			UserID: userID,
-			Token:  tokenHash,
+			UserID:    session.UserID,
+			Token:     session.TokenHash,
+			ID:        session.ID,
+			CreatedAt: session.CreatedAt,
+			UserAgent: session.UserAgent,
+			IP:        session.IP,
 		}
 		data, err := dbToken.MarshalBinary()
 		if err != nil {
@@ -598,8 +1017,8 @@ func (s *BboltStorage) DeleteToken(tokenHash string) error {
 	})
 }
 
-func (s *BboltStorage) ListTokens() (map[string]string, error) {
-	tokens := make(map[string]string)
+func (s *BboltStorage) ListSessions() ([]auth.Session, error) {
+	var sessions []auth.Session
 	err := s.db.View(func(tx *bbolt.Tx) error {
 		b := tx.Bucket(bucketTokensV2)
 		return b.ForEach(func(k, v []byte) error {
@@ -613,19 +1032,32 @@ func (s *BboltStorage) ListTokens() (map[string]string, error) {
 				return err
 			}
 			// key (k) is also token hash, but let's use the one from struct
-			tokens[dbToken.Token] = dbToken.UserID
+			sessions = append(sessions, auth.Session{
+				ID:        dbToken.ID,
+				UserID:    dbToken.UserID,
+				TokenHash: dbToken.Token,
+				CreatedAt: dbToken.CreatedAt,
+				UserAgent: dbToken.UserAgent,
+				IP:        dbToken.IP,
+			})
 			return nil
 		})
 	})
-	return tokens, err
+	return sessions, err
 }
 
-func (s *BboltStorage) UpsertAPIKey(userID string, keyHash string) error {
+func (s *BboltStorage) UpsertAPIKey(key auth.APIKey) error {
 	return s.db.Update(func(tx *bbolt.Tx) error {
 		b := tx.Bucket(bucketAPIKeys)
 		dbKey := &DBAPIKey{
-			UserID:  userID,
-			KeyHash: keyHash,
+			ID:         key.ID,
+			UserID:     key.UserID,
+			KeyHash:    key.KeyHash,
+			Name:       key.Name,
+			CreatedAt:  key.CreatedAt,
+			ExpiresAt:  key.ExpiresAt,
+			LastUsedAt: key.LastUsedAt,
+			LastUsedIP: key.LastUsedIP,
 		}
 		data, err := dbKey.MarshalBinary()
 		if err != nil {
@@ -646,8 +1078,8 @@ func (s *BboltStorage) DeleteAPIKey(keyHash string) error {
 	})
 }
 
-func (s *BboltStorage) ListAPIKeys() (map[string]string, error) {
-	keys := make(map[string]string)
+func (s *BboltStorage) ListAPIKeys() ([]auth.APIKey, error) {
+	var keys []auth.APIKey
 	err := s.db.View(func(tx *bbolt.Tx) error {
 		b := tx.Bucket(bucketAPIKeys)
 		return b.ForEach(func(k, v []byte) error {
@@ -660,7 +1092,17 @@ func (s *BboltStorage) ListAPIKeys() (map[string]string, error) {
 			if err := dbKey.UnmarshalBinary(v); err != nil {
 				return err
 			}
-			keys[dbKey.KeyHash] = dbKey.UserID
+			key := auth.APIKey{
+				ID:         dbKey.ID,
+				UserID:     dbKey.UserID,
+				KeyHash:    dbKey.KeyHash,
+				Name:       dbKey.Name,
+				CreatedAt:  dbKey.CreatedAt,
+				ExpiresAt:  dbKey.ExpiresAt,
+				LastUsedAt: dbKey.LastUsedAt,
+				LastUsedIP: dbKey.LastUsedIP,
+			}
+			keys = append(keys, key)
 			return nil
 		})
 	})
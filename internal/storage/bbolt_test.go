@@ -169,34 +169,69 @@ func TestStorage(t *testing.T) {
 	})
 
 	t.Run("Tokens", func(t *testing.T) {
-		userID := "user2" // using user2 to avoid confusion with previous subtest though store is same
-		tokenHash := "token_hash_123"
+		session := auth.Session{
+			ID:        "s1",
+			UserID:    "user2", // using user2 to avoid confusion with previous subtest though store is same
+			TokenHash: "token_hash_123",
+			CreatedAt: 1700000000,
+			UserAgent: "Firefox",
+			IP:        "192.0.2.1",
+		}
 
-		if err := store.UpsertToken(userID, tokenHash); err != nil {
-			t.Fatalf("UpsertToken failed: %v", err)
+		if err := store.UpsertSession(session); err != nil {
+			t.Fatalf("UpsertSession failed: %v", err)
 		}
 
-		tokens, err := store.ListTokens()
+		sessions, err := store.ListSessions()
 		if err != nil {
-			t.Fatalf("ListTokens failed: %v", err)
+			t.Fatalf("ListSessions failed: %v", err)
 		}
-		if tokens[tokenHash] != userID {
-			t.Errorf("expected userID %s for token %s, got %s", userID, tokenHash, tokens[tokenHash])
+		if len(sessions) != 1 || sessions[0] != session {
+			t.Errorf("expected session %+v, got %+v", session, sessions)
 		}
 
-		if err := store.DeleteToken(tokenHash); err != nil {
+		if err := store.DeleteToken(session.TokenHash); err != nil {
 			t.Fatalf("DeleteToken failed: %v", err)
 		}
 
-		tokens, err = store.ListTokens()
+		sessions, err = store.ListSessions()
 		if err != nil {
-			t.Fatalf("ListTokens failed: %v", err)
+			t.Fatalf("ListSessions failed: %v", err)
 		}
-		if _, ok := tokens[tokenHash]; ok {
+		if len(sessions) != 0 {
 			t.Errorf("expected token to be deleted")
 		}
 	})
 
+	t.Run("BotScopes", func(t *testing.T) {
+		scopes := []models.ChatScope{{ChatID: "g1", BotPermissions: models.BotPermissions{ReadMentions: true, Write: true}}}
+		bot := auth.UserCredentials{User: models.User{
+			ID:       "scoped_bot",
+			UserName: "scopedbot",
+			Status:   models.UserStatusActive,
+			Type:     models.UserTypeBot,
+			Scoped:   true,
+			Scopes:   scopes,
+		}}
+		if err := store.UpsertCredentials(bot); err != nil {
+			t.Fatalf("UpsertCredentials failed: %v", err)
+		}
+
+		creds, err := store.ListAllCredentials()
+		if err != nil {
+			t.Fatalf("ListAllCredentials failed: %v", err)
+		}
+		for _, c := range creds {
+			if c.ID == bot.ID {
+				if !c.Scoped || len(c.Scopes) != 1 || c.Scopes[0] != scopes[0] {
+					t.Errorf("unexpected scopes %+v", c.Scopes)
+				}
+				return
+			}
+		}
+		t.Fatal("scoped bot not found")
+	})
+
 	t.Run("Attachments", func(t *testing.T) {
 		msg := models.Message{
 			Seq:       3,
@@ -563,4 +598,114 @@ func TestStorage(t *testing.T) {
 			t.Errorf("expected LastSeq 2, got %d", targetChat.LastSeq)
 		}
 	})
+
+	t.Run("MessageRevisionsAndReactions", func(t *testing.T) {
+		chatID := "dm_user1_user2"
+		msg := models.Message{
+			ChatID:    chatID,
+			Seq:       1,
+			UserID:    "user1",
+			Content:   "hello there",
+			EditedAt:  200,
+			Revisions: []models.MessageRevision{{Content: "helo", Timestamp: 100}},
+			Reactions: []models.Reaction{{Emoji: "👍", Count: 2, UserIDs: []string{"user1", "user2"}}},
+		}
+		if err := store.UpsertMessage(msg); err != nil {
+			t.Fatalf("UpsertMessage failed: %v", err)
+		}
+
+		msgs, err := store.ListMessages(chatID, 1, 1)
+		if err != nil {
+			t.Fatalf("ListMessages failed: %v", err)
+		}
+		if len(msgs) != 1 {
+			t.Fatalf("expected 1 message, got %d", len(msgs))
+		}
+		got := msgs[0]
+		if got.Content != "hello there" || got.EditedAt != 200 {
+			t.Errorf("unexpected message: %+v", got)
+		}
+		if len(got.Revisions) != 1 || got.Revisions[0].Content != "helo" || got.Revisions[0].Timestamp != 100 {
+			t.Errorf("unexpected revisions: %+v", got.Revisions)
+		}
+		if len(got.Reactions) != 1 || got.Reactions[0].Emoji != "👍" || got.Reactions[0].Count != 2 {
+			t.Errorf("unexpected reactions: %+v", got.Reactions)
+		}
+	})
+
+	t.Run("GroupChatMembers", func(t *testing.T) {
+		chatID := "group_family"
+		if err := store.UpsertChat(models.Chat{ID: chatID, Name: "Family", IsGroup: true, Members: []string{"user1", "user2"}, Pins: []int64{3, 1}}); err != nil {
+			t.Fatalf("UpsertChat failed: %v", err)
+		}
+
+		chats, err := store.ListChats()
+		if err != nil {
+			t.Fatalf("ListChats failed: %v", err)
+		}
+
+		for _, c := range chats {
+			if c.ID != chatID {
+				continue
+			}
+			if !c.IsGroup || c.Name != "Family" {
+				t.Errorf("expected group chat Family, got %+v", c)
+			}
+			if len(c.Members) != 2 || c.Members[0] != "user1" || c.Members[1] != "user2" {
+				t.Errorf("expected members [user1 user2], got %v", c.Members)
+			}
+			if len(c.Pins) != 2 || c.Pins[0] != 3 || c.Pins[1] != 1 {
+				t.Errorf("expected pins [3 1], got %v", c.Pins)
+			}
+			return
+		}
+		t.Fatalf("group chat %s not found in ListChats", chatID)
+	})
+}
+
+func TestChatRecordsEncrypted(t *testing.T) {
+	tmpDir := t.TempDir()
+	dbPath := filepath.Join(tmpDir, "test.db")
+	fs, _ := filestore.NewLocalFileStore(filepath.Join(tmpDir, "fs"))
+	store, err := NewBboltStorage(dbPath, testSecret, fs)
+	if err != nil {
+		t.Fatalf("failed to create storage: %v", err)
+	}
+	if err := store.UpsertChat(models.Chat{ID: "g1", Name: "Secret Plans"}); err != nil {
+		t.Fatalf("UpsertChat failed: %v", err)
+	}
+	// Store a chat the way versions without chat encryption did.
+	err = store.db.Update(func(tx *bbolt.Tx) error {
+		data, _ := (&DBChat{ID: "g2", Name: "Legacy Plans", IsGroup: true}).MarshalBinary()
+		return tx.Bucket(bucketChats).Put([]byte("g2"), data)
+	})
+	if err != nil {
+		t.Fatalf("failed to write plain chat: %v", err)
+	}
+	_ = store.Close()
+
+	store, err = NewBboltStorage(dbPath, testSecret, fs)
+	if err != nil {
+		t.Fatalf("failed to reopen storage: %v", err)
+	}
+	chats, err := store.ListChats()
+	if err != nil {
+		t.Fatalf("ListChats failed: %v", err)
+	}
+	if len(chats) != 2 {
+		t.Fatalf("expected 2 chats, got %d", len(chats))
+	}
+	defer func() { _ = store.Close() }()
+
+	err = store.db.View(func(tx *bbolt.Tx) error {
+		return tx.Bucket(bucketChats).ForEach(func(k, v []byte) error {
+			if _, err := store.crypter.Decrypt(v); err != nil {
+				t.Errorf("chat %q is not encrypted: %v", k, err)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
 }
@@ -0,0 +1,63 @@
+package storage
+
+import (
+	"fmt"
+
+	"besedka/internal/models"
+
+	"go.etcd.io/bbolt"
+)
+
+// ListSlashCommands returns all registered slash commands.
+func (s *BboltStorage) ListSlashCommands() ([]models.SlashCommand, error) {
+	var commands []models.SlashCommand
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		return tx.Bucket(bucketSlashCommands).ForEach(func(k, v []byte) error {
+			v, err := s.crypter.Decrypt(v)
+			if err != nil {
+				return fmt.Errorf("failed to decrypt slash command: %w", err)
+			}
+			var c DBSlashCommand
+			if err := c.UnmarshalBinary(v); err != nil {
+				return err
+			}
+			commands = append(commands, models.SlashCommand{
+				Name:        c.Name,
+				BotID:       c.BotID,
+				Description: c.Description,
+			})
+			return nil
+		})
+	})
+	return commands, err
+}
+
+// UpsertSlashCommand registers a slash command, replacing any command with
+// the same name.
+func (s *BboltStorage) UpsertSlashCommand(cmd models.SlashCommand) error {
+	dbCmd := DBSlashCommand{
+		Name:        cmd.Name,
+		BotID:       cmd.BotID,
+		Description: cmd.Description,
+	}
+	data, err := dbCmd.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	data, err = s.crypter.Encrypt(data)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt slash command: %w", err)
+	}
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		b := tx.Bucket(bucketSlashCommands)
+		return dirtyPut(tx, b, [][]byte{bucketSlashCommands}, []byte(cmd.Name), data)
+	})
+}
+
+// DeleteSlashCommand removes a slash command by name.
+func (s *BboltStorage) DeleteSlashCommand(name string) error {
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		b := tx.Bucket(bucketSlashCommands)
+		return dirtyDelete(tx, b, [][]byte{bucketSlashCommands}, []byte(name))
+	})
+}
@@ -1,9 +1,13 @@
 package storage
 
 import (
+	"bytes"
 	"crypto/aes"
 	"crypto/cipher"
+	"crypto/hmac"
 	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"os"
 
@@ -15,6 +19,17 @@ const (
 	keyLen  = 32
 )
 
+// Encrypted values are wrapped in a versioned envelope naming the key they
+// were encrypted with: a version byte and the key ID, followed by the nonce
+// and ciphertext. The envelope header is authenticated along with the data.
+// Values written before envelopes existed are a bare nonce and ciphertext,
+// and are still accepted by Decrypt.
+const (
+	envelopeV1  byte = 1
+	keyIDLen         = 4
+	envelopeLen      = 1 + keyIDLen
+)
+
 var (
 	// 15 rounds shows around 0.15s in BenchmarkArgon on my machine.
 	argonTime uint32 = 15
@@ -32,8 +47,10 @@ func init() {
 }
 
 type Crypter struct {
-	salt []byte
-	aead cipher.AEAD
+	salt     []byte
+	aead     cipher.AEAD
+	indexKey []byte
+	id       []byte
 }
 
 // NewCrypter creates an instance of Crypter to encode/decode byte slices.
@@ -61,12 +78,30 @@ func NewCrypter(secret []byte, salt []byte) (*Crypter, error) {
 		return nil, err
 	}
 
+	// The blind index key is derived from the encryption key so index lookups
+	// don't reveal the key itself.
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte("besedka search index"))
+	indexKey := mac.Sum(nil)
+
+	// The key ID names the key in envelopes. It is a keyed hash as well, so
+	// it identifies a key without revealing anything about it.
+	mac = hmac.New(sha256.New, key)
+	mac.Write([]byte("besedka key id"))
+
 	return &Crypter{
-		salt: salt,
-		aead: aead,
+		salt:     salt,
+		aead:     aead,
+		indexKey: indexKey,
+		id:       mac.Sum(nil)[:keyIDLen],
 	}, nil
 }
 
+// KeyID returns the ID of the key, as named in the envelopes it writes.
+func (c *Crypter) KeyID() string {
+	return hex.EncodeToString(c.id)
+}
+
 // Salt returns the salt used to derive the encryption key.
 // It must be persisted alongside encrypted data so that the Crypter can be
 // reconstructed with the same key on load.
@@ -89,13 +124,135 @@ func deriveKey(secret, salt []byte) []byte {
 }
 
 // Encrypt encrypts data using AES-256-GCM with a random nonce prepended to
-// the ciphertext.
+// the ciphertext, wrapped in an envelope naming the key.
 func (c *Crypter) Encrypt(data []byte) ([]byte, error) {
-	return c.aead.Seal(nil, nil, data, nil), nil
+	header := make([]byte, envelopeLen, envelopeLen+c.aead.NonceSize()+len(data)+c.aead.Overhead())
+	header[0] = envelopeV1
+	copy(header[1:], c.id)
+	return c.aead.Seal(header, nil, data, bytes.Clone(header)), nil
+}
+
+// BlindIndex returns a keyed hash of data. It is deterministic, so it can be
+// used as a lookup key without storing data in plaintext.
+func (c *Crypter) BlindIndex(data []byte) []byte {
+	mac := hmac.New(sha256.New, c.indexKey)
+	mac.Write(data)
+	return mac.Sum(nil)
 }
 
 // Decrypt decrypts data produced by Encrypt, extracting the prepended nonce
 // and using AES-256-GCM to recover the plaintext.
 func (c *Crypter) Decrypt(data []byte) ([]byte, error) {
+	if id, ok := envelopeKeyID(data); ok && bytes.Equal(id, c.id) {
+		if plain, err := c.aead.Open(nil, nil, data[envelopeLen:], data[:envelopeLen]); err == nil {
+			return plain, nil
+		}
+	}
+	// Written before envelopes, or a bare value that happens to look like one.
 	return c.aead.Open(nil, nil, data, nil)
 }
+
+// envelopeKeyID returns the key ID named by an envelope. A value written
+// before envelopes can look like one by chance, so a match is only a hint.
+func envelopeKeyID(data []byte) ([]byte, bool) {
+	if len(data) < envelopeLen || data[0] != envelopeV1 {
+		return nil, false
+	}
+	return data[1:envelopeLen], true
+}
+
+// Keyring holds the current key and the keys it replaced. It decrypts a value
+// with whichever key the value names and always encrypts with the current
+// key, so a key can be rolled over while old records are migrated gradually.
+type Keyring struct {
+	current *Crypter
+	old     []*Crypter
+}
+
+// NewKeyring returns a keyring that encrypts with current and can still
+// decrypt values written with any of the old keys.
+func NewKeyring(current *Crypter, old ...*Crypter) *Keyring {
+	return &Keyring{current: current, old: old}
+}
+
+// Encrypt encrypts data with the current key.
+func (k *Keyring) Encrypt(data []byte) ([]byte, error) {
+	return k.current.Encrypt(data)
+}
+
+// Decrypt decrypts data with the key it names, falling back to trying every
+// key for values written before envelopes.
+func (k *Keyring) Decrypt(data []byte) ([]byte, error) {
+	if id, ok := envelopeKeyID(data); ok {
+		for _, c := range k.keys() {
+			if bytes.Equal(c.id, id) {
+				if plain, err := c.Decrypt(data); err == nil {
+					return plain, nil
+				}
+			}
+		}
+	}
+	var err error
+	for _, c := range k.keys() {
+		var plain []byte
+		if plain, err = c.aead.Open(nil, nil, data, nil); err == nil {
+			return plain, nil
+		}
+	}
+	return nil, err
+}
+
+// BlindIndex returns a keyed hash of data under the current key.
+func (k *Keyring) BlindIndex(data []byte) []byte {
+	return k.current.BlindIndex(data)
+}
+
+// Salt returns the salt the keys are derived with.
+func (k *Keyring) Salt() []byte {
+	return k.current.Salt()
+}
+
+// CurrentKeyID returns the ID of the key new values are encrypted with.
+func (k *Keyring) CurrentKeyID() string {
+	return k.current.KeyID()
+}
+
+// OldKeyIDs returns the IDs of the keys kept for decryption only.
+func (k *Keyring) OldKeyIDs() []string {
+	ids := make([]string, 0, len(k.old))
+	for _, c := range k.old {
+		ids = append(ids, c.KeyID())
+	}
+	return ids
+}
+
+// keyAge classifies an encrypted value by the key it was written with.
+type keyAge int
+
+const (
+	keyCurrent keyAge = iota
+	keyOld
+	keyUnversioned
+)
+
+// age reports whether data names the current key, an old key, or no key of
+// the keyring. Values written before envelopes fall in the last group.
+func (k *Keyring) age(data []byte) keyAge {
+	id, ok := envelopeKeyID(data)
+	if !ok {
+		return keyUnversioned
+	}
+	if bytes.Equal(id, k.current.id) {
+		return keyCurrent
+	}
+	for _, c := range k.old {
+		if bytes.Equal(id, c.id) {
+			return keyOld
+		}
+	}
+	return keyUnversioned
+}
+
+func (k *Keyring) keys() []*Crypter {
+	return append([]*Crypter{k.current}, k.old...)
+}
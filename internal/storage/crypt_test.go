@@ -207,6 +207,60 @@ func TestSalt_Persistence(t *testing.T) {
 	}
 }
 
+func TestEnvelope(t *testing.T) {
+	c, err := NewCrypter([]byte("test-secret"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ct, _ := c.Encrypt([]byte("hello"))
+	if id, ok := envelopeKeyID(ct); !ok || fmt.Sprintf("%x", id) != c.KeyID() {
+		t.Fatalf("expected an envelope naming key %s, got %x", c.KeyID(), ct[:envelopeLen])
+	}
+
+	// Values written before envelopes are a bare nonce and ciphertext.
+	legacy := c.aead.Seal(nil, nil, []byte("old"), nil)
+	if got, err := c.Decrypt(legacy); err != nil || string(got) != "old" {
+		t.Errorf("expected an unversioned value to decrypt, got %q %v", got, err)
+	}
+
+	// The header is authenticated.
+	ct[1] ^= 0xFF
+	if _, err := c.Decrypt(ct); err == nil {
+		t.Error("expected a tampered key ID to fail")
+	}
+}
+
+func TestKeyring(t *testing.T) {
+	salt := make([]byte, SaltLen)
+	oldKey, _ := NewCrypter([]byte("old-secret"), salt)
+	newKey, _ := NewCrypter([]byte("new-secret"), salt)
+	if oldKey.KeyID() == newKey.KeyID() {
+		t.Fatal("expected different keys to have different IDs")
+	}
+
+	oldCT, _ := oldKey.Encrypt([]byte("from before"))
+	legacyCT := oldKey.aead.Seal(nil, nil, []byte("from long before"), nil)
+	ring := NewKeyring(newKey, oldKey)
+
+	if got, err := ring.Decrypt(oldCT); err != nil || string(got) != "from before" {
+		t.Errorf("expected a value on the old key to decrypt, got %q %v", got, err)
+	}
+	if got, err := ring.Decrypt(legacyCT); err != nil || string(got) != "from long before" {
+		t.Errorf("expected an unversioned value to decrypt, got %q %v", got, err)
+	}
+	newCT, _ := ring.Encrypt([]byte("now"))
+	if ring.age(newCT) != keyCurrent || ring.age(oldCT) != keyOld || ring.age(legacyCT) == keyCurrent {
+		t.Errorf("expected values to be classified by key")
+	}
+	if _, err := oldKey.Decrypt(newCT); err == nil {
+		t.Error("expected the old key not to decrypt new values")
+	}
+	if _, err := NewKeyring(newKey).Decrypt(oldCT); err == nil {
+		t.Error("expected a keyring without the old key to fail")
+	}
+}
+
 func BenchmarkArgon(b *testing.B) {
 	// To find suitable argon2 number of rounds.
 	secret := make([]byte, keyLen)
@@ -0,0 +1,281 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+
+	"github.com/vmihailenco/msgpack/v5"
+	"go.etcd.io/bbolt"
+)
+
+// Outgoing bot webhook requests are queued per bot. Keys are the bot ID, a
+// zero byte and the big-endian delivery ID, so each bot's queue is a
+// contiguous, ordered key range that can be counted without decrypting.
+
+// Delivery is a queued outgoing webhook request.
+type Delivery struct {
+	ID          uint64 `msgpack:"id"`
+	BotID       string `msgpack:"botId"`
+	Payload     []byte `msgpack:"payload"`
+	Attempts    int    `msgpack:"attempts"`
+	NextAttempt int64  `msgpack:"nextAttempt"` // Unix seconds
+	CreatedAt   int64  `msgpack:"createdAt"`
+}
+
+func (d *Delivery) Key() []byte {
+	return deliveryKey(d.BotID, d.ID)
+}
+
+func (d *Delivery) MarshalBinary() (data []byte, err error) {
+	type alias Delivery
+	return msgpack.Marshal((*alias)(d))
+}
+
+func (d *Delivery) UnmarshalBinary(data []byte) error {
+	type alias Delivery
+	return msgpack.Unmarshal(data, (*alias)(d))
+}
+
+// DeliveryStatus summarizes webhook delivery for one bot.
+type DeliveryStatus struct {
+	BotID          string `msgpack:"botId"`
+	Delivered      int64  `msgpack:"delivered"`
+	Dropped        int64  `msgpack:"dropped"` // Gave up after retries or evicted from a full queue
+	LastAttempt    int64  `msgpack:"lastAttempt"`
+	LastSuccess    int64  `msgpack:"lastSuccess"`
+	LastError      string `msgpack:"lastError"`
+	LastStatusCode int    `msgpack:"lastStatusCode"`
+}
+
+func (s *DeliveryStatus) MarshalBinary() (data []byte, err error) {
+	type alias DeliveryStatus
+	return msgpack.Marshal((*alias)(s))
+}
+
+func (s *DeliveryStatus) UnmarshalBinary(data []byte) error {
+	type alias DeliveryStatus
+	return msgpack.Unmarshal(data, (*alias)(s))
+}
+
+func deliveryPrefix(botID string) []byte {
+	return append([]byte(botID), 0)
+}
+
+func deliveryKey(botID string, id uint64) []byte {
+	return binary.BigEndian.AppendUint64(deliveryPrefix(botID), id)
+}
+
+// EnqueueDelivery appends d to its bot's queue and returns the ID it was
+// stored under, which is at least d.ID. When the queue already holds limit
+// deliveries the oldest ones are evicted to make room; the number evicted is
+// returned and counted as dropped.
+func (s *BboltStorage) EnqueueDelivery(d Delivery, limit int) (uint64, int, error) {
+	var dropped int
+	err := s.db.Update(func(tx *bbolt.Tx) error {
+		b := tx.Bucket(bucketBotDeliveries)
+		prefix := deliveryPrefix(d.BotID)
+
+		var keys [][]byte
+		c := b.Cursor()
+		for k, _ := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Next() {
+			keys = append(keys, bytes.Clone(k))
+		}
+
+		// IDs keep increasing within a queue so deliveries stay ordered.
+		if n := len(keys); n > 0 {
+			last := binary.BigEndian.Uint64(keys[n-1][len(prefix):])
+			d.ID = max(d.ID, last+1)
+		}
+
+		for len(keys) >= limit && len(keys) > 0 {
+			if err := dirtyDelete(tx, b, [][]byte{bucketBotDeliveries}, keys[0]); err != nil {
+				return err
+			}
+			keys = keys[1:]
+			dropped++
+		}
+
+		data, err := d.MarshalBinary()
+		if err != nil {
+			return err
+		}
+		data, err = s.crypter.Encrypt(data)
+		if err != nil {
+			return fmt.Errorf("failed to encrypt delivery: %w", err)
+		}
+		if err := dirtyPut(tx, b, [][]byte{bucketBotDeliveries}, d.Key(), data); err != nil {
+			return err
+		}
+
+		if dropped > 0 {
+			st, err := s.getDeliveryStatus(tx, d.BotID)
+			if err != nil {
+				return err
+			}
+			st.Dropped += int64(dropped)
+			return s.putDeliveryStatus(tx, st)
+		}
+		return nil
+	})
+	return d.ID, dropped, err
+}
+
+// ListDeliveries returns all queued deliveries, grouped by bot and oldest
+// first within each bot.
+func (s *BboltStorage) ListDeliveries() ([]Delivery, error) {
+	var deliveries []Delivery
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		return tx.Bucket(bucketBotDeliveries).ForEach(func(k, v []byte) error {
+			v, err := s.crypter.Decrypt(v)
+			if err != nil {
+				return fmt.Errorf("failed to decrypt delivery: %w", err)
+			}
+			var d Delivery
+			if err := d.UnmarshalBinary(v); err != nil {
+				return err
+			}
+			deliveries = append(deliveries, d)
+			return nil
+		})
+	})
+	return deliveries, err
+}
+
+// NextDelivery returns the oldest queued delivery of a bot, or nil if its
+// queue is empty. Only that delivery is decrypted.
+func (s *BboltStorage) NextDelivery(botID string) (*Delivery, error) {
+	var next *Delivery
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		prefix := deliveryPrefix(botID)
+		k, v := tx.Bucket(bucketBotDeliveries).Cursor().Seek(prefix)
+		if k == nil || !bytes.HasPrefix(k, prefix) {
+			return nil
+		}
+		v, err := s.crypter.Decrypt(v)
+		if err != nil {
+			return fmt.Errorf("failed to decrypt delivery: %w", err)
+		}
+		next = &Delivery{}
+		return next.UnmarshalBinary(v)
+	})
+	return next, err
+}
+
+// CountDeliveries returns the number of queued deliveries per bot ID.
+func (s *BboltStorage) CountDeliveries() (map[string]int, error) {
+	counts := make(map[string]int)
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		return tx.Bucket(bucketBotDeliveries).ForEach(func(k, _ []byte) error {
+			if i := bytes.IndexByte(k, 0); i > 0 {
+				counts[string(k[:i])]++
+			}
+			return nil
+		})
+	})
+	return counts, err
+}
+
+// UpdateDelivery stores a delivery's retry state if it is still queued.
+func (s *BboltStorage) UpdateDelivery(d Delivery) error {
+	data, err := d.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	data, err = s.crypter.Encrypt(data)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt delivery: %w", err)
+	}
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		b := tx.Bucket(bucketBotDeliveries)
+		if b.Get(d.Key()) == nil {
+			return nil // Evicted or cleared meanwhile
+		}
+		return dirtyPut(tx, b, [][]byte{bucketBotDeliveries}, d.Key(), data)
+	})
+}
+
+// DeleteDelivery removes a delivery from the queue.
+func (s *BboltStorage) DeleteDelivery(botID string, id uint64) error {
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		b := tx.Bucket(bucketBotDeliveries)
+		return dirtyDelete(tx, b, [][]byte{bucketBotDeliveries}, deliveryKey(botID, id))
+	})
+}
+
+// ClearDeliveries drops every queued delivery of a bot.
+func (s *BboltStorage) ClearDeliveries(botID string) error {
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		b := tx.Bucket(bucketBotDeliveries)
+		prefix := deliveryPrefix(botID)
+		var keys [][]byte
+		c := b.Cursor()
+		for k, _ := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Next() {
+			keys = append(keys, bytes.Clone(k))
+		}
+		for _, k := range keys {
+			if err := dirtyDelete(tx, b, [][]byte{bucketBotDeliveries}, k); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// UpdateDeliveryStatus applies update to the bot's delivery status.
+func (s *BboltStorage) UpdateDeliveryStatus(botID string, update func(st *DeliveryStatus)) error {
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		st, err := s.getDeliveryStatus(tx, botID)
+		if err != nil {
+			return err
+		}
+		update(&st)
+		return s.putDeliveryStatus(tx, st)
+	})
+}
+
+// ListDeliveryStatuses returns the delivery status of every bot that has one.
+func (s *BboltStorage) ListDeliveryStatuses() ([]DeliveryStatus, error) {
+	var statuses []DeliveryStatus
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		return tx.Bucket(bucketBotDeliveryStatus).ForEach(func(k, v []byte) error {
+			v, err := s.crypter.Decrypt(v)
+			if err != nil {
+				return fmt.Errorf("failed to decrypt delivery status: %w", err)
+			}
+			var st DeliveryStatus
+			if err := st.UnmarshalBinary(v); err != nil {
+				return err
+			}
+			statuses = append(statuses, st)
+			return nil
+		})
+	})
+	return statuses, err
+}
+
+func (s *BboltStorage) getDeliveryStatus(tx *bbolt.Tx, botID string) (DeliveryStatus, error) {
+	st := DeliveryStatus{BotID: botID}
+	data := tx.Bucket(bucketBotDeliveryStatus).Get([]byte(botID))
+	if data == nil {
+		return st, nil
+	}
+	data, err := s.crypter.Decrypt(data)
+	if err != nil {
+		return st, fmt.Errorf("failed to decrypt delivery status: %w", err)
+	}
+	return st, st.UnmarshalBinary(data)
+}
+
+func (s *BboltStorage) putDeliveryStatus(tx *bbolt.Tx, st DeliveryStatus) error {
+	data, err := st.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	data, err = s.crypter.Encrypt(data)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt delivery status: %w", err)
+	}
+	b := tx.Bucket(bucketBotDeliveryStatus)
+	return dirtyPut(tx, b, [][]byte{bucketBotDeliveryStatus}, []byte(st.BotID), data)
+}
@@ -0,0 +1,93 @@
+package storage
+
+import (
+	"path/filepath"
+	"testing"
+
+	"besedka/internal/filestore"
+)
+
+func TestDeliveryQueue(t *testing.T) {
+	tmpDir := t.TempDir()
+	fs, _ := filestore.NewLocalFileStore(filepath.Join(tmpDir, "fs"))
+	store, err := NewBboltStorage(filepath.Join(tmpDir, "test.db"), testSecret, fs)
+	if err != nil {
+		t.Fatalf("failed to create storage: %v", err)
+	}
+	defer func() { _ = store.Close() }()
+
+	enqueue := func(botID string, payload string) uint64 {
+		t.Helper()
+		id, _, err := store.EnqueueDelivery(Delivery{BotID: botID, Payload: []byte(payload)}, 3)
+		if err != nil {
+			t.Fatalf("EnqueueDelivery failed: %v", err)
+		}
+		return id
+	}
+
+	// IDs keep increasing even when the caller passes a stale one.
+	first := enqueue("bot1", "a")
+	second := enqueue("bot1", "b")
+	if second <= first {
+		t.Errorf("expected increasing IDs, got %d then %d", first, second)
+	}
+	enqueue("bot2", "x")
+	enqueue("bot1", "c")
+
+	// A full queue evicts its oldest delivery and counts it as dropped.
+	_, dropped, err := store.EnqueueDelivery(Delivery{BotID: "bot1", Payload: []byte("d")}, 3)
+	if err != nil || dropped != 1 {
+		t.Fatalf("expected one eviction, got %d %v", dropped, err)
+	}
+
+	deliveries, err := store.ListDeliveries()
+	if err != nil {
+		t.Fatalf("ListDeliveries failed: %v", err)
+	}
+	var bot1 []string
+	for _, d := range deliveries {
+		if d.BotID == "bot1" {
+			bot1 = append(bot1, string(d.Payload))
+		}
+	}
+	if len(bot1) != 3 || bot1[0] != "b" || bot1[2] != "d" {
+		t.Errorf("unexpected bot1 queue %q", bot1)
+	}
+
+	counts, err := store.CountDeliveries()
+	if err != nil || counts["bot1"] != 3 || counts["bot2"] != 1 {
+		t.Errorf("unexpected counts %v %v", counts, err)
+	}
+
+	next, err := store.NextDelivery("bot1")
+	if err != nil || next == nil || string(next.Payload) != "b" {
+		t.Errorf("expected the oldest bot1 delivery, got %+v %v", next, err)
+	}
+	if next, err := store.NextDelivery("bot3"); err != nil || next != nil {
+		t.Errorf("expected no delivery for an empty queue, got %+v %v", next, err)
+	}
+
+	d := deliveries[0]
+	d.Attempts = 2
+	if err := store.UpdateDelivery(d); err != nil {
+		t.Fatalf("UpdateDelivery failed: %v", err)
+	}
+	if err := store.DeleteDelivery("bot2", deliveries[len(deliveries)-1].ID); err != nil {
+		t.Fatalf("DeleteDelivery failed: %v", err)
+	}
+	if err := store.ClearDeliveries("bot1"); err != nil {
+		t.Fatalf("ClearDeliveries failed: %v", err)
+	}
+	// Updating a delivery that is gone must not resurrect it.
+	if err := store.UpdateDelivery(d); err != nil {
+		t.Fatalf("UpdateDelivery failed: %v", err)
+	}
+	if deliveries, _ := store.ListDeliveries(); len(deliveries) != 0 {
+		t.Errorf("expected empty queue, got %+v", deliveries)
+	}
+
+	statuses, err := store.ListDeliveryStatuses()
+	if err != nil || len(statuses) != 1 || statuses[0].BotID != "bot1" || statuses[0].Dropped != 1 {
+		t.Errorf("unexpected statuses %+v %v", statuses, err)
+	}
+}
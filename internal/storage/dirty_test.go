@@ -90,7 +90,7 @@ func TestDirtyMarkersAllWritePaths(t *testing.T) {
 		{"UpsertMessage", func() error {
 			return st.UpsertMessage(models.Message{ChatID: "c1", Seq: 1, UserID: "u1", Content: "hello"})
 		}, markerKindKey, []string{"messages", "c1", seqKey(1)}},
-		{"UpsertToken", func() error { return st.UpsertToken("u1", "tok-hash") }, markerKindKey, []string{"tokens_v2", "tok-hash"}},
+		{"UpsertSession", func() error { return st.UpsertSession(auth.Session{UserID: "u1", TokenHash: "tok-hash"}) }, markerKindKey, []string{"tokens_v2", "tok-hash"}},
 		{"DeleteToken", func() error { return st.DeleteToken("tok-hash") }, markerKindKey, []string{"tokens_v2", "tok-hash"}},
 		{"UpsertRegistrationToken", func() error { return st.UpsertRegistrationToken("u1", "reg") }, markerKindKey, []string{"registration_tokens", "u1"}},
 		{"DeleteRegistrationToken", func() error { return st.DeleteRegistrationToken("u1") }, markerKindKey, []string{"registration_tokens", "u1"}},
@@ -238,20 +238,20 @@ func TestIncrementalSnapshotResolvesLiveState(t *testing.T) {
 	st := newTestStorage(t)
 
 	// put-then-delete => delete wins.
-	if err := st.UpsertToken("u1", "gone"); err != nil {
+	if err := st.UpsertSession(auth.Session{UserID: "u1", TokenHash: "gone"}); err != nil {
 		t.Fatal(err)
 	}
 	if err := st.DeleteToken("gone"); err != nil {
 		t.Fatal(err)
 	}
 	// delete-then-reput => put wins.
-	if err := st.UpsertToken("u1", "kept"); err != nil {
+	if err := st.UpsertSession(auth.Session{UserID: "u1", TokenHash: "kept"}); err != nil {
 		t.Fatal(err)
 	}
 	if err := st.DeleteToken("kept"); err != nil {
 		t.Fatal(err)
 	}
-	if err := st.UpsertToken("u2", "kept"); err != nil {
+	if err := st.UpsertSession(auth.Session{UserID: "u2", TokenHash: "kept"}); err != nil {
 		t.Fatal(err)
 	}
 	// bucket tombstone plus recreation.
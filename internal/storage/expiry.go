@@ -0,0 +1,108 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"time"
+
+	"besedka/internal/models"
+
+	"go.etcd.io/bbolt"
+)
+
+// indexValue is stored under every key of the expiry, reply and file
+// reference indexes. Only the key matters, but the value must not be empty:
+// incremental backups read a missing value as a deletion.
+var indexValue = []byte{1}
+
+// expiryKey orders the expiry index by expiry time: expiresAt (8 bytes BE),
+// seq (8 bytes BE), then the chat ID.
+func expiryKey(chatID string, seq, expiresAt int64) []byte {
+	key := make([]byte, 16, 16+len(chatID))
+	binary.BigEndian.PutUint64(key, uint64(expiresAt))
+	binary.BigEndian.PutUint64(key[8:], uint64(seq))
+	return append(key, chatID...)
+}
+
+// parseExpiryKey splits an expiry index key into chat ID and seq.
+func parseExpiryKey(key []byte) (string, int64, error) {
+	if len(key) <= 16 {
+		return "", 0, fmt.Errorf("expiry key too short: %x", key)
+	}
+	return string(key[16:]), int64(binary.BigEndian.Uint64(key[8:16])), nil
+}
+
+// indexExpiry adds msg to the expiry index.
+func indexExpiry(tx *bbolt.Tx, msg *DBMessage) error {
+	b := tx.Bucket(bucketMessageExpiry)
+	return dirtyPut(tx, b, [][]byte{bucketMessageExpiry}, expiryKey(msg.ChatID, msg.Seq, msg.ExpiresAt), indexValue)
+}
+
+// SetDisappearAfter sets the disappearing messages timer of chatID in
+// seconds; 0 turns it off. The timer applies to messages sent after it is
+// set.
+func (s *BboltStorage) SetDisappearAfter(chatID string, seconds int64) error {
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		dbChat, err := s.getChat(tx, chatID)
+		if err != nil {
+			return err
+		}
+		if dbChat == nil {
+			return models.ErrNotFound
+		}
+		dbChat.DisappearAfter = seconds
+		return s.putChat(tx, dbChat)
+	})
+}
+
+// DeleteExpiredMessages deletes the messages that expired by now, in batches,
+// along with their search index entries. It returns the deleted seqs by chat
+// ID, and the IDs of the files the messages referred to; pass them to
+// ReleaseFiles.
+func (s *BboltStorage) DeleteExpiredMessages(now time.Time) (map[string][]int64, []string, error) {
+	expired := make(map[string][]int64)
+	var fileIDs []string
+	maxKey := expiryKey("", 0, now.Unix()+1)
+	for done := false; !done; {
+		err := s.db.Update(func(tx *bbolt.Tx) error {
+			idx := tx.Bucket(bucketMessageExpiry)
+			var keys [][]byte
+			c := idx.Cursor()
+			for k, _ := c.First(); k != nil && bytes.Compare(k, maxKey) < 0 && len(keys) < retentionBatch; k, _ = c.Next() {
+				keys = append(keys, bytes.Clone(k))
+			}
+			done = len(keys) < retentionBatch
+
+			for _, k := range keys {
+				if err := dirtyDelete(tx, idx, [][]byte{bucketMessageExpiry}, k); err != nil {
+					return err
+				}
+				chatID, seq, err := parseExpiryKey(k)
+				if err != nil {
+					continue
+				}
+				path := [][]byte{bucketMessages, []byte(chatID)}
+				b := lookupBucket(tx, path)
+				if b == nil {
+					continue
+				}
+				msgKey := (&DBMessage{Seq: seq}).Key()
+				if b.Get(msgKey) == nil {
+					continue // already deleted by retention
+				}
+				ids, err := s.deleteMessage(tx, b, chatID, msgKey)
+				if err != nil {
+					return err
+				}
+				fileIDs = append(fileIDs, ids...)
+				expired[chatID] = append(expired[chatID], seq)
+			}
+			return nil
+		})
+		if err != nil {
+			return expired, fileIDs, err
+		}
+	}
+	return expired, fileIDs, nil
+}
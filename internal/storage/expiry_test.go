@@ -0,0 +1,96 @@
+package storage
+
+import (
+	"bytes"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"besedka/internal/filestore"
+	"besedka/internal/models"
+)
+
+func TestDeleteExpiredMessages(t *testing.T) {
+	tmpDir := t.TempDir()
+	fs, _ := filestore.NewLocalFileStore(filepath.Join(tmpDir, "fs"))
+	store, err := NewBboltStorage(filepath.Join(tmpDir, "test.db"), testSecret, fs)
+	if err != nil {
+		t.Fatalf("failed to create storage: %v", err)
+	}
+	defer func() { _ = store.Close() }()
+
+	if err := store.SetDisappearAfter("dm_u1_u2", 3600); !errors.Is(err, models.ErrNotFound) {
+		t.Errorf("expected ErrNotFound for an unknown chat, got %v", err)
+	}
+	if err := store.UpsertChat(models.Chat{ID: "dm_u1_u2", IsDM: true}); err != nil {
+		t.Fatalf("UpsertChat failed: %v", err)
+	}
+	if err := store.SetDisappearAfter("dm_u1_u2", 3600); err != nil {
+		t.Fatalf("SetDisappearAfter failed: %v", err)
+	}
+	// Saving the chat elsewhere keeps its timer.
+	if err := store.UpsertChat(models.Chat{ID: "dm_u1_u2", IsDM: true, Pins: []int64{3}}); err != nil {
+		t.Fatalf("UpsertChat failed: %v", err)
+	}
+	if chats, _ := store.ListChats(); chats[0].DisappearAfter != 3600 {
+		t.Errorf("expected the chat to keep its timer, got %+v", chats[0])
+	}
+
+	if err := store.SaveFileBlob(bytes.NewReader([]byte("blob")), "h1"); err != nil {
+		t.Fatalf("SaveFileBlob failed: %v", err)
+	}
+	if err := store.UpsertFileMetadata(FileMetadata{ID: "f1", Hash: "h1"}); err != nil {
+		t.Fatalf("UpsertFileMetadata failed: %v", err)
+	}
+	now := time.Now()
+	after := int64(3600)
+	msgs := []models.Message{
+		{Seq: 1, Content: "expired", ExpiresAt: now.Add(-time.Minute).Unix(), DisappearAfter: &after,
+			Attachments: []models.Attachment{{Type: models.AttachmentTypeFile, FileID: "f1"}}},
+		{Seq: 2, Content: "expired too", ExpiresAt: now.Unix()},
+		{Seq: 3, Content: "pending", ExpiresAt: now.Add(time.Hour).Unix()},
+		{Seq: 4, Content: "forever"},
+	}
+	for _, m := range msgs {
+		m.ChatID = "dm_u1_u2"
+		m.UserID = "u1"
+		if err := store.UpsertMessage(m); err != nil {
+			t.Fatalf("UpsertMessage failed: %v", err)
+		}
+	}
+	if stored, _ := store.ListMessages("dm_u1_u2", 1, 1); len(stored) != 1 || stored[0].DisappearAfter == nil || *stored[0].DisappearAfter != 3600 {
+		t.Errorf("expected the announcement timer to be stored, got %+v", stored)
+	}
+
+	expired, fileIDs, err := store.DeleteExpiredMessages(now)
+	if err != nil {
+		t.Fatalf("DeleteExpiredMessages failed: %v", err)
+	}
+	if seqs := expired["dm_u1_u2"]; len(expired) != 1 || len(seqs) != 2 || seqs[0] != 1 || seqs[1] != 2 {
+		t.Errorf("expected seqs 1 and 2 to expire, got %+v", expired)
+	}
+	if len(fileIDs) != 1 || fileIDs[0] != "f1" {
+		t.Errorf("expected f1 to be returned, got %+v", fileIDs)
+	}
+	if left, _ := store.ListMessages("dm_u1_u2", 1, 4); len(left) != 2 || left[0].Seq != 3 || left[0].ExpiresAt == 0 {
+		t.Errorf("expected seqs 3 and 4 to be left, got %+v", left)
+	}
+	if refs, _ := store.SearchMessages([]string{"expired"}, []string{"dm_u1_u2"}); len(refs) != 0 {
+		t.Errorf("expected expired messages to leave the search index, got %+v", refs)
+	}
+	if expired, _, _ := store.DeleteExpiredMessages(now); len(expired) != 0 {
+		t.Errorf("expected nothing left to expire, got %+v", expired)
+	}
+
+	// Retention removes the expiry of the messages it deletes.
+	if _, _, err := store.DeleteMessagesBefore("dm_u1_u2", 4); err != nil {
+		t.Fatalf("DeleteMessagesBefore failed: %v", err)
+	}
+	if expired, _, _ := store.DeleteExpiredMessages(now.Add(2 * time.Hour)); len(expired) != 0 {
+		t.Errorf("expected the expiry of deleted messages to be gone, got %+v", expired)
+	}
+	if report, err := store.VerifyRecords(); err != nil || len(report.Errors) != 0 {
+		t.Errorf("expected all records to verify, got %+v %v", report.Errors, err)
+	}
+}
@@ -0,0 +1,90 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/binary"
+	"slices"
+
+	"go.etcd.io/bbolt"
+)
+
+// fileRefKey orders the file reference index by file ID: the file ID, a zero
+// byte, the chat ID, then the seq of the message (8 bytes BE). File and chat
+// IDs never contain a zero byte.
+func fileRefKey(fileID, chatID string, seq int64) []byte {
+	key := make([]byte, 0, len(fileID)+1+len(chatID)+8)
+	key = append(key, fileID...)
+	key = append(key, 0)
+	key = append(key, chatID...)
+	return binary.BigEndian.AppendUint64(key, uint64(seq))
+}
+
+// indexFiles updates the file reference index of the message seq of chatID,
+// which referred to the files oldIDs and now refers to newIDs.
+func indexFiles(tx *bbolt.Tx, chatID string, seq int64, oldIDs, newIDs []string) error {
+	b := tx.Bucket(bucketMessageFiles)
+	path := [][]byte{bucketMessageFiles}
+	for _, id := range oldIDs {
+		if !slices.Contains(newIDs, id) {
+			if err := dirtyDelete(tx, b, path, fileRefKey(id, chatID, seq)); err != nil {
+				return err
+			}
+		}
+	}
+	for _, id := range newIDs {
+		if !slices.Contains(oldIDs, id) {
+			if err := dirtyPut(tx, b, path, fileRefKey(id, chatID, seq), indexValue); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// fileReferenced reports whether a stored message refers to fileID.
+func fileReferenced(tx *bbolt.Tx, fileID string) bool {
+	prefix := append([]byte(fileID), 0)
+	k, _ := tx.Bucket(bucketMessageFiles).Cursor().Seek(prefix)
+	return k != nil && bytes.HasPrefix(k, prefix)
+}
+
+// rebuildFileIndex indexes the files of all stored messages. It runs once,
+// when the file reference index is created on a database that predates it.
+func (s *BboltStorage) rebuildFileIndex() error {
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		return tx.Bucket(bucketMessages).ForEachBucket(func(chatID []byte) error {
+			chatBucket := tx.Bucket(bucketMessages).Bucket(chatID)
+			return chatBucket.ForEach(func(k, v []byte) error {
+				msg, err := s.decodeMessage(v)
+				if err != nil {
+					return err
+				}
+				return indexFiles(tx, string(chatID), msg.Seq, nil, messageFileIDs(msg))
+			})
+		})
+	})
+}
+
+// HoldFile keeps ReleaseFiles from deleting the file id until the returned
+// func is called, for a file about to be referred to by a new message. It
+// reports false if the file is already gone.
+func (s *BboltStorage) HoldFile(id string) (func(), bool) {
+	s.blobsMu.Lock()
+	defer s.blobsMu.Unlock()
+	if _, err := s.GetFileMetadata(id); err != nil {
+		return nil, false
+	}
+	if s.heldFiles == nil {
+		s.heldFiles = make(map[string]int)
+	}
+	s.heldFiles[id]++
+	return func() {
+		s.blobsMu.Lock()
+		defer s.blobsMu.Unlock()
+		if s.heldFiles[id] > 1 {
+			s.heldFiles[id]--
+		} else {
+			delete(s.heldFiles, id)
+		}
+	}, true
+}
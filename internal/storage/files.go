@@ -38,7 +38,10 @@ func (f *FileMetadata) UnmarshalBinary(data []byte) error {
 	return msgpack.Unmarshal(data, (*alias)(f))
 }
 
+// UpsertFileMetadata stores meta. Once it is stored, the blobs it names are
+// no longer pending: ReleaseFiles goes by the metadata instead.
 func (s *BboltStorage) UpsertFileMetadata(meta FileMetadata) error {
+	defer s.unpendBlobs(meta.Hash, meta.ThumbnailHash)
 	return s.db.Update(func(tx *bbolt.Tx) error {
 		b := tx.Bucket(bucketFiles)
 		data, err := meta.MarshalBinary()
@@ -70,6 +73,15 @@ func (s *BboltStorage) GetFileMetadata(id string) (FileMetadata, error) {
 	return meta, err
 }
 
+// FileUploader returns the ID of the user who uploaded the file id.
+func (s *BboltStorage) FileUploader(id string) (string, error) {
+	meta, err := s.GetFileMetadata(id)
+	if err != nil {
+		return "", err
+	}
+	return meta.UserID, nil
+}
+
 // ListFileMetadata returns all file metadata records.
 func (s *BboltStorage) ListFileMetadata() ([]FileMetadata, error) {
 	var metas []FileMetadata
@@ -92,7 +104,9 @@ func (s *BboltStorage) ListFileMetadata() ([]FileMetadata, error) {
 	return metas, err
 }
 
-// SaveFileBlob saves a file blob, encrypting it at rest.
+// SaveFileBlob saves a file blob, encrypting it at rest. The blob is pending
+// until UpsertFileMetadata stores the metadata naming it, so ReleaseFiles
+// doesn't delete it in between when another file shares it.
 func (s *BboltStorage) SaveFileBlob(r io.Reader, hash string) error {
 	data, err := io.ReadAll(r)
 	if err != nil {
@@ -104,7 +118,31 @@ func (s *BboltStorage) SaveFileBlob(r io.Reader, hash string) error {
 		return fmt.Errorf("failed to encrypt file blob: %w", err)
 	}
 
-	return s.fs.Save(bytes.NewReader(data), hash)
+	s.blobsMu.Lock()
+	if s.pendingBlobs == nil {
+		s.pendingBlobs = make(map[string]int)
+	}
+	s.pendingBlobs[hash]++
+	s.blobsMu.Unlock()
+
+	if err := s.fs.Save(bytes.NewReader(data), hash); err != nil {
+		s.unpendBlobs(hash)
+		return err
+	}
+	return nil
+}
+
+// unpendBlobs counts the blobs as no longer pending.
+func (s *BboltStorage) unpendBlobs(hashes ...string) {
+	s.blobsMu.Lock()
+	defer s.blobsMu.Unlock()
+	for _, hash := range hashes {
+		if s.pendingBlobs[hash] > 1 {
+			s.pendingBlobs[hash]--
+		} else {
+			delete(s.pendingBlobs, hash)
+		}
+	}
 }
 
 type readSeekCloser struct {
@@ -0,0 +1,410 @@
+package storage
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+	"unicode/utf8"
+
+	"go.etcd.io/bbolt"
+)
+
+// Offline inspection and repair, behind the besedka db command. These work on
+// a database opened with OpenOffline while the server is stopped, and read the
+// file as it is rather than through the models the server uses.
+
+// OpenOffline opens the database at path for inspection or repair without
+// creating buckets, checking or switching keys, or rebuilding anything. With
+// readOnly nothing can be written. The database must have been opened by the
+// server before, so it has a salt.
+func OpenOffline(path string, readOnly bool, key []byte, previousKeys ...[]byte) (*BboltStorage, error) {
+	if len(key) == 0 {
+		return nil, errors.New("encryption key is required")
+	}
+	db, err := bbolt.Open(path, 0600, &bbolt.Options{Timeout: 1 * time.Second, ReadOnly: readOnly})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open bbolt db (is the server still running?): %w", err)
+	}
+
+	var salt []byte
+	err = db.View(func(tx *bbolt.Tx) error {
+		settings := tx.Bucket(bucketSettings)
+		if settings == nil || len(settings.Get([]byte("salt"))) == 0 {
+			return errors.New("database has no salt: it was never opened by the server")
+		}
+		if settings.Get([]byte(configKeyRekeySalt)) != nil {
+			return ErrRekeyInProgress
+		}
+		var err error
+		if salt, err = base64.StdEncoding.DecodeString(string(settings.Get([]byte("salt")))); err != nil {
+			return fmt.Errorf("failed to decode salt: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+
+	crypter, err := newKeyring(key, salt, previousKeys)
+	if err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	return &BboltStorage{db: db, crypter: crypter}, nil
+}
+
+// BucketStats describes the contents of a top-level bucket.
+type BucketStats struct {
+	Name string
+	// Records counts the values, including those in nested buckets.
+	Records int
+	// Buckets counts the nested buckets.
+	Buckets int
+	// Bytes is the size of the keys and values, without page overhead.
+	Bytes int
+}
+
+// BucketStats returns the stats of every top-level bucket.
+func (s *BboltStorage) BucketStats() ([]BucketStats, error) {
+	var stats []BucketStats
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		return tx.ForEach(func(name []byte, b *bbolt.Bucket) error {
+			st := BucketStats{Name: string(name)}
+			var walk func(b *bbolt.Bucket) error
+			walk = func(b *bbolt.Bucket) error {
+				return b.ForEach(func(k, v []byte) error {
+					st.Bytes += len(k) + len(v)
+					if v == nil {
+						st.Buckets++
+						return walk(b.Bucket(k))
+					}
+					st.Records++
+					return nil
+				})
+			}
+			if err := walk(b); err != nil {
+				return err
+			}
+			stats = append(stats, st)
+			return nil
+		})
+	})
+	return stats, err
+}
+
+// ChatSeq compares the LastSeq stored on a chat with its messages.
+type ChatSeq struct {
+	ID   string
+	Name string
+	// LastSeq is the sequence number stored on the chat record, the one new
+	// messages are numbered after.
+	LastSeq int
+	// MaxSeq is the highest sequence number among the stored messages.
+	MaxSeq   int
+	Messages int
+	// NoChat is set for messages whose chat record is missing.
+	NoChat bool
+}
+
+// Drifted reports whether LastSeq is behind the stored messages, so new
+// messages would overwrite existing ones.
+func (c ChatSeq) Drifted() bool {
+	return !c.NoChat && c.MaxSeq > c.LastSeq
+}
+
+// ChatSeqs returns the stored and actual last sequence number of every chat.
+func (s *BboltStorage) ChatSeqs() ([]ChatSeq, error) {
+	var seqs []ChatSeq
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		var err error
+		seqs, err = s.chatSeqs(tx)
+		return err
+	})
+	return seqs, err
+}
+
+func (s *BboltStorage) chatSeqs(tx *bbolt.Tx) ([]ChatSeq, error) {
+	var seqs []ChatSeq
+	msgBucket := tx.Bucket(bucketMessages)
+	seen := make(map[string]bool)
+	err := tx.Bucket(bucketChats).ForEach(func(k, v []byte) error {
+		dbChat, err := s.decodeChat(v)
+		if err != nil {
+			return fmt.Errorf("chat %q: %w", k, err)
+		}
+		seq := ChatSeq{ID: string(k), Name: dbChat.Name, LastSeq: dbChat.LastSeq}
+		if msgBucket != nil {
+			seq.MaxSeq, seq.Messages = messageSeqs(msgBucket.Bucket(k))
+		}
+		seen[seq.ID] = true
+		seqs = append(seqs, seq)
+		return nil
+	})
+	if err != nil || msgBucket == nil {
+		return seqs, err
+	}
+	err = msgBucket.ForEachBucket(func(k []byte) error {
+		if !seen[string(k)] {
+			seq := ChatSeq{ID: string(k), NoChat: true}
+			seq.MaxSeq, seq.Messages = messageSeqs(msgBucket.Bucket(k))
+			seqs = append(seqs, seq)
+		}
+		return nil
+	})
+	return seqs, err
+}
+
+// messageSeqs returns the highest sequence number and the number of messages
+// in a chat's message bucket.
+func messageSeqs(b *bbolt.Bucket) (maxSeq, count int) {
+	if b == nil {
+		return 0, 0
+	}
+	if k, _ := b.Cursor().Last(); len(k) == 8 {
+		maxSeq = int(binary.BigEndian.Uint64(k))
+	}
+	return maxSeq, b.Stats().KeyN
+}
+
+// FixLastSeq moves the LastSeq of every drifted chat up to its highest
+// stored message and returns the chats it fixed, as they were before.
+func (s *BboltStorage) FixLastSeq() ([]ChatSeq, error) {
+	var fixed []ChatSeq
+	err := s.db.Update(func(tx *bbolt.Tx) error {
+		seqs, err := s.chatSeqs(tx)
+		if err != nil {
+			return err
+		}
+		for _, seq := range seqs {
+			if !seq.Drifted() {
+				continue
+			}
+			dbChat, err := s.getChat(tx, seq.ID)
+			if err != nil {
+				return fmt.Errorf("chat %q: %w", seq.ID, err)
+			}
+			dbChat.LastSeq = seq.MaxSeq
+			if err := s.putChat(tx, dbChat); err != nil {
+				return err
+			}
+			fixed = append(fixed, seq)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return fixed, nil
+}
+
+// RecordError is a record that failed verification.
+type RecordError struct {
+	// Path is the bucket path, like "messages/townhall".
+	Path string
+	// Key is the record key, hex-encoded unless it is printable text.
+	Key string
+	Err string
+}
+
+// VerifyReport summarizes a VerifyRecords run.
+type VerifyReport struct {
+	Records int
+	Errors  []RecordError
+	// Unknown names the top-level buckets VerifyRecords doesn't know the
+	// format of, so their records were not checked.
+	Unknown []string
+}
+
+// recordFormat describes how the values of a bucket are stored.
+type recordFormat struct {
+	encrypted bool
+	// nested is set for buckets that hold one bucket per chat or user.
+	nested bool
+	value  func() encoding.BinaryUnmarshaler
+}
+
+// recordFormats lists the top-level buckets with msgpack records.
+var recordFormats = map[string]recordFormat{
+	string(bucketUsers):              {encrypted: true, value: func() encoding.BinaryUnmarshaler { return &DBUser{} }},
+	string(bucketUserSettings):       {encrypted: true, value: func() encoding.BinaryUnmarshaler { return &DBUserSettings{} }},
+	string(bucketChats):              {encrypted: true, value: func() encoding.BinaryUnmarshaler { return &DBChat{} }},
+	string(bucketMessages):           {encrypted: true, nested: true, value: func() encoding.BinaryUnmarshaler { return &DBMessage{} }},
+	string(bucketTokensV2):           {encrypted: true, value: func() encoding.BinaryUnmarshaler { return &DBToken{} }},
+	string(bucketRegistrationTokens): {encrypted: true, value: func() encoding.BinaryUnmarshaler { return &DBToken{} }},
+	string(bucketFiles):              {encrypted: true, value: func() encoding.BinaryUnmarshaler { return &FileMetadata{} }},
+	string(bucketVAPIDKeys):          {encrypted: true, value: func() encoding.BinaryUnmarshaler { return &DBVAPIDKeys{} }},
+	string(bucketPushSubscriptions):  {encrypted: true, nested: true, value: func() encoding.BinaryUnmarshaler { return &DBPushSubscription{} }},
+	string(bucketLastSeen):           {value: func() encoding.BinaryUnmarshaler { return &DBLastSeen{} }},
+	string(bucketPasskeyCredentials): {encrypted: true, nested: true, value: func() encoding.BinaryUnmarshaler { return &DBPasskeyCredential{} }},
+	string(bucketAPIKeys):            {encrypted: true, value: func() encoding.BinaryUnmarshaler { return &DBAPIKey{} }},
+	string(bucketLinkPreviews):       {encrypted: true, value: func() encoding.BinaryUnmarshaler { return &DBLinkPreview{} }},
+	string(bucketBotDeliveries):      {encrypted: true, value: func() encoding.BinaryUnmarshaler { return &Delivery{} }},
+	string(bucketBotDeliveryStatus):  {encrypted: true, value: func() encoding.BinaryUnmarshaler { return &DeliveryStatus{} }},
+	string(bucketSlashCommands):      {encrypted: true, value: func() encoding.BinaryUnmarshaler { return &DBSlashCommand{} }},
+	string(bucketAdmins):             {encrypted: true, value: func() encoding.BinaryUnmarshaler { return &DBAdmin{} }},
+	string(bucketAdminTokens):        {encrypted: true, value: func() encoding.BinaryUnmarshaler { return &DBAdminToken{} }},
+	string(bucketAdminAudit):         {encrypted: true, value: func() encoding.BinaryUnmarshaler { return &DBAdminAuditEntry{} }},
+	string(bucketSearchIndex):        {encrypted: true, value: func() encoding.BinaryUnmarshaler { return &DBPosting{} }},
+}
+
+// unverifiedBuckets lists the top-level buckets without msgpack records: the
+// settings bucket holds plain strings, the message expiry, reply and file
+// indexes hold no values, and the old search index is dropped when the server
+// opens the database. backup_dirty markers are checked on their own.
+var unverifiedBuckets = [][]byte{bucketSettings, bucketMessageExpiry, bucketMessageReplies, bucketMessageFiles, bucketSearchIndexV1, bucketBackupDirty}
+
+// VerifyRecords decrypts and unmarshals every record and checks that every
+// backup_dirty marker decodes. Records in unexpected places, like a nested
+// bucket where a record belongs, are reported as errors too, and top-level
+// buckets of unknown format are listed in the report.
+func (s *BboltStorage) VerifyRecords() (VerifyReport, error) {
+	var report VerifyReport
+	fail := func(path [][]byte, key []byte, err error) {
+		report.Errors = append(report.Errors, RecordError{Path: displayPath(path), Key: displayKey(key), Err: err.Error()})
+	}
+	var verify func(b *bbolt.Bucket, path [][]byte, format recordFormat, depth int) error
+	verify = func(b *bbolt.Bucket, path [][]byte, format recordFormat, depth int) error {
+		wantBuckets := format.nested && depth == 0
+		return b.ForEach(func(k, v []byte) error {
+			if v == nil {
+				if !wantBuckets {
+					fail(path, k, errors.New("unexpected nested bucket"))
+					return nil
+				}
+				return verify(b.Bucket(k), appendSeg(path, k), format, depth+1)
+			}
+			report.Records++
+			if wantBuckets {
+				fail(path, k, errors.New("unexpected record"))
+				return nil
+			}
+			if format.encrypted {
+				var err error
+				if v, err = s.crypter.Decrypt(v); err != nil {
+					fail(path, k, fmt.Errorf("failed to decrypt: %w", err))
+					return nil
+				}
+			}
+			if err := format.value().UnmarshalBinary(v); err != nil {
+				fail(path, k, fmt.Errorf("failed to unmarshal: %w", err))
+			}
+			return nil
+		})
+	}
+
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		err := tx.ForEach(func(name []byte, _ *bbolt.Bucket) error {
+			if _, ok := recordFormats[string(name)]; !ok && !slices.ContainsFunc(unverifiedBuckets, func(b []byte) bool { return bytes.Equal(b, name) }) {
+				report.Unknown = append(report.Unknown, displayKey(name))
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		names := make([]string, 0, len(recordFormats))
+		for name := range recordFormats {
+			names = append(names, name)
+		}
+		slices.Sort(names)
+		for _, name := range names {
+			b := tx.Bucket([]byte(name))
+			if b == nil {
+				continue
+			}
+			if err := verify(b, [][]byte{[]byte(name)}, recordFormats[name], 0); err != nil {
+				return err
+			}
+		}
+
+		if d := tx.Bucket(bucketBackupDirty); d != nil {
+			return d.ForEach(func(k, v []byte) error {
+				report.Records++
+				if _, _, err := decodeMarkerKey(k); err != nil {
+					fail([][]byte{bucketBackupDirty}, k, err)
+				} else if len(v) != 8 {
+					fail([][]byte{bucketBackupDirty}, k, errors.New("marker value is not a transaction id"))
+				}
+				return nil
+			})
+		}
+		return nil
+	})
+	return report, err
+}
+
+// PurgeDirtyMarkers deletes the backup_dirty markers no incremental backup
+// needs: those that don't decode, those already covered by the last committed
+// backup, and all of them when no backup was ever committed, since the next
+// backup is then a full one. It returns the number of markers deleted.
+func (s *BboltStorage) PurgeDirtyMarkers() (int, error) {
+	count := 0
+	err := s.db.Update(func(tx *bbolt.Tx) error {
+		var state backupState
+		if raw := tx.Bucket(bucketSettings).Get([]byte(configKeyBackupState)); raw != nil {
+			if err := json.Unmarshal(raw, &state); err != nil {
+				return fmt.Errorf("corrupt backup_state: %w", err)
+			}
+		}
+		d := tx.Bucket(bucketBackupDirty)
+		if d == nil {
+			return nil
+		}
+		// Deleting while the cursor iterates would skip keys, so collect
+		// them first.
+		var stale [][]byte
+		c := d.Cursor()
+		for k, v := c.First(); k != nil; k, v = c.Next() {
+			_, _, err := decodeMarkerKey(k)
+			if err == nil && len(v) == 8 && state.LastKey != "" && binary.BigEndian.Uint64(v) > state.TxID {
+				continue
+			}
+			stale = append(stale, bytes.Clone(k))
+		}
+		for _, k := range stale {
+			if err := d.Delete(k); err != nil {
+				return err
+			}
+		}
+		count = len(stale)
+		return nil
+	})
+	return count, err
+}
+
+func displayPath(path [][]byte) string {
+	out := ""
+	for i, seg := range path {
+		if i > 0 {
+			out += "/"
+		}
+		out += displayKey(seg)
+	}
+	return out
+}
+
+// displayKey renders a key as text when it is printable, otherwise as hex.
+func displayKey(k []byte) string {
+	if utf8.Valid(k) {
+		printable := true
+		for _, r := range string(k) {
+			if r < 0x20 || r == 0x7f {
+				printable = false
+				break
+			}
+		}
+		if printable {
+			return string(k)
+		}
+	}
+	return hex.EncodeToString(k)
+}
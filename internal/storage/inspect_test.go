@@ -0,0 +1,115 @@
+package storage
+
+import (
+	"path/filepath"
+	"testing"
+
+	"besedka/internal/auth"
+	"besedka/internal/filestore"
+	"besedka/internal/models"
+
+	"go.etcd.io/bbolt"
+)
+
+func TestOfflineInspection(t *testing.T) {
+	tmpDir := t.TempDir()
+	fs, _ := filestore.NewLocalFileStore(filepath.Join(tmpDir, "fs"))
+	dbPath := filepath.Join(tmpDir, "test.db")
+	store, err := NewBboltStorage(dbPath, testSecret, fs)
+	if err != nil {
+		t.Fatalf("failed to create storage: %v", err)
+	}
+	if err := store.UpsertCredentials(auth.UserCredentials{User: models.User{ID: "u1", UserName: "alice"}}); err != nil {
+		t.Fatalf("UpsertCredentials failed: %v", err)
+	}
+	if err := store.UpsertChat(models.Chat{ID: "townhall", Name: "Town Hall"}); err != nil {
+		t.Fatalf("UpsertChat failed: %v", err)
+	}
+	for seq := int64(1); seq <= 3; seq++ {
+		if err := store.UpsertMessage(models.Message{ChatID: "townhall", Seq: seq, UserID: "u1", Content: "hello"}); err != nil {
+			t.Fatalf("UpsertMessage failed: %v", err)
+		}
+	}
+	// Let LastSeq drift behind the messages and corrupt a user record.
+	err = store.db.Update(func(tx *bbolt.Tx) error {
+		if err := store.putChat(tx, &DBChat{ID: "townhall", Name: "Town Hall", LastSeq: 1}); err != nil {
+			return err
+		}
+		if _, err := tx.CreateBucket([]byte("mystery")); err != nil {
+			return err
+		}
+		return tx.Bucket(bucketUsers).Put([]byte("u2"), []byte("garbage"))
+	})
+	if err != nil {
+		t.Fatalf("failed to tamper with the db: %v", err)
+	}
+	_ = store.Close()
+
+	if _, err := OpenOffline(filepath.Join(tmpDir, "missing.db"), true, testSecret); err == nil {
+		t.Error("expected a missing database to fail to open")
+	}
+
+	store, err = OpenOffline(dbPath, true, testSecret)
+	if err != nil {
+		t.Fatalf("OpenOffline failed: %v", err)
+	}
+	stats, err := store.BucketStats()
+	if err != nil {
+		t.Fatalf("BucketStats failed: %v", err)
+	}
+	for _, st := range stats {
+		if st.Name == "messages" && (st.Records != 3 || st.Buckets != 1) {
+			t.Errorf("expected 3 messages in 1 bucket, got %+v", st)
+		}
+	}
+	seqs, err := store.ChatSeqs()
+	if err != nil || len(seqs) != 1 || seqs[0].LastSeq != 1 || seqs[0].MaxSeq != 3 || !seqs[0].Drifted() {
+		t.Errorf("expected townhall to have drifted, got %+v %v", seqs, err)
+	}
+	report, err := store.VerifyRecords()
+	if err != nil {
+		t.Fatalf("VerifyRecords failed: %v", err)
+	}
+	if len(report.Errors) != 1 || report.Errors[0].Path != "users" || report.Errors[0].Key != "u2" {
+		t.Errorf("expected the corrupt user to be reported, got %+v", report.Errors)
+	}
+	if len(report.Unknown) != 1 || report.Unknown[0] != "mystery" {
+		t.Errorf("expected the unknown bucket to be reported, got %v", report.Unknown)
+	}
+	if _, err := store.FixLastSeq(); err == nil {
+		t.Error("expected a read-only database to refuse writes")
+	}
+	_ = store.Close()
+
+	store, err = OpenOffline(dbPath, false, testSecret)
+	if err != nil {
+		t.Fatalf("OpenOffline failed: %v", err)
+	}
+	defer func() { _ = store.Close() }()
+	fixed, err := store.FixLastSeq()
+	if err != nil || len(fixed) != 1 {
+		t.Fatalf("expected townhall to be fixed, got %+v %v", fixed, err)
+	}
+	if seqs, _ := store.ChatSeqs(); seqs[0].LastSeq != 3 {
+		t.Errorf("expected LastSeq 3, got %+v", seqs)
+	}
+
+	// No backup was ever committed, so the next one is full and every
+	// marker is orphaned.
+	n, err := store.PurgeDirtyMarkers()
+	if err != nil || n == 0 {
+		t.Fatalf("expected markers to be purged, got %d %v", n, err)
+	}
+	if n, err := store.PurgeDirtyMarkers(); err != nil || n != 0 {
+		t.Errorf("expected every marker to be purged at once, got %d more %v", n, err)
+	}
+	if err := store.CommitBackup("backups/full", 0); err != nil {
+		t.Fatalf("CommitBackup failed: %v", err)
+	}
+	if err := store.UpsertChat(models.Chat{ID: "townhall", Name: "Renamed"}); err != nil {
+		t.Fatalf("UpsertChat failed: %v", err)
+	}
+	if n, err := store.PurgeDirtyMarkers(); err != nil || n != 0 {
+		t.Errorf("expected a marker newer than the last backup to be kept, got %d %v", n, err)
+	}
+}
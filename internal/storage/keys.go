@@ -0,0 +1,309 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"slices"
+	"time"
+
+	"go.etcd.io/bbolt"
+)
+
+// Key rollover: when AUTH_SECRET changes and the old secret is kept as a
+// previous key, records written with the old key stay readable while
+// MigrateKeys rewrites them with the new one in the background. KeyStatus
+// reports how far that got.
+
+// configKeyKeyID is the settings key holding the ID of the key the database
+// is written with.
+const configKeyKeyID = "key_id"
+
+// configKeyMigratedKeyID is the settings key holding the ID of the key
+// MigrateKeys last moved every record and file to.
+const configKeyMigratedKeyID = "key_migrated"
+
+const (
+	// keyMigrationBatch is the number of records rewritten per transaction.
+	keyMigrationBatch = 500
+	// keyMigrationPause is the pause between batches, so the migration
+	// doesn't hold up regular writes.
+	keyMigrationPause = 50 * time.Millisecond
+)
+
+var ErrUnknownKey = errors.New("AUTH_SECRET does not decrypt the database; if it was changed, set AUTH_SECRET_PREVIOUS to the old secret")
+
+// keyMigrationBuckets lists the top-level buckets with encrypted values.
+var keyMigrationBuckets = append(slices.Clone(rekeyBuckets), bucketTokensV2, bucketAdminTokens, bucketSearchIndex)
+
+// KeyCounts counts encrypted values by the key they were written with.
+type KeyCounts struct {
+	Current int `json:"current"`
+	// Old values name one of the previous keys.
+	Old int `json:"old"`
+	// Unversioned values were written before values named their key.
+	Unversioned int `json:"unversioned"`
+}
+
+func (c *KeyCounts) add(age keyAge) {
+	switch age {
+	case keyCurrent:
+		c.Current++
+	case keyOld:
+		c.Old++
+	default:
+		c.Unversioned++
+	}
+}
+
+// KeyStatus reports the progress of a key rollover.
+type KeyStatus struct {
+	CurrentKey string    `json:"currentKey"`
+	OldKeys    []string  `json:"oldKeys"`
+	Migrating  bool      `json:"migrating"`
+	Records    KeyCounts `json:"records"`
+	Files      KeyCounts `json:"files"`
+}
+
+// switchKey records the ID of the current key. It reports whether the key
+// changed since the database was last opened; the backup chain is then reset
+// so the next backup is a full one under the new key. It fails if the
+// database was last written with a key that is not in the keyring.
+func (s *BboltStorage) switchKey() (bool, error) {
+	lastID, err := s.GetConfig(configKeyKeyID)
+	if err != nil {
+		return false, fmt.Errorf("failed to get key ID: %w", err)
+	}
+	currentID := s.crypter.CurrentKeyID()
+	if lastID == currentID {
+		return false, nil
+	}
+	if lastID != "" && !slices.Contains(s.crypter.OldKeyIDs(), lastID) {
+		return false, ErrUnknownKey
+	}
+	if lastID == "" {
+		// Written before key IDs were recorded: check the key on a record.
+		if err := s.checkKey(); err != nil {
+			return false, err
+		}
+	}
+
+	changed := lastID != "" || len(s.crypter.old) > 0
+	err = s.db.Update(func(tx *bbolt.Tx) error {
+		settings := tx.Bucket(bucketSettings)
+		if changed {
+			if err := settings.Delete([]byte(configKeyBackupState)); err != nil {
+				return err
+			}
+		}
+		return settings.Put([]byte(configKeyKeyID), []byte(currentID))
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to persist key ID: %w", err)
+	}
+	if changed {
+		slog.Info("encryption key changed", "key_id", currentID, "previous_keys", s.crypter.OldKeyIDs())
+	}
+	return changed, nil
+}
+
+// checkKey decrypts the first encrypted record found with the keyring.
+func (s *BboltStorage) checkKey() error {
+	return s.db.View(func(tx *bbolt.Tx) error {
+		for _, name := range keyMigrationBuckets {
+			b := tx.Bucket(name)
+			if b == nil {
+				continue
+			}
+			v := firstValue(b)
+			if v == nil {
+				continue
+			}
+			if _, err := s.crypter.Decrypt(v); err != nil {
+				return ErrUnknownKey
+			}
+			return nil
+		}
+		return nil
+	})
+}
+
+// HasOldKeys reports whether records may still be on a previous key, so
+// MigrateKeys has work to do: the storage was opened with previous keys and
+// no migration to the current key has finished yet.
+func (s *BboltStorage) HasOldKeys() bool {
+	if len(s.crypter.old) == 0 {
+		return false
+	}
+	migrated, err := s.GetConfig(configKeyMigratedKeyID)
+	return err != nil || migrated != s.crypter.CurrentKeyID()
+}
+
+// MigrateKeys rewrites every record and file blob that is not encrypted with
+// the current key, in small batches. It returns when everything is migrated
+// or ctx is done. Records are rewritten through the dirty journal, so
+// incremental backups pick them up.
+func (s *BboltStorage) MigrateKeys(ctx context.Context) error {
+	s.migrating.Store(true)
+	defer s.migrating.Store(false)
+
+	total := 0
+	for _, name := range keyMigrationBuckets {
+		n, err := s.migrateBucket(ctx, [][]byte{name})
+		total += n
+		if err != nil {
+			return err
+		}
+	}
+	files, err := s.migrateBlobs(ctx)
+	if err != nil {
+		return err
+	}
+	if err := s.SetConfig(configKeyMigratedKeyID, s.crypter.CurrentKeyID()); err != nil {
+		return fmt.Errorf("failed to record key migration: %w", err)
+	}
+	slog.Info("key migration finished", "records", total, "files", files)
+	return nil
+}
+
+// migrateBucket rewrites the values of the bucket at path and its nested
+// buckets that are not on the current key.
+func (s *BboltStorage) migrateBucket(ctx context.Context, path [][]byte) (int, error) {
+	return rewriteBucket(s.db, path, keyMigrationBatch, s.migrateValue, func() error {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(keyMigrationPause):
+			return nil
+		}
+	})
+}
+
+// migrateValue re-encrypts data with the current key, unless it already is.
+func (s *BboltStorage) migrateValue(data []byte) ([]byte, bool, error) {
+	if s.crypter.age(data) == keyCurrent {
+		return data, false, nil
+	}
+	plain, err := s.crypter.Decrypt(data)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to decrypt: %w", err)
+	}
+	data, err = s.crypter.Encrypt(plain)
+	if err != nil {
+		return nil, false, err
+	}
+	return data, true, nil
+}
+
+// migrateBlobs re-encrypts the file blobs that are not on the current key.
+func (s *BboltStorage) migrateBlobs(ctx context.Context) (int, error) {
+	count := 0
+	for _, hash := range s.blobHashes() {
+		if err := ctx.Err(); err != nil {
+			return count, err
+		}
+		age, err := s.blobKeyAge(hash)
+		if err != nil {
+			slog.Warn("key migration: file blob unreadable, skipping", "hash", hash, "error", err)
+			continue
+		}
+		if age == keyCurrent {
+			continue
+		}
+		rc, err := s.GetFileBlob(hash)
+		if err != nil {
+			return count, fmt.Errorf("blob %s: %w", hash, err)
+		}
+		plain, err := io.ReadAll(rc)
+		_ = rc.Close()
+		if err != nil {
+			return count, fmt.Errorf("blob %s: %w", hash, err)
+		}
+		data, err := s.crypter.Encrypt(plain)
+		if err != nil {
+			return count, err
+		}
+		if err := s.fs.Replace(bytes.NewReader(data), hash); err != nil {
+			return count, fmt.Errorf("blob %s: %w", hash, err)
+		}
+		count++
+	}
+	return count, nil
+}
+
+// blobHashes returns the hashes of all blobs referenced by file metadata.
+func (s *BboltStorage) blobHashes() []string {
+	files, err := s.ListFileMetadata()
+	if err != nil {
+		slog.Error("failed to list files", "error", err)
+		return nil
+	}
+	var hashes []string
+	seen := make(map[string]bool)
+	for _, meta := range files {
+		for _, hash := range []string{meta.Hash, meta.ThumbnailHash} {
+			if hash != "" && !seen[hash] {
+				seen[hash] = true
+				hashes = append(hashes, hash)
+			}
+		}
+	}
+	return hashes
+}
+
+// blobKeyAge reads the envelope header of a blob.
+func (s *BboltStorage) blobKeyAge(hash string) (keyAge, error) {
+	rc, err := s.fs.Get(hash)
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = rc.Close() }()
+	header := make([]byte, envelopeLen)
+	if _, err := io.ReadFull(rc, header); err != nil {
+		return 0, err
+	}
+	return s.crypter.age(header), nil
+}
+
+// KeyStatus counts the records and file blobs on the current key, on
+// previous keys and in the unversioned format.
+func (s *BboltStorage) KeyStatus() (KeyStatus, error) {
+	status := KeyStatus{
+		CurrentKey: s.crypter.CurrentKeyID(),
+		OldKeys:    s.crypter.OldKeyIDs(),
+		Migrating:  s.migrating.Load(),
+	}
+	var count func(b *bbolt.Bucket) error
+	count = func(b *bbolt.Bucket) error {
+		return b.ForEach(func(k, v []byte) error {
+			if v == nil {
+				return count(b.Bucket(k))
+			}
+			status.Records.add(s.crypter.age(v))
+			return nil
+		})
+	}
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		for _, name := range keyMigrationBuckets {
+			if b := tx.Bucket(name); b != nil {
+				if err := count(b); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return KeyStatus{}, err
+	}
+
+	for _, hash := range s.blobHashes() {
+		if age, err := s.blobKeyAge(hash); err == nil {
+			status.Files.add(age)
+		}
+	}
+	return status, nil
+}
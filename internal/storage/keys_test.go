@@ -0,0 +1,115 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"path/filepath"
+	"testing"
+
+	"besedka/internal/auth"
+	"besedka/internal/filestore"
+	"besedka/internal/models"
+)
+
+func TestKeyRollover(t *testing.T) {
+	tmpDir := t.TempDir()
+	fs, _ := filestore.NewLocalFileStore(filepath.Join(tmpDir, "fs"))
+	dbPath := filepath.Join(tmpDir, "test.db")
+	store, err := NewBboltStorage(dbPath, testSecret, fs)
+	if err != nil {
+		t.Fatalf("failed to create storage: %v", err)
+	}
+	if err := store.UpsertCredentials(auth.UserCredentials{User: models.User{ID: "u1", UserName: "alice"}}); err != nil {
+		t.Fatalf("UpsertCredentials failed: %v", err)
+	}
+	if err := store.UpsertChat(models.Chat{ID: "townhall"}); err != nil {
+		t.Fatalf("UpsertChat failed: %v", err)
+	}
+	if err := store.UpsertMessage(models.Message{ChatID: "townhall", Seq: 1, UserID: "u1", Content: "before rollover"}); err != nil {
+		t.Fatalf("UpsertMessage failed: %v", err)
+	}
+	if err := store.SaveFileBlob(bytes.NewReader([]byte("file content")), "blobhash"); err != nil {
+		t.Fatalf("SaveFileBlob failed: %v", err)
+	}
+	if err := store.UpsertFileMetadata(FileMetadata{ID: "f1", Hash: "blobhash"}); err != nil {
+		t.Fatalf("UpsertFileMetadata failed: %v", err)
+	}
+	if err := store.CommitBackup("backups/full", 1); err != nil {
+		t.Fatalf("CommitBackup failed: %v", err)
+	}
+	_ = store.Close()
+
+	newSecret := []byte("new-secret")
+	if _, err := NewBboltStorage(dbPath, newSecret, fs); !errors.Is(err, ErrUnknownKey) {
+		t.Fatalf("expected ErrUnknownKey without the previous key, got %v", err)
+	}
+
+	store, err = NewBboltStorage(dbPath, newSecret, fs, testSecret)
+	if err != nil {
+		t.Fatalf("failed to open storage with a previous key: %v", err)
+	}
+	if lastKey, _, _ := store.BackupState(); lastKey != "" {
+		t.Errorf("expected a key change to reset the backup chain, got %q", lastKey)
+	}
+	if refs, err := store.SearchMessages([]string{"rollover"}, []string{"townhall"}); err != nil || len(refs) != 1 {
+		t.Errorf("expected the search index to be rebuilt under the new key, got %+v %v", refs, err)
+	}
+	if err := store.UpsertMessage(models.Message{ChatID: "townhall", Seq: 2, UserID: "u1", Content: "after rollover"}); err != nil {
+		t.Fatalf("UpsertMessage failed: %v", err)
+	}
+	msgs, err := store.ListMessages("townhall", 1, 2)
+	if err != nil || len(msgs) != 2 {
+		t.Fatalf("expected both messages to be readable, got %+v %v", msgs, err)
+	}
+
+	status, err := store.KeyStatus()
+	if err != nil {
+		t.Fatalf("KeyStatus failed: %v", err)
+	}
+	if status.Records.Old == 0 || status.Records.Current == 0 || status.Files.Old != 1 {
+		t.Errorf("expected records and files on both keys, got %+v", status)
+	}
+
+	if !store.HasOldKeys() {
+		t.Error("expected records on the previous key before migrating")
+	}
+	if err := store.MigrateKeys(context.Background()); err != nil {
+		t.Fatalf("MigrateKeys failed: %v", err)
+	}
+	status, _ = store.KeyStatus()
+	if status.Records.Old != 0 || status.Records.Unversioned != 0 || status.Files.Old != 0 || status.Files.Current != 1 {
+		t.Errorf("expected everything on the current key, got %+v", status)
+	}
+	_ = store.Close()
+
+	// A finished migration is not repeated while the previous key is kept.
+	store, err = NewBboltStorage(dbPath, newSecret, fs, testSecret)
+	if err != nil {
+		t.Fatalf("failed to reopen storage: %v", err)
+	}
+	if store.HasOldKeys() {
+		t.Error("expected no key migration after it finished")
+	}
+	_ = store.Close()
+
+	// Once migrated, the previous key is no longer needed.
+	store, err = NewBboltStorage(dbPath, newSecret, fs)
+	if err != nil {
+		t.Fatalf("failed to open storage with the new key only: %v", err)
+	}
+	defer func() { _ = store.Close() }()
+	if creds, err := store.ListAllCredentials(); err != nil || len(creds) != 1 {
+		t.Errorf("expected alice, got %+v %v", creds, err)
+	}
+	rc, err := store.GetFileBlob("blobhash")
+	if err != nil {
+		t.Fatalf("GetFileBlob failed: %v", err)
+	}
+	data, _ := io.ReadAll(rc)
+	_ = rc.Close()
+	if string(data) != "file content" {
+		t.Errorf("expected the migrated blob, got %q", data)
+	}
+}
@@ -0,0 +1,105 @@
+package storage
+
+import (
+	"bytes"
+	"fmt"
+
+	"besedka/internal/models"
+
+	"go.etcd.io/bbolt"
+)
+
+// Link previews are cached by URL. Keys are blind indexes so cached URLs are
+// not readable at rest.
+
+// GetLinkPreview returns the cached preview for url and the Unix time it was
+// fetched. A cached preview with an empty Title and ImageID records a failed
+// fetch. It returns models.ErrNotFound if url is not cached.
+func (s *BboltStorage) GetLinkPreview(url string) (models.LinkPreview, int64, error) {
+	var p DBLinkPreview
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		data := tx.Bucket(bucketLinkPreviews).Get(s.crypter.BlindIndex([]byte(url)))
+		if data == nil {
+			return models.ErrNotFound
+		}
+		data, err := s.crypter.Decrypt(data)
+		if err != nil {
+			return fmt.Errorf("failed to decrypt link preview: %w", err)
+		}
+		return p.UnmarshalBinary(data)
+	})
+	if err != nil {
+		return models.LinkPreview{}, 0, err
+	}
+	return p.toModel(), p.FetchedAt, nil
+}
+
+// PutLinkPreview caches a preview fetched at fetchedAt (Unix seconds).
+func (s *BboltStorage) PutLinkPreview(p models.LinkPreview, fetchedAt int64) error {
+	dbPreview := DBLinkPreview{
+		URL:         p.URL,
+		Title:       p.Title,
+		Description: p.Description,
+		SiteName:    p.SiteName,
+		ImageID:     p.ImageID,
+		FetchedAt:   fetchedAt,
+	}
+	data, err := dbPreview.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	data, err = s.crypter.Encrypt(data)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt link preview: %w", err)
+	}
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		b := tx.Bucket(bucketLinkPreviews)
+		return dirtyPut(tx, b, [][]byte{bucketLinkPreviews}, s.crypter.BlindIndex([]byte(p.URL)), data)
+	})
+}
+
+func (p DBLinkPreview) toModel() models.LinkPreview {
+	return models.LinkPreview{
+		URL:         p.URL,
+		Title:       p.Title,
+		Description: p.Description,
+		SiteName:    p.SiteName,
+		ImageID:     p.ImageID,
+	}
+}
+
+// rekeyLinkPreviews moves cached previews to the blind index of their URL
+// under the current key, after the key changed.
+func (s *BboltStorage) rekeyLinkPreviews() error {
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		b := tx.Bucket(bucketLinkPreviews)
+		type move struct{ from, to, v []byte }
+		var moves []move
+		err := b.ForEach(func(k, v []byte) error {
+			data, err := s.crypter.Decrypt(v)
+			if err != nil {
+				return fmt.Errorf("failed to decrypt link preview: %w", err)
+			}
+			var p DBLinkPreview
+			if err := p.UnmarshalBinary(data); err != nil {
+				return err
+			}
+			if key := s.crypter.BlindIndex([]byte(p.URL)); !bytes.Equal(key, k) {
+				moves = append(moves, move{bytes.Clone(k), key, bytes.Clone(v)})
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, m := range moves {
+			if err := dirtyDelete(tx, b, [][]byte{bucketLinkPreviews}, m.from); err != nil {
+				return err
+			}
+			if err := dirtyPut(tx, b, [][]byte{bucketLinkPreviews}, m.to, m.v); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
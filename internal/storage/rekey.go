@@ -0,0 +1,420 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"time"
+
+	"besedka/internal/filestore"
+
+	"go.etcd.io/bbolt"
+)
+
+// Re-keying re-encrypts the database and file blobs from one AUTH_SECRET to
+// another. It runs offline, with exclusive access to the database file, and
+// in many small transactions so a large database does not need one huge
+// write. The new salt is persisted under configKeyRekeySalt before anything
+// is rewritten; while it is present NewBboltStorage refuses to open the
+// database. Every value is first tried with the new key, so running Rekey
+// again after an interruption skips what was already re-encrypted.
+
+// configKeyRekeySalt is the settings key holding the salt of the new key
+// while a re-key is in progress.
+const configKeyRekeySalt = "rekey_salt"
+
+// rekeyBatchSize is the number of records re-encrypted per transaction.
+const rekeyBatchSize = 1000
+
+var ErrRekeyInProgress = errors.New("a re-key of the database is in progress: run besedka --rekey again to finish it")
+
+// rekeyBuckets lists the top-level buckets with encrypted values. Nested
+// buckets (messages per chat, push subscriptions and passkeys per user) are
+// re-encrypted recursively. Sessions, admin sign-ins and the search index are
+// not listed: they are dropped or rebuilt instead.
+var rekeyBuckets = [][]byte{
+	bucketUsers,
+	bucketUserSettings,
+	bucketMessages,
+	bucketRegistrationTokens,
+	bucketFiles,
+	bucketVAPIDKeys,
+	bucketPushSubscriptions,
+	bucketPasskeyCredentials,
+	bucketAPIKeys,
+	bucketLinkPreviews,
+	bucketBotDeliveries,
+	bucketBotDeliveryStatus,
+	bucketChats,
+	bucketSlashCommands,
+	bucketAdmins,
+	bucketAdminAudit,
+}
+
+// RekeyStats summarizes a finished re-key.
+type RekeyStats struct {
+	Records      int
+	Blobs        int
+	MissingBlobs int
+	Sessions     int
+}
+
+type rekeyer struct {
+	db         *bbolt.DB
+	oldKeys    *Keyring
+	newCrypter *Crypter
+	fs         filestore.FileStore
+	stats      RekeyStats
+}
+
+// Rekey re-encrypts the database at path and the file blobs in fs from
+// oldSecrets to newSecret under a fresh salt. The first old secret is the one
+// in use; the others are previous secrets of a key rollover still in progress. uploadBlob, if not nil, is called
+// for every re-encrypted blob so copies kept elsewhere can be replaced.
+//
+// Values are rewritten through the dirty journal, which finish clears along
+// with the backup state. User sessions and admin sign-ins are dropped, since their keys are hashes
+// of the old secret. The backup state is reset, so the next backup is a full
+// one. Rekey can be run again with the same secrets to resume after an
+// interruption.
+func Rekey(path string, oldSecrets [][]byte, newSecret []byte, fs filestore.FileStore, uploadBlob func(hash string) error) (RekeyStats, error) {
+	if len(oldSecrets) == 0 || len(oldSecrets[0]) == 0 || len(newSecret) == 0 {
+		return RekeyStats{}, errors.New("both the old and the new secret are required")
+	}
+	if bytes.Equal(oldSecrets[0], newSecret) {
+		return RekeyStats{}, errors.New("the new secret is the same as the old one")
+	}
+
+	db, err := bbolt.Open(path, 0600, &bbolt.Options{Timeout: 1 * time.Second})
+	if err != nil {
+		return RekeyStats{}, fmt.Errorf("failed to open bbolt db (is the server still running?): %w", err)
+	}
+	defer func() { _ = db.Close() }()
+
+	r := &rekeyer{db: db, fs: fs}
+	if err := r.begin(oldSecrets, newSecret); err != nil {
+		return RekeyStats{}, err
+	}
+	for _, name := range rekeyBuckets {
+		n, err := r.bucket([][]byte{name})
+		if err != nil {
+			return r.stats, err
+		}
+		r.stats.Records += n
+		slog.Info("re-encrypted bucket", "bucket", string(name), "records", n)
+	}
+
+	bs := &BboltStorage{db: db, crypter: NewKeyring(r.newCrypter), fs: fs}
+	if err := bs.rekeyLinkPreviews(); err != nil {
+		return r.stats, fmt.Errorf("failed to re-key link previews: %w", err)
+	}
+	if err := bs.RebuildSearchIndex(); err != nil {
+		return r.stats, fmt.Errorf("failed to rebuild search index: %w", err)
+	}
+	if err := r.blobs(bs, uploadBlob); err != nil {
+		return r.stats, err
+	}
+	return r.stats, r.finish()
+}
+
+// begin sets up the old keys and the new crypter. On the first run it checks
+// that the old secrets decrypt the database, drops the secret-derived records and
+// persists a new salt; on a resumed run it reuses the persisted salt.
+func (r *rekeyer) begin(oldSecrets [][]byte, newSecret []byte) error {
+	var salt, newSalt []byte
+	err := r.db.View(func(tx *bbolt.Tx) error {
+		settings := tx.Bucket(bucketSettings)
+		if settings == nil {
+			return errors.New("database has no settings bucket")
+		}
+		var err error
+		if salt, err = base64.StdEncoding.DecodeString(string(settings.Get([]byte("salt")))); err != nil {
+			return fmt.Errorf("failed to decode salt: %w", err)
+		}
+		if len(salt) == 0 {
+			return errors.New("database has no salt: it was never opened by the server")
+		}
+		if v := settings.Get([]byte(configKeyRekeySalt)); v != nil {
+			if newSalt, err = base64.StdEncoding.DecodeString(string(v)); err != nil {
+				return fmt.Errorf("failed to decode re-key salt: %w", err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	resume := newSalt != nil
+	if !resume {
+		if newSalt, err = genSalt(); err != nil {
+			return fmt.Errorf("failed to generate salt: %w", err)
+		}
+	}
+	oldCrypters := make([]*Crypter, 0, len(oldSecrets))
+	for _, secret := range oldSecrets {
+		c, err := NewCrypter(secret, salt)
+		if err != nil {
+			return fmt.Errorf("failed to create crypter: %w", err)
+		}
+		oldCrypters = append(oldCrypters, c)
+	}
+	r.oldKeys = NewKeyring(oldCrypters[0], oldCrypters[1:]...)
+	if r.newCrypter, err = NewCrypter(newSecret, newSalt); err != nil {
+		return fmt.Errorf("failed to create crypter: %w", err)
+	}
+	if err := r.checkSecrets(); err != nil {
+		return err
+	}
+	if resume {
+		slog.Info("resuming interrupted re-key")
+		return nil
+	}
+
+	return r.db.Update(func(tx *bbolt.Tx) error {
+		for _, name := range [][]byte{bucketTokensV2, bucketAdminTokens} {
+			n, err := clearBucket(tx, name)
+			if err != nil {
+				return err
+			}
+			r.stats.Sessions += n
+		}
+		if _, err := clearBucket(tx, bucketSearchIndex); err != nil {
+			return err
+		}
+		return tx.Bucket(bucketSettings).Put([]byte(configKeyRekeySalt), []byte(base64.StdEncoding.EncodeToString(newSalt)))
+	})
+}
+
+// checkSecrets decrypts the first encrypted record found, so a wrong secret
+// fails before anything is written.
+func (r *rekeyer) checkSecrets() error {
+	return r.db.View(func(tx *bbolt.Tx) error {
+		for _, name := range rekeyBuckets {
+			b := tx.Bucket(name)
+			if b == nil {
+				continue
+			}
+			v := firstValue(b)
+			if v == nil {
+				continue
+			}
+			if _, err := r.oldKeys.Decrypt(v); err == nil {
+				return nil
+			}
+			if _, err := r.newCrypter.Decrypt(v); err == nil {
+				return nil
+			}
+			return fmt.Errorf("the old secret does not decrypt the %s bucket: check AUTH_SECRET", name)
+		}
+		return nil
+	})
+}
+
+// firstValue returns the first value in b or its nested buckets.
+func firstValue(b *bbolt.Bucket) []byte {
+	c := b.Cursor()
+	for k, v := c.First(); k != nil; k, v = c.Next() {
+		if v != nil {
+			return v
+		}
+		if v := firstValue(b.Bucket(k)); v != nil {
+			return v
+		}
+	}
+	return nil
+}
+
+// clearBucket deletes every key in a top-level bucket and returns how many
+// there were.
+func clearBucket(tx *bbolt.Tx, name []byte) (int, error) {
+	b := tx.Bucket(name)
+	if b == nil {
+		return 0, nil
+	}
+	n := b.Stats().KeyN
+	if err := tx.DeleteBucket(name); err != nil {
+		return 0, err
+	}
+	_, err := tx.CreateBucket(name)
+	return n, err
+}
+
+// bucket re-encrypts the values of the bucket at path and its nested
+// buckets. It returns the number of values re-encrypted.
+func (r *rekeyer) bucket(path [][]byte) (int, error) {
+	return rewriteBucket(r.db, path, rekeyBatchSize, r.reencrypt, nil)
+}
+
+// rewriteBucket passes every value of the bucket at path and its nested
+// buckets to fn, storing the values fn reports as changed. Each transaction
+// visits at most batch keys, so walking a bucket that needs no changes doesn't
+// hold the write lock for long either. pause, if not nil, runs between transactions and stops the
+// walk when it returns an error. It returns the number of values changed.
+func rewriteBucket(db *bbolt.DB, path [][]byte, batch int, fn func(v []byte) ([]byte, bool, error), pause func() error) (int, error) {
+	var after []byte
+	var nested [][]byte
+	count := 0
+	for {
+		done := true
+		err := db.Update(func(tx *bbolt.Tx) error {
+			b := lookupBucket(tx, path)
+			if b == nil {
+				return nil
+			}
+			type update struct{ k, v []byte }
+			var updates []update
+			visited := 0
+			c := b.Cursor()
+			k, v := c.First()
+			if after != nil {
+				k, v = c.Seek(after)
+				if bytes.Equal(k, after) {
+					k, v = c.Next()
+				}
+			}
+			for ; k != nil; k, v = c.Next() {
+				if visited == batch {
+					done = false
+					break
+				}
+				visited++
+				after = bytes.Clone(k)
+				if v == nil {
+					nested = append(nested, bytes.Clone(k))
+					continue
+				}
+				data, changed, err := fn(v)
+				if err != nil {
+					return fmt.Errorf("%s/%x: %w", bytes.Join(path, []byte("/")), k, err)
+				}
+				if changed {
+					updates = append(updates, update{bytes.Clone(k), data})
+				}
+			}
+			// Values are stored after the walk: changing a bucket while a
+			// cursor is iterating it invalidates the cursor.
+			for _, u := range updates {
+				if err := dirtyPut(tx, b, path, u.k, u.v); err != nil {
+					return err
+				}
+			}
+			count += len(updates)
+			return nil
+		})
+		if err != nil {
+			return count, err
+		}
+		if done {
+			break
+		}
+		if pause != nil {
+			if err := pause(); err != nil {
+				return count, err
+			}
+		}
+	}
+
+	for _, name := range nested {
+		n, err := rewriteBucket(db, appendSeg(path, name), batch, fn, pause)
+		count += n
+		if err != nil {
+			return count, err
+		}
+	}
+	return count, nil
+}
+
+// reencrypt returns data encrypted with the new key. It reports false if data
+// is already encrypted with it.
+func (r *rekeyer) reencrypt(data []byte) ([]byte, bool, error) {
+	if _, err := r.newCrypter.Decrypt(data); err == nil {
+		return data, false, nil
+	}
+	plain, err := r.oldKeys.Decrypt(data)
+	if err != nil {
+		return nil, false, fmt.Errorf("decrypts with neither the old nor the new secret: %w", err)
+	}
+	data, err = r.newCrypter.Encrypt(plain)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to encrypt: %w", err)
+	}
+	return data, true, nil
+}
+
+// blobs re-encrypts every file blob referenced by file metadata.
+func (r *rekeyer) blobs(bs *BboltStorage, uploadBlob func(hash string) error) error {
+	files, err := bs.ListFileMetadata()
+	if err != nil {
+		return fmt.Errorf("failed to list files: %w", err)
+	}
+	seen := make(map[string]bool)
+	for _, meta := range files {
+		for _, hash := range []string{meta.Hash, meta.ThumbnailHash} {
+			if hash == "" || seen[hash] {
+				continue
+			}
+			seen[hash] = true
+			if err := r.blob(hash); err != nil {
+				if errors.Is(err, errBlobMissing) {
+					slog.Warn("file blob is missing, skipping", "hash", hash, "error", err)
+					r.stats.MissingBlobs++
+					continue
+				}
+				return fmt.Errorf("blob %s: %w", hash, err)
+			}
+			if uploadBlob != nil {
+				if err := uploadBlob(hash); err != nil {
+					return fmt.Errorf("failed to upload blob %s: %w", hash, err)
+				}
+			}
+			r.stats.Blobs++
+		}
+	}
+	slog.Info("re-encrypted file blobs", "count", r.stats.Blobs, "missing", r.stats.MissingBlobs)
+	return nil
+}
+
+var errBlobMissing = errors.New("blob missing")
+
+func (r *rekeyer) blob(hash string) error {
+	rc, err := r.fs.Get(hash)
+	if err != nil {
+		return fmt.Errorf("%w: %w", errBlobMissing, err)
+	}
+	data, err := io.ReadAll(rc)
+	_ = rc.Close()
+	if err != nil {
+		return fmt.Errorf("failed to read blob: %w", err)
+	}
+	data, changed, err := r.reencrypt(data)
+	if err != nil || !changed {
+		return err
+	}
+	return r.fs.Replace(bytes.NewReader(data), hash)
+}
+
+// finish switches the database to the new salt and resets the backup state,
+// so the next backup starts a new full chain.
+func (r *rekeyer) finish() error {
+	return r.db.Update(func(tx *bbolt.Tx) error {
+		settings := tx.Bucket(bucketSettings)
+		if err := settings.Put([]byte("salt"), []byte(base64.StdEncoding.EncodeToString(r.newCrypter.Salt()))); err != nil {
+			return err
+		}
+		if err := settings.Put([]byte(configKeyKeyID), []byte(r.newCrypter.KeyID())); err != nil {
+			return err
+		}
+		if err := settings.Delete([]byte(configKeyRekeySalt)); err != nil {
+			return err
+		}
+		if err := settings.Delete([]byte(configKeyBackupState)); err != nil {
+			return err
+		}
+		_, err := clearBucket(tx, bucketBackupDirty)
+		return err
+	})
+}
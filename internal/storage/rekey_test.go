@@ -0,0 +1,166 @@
+package storage
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"path/filepath"
+	"testing"
+
+	"besedka/internal/auth"
+	"besedka/internal/filestore"
+	"besedka/internal/models"
+
+	"go.etcd.io/bbolt"
+)
+
+func TestRekey(t *testing.T) {
+	tmpDir := t.TempDir()
+	fs, _ := filestore.NewLocalFileStore(filepath.Join(tmpDir, "fs"))
+	dbPath := filepath.Join(tmpDir, "test.db")
+	store, err := NewBboltStorage(dbPath, testSecret, fs)
+	if err != nil {
+		t.Fatalf("failed to create storage: %v", err)
+	}
+
+	if err := store.UpsertCredentials(auth.UserCredentials{User: models.User{ID: "u1", UserName: "alice"}, PasswordHash: "hash"}); err != nil {
+		t.Fatalf("UpsertCredentials failed: %v", err)
+	}
+	if err := store.UpsertChat(models.Chat{ID: "townhall"}); err != nil {
+		t.Fatalf("UpsertChat failed: %v", err)
+	}
+	if err := store.UpsertMessage(models.Message{ChatID: "townhall", Seq: 1, UserID: "u1", Content: "rotate the keys"}); err != nil {
+		t.Fatalf("UpsertMessage failed: %v", err)
+	}
+	if err := store.UpsertPushSubscription("u1", "https://push.example/1", []byte("sub")); err != nil {
+		t.Fatalf("UpsertPushSubscription failed: %v", err)
+	}
+	if err := store.UpsertSession(auth.Session{ID: "s1", TokenHash: "th", UserID: "u1"}); err != nil {
+		t.Fatalf("UpsertSession failed: %v", err)
+	}
+	if err := store.PutLinkPreview(models.LinkPreview{URL: "https://example.com", Title: "Example"}, 100); err != nil {
+		t.Fatalf("PutLinkPreview failed: %v", err)
+	}
+	if err := store.SaveFileBlob(bytes.NewReader([]byte("file content")), "blobhash"); err != nil {
+		t.Fatalf("SaveFileBlob failed: %v", err)
+	}
+	if err := store.UpsertFileMetadata(FileMetadata{ID: "f1", Hash: "blobhash", ThumbnailHash: "lost"}); err != nil {
+		t.Fatalf("UpsertFileMetadata failed: %v", err)
+	}
+	if err := store.CommitBackup("backups/full", 1); err != nil {
+		t.Fatalf("CommitBackup failed: %v", err)
+	}
+	_ = store.Close()
+
+	newSecret := []byte("new-secret")
+	if _, err := Rekey(dbPath, [][]byte{[]byte("wrong")}, newSecret, fs, nil); err == nil {
+		t.Fatal("expected a wrong old secret to be rejected")
+	}
+
+	// Simulate an interrupted run: the new salt is persisted and only the
+	// users bucket is re-encrypted.
+	db, err := bbolt.Open(dbPath, 0600, nil)
+	if err != nil {
+		t.Fatalf("failed to open db: %v", err)
+	}
+	r := &rekeyer{db: db, fs: fs}
+	if err := r.begin([][]byte{testSecret}, newSecret); err != nil {
+		t.Fatalf("begin failed: %v", err)
+	}
+	if _, err := r.bucket([][]byte{bucketUsers}); err != nil {
+		t.Fatalf("bucket failed: %v", err)
+	}
+	_ = r.db.Close()
+	if _, err := NewBboltStorage(dbPath, testSecret, fs); !errors.Is(err, ErrRekeyInProgress) {
+		t.Fatalf("expected ErrRekeyInProgress, got %v", err)
+	}
+
+	var uploaded []string
+	stats, err := Rekey(dbPath, [][]byte{testSecret}, newSecret, fs, func(hash string) error {
+		uploaded = append(uploaded, hash)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Rekey failed: %v", err)
+	}
+	if stats.Blobs != 1 || stats.MissingBlobs != 1 || len(uploaded) != 1 || uploaded[0] != "blobhash" {
+		t.Errorf("expected one re-encrypted and one missing blob, got %+v %v", stats, uploaded)
+	}
+
+	store, err = NewBboltStorage(dbPath, newSecret, fs)
+	if err != nil {
+		t.Fatalf("failed to reopen storage with the new secret: %v", err)
+	}
+	defer func() { _ = store.Close() }()
+
+	creds, err := store.ListAllCredentials()
+	if err != nil || len(creds) != 1 || creds[0].UserName != "alice" {
+		t.Errorf("expected alice, got %+v %v", creds, err)
+	}
+	msgs, err := store.ListMessages("townhall", 1, 1)
+	if err != nil || len(msgs) != 1 || msgs[0].Content != "rotate the keys" {
+		t.Errorf("expected the message, got %+v %v", msgs, err)
+	}
+	if subs, err := store.GetPushSubscriptions("u1"); err != nil || len(subs) != 1 || string(subs[0]) != "sub" {
+		t.Errorf("expected the push subscription, got %q %v", subs, err)
+	}
+	if refs, err := store.SearchMessages([]string{"rotate"}, []string{"townhall"}); err != nil || len(refs) != 1 {
+		t.Errorf("expected the search index to be rebuilt, got %+v %v", refs, err)
+	}
+	if p, _, err := store.GetLinkPreview("https://example.com"); err != nil || p.Title != "Example" {
+		t.Errorf("expected the link preview, got %+v %v", p, err)
+	}
+	rc, err := store.GetFileBlob("blobhash")
+	if err != nil {
+		t.Fatalf("GetFileBlob failed: %v", err)
+	}
+	data, _ := io.ReadAll(rc)
+	_ = rc.Close()
+	if string(data) != "file content" {
+		t.Errorf("expected the blob to decrypt with the new secret, got %q", data)
+	}
+	if sessions, _ := store.ListSessions(); len(sessions) != 0 {
+		t.Errorf("expected sessions to be dropped, got %+v", sessions)
+	}
+	if lastKey, _, _ := store.BackupState(); lastKey != "" {
+		t.Errorf("expected the backup state to be reset, got %q", lastKey)
+	}
+}
+
+func TestRewriteBucketBatchesUnchangedValues(t *testing.T) {
+	db, err := bbolt.Open(filepath.Join(t.TempDir(), "test.db"), 0600, nil)
+	if err != nil {
+		t.Fatalf("failed to open db: %v", err)
+	}
+	defer func() { _ = db.Close() }()
+	err = db.Update(func(tx *bbolt.Tx) error {
+		b, err := tx.CreateBucket([]byte("values"))
+		if err != nil {
+			return err
+		}
+		for _, k := range []string{"a", "b", "c", "d", "e"} {
+			if err := b.Put([]byte(k), []byte("v")); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("failed to fill bucket: %v", err)
+	}
+
+	visited, pauses := 0, 0
+	n, err := rewriteBucket(db, [][]byte{[]byte("values")}, 2, func(v []byte) ([]byte, bool, error) {
+		visited++
+		return v, false, nil
+	}, func() error {
+		pauses++
+		return nil
+	})
+	if err != nil || n != 0 {
+		t.Fatalf("expected no changes, got %d %v", n, err)
+	}
+	if visited != 5 || pauses != 2 {
+		t.Errorf("expected 5 values in 3 transactions, got %d values and %d pauses", visited, pauses)
+	}
+}
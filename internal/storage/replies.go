@@ -0,0 +1,79 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+
+	"go.etcd.io/bbolt"
+)
+
+// replyKey orders a chat's reply index by the replied-to message: parentSeq
+// (8 bytes BE), then the seq of the reply (8 bytes BE).
+func replyKey(parentSeq, seq int64) []byte {
+	key := make([]byte, 16)
+	binary.BigEndian.PutUint64(key, uint64(parentSeq))
+	binary.BigEndian.PutUint64(key[8:], uint64(seq))
+	return key
+}
+
+// indexReply adds msg, which must be a reply, to the reply index. Replies
+// never change what they reply to, so indexing a message again is a no-op.
+func indexReply(tx *bbolt.Tx, msg *DBMessage) error {
+	b, err := tx.Bucket(bucketMessageReplies).CreateBucketIfNotExists([]byte(msg.ChatID))
+	if err != nil {
+		return fmt.Errorf("failed to create reply index bucket: %w", err)
+	}
+	path := [][]byte{bucketMessageReplies, []byte(msg.ChatID)}
+	return dirtyPut(tx, b, path, replyKey(msg.ReplyTo.Seq, msg.Seq), indexValue)
+}
+
+// unindexReply removes msg from the reply index.
+func unindexReply(tx *bbolt.Tx, chatID string, msg *DBMessage) error {
+	path := [][]byte{bucketMessageReplies, []byte(chatID)}
+	b := lookupBucket(tx, path)
+	if b == nil {
+		return nil
+	}
+	return dirtyDelete(tx, b, path, replyKey(msg.ReplyTo.Seq, msg.Seq))
+}
+
+// ListReplies returns the seqs of up to limit messages in chatID that reply to
+// seq and come after the seq after, in ascending order.
+func (s *BboltStorage) ListReplies(chatID string, seq, after int64, limit int) ([]int64, error) {
+	var seqs []int64
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		b := lookupBucket(tx, [][]byte{bucketMessageReplies, []byte(chatID)})
+		if b == nil {
+			return nil
+		}
+		prefix := replyKey(seq, 0)[:8]
+		c := b.Cursor()
+		for k, _ := c.Seek(replyKey(seq, after+1)); k != nil && bytes.HasPrefix(k, prefix) && len(seqs) < limit; k, _ = c.Next() {
+			seqs = append(seqs, int64(binary.BigEndian.Uint64(k[8:])))
+		}
+		return nil
+	})
+	return seqs, err
+}
+
+// rebuildReplyIndex indexes all stored replies. It runs once, when the reply
+// index is created on a database that predates it.
+func (s *BboltStorage) rebuildReplyIndex() error {
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		return tx.Bucket(bucketMessages).ForEachBucket(func(chatID []byte) error {
+			chatBucket := tx.Bucket(bucketMessages).Bucket(chatID)
+			return chatBucket.ForEach(func(k, v []byte) error {
+				msg, err := s.decodeMessage(v)
+				if err != nil {
+					return err
+				}
+				if msg.ReplyTo == nil {
+					return nil
+				}
+				msg.ChatID = string(chatID)
+				return indexReply(tx, msg)
+			})
+		})
+	})
+}
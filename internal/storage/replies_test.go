@@ -0,0 +1,88 @@
+package storage
+
+import (
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"besedka/internal/filestore"
+	"besedka/internal/models"
+
+	"go.etcd.io/bbolt"
+)
+
+func TestReplyIndex(t *testing.T) {
+	tmpDir := t.TempDir()
+	dbPath := filepath.Join(tmpDir, "test.db")
+	fs, _ := filestore.NewLocalFileStore(filepath.Join(tmpDir, "fs"))
+	store, err := NewBboltStorage(dbPath, testSecret, fs)
+	if err != nil {
+		t.Fatalf("failed to create storage: %v", err)
+	}
+
+	if err := store.UpsertChat(models.Chat{ID: "townhall"}); err != nil {
+		t.Fatalf("UpsertChat failed: %v", err)
+	}
+	for seq := int64(1); seq <= 6; seq++ {
+		m := models.Message{ChatID: "townhall", Seq: seq, UserID: "u1", Content: "msg"}
+		switch seq {
+		case 2, 4, 5:
+			m.ReplyTo = &models.ReplyRef{ChatID: "townhall", Seq: 1}
+		case 6:
+			m.ReplyTo = &models.ReplyRef{ChatID: "townhall", Seq: 2}
+		}
+		if err := store.UpsertMessage(m); err != nil {
+			t.Fatalf("UpsertMessage failed: %v", err)
+		}
+	}
+	// Saving a reply again, as an edit does, does not index it twice.
+	if err := store.UpsertMessage(models.Message{ChatID: "townhall", Seq: 4, UserID: "u1", Content: "edited",
+		ReplyTo: &models.ReplyRef{ChatID: "townhall", Seq: 1}}); err != nil {
+		t.Fatalf("UpsertMessage failed: %v", err)
+	}
+
+	expectReplies := func(seq, after int64, limit int, want []int64) {
+		t.Helper()
+		got, err := store.ListReplies("townhall", seq, after, limit)
+		if err != nil {
+			t.Fatalf("ListReplies failed: %v", err)
+		}
+		if !slices.Equal(got, want) {
+			t.Errorf("ListReplies(%d, %d, %d) = %v, want %v", seq, after, limit, got, want)
+		}
+	}
+	expectReplies(1, 0, 10, []int64{2, 4, 5})
+	expectReplies(1, 0, 2, []int64{2, 4})
+	expectReplies(1, 4, 2, []int64{5})
+	expectReplies(2, 0, 10, []int64{6})
+	expectReplies(3, 0, 10, nil)
+
+	msgs, err := store.GetMessages("townhall", []int64{6, 4, 42, 4})
+	if err != nil {
+		t.Fatalf("GetMessages failed: %v", err)
+	}
+	if len(msgs) != 2 || msgs[0].Seq != 4 || msgs[0].Content != "edited" || msgs[1].Seq != 6 {
+		t.Errorf("unexpected messages: %+v", msgs)
+	}
+
+	// Retention drops deleted replies from the index.
+	if _, _, err := store.DeleteMessagesBefore("townhall", 3); err != nil {
+		t.Fatalf("DeleteMessagesBefore failed: %v", err)
+	}
+	expectReplies(1, 0, 10, []int64{4, 5})
+
+	// A database that predates the index gets it built on open.
+	if err := store.db.Update(func(tx *bbolt.Tx) error {
+		return tx.DeleteBucket(bucketMessageReplies)
+	}); err != nil {
+		t.Fatalf("failed to drop reply index: %v", err)
+	}
+	_ = store.Close()
+	store, err = NewBboltStorage(dbPath, testSecret, fs)
+	if err != nil {
+		t.Fatalf("failed to reopen storage: %v", err)
+	}
+	defer func() { _ = store.Close() }()
+	expectReplies(1, 0, 10, []int64{4, 5})
+	expectReplies(2, 0, 10, []int64{6})
+}
@@ -0,0 +1,349 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"strings"
+	"time"
+
+	"besedka/internal/content"
+	"besedka/internal/models"
+
+	"go.etcd.io/bbolt"
+)
+
+// retentionBatch is the number of messages deleted per transaction.
+const retentionBatch = 500
+
+func (r *DBRetention) toModel() *models.RetentionPolicy {
+	if r == nil {
+		return nil
+	}
+	return &models.RetentionPolicy{MaxAge: r.MaxAge, MaxMessages: r.MaxMessages}
+}
+
+// SetChatRetention sets the retention policy of chatID. A nil policy makes
+// the chat follow the global one again.
+func (s *BboltStorage) SetChatRetention(chatID string, policy *models.RetentionPolicy) error {
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		dbChat, err := s.getChat(tx, chatID)
+		if err != nil {
+			return err
+		}
+		if dbChat == nil {
+			return models.ErrNotFound
+		}
+		dbChat.Retention = nil
+		if policy != nil {
+			dbChat.Retention = &DBRetention{MaxAge: policy.MaxAge, MaxMessages: policy.MaxMessages}
+		}
+		return s.putChat(tx, dbChat)
+	})
+}
+
+// RetentionCutoff returns the seq of the oldest message of chatID that policy
+// keeps at now, or 0 when it keeps them all.
+func (s *BboltStorage) RetentionCutoff(chatID string, policy models.RetentionPolicy, now time.Time) (int64, error) {
+	var cutoff int64
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		b := tx.Bucket(bucketMessages).Bucket([]byte(chatID))
+		if b == nil {
+			return nil
+		}
+		c := b.Cursor()
+		first, _ := c.First()
+		if first == nil {
+			return nil
+		}
+
+		if policy.MaxMessages > 0 {
+			k, _ := c.Last()
+			for i := 1; k != nil && i < policy.MaxMessages; i++ {
+				k, _ = c.Prev()
+			}
+			if k != nil {
+				cutoff = int64(binary.BigEndian.Uint64(k))
+			}
+		}
+
+		if policy.MaxAge > 0 {
+			// Seqs follow send order, so the expired messages come first.
+			oldest := now.Unix() - policy.MaxAge
+			for k, v := c.First(); k != nil; k, v = c.Next() {
+				msg, err := s.decodeMessage(v)
+				if err != nil {
+					return err
+				}
+				if msg.Timestamp >= oldest {
+					break
+				}
+				cutoff = max(cutoff, msg.Seq+1)
+			}
+		}
+
+		if cutoff <= int64(binary.BigEndian.Uint64(first)) {
+			cutoff = 0
+		}
+		return nil
+	})
+	return cutoff, err
+}
+
+// DeleteMessagesBefore deletes the messages of chatID with a seq below before
+// and records before as the chat's FirstSeq. Messages are deleted through the
+// dirty journal, in batches, along with their search index entries. It
+// returns the IDs of the files the deleted messages referred to; pass them to
+// ReleaseFiles once nothing else can refer to the messages.
+func (s *BboltStorage) DeleteMessagesBefore(chatID string, before int64) ([]string, int, error) {
+	var fileIDs []string
+	deleted := 0
+	path := [][]byte{bucketMessages, []byte(chatID)}
+	maxKey := (&DBMessage{Seq: before}).Key()
+	for done := false; !done; {
+		err := s.db.Update(func(tx *bbolt.Tx) error {
+			var keys [][]byte
+			if b := lookupBucket(tx, path); b != nil {
+				c := b.Cursor()
+				for k, _ := c.First(); k != nil && bytes.Compare(k, maxKey) < 0 && len(keys) < retentionBatch; k, _ = c.Next() {
+					keys = append(keys, bytes.Clone(k))
+				}
+				for _, k := range keys {
+					ids, err := s.deleteMessage(tx, b, chatID, k)
+					if err != nil {
+						return err
+					}
+					fileIDs = append(fileIDs, ids...)
+				}
+			}
+			done = len(keys) < retentionBatch
+			deleted += len(keys)
+
+			firstSeq := before
+			if !done {
+				firstSeq = int64(binary.BigEndian.Uint64(keys[len(keys)-1])) + 1
+			}
+			return s.advanceFirstSeq(tx, chatID, int(firstSeq))
+		})
+		if err != nil {
+			return fileIDs, deleted, err
+		}
+	}
+	return fileIDs, deleted, nil
+}
+
+// deleteMessage deletes the message of chatID under key k from b, along with
+// its search, expiry and reply index entries, and returns the IDs of the
+// files it referred to.
+func (s *BboltStorage) deleteMessage(tx *bbolt.Tx, b *bbolt.Bucket, chatID string, k []byte) ([]string, error) {
+	var fileIDs []string
+	msg, err := s.decodeMessage(b.Get(k))
+	if err != nil {
+		// Delete it anyway: it is being deleted for good either way.
+		slog.Warn("message unreadable, deleting", "chatID", chatID, "key", fmt.Sprintf("%x", k), "error", err)
+	} else {
+		if !msg.Deleted {
+			fileIDs = messageFileIDs(msg)
+			if err := s.updateSearchIndex(tx, chatID, msg.Seq, msg.Timestamp, content.Tokenize(msg.Content), nil); err != nil {
+				return nil, fmt.Errorf("failed to update search index: %w", err)
+			}
+		}
+		if msg.ExpiresAt > 0 {
+			idx := tx.Bucket(bucketMessageExpiry)
+			if err := dirtyDelete(tx, idx, [][]byte{bucketMessageExpiry}, expiryKey(chatID, msg.Seq, msg.ExpiresAt)); err != nil {
+				return nil, err
+			}
+		}
+		if msg.ReplyTo != nil {
+			if err := unindexReply(tx, chatID, msg); err != nil {
+				return nil, err
+			}
+		}
+		if err := indexFiles(tx, chatID, msg.Seq, messageFileIDs(msg), nil); err != nil {
+			return nil, err
+		}
+	}
+	return fileIDs, dirtyDelete(tx, b, [][]byte{bucketMessages, []byte(chatID)}, k)
+}
+
+// advanceFirstSeq moves the FirstSeq of chatID up to firstSeq.
+func (s *BboltStorage) advanceFirstSeq(tx *bbolt.Tx, chatID string, firstSeq int) error {
+	dbChat, err := s.getChat(tx, chatID)
+	if err != nil || dbChat == nil || dbChat.FirstSeq >= firstSeq {
+		return err
+	}
+	dbChat.FirstSeq = firstSeq
+	return s.putChat(tx, dbChat)
+}
+
+// messageFileIDs returns the IDs of the files msg refers to.
+func messageFileIDs(msg *DBMessage) []string {
+	var ids []string
+	for _, a := range msg.Attachments {
+		if a.FileID != "" {
+			ids = append(ids, a.FileID)
+		}
+	}
+	for _, p := range msg.Previews {
+		if p.ImageID != "" {
+			ids = append(ids, p.ImageID)
+		}
+	}
+	if msg.Sender != nil && msg.Sender.AvatarID != "" {
+		ids = append(ids, msg.Sender.AvatarID)
+	}
+	return ids
+}
+
+// ReleaseFiles deletes the files among fileIDs that nothing refers to any
+// more: no stored message, cached link preview, user or chat avatar, profile
+// song, and no HoldFile. A file's blobs are deleted from the file store unless another
+// file shares them or an upload of them is pending. It returns the number of
+// files deleted.
+func (s *BboltStorage) ReleaseFiles(fileIDs []string) (int, error) {
+	if len(fileIDs) == 0 {
+		return 0, nil
+	}
+	candidates := make(map[string]bool, len(fileIDs))
+	for _, id := range fileIDs {
+		candidates[id] = true
+	}
+
+	// Uploads and holds wait until the blobs are gone, so none of them can
+	// start to use a file or blob between the check and the deletion.
+	s.blobsMu.Lock()
+	defer s.blobsMu.Unlock()
+	for id := range s.heldFiles {
+		delete(candidates, id)
+	}
+
+	var released []FileMetadata
+	inUse := make(map[string]bool)
+	err := s.db.Update(func(tx *bbolt.Tx) error {
+		if err := s.dropReferenced(tx, candidates); err != nil {
+			return err
+		}
+		if len(candidates) == 0 {
+			return nil
+		}
+		err := tx.Bucket(bucketFiles).ForEach(func(k, v []byte) error {
+			data, err := s.crypter.Decrypt(v)
+			if err != nil {
+				return fmt.Errorf("failed to decrypt file metadata: %w", err)
+			}
+			var meta FileMetadata
+			if err := meta.UnmarshalBinary(data); err != nil {
+				return err
+			}
+			if candidates[meta.ID] {
+				released = append(released, meta)
+			} else {
+				inUse[meta.Hash] = true
+				inUse[meta.ThumbnailHash] = true
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		b := tx.Bucket(bucketFiles)
+		for _, meta := range released {
+			if err := dirtyDelete(tx, b, [][]byte{bucketFiles}, meta.Key()); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	for _, meta := range released {
+		for _, hash := range []string{meta.Hash, meta.ThumbnailHash} {
+			if hash == "" || inUse[hash] || s.pendingBlobs[hash] > 0 {
+				continue
+			}
+			inUse[hash] = true // delete each blob once
+			if err := s.fs.Delete(hash); err != nil {
+				slog.Warn("retention: failed to delete file blob", "hash", hash, "error", err)
+			}
+		}
+	}
+	return len(released), nil
+}
+
+// dropReferenced removes the files still referred to from candidates.
+func (s *BboltStorage) dropReferenced(tx *bbolt.Tx, candidates map[string]bool) error {
+	for id := range candidates {
+		if fileReferenced(tx, id) {
+			delete(candidates, id)
+		}
+	}
+	if len(candidates) == 0 {
+		return nil
+	}
+
+	err := tx.Bucket(bucketLinkPreviews).ForEach(func(k, v []byte) error {
+		data, err := s.crypter.Decrypt(v)
+		if err != nil {
+			return fmt.Errorf("failed to decrypt link preview: %w", err)
+		}
+		var p DBLinkPreview
+		if err := p.UnmarshalBinary(data); err != nil {
+			return err
+		}
+		delete(candidates, p.ImageID)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// Avatars and profile songs refer to files by URL.
+	err = tx.Bucket(bucketUsers).ForEach(func(k, v []byte) error {
+		data, err := s.crypter.Decrypt(v)
+		if err != nil {
+			return fmt.Errorf("failed to decrypt user record: %w", err)
+		}
+		var u DBUser
+		if err := u.UnmarshalBinary(data); err != nil {
+			return err
+		}
+		delete(candidates, fileIDFromURL(u.AvatarURL))
+		delete(candidates, fileIDFromURL(u.SongURL))
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return tx.Bucket(bucketChats).ForEach(func(k, v []byte) error {
+		c, err := s.decodeChat(v)
+		if err != nil {
+			return err
+		}
+		delete(candidates, fileIDFromURL(c.AvatarURL))
+		return nil
+	})
+}
+
+// fileIDFromURL returns the ID of the file a /api/images/{id} or
+// /api/files/{id}{ext} URL serves, or "" for any other URL.
+func fileIDFromURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	var id string
+	if rest, ok := strings.CutPrefix(u.Path, "/api/images/"); ok {
+		id = rest
+	} else if rest, ok := strings.CutPrefix(u.Path, "/api/files/"); ok {
+		id, _, _ = strings.Cut(rest, ".")
+	}
+	if strings.Contains(id, "/") {
+		return ""
+	}
+	return id
+}
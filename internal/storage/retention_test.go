@@ -0,0 +1,277 @@
+package storage
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"besedka/internal/auth"
+	"besedka/internal/filestore"
+	"besedka/internal/models"
+
+	"go.etcd.io/bbolt"
+)
+
+func TestRetention(t *testing.T) {
+	tmpDir := t.TempDir()
+	fs, _ := filestore.NewLocalFileStore(filepath.Join(tmpDir, "fs"))
+	store, err := NewBboltStorage(filepath.Join(tmpDir, "test.db"), testSecret, fs)
+	if err != nil {
+		t.Fatalf("failed to create storage: %v", err)
+	}
+	defer func() { _ = store.Close() }()
+
+	// f3 is also alice's avatar, so it outlives the messages it is attached to.
+	if err := store.UpsertCredentials(auth.UserCredentials{User: models.User{ID: "u1", UserName: "alice", AvatarURL: "/api/images/f3?thumb=1"}}); err != nil {
+		t.Fatalf("UpsertCredentials failed: %v", err)
+	}
+	if err := store.UpsertChat(models.Chat{ID: "townhall"}); err != nil {
+		t.Fatalf("UpsertChat failed: %v", err)
+	}
+	for _, f := range []FileMetadata{{ID: "f1", Hash: "h1"}, {ID: "f2", Hash: "h2"}, {ID: "f3", Hash: "h3"}} {
+		if err := store.SaveFileBlob(bytes.NewReader([]byte("blob "+f.Hash)), f.Hash); err != nil {
+			t.Fatalf("SaveFileBlob failed: %v", err)
+		}
+		if err := store.UpsertFileMetadata(f); err != nil {
+			t.Fatalf("UpsertFileMetadata failed: %v", err)
+		}
+	}
+	attachments := map[int64][]string{1: {"f1"}, 2: {"f2", "f3"}, 5: {"f2"}}
+	now := time.Now()
+	for seq := int64(1); seq <= 5; seq++ {
+		msg := models.Message{
+			ChatID:    "townhall",
+			Seq:       seq,
+			UserID:    "u1",
+			Timestamp: now.Add(-time.Duration(6-seq) * 24 * time.Hour).Unix(),
+			Content:   fmt.Sprintf("message%d", seq),
+		}
+		for _, id := range attachments[seq] {
+			msg.Attachments = append(msg.Attachments, models.Attachment{Type: models.AttachmentTypeFile, FileID: id})
+		}
+		if err := store.UpsertMessage(msg); err != nil {
+			t.Fatalf("UpsertMessage failed: %v", err)
+		}
+	}
+
+	cutoffs := []struct {
+		policy models.RetentionPolicy
+		want   int64
+	}{
+		{models.RetentionPolicy{MaxMessages: 3}, 3},
+		{models.RetentionPolicy{MaxMessages: 10}, 0},
+		{models.RetentionPolicy{MaxAge: int64((60 * time.Hour).Seconds())}, 4},
+		{models.RetentionPolicy{MaxAge: int64((60 * time.Hour).Seconds()), MaxMessages: 4}, 4},
+		{models.RetentionPolicy{MaxAge: int64((30 * 24 * time.Hour).Seconds())}, 0},
+	}
+	for _, c := range cutoffs {
+		if got, err := store.RetentionCutoff("townhall", c.policy, now); err != nil || got != c.want {
+			t.Errorf("RetentionCutoff(%+v) = %d %v, want %d", c.policy, got, err, c.want)
+		}
+	}
+
+	fileIDs, deleted, err := store.DeleteMessagesBefore("townhall", 3)
+	if err != nil || deleted != 2 || len(fileIDs) != 3 {
+		t.Fatalf("expected 2 messages with 3 files deleted, got %d %v %v", deleted, fileIDs, err)
+	}
+	if msgs, _ := store.ListMessages("townhall", 1, 5); len(msgs) != 3 || msgs[0].Seq != 3 {
+		t.Errorf("expected seqs 3 to 5 to be left, got %+v", msgs)
+	}
+	if refs, _ := store.SearchMessages([]string{"message1"}, []string{"townhall"}); len(refs) != 0 {
+		t.Errorf("expected deleted messages to leave the search index, got %+v", refs)
+	}
+	if chats, _ := store.ListChats(); chats[0].FirstSeq != 3 || chats[0].LastSeq != 5 {
+		t.Errorf("expected FirstSeq 3 and LastSeq 5, got %+v", chats[0])
+	}
+
+	released, err := store.ReleaseFiles(fileIDs)
+	if err != nil || released != 1 {
+		t.Fatalf("expected only f1 to be released, got %d %v", released, err)
+	}
+	if _, err := store.GetFileMetadata("f1"); err == nil {
+		t.Error("expected f1 metadata to be deleted")
+	}
+	if _, err := fs.Get("h1"); err == nil {
+		t.Error("expected the f1 blob to be deleted")
+	}
+	for _, id := range []string{"f2", "f3"} {
+		if _, err := store.GetFileMetadata(id); err != nil {
+			t.Errorf("expected %s to be kept: %v", id, err)
+		}
+	}
+
+	if err := store.SetChatRetention("missing", nil); !errors.Is(err, models.ErrNotFound) {
+		t.Errorf("expected ErrNotFound for an unknown chat, got %v", err)
+	}
+	if err := store.SetChatRetention("townhall", &models.RetentionPolicy{MaxMessages: 100}); err != nil {
+		t.Fatalf("SetChatRetention failed: %v", err)
+	}
+	// Saving the chat elsewhere keeps its policy and FirstSeq.
+	if err := store.UpsertChat(models.Chat{ID: "townhall", Pins: []int64{4}}); err != nil {
+		t.Fatalf("UpsertChat failed: %v", err)
+	}
+	chats, _ := store.ListChats()
+	if chats[0].Retention == nil || chats[0].Retention.MaxMessages != 100 || chats[0].FirstSeq != 3 {
+		t.Errorf("expected the chat to keep its policy and FirstSeq, got %+v", chats[0])
+	}
+	if err := store.SetChatRetention("townhall", nil); err != nil {
+		t.Fatalf("SetChatRetention failed: %v", err)
+	}
+	if chats, _ := store.ListChats(); chats[0].Retention != nil {
+		t.Errorf("expected the policy to be reset, got %+v", chats[0].Retention)
+	}
+
+	// Tombstoning the last message attaching f2 releases it.
+	if err := store.UpsertMessage(models.Message{ChatID: "townhall", Seq: 5, UserID: "u1", Deleted: true}); err != nil {
+		t.Fatalf("UpsertMessage failed: %v", err)
+	}
+	if _, err := store.GetFileMetadata("f2"); err == nil {
+		t.Error("expected f2 to be released with the tombstoned message")
+	}
+	if _, err := store.GetFileMetadata("f3"); err != nil {
+		t.Errorf("expected f3 to be kept: %v", err)
+	}
+}
+
+func TestReleaseFilesKeepsFilesInUse(t *testing.T) {
+	tmpDir := t.TempDir()
+	fs, _ := filestore.NewLocalFileStore(filepath.Join(tmpDir, "fs"))
+	dbPath := filepath.Join(tmpDir, "test.db")
+	store, err := NewBboltStorage(dbPath, testSecret, fs)
+	if err != nil {
+		t.Fatalf("failed to create storage: %v", err)
+	}
+	if err := store.UpsertChat(models.Chat{ID: "townhall"}); err != nil {
+		t.Fatalf("UpsertChat failed: %v", err)
+	}
+	for _, f := range []FileMetadata{{ID: "f1", Hash: "h1"}, {ID: "f2", Hash: "h2"}, {ID: "f3", Hash: "h3"}} {
+		if err := store.SaveFileBlob(bytes.NewReader([]byte("blob "+f.Hash)), f.Hash); err != nil {
+			t.Fatalf("SaveFileBlob failed: %v", err)
+		}
+		if err := store.UpsertFileMetadata(f); err != nil {
+			t.Fatalf("UpsertFileMetadata failed: %v", err)
+		}
+	}
+	msg := models.Message{ChatID: "townhall", Seq: 1, UserID: "u1", Content: "with a file",
+		Attachments: []models.Attachment{{Type: models.AttachmentTypeFile, FileID: "f1"}}}
+	if err := store.UpsertMessage(msg); err != nil {
+		t.Fatalf("UpsertMessage failed: %v", err)
+	}
+
+	// A database that predates the file reference index gets it built on open.
+	if err := store.db.Update(func(tx *bbolt.Tx) error {
+		return tx.DeleteBucket(bucketMessageFiles)
+	}); err != nil {
+		t.Fatalf("failed to drop file reference index: %v", err)
+	}
+	_ = store.Close()
+	store, err = NewBboltStorage(dbPath, testSecret, fs)
+	if err != nil {
+		t.Fatalf("failed to reopen storage: %v", err)
+	}
+	defer func() { _ = store.Close() }()
+	if n, err := store.ReleaseFiles([]string{"f1"}); err != nil || n != 0 {
+		t.Errorf("expected f1 to be kept for the message, got %d %v", n, err)
+	}
+
+	// Editing the attachment away drops the reference.
+	msg.Attachments = nil
+	if err := store.UpsertMessage(msg); err != nil {
+		t.Fatalf("UpsertMessage failed: %v", err)
+	}
+	if n, err := store.ReleaseFiles([]string{"f1"}); err != nil || n != 1 {
+		t.Errorf("expected f1 to be released after the edit, got %d %v", n, err)
+	}
+
+	// A held file is kept until it is let go.
+	if _, ok := store.HoldFile("f1"); ok {
+		t.Error("expected a released file not to be held")
+	}
+	release, ok := store.HoldFile("f2")
+	if !ok {
+		t.Fatal("expected f2 to be held")
+	}
+	if n, err := store.ReleaseFiles([]string{"f2"}); err != nil || n != 0 {
+		t.Errorf("expected held f2 to be kept, got %d %v", n, err)
+	}
+	release()
+	if n, err := store.ReleaseFiles([]string{"f2"}); err != nil || n != 1 {
+		t.Errorf("expected f2 to be released once let go, got %d %v", n, err)
+	}
+
+	// A blob being uploaded again outlives the file that had it.
+	if err := store.SaveFileBlob(bytes.NewReader([]byte("blob h3")), "h3"); err != nil {
+		t.Fatalf("SaveFileBlob failed: %v", err)
+	}
+	if n, err := store.ReleaseFiles([]string{"f3"}); err != nil || n != 1 {
+		t.Errorf("expected f3 to be released, got %d %v", n, err)
+	}
+	if _, err := fs.Get("h3"); err != nil {
+		t.Errorf("expected the pending h3 blob to be kept: %v", err)
+	}
+	if err := store.UpsertFileMetadata(FileMetadata{ID: "f4", Hash: "h3"}); err != nil {
+		t.Fatalf("UpsertFileMetadata failed: %v", err)
+	}
+	if len(store.pendingBlobs) != 0 {
+		t.Errorf("expected no pending blobs once the metadata is stored, got %v", store.pendingBlobs)
+	}
+}
+
+func TestReleaseFilesKeepsAvatarsAndSongs(t *testing.T) {
+	tmpDir := t.TempDir()
+	fs, _ := filestore.NewLocalFileStore(filepath.Join(tmpDir, "fs"))
+	store, err := NewBboltStorage(filepath.Join(tmpDir, "test.db"), testSecret, fs)
+	if err != nil {
+		t.Fatalf("failed to create storage: %v", err)
+	}
+	defer func() { _ = store.Close() }()
+
+	users := []models.User{
+		{ID: "u1", UserName: "alice"},
+		{ID: "u2", UserName: "bob", AvatarURL: "/api/images/bobface?thumb=1", SongURL: "/api/files/bobsong.mp3"},
+	}
+	for _, u := range users {
+		if err := store.UpsertCredentials(auth.UserCredentials{User: u}); err != nil {
+			t.Fatalf("UpsertCredentials failed: %v", err)
+		}
+	}
+	if err := store.UpsertChat(models.Chat{ID: "g1", IsGroup: true, AvatarURL: "/api/images/groupface?thumb=1"}); err != nil {
+		t.Fatalf("UpsertChat failed: %v", err)
+	}
+	ids := []string{"bobface", "bobsong", "groupface", "bobface2", "upload"}
+	for _, id := range ids {
+		if err := store.SaveFileBlob(bytes.NewReader([]byte("blob "+id)), "h"+id); err != nil {
+			t.Fatalf("SaveFileBlob failed: %v", err)
+		}
+		if err := store.UpsertFileMetadata(FileMetadata{ID: id, Hash: "h" + id}); err != nil {
+			t.Fatalf("UpsertFileMetadata failed: %v", err)
+		}
+	}
+
+	// Alice forwards bob's avatar, song and the group avatar, then deletes
+	// the message. Only her own upload and a file merely named like an
+	// avatar go with it.
+	msg := models.Message{ChatID: "g1", Seq: 1, UserID: "u1", Content: "look"}
+	for _, id := range ids {
+		msg.Attachments = append(msg.Attachments, models.Attachment{Type: models.AttachmentTypeFile, FileID: id})
+	}
+	if err := store.UpsertMessage(msg); err != nil {
+		t.Fatalf("UpsertMessage failed: %v", err)
+	}
+	if err := store.UpsertMessage(models.Message{ChatID: "g1", Seq: 1, UserID: "u1", Deleted: true}); err != nil {
+		t.Fatalf("UpsertMessage failed: %v", err)
+	}
+	for _, id := range []string{"bobface", "bobsong", "groupface"} {
+		if _, err := store.GetFileMetadata(id); err != nil {
+			t.Errorf("expected %s to be kept: %v", id, err)
+		}
+	}
+	for _, id := range []string{"bobface2", "upload"} {
+		if _, err := store.GetFileMetadata(id); err == nil {
+			t.Errorf("expected %s to be released", id)
+		}
+	}
+}
@@ -0,0 +1,229 @@
+package storage
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/binary"
+	"fmt"
+	"slices"
+
+	"besedka/internal/content"
+
+	"github.com/vmihailenco/msgpack/v5"
+	"go.etcd.io/bbolt"
+)
+
+// The search index is an inverted index from message tokens to the messages
+// containing them. Every posting is a record of its own, keyed by the blinded
+// token, a blind index of the token and the chat, and a blind index of the
+// token and the message, so indexing a message touches one record per token
+// however many messages share it, and a search only reads the postings of the
+// chats it is limited to. Tokens are stored blinded and postings encrypted, so
+// words are not readable at rest, but the key prefixes are: the postings of a
+// token share one, which reveals how often each token is used and lets the
+// messages containing a token be grouped together, and by chat. Only exact
+// tokens can be looked up.
+
+// SearchRef identifies a message matching a search.
+type SearchRef struct {
+	ChatID    string
+	Seq       int64
+	Timestamp int64
+}
+
+type DBPosting struct {
+	ChatID    string `msgpack:"chatId"`
+	Seq       int64  `msgpack:"seq"`
+	Timestamp int64  `msgpack:"timestamp"`
+}
+
+func (p *DBPosting) MarshalBinary() (data []byte, err error) {
+	type alias DBPosting
+	return msgpack.Marshal((*alias)(p))
+}
+
+func (p *DBPosting) UnmarshalBinary(data []byte) error {
+	type alias DBPosting
+	return msgpack.Unmarshal(data, (*alias)(p))
+}
+
+// SearchMessages returns references to all messages of chatIDs containing
+// every token, newest first.
+func (s *BboltStorage) SearchMessages(tokens, chatIDs []string) ([]SearchRef, error) {
+	if len(tokens) == 0 || len(chatIDs) == 0 {
+		return nil, nil
+	}
+
+	type msgRef struct {
+		chatID string
+		seq    int64
+	}
+	var refs []SearchRef
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		b := tx.Bucket(bucketSearchIndex)
+		var matches map[msgRef]int64
+		for _, token := range tokens {
+			next := make(map[msgRef]int64)
+			for _, chatID := range chatIDs {
+				err := s.forEachPosting(b, token, chatID, func(p DBPosting) {
+					ref := msgRef{p.ChatID, p.Seq}
+					if _, ok := matches[ref]; matches == nil || ok {
+						next[ref] = p.Timestamp
+					}
+				})
+				if err != nil {
+					return err
+				}
+			}
+			matches = next
+			if len(matches) == 0 {
+				return nil
+			}
+		}
+		for ref, ts := range matches {
+			refs = append(refs, SearchRef{ChatID: ref.chatID, Seq: ref.seq, Timestamp: ts})
+		}
+		return nil
+	})
+	slices.SortFunc(refs, func(a, b SearchRef) int {
+		return cmp.Or(cmp.Compare(b.Timestamp, a.Timestamp), cmp.Compare(a.ChatID, b.ChatID), cmp.Compare(b.Seq, a.Seq))
+	})
+	return refs, err
+}
+
+// RebuildSearchIndex clears the search index and rebuilds it from all stored messages.
+func (s *BboltStorage) RebuildSearchIndex() error {
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		b := tx.Bucket(bucketSearchIndex)
+		var stale [][]byte
+		if err := b.ForEach(func(k, _ []byte) error {
+			stale = append(stale, slices.Clone(k))
+			return nil
+		}); err != nil {
+			return err
+		}
+		for _, k := range stale {
+			if err := dirtyDelete(tx, b, [][]byte{bucketSearchIndex}, k); err != nil {
+				return err
+			}
+		}
+
+		return tx.Bucket(bucketMessages).ForEachBucket(func(chatID []byte) error {
+			chatBucket := tx.Bucket(bucketMessages).Bucket(chatID)
+			return chatBucket.ForEach(func(k, v []byte) error {
+				msg, err := s.decodeMessage(v)
+				if err != nil {
+					return err
+				}
+				if msg.Deleted {
+					return nil
+				}
+				posting := &DBPosting{ChatID: string(chatID), Seq: msg.Seq, Timestamp: msg.Timestamp}
+				for _, token := range content.Tokenize(msg.Content) {
+					if err := s.putPosting(tx, b, token, posting); err != nil {
+						return err
+					}
+				}
+				return nil
+			})
+		})
+	})
+}
+
+// updateSearchIndex moves a message from the posting lists of oldTokens to those of newTokens.
+func (s *BboltStorage) updateSearchIndex(tx *bbolt.Tx, chatID string, seq, timestamp int64, oldTokens, newTokens []string) error {
+	b := tx.Bucket(bucketSearchIndex)
+	posting := &DBPosting{ChatID: chatID, Seq: seq, Timestamp: timestamp}
+
+	for _, token := range oldTokens {
+		if slices.Contains(newTokens, token) {
+			continue
+		}
+		if err := dirtyDelete(tx, b, [][]byte{bucketSearchIndex}, s.postingKey(token, chatID, seq)); err != nil {
+			return err
+		}
+	}
+
+	for _, token := range newTokens {
+		if slices.Contains(oldTokens, token) {
+			continue
+		}
+		if err := s.putPosting(tx, b, token, posting); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// postingPrefix is the blinded token followed by a blind index of the token
+// and the chat: the common prefix of the token's postings in chatID.
+func (s *BboltStorage) postingPrefix(token, chatID string) []byte {
+	id := make([]byte, 0, len(token)+len(chatID)+1)
+	id = append(id, token...)
+	id = append(id, 0)
+	id = append(id, chatID...)
+	return append(s.crypter.BlindIndex([]byte(token)), s.crypter.BlindIndex(id)...)
+}
+
+// postingKey is the posting prefix followed by a blind index of the token and
+// the message.
+func (s *BboltStorage) postingKey(token, chatID string, seq int64) []byte {
+	id := make([]byte, 0, len(token)+len(chatID)+10)
+	id = append(id, token...)
+	id = append(id, 0)
+	id = append(id, chatID...)
+	id = append(id, 0)
+	id = binary.BigEndian.AppendUint64(id, uint64(seq))
+	return append(s.postingPrefix(token, chatID), s.crypter.BlindIndex(id)...)
+}
+
+// forEachPosting calls fn with every posting of token in chatID.
+func (s *BboltStorage) forEachPosting(b *bbolt.Bucket, token, chatID string, fn func(p DBPosting)) error {
+	prefix := s.postingPrefix(token, chatID)
+	c := b.Cursor()
+	for k, v := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+		data, err := s.crypter.Decrypt(v)
+		if err != nil {
+			return fmt.Errorf("failed to decrypt search posting: %w", err)
+		}
+		var p DBPosting
+		if err := p.UnmarshalBinary(data); err != nil {
+			return err
+		}
+		fn(p)
+	}
+	return nil
+}
+
+func (s *BboltStorage) putPosting(tx *bbolt.Tx, b *bbolt.Bucket, token string, posting *DBPosting) error {
+	data, err := posting.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	data, err = s.crypter.Encrypt(data)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt search posting: %w", err)
+	}
+	return dirtyPut(tx, b, [][]byte{bucketSearchIndex}, s.postingKey(token, posting.ChatID, posting.Seq), data)
+}
+
+// getMessage returns the stored message with the given seq, or nil if there is none.
+func (s *BboltStorage) getMessage(chatBucket *bbolt.Bucket, seq int64) (*DBMessage, error) {
+	data := chatBucket.Get((&DBMessage{Seq: seq}).Key())
+	if data == nil {
+		return nil, nil
+	}
+	return s.decodeMessage(data)
+}
+
+func (s *BboltStorage) decodeMessage(data []byte) (*DBMessage, error) {
+	data, err := s.crypter.Decrypt(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt message record: %w", err)
+	}
+	var msg DBMessage
+	if err := msg.UnmarshalBinary(data); err != nil {
+		return nil, err
+	}
+	return &msg, nil
+}
@@ -0,0 +1,185 @@
+package storage
+
+import (
+	"bytes"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"besedka/internal/filestore"
+	"besedka/internal/models"
+
+	"go.etcd.io/bbolt"
+)
+
+func TestSearchIndex(t *testing.T) {
+	tmpDir := t.TempDir()
+	dbPath := filepath.Join(tmpDir, "test.db")
+	fs, _ := filestore.NewLocalFileStore(filepath.Join(tmpDir, "fs"))
+	store, err := NewBboltStorage(dbPath, testSecret, fs)
+	if err != nil {
+		t.Fatalf("failed to create storage: %v", err)
+	}
+
+	search := func(t *testing.T, query ...string) []SearchRef {
+		t.Helper()
+		refs, err := store.SearchMessages(query, []string{"townhall", "dm_u1_u2"})
+		if err != nil {
+			t.Fatalf("SearchMessages failed: %v", err)
+		}
+		slices.SortFunc(refs, func(a, b SearchRef) int { return int(a.Seq - b.Seq) })
+		return refs
+	}
+
+	for _, id := range []string{"townhall", "dm_u1_u2"} {
+		if err := store.UpsertChat(models.Chat{ID: id}); err != nil {
+			t.Fatalf("UpsertChat failed: %v", err)
+		}
+	}
+	for _, m := range []models.Message{
+		{ChatID: "townhall", Seq: 1, UserID: "u1", Content: "Lunch at **noon**?"},
+		{ChatID: "townhall", Seq: 2, UserID: "u2", Content: "noon works"},
+		{ChatID: "dm_u1_u2", Seq: 1, UserID: "u1", Content: "secret lunch plans"},
+	} {
+		if err := store.UpsertMessage(m); err != nil {
+			t.Fatalf("UpsertMessage failed: %v", err)
+		}
+	}
+
+	if refs := search(t, "noon"); len(refs) != 2 || refs[0] != (SearchRef{ChatID: "townhall", Seq: 1}) || refs[1] != (SearchRef{ChatID: "townhall", Seq: 2}) {
+		t.Errorf("unexpected results for noon: %v", refs)
+	}
+	if refs := search(t, "lunch", "noon"); len(refs) != 1 || refs[0] != (SearchRef{ChatID: "townhall", Seq: 1}) {
+		t.Errorf("expected AND semantics, got %v", refs)
+	}
+	if refs := search(t, "missing"); len(refs) != 0 {
+		t.Errorf("expected no results, got %v", refs)
+	}
+	if refs, err := store.SearchMessages([]string{"lunch"}, []string{"townhall"}); err != nil || len(refs) != 1 || refs[0].ChatID != "townhall" {
+		t.Errorf("expected only the townhall message, got %v %v", refs, err)
+	}
+
+	// Tokens are stored blinded, never in plaintext.
+	err = store.db.View(func(tx *bbolt.Tx) error {
+		return tx.Bucket(bucketSearchIndex).ForEach(func(k, v []byte) error {
+			if bytes.Contains(k, []byte("lunch")) || bytes.Contains(v, []byte("lunch")) {
+				t.Error("search index contains plaintext token")
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Edits move the message between posting lists, deletes drop it.
+	if err := store.UpsertMessage(models.Message{ChatID: "townhall", Seq: 2, UserID: "u2", Content: "tomorrow works"}); err != nil {
+		t.Fatalf("UpsertMessage failed: %v", err)
+	}
+	if refs := search(t, "noon"); len(refs) != 1 || refs[0].Seq != 1 {
+		t.Errorf("expected edited message to leave index, got %v", refs)
+	}
+	if refs := search(t, "tomorrow"); len(refs) != 1 || refs[0].Seq != 2 {
+		t.Errorf("expected edited message to be indexed, got %v", refs)
+	}
+	if err := store.UpsertMessage(models.Message{ChatID: "dm_u1_u2", Seq: 1, UserID: "u1", Deleted: true}); err != nil {
+		t.Fatalf("UpsertMessage failed: %v", err)
+	}
+	if refs := search(t, "secret"); len(refs) != 0 {
+		t.Errorf("expected deleted message to leave index, got %v", refs)
+	}
+
+	// A missing index bucket is rebuilt on startup.
+	err = store.db.Update(func(tx *bbolt.Tx) error {
+		return tx.DeleteBucket(bucketSearchIndex)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Close(); err != nil {
+		t.Fatal(err)
+	}
+	store, err = NewBboltStorage(dbPath, testSecret, fs)
+	if err != nil {
+		t.Fatalf("failed to reopen storage: %v", err)
+	}
+	defer func() { _ = store.Close() }()
+
+	if refs := search(t, "lunch"); len(refs) != 1 || refs[0] != (SearchRef{ChatID: "townhall", Seq: 1}) {
+		t.Errorf("unexpected results after rebuild: %v", refs)
+	}
+	if refs := search(t, "tomorrow"); len(refs) != 1 {
+		t.Errorf("unexpected results after rebuild: %v", refs)
+	}
+}
+
+func TestSearchIndexOrderAndUpgrade(t *testing.T) {
+	tmpDir := t.TempDir()
+	dbPath := filepath.Join(tmpDir, "test.db")
+	fs, _ := filestore.NewLocalFileStore(filepath.Join(tmpDir, "fs"))
+	store, err := NewBboltStorage(dbPath, testSecret, fs)
+	if err != nil {
+		t.Fatalf("failed to create storage: %v", err)
+	}
+
+	for _, id := range []string{"townhall", "dm_u1_u2"} {
+		if err := store.UpsertChat(models.Chat{ID: id}); err != nil {
+			t.Fatalf("UpsertChat failed: %v", err)
+		}
+	}
+	for _, m := range []models.Message{
+		{ChatID: "townhall", Seq: 1, UserID: "u1", Timestamp: 100, Content: "deploy today"},
+		{ChatID: "dm_u1_u2", Seq: 1, UserID: "u1", Timestamp: 300, Content: "deploy done"},
+		{ChatID: "townhall", Seq: 2, UserID: "u2", Timestamp: 200, Content: "deploy failed"},
+	} {
+		if err := store.UpsertMessage(m); err != nil {
+			t.Fatalf("UpsertMessage failed: %v", err)
+		}
+	}
+
+	expectNewestFirst := func() {
+		t.Helper()
+		refs, err := store.SearchMessages([]string{"deploy"}, []string{"townhall", "dm_u1_u2"})
+		if err != nil {
+			t.Fatalf("SearchMessages failed: %v", err)
+		}
+		want := []SearchRef{
+			{ChatID: "dm_u1_u2", Seq: 1, Timestamp: 300},
+			{ChatID: "townhall", Seq: 2, Timestamp: 200},
+			{ChatID: "townhall", Seq: 1, Timestamp: 100},
+		}
+		if !slices.Equal(refs, want) {
+			t.Errorf("expected %v, got %v", want, refs)
+		}
+	}
+	expectNewestFirst()
+
+	// A database with the old posting list index gets it replaced on startup.
+	err = store.db.Update(func(tx *bbolt.Tx) error {
+		if err := tx.DeleteBucket(bucketSearchIndex); err != nil {
+			return err
+		}
+		b, err := tx.CreateBucket(bucketSearchIndexV1)
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte("token"), []byte("postings"))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = store.Close()
+	store, err = NewBboltStorage(dbPath, testSecret, fs)
+	if err != nil {
+		t.Fatalf("failed to reopen storage: %v", err)
+	}
+	defer func() { _ = store.Close() }()
+
+	expectNewestFirst()
+	_ = store.db.View(func(tx *bbolt.Tx) error {
+		if tx.Bucket(bucketSearchIndexV1) != nil {
+			t.Error("expected the old search index to be dropped")
+		}
+		return nil
+	})
+}
@@ -18,6 +18,11 @@ type Storeable interface {
 type DBToken struct {
 	UserID string `msgpack:"userId"`
 	Token  string `msgpack:"token"`
+	// Session details, not set for registration tokens.
+	ID        string `msgpack:"id,omitempty"`
+	CreatedAt int64  `msgpack:"createdAt,omitempty"`
+	UserAgent string `msgpack:"userAgent,omitempty"`
+	IP        string `msgpack:"ip,omitempty"`
 }
 
 func (t *DBToken) Key() []byte {
@@ -35,8 +40,19 @@ func (t *DBToken) UnmarshalBinary(data []byte) error {
 }
 
 type DBAPIKey struct {
-	UserID  string `msgpack:"userId"`
-	KeyHash string `msgpack:"keyHash"`
+	ID         string `msgpack:"id,omitempty"`
+	UserID     string `msgpack:"userId"`
+	KeyHash    string `msgpack:"keyHash"`
+	Name       string `msgpack:"name,omitempty"`
+	CreatedAt  int64  `msgpack:"createdAt,omitempty"`
+	ExpiresAt  int64  `msgpack:"expiresAt,omitempty"`
+	LastUsedAt int64  `msgpack:"lastUsedAt,omitempty"`
+	LastUsedIP string `msgpack:"lastUsedIp,omitempty"`
+}
+
+type DBChatScope struct {
+	ChatID      string           `msgpack:"chatId"`
+	Permissions DBBotPermissions `msgpack:"permissions"`
 }
 
 func (k *DBAPIKey) Key() []byte {
@@ -71,11 +87,18 @@ type DBUser struct {
 	Status         string           `msgpack:"status"`
 	Type           string           `msgpack:"type"`
 	BotPermissions DBBotPermissions `msgpack:"botPermissions"`
+	Scoped         bool             `msgpack:"scoped,omitempty"`
+	Scopes         []DBChatScope    `msgpack:"scopes,omitempty"`
 	TargetChatID   string           `msgpack:"targetChatId"`
+	WebhookChats   []string         `msgpack:"webhookChats,omitempty"`
 	SongURL        string           `msgpack:"songUrl"`
 	SongTitle      string           `msgpack:"songTitle"`
 	SongArtist     string           `msgpack:"songArtist"`
 	Bio            string           `msgpack:"bio"`
+	CallbackURL    string           `msgpack:"callbackUrl,omitempty"`
+	WebhookSecret  []byte           `msgpack:"webhookSecret,omitempty"`
+	RecoveryCodes  []string         `msgpack:"recoveryCodes,omitempty"`
+	PasskeyOnly    bool             `msgpack:"passkeyOnly,omitempty"`
 }
 
 func (u *DBUser) Key() []byte {
@@ -142,11 +165,27 @@ func (s *DBUserSettings) toModel() models.UserSettings {
 }
 
 type DBChat struct {
-	ID        string `msgpack:"id"`
-	Name      string `msgpack:"name"`
-	AvatarURL string `msgpack:"avatarUrl"`
-	LastSeq   int    `msgpack:"lastSeq"`
-	IsDM      bool   `msgpack:"isDm"`
+	ID        string   `msgpack:"id"`
+	Name      string   `msgpack:"name"`
+	AvatarURL string   `msgpack:"avatarUrl"`
+	LastSeq   int      `msgpack:"lastSeq"`
+	IsDM      bool     `msgpack:"isDm"`
+	IsGroup   bool     `msgpack:"isGroup"`
+	Members   []string `msgpack:"members"`
+	Pins      []int64  `msgpack:"pins"`
+	// FirstSeq is the oldest message kept; retention deleted earlier ones.
+	FirstSeq  int          `msgpack:"firstSeq,omitempty"`
+	Retention *DBRetention `msgpack:"retention,omitempty"`
+	// DisappearAfter is the disappearing messages timer of a DM, in seconds.
+	DisappearAfter int64 `msgpack:"disappearAfter,omitempty"`
+	// CreatedBy is the creator of a group chat.
+	CreatedBy string `msgpack:"createdBy,omitempty"`
+}
+
+// DBRetention is a per-chat retention policy.
+type DBRetention struct {
+	MaxAge      int64 `msgpack:"maxAge"`
+	MaxMessages int   `msgpack:"maxMessages"`
 }
 
 func (c *DBChat) Key() []byte {
@@ -164,12 +203,79 @@ func (c *DBChat) UnmarshalBinary(data []byte) error {
 }
 
 type DBMessage struct {
-	Seq         int64          `msgpack:"seq"`
-	Timestamp   int64          `msgpack:"timestamp"`
-	ChatID      string         `msgpack:"chatId"`
-	UserID      string         `msgpack:"userId"`
-	Content     string         `msgpack:"content"`
-	Attachments []DBAttachment `msgpack:"attachments"`
+	Seq         int64           `msgpack:"seq"`
+	Timestamp   int64           `msgpack:"timestamp"`
+	ChatID      string          `msgpack:"chatId"`
+	UserID      string          `msgpack:"userId"`
+	Content     string          `msgpack:"content"`
+	Attachments []DBAttachment  `msgpack:"attachments"`
+	EditedAt    int64           `msgpack:"editedAt"`
+	Revisions   []DBRevision    `msgpack:"revisions"`
+	Deleted     bool            `msgpack:"deleted"`
+	Reactions   []DBReaction    `msgpack:"reactions"`
+	ReplyTo     *DBReplyRef     `msgpack:"replyTo"`
+	Previews    []DBLinkPreview `msgpack:"previews"`
+	Sender      *DBSender       `msgpack:"sender"`
+	// ExpiresAt is set on messages sent while disappearing messages were on.
+	ExpiresAt int64 `msgpack:"expiresAt,omitempty"`
+	// DisappearAfter is set on the announcement of a timer change.
+	DisappearAfter *int64 `msgpack:"disappearAfter,omitempty"`
+}
+
+type DBSender struct {
+	Name     string `msgpack:"name"`
+	AvatarID string `msgpack:"avatarId"`
+}
+
+type DBLinkPreview struct {
+	URL         string `msgpack:"url"`
+	Title       string `msgpack:"title"`
+	Description string `msgpack:"description"`
+	SiteName    string `msgpack:"siteName"`
+	ImageID     string `msgpack:"imageId"`
+	// FetchedAt is only set on cached previews, see GetLinkPreview.
+	FetchedAt int64 `msgpack:"fetchedAt,omitempty"`
+}
+
+func (p *DBLinkPreview) MarshalBinary() (data []byte, err error) {
+	type alias DBLinkPreview
+	return msgpack.Marshal((*alias)(p))
+}
+
+func (p *DBLinkPreview) UnmarshalBinary(data []byte) error {
+	type alias DBLinkPreview
+	return msgpack.Unmarshal(data, (*alias)(p))
+}
+
+type DBSlashCommand struct {
+	Name        string `msgpack:"name"`
+	BotID       string `msgpack:"botId"`
+	Description string `msgpack:"description"`
+}
+
+func (c *DBSlashCommand) MarshalBinary() (data []byte, err error) {
+	type alias DBSlashCommand
+	return msgpack.Marshal((*alias)(c))
+}
+
+func (c *DBSlashCommand) UnmarshalBinary(data []byte) error {
+	type alias DBSlashCommand
+	return msgpack.Unmarshal(data, (*alias)(c))
+}
+
+type DBReplyRef struct {
+	ChatID string `msgpack:"chatId"`
+	Seq    int64  `msgpack:"seq"`
+}
+
+type DBReaction struct {
+	Emoji   string   `msgpack:"emoji"`
+	UserIDs []string `msgpack:"userIds"`
+}
+
+type DBRevision struct {
+	Content   string `msgpack:"content"`
+	Timestamp int64  `msgpack:"timestamp"`
 }
 
 type DBAttachment struct {
@@ -281,3 +387,70 @@ func (c *DBPasskeyCredential) UnmarshalBinary(data []byte) error {
 	type alias DBPasskeyCredential
 	return msgpack.Unmarshal(data, (*alias)(c))
 }
+
+type DBAdmin struct {
+	ID                  string `msgpack:"id"`
+	UserName            string `msgpack:"userName"`
+	PasswordHash        string `msgpack:"passwordHash"`
+	TOTPSecret          string `msgpack:"totpSecret"`
+	LastTOTP            int    `msgpack:"lastTOTP"`
+	CreatedAt           int64  `msgpack:"createdAt"`
+	CreatedBy           string `msgpack:"createdBy,omitempty"`
+	FailedLoginAttempts int64  `msgpack:"failedLoginAttempts,omitempty"`
+	LastAttemptTime     int64  `msgpack:"lastAttemptTime,omitempty"`
+}
+
+func (a *DBAdmin) Key() []byte {
+	return []byte(a.ID)
+}
+
+func (a *DBAdmin) MarshalBinary() (data []byte, err error) {
+	type alias DBAdmin
+	return msgpack.Marshal((*alias)(a))
+}
+
+func (a *DBAdmin) UnmarshalBinary(data []byte) error {
+	type alias DBAdmin
+	return msgpack.Unmarshal(data, (*alias)(a))
+}
+
+type DBAdminToken struct {
+	TokenHash string `msgpack:"tokenHash"`
+	AdminID   string `msgpack:"adminId"`
+	CreatedAt int64  `msgpack:"createdAt"`
+	ExpiresAt int64  `msgpack:"expiresAt"`
+	IP        string `msgpack:"ip,omitempty"`
+}
+
+func (t *DBAdminToken) Key() []byte {
+	return []byte(t.TokenHash)
+}
+
+func (t *DBAdminToken) MarshalBinary() (data []byte, err error) {
+	type alias DBAdminToken
+	return msgpack.Marshal((*alias)(t))
+}
+
+func (t *DBAdminToken) UnmarshalBinary(data []byte) error {
+	type alias DBAdminToken
+	return msgpack.Unmarshal(data, (*alias)(t))
+}
+
+type DBAdminAuditEntry struct {
+	Time      int64  `msgpack:"time"`
+	AdminID   string `msgpack:"adminId"`
+	AdminName string `msgpack:"adminName"`
+	Action    string `msgpack:"action"`
+	Status    int    `msgpack:"status"`
+	IP        string `msgpack:"ip,omitempty"`
+}
+
+func (e *DBAdminAuditEntry) MarshalBinary() (data []byte, err error) {
+	type alias DBAdminAuditEntry
+	return msgpack.Marshal((*alias)(e))
+}
+
+func (e *DBAdminAuditEntry) UnmarshalBinary(data []byte) error {
+	type alias DBAdminAuditEntry
+	return msgpack.Unmarshal(data, (*alias)(e))
+}
@@ -0,0 +1,402 @@
+// Package unfurl builds link previews from OpenGraph and Twitter card metadata.
+//
+// Pages are fetched with a hardened HTTP client: requests time out, response
+// bodies are size-limited, only http and https are followed, and connections
+// to loopback, private and other non-public addresses are refused at dial
+// time, so redirects and DNS answers cannot be used to reach internal services.
+// NewClient and Download expose the same protections to other packages.
+package unfurl
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+	"unicode/utf8"
+
+	"besedka/internal/images"
+	"besedka/internal/models"
+	"besedka/internal/storage"
+
+	"github.com/google/uuid"
+	"github.com/h2non/filetype"
+	"golang.org/x/net/html"
+)
+
+const (
+	maxRedirects      = 3
+	maxTitleRunes     = 200
+	maxDescRunes      = 300
+	maxSiteNameRunes  = 100
+	maxHeaderBytes    = 64 << 10
+	userAgent         = "Mozilla/5.0 (compatible; BesedkaBot/1.0; link preview)"
+	failedFetchMaxAge = time.Hour
+)
+
+var (
+	ErrBlockedAddress = errors.New("address is not publicly routable")
+	ErrNoPreview      = errors.New("page has no preview metadata")
+	ErrTooLarge       = errors.New("response too large")
+)
+
+// Non-public ranges not covered by the netip.Addr predicates.
+var blockedPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("240.0.0.0/4"),
+	netip.MustParsePrefix("64:ff9b::/96"),
+	netip.MustParsePrefix("2002::/16"),
+}
+
+type Config struct {
+	Timeout      time.Duration // Per request, including redirects and reading the body
+	MaxPageSize  int64         // Bytes of HTML read looking for metadata
+	MaxImageSize int64         // Larger preview images are skipped
+	CacheTTL     time.Duration // How long successful previews are reused
+	// AllowPrivate disables blocking of non-public addresses. Only for tests.
+	AllowPrivate bool
+}
+
+func (c Config) withDefaults() Config {
+	if c.Timeout <= 0 {
+		c.Timeout = 5 * time.Second
+	}
+	if c.MaxPageSize <= 0 {
+		c.MaxPageSize = 512 << 10
+	}
+	if c.MaxImageSize <= 0 {
+		c.MaxImageSize = 5 << 20
+	}
+	if c.CacheTTL <= 0 {
+		c.CacheTTL = 24 * time.Hour
+	}
+	return c
+}
+
+// Unfurler fetches link previews and caches them in storage. Preview images
+// are stored as regular files with thumbnails.
+type Unfurler struct {
+	store  *storage.BboltStorage
+	client *http.Client
+	cfg    Config
+}
+
+func New(store *storage.BboltStorage, cfg Config) *Unfurler {
+	cfg = cfg.withDefaults()
+	return &Unfurler{
+		store:  store,
+		cfg:    cfg,
+		client: NewClient(cfg.Timeout, cfg.AllowPrivate),
+	}
+}
+
+// NewClient returns an HTTP client with the protections described in the
+// package documentation, for other fetches of user-supplied URLs.
+// allowPrivate disables blocking of non-public addresses and is only for tests.
+func NewClient(timeout time.Duration, allowPrivate bool) *http.Client {
+	dialer := &net.Dialer{Timeout: timeout}
+	if !allowPrivate {
+		dialer.Control = func(_, address string, _ syscall.RawConn) error {
+			return checkAddress(address)
+		}
+	}
+
+	transport := &http.Transport{
+		Proxy:                  nil, // A proxy would bypass the address check.
+		DialContext:            dialer.DialContext,
+		TLSHandshakeTimeout:    timeout,
+		ResponseHeaderTimeout:  timeout,
+		MaxResponseHeaderBytes: maxHeaderBytes,
+		MaxIdleConns:           10,
+		IdleConnTimeout:        30 * time.Second,
+	}
+
+	return &http.Client{
+		Transport: transport,
+		Timeout:   timeout,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= maxRedirects {
+				return errors.New("too many redirects")
+			}
+			return checkScheme(req.URL)
+		},
+	}
+}
+
+// Download GETs rawURL with client, which should come from NewClient, and
+// returns the body. Bodies over maxBytes are an error.
+func Download(ctx context.Context, client *http.Client, rawURL string, maxBytes int64) ([]byte, error) {
+	body, _, err := fetch(ctx, client, rawURL, "", maxBytes, true)
+	return body, err
+}
+
+// Unfurl returns a preview for rawURL. Results, including failures, are cached.
+// It returns ErrNoPreview if the page has no usable metadata.
+func (u *Unfurler) Unfurl(ctx context.Context, rawURL string) (models.LinkPreview, error) {
+	now := time.Now()
+	if p, fetchedAt, err := u.store.GetLinkPreview(rawURL); err == nil {
+		age := now.Sub(time.Unix(fetchedAt, 0))
+		empty := p.Title == "" && p.ImageID == ""
+		switch {
+		case !empty && age < u.cfg.CacheTTL:
+			return p, nil
+		case empty && age < failedFetchMaxAge:
+			return models.LinkPreview{}, ErrNoPreview
+		}
+	} else if !errors.Is(err, models.ErrNotFound) {
+		return models.LinkPreview{}, err
+	}
+
+	p, err := u.fetchPreview(ctx, rawURL)
+	if err != nil && ctx.Err() != nil {
+		// Don't cache failures caused by the caller giving up.
+		return models.LinkPreview{}, err
+	}
+	if err != nil {
+		slog.Debug("link preview fetch failed", "url", rawURL, "error", err)
+		p = models.LinkPreview{URL: rawURL}
+	}
+	if cacheErr := u.store.PutLinkPreview(p, now.Unix()); cacheErr != nil {
+		slog.Warn("failed to cache link preview", "error", cacheErr)
+	}
+	if p.Title == "" && p.ImageID == "" {
+		return models.LinkPreview{}, ErrNoPreview
+	}
+	return p, nil
+}
+
+func (u *Unfurler) fetchPreview(ctx context.Context, rawURL string) (models.LinkPreview, error) {
+	body, finalURL, err := fetch(ctx, u.client, rawURL, "text/html", u.cfg.MaxPageSize, false)
+	if err != nil {
+		return models.LinkPreview{}, err
+	}
+
+	meta := parseMeta(body)
+	p := models.LinkPreview{
+		URL:         rawURL,
+		Title:       clean(firstOf(meta["og:title"], meta["twitter:title"], meta["title"]), maxTitleRunes),
+		Description: clean(firstOf(meta["og:description"], meta["twitter:description"], meta["description"]), maxDescRunes),
+		SiteName:    clean(meta["og:site_name"], maxSiteNameRunes),
+	}
+
+	if image := firstOf(meta["og:image:secure_url"], meta["og:image"], meta["twitter:image"], meta["twitter:image:src"]); image != "" {
+		if imageURL, err := finalURL.Parse(image); err == nil {
+			id, err := u.saveImage(ctx, imageURL.String())
+			if err != nil {
+				slog.Debug("link preview image skipped", "url", imageURL.String(), "error", err)
+			}
+			p.ImageID = id
+		}
+	}
+	return p, nil
+}
+
+// saveImage downloads an image and stores it like an uploaded one, returning the file ID.
+func (u *Unfurler) saveImage(ctx context.Context, imageURL string) (string, error) {
+	data, _, err := fetch(ctx, u.client, imageURL, "image/", u.cfg.MaxImageSize, true)
+	if err != nil {
+		return "", err
+	}
+	// SVG is not detected by filetype and is rejected on purpose: it can carry scripts.
+	kind, err := filetype.Match(data)
+	if err != nil || !filetype.IsImage(data) {
+		return "", errors.New("not an image")
+	}
+
+	hasher := sha256.New()
+	hasher.Write(data)
+	hash := hex.EncodeToString(hasher.Sum(nil))
+
+	if err := u.store.SaveFileBlob(bytes.NewReader(data), hash); err != nil {
+		return "", fmt.Errorf("failed to save image blob: %w", err)
+	}
+
+	meta := storage.FileMetadata{
+		ID:        uuid.NewString(),
+		Hash:      hash,
+		MimeType:  kind.MIME.Value,
+		Size:      int64(len(data)),
+		CreatedAt: time.Now().Unix(),
+	}
+	if _, err := images.AttachThumbnail(u.store, &meta, data); err != nil {
+		slog.Warn("thumbnail generation failed", "fileID", meta.ID, "error", err)
+	}
+	if err := u.store.UpsertFileMetadata(meta); err != nil {
+		return "", fmt.Errorf("failed to save image metadata: %w", err)
+	}
+	return meta.ID, nil
+}
+
+// fetch GETs rawURL and returns at most maxBytes of the body, along with the
+// URL after redirects. The response Content-Type must start with typePrefix.
+// If strict is set, bodies over maxBytes are an error instead of being truncated.
+func fetch(ctx context.Context, client *http.Client, rawURL, typePrefix string, maxBytes int64, strict bool) ([]byte, *url.URL, error) {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := checkScheme(parsed); err != nil {
+		return nil, nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, parsed.String(), nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	req.Header.Set("User-Agent", userAgent)
+	switch typePrefix {
+	case "":
+		req.Header.Set("Accept", "*/*")
+	case "text/html":
+		req.Header.Set("Accept", "text/html,application/xhtml+xml")
+	default:
+		req.Header.Set("Accept", typePrefix+"*")
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, nil, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	if resp.ContentLength > maxBytes && strict {
+		return nil, nil, ErrTooLarge
+	}
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if !strings.HasPrefix(mediaType, typePrefix) && !(typePrefix == "text/html" && mediaType == "application/xhtml+xml") {
+		return nil, nil, fmt.Errorf("unexpected content type %q", mediaType)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxBytes+1))
+	if err != nil {
+		return nil, nil, err
+	}
+	if int64(len(body)) > maxBytes {
+		if strict {
+			return nil, nil, ErrTooLarge
+		}
+		body = body[:maxBytes]
+	}
+	return body, resp.Request.URL, nil
+}
+
+func checkScheme(u *url.URL) error {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("unsupported scheme %q", u.Scheme)
+	}
+	if u.Hostname() == "" {
+		return errors.New("missing host")
+	}
+	return nil
+}
+
+// checkAddress refuses connections to addresses that are not publicly routable.
+func checkAddress(address string) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip, err := netip.ParseAddr(host)
+	if err != nil {
+		return err
+	}
+	ip = ip.Unmap()
+	if !ip.IsGlobalUnicast() || ip.IsPrivate() {
+		return ErrBlockedAddress
+	}
+	for _, p := range blockedPrefixes {
+		if p.Contains(ip) {
+			return ErrBlockedAddress
+		}
+	}
+	return nil
+}
+
+// parseMeta collects <meta> properties and the <title> of an HTML document's head.
+// Keys are lowercased; the first value for a key wins.
+func parseMeta(body []byte) map[string]string {
+	meta := make(map[string]string)
+	z := html.NewTokenizer(bytes.NewReader(body))
+	inTitle := false
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			return meta
+		case html.StartTagToken, html.SelfClosingTagToken:
+			name, hasAttr := z.TagName()
+			switch string(name) {
+			case "body":
+				return meta
+			case "title":
+				inTitle = true
+			case "meta":
+				var key, value string
+				for hasAttr {
+					var k, v []byte
+					k, v, hasAttr = z.TagAttr()
+					switch string(k) {
+					case "property", "name":
+						if key == "" {
+							key = strings.ToLower(string(v))
+						}
+					case "content":
+						value = string(v)
+					}
+				}
+				if _, ok := meta[key]; key != "" && !ok {
+					meta[key] = value
+				}
+			}
+		case html.TextToken:
+			if inTitle {
+				if _, ok := meta["title"]; !ok {
+					meta["title"] = string(z.Text())
+				}
+			}
+		case html.EndTagToken:
+			if name, _ := z.TagName(); string(name) == "title" {
+				inTitle = false
+			} else if string(name) == "head" {
+				return meta
+			}
+		}
+	}
+}
+
+func firstOf(values ...string) string {
+	for _, v := range values {
+		if strings.TrimSpace(v) != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// clean collapses whitespace and truncates s to maxRunes.
+func clean(s string, maxRunes int) string {
+	s = strings.Join(strings.Fields(s), " ")
+	if !utf8.ValidString(s) {
+		s = strings.ToValidUTF8(s, "")
+	}
+	if utf8.RuneCountInString(s) <= maxRunes {
+		return s
+	}
+	return string([]rune(s)[:maxRunes-1]) + "…"
+}
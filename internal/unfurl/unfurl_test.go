@@ -0,0 +1,174 @@
+package unfurl
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"besedka/internal/filestore"
+	"besedka/internal/storage"
+)
+
+const testPage = `<!doctype html>
+<html><head>
+<title>Fallback title</title>
+<meta property="og:title" content="  The   Title ">
+<meta property="og:description" content="A &amp; B">
+<meta property="og:site_name" content="Example">
+<meta property="og:image" content="/img.png">
+</head><body><meta property="og:title" content="ignored"></body></html>`
+
+func newTestStore(t *testing.T) *storage.BboltStorage {
+	t.Helper()
+	dir := t.TempDir()
+	fs, err := filestore.NewLocalFileStore(filepath.Join(dir, "fs"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	store, err := storage.NewBboltStorage(filepath.Join(dir, "test.db"), []byte("secret"), fs)
+	if err != nil {
+		t.Fatalf("failed to create storage: %v", err)
+	}
+	t.Cleanup(func() { _ = store.Close() })
+	return store
+}
+
+func newTestServer(t *testing.T, hits *atomic.Int32) *httptest.Server {
+	t.Helper()
+	var img bytes.Buffer
+	if err := png.Encode(&img, image.NewRGBA(image.Rect(0, 0, 4, 4))); err != nil {
+		t.Fatal(err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/page", func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		_, _ = w.Write([]byte(testPage))
+	})
+	mux.HandleFunc("/img.png", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+		_, _ = w.Write(img.Bytes())
+	})
+	mux.HandleFunc("/plain", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		_, _ = w.Write([]byte("<html><body>no metadata</body></html>"))
+	})
+	mux.HandleFunc("/huge", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		_, _ = w.Write([]byte("<html><head>" + strings.Repeat(" ", 4096) + `<meta property="og:title" content="too late"></head></html>`))
+	})
+	mux.HandleFunc("/redirect", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/page", http.StatusFound)
+	})
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestUnfurl(t *testing.T) {
+	store := newTestStore(t)
+	var hits atomic.Int32
+	srv := newTestServer(t, &hits)
+	u := New(store, Config{AllowPrivate: true, MaxPageSize: 1024})
+	ctx := context.Background()
+
+	p, err := u.Unfurl(ctx, srv.URL+"/page")
+	if err != nil {
+		t.Fatalf("Unfurl failed: %v", err)
+	}
+	if p.URL != srv.URL+"/page" || p.Title != "The Title" || p.Description != "A & B" || p.SiteName != "Example" {
+		t.Errorf("unexpected preview: %+v", p)
+	}
+	if p.ImageID == "" {
+		t.Fatal("expected preview image")
+	}
+	meta, err := store.GetFileMetadata(p.ImageID)
+	if err != nil || meta.MimeType != "image/png" {
+		t.Errorf("expected stored png image, got %+v, %v", meta, err)
+	}
+
+	// Second call is served from the cache.
+	if _, err := u.Unfurl(ctx, srv.URL+"/page"); err != nil {
+		t.Fatalf("Unfurl failed: %v", err)
+	}
+	if n := hits.Load(); n != 1 {
+		t.Errorf("expected 1 fetch, got %d", n)
+	}
+
+	if p, err := u.Unfurl(ctx, srv.URL+"/redirect"); err != nil || p.Title != "The Title" {
+		t.Errorf("expected redirect to be followed, got %+v, %v", p, err)
+	}
+	if _, err := u.Unfurl(ctx, srv.URL+"/plain"); !errors.Is(err, ErrNoPreview) {
+		t.Errorf("expected ErrNoPreview, got %v", err)
+	}
+	// Only MaxPageSize bytes are parsed.
+	if _, err := u.Unfurl(ctx, srv.URL+"/huge"); !errors.Is(err, ErrNoPreview) {
+		t.Errorf("expected ErrNoPreview for metadata past the size limit, got %v", err)
+	}
+	if _, err := u.Unfurl(ctx, "ftp://example.com/"); !errors.Is(err, ErrNoPreview) {
+		t.Errorf("expected ErrNoPreview for unsupported scheme, got %v", err)
+	}
+}
+
+func TestUnfurl_BlocksPrivateAddresses(t *testing.T) {
+	store := newTestStore(t)
+	var hits atomic.Int32
+	srv := newTestServer(t, &hits)
+	u := New(store, Config{})
+
+	if _, err := u.Unfurl(context.Background(), srv.URL+"/page"); !errors.Is(err, ErrNoPreview) {
+		t.Errorf("expected ErrNoPreview, got %v", err)
+	}
+	if n := hits.Load(); n != 0 {
+		t.Errorf("expected no requests to reach a loopback server, got %d", n)
+	}
+	if _, err := Download(context.Background(), u.client, srv.URL+"/page", 1024); !errors.Is(err, ErrBlockedAddress) {
+		t.Errorf("expected ErrBlockedAddress, got %v", err)
+	}
+}
+
+func TestCheckAddress(t *testing.T) {
+	tests := []struct {
+		addr    string
+		blocked bool
+	}{
+		{"127.0.0.1:80", true},
+		{"10.1.2.3:443", true},
+		{"172.16.0.1:443", true},
+		{"192.168.1.1:80", true},
+		{"169.254.169.254:80", true},
+		{"100.64.0.1:80", true},
+		{"0.0.0.0:80", true},
+		{"[::1]:80", true},
+		{"[fe80::1]:80", true},
+		{"[fd00::1]:80", true},
+		{"[::ffff:127.0.0.1]:80", true},
+		{"93.184.216.34:443", false},
+		{"[2606:2800:220:1:248:1893:25c8:1946]:443", false},
+	}
+	for _, tt := range tests {
+		err := checkAddress(tt.addr)
+		if blocked := errors.Is(err, ErrBlockedAddress); blocked != tt.blocked {
+			t.Errorf("checkAddress(%s) = %v, want blocked=%v", tt.addr, err, tt.blocked)
+		}
+	}
+}
+
+func TestParseMeta(t *testing.T) {
+	meta := parseMeta([]byte(testPage))
+	if meta["og:title"] != "  The   Title " || meta["title"] != "Fallback title" {
+		t.Errorf("unexpected meta: %v", meta)
+	}
+	if got := clean(strings.Repeat("a", 10), 5); got != "aaaa…" {
+		t.Errorf("clean() = %q", got)
+	}
+}
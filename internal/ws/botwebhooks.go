@@ -0,0 +1,51 @@
+package ws
+
+import (
+	"besedka/internal/chat"
+	"besedka/internal/content"
+	"besedka/internal/models"
+)
+
+// BotNotifier delivers new messages and slash command invocations to bots
+// that receive them over HTTP instead of holding a WebSocket open.
+// NotifyCommand reports whether the bot receives events over HTTP.
+type BotNotifier interface {
+	NotifyBot(botID string, msg models.Message)
+	NotifyCommand(botID string, inv models.CommandInvocation) bool
+}
+
+// SetBotNotifier enables outgoing bot webhooks. It must be called before the
+// hub serves clients.
+func (h *Hub) SetBotNotifier(n BotNotifier) {
+	h.botNotifier = n
+}
+
+// notifyBot hands a new record to the bot notifier if receiverID is a bot
+// allowed to see it. The notifier decides whether the bot has a callback.
+func (h *Hub) notifyBot(receiverID, chatID string, record chat.ChatRecord) {
+	bot, err := h.userProvider.GetUser(receiverID)
+	if err != nil || bot.Type != models.UserTypeBot {
+		return
+	}
+	if !models.IsMessageVisible(chatID, content.ExtractMentions(record.Content), bot) {
+		return
+	}
+
+	h.mu.RLock()
+	c, ok := h.chats[chatID]
+	h.mu.RUnlock()
+
+	var messages []models.Message
+	if ok {
+		messages = h.messagesFor(c, []chat.ChatRecord{record})
+	} else {
+		messages = mapRecordsToMessages([]chat.ChatRecord{record})
+	}
+	if !models.IsReplyPreviewVisible(chatID, bot) {
+		messages = stripReplyPreviews(messages)
+	}
+	for _, m := range messages {
+		m.ChatID = chatID
+		h.botNotifier.NotifyBot(bot.ID, m)
+	}
+}
@@ -0,0 +1,63 @@
+package ws
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"besedka/internal/models"
+)
+
+type fakeBotNotifier struct {
+	mu        sync.Mutex
+	messages  map[string][]models.Message
+	commands  map[string][]models.CommandInvocation
+	callbacks map[string]bool // Bots that have a callback URL
+}
+
+func (f *fakeBotNotifier) NotifyBot(botID string, msg models.Message) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.messages[botID] = append(f.messages[botID], msg)
+}
+
+func (f *fakeBotNotifier) NotifyCommand(botID string, inv models.CommandInvocation) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if !f.callbacks[botID] {
+		return false
+	}
+	f.commands[botID] = append(f.commands[botID], inv)
+	return true
+}
+
+func TestHub_BotNotifier(t *testing.T) {
+	human := models.User{ID: "u1", UserName: "alice", Type: models.UserTypeHuman}
+	allBot := models.User{ID: "b1", UserName: "allbot", Type: models.UserTypeBot, BotPermissions: models.BotPermissions{ReadAll: true, Write: true}}
+	mentionBot := models.User{ID: "b2", UserName: "mentionbot", Type: models.UserTypeBot, BotPermissions: models.BotPermissions{ReadMentions: true, Write: true}}
+	provider := &MockUserProvider{users: []models.User{human, allBot, mentionBot}}
+	h := NewHub(context.Background(), provider, NewMockStorage(), &MockPushService{})
+	notifier := &fakeBotNotifier{messages: make(map[string][]models.Message)}
+	h.SetBotNotifier(notifier)
+
+	ch := h.Join(human.ID)
+	drainMessages(ch, 1)
+
+	for _, text := range []string{"hello everyone", "hi @mentionbot"} {
+		h.Dispatch(human.ID, models.ClientMessage{Type: models.ClientMessageTypeSend, ChatID: "townhall", Content: text}, ch)
+	}
+	// Bots are not notified of their own messages.
+	h.Dispatch(allBot.ID, models.ClientMessage{Type: models.ClientMessageTypeSend, ChatID: "townhall", Content: "from the bot"}, nil)
+
+	notifier.mu.Lock()
+	defer notifier.mu.Unlock()
+	if got := notifier.messages["b1"]; len(got) != 2 || got[0].ChatID != "townhall" || got[1].Seq != 2 {
+		t.Errorf("expected read-all bot to get both human messages, got %+v", got)
+	}
+	if got := notifier.messages["b2"]; len(got) != 1 || got[0].Seq != 2 {
+		t.Errorf("expected mention bot to get only the mention, got %+v", got)
+	}
+	if got := notifier.messages["u1"]; len(got) != 0 {
+		t.Errorf("humans must not be notified, got %+v", got)
+	}
+}
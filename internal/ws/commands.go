@@ -0,0 +1,241 @@
+package ws
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+	"unicode"
+
+	"besedka/internal/chat"
+	"besedka/internal/content"
+	"besedka/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// commandReplyTTL is how long a bot can reply to a command invocation.
+const commandReplyTTL = 15 * time.Minute
+
+var (
+	commandNameRegex = regexp.MustCompile(`^[a-z0-9_-]{1,32}$`)
+
+	ErrInvalidCommand  = errors.New("command names must be 1-32 lowercase letters, digits, '-' or '_'")
+	ErrCannotPostReply = errors.New("bot cannot post in this chat")
+)
+
+// CommandStore persists the slash command registry.
+type CommandStore interface {
+	ListSlashCommands() ([]models.SlashCommand, error)
+	UpsertSlashCommand(cmd models.SlashCommand) error
+	DeleteSlashCommand(name string) error
+}
+
+// SetCommandStore enables slash commands and loads the registered ones. It
+// must be called before the hub serves clients.
+func (h *Hub) SetCommandStore(store CommandStore) error {
+	commands, err := store.ListSlashCommands()
+	if err != nil {
+		return fmt.Errorf("failed to load slash commands: %w", err)
+	}
+	h.commandsMu.Lock()
+	defer h.commandsMu.Unlock()
+	h.commandStore = store
+	h.commands = make(map[string]models.SlashCommand, len(commands))
+	for _, cmd := range commands {
+		h.commands[cmd.Name] = cmd
+	}
+	return nil
+}
+
+// RegisterCommand routes /cmd.Name to the bot cmd.BotID, replacing any
+// existing command with that name.
+func (h *Hub) RegisterCommand(cmd models.SlashCommand) error {
+	cmd.Name = strings.TrimPrefix(cmd.Name, "/")
+	if !commandNameRegex.MatchString(cmd.Name) {
+		return ErrInvalidCommand
+	}
+	bot, err := h.userProvider.GetUser(cmd.BotID)
+	if err != nil || bot.Type != models.UserTypeBot || bot.Status == models.UserStatusDeleted {
+		return models.ErrNotFound
+	}
+	cmd.Description = content.Sanitize(cmd.Description)
+
+	h.commandsMu.Lock()
+	defer h.commandsMu.Unlock()
+	if h.commandStore == nil {
+		return errors.New("slash commands are not enabled")
+	}
+	if err := h.commandStore.UpsertSlashCommand(cmd); err != nil {
+		return fmt.Errorf("failed to persist slash command: %w", err)
+	}
+	h.commands[cmd.Name] = cmd
+	return nil
+}
+
+// UnregisterCommand removes a slash command. Pending invocations can still be
+// replied to until they expire.
+func (h *Hub) UnregisterCommand(name string) error {
+	name = strings.TrimPrefix(name, "/")
+
+	h.commandsMu.Lock()
+	defer h.commandsMu.Unlock()
+	if _, ok := h.commands[name]; !ok {
+		return models.ErrNotFound
+	}
+	if err := h.commandStore.DeleteSlashCommand(name); err != nil {
+		return fmt.Errorf("failed to delete slash command: %w", err)
+	}
+	delete(h.commands, name)
+	return nil
+}
+
+// ListCommands returns the registered slash commands sorted by name.
+func (h *Hub) ListCommands() []models.SlashCommand {
+	h.commandsMu.RLock()
+	defer h.commandsMu.RUnlock()
+	commands := make([]models.SlashCommand, 0, len(h.commands))
+	for _, cmd := range h.commands {
+		commands = append(commands, cmd)
+	}
+	slices.SortFunc(commands, func(a, b models.SlashCommand) int { return strings.Compare(a.Name, b.Name) })
+	return commands
+}
+
+// parseCommand splits "/name args" into its parts.
+func parseCommand(text string) (string, string, bool) {
+	if !strings.HasPrefix(text, "/") {
+		return "", "", false
+	}
+	name, args := text[1:], ""
+	if i := strings.IndexFunc(name, unicode.IsSpace); i >= 0 {
+		name, args = name[:i], name[i:]
+	}
+	return strings.ToLower(name), strings.TrimSpace(args), true
+}
+
+// routeCommand hands a message starting with a registered slash command to its
+// bot instead of posting it, attachments included. It reports whether the
+// message was a command. Only people run commands, so bots can't trigger each
+// other in a loop. A command whose bot may not read the chat is posted as an
+// ordinary message instead, so the chat's data never reaches the bot.
+func (h *Hub) routeCommand(userID string, c *chat.Chat, text string, attachments []models.Attachment) bool {
+	name, args, ok := parseCommand(text)
+	if !ok {
+		return false
+	}
+	h.commandsMu.RLock()
+	cmd, ok := h.commands[name]
+	h.commandsMu.RUnlock()
+	if !ok {
+		return false
+	}
+	if u, err := h.userProvider.GetUser(userID); err != nil || u.Type == models.UserTypeBot || u.Type == models.UserTypeWebhook {
+		return false
+	}
+	if !h.botCanReceiveCommand(cmd.BotID, c) {
+		return false
+	}
+
+	chatID := c.ID
+	inv := models.CommandInvocation{
+		ID:          uuid.NewString(),
+		Command:     cmd.Name,
+		Args:        args,
+		ChatID:      chatID,
+		UserID:      userID,
+		Timestamp:   time.Now().Unix(),
+		Attachments: attachments,
+	}
+	h.invocations.Set(inv.ID, pendingCommand{invocation: inv, botID: cmd.BotID})
+
+	delivered := false
+	if h.botNotifier != nil && h.botNotifier.NotifyCommand(cmd.BotID, inv) {
+		delivered = true
+	}
+	if h.IsUserOnline(cmd.BotID) {
+		h.sendToUser(cmd.BotID, models.ServerMessage{
+			Type:    models.ServerMessageTypeCommand,
+			ChatID:  chatID,
+			Command: &inv,
+		})
+		delivered = true
+	}
+	if !delivered {
+		slog.Info("slash command bot is unreachable", "command", cmd.Name, "botID", cmd.BotID)
+		h.sendEphemeral(userID, chatID, cmd.BotID, fmt.Sprintf("/%s is not available right now.", cmd.Name))
+	}
+	return true
+}
+
+// botCanReceiveCommand reports whether botID may be sent a command run in c:
+// the bot must have access to the chat and, if it is restricted to scoped
+// chats, a scope for it.
+func (h *Hub) botCanReceiveCommand(botID string, c *chat.Chat) bool {
+	bot, err := h.userProvider.GetUser(botID)
+	if err != nil || bot.Type != models.UserTypeBot || bot.Status == models.UserStatusDeleted {
+		return false
+	}
+	if !canAccess(botID, c) {
+		return false
+	}
+	return !bot.Scoped || slices.ContainsFunc(bot.Scopes, func(s models.ChatScope) bool { return s.ChatID == c.ID })
+}
+
+type pendingCommand struct {
+	invocation models.CommandInvocation
+	botID      string
+}
+
+// ReplyToCommand answers a pending command invocation. Ephemeral replies are
+// shown only to the user who ran the command and are not stored; public
+// replies are posted to the chat as the bot.
+func (h *Hub) ReplyToCommand(botID, invocationID, text string, ephemeral bool) error {
+	pending, err := h.invocations.Get(invocationID)
+	if err != nil || pending.botID != botID {
+		return models.ErrNotFound
+	}
+	inv := pending.invocation
+
+	if ephemeral {
+		h.sendEphemeral(inv.UserID, inv.ChatID, botID, text)
+		return nil
+	}
+
+	bot, err := h.userProvider.GetUser(botID)
+	if err != nil {
+		return models.ErrNotFound
+	}
+	h.mu.RLock()
+	c, ok := h.chats[inv.ChatID]
+	h.mu.RUnlock()
+	if !ok || !canAccess(botID, c) || !models.CanPost(inv.ChatID, bot) {
+		return ErrCannotPostReply
+	}
+
+	h.Dispatch(botID, models.ClientMessage{
+		Type:    models.ClientMessageTypeSend,
+		ChatID:  inv.ChatID,
+		Content: text,
+	}, nil)
+	return nil
+}
+
+// sendEphemeral shows a message from fromID to userID only, without storing it.
+func (h *Hub) sendEphemeral(userID, chatID, fromID, text string) {
+	formatted := content.FormatMessage(text)
+	h.sendToUser(userID, models.ServerMessage{
+		Type:   models.ServerMessageTypeEphemeral,
+		ChatID: chatID,
+		Messages: []models.Message{{
+			ChatID:     chatID,
+			UserID:     fromID,
+			Content:    formatted,
+			RawContent: content.Sanitize(formatted),
+			Timestamp:  time.Now().Unix(),
+		}},
+	})
+}
@@ -0,0 +1,189 @@
+package ws
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"besedka/internal/models"
+)
+
+type memCommandStore struct {
+	commands map[string]models.SlashCommand
+}
+
+func (m *memCommandStore) ListSlashCommands() ([]models.SlashCommand, error) {
+	var commands []models.SlashCommand
+	for _, cmd := range m.commands {
+		commands = append(commands, cmd)
+	}
+	return commands, nil
+}
+
+func (m *memCommandStore) UpsertSlashCommand(cmd models.SlashCommand) error {
+	m.commands[cmd.Name] = cmd
+	return nil
+}
+
+func (m *memCommandStore) DeleteSlashCommand(name string) error {
+	delete(m.commands, name)
+	return nil
+}
+
+func TestParseCommand(t *testing.T) {
+	for text, want := range map[string][2]string{
+		"/weather":              {"weather", ""},
+		"/Weather  Berlin, DE ": {"weather", "Berlin, DE"},
+		"/poll\nlunch?":         {"poll", "lunch?"},
+	} {
+		name, args, ok := parseCommand(text)
+		if !ok || name != want[0] || args != want[1] {
+			t.Errorf("parseCommand(%q) = %q, %q, %v", text, name, args, ok)
+		}
+	}
+	if _, _, ok := parseCommand("no slash"); ok {
+		t.Error("expected plain text not to parse as a command")
+	}
+}
+
+func TestHub_SlashCommands(t *testing.T) {
+	human := models.User{ID: "u1", UserName: "alice", Type: models.UserTypeHuman}
+	wsBot := models.User{ID: "b1", UserName: "weatherbot", Type: models.UserTypeBot, BotPermissions: models.BotPermissions{Write: true}}
+	hookBot := models.User{ID: "b2", UserName: "pollbot", Type: models.UserTypeBot}
+	offlineBot := models.User{ID: "b3", UserName: "sleepybot", Type: models.UserTypeBot}
+	scopedBot := models.User{ID: "b4", UserName: "elsewherebot", Type: models.UserTypeBot, Scoped: true, Scopes: []models.ChatScope{{ChatID: "other"}}}
+	provider := &MockUserProvider{users: []models.User{human, wsBot, hookBot, offlineBot, scopedBot}}
+	store := NewMockStorage()
+	h := NewHub(context.Background(), provider, store, &MockPushService{})
+
+	cmdStore := &memCommandStore{commands: map[string]models.SlashCommand{
+		"weather": {Name: "weather", BotID: wsBot.ID},
+	}}
+	if err := h.SetCommandStore(cmdStore); err != nil {
+		t.Fatalf("SetCommandStore failed: %v", err)
+	}
+	notifier := &fakeBotNotifier{
+		messages:  make(map[string][]models.Message),
+		commands:  make(map[string][]models.CommandInvocation),
+		callbacks: map[string]bool{hookBot.ID: true},
+	}
+	h.SetBotNotifier(notifier)
+
+	if err := h.RegisterCommand(models.SlashCommand{Name: "/poll", BotID: hookBot.ID}); err != nil {
+		t.Fatalf("RegisterCommand failed: %v", err)
+	}
+	if err := h.RegisterCommand(models.SlashCommand{Name: "nap", BotID: offlineBot.ID}); err != nil {
+		t.Fatalf("RegisterCommand failed: %v", err)
+	}
+	if err := h.RegisterCommand(models.SlashCommand{Name: "elsewhere", BotID: scopedBot.ID}); err != nil {
+		t.Fatalf("RegisterCommand failed: %v", err)
+	}
+	if err := h.RegisterCommand(models.SlashCommand{Name: "Bad Name", BotID: wsBot.ID}); !errors.Is(err, ErrInvalidCommand) {
+		t.Errorf("expected ErrInvalidCommand, got %v", err)
+	}
+	if err := h.RegisterCommand(models.SlashCommand{Name: "human", BotID: human.ID}); !errors.Is(err, models.ErrNotFound) {
+		t.Errorf("expected ErrNotFound for a non-bot, got %v", err)
+	}
+	if got := h.ListCommands(); len(got) != 4 || got[0].Name != "elsewhere" || got[3].Name != "weather" {
+		t.Errorf("unexpected commands %+v", got)
+	}
+	if _, ok := cmdStore.commands["poll"]; !ok {
+		t.Error("expected registered command to be persisted")
+	}
+
+	humanCh := h.Join(human.ID)
+	botCh := h.Join(wsBot.ID)
+	drainMessages(humanCh, 1)
+	drainMessages(botCh, 1)
+
+	// A connected bot gets the invocation over its WebSocket and nothing is posted.
+	attachments := []models.Attachment{{Type: "image", Name: "sky.png", FileID: "f1"}}
+	store.files["f1"] = human.ID
+	h.Dispatch(human.ID, models.ClientMessage{Type: models.ClientMessageTypeSend, ChatID: "townhall", Content: "/weather Berlin", Attachments: attachments}, humanCh)
+	msg := expectChatEvent(t, botCh, models.ServerMessageTypeCommand, "townhall")
+	inv := msg.Command
+	if inv == nil || inv.Command != "weather" || inv.Args != "Berlin" || inv.UserID != human.ID {
+		t.Fatalf("unexpected invocation %+v", msg.Command)
+	}
+	if len(inv.Attachments) != 1 || inv.Attachments[0].FileID != "f1" {
+		t.Errorf("expected attachments to be forwarded, got %+v", inv.Attachments)
+	}
+	if len(store.messages["townhall"]) != 0 {
+		t.Fatalf("expected command not to be posted, got %+v", store.messages["townhall"])
+	}
+
+	// Ephemeral replies reach only the invoking user.
+	if err := h.ReplyToCommand(wsBot.ID, inv.ID, "Sunny, 21°C", true); err != nil {
+		t.Fatalf("ReplyToCommand failed: %v", err)
+	}
+	msg = expectChatEvent(t, humanCh, models.ServerMessageTypeEphemeral, "townhall")
+	if len(msg.Messages) != 1 || msg.Messages[0].UserID != wsBot.ID || !strings.Contains(msg.Messages[0].Content, "Sunny, 21°C") {
+		t.Errorf("unexpected ephemeral reply %+v", msg.Messages)
+	}
+	expectNoChatEvent(t, botCh, models.ServerMessageTypeEphemeral, "townhall", 50*time.Millisecond)
+	if len(store.messages["townhall"]) != 0 {
+		t.Fatal("expected ephemeral reply not to be stored")
+	}
+
+	// Public replies are posted as the bot.
+	if err := h.ReplyToCommand(wsBot.ID, inv.ID, "Sunny everywhere", false); err != nil {
+		t.Fatalf("ReplyToCommand failed: %v", err)
+	}
+	if got := store.messages["townhall"]; len(got) != 1 || got[0].UserID != wsBot.ID {
+		t.Fatalf("expected public reply from the bot, got %+v", got)
+	}
+	if err := h.ReplyToCommand(hookBot.ID, inv.ID, "not mine", true); !errors.Is(err, models.ErrNotFound) {
+		t.Errorf("expected ErrNotFound replying to another bot's invocation, got %v", err)
+	}
+
+	// Bots with a callback URL get the invocation as a webhook.
+	h.Dispatch(human.ID, models.ClientMessage{Type: models.ClientMessageTypeSend, ChatID: "townhall", Content: "/poll lunch?"}, humanCh)
+	notifier.mu.Lock()
+	polls := notifier.commands[hookBot.ID]
+	notifier.mu.Unlock()
+	if len(polls) != 1 || polls[0].Args != "lunch?" || polls[0].ChatID != "townhall" {
+		t.Fatalf("expected poll invocation via webhook, got %+v", polls)
+	}
+	// A bot without townhall write permission can't reply publicly there.
+	if err := h.ReplyToCommand(hookBot.ID, polls[0].ID, "Vote now", false); !errors.Is(err, ErrCannotPostReply) {
+		t.Errorf("expected ErrCannotPostReply, got %v", err)
+	}
+
+	// An unreachable bot results in an ephemeral notice.
+	h.Dispatch(human.ID, models.ClientMessage{Type: models.ClientMessageTypeSend, ChatID: "townhall", Content: "/nap"}, humanCh)
+	msg = expectChatEvent(t, humanCh, models.ServerMessageTypeEphemeral, "townhall")
+	if len(msg.Messages) != 1 || msg.Messages[0].UserID != offlineBot.ID {
+		t.Errorf("unexpected unavailable notice %+v", msg.Messages)
+	}
+
+	// Unknown commands, commands sent by bots and commands for bots that can't
+	// access the chat are posted as normal messages.
+	h.Dispatch(human.ID, models.ClientMessage{Type: models.ClientMessageTypeSend, ChatID: "townhall", Content: "/shrug"}, humanCh)
+	h.Dispatch(wsBot.ID, models.ClientMessage{Type: models.ClientMessageTypeSend, ChatID: "townhall", Content: "/poll again"}, botCh)
+	h.Dispatch(human.ID, models.ClientMessage{Type: models.ClientMessageTypeSend, ChatID: "townhall", Content: "/elsewhere hi"}, humanCh)
+	if got := store.messages["townhall"]; len(got) != 4 {
+		t.Fatalf("expected unknown, bot-sent and unroutable commands to be posted, got %+v", got)
+	}
+	notifier.mu.Lock()
+	if got := notifier.commands[scopedBot.ID]; len(got) != 0 {
+		t.Errorf("expected a bot without a scope for the chat not to get the command, got %+v", got)
+	}
+	notifier.mu.Unlock()
+	notifier.mu.Lock()
+	if got := notifier.commands[hookBot.ID]; len(got) != 1 {
+		t.Errorf("expected bots not to trigger commands, got %+v", got)
+	}
+	notifier.mu.Unlock()
+
+	if err := h.UnregisterCommand("poll"); err != nil {
+		t.Fatalf("UnregisterCommand failed: %v", err)
+	}
+	if err := h.UnregisterCommand("poll"); !errors.Is(err, models.ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+	if _, ok := cmdStore.commands["poll"]; ok {
+		t.Error("expected unregistered command to be deleted from the store")
+	}
+}
@@ -135,10 +135,17 @@ func (c *Connection) mainLoop(ctx context.Context) error {
 
 func (c *Connection) processClientMessage(msg models.ClientMessage) error {
 	switch msg.Type {
-	case models.ClientMessageTypeJoin, models.ClientMessageTypeSend, models.ClientMessageTypeFetch, models.ClientMessageTypeRead:
+	case models.ClientMessageTypeJoin, models.ClientMessageTypeSend, models.ClientMessageTypeFetch, models.ClientMessageTypeRead,
+		models.ClientMessageTypeEdit, models.ClientMessageTypeDelete,
+		models.ClientMessageTypeReact, models.ClientMessageTypeUnreact,
+		models.ClientMessageTypeTyping, models.ClientMessageTypeStopTyping,
+		models.ClientMessageTypePin, models.ClientMessageTypeUnpin:
 		c.hub.Dispatch(c.userID, msg, c.fromServer)
 	case models.ClientMessageTypeLocation:
 		c.hub.Dispatch(c.userID, msg, c.fromServer)
+	case models.ClientMessageTypeCreateGroup, models.ClientMessageTypeRenameGroup,
+		models.ClientMessageTypeAddMember, models.ClientMessageTypeRemoveMember:
+		c.hub.Dispatch(c.userID, msg, c.fromServer)
 	}
 
 	return nil
@@ -0,0 +1,93 @@
+package ws
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"besedka/internal/chat"
+	"besedka/internal/content"
+	"besedka/internal/models"
+)
+
+var (
+	ErrNotDM        = errors.New("disappearing messages can only be set in direct messages")
+	ErrInvalidTimer = errors.New("disappearing messages timer must be off, 1 hour, 1 day or 1 week")
+)
+
+// disappearingTimers names the disappearing messages timers users can pick, in
+// seconds.
+var disappearingTimers = map[int64]string{
+	int64(time.Hour / time.Second):          "1 hour",
+	int64(24 * time.Hour / time.Second):     "1 day",
+	int64(7 * 24 * time.Hour / time.Second): "1 week",
+}
+
+// SetDisappearingTimer sets the disappearing messages timer of a DM userID is
+// in, and announces the change in the chat. Messages sent from then on expire
+// after seconds; 0 turns the timer off. Messages already sent keep their
+// expiry. Setting the current timer again is a no-op.
+func (h *Hub) SetDisappearingTimer(userID, chatID string, seconds int64) error {
+	c, err := h.writableChat(userID, chatID)
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(c.ID, "dm_") {
+		return ErrNotDM
+	}
+	label, ok := disappearingTimers[seconds]
+	if !ok && seconds != 0 {
+		return ErrInvalidTimer
+	}
+
+	h.groupsMu.Lock()
+	if c.GetDisappearAfter() == seconds {
+		h.groupsMu.Unlock()
+		return nil
+	}
+	if err := h.storage.SetDisappearAfter(c.ID, seconds); err != nil {
+		h.groupsMu.Unlock()
+		return fmt.Errorf("failed to persist disappearing messages timer: %w", err)
+	}
+	c.SetDisappearAfter(seconds)
+	h.groupsMu.Unlock()
+
+	text := "turned off disappearing messages"
+	if seconds > 0 {
+		text = "set disappearing messages to " + label
+	}
+	_, err = c.AddRecord(chat.ChatRecord{
+		UserID:           userID,
+		Content:          text,
+		FormattedContent: content.FormatMessage(text),
+		Timestamp:        time.Now().Unix(),
+		DisappearAfter:   &seconds,
+	})
+	return err
+}
+
+// ExpireMessages drops disappearing messages that were deleted from storage
+// from memory, unpins them and tells the chat members to remove them.
+func (h *Hub) ExpireMessages(chatID string, seqs []int64) {
+	h.mu.RLock()
+	c, ok := h.chats[chatID]
+	h.mu.RUnlock()
+	if !ok || len(seqs) == 0 {
+		return
+	}
+
+	expired := make([]chat.Seq, len(seqs))
+	for i, seq := range seqs {
+		expired[i] = chat.Seq(seq)
+	}
+	c.Expire(expired)
+	h.unpinWhere(c, func(seq int64) bool { return slices.Contains(seqs, seq) })
+
+	h.broadcastToMembers(c, chat.ChatRecord{}, models.ServerMessage{
+		Type:   models.ServerMessageTypeExpired,
+		ChatID: c.ID,
+		Seqs:   seqs,
+	})
+}
@@ -0,0 +1,142 @@
+package ws
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"besedka/internal/models"
+)
+
+func TestHub_SetDisappearingTimer(t *testing.T) {
+	user1 := models.User{ID: "u1", DisplayName: "User 1"}
+	user2 := models.User{ID: "u2", DisplayName: "User 2"}
+	provider := &MockUserProvider{users: []models.User{user1, user2}}
+	store := NewMockStorage()
+	h := NewHub(context.Background(), provider, store, &MockPushService{})
+	dmID := getDMID(user1.ID, user2.ID)
+
+	ch2 := h.Join(user2.ID)
+	drainMessages(ch2, 1)
+
+	if err := h.SetDisappearingTimer(user1.ID, "townhall", 3600); !errors.Is(err, ErrNotDM) {
+		t.Errorf("expected ErrNotDM in townhall, got %v", err)
+	}
+	if err := h.SetDisappearingTimer(user1.ID, dmID, 60); !errors.Is(err, ErrInvalidTimer) {
+		t.Errorf("expected ErrInvalidTimer for 60 seconds, got %v", err)
+	}
+
+	h.Dispatch(user1.ID, models.ClientMessage{Type: models.ClientMessageTypeSetTimer, ChatID: dmID, DisappearAfter: 86400}, nil)
+	msg := expectMessages(t, ch2, dmID)
+	announced := msg.Messages[0]
+	if announced.DisappearAfter == nil || *announced.DisappearAfter != 86400 || announced.ExpiresAt != announced.Timestamp+86400 {
+		t.Errorf("expected an announcement of the 1 day timer, got %+v", announced)
+	}
+	if store.chats[dmID].DisappearAfter != 86400 {
+		t.Errorf("expected the timer to be persisted, got %+v", store.chats[dmID])
+	}
+	for _, c := range h.GetChats(user2.ID) {
+		if c.ID == dmID && c.DisappearAfter != 86400 {
+			t.Errorf("expected the DM to list its timer, got %+v", c)
+		}
+	}
+
+	// Setting the same timer again does not announce it twice.
+	if err := h.SetDisappearingTimer(user2.ID, dmID, 86400); err != nil {
+		t.Fatalf("SetDisappearingTimer failed: %v", err)
+	}
+	if msgs, _ := h.GetChatRecords(user1.ID, dmID, 1, 10); len(msgs) != 1 {
+		t.Errorf("expected a single announcement, got %+v", msgs)
+	}
+
+	if err := h.SetDisappearingTimer(user2.ID, dmID, 0); err != nil {
+		t.Fatalf("SetDisappearingTimer failed: %v", err)
+	}
+	msg = expectMessages(t, ch2, dmID)
+	if off := msg.Messages[0]; off.DisappearAfter == nil || *off.DisappearAfter != 0 || off.ExpiresAt != 0 {
+		t.Errorf("expected an announcement of the timer turned off, got %+v", off)
+	}
+}
+
+func TestHub_ExpireMessages(t *testing.T) {
+	user1 := models.User{ID: "u1", DisplayName: "User 1"}
+	user2 := models.User{ID: "u2", DisplayName: "User 2"}
+	provider := &MockUserProvider{users: []models.User{user1, user2}}
+	h := NewHub(context.Background(), provider, NewMockStorage(), &MockPushService{})
+	dmID := getDMID(user1.ID, user2.ID)
+
+	ch1 := h.Join(user1.ID)
+	drainMessages(ch1, 1)
+
+	for _, text := range []string{"one", "two"} {
+		h.Dispatch(user1.ID, models.ClientMessage{Type: models.ClientMessageTypeSend, ChatID: dmID, Content: text}, ch1)
+	}
+	if err := h.PinMessage(user1.ID, dmID, 1, true); err != nil {
+		t.Fatalf("PinMessage failed: %v", err)
+	}
+
+	h.ExpireMessages(dmID, []int64{1})
+
+	if msg := expectChatEvent(t, ch1, models.ServerMessageTypeUnpinned, dmID); msg.Seq != 1 {
+		t.Errorf("expected seq 1 to be unpinned, got %+v", msg)
+	}
+	if msg := expectChatEvent(t, ch1, models.ServerMessageTypeExpired, dmID); len(msg.Seqs) != 1 || msg.Seqs[0] != 1 {
+		t.Errorf("expected seq 1 to expire, got %+v", msg)
+	}
+	msgs, err := h.GetChatRecords(user1.ID, dmID, 1, 1)
+	if err != nil || len(msgs) != 1 || msgs[0].Content != "" {
+		t.Errorf("expected the content of seq 1 to be dropped, got %+v %v", msgs, err)
+	}
+}
+
+func TestHub_SetDisappearingTimerReadOnlyBot(t *testing.T) {
+	user1 := models.User{ID: "u1", DisplayName: "User 1"}
+	dmID := getDMID(user1.ID, "b1")
+	bot := models.User{ID: "b1", UserName: "reader", Type: models.UserTypeBot, Scoped: true,
+		Scopes: []models.ChatScope{{ChatID: dmID, BotPermissions: models.BotPermissions{ReadAll: true}}}}
+	provider := &MockUserProvider{users: []models.User{user1, bot}}
+	h := NewHub(context.Background(), provider, NewMockStorage(), &MockPushService{})
+
+	if err := h.SetDisappearingTimer(bot.ID, dmID, 3600); !errors.Is(err, ErrCannotPost) {
+		t.Errorf("expected ErrCannotPost, got %v", err)
+	}
+}
+
+func TestHub_SendMessageForeignAttachment(t *testing.T) {
+	user1 := models.User{ID: "u1", DisplayName: "User 1"}
+	user2 := models.User{ID: "u2", DisplayName: "User 2"}
+	provider := &MockUserProvider{users: []models.User{user1, user2}}
+	store := NewMockStorage()
+	h := NewHub(context.Background(), provider, store, &MockPushService{})
+	dmID := getDMID(user1.ID, user2.ID)
+	store.files["mine"] = user1.ID
+	store.files["theirs"] = user2.ID
+
+	// A disappearing message attaching someone else's file would release
+	// it on expiry.
+	if err := h.SetDisappearingTimer(user1.ID, dmID, 3600); err != nil {
+		t.Fatalf("SetDisappearingTimer failed: %v", err)
+	}
+	for _, id := range []string{"theirs", "missing"} {
+		err := h.SendMessage(user1.ID, models.ClientMessage{
+			Type:        models.ClientMessageTypeSend,
+			ChatID:      dmID,
+			Attachments: []models.Attachment{{Type: models.AttachmentTypeFile, FileID: "mine"}, {Type: models.AttachmentTypeFile, FileID: id}},
+		}, nil)
+		if !errors.Is(err, ErrForeignAttachment) {
+			t.Errorf("attaching %q: expected ErrForeignAttachment, got %v", id, err)
+		}
+	}
+	if len(store.messages[dmID]) != 1 {
+		t.Errorf("expected only the timer announcement to be stored, got %+v", store.messages[dmID])
+	}
+
+	err := h.SendMessage(user1.ID, models.ClientMessage{
+		Type:        models.ClientMessageTypeSend,
+		ChatID:      dmID,
+		Attachments: []models.Attachment{{Type: models.AttachmentTypeFile, FileID: "mine"}},
+	}, nil)
+	if err != nil {
+		t.Fatalf("SendMessage failed: %v", err)
+	}
+}
@@ -0,0 +1,38 @@
+package ws
+
+import "testing"
+
+func TestIsEmoji(t *testing.T) {
+	for _, c := range []struct {
+		s    string
+		want bool
+	}{
+		{"👍", true},
+		{"👍🏽", true},
+		{"❤️", true},
+		{"©", true},
+		{"🇺🇦", true},
+		{"1️⃣", true},
+		{"#⃣", true},
+		{"👨‍👩‍👧", true},
+		{"🧑🏿‍🚀", true},
+		{"🏴\U000E0067\U000E0062\U000E0065\U000E006E\U000E0067\U000E007F", true},
+		{"", false},
+		{"a", false},
+		{"ok", false},
+		{"👍👍", false},
+		{"👍 ", false},
+		{"🇺", false},
+		{"🇺🇦🇺", false},
+		{"🏽", false},
+		{"👨‍", false},
+		{"👨‍a", false},
+		{"🏴\U000E0067\U000E0062", false},
+		{"1", false},
+		{"ё", false},
+	} {
+		if got := isEmoji(c.s); got != c.want {
+			t.Errorf("isEmoji(%q) = %v, want %v", c.s, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,293 @@
+package ws
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"unicode/utf8"
+
+	"besedka/internal/chat"
+	"besedka/internal/content"
+	"besedka/internal/models"
+
+	"github.com/google/uuid"
+)
+
+const maxGroupNameLength = 64
+
+var (
+	ErrInvalidGroupName = errors.New("group name must be 1-64 characters")
+	ErrInvalidMember    = errors.New("invalid group member")
+	ErrNotGroup         = errors.New("chat is not a group chat")
+	ErrNotGroupCreator  = errors.New("only the group creator can remove other members")
+)
+
+// CreateGroup creates a named group chat. The creator is always a member.
+func (h *Hub) CreateGroup(creatorID, name string, memberIDs []string) (models.Chat, error) {
+	name, err := normalizeGroupName(name)
+	if err != nil {
+		return models.Chat{}, err
+	}
+
+	members := []string{creatorID}
+	seen := map[string]bool{creatorID: true}
+	for _, id := range memberIDs {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		members = append(members, id)
+	}
+	for _, id := range members {
+		if err := h.validateGroupMember(id); err != nil {
+			return models.Chat{}, err
+		}
+	}
+
+	id := "group_" + uuid.NewString()
+	if err := h.storage.UpsertChat(models.Chat{
+		ID:        id,
+		Name:      name,
+		IsGroup:   true,
+		Members:   members,
+		CreatedBy: creatorID,
+	}); err != nil {
+		return models.Chat{}, fmt.Errorf("failed to persist group: %w", err)
+	}
+
+	c := chat.New(chat.Config{
+		ID:             id,
+		Name:           name,
+		IsGroup:        true,
+		CreatedBy:      creatorID,
+		MaxRecords:     chatMaxRecords,
+		RecordCallback: h.handleRecordCallback,
+		Storage:        h.storage,
+	})
+
+	h.mu.Lock()
+	for _, m := range members {
+		_, online := h.connectedUsers[m]
+		c.SetMemberStatus(m, online)
+	}
+	h.chats[id] = c
+	h.mu.Unlock()
+
+	info := groupInfo(c)
+	h.notifyGroup(info, info.Members)
+	return info, nil
+}
+
+// RenameGroup changes the name of a group chat userID is a member of.
+func (h *Hub) RenameGroup(userID, chatID, name string) (models.Chat, error) {
+	name, err := normalizeGroupName(name)
+	if err != nil {
+		return models.Chat{}, err
+	}
+
+	h.groupsMu.Lock()
+	defer h.groupsMu.Unlock()
+
+	c, err := h.groupFor(userID, chatID)
+	if err != nil {
+		return models.Chat{}, err
+	}
+
+	info := groupInfo(c)
+	info.Name = name
+	if err := h.persistGroup(info); err != nil {
+		return models.Chat{}, err
+	}
+	c.SetName(name)
+
+	h.notifyGroup(info, info.Members)
+	return info, nil
+}
+
+// AddGroupMember adds memberID to a group chat userID is a member of.
+func (h *Hub) AddGroupMember(userID, chatID, memberID string) (models.Chat, error) {
+	h.groupsMu.Lock()
+	defer h.groupsMu.Unlock()
+
+	c, err := h.groupFor(userID, chatID)
+	if err != nil {
+		return models.Chat{}, err
+	}
+	if c.HasMember(memberID) {
+		return groupInfo(c), nil
+	}
+	if err := h.validateGroupMember(memberID); err != nil {
+		return models.Chat{}, err
+	}
+
+	info := groupInfo(c)
+	info.Members = append(info.Members, memberID)
+	if err := h.persistGroup(info); err != nil {
+		return models.Chat{}, err
+	}
+
+	h.mu.RLock()
+	_, online := h.connectedUsers[memberID]
+	h.mu.RUnlock()
+	c.SetMemberStatus(memberID, online)
+
+	info = groupInfo(c)
+	h.notifyGroup(info, info.Members)
+	return info, nil
+}
+
+// RemoveGroupMember removes memberID from a group chat userID is a member of.
+// Only the group creator may remove other members; any member may remove
+// themselves to leave the group.
+func (h *Hub) RemoveGroupMember(userID, chatID, memberID string) (models.Chat, error) {
+	h.groupsMu.Lock()
+	defer h.groupsMu.Unlock()
+
+	c, err := h.groupFor(userID, chatID)
+	if err != nil {
+		return models.Chat{}, err
+	}
+	if memberID != userID && userID != c.CreatedBy {
+		return models.Chat{}, ErrNotGroupCreator
+	}
+	return h.removeGroupMemberLocked(c, memberID)
+}
+
+// AdminRemoveGroupMember removes memberID from a group chat on behalf of an
+// admin.
+func (h *Hub) AdminRemoveGroupMember(chatID, memberID string) (models.Chat, error) {
+	h.groupsMu.Lock()
+	defer h.groupsMu.Unlock()
+
+	h.mu.RLock()
+	c, ok := h.chats[chatID]
+	h.mu.RUnlock()
+	if !ok {
+		return models.Chat{}, models.ErrNotFound
+	}
+	if !c.IsGroup {
+		return models.Chat{}, ErrNotGroup
+	}
+	return h.removeGroupMemberLocked(c, memberID)
+}
+
+// removeGroupMemberLocked removes memberID from c and tells the members.
+// h.groupsMu must be held.
+func (h *Hub) removeGroupMemberLocked(c *chat.Chat, memberID string) (models.Chat, error) {
+	if !c.HasMember(memberID) {
+		return models.Chat{}, ErrInvalidMember
+	}
+
+	info := groupInfo(c)
+	members := make([]string, 0, len(info.Members))
+	for _, id := range info.Members {
+		if id != memberID {
+			members = append(members, id)
+		}
+	}
+	info.Members = members
+	if err := h.persistGroup(info); err != nil {
+		return models.Chat{}, err
+	}
+	c.RemoveMember(memberID)
+
+	h.sendToUser(memberID, models.ServerMessage{
+		Type:   models.ServerMessageTypeChatRemoved,
+		ChatID: c.ID,
+	})
+	h.notifyGroup(info, info.Members)
+	return info, nil
+}
+
+// removeFromGroupsLocked drops a deleted user from every group chat. h.groupsMu
+// and h.mu must be held.
+func (h *Hub) removeFromGroupsLocked(userID string) {
+	for _, c := range h.chats {
+		if !c.IsGroup || !c.HasMember(userID) {
+			continue
+		}
+		c.RemoveMember(userID)
+		if err := h.storage.UpsertChat(groupInfo(c)); err != nil {
+			slog.Error("failed to persist group", "chatID", c.ID, "error", err)
+		}
+	}
+}
+
+func (h *Hub) groupFor(userID, chatID string) (*chat.Chat, error) {
+	c, err := h.writableChat(userID, chatID)
+	if err != nil {
+		return nil, err
+	}
+	if !c.IsGroup {
+		return nil, ErrNotGroup
+	}
+	return c, nil
+}
+
+func (h *Hub) validateGroupMember(userID string) error {
+	if userID == "" {
+		return ErrInvalidMember
+	}
+	u, err := h.userProvider.GetUser(userID)
+	if err != nil || u.ID == "" || u.Status == models.UserStatusDeleted || u.Type == models.UserTypeWebhook {
+		return ErrInvalidMember
+	}
+	return nil
+}
+
+func (h *Hub) persistGroup(info models.Chat) error {
+	if err := h.storage.UpsertChat(info); err != nil {
+		return fmt.Errorf("failed to persist group: %w", err)
+	}
+	return nil
+}
+
+func (h *Hub) notifyGroup(info models.Chat, members []string) {
+	info.Name = content.Escape(info.Name)
+	for _, id := range members {
+		h.sendToUser(id, models.ServerMessage{
+			Type:   models.ServerMessageTypeChat,
+			ChatID: info.ID,
+			Chat:   &info,
+		})
+	}
+}
+
+func groupInfo(c *chat.Chat) models.Chat {
+	return models.Chat{
+		ID:        c.ID,
+		Name:      c.GetName(),
+		IsGroup:   true,
+		Members:   c.MemberIDs(),
+		Pins:      c.GetPins(),
+		LastSeq:   int(c.GetLastSeq()),
+		CreatedBy: c.CreatedBy,
+	}
+}
+
+func normalizeGroupName(name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || utf8.RuneCountInString(name) > maxGroupNameLength {
+		return "", ErrInvalidGroupName
+	}
+	return name, nil
+}
+
+func canAccess(userID string, c *chat.Chat) bool {
+	if c.ID == "townhall" {
+		return true
+	}
+	if c.IsGroup {
+		return c.HasMember(userID)
+	}
+	return isUserInDM(userID, c.ID)
+}
+
+// IsGroup reports whether chatID is an existing group chat.
+func (h *Hub) IsGroup(chatID string) bool {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	c, ok := h.chats[chatID]
+	return ok && c.IsGroup
+}
@@ -0,0 +1,193 @@
+package ws
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"besedka/internal/models"
+)
+
+// expectChatEvent blocks until a server message of type typ is received for chatID.
+func expectChatEvent(t *testing.T, ch <-chan models.ServerMessage, typ models.ServerMessageType, chatID string) models.ServerMessage {
+	t.Helper()
+	timeout := time.After(1 * time.Second)
+	for {
+		select {
+		case msg := <-ch:
+			if msg.Type == typ && msg.ChatID == chatID {
+				return msg
+			}
+		case <-timeout:
+			t.Fatalf("timeout waiting for %s in chat %s", typ, chatID)
+		}
+	}
+}
+
+func TestHub_GroupChat(t *testing.T) {
+	user1 := models.User{ID: "u1", DisplayName: "User 1"}
+	user2 := models.User{ID: "u2", DisplayName: "User 2"}
+	user3 := models.User{ID: "u3", DisplayName: "User 3"}
+	provider := &MockUserProvider{users: []models.User{user1, user2, user3}}
+	store := NewMockStorage()
+	h := NewHub(context.Background(), provider, store, &MockPushService{})
+
+	ch1 := h.Join(user1.ID)
+	ch2 := h.Join(user2.ID)
+	ch3 := h.Join(user3.ID)
+	drainMessages(ch1, 2)
+	drainMessages(ch2, 2)
+	drainMessages(ch3, 2)
+
+	if _, err := h.CreateGroup(user1.ID, "  ", nil); !errors.Is(err, ErrInvalidGroupName) {
+		t.Errorf("expected ErrInvalidGroupName, got %v", err)
+	}
+	if _, err := h.CreateGroup(user1.ID, "Family", []string{"nobody"}); !errors.Is(err, ErrInvalidMember) {
+		t.Errorf("expected ErrInvalidMember, got %v", err)
+	}
+
+	group, err := h.CreateGroup(user1.ID, "Family", []string{user2.ID, user2.ID})
+	if err != nil {
+		t.Fatalf("CreateGroup failed: %v", err)
+	}
+	if len(group.Members) != 2 {
+		t.Fatalf("expected 2 members, got %v", group.Members)
+	}
+	if persisted := store.chats[group.ID]; !persisted.IsGroup || len(persisted.Members) != 2 {
+		t.Errorf("group not persisted correctly: %+v", persisted)
+	}
+	expectChatEvent(t, ch1, models.ServerMessageTypeChat, group.ID)
+	expectChatEvent(t, ch2, models.ServerMessageTypeChat, group.ID)
+
+	h.Dispatch(user1.ID, models.ClientMessage{Type: models.ClientMessageTypeSend, ChatID: group.ID, Content: "hello family"}, ch1)
+	msg := expectMessages(t, ch2, group.ID)
+	if msg.Messages[0].Content == "" {
+		t.Error("expected message content")
+	}
+
+	// Non-members can neither read nor post.
+	if _, err := h.GetChatRecords(user3.ID, group.ID, 1, 10); !errors.Is(err, models.ErrNotFound) {
+		t.Errorf("expected ErrNotFound for non-member, got %v", err)
+	}
+	h.Dispatch(user3.ID, models.ClientMessage{Type: models.ClientMessageTypeSend, ChatID: group.ID, Content: "intruder"}, ch3)
+	if seq := h.chats[group.ID].GetLastSeq(); seq != 1 {
+		t.Errorf("expected non-member send to be ignored, LastSeq %d", seq)
+	}
+	for _, c := range h.GetChats(user3.ID) {
+		if c.ID == group.ID {
+			t.Error("group should not be listed for non-member")
+		}
+	}
+
+	if _, err := h.RenameGroup(user3.ID, group.ID, "Mine"); !errors.Is(err, models.ErrNotFound) {
+		t.Errorf("expected ErrNotFound renaming as non-member, got %v", err)
+	}
+	if _, err := h.RenameGroup(user1.ID, "townhall", "Mine"); !errors.Is(err, ErrNotGroup) {
+		t.Errorf("expected ErrNotGroup, got %v", err)
+	}
+	h.Dispatch(user2.ID, models.ClientMessage{Type: models.ClientMessageTypeRenameGroup, ChatID: group.ID, Name: "Trip <planning>"}, ch2)
+	renamed := expectChatEvent(t, ch1, models.ServerMessageTypeChat, group.ID)
+	if renamed.Chat.Name != "Trip &lt;planning&gt;" {
+		t.Errorf("expected escaped name, got %q", renamed.Chat.Name)
+	}
+
+	if _, err := h.AddGroupMember(user1.ID, group.ID, user3.ID); err != nil {
+		t.Fatalf("AddGroupMember failed: %v", err)
+	}
+	expectChatEvent(t, ch3, models.ServerMessageTypeChat, group.ID)
+	if _, err := h.GetChatRecords(user3.ID, group.ID, 1, 10); err != nil {
+		t.Errorf("expected new member to read history, got %v", err)
+	}
+
+	if _, err := h.RemoveGroupMember(user1.ID, group.ID, user2.ID); err != nil {
+		t.Fatalf("RemoveGroupMember failed: %v", err)
+	}
+	expectChatEvent(t, ch2, models.ServerMessageTypeChatRemoved, group.ID)
+	if _, err := h.GetChatRecords(user2.ID, group.ID, 1, 10); !errors.Is(err, models.ErrNotFound) {
+		t.Errorf("expected ErrNotFound for removed member, got %v", err)
+	}
+	if _, err := h.RemoveGroupMember(user3.ID, group.ID, user1.ID); !errors.Is(err, ErrNotGroupCreator) {
+		t.Errorf("expected ErrNotGroupCreator removing the creator, got %v", err)
+	}
+
+	// Group survives a restart with its name and members.
+	h2 := NewHub(context.Background(), provider, store, &MockPushService{})
+	var restored *models.Chat
+	for _, c := range h2.GetChats(user3.ID) {
+		if c.ID == group.ID {
+			restored = &c
+		}
+	}
+	if restored == nil {
+		t.Fatal("group not restored for member")
+	}
+	if !restored.IsGroup || restored.Name != "Trip &lt;planning&gt;" || len(restored.Members) != 2 {
+		t.Errorf("unexpected restored group: %+v", restored)
+	}
+	if _, err := h2.GetChatRecords(user2.ID, group.ID, 1, 10); !errors.Is(err, models.ErrNotFound) {
+		t.Errorf("expected removed member to stay removed after restart, got %v", err)
+	}
+	if restored.CreatedBy != user1.ID {
+		t.Errorf("expected the creator to be restored, got %q", restored.CreatedBy)
+	}
+
+	// Members may leave, and admins may remove anyone.
+	if _, err := h2.RemoveGroupMember(user3.ID, group.ID, user3.ID); err != nil {
+		t.Errorf("expected a member to be able to leave, got %v", err)
+	}
+	if _, err := h2.AdminRemoveGroupMember(group.ID, user1.ID); err != nil {
+		t.Errorf("AdminRemoveGroupMember failed: %v", err)
+	}
+	if _, err := h2.AdminRemoveGroupMember("townhall", user1.ID); !errors.Is(err, ErrNotGroup) {
+		t.Errorf("expected ErrNotGroup, got %v", err)
+	}
+}
+
+func TestHub_RemoveDeletedUser_LeavesGroups(t *testing.T) {
+	user1 := models.User{ID: "u1", DisplayName: "User 1"}
+	user2 := models.User{ID: "u2", DisplayName: "User 2"}
+	provider := &MockUserProvider{users: []models.User{user1, user2}}
+	store := NewMockStorage()
+	h := NewHub(context.Background(), provider, store, &MockPushService{})
+
+	group, err := h.CreateGroup(user1.ID, "Pair", []string{user2.ID})
+	if err != nil {
+		t.Fatalf("CreateGroup failed: %v", err)
+	}
+
+	h.RemoveDeletedUser(user2.ID)
+
+	if h.chats[group.ID].HasMember(user2.ID) {
+		t.Error("deleted user should be removed from group")
+	}
+	if members := store.chats[group.ID].Members; len(members) != 1 || members[0] != user1.ID {
+		t.Errorf("expected persisted members [u1], got %v", members)
+	}
+}
+
+func TestHub_GroupReadOnlyBot(t *testing.T) {
+	user1 := models.User{ID: "u1", DisplayName: "User 1"}
+	user2 := models.User{ID: "u2", DisplayName: "User 2"}
+	bot := models.User{ID: "b1", UserName: "reader", Type: models.UserTypeBot}
+	provider := &MockUserProvider{users: []models.User{user1, user2, bot}}
+	h := NewHub(context.Background(), provider, NewMockStorage(), &MockPushService{})
+
+	group, err := h.CreateGroup(user1.ID, "Family", []string{bot.ID})
+	if err != nil {
+		t.Fatalf("CreateGroup failed: %v", err)
+	}
+	// The bot stays a member but may only read the group.
+	provider.users[2].Scoped = true
+	provider.users[2].Scopes = []models.ChatScope{{ChatID: group.ID, BotPermissions: models.BotPermissions{ReadAll: true}}}
+
+	if _, err := h.RenameGroup(bot.ID, group.ID, "Bots"); !errors.Is(err, ErrCannotPost) {
+		t.Errorf("RenameGroup: expected ErrCannotPost, got %v", err)
+	}
+	if _, err := h.AddGroupMember(bot.ID, group.ID, user2.ID); !errors.Is(err, ErrCannotPost) {
+		t.Errorf("AddGroupMember: expected ErrCannotPost, got %v", err)
+	}
+	if _, err := h.RemoveGroupMember(bot.ID, group.ID, user1.ID); !errors.Is(err, ErrCannotPost) {
+		t.Errorf("RemoveGroupMember: expected ErrCannotPost, got %v", err)
+	}
+}
@@ -3,8 +3,10 @@ package ws
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
+	"slices"
 	"sort"
 	"strings"
 	"sync"
@@ -23,6 +25,8 @@ const (
 	locationCleanup = time.Minute
 	pushWorkers     = 5
 	pushQueueSize   = 100
+	unfurlWorkers   = 4
+	unfurlQueueSize = 100
 )
 
 type pushTask struct {
@@ -40,25 +44,51 @@ type Hub struct {
 	connectedUsers map[string][]chan models.ServerMessage
 	userLocations  *geche.MapTTLCache[string, models.Location]
 
+	// sessions maps connections of logged in users to their session ID.
+	sessions map[chan models.ServerMessage]string
+
 	userProvider userProvider
 	storage      storage
 	pushService  PushService
 	pushQueue    chan pushTask
+	unfurlQueue  chan unfurlTask
 
 	lastSeenSeq   map[userChatKey]int64
 	changedSeq    []models.LastSeenEntry
 	changedSeqMux sync.Mutex
 
+	// groupsMu serializes changes to persisted chat metadata: group membership, names and pins.
+	groupsMu sync.Mutex
+
+	typing        map[userChatKey]*typingEntry
+	typingMu      sync.Mutex
+	typingTimeout time.Duration
+
+	// unfurler and botNotifier are optional and must be set before the hub
+	// serves clients.
+	unfurler    LinkUnfurler
+	botNotifier BotNotifier
+
+	// Slash commands are enabled by SetCommandStore.
+	commands     map[string]models.SlashCommand
+	commandStore CommandStore
+	commandsMu   sync.RWMutex
+	invocations  *geche.MapTTLCache[string, pendingCommand]
+
 	mu sync.RWMutex
 }
 
 type storage interface {
 	UpsertMessage(message models.Message) error
 	ListMessages(chatID string, from, to int64) ([]models.Message, error)
+	GetMessages(chatID string, seqs []int64) ([]models.Message, error)
+	ListReplies(chatID string, seq, after int64, limit int) ([]int64, error)
 	ListChats() ([]models.Chat, error)
 	UpsertChat(chat models.Chat) error
 	SaveLastSeenBatch(batch []models.LastSeenEntry) error
 	ListLastSeen() ([]models.LastSeenEntry, error)
+	SetDisappearAfter(chatID string, seconds int64) error
+	FileUploader(id string) (string, error)
 }
 
 type userProvider interface {
@@ -74,17 +104,25 @@ func NewHub(ctx context.Context, userProvider userProvider, storage storage, pus
 	h := &Hub{
 		chats:          make(map[string]*chat.Chat),
 		connectedUsers: make(map[string][]chan models.ServerMessage),
+		sessions:       make(map[chan models.ServerMessage]string),
 		userLocations:  geche.NewMapTTLCache[string, models.Location](ctx, locationTTL, locationCleanup),
 		userProvider:   userProvider,
 		storage:        storage,
 		pushService:    pushService,
 		pushQueue:      make(chan pushTask, pushQueueSize),
+		unfurlQueue:    make(chan unfurlTask, unfurlQueueSize),
 		lastSeenSeq:    make(map[userChatKey]int64),
+		typing:         make(map[userChatKey]*typingEntry),
+		typingTimeout:  typingTimeout,
+		invocations:    geche.NewMapTTLCache[string, pendingCommand](ctx, commandReplyTTL, time.Minute),
 	}
 
 	for i := 0; i < pushWorkers; i++ {
 		go h.pushWorker(ctx)
 	}
+	for i := 0; i < unfurlWorkers; i++ {
+		go h.unfurlWorker(ctx)
+	}
 
 	// Load last seen sequence numbers
 	lastSeen, err := storage.ListLastSeen()
@@ -142,6 +180,11 @@ func (h *Hub) pushWorker(ctx context.Context) {
 func (h *Hub) restoreChat(modelChat models.Chat) {
 	c := chat.New(chat.Config{
 		ID:             modelChat.ID,
+		Name:           modelChat.Name,
+		IsGroup:        modelChat.IsGroup,
+		CreatedBy:      modelChat.CreatedBy,
+		Pins:           modelChat.Pins,
+		DisappearAfter: modelChat.DisappearAfter,
 		MaxRecords:     chatMaxRecords,
 		RecordCallback: h.handleRecordCallback,
 		Storage:        h.storage,
@@ -161,8 +204,14 @@ func (h *Hub) restoreChat(modelChat models.Chat) {
 			c.SetMemberStatus(parts[0], false)
 			c.SetMemberStatus(parts[1], false)
 		}
+	} else if modelChat.IsGroup {
+		for _, id := range modelChat.Members {
+			c.SetMemberStatus(id, false)
+		}
 	}
 
+	c.MinSeq = chat.Seq(modelChat.FirstSeq)
+
 	if modelChat.LastSeq > 0 {
 		c.LastSeq = chat.Seq(modelChat.LastSeq)
 		from := int64(modelChat.LastSeq) - chatMaxRecords + 1
@@ -176,14 +225,8 @@ func (h *Hub) restoreChat(modelChat models.Chat) {
 			slog.Error("failed to restore messages", "chatID", c.ID, "error", err)
 		} else {
 			for _, m := range msgs {
-				rec := chat.ChatRecord{
-					Seq:              chat.Seq(m.Seq),
-					Timestamp:        m.Timestamp,
-					UserID:           m.UserID,
-					Content:          m.Content,
-					FormattedContent: content.FormatMessage(m.Content),
-					Attachments:      m.Attachments,
-				}
+				rec := chat.RecordFromMessage(m)
+				rec.FormattedContent = content.FormatMessage(m.Content)
 				c.Records = append(c.Records, rec)
 				if c.FirstSeq == 0 {
 					c.FirstSeq = rec.Seq
@@ -261,9 +304,9 @@ func (h *Hub) Join(userID string) chan models.ServerMessage {
 	h.connectedUsers[userID] = append(h.connectedUsers[userID], ch)
 
 	// Join all relevant chats
-	// Logic: A user should be part of Townhall and all their DMs
-	for chatID, c := range h.chats {
-		if chatID == "townhall" || isUserInDM(userID, chatID) {
+	// Logic: A user should be part of Townhall, all their DMs and groups
+	for _, c := range h.chats {
+		if canAccess(userID, c) {
 			c.Join(userID)
 		}
 	}
@@ -321,6 +364,7 @@ func (h *Hub) leaveLocked(userID string, expectedCh chan models.ServerMessage, b
 	if expectedCh == nil {
 		for _, ch := range channels {
 			h.safeClose(ch)
+			delete(h.sessions, ch)
 		}
 		delete(h.connectedUsers, userID)
 	} else {
@@ -331,6 +375,7 @@ func (h *Hub) leaveLocked(userID string, expectedCh chan models.ServerMessage, b
 			if ch == expectedCh {
 				found = true
 				h.safeClose(ch)
+				delete(h.sessions, ch)
 				continue
 			}
 			newChannels = append(newChannels, ch)
@@ -352,11 +397,12 @@ func (h *Hub) leaveLocked(userID string, expectedCh chan models.ServerMessage, b
 	}
 
 	// Leave all relevant chats
-	for chatID, c := range h.chats {
-		if chatID == "townhall" || isUserInDM(userID, chatID) {
+	for _, c := range h.chats {
+		if canAccess(userID, c) {
 			c.Leave(userID)
 		}
 	}
+	h.clearTypingLocked(userID)
 
 	if broadcastOffline {
 		// Notify others that user is offline
@@ -385,6 +431,8 @@ func (h *Hub) BroadcastNewUser(user models.User) {
 }
 
 func (h *Hub) RemoveDeletedUser(userID string) {
+	h.groupsMu.Lock()
+	defer h.groupsMu.Unlock()
 	h.mu.Lock()
 
 	// Close deleted user's connection if online and cleanup.
@@ -397,6 +445,7 @@ func (h *Hub) RemoveDeletedUser(userID string) {
 			delete(h.chats, id)
 		}
 	}
+	h.removeFromGroupsLocked(userID)
 
 	h.mu.Unlock()
 
@@ -412,6 +461,28 @@ func (h *Hub) DisconnectUser(userID string) {
 	h.mu.Unlock()
 }
 
+// SetSession records the login session a connection was opened with, so
+// DisconnectSession can close it.
+func (h *Hub) SetSession(userID string, ch chan models.ServerMessage, sessionID string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	// The connection may have been closed already.
+	if slices.Contains(h.connectedUsers[userID], ch) {
+		h.sessions[ch] = sessionID
+	}
+}
+
+// DisconnectSession closes the connections of a user opened with a session.
+func (h *Hub) DisconnectSession(userID, sessionID string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, ch := range slices.Clone(h.connectedUsers[userID]) {
+		if h.sessions[ch] == sessionID {
+			h.leaveLocked(userID, ch, true)
+		}
+	}
+}
+
 // BroadcastToAll sends a message to all connected users except the excluded one.
 func (h *Hub) BroadcastToAll(msg models.ServerMessage, excludeUserID string) {
 	h.mu.RLock()
@@ -470,43 +541,107 @@ func (h *Hub) sendToChannels(channels []chan models.ServerMessage, msg models.Se
 	}
 }
 
+// writableChat returns chatID if userID may change it: post, edit, delete,
+// react, pin or manage the group. Every action that changes a chat on behalf
+// of a user goes through it, so bots scoped to read a chat can't change it.
+func (h *Hub) writableChat(userID, chatID string) (*chat.Chat, error) {
+	h.mu.RLock()
+	c, ok := h.chats[chatID]
+	h.mu.RUnlock()
+	if !ok {
+		return nil, models.ErrNotFound
+	}
+
+	u, err := h.userProvider.GetUser(userID)
+	if err != nil {
+		return nil, models.ErrNotFound
+	}
+	// Webhooks are never chat members; CanPost checks their allowed chats.
+	if !canAccess(userID, c) && u.Type != models.UserTypeWebhook {
+		return nil, models.ErrNotFound
+	}
+	if !models.CanPost(c.ID, u) {
+		return nil, ErrCannotPost
+	}
+	return c, nil
+}
+
+// SendMessage posts msg to its chat as userID, or routes it to a bot if it is
+// a slash command. senderCh, if not nil, is the sender's own connection.
+func (h *Hub) SendMessage(userID string, msg models.ClientMessage, senderCh chan models.ServerMessage) error {
+	c, err := h.writableChat(userID, msg.ChatID)
+	if err != nil {
+		return err
+	}
+	// Messages own their attachments: deleting or expiring one releases
+	// them, so nobody may attach a file somebody else uploaded.
+	for _, a := range msg.Attachments {
+		if uploader, err := h.storage.FileUploader(a.FileID); err != nil || uploader != userID {
+			return ErrForeignAttachment
+		}
+	}
+
+	for i := range msg.Attachments {
+		if len(msg.Attachments[i].Name) > 255 {
+			msg.Attachments[i].Name = msg.Attachments[i].Name[:255]
+		}
+	}
+	if h.routeCommand(userID, c, msg.Content, msg.Attachments) {
+		_ = h.SetTyping(userID, c.ID, false)
+		return nil
+	}
+	replyTo, err := validateReplyRef(c, msg.ReplyTo)
+	if err != nil {
+		return err
+	}
+	seq, err := c.AddRecord(chat.ChatRecord{
+		UserID:           userID,
+		Content:          msg.Content,
+		FormattedContent: content.FormatMessage(msg.Content),
+		Attachments:      msg.Attachments,
+		Timestamp:        time.Now().Unix(),
+		ReplyTo:          replyTo,
+		Sender:           msg.Sender,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to add record: %w", err)
+	}
+	h.UpdateLastSeen(userID, c.ID, int64(seq), senderCh)
+	_ = h.SetTyping(userID, c.ID, false)
+	h.unfurlRecord(c, seq, msg.Content)
+	return nil
+}
+
 func (h *Hub) Dispatch(userID string, msg models.ClientMessage, senderCh chan models.ServerMessage) {
 	// Location messages do not belong to any chatID, so handle them separately.
 	if msg.Type == models.ClientMessageTypeLocation {
 		h.handleLocation(userID, msg)
 		return
 	}
+	// Group creation has no chatID yet either.
+	if msg.Type == models.ClientMessageTypeCreateGroup {
+		if _, err := h.CreateGroup(userID, msg.Name, msg.UserIDs); err != nil {
+			slog.Warn("failed to create group", "userID", userID, "error", err)
+		}
+		return
+	}
+
+	if msg.Type == models.ClientMessageTypeSend {
+		if err := h.SendMessage(userID, msg, senderCh); err != nil && !errors.Is(err, models.ErrNotFound) {
+			slog.Warn("failed to send message", "chatID", msg.ChatID, "userID", userID, "error", err)
+		}
+		return
+	}
 
 	h.mu.RLock()
 	c, ok := h.chats[msg.ChatID]
 	h.mu.RUnlock()
 
-	if !ok {
-		return
-	}
-
-	if c.ID != "townhall" && !isUserInDM(userID, c.ID) {
+	if !ok || !canAccess(userID, c) {
 		return
 	}
 
 	switch msg.Type {
-	case models.ClientMessageTypeSend:
-		for i := range msg.Attachments {
-			if len(msg.Attachments[i].Name) > 255 {
-				msg.Attachments[i].Name = msg.Attachments[i].Name[:255]
-			}
-		}
-		if err := c.AddRecord(chat.ChatRecord{
-			UserID:           userID,
-			Content:          msg.Content,
-			FormattedContent: content.FormatMessage(msg.Content),
-			Attachments:      msg.Attachments,
-			Timestamp:        time.Now().Unix(),
-		}); err != nil {
-			slog.Error("failed to add record", "chatID", c.ID, "userID", userID, "error", err)
-		} else {
-			h.UpdateLastSeen(userID, c.ID, c.GetLastSeq(), senderCh)
-		}
 	case models.ClientMessageTypeJoin:
 		records, err := c.GetLastRecords(100)
 		if err != nil {
@@ -517,7 +652,7 @@ func (h *Hub) Dispatch(userID string, msg models.ClientMessage, senderCh chan mo
 		h.sendToUser(userID, models.ServerMessage{
 			Type:     models.ServerMessageTypeMessages,
 			ChatID:   c.ID,
-			Messages: mapRecordsToMessages(records),
+			Messages: h.messagesFor(c, records),
 		})
 
 	case models.ClientMessageTypeFetch:
@@ -537,10 +672,47 @@ func (h *Hub) Dispatch(userID string, msg models.ClientMessage, senderCh chan mo
 		h.sendToUser(userID, models.ServerMessage{
 			Type:     models.ServerMessageTypeMessages,
 			ChatID:   c.ID,
-			Messages: mapRecordsToMessages(records),
+			Messages: h.messagesFor(c, records),
 		})
 	case models.ClientMessageTypeRead:
 		h.UpdateLastSeen(userID, msg.ChatID, msg.Seq, senderCh)
+	case models.ClientMessageTypeDelete:
+		if err := h.DeleteMessage(userID, c.ID, msg.Seq); err != nil {
+			slog.Warn("failed to delete message", "chatID", c.ID, "seq", msg.Seq, "userID", userID, "error", err)
+		}
+	case models.ClientMessageTypeReact, models.ClientMessageTypeUnreact:
+		add := msg.Type == models.ClientMessageTypeReact
+		if err := h.React(userID, c.ID, msg.Seq, msg.Emoji, add); err != nil {
+			slog.Warn("failed to update reaction", "chatID", c.ID, "seq", msg.Seq, "userID", userID, "error", err)
+		}
+	case models.ClientMessageTypeEdit:
+		if _, err := h.EditMessage(userID, c.ID, msg.Seq, msg.Content); err != nil {
+			slog.Warn("failed to edit message", "chatID", c.ID, "seq", msg.Seq, "userID", userID, "error", err)
+		}
+	case models.ClientMessageTypeTyping, models.ClientMessageTypeStopTyping:
+		if err := h.SetTyping(userID, c.ID, msg.Type == models.ClientMessageTypeTyping); err != nil {
+			slog.Warn("failed to update typing status", "chatID", c.ID, "userID", userID, "error", err)
+		}
+	case models.ClientMessageTypePin, models.ClientMessageTypeUnpin:
+		if err := h.PinMessage(userID, c.ID, msg.Seq, msg.Type == models.ClientMessageTypePin); err != nil {
+			slog.Warn("failed to update pins", "chatID", c.ID, "seq", msg.Seq, "userID", userID, "error", err)
+		}
+	case models.ClientMessageTypeRenameGroup:
+		if _, err := h.RenameGroup(userID, c.ID, msg.Name); err != nil {
+			slog.Warn("failed to rename group", "chatID", c.ID, "userID", userID, "error", err)
+		}
+	case models.ClientMessageTypeAddMember:
+		if _, err := h.AddGroupMember(userID, c.ID, msg.UserID); err != nil {
+			slog.Warn("failed to add group member", "chatID", c.ID, "userID", userID, "error", err)
+		}
+	case models.ClientMessageTypeRemoveMember:
+		if _, err := h.RemoveGroupMember(userID, c.ID, msg.UserID); err != nil {
+			slog.Warn("failed to remove group member", "chatID", c.ID, "userID", userID, "error", err)
+		}
+	case models.ClientMessageTypeSetTimer:
+		if err := h.SetDisappearingTimer(userID, c.ID, msg.DisappearAfter); err != nil {
+			slog.Warn("failed to set disappearing messages timer", "chatID", c.ID, "userID", userID, "error", err)
+		}
 	}
 }
 
@@ -607,10 +779,18 @@ func (h *Hub) IsUserOnline(userID string) bool {
 
 type chatSnapshot struct {
 	ID          string
+	FirstSeq    int64
 	LastSeq     int64
 	LastSeenSeq int64
 	IsDM        bool
+	IsGroup     bool
+	Name        string
+	Members     []string
+	CreatedBy   string
 	OtherID     string
+	PinCount    int
+	// DisappearAfter is the disappearing messages timer, for DMs.
+	DisappearAfter int64
 }
 
 func (h *Hub) GetChats(userID string) []models.Chat {
@@ -620,8 +800,7 @@ func (h *Hub) GetChats(userID string) []models.Chat {
 	var newEntries []models.LastSeenEntry
 
 	for id, c := range h.chats {
-		inChat := (id == "townhall") || isUserInDM(userID, id)
-		if !inChat {
+		if !canAccess(userID, c) {
 			continue
 		}
 
@@ -638,9 +817,18 @@ func (h *Hub) GetChats(userID string) []models.Chat {
 
 		snap := chatSnapshot{
 			ID:          c.ID,
+			FirstSeq:    int64(c.GetMinSeq()),
 			LastSeq:     int64(c.LastSeq),
 			LastSeenSeq: lastSeen,
-			IsDM:        id != "townhall",
+			IsDM:        id != "townhall" && !c.IsGroup,
+			IsGroup:     c.IsGroup,
+			PinCount:    len(c.GetPins()),
+		}
+
+		if snap.IsGroup {
+			snap.Name = c.GetName()
+			snap.Members = c.MemberIDs()
+			snap.CreatedBy = c.CreatedBy
 		}
 
 		if snap.IsDM {
@@ -650,6 +838,7 @@ func (h *Hub) GetChats(userID string) []models.Chat {
 				otherID = parts[1]
 			}
 			snap.OtherID = otherID
+			snap.DisappearAfter = c.GetDisappearAfter()
 		}
 
 		snapshots = append(snapshots, snap)
@@ -666,13 +855,29 @@ func (h *Hub) GetChats(userID string) []models.Chat {
 	var result []models.Chat
 
 	for _, snap := range snapshots {
+		if snap.IsGroup {
+			result = append(result, models.Chat{
+				ID:          snap.ID,
+				Name:        content.Escape(snap.Name),
+				IsGroup:     true,
+				Members:     snap.Members,
+				CreatedBy:   snap.CreatedBy,
+				FirstSeq:    int(snap.FirstSeq),
+				LastSeq:     int(snap.LastSeq),
+				LastSeenSeq: snap.LastSeenSeq,
+				PinCount:    snap.PinCount,
+			})
+			continue
+		}
 		if !snap.IsDM {
 			result = append(result, models.Chat{
 				ID:          snap.ID,
 				Name:        "Town Hall",
 				AvatarURL:   "/besedka.png",
+				FirstSeq:    int(snap.FirstSeq),
 				LastSeq:     int(snap.LastSeq),
 				LastSeenSeq: snap.LastSeenSeq,
+				PinCount:    snap.PinCount,
 			})
 			continue
 		}
@@ -692,12 +897,15 @@ func (h *Hub) GetChats(userID string) []models.Chat {
 		h.mu.Unlock()
 
 		result = append(result, models.Chat{
-			ID:          snap.ID,
-			Name:        name,
-			IsDM:        true,
-			Online:      online,
-			LastSeq:     int(snap.LastSeq),
-			LastSeenSeq: snap.LastSeenSeq,
+			ID:             snap.ID,
+			Name:           name,
+			IsDM:           true,
+			Online:         online,
+			FirstSeq:       int(snap.FirstSeq),
+			LastSeq:        int(snap.LastSeq),
+			LastSeenSeq:    snap.LastSeenSeq,
+			PinCount:       snap.PinCount,
+			DisappearAfter: snap.DisappearAfter,
 		})
 	}
 
@@ -725,7 +933,7 @@ func (h *Hub) GetChatRecords(userID, chatID string, from, to int64) ([]models.Me
 		return nil, models.ErrNotFound
 	}
 
-	if c.ID != "townhall" && !isUserInDM(userID, c.ID) {
+	if !canAccess(userID, c) {
 		return nil, models.ErrNotFound
 	}
 
@@ -734,7 +942,55 @@ func (h *Hub) GetChatRecords(userID, chatID string, from, to int64) ([]models.Me
 		return nil, err
 	}
 
-	return mapRecordsToMessages(records), nil
+	return h.messagesFor(c, records), nil
+}
+
+// GetChatRecordsAt returns the messages of chatID with the given seqs in
+// ascending seq order, skipping seqs that don't exist. Records no longer in
+// memory are loaded from storage at once.
+func (h *Hub) GetChatRecordsAt(userID, chatID string, seqs []int64) ([]models.Message, error) {
+	h.mu.RLock()
+	c, ok := h.chats[chatID]
+	h.mu.RUnlock()
+
+	if !ok || !canAccess(userID, c) {
+		return nil, models.ErrNotFound
+	}
+
+	at := make([]chat.Seq, len(seqs))
+	for i, seq := range seqs {
+		at[i] = chat.Seq(seq)
+	}
+	records, err := c.GetRecordsAt(at)
+	if err != nil {
+		return nil, err
+	}
+	return h.messagesFor(c, records), nil
+}
+
+// ChatIDs returns the IDs of the chats userID can access.
+func (h *Hub) ChatIDs(userID string) []string {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	var ids []string
+	for id, c := range h.chats {
+		if canAccess(userID, c) {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// GetChat returns the chat as listed for userID, or models.ErrNotFound when
+// the user can't access it.
+func (h *Hub) GetChat(userID, chatID string) (models.Chat, error) {
+	for _, c := range h.GetChats(userID) {
+		if c.ID == chatID {
+			return c, nil
+		}
+	}
+	return models.Chat{}, models.ErrNotFound
 }
 
 func (h *Hub) GetUser(userID string) (models.User, error) {
@@ -742,6 +998,10 @@ func (h *Hub) GetUser(userID string) (models.User, error) {
 }
 
 func (h *Hub) handleRecordCallback(receiverID string, chatID string, record chat.ChatRecord) {
+	if h.botNotifier != nil && receiverID != record.UserID {
+		h.notifyBot(receiverID, chatID, record)
+	}
+
 	h.mu.RLock()
 	channels, online := h.connectedUsers[receiverID]
 
@@ -755,10 +1015,19 @@ func (h *Hub) handleRecordCallback(receiverID string, chatID string, record chat
 			}
 		}
 
+		var messages []models.Message
+		if c, ok := h.chats[chatID]; ok {
+			messages = h.messagesFor(c, []chat.ChatRecord{record})
+		} else {
+			messages = mapRecordsToMessages([]chat.ChatRecord{record})
+		}
+		if !models.IsReplyPreviewVisible(chatID, receiverUser) {
+			messages = stripReplyPreviews(messages)
+		}
 		msg := models.ServerMessage{
 			Type:     models.ServerMessageTypeMessages,
 			ChatID:   chatID,
-			Messages: mapRecordsToMessages([]chat.ChatRecord{record}),
+			Messages: messages,
 		}
 
 		for _, ch := range channels {
@@ -777,6 +1046,9 @@ func (h *Hub) handleRecordCallback(receiverID string, chatID string, record chat
 			// Send push notification if user is offline AND is not the sender
 			sender, _ := h.userProvider.GetUser(record.UserID)
 			senderName := sender.DisplayName
+			if record.Sender != nil && record.Sender.Name != "" {
+				senderName = record.Sender.Name
+			}
 			if senderName == "" {
 				senderName = sender.UserName
 			}
@@ -816,6 +1088,31 @@ func mapRecordsToMessages(records []chat.ChatRecord) []models.Message {
 			RawContent:  content.Sanitize(formatted),
 			Timestamp:   r.Timestamp,
 			Attachments: r.Attachments,
+			EditedAt:    r.EditedAt,
+			Deleted:     r.Deleted,
+			Reactions:   r.Reactions,
+			ExpiresAt:   r.ExpiresAt,
+		}
+		if r.DisappearAfter != nil {
+			after := *r.DisappearAfter
+			messages[i].DisappearAfter = &after
+		}
+		if r.ReplyTo != nil {
+			ref := *r.ReplyTo
+			messages[i].ReplyTo = &ref
+		}
+		if r.Sender != nil {
+			sender := *r.Sender
+			messages[i].Sender = &sender
+		}
+		for _, p := range r.Previews {
+			messages[i].Previews = append(messages[i].Previews, escapePreview(p))
+		}
+		for _, rev := range r.Revisions {
+			messages[i].Revisions = append(messages[i].Revisions, models.MessageRevision{
+				Content:   content.FormatMessage(rev.Content),
+				Timestamp: rev.Timestamp,
+			})
 		}
 	}
 	return messages
@@ -4,6 +4,7 @@ import (
 	"besedka/internal/models"
 	"context"
 	"fmt"
+	"slices"
 	"sync"
 	"testing"
 	"time"
@@ -32,6 +33,7 @@ type MockStorage struct {
 	messages map[string][]models.Message
 	chats    map[string]models.Chat
 	lastSeen []models.LastSeenEntry
+	files    map[string]string // file ID to uploader
 	mu       sync.Mutex
 }
 
@@ -39,10 +41,17 @@ func NewMockStorage() *MockStorage {
 	return &MockStorage{
 		messages: make(map[string][]models.Message),
 		chats:    make(map[string]models.Chat),
+		files:    make(map[string]string),
 	}
 }
 
 func (m *MockStorage) UpsertMessage(msg models.Message) error {
+	for i, r := range m.messages[msg.ChatID] {
+		if r.Seq == msg.Seq {
+			m.messages[msg.ChatID][i] = msg
+			return nil
+		}
+	}
 	m.messages[msg.ChatID] = append(m.messages[msg.ChatID], msg)
 	return nil
 }
@@ -59,6 +68,31 @@ func (m *MockStorage) ListMessages(chatID string, from, to int64) ([]models.Mess
 	return results, nil
 }
 
+func (m *MockStorage) GetMessages(chatID string, seqs []int64) ([]models.Message, error) {
+	var results []models.Message
+	for _, r := range m.messages[chatID] {
+		if slices.Contains(seqs, r.Seq) {
+			results = append(results, r)
+		}
+	}
+	slices.SortFunc(results, func(a, b models.Message) int { return int(a.Seq - b.Seq) })
+	return results, nil
+}
+
+func (m *MockStorage) ListReplies(chatID string, seq, after int64, limit int) ([]int64, error) {
+	var seqs []int64
+	for _, r := range m.messages[chatID] {
+		if r.ReplyTo != nil && r.ReplyTo.Seq == seq && r.Seq > after {
+			seqs = append(seqs, r.Seq)
+		}
+	}
+	slices.Sort(seqs)
+	if len(seqs) > limit {
+		seqs = seqs[:limit]
+	}
+	return seqs, nil
+}
+
 func (m *MockStorage) ListChats() ([]models.Chat, error) {
 	var results []models.Chat
 	for _, c := range m.chats {
@@ -99,6 +133,26 @@ func (m *MockStorage) ListLastSeen() ([]models.LastSeenEntry, error) {
 	return copied, nil
 }
 
+func (m *MockStorage) SetDisappearAfter(chatID string, seconds int64) error {
+	c, ok := m.chats[chatID]
+	if !ok {
+		return models.ErrNotFound
+	}
+	c.DisappearAfter = seconds
+	m.chats[chatID] = c
+	return nil
+}
+
+func (m *MockStorage) FileUploader(id string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	uploader, ok := m.files[id]
+	if !ok {
+		return "", models.ErrNotFound
+	}
+	return uploader, nil
+}
+
 type MockPushService struct{}
 
 func (m *MockPushService) SendNotification(userID string, payload []byte) error {
@@ -992,3 +1046,35 @@ Loop1:
 	}
 }
 
+
+func TestHub_DisconnectSession(t *testing.T) {
+	user1 := models.User{ID: "u1", DisplayName: "User 1"}
+	provider := &MockUserProvider{
+		users: []models.User{user1},
+	}
+	h := NewHub(context.Background(), provider, NewMockStorage(), &MockPushService{})
+
+	ch1 := h.Join(user1.ID)
+	ch2 := h.Join(user1.ID)
+	h.SetSession(user1.ID, ch1, "s1")
+	h.SetSession(user1.ID, ch2, "s2")
+
+	h.DisconnectSession(user1.ID, "s1")
+
+	timeout := time.After(time.Second)
+	for open := true; open; {
+		select {
+		case _, open = <-ch1:
+		case <-timeout:
+			t.Fatal("expected the revoked session's connection to be closed")
+		}
+	}
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	if channels := h.connectedUsers[user1.ID]; len(channels) != 1 || channels[0] != ch2 {
+		t.Errorf("expected only the other session to stay connected, got %d connections", len(channels))
+	}
+	if _, ok := h.sessions[ch1]; ok {
+		t.Error("expected the closed connection to be forgotten")
+	}
+}
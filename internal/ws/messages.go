@@ -0,0 +1,235 @@
+package ws
+
+import (
+	"errors"
+	"slices"
+	"time"
+	"unicode/utf8"
+
+	"besedka/internal/chat"
+	"besedka/internal/content"
+	"besedka/internal/models"
+)
+
+const (
+	maxReactionRunes   = 16
+	maxReactionsPerMsg = 32
+	maxRevisions       = 10 // Older revisions are dropped on further edits
+)
+
+var (
+	ErrEmptyMessage      = errors.New("message content cannot be empty")
+	ErrInvalidReaction   = errors.New("invalid reaction")
+	ErrCannotPost        = errors.New("user cannot post in this chat")
+	ErrForeignAttachment = errors.New("attachment was not uploaded by the sender")
+)
+
+// EditMessage replaces the content of a message authored by userID and keeps
+// the previous version in the record's revision history. Only the last
+// maxRevisions versions are kept.
+func (h *Hub) EditMessage(userID, chatID string, seq int64, newContent string) (models.Message, error) {
+	if newContent == "" {
+		return models.Message{}, ErrEmptyMessage
+	}
+
+	c, err := h.writableChat(userID, chatID)
+	if err != nil {
+		return models.Message{}, err
+	}
+
+	record, err := c.UpdateRecord(chat.Seq(seq), func(r *chat.ChatRecord) error {
+		if r.UserID != userID {
+			return chat.ErrNotAuthor
+		}
+		if r.Deleted {
+			return models.ErrNotFound
+		}
+		written := r.EditedAt
+		if written == 0 {
+			written = r.Timestamp
+		}
+		r.Revisions = append(r.Revisions, models.MessageRevision{
+			Content:   r.Content,
+			Timestamp: written,
+		})
+		if extra := len(r.Revisions) - maxRevisions; extra > 0 {
+			r.Revisions = slices.Clone(r.Revisions[extra:])
+		}
+		r.Content = newContent
+		r.FormattedContent = content.FormatMessage(newContent)
+		r.EditedAt = time.Now().Unix()
+		r.Previews = nil
+		return nil
+	})
+	if err != nil {
+		return models.Message{}, err
+	}
+
+	h.broadcastRecordUpdate(c, models.ServerMessageTypeEdited, record)
+	h.unfurlRecord(c, record.Seq, newContent)
+	return h.messagesFor(c, []chat.ChatRecord{record})[0], nil
+}
+
+// DeleteMessage replaces a message authored by userID with a tombstone.
+func (h *Hub) DeleteMessage(userID, chatID string, seq int64) error {
+	c, err := h.writableChat(userID, chatID)
+	if err != nil {
+		return err
+	}
+	return h.deleteRecord(c, seq, userID)
+}
+
+// AdminDeleteMessage replaces any message with a tombstone.
+func (h *Hub) AdminDeleteMessage(chatID string, seq int64) error {
+	h.mu.RLock()
+	c, ok := h.chats[chatID]
+	h.mu.RUnlock()
+
+	if !ok {
+		return models.ErrNotFound
+	}
+	return h.deleteRecord(c, seq, "")
+}
+
+// deleteRecord tombstones a record, keeping its seq so range fetches stay
+// contiguous. An empty authorID skips the author check.
+func (h *Hub) deleteRecord(c *chat.Chat, seq int64, authorID string) error {
+	// Bots that only read mentions must learn about the deletion too, so the
+	// mentions are taken from the content before it is cleared.
+	var mentions []string
+	record, err := c.UpdateRecord(chat.Seq(seq), func(r *chat.ChatRecord) error {
+		if authorID != "" && r.UserID != authorID {
+			return chat.ErrNotAuthor
+		}
+		mentions = content.ExtractMentions(r.Content)
+		r.Content = ""
+		r.FormattedContent = ""
+		r.Attachments = nil
+		r.Revisions = nil
+		r.Reactions = nil
+		r.Previews = nil
+		r.Deleted = true
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	h.broadcastToVisible(c, mentions, models.ServerMessage{
+		Type:     models.ServerMessageTypeMessageDeleted,
+		ChatID:   c.ID,
+		Messages: h.messagesFor(c, []chat.ChatRecord{record}),
+	})
+	h.unpinDeleted(c, seq)
+	return nil
+}
+
+// React adds or removes userID's emoji reaction on a message. A reaction is a
+// single emoji. Adding a reaction twice or removing a missing one is a no-op.
+func (h *Hub) React(userID, chatID string, seq int64, emoji string, add bool) error {
+	if utf8.RuneCountInString(emoji) > maxReactionRunes || !isEmoji(emoji) {
+		return ErrInvalidReaction
+	}
+
+	c, err := h.writableChat(userID, chatID)
+	if err != nil {
+		return err
+	}
+
+	changed := false
+	record, err := c.UpdateRecord(chat.Seq(seq), func(r *chat.ChatRecord) error {
+		if r.Deleted {
+			return models.ErrNotFound
+		}
+		reactions, err := updateReactions(r.Reactions, userID, emoji, add)
+		if err != nil {
+			return err
+		}
+		changed = len(reactions) != len(r.Reactions) || !slices.EqualFunc(reactions, r.Reactions, func(a, b models.Reaction) bool {
+			return a.Emoji == b.Emoji && a.Count == b.Count
+		})
+		r.Reactions = reactions
+		return nil
+	})
+	if err != nil || !changed {
+		return err
+	}
+
+	typ := models.ServerMessageTypeUnreacted
+	if add {
+		typ = models.ServerMessageTypeReacted
+	}
+	h.broadcastToMembers(c, record, models.ServerMessage{
+		Type:   typ,
+		ChatID: c.ID,
+		Seq:    seq,
+		UserID: userID,
+		Emoji:  emoji,
+	})
+	return nil
+}
+
+// updateReactions returns a copy of reactions with userID's emoji added or
+// removed. Emojis nobody uses any more are dropped.
+func updateReactions(reactions []models.Reaction, userID, emoji string, add bool) ([]models.Reaction, error) {
+	result := make([]models.Reaction, 0, len(reactions)+1)
+	found := false
+	for _, r := range reactions {
+		if r.Emoji != emoji {
+			result = append(result, r)
+			continue
+		}
+		found = true
+		users := slices.DeleteFunc(slices.Clone(r.UserIDs), func(id string) bool { return id == userID })
+		if add {
+			users = append(users, userID)
+		}
+		if len(users) > 0 {
+			result = append(result, models.Reaction{Emoji: emoji, Count: len(users), UserIDs: users})
+		}
+	}
+	if add && !found {
+		if len(reactions) >= maxReactionsPerMsg {
+			return nil, ErrInvalidReaction
+		}
+		result = append(result, models.Reaction{Emoji: emoji, Count: 1, UserIDs: []string{userID}})
+	}
+	return result, nil
+}
+
+// broadcastRecordUpdate sends a changed record to every online chat member
+// who is allowed to see it.
+func (h *Hub) broadcastRecordUpdate(c *chat.Chat, typ models.ServerMessageType, record chat.ChatRecord) {
+	h.broadcastToMembers(c, record, models.ServerMessage{
+		Type:     typ,
+		ChatID:   c.ID,
+		Messages: h.messagesFor(c, []chat.ChatRecord{record}),
+	})
+}
+
+// broadcastToMembers sends msg about record to every online chat member who is
+// allowed to see the record.
+func (h *Hub) broadcastToMembers(c *chat.Chat, record chat.ChatRecord, msg models.ServerMessage) {
+	h.broadcastToVisible(c, content.ExtractMentions(record.Content), msg)
+}
+
+// broadcastToVisible sends msg to every online chat member who is allowed to
+// see a message with mentions.
+func (h *Hub) broadcastToVisible(c *chat.Chat, mentions []string, msg models.ServerMessage) {
+	for _, memberID := range c.MemberIDs() {
+		if !h.IsUserOnline(memberID) {
+			continue
+		}
+		u, err := h.userProvider.GetUser(memberID)
+		if err == nil && !models.IsMessageVisible(c.ID, mentions, u) {
+			continue
+		}
+		if !models.IsReplyPreviewVisible(c.ID, u) {
+			stripped := msg
+			stripped.Messages = stripReplyPreviews(msg.Messages)
+			h.sendToUser(memberID, stripped)
+			continue
+		}
+		h.sendToUser(memberID, msg)
+	}
+}
@@ -0,0 +1,250 @@
+package ws
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"besedka/internal/chat"
+	"besedka/internal/models"
+)
+
+func TestHub_EditMessage(t *testing.T) {
+	user1 := models.User{ID: "u1", DisplayName: "User 1"}
+	user2 := models.User{ID: "u2", DisplayName: "User 2"}
+	provider := &MockUserProvider{users: []models.User{user1, user2}}
+	store := NewMockStorage()
+	h := NewHub(context.Background(), provider, store, &MockPushService{})
+
+	ch1 := h.Join(user1.ID)
+	ch2 := h.Join(user2.ID)
+	drainMessages(ch1, 1)
+
+	h.Dispatch(user1.ID, models.ClientMessage{Type: models.ClientMessageTypeSend, ChatID: "townhall", Content: "helo"}, ch1)
+	expectMessages(t, ch2, "townhall")
+
+	if _, err := h.EditMessage(user2.ID, "townhall", 1, "hijacked"); !errors.Is(err, chat.ErrNotAuthor) {
+		t.Errorf("expected ErrNotAuthor, got %v", err)
+	}
+	if _, err := h.EditMessage(user1.ID, "townhall", 1, ""); !errors.Is(err, ErrEmptyMessage) {
+		t.Errorf("expected ErrEmptyMessage, got %v", err)
+	}
+	if _, err := h.EditMessage(user1.ID, "townhall", 42, "hello"); !errors.Is(err, models.ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+
+	h.Dispatch(user1.ID, models.ClientMessage{Type: models.ClientMessageTypeEdit, ChatID: "townhall", Seq: 1, Content: "hello"}, ch1)
+	edited := expectChatEvent(t, ch2, models.ServerMessageTypeEdited, "townhall")
+	msg := edited.Messages[0]
+	if !strings.Contains(msg.Content, "hello") || msg.EditedAt == 0 {
+		t.Errorf("unexpected edited message: %+v", msg)
+	}
+	if len(msg.Revisions) != 1 || !strings.Contains(msg.Revisions[0].Content, "helo") {
+		t.Errorf("expected original content in revisions, got %+v", msg.Revisions)
+	}
+
+	stored := store.messages["townhall"]
+	if len(stored) != 1 || stored[0].Content != "hello" || len(stored[0].Revisions) != 1 {
+		t.Errorf("edit not persisted: %+v", stored)
+	}
+
+	records, err := h.GetChatRecords(user2.ID, "townhall", 1, 1)
+	if err != nil {
+		t.Fatalf("GetChatRecords failed: %v", err)
+	}
+	if !strings.Contains(records[0].Content, "hello") {
+		t.Errorf("expected edited content from ring buffer, got %q", records[0].Content)
+	}
+
+	for i := range maxRevisions + 5 {
+		if _, err := h.EditMessage(user1.ID, "townhall", 1, fmt.Sprintf("edit %d", i)); err != nil {
+			t.Fatalf("EditMessage failed: %v", err)
+		}
+	}
+	revisions := store.messages["townhall"][0].Revisions
+	if len(revisions) != maxRevisions {
+		t.Fatalf("expected %d revisions kept, got %d", maxRevisions, len(revisions))
+	}
+	if !strings.Contains(revisions[maxRevisions-1].Content, fmt.Sprintf("edit %d", maxRevisions+3)) {
+		t.Errorf("expected newest revisions kept, got %+v", revisions)
+	}
+}
+
+func TestHub_DeleteMessage(t *testing.T) {
+	user1 := models.User{ID: "u1", DisplayName: "User 1"}
+	user2 := models.User{ID: "u2", DisplayName: "User 2"}
+	provider := &MockUserProvider{users: []models.User{user1, user2}}
+	store := NewMockStorage()
+	h := NewHub(context.Background(), provider, store, &MockPushService{})
+
+	ch1 := h.Join(user1.ID)
+	ch2 := h.Join(user2.ID)
+	drainMessages(ch1, 1)
+
+	for _, text := range []string{"first", "second", "third"} {
+		store.files["f-"+text] = user1.ID
+		h.Dispatch(user1.ID, models.ClientMessage{
+			Type:        models.ClientMessageTypeSend,
+			ChatID:      "townhall",
+			Content:     text,
+			Attachments: []models.Attachment{{Type: models.AttachmentTypeFile, FileID: "f-" + text}},
+		}, ch1)
+		expectMessages(t, ch2, "townhall")
+	}
+
+	if err := h.DeleteMessage(user2.ID, "townhall", 2); !errors.Is(err, chat.ErrNotAuthor) {
+		t.Errorf("expected ErrNotAuthor, got %v", err)
+	}
+
+	h.Dispatch(user1.ID, models.ClientMessage{Type: models.ClientMessageTypeDelete, ChatID: "townhall", Seq: 2}, ch1)
+	deleted := expectChatEvent(t, ch2, models.ServerMessageTypeMessageDeleted, "townhall")
+	if tomb := deleted.Messages[0]; tomb.Seq != 2 || !tomb.Deleted || tomb.Content != "" || len(tomb.Attachments) != 0 {
+		t.Errorf("unexpected tombstone: %+v", tomb)
+	}
+
+	if _, err := h.EditMessage(user1.ID, "townhall", 2, "resurrected"); !errors.Is(err, models.ErrNotFound) {
+		t.Errorf("expected deleted message to be uneditable, got %v", err)
+	}
+
+	// Admins can delete anyone's message.
+	if err := h.AdminDeleteMessage("townhall", 3); err != nil {
+		t.Fatalf("AdminDeleteMessage failed: %v", err)
+	}
+	expectChatEvent(t, ch2, models.ServerMessageTypeMessageDeleted, "townhall")
+
+	records, err := h.GetChatRecords(user2.ID, "townhall", 1, 3)
+	if err != nil {
+		t.Fatalf("GetChatRecords failed: %v", err)
+	}
+	if len(records) != 3 {
+		t.Fatalf("expected tombstones to keep their seq, got %d records", len(records))
+	}
+	if records[0].Deleted || !records[1].Deleted || !records[2].Deleted {
+		t.Errorf("unexpected deleted flags: %+v", records)
+	}
+
+	stored := store.messages["townhall"]
+	if !stored[1].Deleted || stored[1].Content != "" || stored[1].Attachments != nil {
+		t.Errorf("tombstone not persisted: %+v", stored[1])
+	}
+}
+
+func TestHub_DeleteMessageReachesMentionedBot(t *testing.T) {
+	user1 := models.User{ID: "u1", DisplayName: "User 1"}
+	bot := models.User{ID: "b1", UserName: "helper", Type: models.UserTypeBot, BotPermissions: models.BotPermissions{ReadMentions: true}}
+	provider := &MockUserProvider{users: []models.User{user1, bot}}
+	h := NewHub(context.Background(), provider, NewMockStorage(), &MockPushService{})
+
+	ch1 := h.Join(user1.ID)
+	chBot := h.Join(bot.ID)
+	drainMessages(ch1, 2)
+
+	h.Dispatch(user1.ID, models.ClientMessage{Type: models.ClientMessageTypeSend, ChatID: "townhall", Content: "hi @helper"}, ch1)
+	expectMessages(t, chBot, "townhall")
+
+	if err := h.DeleteMessage(user1.ID, "townhall", 1); err != nil {
+		t.Fatalf("DeleteMessage failed: %v", err)
+	}
+	deleted := expectChatEvent(t, chBot, models.ServerMessageTypeMessageDeleted, "townhall")
+	if !deleted.Messages[0].Deleted {
+		t.Errorf("expected tombstone, got %+v", deleted.Messages[0])
+	}
+}
+
+func TestHub_React(t *testing.T) {
+	user1 := models.User{ID: "u1", DisplayName: "User 1"}
+	user2 := models.User{ID: "u2", DisplayName: "User 2"}
+	provider := &MockUserProvider{users: []models.User{user1, user2}}
+	store := NewMockStorage()
+	h := NewHub(context.Background(), provider, store, &MockPushService{})
+
+	ch1 := h.Join(user1.ID)
+	ch2 := h.Join(user2.ID)
+	drainMessages(ch1, 1)
+
+	h.Dispatch(user1.ID, models.ClientMessage{Type: models.ClientMessageTypeSend, ChatID: "townhall", Content: "lunch?"}, ch1)
+	expectMessages(t, ch2, "townhall")
+
+	for _, emoji := range []string{"", "<b>", "ok", "lol 👍", "👍👍", "a⃣"} {
+		if err := h.React(user1.ID, "townhall", 1, emoji, true); !errors.Is(err, ErrInvalidReaction) {
+			t.Errorf("React(%q): expected ErrInvalidReaction, got %v", emoji, err)
+		}
+	}
+
+	h.Dispatch(user1.ID, models.ClientMessage{Type: models.ClientMessageTypeReact, ChatID: "townhall", Seq: 1, Emoji: "👍"}, ch1)
+	delta := expectChatEvent(t, ch2, models.ServerMessageTypeReacted, "townhall")
+	if delta.Seq != 1 || delta.UserID != user1.ID || delta.Emoji != "👍" {
+		t.Errorf("unexpected reaction delta: %+v", delta)
+	}
+
+	for _, r := range []struct {
+		userID string
+		emoji  string
+	}{{user2.ID, "👍"}, {user2.ID, "🍕"}, {user2.ID, "👍"}} {
+		if err := h.React(r.userID, "townhall", 1, r.emoji, true); err != nil {
+			t.Fatalf("React failed: %v", err)
+		}
+	}
+	if err := h.React(user1.ID, "townhall", 1, "🍕", false); err != nil {
+		t.Fatalf("removing a missing reaction should be a no-op, got %v", err)
+	}
+
+	records, err := h.GetChatRecords(user1.ID, "townhall", 1, 1)
+	if err != nil {
+		t.Fatalf("GetChatRecords failed: %v", err)
+	}
+	reactions := records[0].Reactions
+	if len(reactions) != 2 || reactions[0].Emoji != "👍" || reactions[0].Count != 2 || reactions[1].Emoji != "🍕" || reactions[1].Count != 1 {
+		t.Fatalf("unexpected reactions: %+v", reactions)
+	}
+
+	h.Dispatch(user2.ID, models.ClientMessage{Type: models.ClientMessageTypeUnreact, ChatID: "townhall", Seq: 1, Emoji: "🍕"}, ch2)
+	expectChatEvent(t, ch1, models.ServerMessageTypeUnreacted, "townhall")
+
+	stored := store.messages["townhall"][0].Reactions
+	if len(stored) != 1 || stored[0].Emoji != "👍" || len(stored[0].UserIDs) != 2 {
+		t.Errorf("reactions not persisted: %+v", stored)
+	}
+}
+
+// newReadOnlyBotHub returns a hub with a bot that may read the town hall but
+// not write to it, and a message the bot wrote there before losing write
+// access.
+func newReadOnlyBotHub(t *testing.T) (*Hub, models.User) {
+	t.Helper()
+	user1 := models.User{ID: "u1", DisplayName: "User 1"}
+	bot := models.User{ID: "b1", UserName: "reader", Type: models.UserTypeBot, BotPermissions: models.BotPermissions{ReadAll: true}}
+	provider := &MockUserProvider{users: []models.User{user1, bot}}
+	h := NewHub(context.Background(), provider, NewMockStorage(), &MockPushService{})
+
+	h.mu.RLock()
+	c := h.chats["townhall"]
+	h.mu.RUnlock()
+	if _, err := c.AddRecord(chat.ChatRecord{UserID: bot.ID, Content: "written while it could"}); err != nil {
+		t.Fatalf("AddRecord failed: %v", err)
+	}
+	return h, bot
+}
+
+func TestHub_EditMessageReadOnlyBot(t *testing.T) {
+	h, bot := newReadOnlyBotHub(t)
+	if _, err := h.EditMessage(bot.ID, "townhall", 1, "changed"); !errors.Is(err, ErrCannotPost) {
+		t.Errorf("expected ErrCannotPost, got %v", err)
+	}
+}
+
+func TestHub_DeleteMessageReadOnlyBot(t *testing.T) {
+	h, bot := newReadOnlyBotHub(t)
+	if err := h.DeleteMessage(bot.ID, "townhall", 1); !errors.Is(err, ErrCannotPost) {
+		t.Errorf("expected ErrCannotPost, got %v", err)
+	}
+}
+
+func TestHub_ReactReadOnlyBot(t *testing.T) {
+	h, bot := newReadOnlyBotHub(t)
+	if err := h.React(bot.ID, "townhall", 1, "👍", true); !errors.Is(err, ErrCannotPost) {
+		t.Errorf("expected ErrCannotPost, got %v", err)
+	}
+}
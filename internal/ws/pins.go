@@ -0,0 +1,181 @@
+package ws
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+
+	"besedka/internal/chat"
+	"besedka/internal/models"
+)
+
+const maxPinsPerChat = 50
+
+var ErrTooManyPins = errors.New("a chat can have at most 50 pinned messages")
+
+// PinMessage pins or unpins a message in a chat userID is a member of.
+// Pinning a pinned message or unpinning one that is not pinned is a no-op.
+func (h *Hub) PinMessage(userID, chatID string, seq int64, pin bool) error {
+	c, err := h.writableChat(userID, chatID)
+	if err != nil {
+		return err
+	}
+
+	record, err := getRecord(c, seq)
+	if err != nil {
+		return err
+	}
+	if pin && record.Deleted {
+		return models.ErrNotFound
+	}
+
+	h.groupsMu.Lock()
+	pins := c.GetPins()
+	idx := slices.Index(pins, seq)
+	switch {
+	case pin && idx >= 0, !pin && idx < 0:
+		h.groupsMu.Unlock()
+		return nil
+	case pin:
+		if len(pins) >= maxPinsPerChat {
+			h.groupsMu.Unlock()
+			return ErrTooManyPins
+		}
+		pins = append([]int64{seq}, pins...)
+	default:
+		pins = slices.Delete(pins, idx, idx+1)
+	}
+	err = h.savePins(c, pins)
+	h.groupsMu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	typ := models.ServerMessageTypeUnpinned
+	if pin {
+		typ = models.ServerMessageTypePinned
+	}
+	h.broadcastToMembers(c, record, models.ServerMessage{
+		Type:   typ,
+		ChatID: c.ID,
+		Seq:    seq,
+		UserID: userID,
+	})
+	return nil
+}
+
+// GetPins returns the pinned messages of a chat, most recently pinned first.
+func (h *Hub) GetPins(userID, chatID string) ([]models.Message, error) {
+	h.mu.RLock()
+	c, ok := h.chats[chatID]
+	h.mu.RUnlock()
+
+	if !ok || !canAccess(userID, c) {
+		return nil, models.ErrNotFound
+	}
+
+	var records []chat.ChatRecord
+	for _, seq := range c.GetPins() {
+		record, err := getRecord(c, seq)
+		if errors.Is(err, models.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+	return h.messagesFor(c, records), nil
+}
+
+// unpinDeleted drops a deleted message from the pin list and notifies members.
+func (h *Hub) unpinDeleted(c *chat.Chat, seq int64) {
+	h.groupsMu.Lock()
+	pins := c.GetPins()
+	idx := slices.Index(pins, seq)
+	if idx < 0 {
+		h.groupsMu.Unlock()
+		return
+	}
+	err := h.savePins(c, slices.Delete(pins, idx, idx+1))
+	h.groupsMu.Unlock()
+	if err != nil {
+		slog.Error("failed to unpin deleted message", "chatID", c.ID, "seq", seq, "error", err)
+		return
+	}
+
+	h.broadcastToMembers(c, chat.ChatRecord{Seq: chat.Seq(seq)}, models.ServerMessage{
+		Type:   models.ServerMessageTypeUnpinned,
+		ChatID: c.ID,
+		Seq:    seq,
+	})
+}
+
+// savePins persists a new pin list and applies it to c. h.groupsMu must be held.
+func (h *Hub) savePins(c *chat.Chat, pins []int64) error {
+	info := chatInfo(c)
+	info.Pins = pins
+	if err := h.storage.UpsertChat(info); err != nil {
+		return fmt.Errorf("failed to persist pins: %w", err)
+	}
+	c.SetPins(pins)
+	return nil
+}
+
+// unpinWhere unpins the messages of c matching drop, which are being deleted,
+// and tells the chat members.
+func (h *Hub) unpinWhere(c *chat.Chat, drop func(seq int64) bool) {
+	h.groupsMu.Lock()
+	var kept, unpinned []int64
+	for _, seq := range c.GetPins() {
+		if drop(seq) {
+			unpinned = append(unpinned, seq)
+		} else {
+			kept = append(kept, seq)
+		}
+	}
+	var err error
+	if len(unpinned) > 0 {
+		err = h.savePins(c, kept)
+	}
+	h.groupsMu.Unlock()
+	if err != nil {
+		slog.Error("failed to unpin deleted messages", "chatID", c.ID, "error", err)
+		return
+	}
+
+	for _, seq := range unpinned {
+		h.broadcastToMembers(c, chat.ChatRecord{Seq: chat.Seq(seq)}, models.ServerMessage{
+			Type:   models.ServerMessageTypeUnpinned,
+			ChatID: c.ID,
+			Seq:    seq,
+		})
+	}
+}
+
+// chatInfo returns the persisted form of c.
+func chatInfo(c *chat.Chat) models.Chat {
+	if c.IsGroup {
+		return groupInfo(c)
+	}
+	return models.Chat{
+		ID:      c.ID,
+		Name:    c.GetName(),
+		IsDM:    strings.HasPrefix(c.ID, "dm_"),
+		Pins:    c.GetPins(),
+		LastSeq: int(c.GetLastSeq()),
+	}
+}
+
+func getRecord(c *chat.Chat, seq int64) (chat.ChatRecord, error) {
+	records, err := c.GetRecords(chat.Seq(seq), chat.Seq(seq))
+	if err != nil {
+		return chat.ChatRecord{}, err
+	}
+	if len(records) != 1 {
+		return chat.ChatRecord{}, models.ErrNotFound
+	}
+	return records[0], nil
+}
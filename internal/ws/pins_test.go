@@ -0,0 +1,97 @@
+package ws
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"besedka/internal/models"
+)
+
+func TestHub_Pins(t *testing.T) {
+	user1 := models.User{ID: "u1", DisplayName: "User 1"}
+	user2 := models.User{ID: "u2", DisplayName: "User 2"}
+	user3 := models.User{ID: "u3", DisplayName: "User 3"}
+	provider := &MockUserProvider{users: []models.User{user1, user2, user3}}
+	store := NewMockStorage()
+	h := NewHub(context.Background(), provider, store, &MockPushService{})
+
+	ch1 := h.Join(user1.ID)
+	ch2 := h.Join(user2.ID)
+	drainMessages(ch1, 1)
+	drainMessages(ch2, 1)
+
+	for _, text := range []string{"wifi password: hunter2", "address: 1 Main St", "hello"} {
+		h.Dispatch(user1.ID, models.ClientMessage{Type: models.ClientMessageTypeSend, ChatID: "townhall", Content: text}, ch1)
+	}
+
+	if err := h.PinMessage(user1.ID, "townhall", 42, true); !errors.Is(err, models.ErrNotFound) {
+		t.Errorf("expected ErrNotFound for missing message, got %v", err)
+	}
+	dmID := getDMID(user1.ID, user2.ID)
+	if err := h.PinMessage(user3.ID, dmID, 1, true); !errors.Is(err, models.ErrNotFound) {
+		t.Errorf("expected ErrNotFound for non-member, got %v", err)
+	}
+
+	h.Dispatch(user2.ID, models.ClientMessage{Type: models.ClientMessageTypePin, ChatID: "townhall", Seq: 1}, ch2)
+	msg := expectChatEvent(t, ch1, models.ServerMessageTypePinned, "townhall")
+	if msg.Seq != 1 || msg.UserID != user2.ID {
+		t.Errorf("unexpected pinned event: %+v", msg)
+	}
+	if err := h.PinMessage(user1.ID, "townhall", 2, true); err != nil {
+		t.Fatalf("PinMessage failed: %v", err)
+	}
+	// Pinning twice is a no-op.
+	if err := h.PinMessage(user1.ID, "townhall", 2, true); err != nil {
+		t.Fatalf("PinMessage failed: %v", err)
+	}
+
+	pins, err := h.GetPins(user1.ID, "townhall")
+	if err != nil {
+		t.Fatalf("GetPins failed: %v", err)
+	}
+	if len(pins) != 2 || pins[0].Seq != 2 || pins[1].Seq != 1 {
+		t.Fatalf("expected pins [2 1], got %+v", pins)
+	}
+	for _, c := range h.GetChats(user2.ID) {
+		if c.ID == "townhall" && c.PinCount != 2 {
+			t.Errorf("expected PinCount 2, got %d", c.PinCount)
+		}
+	}
+
+	// Deleting a pinned message unpins it.
+	if err := h.DeleteMessage(user1.ID, "townhall", 2); err != nil {
+		t.Fatalf("DeleteMessage failed: %v", err)
+	}
+	msg = expectChatEvent(t, ch2, models.ServerMessageTypeUnpinned, "townhall")
+	if msg.Seq != 2 {
+		t.Errorf("expected seq 2 unpinned, got %d", msg.Seq)
+	}
+	if err := h.PinMessage(user1.ID, "townhall", 2, true); !errors.Is(err, models.ErrNotFound) {
+		t.Errorf("expected ErrNotFound pinning deleted message, got %v", err)
+	}
+
+	// Pins survive a restart.
+	h2 := NewHub(context.Background(), provider, store, &MockPushService{})
+	pins, err = h2.GetPins(user2.ID, "townhall")
+	if err != nil {
+		t.Fatalf("GetPins failed: %v", err)
+	}
+	if len(pins) != 1 || pins[0].Seq != 1 {
+		t.Errorf("expected pins [1] after restart, got %+v", pins)
+	}
+
+	if err := h2.PinMessage(user1.ID, "townhall", 1, false); err != nil {
+		t.Fatalf("unpin failed: %v", err)
+	}
+	if pins, _ := h2.GetPins(user1.ID, "townhall"); len(pins) != 0 {
+		t.Errorf("expected no pins, got %+v", pins)
+	}
+}
+
+func TestHub_PinMessageReadOnlyBot(t *testing.T) {
+	h, bot := newReadOnlyBotHub(t)
+	if err := h.PinMessage(bot.ID, "townhall", 1, true); !errors.Is(err, ErrCannotPost) {
+		t.Errorf("expected ErrCannotPost, got %v", err)
+	}
+}
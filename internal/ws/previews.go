@@ -0,0 +1,112 @@
+package ws
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"besedka/internal/chat"
+	"besedka/internal/content"
+	"besedka/internal/models"
+)
+
+const (
+	maxPreviewsPerMessage = 3
+	unfurlTimeout         = 20 * time.Second
+)
+
+var errStalePreview = errors.New("message changed while unfurling links")
+
+// LinkUnfurler fetches link previews for URLs in messages.
+type LinkUnfurler interface {
+	Unfurl(ctx context.Context, url string) (models.LinkPreview, error)
+}
+
+// SetUnfurler enables link previews. It must be called before the hub serves clients.
+func (h *Hub) SetUnfurler(u LinkUnfurler) {
+	h.unfurler = u
+}
+
+type unfurlTask struct {
+	c    *chat.Chat
+	seq  chat.Seq
+	text string
+	urls []string
+}
+
+// unfurlRecord queues fetching previews for the links in text. A worker
+// attaches them to the record, unless it has been edited or deleted since.
+// Links are not unfurled when the queue is full.
+func (h *Hub) unfurlRecord(c *chat.Chat, seq chat.Seq, text string) {
+	if h.unfurler == nil {
+		return
+	}
+	urls := content.ExtractURLs(text)
+	if len(urls) == 0 {
+		return
+	}
+	if len(urls) > maxPreviewsPerMessage {
+		urls = urls[:maxPreviewsPerMessage]
+	}
+
+	select {
+	case h.unfurlQueue <- unfurlTask{c: c, seq: seq, text: text, urls: urls}:
+	default:
+		slog.Warn("Link preview queue full, dropping previews", "chatID", c.ID, "seq", seq)
+	}
+}
+
+func (h *Hub) unfurlWorker(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case task := <-h.unfurlQueue:
+			h.unfurl(ctx, task)
+		}
+	}
+}
+
+func (h *Hub) unfurl(ctx context.Context, task unfurlTask) {
+	ctx, cancel := context.WithTimeout(ctx, unfurlTimeout)
+	defer cancel()
+
+	var previews []models.LinkPreview
+	for _, u := range task.urls {
+		p, err := h.unfurler.Unfurl(ctx, u)
+		if err != nil {
+			continue
+		}
+		previews = append(previews, p)
+	}
+	if len(previews) == 0 {
+		return
+	}
+
+	record, err := task.c.UpdateRecord(task.seq, func(r *chat.ChatRecord) error {
+		if r.Deleted || r.Content != task.text {
+			return errStalePreview
+		}
+		r.Previews = previews
+		return nil
+	})
+	if err != nil {
+		if !errors.Is(err, errStalePreview) {
+			slog.Warn("failed to attach link previews", "chatID", task.c.ID, "seq", task.seq, "error", err)
+		}
+		return
+	}
+	h.broadcastRecordUpdate(task.c, models.ServerMessageTypePreviews, record)
+}
+
+// escapePreview escapes the text fields of a preview fetched from a third-party site.
+func escapePreview(p models.LinkPreview) models.LinkPreview {
+	return models.LinkPreview{
+		URL:         content.Escape(p.URL),
+		Title:       content.Escape(p.Title),
+		Description: content.Escape(p.Description),
+		SiteName:    content.Escape(p.SiteName),
+		ImageID:     p.ImageID,
+	}
+}
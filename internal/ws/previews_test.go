@@ -0,0 +1,111 @@
+package ws
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"besedka/internal/models"
+)
+
+type fakeUnfurler struct{}
+
+func (fakeUnfurler) Unfurl(_ context.Context, url string) (models.LinkPreview, error) {
+	if url == "https://example.com/none" {
+		return models.LinkPreview{}, errors.New("no preview")
+	}
+	return models.LinkPreview{URL: url, Title: "<b>Example</b>"}, nil
+}
+
+func TestHub_LinkPreviews(t *testing.T) {
+	user1 := models.User{ID: "u1", DisplayName: "User 1"}
+	user2 := models.User{ID: "u2", DisplayName: "User 2"}
+	provider := &MockUserProvider{users: []models.User{user1, user2}}
+	store := NewMockStorage()
+	h := NewHub(context.Background(), provider, store, &MockPushService{})
+	h.SetUnfurler(fakeUnfurler{})
+
+	ch1 := h.Join(user1.ID)
+	ch2 := h.Join(user2.ID)
+	drainMessages(ch1, 1)
+	drainMessages(ch2, 1)
+
+	h.Dispatch(user1.ID, models.ClientMessage{Type: models.ClientMessageTypeSend, ChatID: "townhall", Content: "see https://example.com/a and https://example.com/none"}, ch1)
+	msg := expectChatEvent(t, ch2, models.ServerMessageTypePreviews, "townhall")
+	if len(msg.Messages) != 1 || msg.Messages[0].Seq != 1 {
+		t.Fatalf("unexpected previews event: %+v", msg)
+	}
+	previews := msg.Messages[0].Previews
+	if len(previews) != 1 || previews[0].URL != "https://example.com/a" {
+		t.Fatalf("expected one preview, got %+v", previews)
+	}
+	if previews[0].Title != "&lt;b&gt;Example&lt;/b&gt;" {
+		t.Errorf("expected escaped title, got %q", previews[0].Title)
+	}
+
+	stored := store.messages["townhall"][0]
+	if len(stored.Previews) != 1 || stored.Previews[0].Title != "<b>Example</b>" {
+		t.Errorf("expected preview to be persisted unescaped, got %+v", stored.Previews)
+	}
+
+	// Editing drops the old previews and unfurls the new links.
+	if _, err := h.EditMessage(user1.ID, "townhall", 1, "now https://example.com/b"); err != nil {
+		t.Fatalf("EditMessage failed: %v", err)
+	}
+	msg = expectChatEvent(t, ch2, models.ServerMessageTypePreviews, "townhall")
+	if previews := msg.Messages[0].Previews; len(previews) != 1 || previews[0].URL != "https://example.com/b" {
+		t.Errorf("expected preview for edited link, got %+v", previews)
+	}
+}
+
+type blockingUnfurler struct {
+	mu      sync.Mutex
+	running int
+	peak    int
+	release chan struct{}
+}
+
+func (u *blockingUnfurler) Unfurl(ctx context.Context, url string) (models.LinkPreview, error) {
+	u.mu.Lock()
+	u.running++
+	u.peak = max(u.peak, u.running)
+	u.mu.Unlock()
+	defer func() {
+		u.mu.Lock()
+		u.running--
+		u.mu.Unlock()
+	}()
+	select {
+	case <-u.release:
+	case <-ctx.Done():
+	}
+	return models.LinkPreview{URL: url}, nil
+}
+
+func TestHub_LinkPreviewWorkers(t *testing.T) {
+	user1 := models.User{ID: "u1", DisplayName: "User 1"}
+	provider := &MockUserProvider{users: []models.User{user1}}
+	h := NewHub(context.Background(), provider, NewMockStorage(), &MockPushService{})
+	unfurler := &blockingUnfurler{release: make(chan struct{})}
+	h.SetUnfurler(unfurler)
+
+	ch1 := h.Join(user1.ID)
+	drainMessages(ch1, 1)
+
+	for range unfurlWorkers * 2 {
+		h.Dispatch(user1.ID, models.ClientMessage{Type: models.ClientMessageTypeSend, ChatID: "townhall", Content: "https://example.com/slow"}, ch1)
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(unfurler.release)
+
+	for range unfurlWorkers * 2 {
+		expectChatEvent(t, ch1, models.ServerMessageTypePreviews, "townhall")
+	}
+	unfurler.mu.Lock()
+	defer unfurler.mu.Unlock()
+	if unfurler.peak != unfurlWorkers {
+		t.Errorf("expected at most %d unfurls at once, got %d", unfurlWorkers, unfurler.peak)
+	}
+}
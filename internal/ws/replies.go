@@ -0,0 +1,136 @@
+package ws
+
+import (
+	"errors"
+	"html"
+	"log/slog"
+
+	"besedka/internal/chat"
+	"besedka/internal/content"
+	"besedka/internal/models"
+)
+
+const (
+	replyPreviewRunes = 100
+	// MaxRepliesPage is the most replies GetReplies returns at once.
+	MaxRepliesPage = 100
+)
+
+var ErrInvalidReply = errors.New("reply must reference an existing message in the same chat")
+
+// validateReplyRef checks that ref points to an existing message in c and
+// returns a copy holding only the reference fields.
+func validateReplyRef(c *chat.Chat, ref *models.ReplyRef) (*models.ReplyRef, error) {
+	if ref == nil {
+		return nil, nil
+	}
+	chatID := ref.ChatID
+	if chatID == "" {
+		chatID = c.ID
+	}
+	if chatID != c.ID || ref.Seq < 1 || ref.Seq > c.GetLastSeq() {
+		return nil, ErrInvalidReply
+	}
+	return &models.ReplyRef{ChatID: chatID, Seq: ref.Seq}, nil
+}
+
+// messagesFor maps records to messages and fills in the quoted preview of
+// every message that is a reply. The replied-to records are loaded at once.
+func (h *Hub) messagesFor(c *chat.Chat, records []chat.ChatRecord) []models.Message {
+	messages := mapRecordsToMessages(records)
+	var seqs []chat.Seq
+	for _, m := range messages {
+		if m.ReplyTo != nil {
+			seqs = append(seqs, chat.Seq(m.ReplyTo.Seq))
+		}
+	}
+	if len(seqs) == 0 {
+		return messages
+	}
+	loaded, err := c.GetRecordsAt(seqs)
+	if err != nil {
+		slog.Error("failed to load replied-to messages", "chatID", c.ID, "error", err)
+		return messages
+	}
+	parents := make(map[int64]chat.ChatRecord, len(loaded))
+	for _, p := range loaded {
+		parents[int64(p.Seq)] = p
+	}
+
+	for i := range messages {
+		ref := messages[i].ReplyTo
+		if ref == nil {
+			continue
+		}
+		parent, ok := parents[ref.Seq]
+		if !ok {
+			ref.Deleted = true
+			continue
+		}
+		ref.UserID = parent.UserID
+		ref.Deleted = parent.Deleted
+		if !parent.Deleted {
+			ref.Preview = replyPreview(parent)
+		}
+	}
+	return messages
+}
+
+// GetReplies returns up to limit messages in chatID that reply to seq and
+// come after the seq after, oldest first. limit is capped at MaxRepliesPage.
+func (h *Hub) GetReplies(userID, chatID string, seq, after int64, limit int) ([]models.Message, error) {
+	h.mu.RLock()
+	c, ok := h.chats[chatID]
+	h.mu.RUnlock()
+
+	if !ok || !canAccess(userID, c) {
+		return nil, models.ErrNotFound
+	}
+	last := c.GetLastSeq()
+	if seq < 1 || seq > last {
+		return nil, models.ErrNotFound
+	}
+
+	if limit <= 0 || limit > MaxRepliesPage {
+		limit = MaxRepliesPage
+	}
+	replySeqs, err := h.storage.ListReplies(c.ID, seq, after, limit)
+	if err != nil {
+		return nil, err
+	}
+	seqs := make([]chat.Seq, len(replySeqs))
+	for i, s := range replySeqs {
+		seqs[i] = chat.Seq(s)
+	}
+	replies, err := c.GetRecordsAt(seqs)
+	if err != nil {
+		return nil, err
+	}
+	return h.messagesFor(c, replies), nil
+}
+
+// replyPreview returns a short escaped plain-text excerpt of a record.
+func replyPreview(r chat.ChatRecord) string {
+	formatted := r.FormattedContent
+	if formatted == "" {
+		formatted = content.FormatMessage(r.Content)
+	}
+	text := []rune(html.UnescapeString(content.Sanitize(formatted)))
+	if len(text) > replyPreviewRunes {
+		text = append(text[:replyPreviewRunes], '…')
+	}
+	return content.Escape(string(text))
+}
+
+func stripReplyPreviews(messages []models.Message) []models.Message {
+	stripped := make([]models.Message, len(messages))
+	for i, m := range messages {
+		if m.ReplyTo != nil {
+			ref := *m.ReplyTo
+			ref.Preview = ""
+			m.ReplyTo = &ref
+		}
+		stripped[i] = m
+	}
+	return stripped
+}
@@ -0,0 +1,105 @@
+package ws
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"besedka/internal/models"
+)
+
+func TestHub_Replies(t *testing.T) {
+	user1 := models.User{ID: "u1", DisplayName: "User 1"}
+	user2 := models.User{ID: "u2", DisplayName: "User 2"}
+	bot := models.User{ID: "b1", UserName: "helper", Type: models.UserTypeBot, BotPermissions: models.BotPermissions{ReadMentions: true}}
+	provider := &MockUserProvider{users: []models.User{user1, user2, bot}}
+	store := NewMockStorage()
+	h := NewHub(context.Background(), provider, store, &MockPushService{})
+
+	ch1 := h.Join(user1.ID)
+	ch2 := h.Join(user2.ID)
+	chBot := h.Join(bot.ID)
+	drainMessages(ch1, 2)
+	drainMessages(ch2, 1)
+
+	long := strings.Repeat("a", 150) + " & more"
+	h.Dispatch(user1.ID, models.ClientMessage{Type: models.ClientMessageTypeSend, ChatID: "townhall", Content: long}, ch1)
+	expectMessages(t, ch2, "townhall")
+	h.Dispatch(user1.ID, models.ClientMessage{Type: models.ClientMessageTypeSend, ChatID: "townhall", Content: "unrelated"}, ch1)
+	expectMessages(t, ch2, "townhall")
+
+	// Replies must point into the same chat.
+	dmID := getDMID(user1.ID, user2.ID)
+	h.Dispatch(user2.ID, models.ClientMessage{
+		Type: models.ClientMessageTypeSend, ChatID: dmID, Content: "leak",
+		ReplyTo: &models.ReplyRef{ChatID: "townhall", Seq: 1},
+	}, ch2)
+	if seq := h.chats[dmID].GetLastSeq(); seq != 0 {
+		t.Errorf("expected cross-chat reply to be rejected, LastSeq %d", seq)
+	}
+
+	h.Dispatch(user2.ID, models.ClientMessage{
+		Type: models.ClientMessageTypeSend, ChatID: "townhall", Content: "agreed @helper",
+		ReplyTo: &models.ReplyRef{Seq: 1},
+	}, ch2)
+	msg := expectMessages(t, ch1, "townhall").Messages[0]
+	for msg.Seq != 3 {
+		msg = expectMessages(t, ch1, "townhall").Messages[0]
+	}
+	ref := msg.ReplyTo
+	if ref == nil || ref.ChatID != "townhall" || ref.Seq != 1 || ref.UserID != user1.ID {
+		t.Fatalf("unexpected reply reference: %+v", ref)
+	}
+	if !strings.HasPrefix(ref.Preview, strings.Repeat("a", 100)) || !strings.HasSuffix(ref.Preview, "…") {
+		t.Errorf("expected truncated preview, got %q", ref.Preview)
+	}
+
+	// A mention-only bot sees the reply but not the quote.
+	botMsg := expectMessages(t, chBot, "townhall").Messages[0]
+	if botMsg.ReplyTo == nil || botMsg.ReplyTo.Preview != "" {
+		t.Errorf("expected preview hidden from bot, got %+v", botMsg.ReplyTo)
+	}
+
+	replies, err := h.GetReplies(user1.ID, "townhall", 1, 0, 0)
+	if err != nil {
+		t.Fatalf("GetReplies failed: %v", err)
+	}
+	if len(replies) != 1 || replies[0].Seq != 3 {
+		t.Errorf("expected reply seq 3, got %+v", replies)
+	}
+	if replies[0].ReplyTo == nil || replies[0].ReplyTo.Preview == "" {
+		t.Errorf("expected reply preview, got %+v", replies[0].ReplyTo)
+	}
+
+	// Replies are paged by seq.
+	h.Dispatch(user1.ID, models.ClientMessage{
+		Type: models.ClientMessageTypeSend, ChatID: "townhall", Content: "me too",
+		ReplyTo: &models.ReplyRef{Seq: 1},
+	}, ch1)
+	if page, err := h.GetReplies(user1.ID, "townhall", 1, 0, 1); err != nil || len(page) != 1 || page[0].Seq != 3 {
+		t.Errorf("expected first page with seq 3, got %+v %v", page, err)
+	}
+	if page, err := h.GetReplies(user1.ID, "townhall", 1, 3, 1); err != nil || len(page) != 1 || page[0].Seq != 4 {
+		t.Errorf("expected second page with seq 4, got %+v %v", page, err)
+	}
+	if _, err := h.GetReplies(user1.ID, "townhall", 99, 0, 0); !errors.Is(err, models.ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+
+	// Deleting the parent hides the preview.
+	if err := h.DeleteMessage(user1.ID, "townhall", 1); err != nil {
+		t.Fatalf("DeleteMessage failed: %v", err)
+	}
+	records, err := h.GetChatRecords(user1.ID, "townhall", 3, 3)
+	if err != nil {
+		t.Fatalf("GetChatRecords failed: %v", err)
+	}
+	if ref := records[0].ReplyTo; ref == nil || !ref.Deleted || ref.Preview != "" {
+		t.Errorf("expected deleted parent reference, got %+v", ref)
+	}
+
+	if stored := store.messages["townhall"][2].ReplyTo; stored == nil || stored.Seq != 1 || stored.Preview != "" {
+		t.Errorf("expected only the reference to be stored, got %+v", stored)
+	}
+}
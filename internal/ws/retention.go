@@ -0,0 +1,21 @@
+package ws
+
+import (
+	"besedka/internal/chat"
+)
+
+// TrimChat drops the messages before firstSeq from a chat whose older
+// messages are being deleted by retention, and unpins any of them. Call it
+// before deleting the messages from storage, so they cannot be edited back in
+// while the deletion runs.
+func (h *Hub) TrimChat(chatID string, firstSeq int64) {
+	h.mu.RLock()
+	c, ok := h.chats[chatID]
+	h.mu.RUnlock()
+	if !ok {
+		return
+	}
+
+	c.Trim(chat.Seq(firstSeq))
+	h.unpinWhere(c, func(seq int64) bool { return seq < firstSeq })
+}
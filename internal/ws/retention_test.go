@@ -0,0 +1,42 @@
+package ws
+
+import (
+	"context"
+	"testing"
+
+	"besedka/internal/models"
+)
+
+func TestHub_TrimChat(t *testing.T) {
+	user1 := models.User{ID: "u1", DisplayName: "User 1"}
+	provider := &MockUserProvider{users: []models.User{user1}}
+	h := NewHub(context.Background(), provider, NewMockStorage(), &MockPushService{})
+
+	ch1 := h.Join(user1.ID)
+	drainMessages(ch1, 1)
+
+	for _, text := range []string{"one", "two", "three"} {
+		h.Dispatch(user1.ID, models.ClientMessage{Type: models.ClientMessageTypeSend, ChatID: "townhall", Content: text}, ch1)
+	}
+	for _, seq := range []int64{1, 3} {
+		if err := h.PinMessage(user1.ID, "townhall", seq, true); err != nil {
+			t.Fatalf("PinMessage failed: %v", err)
+		}
+	}
+
+	h.TrimChat("townhall", 2)
+
+	msg := expectChatEvent(t, ch1, models.ServerMessageTypeUnpinned, "townhall")
+	if msg.Seq != 1 {
+		t.Errorf("expected seq 1 to be unpinned, got %+v", msg)
+	}
+	msgs, err := h.GetChatRecords(user1.ID, "townhall", 1, 3)
+	if err != nil || len(msgs) != 2 || msgs[0].Seq != 2 {
+		t.Errorf("expected seqs 2 and 3, got %+v %v", msgs, err)
+	}
+	for _, c := range h.GetChats(user1.ID) {
+		if c.ID == "townhall" && (c.FirstSeq != 2 || c.PinCount != 1) {
+			t.Errorf("expected FirstSeq 2 and one pin, got %+v", c)
+		}
+	}
+}
@@ -28,11 +28,11 @@ func NewServer(auth *auth.AuthService, hub *Hub) *Server {
 }
 
 func (s *Server) HandleConnections(w http.ResponseWriter, r *http.Request) {
-	var userID string
+	var userID, sessionID string
 	authHeader := r.Header.Get("Authorization")
 	if strings.HasPrefix(authHeader, "Bearer ") {
 		apiKey := strings.TrimSpace(strings.TrimPrefix(authHeader, "Bearer "))
-		if u, err := s.auth.GetUserByAPIKey(apiKey); err == nil {
+		if u, err := s.auth.GetUserByAPIKey(apiKey, r.RemoteAddr); err == nil {
 			if u.Type == models.UserTypeWebhook {
 				http.Error(w, "Webhooks cannot connect via WebSocket", http.StatusForbidden)
 				return
@@ -53,7 +53,7 @@ func (s *Server) HandleConnections(w http.ResponseWriter, r *http.Request) {
 		}
 
 		if strings.HasPrefix(token, "bsk_") {
-			if u, err := s.auth.GetUserByAPIKey(token); err == nil {
+			if u, err := s.auth.GetUserByAPIKey(token, r.RemoteAddr); err == nil {
 				if u.Type == models.UserTypeWebhook {
 					http.Error(w, "Webhooks cannot connect via WebSocket", http.StatusForbidden)
 					return
@@ -70,6 +70,7 @@ func (s *Server) HandleConnections(w http.ResponseWriter, r *http.Request) {
 				return
 			}
 			userID = id
+			sessionID, _ = s.auth.SessionID(token)
 		}
 	}
 
@@ -104,6 +105,9 @@ func (s *Server) HandleConnections(w http.ResponseWriter, r *http.Request) {
 
 	// Create Connection
 	conn := NewConnection(s.hub, ws, userID)
+	if sessionID != "" {
+		s.hub.SetSession(userID, conn.fromServer, sessionID)
+	}
 
 	// Handle connection (blocks until closed)
 	if err := conn.Handle(r.Context()); err != nil {
@@ -0,0 +1,137 @@
+package ws
+
+import (
+	"time"
+
+	"besedka/internal/chat"
+	"besedka/internal/models"
+)
+
+// typingTimeout is how long a typing indicator stays active without a refresh.
+// Clients are expected to resend "typing" every few seconds while the user types.
+const typingTimeout = 5 * time.Second
+
+type typingEntry struct {
+	timer   *time.Timer
+	expires time.Time
+}
+
+// SetTyping starts or stops the typing indicator of userID in chatID and notifies
+// the other chat members. An active indicator expires on its own after typingTimeout.
+func (h *Hub) SetTyping(userID, chatID string, typing bool) error {
+	h.mu.RLock()
+	c, ok := h.chats[chatID]
+	h.mu.RUnlock()
+
+	if !ok || !canAccess(userID, c) {
+		return models.ErrNotFound
+	}
+
+	key := userChatKey{UserID: userID, ChatID: chatID}
+
+	h.typingMu.Lock()
+	entry, active := h.typing[key]
+	switch {
+	case typing && active:
+		// Refresh without notifying again.
+		entry.expires = time.Now().Add(h.typingTimeout)
+		entry.timer.Reset(h.typingTimeout)
+		h.typingMu.Unlock()
+		return nil
+	case typing:
+		entry = &typingEntry{expires: time.Now().Add(h.typingTimeout)}
+		entry.timer = time.AfterFunc(h.typingTimeout, func() { h.expireTyping(key, entry) })
+		h.typing[key] = entry
+	case active:
+		entry.timer.Stop()
+		delete(h.typing, key)
+	default:
+		h.typingMu.Unlock()
+		return nil
+	}
+	h.typingMu.Unlock()
+
+	msg := typingMessage(chatID, userID, typing)
+	for _, id := range h.typingRecipients(c, userID) {
+		h.sendToUser(id, msg)
+	}
+	return nil
+}
+
+func (h *Hub) expireTyping(key userChatKey, entry *typingEntry) {
+	h.typingMu.Lock()
+	// The entry may have been stopped, replaced or refreshed after the timer fired.
+	if h.typing[key] != entry || time.Now().Before(entry.expires) {
+		h.typingMu.Unlock()
+		return
+	}
+	delete(h.typing, key)
+	h.typingMu.Unlock()
+
+	h.mu.RLock()
+	c, ok := h.chats[key.ChatID]
+	h.mu.RUnlock()
+	if !ok {
+		return
+	}
+	msg := typingMessage(key.ChatID, key.UserID, false)
+	for _, id := range h.typingRecipients(c, key.UserID) {
+		h.sendToUser(id, msg)
+	}
+}
+
+// clearTypingLocked stops all typing indicators of a user who went offline. h.mu must be held.
+func (h *Hub) clearTypingLocked(userID string) {
+	var chatIDs []string
+	h.typingMu.Lock()
+	for key, entry := range h.typing {
+		if key.UserID != userID {
+			continue
+		}
+		entry.timer.Stop()
+		delete(h.typing, key)
+		chatIDs = append(chatIDs, key.ChatID)
+	}
+	h.typingMu.Unlock()
+
+	for _, chatID := range chatIDs {
+		c, ok := h.chats[chatID]
+		if !ok {
+			continue
+		}
+		msg := typingMessage(chatID, userID, false)
+		for _, id := range h.typingRecipients(c, userID) {
+			if channels, online := h.connectedUsers[id]; online {
+				h.sendToChannels(channels, msg, id)
+			}
+		}
+	}
+}
+
+// typingRecipients returns the members of c other than userID that may see its messages.
+func (h *Hub) typingRecipients(c *chat.Chat, userID string) []string {
+	var ids []string
+	for _, id := range c.MemberIDs() {
+		if id == userID || !canAccess(id, c) {
+			continue
+		}
+		u, err := h.userProvider.GetUser(id)
+		if err != nil || !models.IsMessageVisible(c.ID, nil, u) {
+			continue
+		}
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+func typingMessage(chatID, userID string, typing bool) models.ServerMessage {
+	typ := models.ServerMessageTypeStoppedTyping
+	if typing {
+		typ = models.ServerMessageTypeTyping
+	}
+	return models.ServerMessage{
+		Type:   typ,
+		ChatID: chatID,
+		UserID: userID,
+	}
+}
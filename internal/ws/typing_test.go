@@ -0,0 +1,81 @@
+package ws
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"besedka/internal/models"
+)
+
+// expectNoChatEvent fails if a server message of type typ for chatID arrives within wait.
+func expectNoChatEvent(t *testing.T, ch <-chan models.ServerMessage, typ models.ServerMessageType, chatID string, wait time.Duration) {
+	t.Helper()
+	timeout := time.After(wait)
+	for {
+		select {
+		case msg := <-ch:
+			if msg.Type == typ && msg.ChatID == chatID {
+				t.Fatalf("unexpected %s in chat %s", typ, chatID)
+			}
+		case <-timeout:
+			return
+		}
+	}
+}
+
+func TestHub_Typing(t *testing.T) {
+	user1 := models.User{ID: "u1", DisplayName: "User 1"}
+	user2 := models.User{ID: "u2", DisplayName: "User 2"}
+	user3 := models.User{ID: "u3", DisplayName: "User 3"}
+	provider := &MockUserProvider{users: []models.User{user1, user2, user3}}
+	h := NewHub(context.Background(), provider, NewMockStorage(), &MockPushService{})
+	h.typingTimeout = 100 * time.Millisecond
+
+	ch1 := h.Join(user1.ID)
+	ch2 := h.Join(user2.ID)
+	ch3 := h.Join(user3.ID)
+	drainMessages(ch1, 2)
+	drainMessages(ch2, 2)
+	drainMessages(ch3, 2)
+
+	dmID := getDMID(user1.ID, user2.ID)
+	if err := h.SetTyping(user3.ID, dmID, true); !errors.Is(err, models.ErrNotFound) {
+		t.Errorf("expected ErrNotFound for non-member, got %v", err)
+	}
+
+	// Only the other DM member is notified, and the indicator expires on its own.
+	h.Dispatch(user1.ID, models.ClientMessage{Type: models.ClientMessageTypeTyping, ChatID: dmID}, ch1)
+	msg := expectChatEvent(t, ch2, models.ServerMessageTypeTyping, dmID)
+	if msg.UserID != user1.ID {
+		t.Errorf("expected typing from %s, got %s", user1.ID, msg.UserID)
+	}
+	expectChatEvent(t, ch2, models.ServerMessageTypeStoppedTyping, dmID)
+	expectNoChatEvent(t, ch1, models.ServerMessageTypeTyping, dmID, 50*time.Millisecond)
+	expectNoChatEvent(t, ch3, models.ServerMessageTypeTyping, dmID, 50*time.Millisecond)
+
+	// Refreshing keeps the indicator alive without notifying again.
+	h.Dispatch(user1.ID, models.ClientMessage{Type: models.ClientMessageTypeTyping, ChatID: dmID}, ch1)
+	expectChatEvent(t, ch2, models.ServerMessageTypeTyping, dmID)
+	for i := 0; i < 3; i++ {
+		time.Sleep(50 * time.Millisecond)
+		h.Dispatch(user1.ID, models.ClientMessage{Type: models.ClientMessageTypeTyping, ChatID: dmID}, ch1)
+	}
+	select {
+	case msg := <-ch2:
+		t.Fatalf("unexpected message while typing: %+v", msg)
+	default:
+	}
+
+	// Sending a message stops typing.
+	h.Dispatch(user1.ID, models.ClientMessage{Type: models.ClientMessageTypeSend, ChatID: dmID, Content: "hi"}, ch1)
+	expectChatEvent(t, ch2, models.ServerMessageTypeStoppedTyping, dmID)
+
+	// Disconnecting clears the indicator.
+	h.typingTimeout = time.Minute
+	h.Dispatch(user1.ID, models.ClientMessage{Type: models.ClientMessageTypeTyping, ChatID: "townhall"}, ch1)
+	expectChatEvent(t, ch3, models.ServerMessageTypeTyping, "townhall")
+	h.Leave(user1.ID, ch1)
+	expectChatEvent(t, ch3, models.ServerMessageTypeStoppedTyping, "townhall")
+}
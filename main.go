@@ -18,6 +18,7 @@ import (
 	"besedka/internal/assets"
 	"besedka/internal/auth"
 	"besedka/internal/backup"
+	"besedka/internal/botwebhook"
 	"besedka/internal/commands"
 	"besedka/internal/config"
 	"besedka/internal/filestore"
@@ -25,7 +26,9 @@ import (
 	"besedka/internal/images"
 	"besedka/internal/objectstore"
 	"besedka/internal/push"
+	"besedka/internal/retention"
 	"besedka/internal/storage"
+	"besedka/internal/unfurl"
 	"besedka/internal/ws"
 	"besedka/static"
 
@@ -35,19 +38,47 @@ import (
 // cliOptions holds the parsed CLI-mode flags. When any is set, run() dispatches
 // to the matching command and returns instead of booting the servers.
 type cliOptions struct {
-	addUser        string
-	setAvatar      string
-	user           string
-	displayName    string
-	userType       string
-	botPermissions string
-	target         string
-	listUsers      bool
-	deleteUser     string
-	resetPassword  string
-	backup         bool
-	shutdown       bool
-	yes            bool
+	addUser         string
+	setAvatar       string
+	setCallbackURL  string
+	setWebhookChats string
+	createAPIKey    string
+	expires         string
+	listAPIKeys     bool
+	revokeAPIKey    string
+	listSessions    bool
+	revokeSession   string
+	logoutUser      string
+	export          string
+	format          string
+	output          string
+	user            string
+	displayName     string
+	userType        string
+	botPermissions  string
+	scopes          string
+	target          string
+	listUsers       bool
+	deleteUser      string
+	resetPassword   string
+	backup          bool
+	shutdown        bool
+	yes             bool
+	bootstrapAdmin  string
+	adminLogin      string
+	adminLogout     bool
+	addAdmin        string
+	listAdmins      bool
+	deleteAdmin     string
+	adminAudit      bool
+	rekey           bool
+	setRetention    string
+	maxAge          string
+	maxMessages     int
+	resetRetention  string
+	listRetention   bool
+	// db holds the arguments after "besedka db"; nil unless it was given.
+	db []string
 }
 
 func run(ctx context.Context, cli cliOptions) error {
@@ -58,9 +89,27 @@ func run(ctx context.Context, cli cliOptions) error {
 
 	switch {
 	case cli.addUser != "":
-		return commands.AddUser(cli.addUser, cli.displayName, cli.userType, cli.botPermissions, cli.target, cfg)
+		return commands.AddUser(cli.addUser, cli.displayName, cli.userType, cli.botPermissions, cli.scopes, cli.target, cfg)
 	case cli.setAvatar != "":
 		return commands.SetAvatar(cli.setAvatar, cli.user, cfg)
+	case cli.setCallbackURL != "":
+		return commands.SetCallbackURL(cli.setCallbackURL, cli.user, cfg)
+	case cli.setWebhookChats != "":
+		return commands.SetWebhookChats(cli.setWebhookChats, cli.user, cfg)
+	case cli.createAPIKey != "":
+		return commands.CreateAPIKey(cli.createAPIKey, cli.user, cli.expires, cfg)
+	case cli.listAPIKeys:
+		return commands.ListAPIKeys(cli.user, cfg)
+	case cli.revokeAPIKey != "":
+		return commands.RevokeAPIKey(cli.revokeAPIKey, cli.user, cfg)
+	case cli.listSessions:
+		return commands.ListSessions(cli.user, cfg)
+	case cli.revokeSession != "":
+		return commands.RevokeSession(cli.revokeSession, cli.user, cfg)
+	case cli.logoutUser != "":
+		return commands.LogoutUser(cli.logoutUser, cfg)
+	case cli.export != "":
+		return commands.Export(cli.export, cli.user, cli.format, cli.output, cfg)
 	case cli.listUsers:
 		return commands.ListUsers(cfg)
 	case cli.deleteUser != "":
@@ -71,6 +120,30 @@ func run(ctx context.Context, cli cliOptions) error {
 		return commands.Backup(cfg)
 	case cli.shutdown:
 		return commands.Shutdown(cfg)
+	case cli.bootstrapAdmin != "":
+		return commands.BootstrapAdmin(cli.bootstrapAdmin, cfg)
+	case cli.adminLogin != "":
+		return commands.AdminLogin(cli.adminLogin, cfg)
+	case cli.adminLogout:
+		return commands.AdminLogout(cfg)
+	case cli.addAdmin != "":
+		return commands.AddAdmin(cli.addAdmin, cfg)
+	case cli.listAdmins:
+		return commands.ListAdmins(cfg)
+	case cli.deleteAdmin != "":
+		return commands.DeleteAdmin(cli.deleteAdmin, cli.yes, cfg)
+	case cli.adminAudit:
+		return commands.AdminAudit(cli.user, cfg)
+	case cli.rekey:
+		return commands.Rekey(ctx, cfg)
+	case cli.setRetention != "":
+		return commands.SetRetention(cli.setRetention, cli.maxAge, cli.maxMessages, cfg)
+	case cli.resetRetention != "":
+		return commands.ResetRetention(cli.resetRetention, cfg)
+	case cli.listRetention:
+		return commands.ListRetention(cfg)
+	case cli.db != nil:
+		return commands.DB(cli.db, cfg)
 	}
 
 	// Own a cancel so the /api/shutdown endpoint can stop the whole process.
@@ -88,6 +161,13 @@ func run(ctx context.Context, cli cliOptions) error {
 		RPDisplayName: cfg.ChatName,
 		RPID:          baseURL.Hostname(),
 		RPOrigin:      cfg.BaseURL,
+
+		AdminOrigin:         cfg.AdminOrigin,
+		AdminTokenExpiry:    cfg.AdminTokenExpiry,
+		AdminBootstrapToken: cfg.AdminBootstrapToken,
+	}
+	if cfg.PreviousAuthSecret != "" {
+		authConfig.PreviousSecret = base64.StdEncoding.EncodeToString([]byte(cfg.PreviousAuthSecret))
 	}
 
 	// Initialize object storage (optional). objClient is nil when disabled.
@@ -125,7 +205,11 @@ func run(ctx context.Context, cli cliOptions) error {
 		fs = mirror
 	}
 
-	bbStorage, err := storage.NewBboltStorage(cfg.DBFile, []byte(cfg.AuthSecret), fs)
+	var previousKeys [][]byte
+	if cfg.PreviousAuthSecret != "" {
+		previousKeys = append(previousKeys, []byte(cfg.PreviousAuthSecret))
+	}
+	bbStorage, err := storage.NewBboltStorage(cfg.DBFile, []byte(cfg.AuthSecret), fs, previousKeys...)
 	if err != nil {
 		return err
 	}
@@ -141,6 +225,18 @@ func run(ctx context.Context, cli cliOptions) error {
 	if err != nil {
 		return err
 	}
+	if os.Getenv("ADMIN_USER") != "" || os.Getenv("ADMIN_PASSWORD") != "" {
+		slog.Warn("ADMIN_USER and ADMIN_PASSWORD are set but ignored: they no longer create or log in an admin. " +
+			"Admin accounts are kept in the database; remove these variables from the environment")
+	}
+	switch {
+	case authService.HasAdmins():
+	case cfg.AdminBootstrapToken != "":
+		slog.Warn("no admin accounts yet; create the first one with besedka --bootstrap-admin <username> and ADMIN_BOOTSTRAP_TOKEN")
+	default:
+		slog.Warn("no admin accounts yet; create the first one with besedka --bootstrap-admin <username> and this one-time bootstrap token",
+			"bootstrap_token", authService.BootstrapToken())
+	}
 
 	pushService, err := push.NewService(bbStorage)
 	if err != nil {
@@ -148,6 +244,14 @@ func run(ctx context.Context, cli cliOptions) error {
 	}
 
 	hub := ws.NewHub(ctx, authService, bbStorage, pushService)
+	if cfg.LinkPreviews {
+		hub.SetUnfurler(unfurl.New(bbStorage, unfurl.Config{MaxImageSize: cfg.MaxImageSize}))
+	}
+	botHooks := botwebhook.New(bbStorage, authService, botwebhook.Config{})
+	hub.SetBotNotifier(botHooks)
+	if err := hub.SetCommandStore(bbStorage); err != nil {
+		return err
+	}
 
 	// Load assets with substitution
 	assetsFS, err := assets.Load(cfg.ChatName, static.Content)
@@ -160,6 +264,30 @@ func run(ctx context.Context, cli cliOptions) error {
 
 	g, gCtx := errgroup.WithContext(ctx)
 
+	// Deliver queued messages to bots with a callback URL.
+	g.Go(func() error {
+		botHooks.Run(gCtx)
+		return nil
+	})
+
+	// Delete messages past their chat's retention policy or their expiry.
+	janitor := retention.NewJanitor(bbStorage, hub, cfg.RetentionPolicy(), cfg.RetentionInterval)
+	g.Go(func() error {
+		janitor.Run(gCtx)
+		return nil
+	})
+
+	// Re-encrypt records and files still on AUTH_SECRET_PREVIOUS, unless a
+	// previous run already finished.
+	if bbStorage.HasOldKeys() {
+		g.Go(func() error {
+			if err := bbStorage.MigrateKeys(gCtx); err != nil && !errors.Is(err, context.Canceled) {
+				slog.Error("key migration failed", "error", err)
+			}
+			return nil
+		})
+	}
+
 	// Start object-storage background work: mirror upload workers (with backfill
 	// of existing files) and the periodic database backup scheduler.
 	var scheduler *backup.Scheduler
@@ -306,7 +434,8 @@ func main() {
 	displayName := flag.String("display-name", "", "Display name for user, bot, or webhook")
 	userType := flag.String("type", "user", "User type (user, bot, webhook)")
 	botPermissions := flag.String("bot-permissions", "read_all,write", "Bot permissions comma-separated (read_mentions, read_all, write)")
-	target := flag.String("target", "townhall", "Target for webhook ('townhall' or a target user's username)")
+	scopes := flag.String("scopes", "", "Restrict a bot to chats, as <chat id>:<permissions> separated by ';' (overrides --bot-permissions; 'none' for DMs users opt into only)")
+	target := flag.String("target", "townhall", "Target for webhook ('townhall', a target user's username or a group chat ID; comma-separated to allow several, the first is the default)")
 	targetChat := flag.String("target-chat", "", "Deprecated alias for --target")
 	listUsers := flag.Bool("list-users", false, "List all users with their statuses")
 	deleteUser := flag.String("delete-user", "", "Delete a user by username")
@@ -315,7 +444,32 @@ func main() {
 	shutdown := flag.Bool("shutdown", false, "Stop the primary server, take a final backup, and stop the process")
 	yes := flag.Bool("yes", false, "Skip confirmation prompts (e.g. for --delete-user)")
 	setAvatar := flag.String("set-avatar", "", "Set avatar for a user from an image file")
-	user := flag.String("user", "", "Target username for commands like --set-avatar")
+	setCallbackURL := flag.String("set-callback-url", "", "Set the outgoing webhook URL for a bot (requires --user; 'none' removes it)")
+	setWebhookChats := flag.String("set-webhook-chats", "", "Set the comma-separated chats a webhook may post to, like --target (requires --user)")
+	createAPIKey := flag.String("create-api-key", "", "Create an additional named API key for a bot or webhook (requires --user)")
+	expires := flag.String("expires", "", "Expiry for --create-api-key, as a duration (720h) or a date (2026-12-31)")
+	listAPIKeys := flag.Bool("list-api-keys", false, "List the API keys of a bot or webhook (requires --user)")
+	revokeAPIKey := flag.String("revoke-api-key", "", "Revoke an API key of a bot or webhook by its ID (requires --user)")
+	listSessions := flag.Bool("list-sessions", false, "List the login sessions of a user (requires --user)")
+	revokeSession := flag.String("revoke-session", "", "Log a user out of one session by its ID (requires --user)")
+	logoutUser := flag.String("logout-user", "", "Log a user out of all sessions by username")
+	exportChat := flag.String("export", "", "Export a chat's history by chat ID (requires --user, a member of the chat)")
+	format := flag.String("format", "jsonl", "Export format for --export (jsonl, html)")
+	output := flag.String("output", "", "Output file for --export (defaults to besedka-<chat>.jsonl or .zip)")
+	user := flag.String("user", "", "Target username for commands like --set-avatar and --export")
+	bootstrapAdmin := flag.String("bootstrap-admin", "", "Create the first admin account by username, with the bootstrap token from the server log (only while there are no admins)")
+	adminLogin := flag.String("admin-login", "", "Log the CLI in as an admin by username")
+	adminLogout := flag.Bool("admin-logout", false, "Log the CLI admin session out")
+	addAdmin := flag.String("add-admin", "", "Create another admin account by username (prints its TOTP secret)")
+	listAdmins := flag.Bool("list-admins", false, "List admin accounts")
+	deleteAdmin := flag.String("delete-admin", "", "Delete an admin account by username")
+	adminAudit := flag.Bool("admin-audit", false, "Show the admin audit log (--user filters by admin username)")
+	rekey := flag.Bool("rekey", false, "Re-encrypt the database and files from AUTH_SECRET to NEW_AUTH_SECRET (server must be stopped)")
+	setRetention := flag.String("set-retention", "", "Override the message retention policy of a chat by chat ID (with --max-age and --max-messages; neither keeps messages forever)")
+	maxAge := flag.String("max-age", "", "Maximum message age for --set-retention, as a duration (720h)")
+	maxMessages := flag.Int("max-messages", 0, "Maximum number of messages kept for --set-retention")
+	resetRetention := flag.String("reset-retention", "", "Make a chat follow the global retention policy again by chat ID")
+	listRetention := flag.Bool("list-retention", false, "List the global and per-chat message retention policies")
 	flag.Parse()
 
 	targetVal := *target
@@ -324,19 +478,48 @@ func main() {
 	}
 
 	cli := cliOptions{
-		addUser:        *addUser,
-		setAvatar:      *setAvatar,
-		user:           *user,
-		displayName:    *displayName,
-		userType:       *userType,
-		botPermissions: *botPermissions,
-		target:         targetVal,
-		listUsers:      *listUsers,
-		deleteUser:     *deleteUser,
-		resetPassword:  *resetPassword,
-		backup:         *backupFlag,
-		shutdown:       *shutdown,
-		yes:            *yes,
+		addUser:         *addUser,
+		setAvatar:       *setAvatar,
+		setCallbackURL:  *setCallbackURL,
+		setWebhookChats: *setWebhookChats,
+		createAPIKey:    *createAPIKey,
+		expires:         *expires,
+		listAPIKeys:     *listAPIKeys,
+		revokeAPIKey:    *revokeAPIKey,
+		listSessions:    *listSessions,
+		revokeSession:   *revokeSession,
+		logoutUser:      *logoutUser,
+		export:          *exportChat,
+		format:          *format,
+		output:          *output,
+		user:            *user,
+		displayName:     *displayName,
+		userType:        *userType,
+		botPermissions:  *botPermissions,
+		scopes:          *scopes,
+		target:          targetVal,
+		listUsers:       *listUsers,
+		deleteUser:      *deleteUser,
+		resetPassword:   *resetPassword,
+		backup:          *backupFlag,
+		shutdown:        *shutdown,
+		yes:             *yes,
+		bootstrapAdmin:  *bootstrapAdmin,
+		adminLogin:      *adminLogin,
+		adminLogout:     *adminLogout,
+		addAdmin:        *addAdmin,
+		listAdmins:      *listAdmins,
+		deleteAdmin:     *deleteAdmin,
+		adminAudit:      *adminAudit,
+		rekey:           *rekey,
+		setRetention:    *setRetention,
+		maxAge:          *maxAge,
+		maxMessages:     *maxMessages,
+		resetRetention:  *resetRetention,
+		listRetention:   *listRetention,
+	}
+	if args := flag.Args(); len(args) > 0 && args[0] == "db" {
+		cli.db = args[1:]
 	}
 
 	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
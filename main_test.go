@@ -35,12 +35,14 @@ func TestIntegration(t *testing.T) {
 	_ = os.Setenv("ADMIN_ADDR", adminAddr)
 	_ = os.Setenv("API_ADDR", apiAddr)
 	_ = os.Setenv("AUTH_SECRET", "very-secure-test-secret")
+	_ = os.Setenv("ADMIN_BOOTSTRAP_TOKEN", testBootstrapToken)
 	_ = os.Setenv("UPLOADS_PATH", uploadsDir)
 	defer func() {
 		_ = os.Unsetenv("BESEDKA_DB")
 		_ = os.Unsetenv("ADMIN_ADDR")
 		_ = os.Unsetenv("API_ADDR")
 		_ = os.Unsetenv("AUTH_SECRET")
+		_ = os.Unsetenv("ADMIN_BOOTSTRAP_TOKEN")
 		_ = os.Unsetenv("UPLOADS_PATH")
 	}()
 
@@ -77,13 +79,15 @@ func TestIntegration(t *testing.T) {
 		require.Equal(t, "/login.html", location.Path)
 	}
 
+	adminToken := bootstrapTestAdmin(t, adminAddr)
+
 	// Step 1: Create User via Admin API (Invite)
 	username := "testuser"
 	reqBody, _ := json.Marshal(api.AddUserRequest{Username: username})
 	req, err := http.NewRequest("POST", fmt.Sprintf("http://%s/admin/users", adminAddr), bytes.NewBuffer(reqBody))
 	require.NoError(t, err)
 	req.Header.Set("Content-Type", "application/json")
-	req.SetBasicAuth("admin", "1337chat")
+	req.Header.Set("Authorization", "Bearer "+adminToken)
 
 	client := &http.Client{}
 	resp, err := client.Do(req)
@@ -355,7 +359,7 @@ func TestIntegration(t *testing.T) {
 
 	// Delete user via Admin API
 	reqDel, _ := http.NewRequest("DELETE", fmt.Sprintf("http://%s/api/users?id=%s", adminAddr, testUserID), nil)
-	reqDel.SetBasicAuth("admin", "1337chat")
+	reqDel.Header.Set("Authorization", "Bearer "+adminToken)
 	client = &http.Client{}
 	respDel, err := client.Do(reqDel)
 	require.NoError(t, err)
@@ -382,15 +386,13 @@ func TestIntegration(t *testing.T) {
 
 func waitForServer(t *testing.T, urlStr string, retries int) {
 	req, _ := http.NewRequest("GET", urlStr, nil)
-	req.SetBasicAuth("admin", "1337chat") // Use default creds
 	client := &http.Client{Timeout: 500 * time.Millisecond}
 
 	for i := 0; i < retries; i++ {
 		resp, err := client.Do(req)
 		if err == nil {
 			_ = resp.Body.Close()
-			// Accept 200 OK or 401 Unauthorized (invalid auth but server is up)
-			// But since we send auth, we expect 200 or at least not connection refused.
+			// Any response, even 401 Unauthorized, means the server is up.
 			return
 		}
 		time.Sleep(100 * time.Millisecond)
@@ -432,3 +434,25 @@ func makeLargeWebP(t *testing.T) []byte {
 	}
 	return append(data, make([]byte, 105*1024)...)
 }
+
+// testBootstrapToken is the ADMIN_BOOTSTRAP_TOKEN test servers run with.
+const testBootstrapToken = "test-bootstrap-token"
+
+// bootstrapTestAdmin creates the first admin account of a freshly started
+// server and returns its token.
+func bootstrapTestAdmin(t *testing.T, adminAddr string) string {
+	t.Helper()
+	body, _ := json.Marshal(api.BootstrapAdminRequest{
+		AdminCredentialsRequest: api.AdminCredentialsRequest{Username: "admin", Password: "test-admin-password"},
+		BootstrapToken:          testBootstrapToken,
+	})
+	resp, err := http.Post(fmt.Sprintf("http://%s/api/admins/bootstrap", adminAddr), "application/json", bytes.NewReader(body))
+	require.NoError(t, err)
+	defer func() { _ = resp.Body.Close() }()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var result api.BootstrapAdminResponse
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&result))
+	require.NotEmpty(t, result.Token)
+	return result.Token
+}
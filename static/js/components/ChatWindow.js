@@ -101,7 +101,14 @@ export function createChatWindow(container) {
                 <div class="avatar" style="width:32px; height:32px; font-size: 14px;"></div>
                 <h3 style="margin-left: 10px;"></h3>
             </div>
-            <div class="actions"></div>
+            <div class="actions">
+                <select class="disappear-select" id="disappear-select" title="Disappearing messages" aria-label="Disappearing messages" style="display:none">
+                    <option value="0">Messages kept</option>
+                    <option value="3600">Disappear after 1 hour</option>
+                    <option value="86400">Disappear after 1 day</option>
+                    <option value="604800">Disappear after 1 week</option>
+                </select>
+            </div>
         </div>
         <div class="messages-container" id="messages-container">
             <div class="history-loading" style="display:none">
@@ -132,6 +139,7 @@ export function createChatWindow(container) {
     const elements = {
         headerAvatar: container.querySelector('.chat-header .avatar'),
         headerTitle: container.querySelector('.chat-header h3'),
+        disappearSelect: container.querySelector('#disappear-select'),
         messagesContainer: container.querySelector('#messages-container'),
         historyLoading: container.querySelector('.history-loading'),
         input: container.querySelector('#message-input'),
@@ -155,10 +163,15 @@ export function createChatWindow(container) {
         if (!isMe) {
             senderUser = state.users.find(u => u.id === msg.userId);
             senderDisplayName = senderUser ? senderUser.displayName : msg.userId;
+            // Webhooks may post under a per-message name; the badge below
+            // still marks the message as coming from the webhook.
+            if (msg.senderOverride?.name) {
+                senderDisplayName = msg.senderOverride.name;
+            }
         }
 
         const div = document.createElement('div');
-        div.className = `message-line ${isMe ? 'is-me' : ''}`;
+        div.className = `message-line ${isMe ? 'is-me' : ''} ${msg.disappearAfter != null ? 'is-announcement' : ''}`;
         div.setAttribute('data-seq', msg.seq);
 
         const attachmentsFragment = document.createDocumentFragment();
@@ -231,6 +244,9 @@ export function createChatWindow(container) {
             b.className = `user-type-badge ${senderUser.type}-badge`;
             b.textContent = senderUser.type === 'bot' ? ' 🤖' : ' ⚡';
             b.title = senderUser.type === 'bot' ? 'Bot' : 'Webhook';
+            if (msg.senderOverride?.name) {
+                b.title += ` (${senderUser.displayName})`;
+            }
             senderSpan.appendChild(b);
         }
         senderSpan.style.cursor = 'pointer';
@@ -404,10 +420,22 @@ export function createChatWindow(container) {
             }
         }
 
+        // Disappearing messages can only be set in DMs.
+        elements.disappearSelect.style.display = activeChat.isDm ? '' : 'none';
+        elements.disappearSelect.value = String(activeChat.disappearAfter || 0);
+
         // 2. Update Loading State
         elements.historyLoading.style.display = isLoading ? 'flex' : 'none';
 
         // 3. Surgical Message Updates
+        // Drop disappearing messages that expired.
+        const rendered = elements.messagesContainer.querySelectorAll('.message-line');
+        if (rendered.length > messages.length) {
+            const seqs = new Set(messages.map(m => m.seq));
+            rendered.forEach(el => {
+                if (!seqs.has(Number(el.dataset.seq))) el.remove();
+            });
+        }
         if (messages.length > 0) {
             // Initial render
             if (firstRenderedSeq === 0) {
@@ -504,7 +532,9 @@ export function createChatWindow(container) {
             if (c.scrollTop <= 100 && !store.state.isLoadingHistory?.[lastChatId]) {
                 const msgs = store.state.messages[lastChatId] || [];
                 const minSeq = msgs.length > 0 ? msgs[0].seq : 0;
-                if (minSeq > 1) {
+                // Messages before firstSeq were deleted by retention.
+                const chat = store.state.chats.find(c => c.id === lastChatId);
+                if (minSeq > Math.max(1, chat?.firstSeq || 0)) {
                     store.fetchMessages(lastChatId, minSeq - 100, minSeq - 1);
                 }
             }
@@ -607,6 +637,9 @@ export function createChatWindow(container) {
     const mentionCtrl = attachMentionAutocomplete(elements.input, store);
 
     elements.sendBtn.addEventListener('click', handleSend);
+    elements.disappearSelect.addEventListener('change', () => {
+        store.setDisappearingTimer(lastChatId, Number(elements.disappearSelect.value));
+    });
     elements.input.addEventListener('input', () => {
         elements.input.style.height = 'auto';
         elements.input.style.height = `${Math.max(40, elements.input.scrollHeight)}px`;
@@ -111,6 +111,28 @@ export function createProfileSettingsModal(store) {
                 <div id="passkey-success" class="success-text" style="display:none;"></div>
             </div>
 
+            <!-- Recovery Codes Section -->
+            <div class="profile-section">
+                <h3>Recovery Codes</h3>
+                <p class="text-muted">One-time codes you can enter instead of a 2FA code if you lose your authenticator. Generating new codes invalidates the old ones.</p>
+                <p id="recovery-codes-left" class="text-muted"></p>
+                <pre id="recovery-codes-list" style="display:none;"></pre>
+                <input type="password" id="recovery-codes-password" class="form-control" placeholder="Current password" autocomplete="current-password">
+                <input type="text" id="recovery-codes-code" class="form-control" placeholder="2FA code or recovery code" autocomplete="one-time-code">
+                <button class="btn btn-secondary" id="recovery-codes-btn">Generate New Codes</button>
+                <div id="recovery-codes-error" class="error-text" style="display:none;"></div>
+            </div>
+
+            <!-- Sessions Section -->
+            <div class="profile-section">
+                <h3>Sessions</h3>
+                <p class="text-muted">Devices where you are signed in. Revoking a session signs that device out.</p>
+                <div id="sessions-list" class="passkeys-list">
+                    <!-- Loaded dynamically -->
+                </div>
+                <div id="session-error" class="error-text" style="display:none;"></div>
+            </div>
+
             <!-- Password Reset Section -->
             <div class="profile-section danger-zone">
                 <h3 class="danger-text">Reset Password</h3>
@@ -226,6 +248,18 @@ export function createProfileSettingsModal(store) {
     const passkeyError = document.getElementById('passkey-error');
     const passkeySuccess = document.getElementById('passkey-success');
 
+    // Recovery Codes
+    const recoveryCodesLeft = document.getElementById('recovery-codes-left');
+    const recoveryCodesList = document.getElementById('recovery-codes-list');
+    const recoveryCodesBtn = document.getElementById('recovery-codes-btn');
+    const recoveryCodesPassword = document.getElementById('recovery-codes-password');
+    const recoveryCodesCode = document.getElementById('recovery-codes-code');
+    const recoveryCodesError = document.getElementById('recovery-codes-error');
+
+    // Sessions
+    const sessionsList = document.getElementById('sessions-list');
+    const sessionError = document.getElementById('session-error');
+
     // --- Helpers ---
     const closeModal = () => {
         overlay.remove();
@@ -248,6 +282,8 @@ export function createProfileSettingsModal(store) {
         passwordResetError.style.display = 'none';
         passkeyError.style.display = 'none';
         passkeySuccess.style.display = 'none';
+        sessionError.style.display = 'none';
+        recoveryCodesError.style.display = 'none';
     };
 
     // --- Event Listeners ---
@@ -513,6 +549,98 @@ export function createProfileSettingsModal(store) {
         window.location.href = '/login.html';
     });
 
+    // Recovery Codes Logic
+    if (store.state.currentUser?.passkeyOnly) {
+        recoveryCodesBtn.closest('.profile-section').style.display = 'none';
+    }
+    const showRecoveryCodesLeft = () => {
+        const left = store.state.currentUser?.recoveryCodesLeft;
+        recoveryCodesLeft.textContent = left === undefined ? '' : `${left} unused code(s) left.`;
+    };
+    showRecoveryCodesLeft();
+
+    recoveryCodesBtn.addEventListener('click', async () => {
+        resetMessages();
+        const password = recoveryCodesPassword.value;
+        const code = recoveryCodesCode.value.trim();
+        if (!password || !code) {
+            recoveryCodesError.textContent = 'Enter your password and a 2FA or recovery code.';
+            recoveryCodesError.style.display = 'block';
+            return;
+        }
+        if (!confirm('Generate new recovery codes? Your current codes will stop working.')) {
+            return;
+        }
+
+        recoveryCodesBtn.disabled = true;
+        try {
+            const codes = await store.regenerateRecoveryCodes(password, code);
+            recoveryCodesPassword.value = '';
+            recoveryCodesCode.value = '';
+            recoveryCodesList.textContent = codes.join('\n');
+            recoveryCodesList.style.display = 'block';
+            showRecoveryCodesLeft();
+        } catch (e) {
+            recoveryCodesError.textContent = e.message;
+            recoveryCodesError.style.display = 'block';
+        } finally {
+            recoveryCodesBtn.disabled = false;
+        }
+    });
+
+    // Sessions Logic
+    async function loadSessions() {
+        try {
+            const sessions = await store.getSessions();
+            sessionsList.innerHTML = '';
+            if (!sessions || sessions.length === 0) {
+                sessionsList.innerHTML = '<p class="text-muted">No active sessions.</p>';
+                return;
+            }
+
+            sessions.forEach(s => {
+                const item = document.createElement('div');
+                item.className = 'passkey-item';
+
+                const infoSpan = document.createElement('span');
+                const lastActive = new Date(s.lastActiveAt * 1000).toLocaleString();
+                infoSpan.textContent = `${s.userAgent || 'Unknown device'} · ${s.ip || 'unknown IP'} · ${lastActive}`;
+                infoSpan.title = s.createdAt ? `Signed in ${new Date(s.createdAt * 1000).toLocaleString()}` : '';
+                if (s.current) {
+                    infoSpan.textContent += ' (this device)';
+                }
+
+                const revokeBtn = document.createElement('button');
+                revokeBtn.className = 'btn btn-danger btn-sm';
+                revokeBtn.textContent = 'Revoke';
+                revokeBtn.onclick = async () => {
+                    const question = s.current ? 'Sign out of this device?' : 'Sign out this session?';
+                    if (confirm(question)) {
+                        try {
+                            await store.revokeSession(s.id);
+                            if (s.current) {
+                                window.location.href = '/login.html';
+                                return;
+                            }
+                            loadSessions();
+                        } catch (e) {
+                            sessionError.textContent = e.message;
+                            sessionError.style.display = 'block';
+                        }
+                    }
+                };
+
+                item.appendChild(infoSpan);
+                item.appendChild(revokeBtn);
+                sessionsList.appendChild(item);
+            });
+        } catch (e) {
+            console.error('Failed to load sessions:', e);
+        }
+    }
+
+    loadSessions();
+
     // Passkeys Logic
     async function loadPasskeys() {
         try {
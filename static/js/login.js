@@ -34,11 +34,14 @@ const handleLogin = async (e) => {
     // Read directly from DOM to support password-managers auto-fill without input events
     const currentUsername = usernameInput ? usernameInput.value : '';
     const currentPassword = passwordInput ? passwordInput.value : '';
-    const currentOtp = otpInput ? otpInput.value : '';
-    const otpVal = currentOtp ? parseInt(currentOtp, 10) : 0;
+    const currentOtp = otpInput ? otpInput.value.trim() : '';
+    // Anything but a numeric code is treated as a recovery code.
+    const isTOTP = /^\d*$/.test(currentOtp);
+    const otpVal = isTOTP && currentOtp ? parseInt(currentOtp, 10) : 0;
+    const recoveryCode = isTOTP ? '' : currentOtp;
 
     try {
-        const result = await store.login(currentUsername, currentPassword, otpVal);
+        const result = await store.login(currentUsername, currentPassword, otpVal, recoveryCode);
         if (result.success) {
             window.location.replace('/');
         } else if (result.needRegister) {
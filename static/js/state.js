@@ -156,9 +156,12 @@ class Store {
     }
 
     // API Actions
-    async login(username, password, otp = 0) {
+    async login(username, password, otp = 0, recoveryCode = '') {
         try {
-            const body = `username=${encodeURIComponent(username)}&password=${encodeURIComponent(password)}&totp=${otp}`;
+            let body = `username=${encodeURIComponent(username)}&password=${encodeURIComponent(password)}&totp=${otp}`;
+            if (recoveryCode) {
+                body += `&recoveryCode=${encodeURIComponent(recoveryCode)}`;
+            }
             const response = await fetch('/api/login', {
                 method: 'POST',
                 headers: { 'Content-Type': 'application/x-www-form-urlencoded' },
@@ -262,6 +265,20 @@ class Store {
         }
     }
 
+    async getSessions() {
+        const response = await fetch('/api/sessions');
+        if (!response.ok) throw new Error('Failed to fetch sessions');
+        return await response.json();
+    }
+
+    async revokeSession(id) {
+        const response = await fetch(`/api/sessions/${encodeURIComponent(id)}`, { method: 'DELETE' });
+        if (!response.ok) {
+            const text = await response.text();
+            throw new Error(text || 'Failed to revoke session');
+        }
+    }
+
     async beginPasskeyRegistration() {
         const response = await fetch('/api/webauthn/register/begin', { method: 'POST' });
         if (!response.ok) {
@@ -479,6 +496,33 @@ class Store {
         }
     }
 
+    // code is a 6-digit 2FA code or one of the current recovery codes.
+    async regenerateRecoveryCodes(password, code) {
+        const body = /^\d{6}$/.test(code)
+            ? { password, totp: parseInt(code, 10) }
+            : { password, recoveryCode: code };
+        const response = await fetch('/api/recovery-codes', {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify(body)
+        });
+        if (!response.ok) {
+            const text = await response.text();
+            let errorMessage = text || 'Failed to generate recovery codes';
+            try {
+                errorMessage = JSON.parse(text)?.message || errorMessage;
+            } catch {
+                // Not a JSON response, use raw text
+            }
+            throw new Error(errorMessage);
+        }
+        const data = await response.json();
+        if (this.state.currentUser) {
+            this.setState({ currentUser: { ...this.state.currentUser, recoveryCodesLeft: data.recoveryCodes.length } });
+        }
+        return data.recoveryCodes;
+    }
+
     async resetPassword() {
         try {
             const response = await fetch('/api/reset-password', {
@@ -675,6 +719,9 @@ class Store {
             case 'read':
                 this.handleReadReceipt(msg);
                 break;
+            case 'expired':
+                this.handleExpired(msg);
+                break;
         }
     }
 
@@ -787,7 +834,11 @@ class Store {
                 })(),
                 rawTimestamp: m.timestamp * 1000,
                 userId: m.userId,
-                attachments: m.attachments || []
+                senderOverride: m.sender || null,
+                attachments: m.attachments || [],
+                expiresAt: m.expiresAt || 0,
+                // Set on the announcement of a disappearing messages timer change.
+                disappearAfter: m.disappearAfter ?? null
             });
         }
 
@@ -816,11 +867,17 @@ class Store {
 
         const maxSeq = mergedMessages.length > 0 ? mergedMessages[mergedMessages.length - 1].seq : 0;
         
-        // Update lastSeq for this chat in state
+        // Update lastSeq for this chat in state, and the disappearing
+        // messages timer if a new message announced a change.
+        const announced = newMessages.filter(m => m.disappearAfter !== null).pop();
         const chats = this.state.chats.map(c => {
             if (c.id === chatId) {
                 const updatedLastSeq = Math.max(c.lastSeq || 0, maxSeq);
-                return { ...c, lastSeq: updatedLastSeq };
+                const updated = { ...c, lastSeq: updatedLastSeq };
+                if (announced && announced.seq > (c.lastSeq || 0)) {
+                    updated.disappearAfter = announced.disappearAfter;
+                }
+                return updated;
             }
             return c;
         });
@@ -917,7 +974,8 @@ class Store {
 
         try {
             const senderUser = this.state.users.find(u => u.id === message.userId);
-            const senderName = senderUser ? (senderUser.displayName || senderUser.userName) : message.userId;
+            const senderName = message.senderOverride?.name
+                || (senderUser ? (senderUser.displayName || senderUser.userName) : message.userId);
             
             const chat = this.state.chats.find(c => c.id === chatId);
             let title = senderName;
@@ -928,7 +986,9 @@ class Store {
             const registration = await navigator.serviceWorker.ready;
             await registration.showNotification(title, {
                 body: message.rawText || message.text,
-                icon: senderUser?.avatarUrl || '/besedka.png',
+                icon: message.senderOverride?.avatarId
+                    ? `/api/images/${encodeURIComponent(message.senderOverride.avatarId)}?thumb=1`
+                    : (senderUser?.avatarUrl || '/besedka.png'),
                 tag: `/?chat=${chatId}`,
                 renotify: true,
                 data: {
@@ -1017,6 +1077,30 @@ class Store {
         }
     }
 
+    handleExpired(msg) {
+        const chatId = msg.chatId;
+        const current = this.state.messages[chatId];
+        if (!current || !msg.seqs) return;
+
+        const expired = new Set(msg.seqs);
+        this.setState({
+            messages: {
+                ...this.state.messages,
+                [chatId]: current.filter(m => !expired.has(m.seq))
+            }
+        });
+    }
+
+    // setDisappearingTimer sets how long new messages in a DM are kept, in
+    // seconds; 0 turns disappearing messages off.
+    setDisappearingTimer(chatId, seconds) {
+        this.sendWebSocketMessage({
+            type: 'setTimer',
+            chatId,
+            disappearAfter: seconds
+        });
+    }
+
     sendWebSocketMessage(msg) {
         if (this.socket && this.socket.readyState === WebSocket.OPEN) {
             this.socket.send(JSON.stringify(msg));
@@ -1037,7 +1121,8 @@ class Store {
     }
 
     fetchMessages(chatId, fromSeq, toSeq) {
-        fromSeq = Math.max(1, fromSeq);
+        const chat = this.state.chats.find(c => c.id === chatId);
+        fromSeq = Math.max(1, chat?.firstSeq || 0, fromSeq);
         if (fromSeq > toSeq) return;
         this.setState({
             isLoadingHistory: {